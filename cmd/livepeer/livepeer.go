@@ -18,6 +18,7 @@ import (
 	"path"
 	"path/filepath"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/livepeer/go-livepeer/pm"
@@ -69,6 +70,10 @@ func main() {
 	httpAddr := flag.String("httpAddr", "", "Address to bind for HTTP commands")
 	serviceAddr := flag.String("serviceAddr", "", "Orchestrator only. Overrides the on-chain serviceURI that broadcasters can use to contact this node; may be an IP or hostname.")
 	orchAddr := flag.String("orchAddr", "", "Orchestrator to connect to as a standalone transcoder")
+	region := flag.String("region", "", "Orchestrator only. Region this node is located in, advertised to broadcasters as a hint for -preferRegions")
+	capabilities := flag.String("capabilities", "", "Orchestrator only. Comma separated features this node supports, advertised to broadcasters for -requiredCapabilities")
+	requiredCapabilities := flag.String("requiredCapabilities", "", "Broadcaster only. Comma separated features orchestrators must advertise with -capabilities to be used")
+	preferRegions := flag.String("preferRegions", "", "Broadcaster only. Comma separated regions to prefer orchestrators in, most preferred first, or \"auto\" to prefer the region with the lowest observed latency")
 
 	// Transcoding:
 	orchestrator := flag.Bool("orchestrator", false, "Set to true to be an orchestrator")
@@ -76,7 +81,43 @@ func main() {
 	broadcaster := flag.Bool("broadcaster", false, "Set to true to be a broadcaster")
 	orchSecret := flag.String("orchSecret", "", "Shared secret with the orchestrator as a standalone transcoder")
 	transcodingOptions := flag.String("transcodingOptions", "P240p30fps16x9,P360p30fps16x9", "Transcoding options for broadcast job")
+	audioOnlyProfile := flag.String("audioOnlyProfile", server.AudioOnlyProfile.Name, "Broadcaster only. Profile streams without video are published under if their audio has its codec, one of A128kAAC, A96kAAC, A64kAAC or A128kMP3. Audio is not re-encoded; playlists advertise the codec and bitrate of the stream")
 	maxSessions := flag.Int("maxSessions", 10, "Maximum number of concurrent transcoding sessions for Orchestrator or maximum number or RTMP streams for Broadcaster")
+	maxSegmentRetries := flag.Int("maxSegmentRetries", server.MaxSegmentRetries, "Maximum number of times a segment is resubmitted to the orchestrator after a failure")
+	segmentRetryBackoff := flag.Duration("segmentRetryBackoff", server.SegmentRetryBackoff, "Backoff before the first resubmission of a failed segment; doubles with every retry")
+	segmentRetryMaxBackoff := flag.Duration("segmentRetryMaxBackoff", server.SegmentRetryMaxBackoff, "Maximum backoff between resubmissions of a failed segment")
+	segmentTimeoutMultiplier := flag.Float64("segmentTimeoutMultiplier", server.SegmentTimeoutMultiplier, "Broadcaster only. Multiple of the segment duration that submitting a segment, and downloading each of its renditions, may take before giving up")
+	segmentRetryDeadline := flag.Duration("segmentRetryDeadline", 0, "Age of a segment after which it is no longer resubmitted; defaults to twice the segment length")
+	maxSegmentSize := flag.Int64("maxSegmentSize", server.MaxSegmentSize, "Maximum size of a source segment in bytes; larger segments are dropped")
+	liveWindow := flag.Uint64("liveWindow", core.LiveWindow, "Broadcaster only. Number of segments a segment may trail the latest one of its rendition by before it is dropped as stale. A source segment trailing by more restarts the segment numbering of the stream")
+	selectionStrategy := flag.String("selectionStrategy", "first", "Broadcaster only. How to select orchestrators: first (to respond), roundrobin, latency (lowest observed), price (lowest), score (best success rate and latency, remembered across restarts) or stake (stake-weighted random)")
+	selectionCandidates := flag.Int("selectionCandidates", server.SelectionCandidates, "Broadcaster only. Number of orchestrators -selectionStrategy chooses between, except for first")
+	probeOrchestrators := flag.Bool("probeOrchestrators", false, "Broadcaster only. Ping orchestrators returned by discovery before starting sessions with them, trying the fastest first")
+	maxOrchLatency := flag.Duration("maxOrchLatency", 0, "Broadcaster only. Skip orchestrators whose ping takes longer than this with -probeOrchestrators. 0 is unlimited")
+	minSessionRefreshInterval := flag.Duration("minSessionRefreshInterval", server.MinSessionRefreshInterval, "Broadcaster only. Minimum time between orchestrator selections for a stream, doubled while its sessions keep failing. 0 is unlimited")
+	compareSubmissions := flag.Bool("compareSubmissions", false, "Broadcaster only. Submit each segment to two orchestrators and only use their renditions if they are identical, submitting to a third if they differ")
+	redundantSubmissions := flag.Int("redundantSubmissions", server.RedundantSubmissions, "Broadcaster only. Number of orchestrators to submit each segment to in parallel; the first result is used")
+	suspensionCooldown := flag.Duration("suspensionCooldown", server.SuspensionCooldown, "Broadcaster only. How long to stop using an orchestrator after it fails; doubles with repeated failures. 0 disables")
+	maxSuspensionCooldown := flag.Duration("maxSuspensionCooldown", server.MaxSuspensionCooldown, "Broadcaster only. Maximum time to stop using a repeatedly failing orchestrator for")
+	verifySegments := flag.Bool("verifySegments", false, "Broadcaster only. Check the resolution, frame rate and bitrate of transcoded segments; orchestrators returning mismatching segments are suspended and the segment resubmitted")
+	verifierURL := flag.String("verifierUrl", "", "Broadcaster only. URL of an external service to verify transcoded segments with, instead of -verifySegments")
+	verifyBitrateTolerance := flag.Float64("verifyBitrateTolerance", 2, "Broadcaster only. How many times the profile bitrate a segment may have and pass -verifySegments")
+	verifyFramerateTolerance := flag.Float64("verifyFramerateTolerance", 0.2, "Broadcaster only. Fraction by which the frame rate of a segment may differ from its profile's and pass -verifySegments")
+	maxStreamsPerMinute := flag.Int("maxStreamsPerMinute", server.MaxStreamsPerMinute, "Broadcaster only. Maximum number of RTMP streams to accept per minute; 0 is unlimited")
+	maxIngestBitrate := flag.Int64("maxIngestBitrate", server.MaxIngestBitrate, "Broadcaster only. Maximum bitrate, in bits per second, to ingest streams at; streams above it are closed. 0 is unlimited")
+	maxPricePerSegment := flag.String("maxPricePerSegment", "0", "Broadcaster only. Maximum expected price per segment, in wei, to pay orchestrators; orchestrators asking more aren't used. 0 is unlimited")
+	localTranscode := flag.Bool("localTranscode", false, "Broadcaster only. Transcode segments on this node when no orchestrator is available")
+	maxLocalTranscodes := flag.Int("maxLocalTranscodes", server.MaxLocalTranscodes, "Broadcaster only. Maximum number of segments to transcode locally at once, to cap the CPU used by -localTranscode")
+	localTranscodeProfiles := flag.Int("localTranscodeProfiles", server.LocalTranscodeProfiles, "Broadcaster only. Number of renditions to transcode locally, lowest resolution first. 0 is all of them")
+	spotCheckRate := flag.Float64("spotCheckRate", server.SpotCheckRate, "Broadcaster only. Fraction of segments to transcode again with a second orchestrator, or locally, to check the renditions of the stream's orchestrator. Requires -spotCheckHasherURL")
+	spotCheckHasherURL := flag.String("spotCheckHasherURL", "", "Broadcaster only. URL of the service computing the perceptual hashes of renditions compared by spot checks")
+	spotCheckMaxDistance := flag.Int("spotCheckMaxDistance", server.SpotCheckMaxDistance, "Broadcaster only. Mean number of bits the perceptual hashes of a spot checked rendition may differ from the reference by before its orchestrator is suspended")
+	drainTimeout := flag.Duration("drainTimeout", 30*time.Second, "Broadcaster only. How long to wait on shutdown for in-flight segments to be transcoded and recordings to be written")
+	segmentLength := flag.Duration("segmentLength", server.SegLen, "Broadcaster only. Length of the segments streams are split into; streams may override it with the segmentLength RTMP URL parameter or auth webhook field, between 1s and 20s")
+	dash := flag.Bool("dash", false, "Broadcaster only. Also package streams as MPEG-DASH, served at /dash/<manifestID>.mpd")
+	record := flag.Bool("record", false, "Broadcaster only. Keep all segments in object storage and write a VOD playlist when streams end; requires -s3bucket or -gsbucket")
+	recordMP4 := flag.Bool("recordMP4", false, "Broadcaster only. Also remux the source rendition of recorded streams into an MP4 file")
+	contentAddressedSegments := flag.Bool("contentAddressedSegments", false, "Broadcaster only. Name segments saved to object storage by the Keccak hash of their data rather than their sequence number")
 	currentManifest := flag.Bool("currentManifest", false, "Expose the currently active ManifestID as \"/stream/current.m3u8\"")
 
 	// Onchain:
@@ -94,6 +135,38 @@ func main() {
 	// Metrics & logging:
 	monitor := flag.Bool("monitor", false, "Set to true to send performance metrics")
 	monUrl := flag.String("monUrl", "", "host name for the metrics data collector")
+	metricsBackend := flag.String("metricsBackend", "prometheus", "Metrics backend to send metrics to: prometheus or statsd")
+	statsdAddr := flag.String("statsdAddr", "", "DogStatsD agent address (host:port) to send metrics to DataDog")
+	otlpEndpoint := flag.String("otlpEndpoint", "", "OpenTelemetry collector address (host:port) to push metrics and segment traces to over OTLP/gRPC")
+	otlpInsecure := flag.Bool("otlpInsecure", false, "Set to true to connect to the OpenTelemetry collector without TLS")
+	metricsPushURL := flag.String("metricsPushURL", "", "Prometheus Pushgateway URL to periodically push metrics to")
+	metricsPushInterval := flag.Duration("metricsPushInterval", 15*time.Second, "How often to push metrics to -metricsPushURL")
+	metricsPushHeaders := flag.String("metricsPushHeaders", "", "Comma-separated list of Name:Value headers to send with pushed metrics, eg for auth")
+	metricsBuckets := flag.String("metricsBuckets", "", "Histogram bucket overrides, eg upload_time_seconds=0,1,2,5;transcode_time_seconds=0,2,4,8")
+	metricsDisableTags := flag.String("metricsDisableTags", "", "Comma-separated list of tags to drop from metrics: node_id, profiles, error_code")
+	metricsAllowTags := flag.String("metricsAllowTags", "", "Comma-separated list of the only optional tags (node_id, profiles, error_code) to keep on metrics")
+	metricsDisableGroups := flag.String("metricsDisableGroups", "", "Comma-separated list of metric view groups to disable at startup: profile, orchestrator, ticket, stream, gpu, storage, debug")
+	streamLabels := flag.String("streamLabels", "", "Comma-separated list of stream labels, set by RTMP URL query params or the auth webhook, to add as tags to per-stream metrics")
+	jaegerEndpoint := flag.String("jaegerEndpoint", "", "Jaeger collector endpoint to export segment traces to, eg http://localhost:14268/api/traces")
+	zipkinEndpoint := flag.String("zipkinEndpoint", "", "Zipkin endpoint to export segment traces to, eg http://localhost:9411/api/v2/spans")
+	traceSampleRate := flag.Float64("traceSampleRate", 0.01, "Fraction of segments to trace when -jaegerEndpoint, -zipkinEndpoint or -otlpEndpoint is set")
+	gpuMetrics := flag.Bool("gpuMetrics", false, "Set to true to export NVIDIA GPU utilization metrics polled via NVML. Requires a build with -tags nvml")
+	perStreamMetrics := flag.Bool("perStreamMetrics", false, "Set to true to tag segment metrics with the stream manifest ID and report the success rate of each stream")
+	successRateWindow := flag.Int("successRateWindow", 30, "Number of most recent segments the success rate of a stream is averaged over")
+	lostSegmentTimeout := flag.Duration("lostSegmentTimeout", 8500*time.Millisecond, "How long a segment can go without being transcoded before it is counted as lost")
+	jsonLogs := flag.Bool("jsonLogs", false, "Set to true to write structured JSON logs for segment processing")
+	logSampleInterval := flag.Duration("logSampleInterval", time.Minute, "How long repeated segment and discovery errors are collapsed into a single summary line for; 0 logs every error")
+	alertWebhookURL := flag.String("alertWebhookURL", "", "Webhook (eg Slack incoming webhook) URL to send threshold alert notifications to")
+	alertMinSuccessRate := flag.Float64("alertMinSuccessRate", 0, "Alert when the success rate stays below this value; 0 disables the alert")
+	alertMaxUploadTime := flag.Duration("alertMaxUploadTime", 0, "Alert when the 95th percentile segment upload time stays above this value; 0 disables the alert")
+	alertNoOrchestrators := flag.Bool("alertNoOrchestrators", false, "Alert when discovery keeps finding no orchestrators")
+	alertFor := flag.Duration("alertFor", 5*time.Minute, "How long an alert condition must hold before the alert fires")
+	sentryDSN := flag.String("sentryDSN", "", "Sentry DSN to report panics in segment processing to")
+	crashWebhookURL := flag.String("crashWebhookURL", "", "URL to POST panics in segment processing to as JSON")
+	eventsWebhookURL := flag.String("eventsWebhookURL", "", "URL to POST structured node events to as JSON")
+	eventsFile := flag.String("eventsFile", "", "Path of a file to append structured node events to as JSON lines")
+	kafkaBrokers := flag.String("kafkaBrokers", "", "Comma-separated list of Kafka brokers to send segment events to")
+	kafkaTopic := flag.String("kafkaTopic", "livepeer-segments", "Kafka topic for segment events")
 	version := flag.Bool("version", false, "Print out the version")
 	verbosity := flag.String("v", "", "Log verbosity.  {4|5|6}")
 	logIPFS := flag.Bool("logIPFS", false, "Set to true if log files should not be generated") // unused until we re-enable IPFS
@@ -108,6 +181,13 @@ func main() {
 
 	// API
 	authWebhookURL := flag.String("authWebhookUrl", "", "RTMP authentication webhook URL")
+	orchWebhookURL := flag.String("orchWebhookUrl", "", "Broadcaster only. URL returning a JSON list of orchestrators to discover, used instead of the on-chain pool")
+	orchCacheTTL := flag.Duration("orchCacheTTL", discovery.CacheTTL, "Broadcaster only. How long orchestrators registered on chain are used for after they were last seen registered")
+	orchCacheRefresh := flag.Duration("orchCacheRefreshInterval", discovery.CacheRefreshInterval, "Broadcaster only. How often the orchestrators registered on chain are fetched")
+	orchWebhookRefresh := flag.Duration("orchWebhookRefreshInterval", time.Minute, "Broadcaster only. How often the orchestrator list is fetched from -orchWebhookUrl")
+	discoveryTimeout := flag.Duration("discoveryTimeout", discovery.DiscoveryTimeout, "Broadcaster only. How long to wait for orchestrators to respond to discovery before using those that did")
+	orchDiscoveryTimeout := flag.Duration("orchDiscoveryTimeout", discovery.OrchestratorTimeout, "Broadcaster only. How long each orchestrator is given to respond to discovery before it is skipped")
+	discoveryCacheTTL := flag.Duration("discoveryCacheTTL", 0, "Broadcaster only. How long discovered orchestrators are queried directly, skipping discovery, while they are refreshed in the background. 0 runs discovery on every refresh")
 
 	flag.Parse()
 	vFlag.Value.Set(*verbosity)
@@ -209,22 +289,147 @@ func main() {
 		glog.Fatalf("Node type not set; must be one of -broadcaster, -transcoder or -orchestrator")
 	}
 
-	if *monitor {
-		glog.Infof("Monitoring endpoint: %s", *monUrl)
+	nodeID := *ethAcctAddr
+	if nodeID == "" {
+		hn, _ := os.Hostname()
+		nodeID = hn
+	}
+	nodeType := "bctr"
+	switch n.NodeType {
+	case core.OrchestratorNode:
+		nodeType = "orch"
+	case core.TranscoderNode:
+		nodeType = "trcr"
+	}
+
+	if *jsonLogs {
+		zl, err := lpmon.NewZapLogger(nodeType, nodeID)
+		if err != nil {
+			glog.Fatalf("Error setting up JSON logging: %v", err)
+		}
+		defer zl.Sync()
+		lpmon.SetLogger(zl)
+	}
+	lpmon.LogSampleInterval = *logSampleInterval
+
+	switch *metricsBackend {
+	case "prometheus":
+	case "statsd":
+		if *statsdAddr == "" {
+			*statsdAddr = lpmon.DefaultStatsDAddr
+		}
+	default:
+		glog.Fatalf("Unknown metrics backend %s; expected prometheus or statsd", *metricsBackend)
+	}
+
+	if *monitor || *statsdAddr != "" || *otlpEndpoint != "" || *metricsPushURL != "" {
 		lpmon.Enabled = true
-		nodeID := *ethAcctAddr
-		if nodeID == "" {
-			hn, _ := os.Hostname()
-			nodeID = hn
+		lpmon.PerStreamMetrics = *perStreamMetrics
+		if *successRateWindow < 1 {
+			glog.Fatalf("-successRateWindow must be at least 1; got %d", *successRateWindow)
+		}
+		lpmon.SuccessRateWindow = *successRateWindow
+		lpmon.LostSegmentTimeout = *lostSegmentTimeout
+		// exemplars link latency histograms to segment traces
+		lpmon.Exemplars = *jaegerEndpoint != "" || *zipkinEndpoint != "" || *otlpEndpoint != ""
+		if *metricsBuckets != "" {
+			buckets, err := lpmon.ParseHistogramBuckets(*metricsBuckets)
+			if err != nil {
+				glog.Fatalf("Error parsing -metricsBuckets: %v", err)
+			}
+			lpmon.HistogramBuckets = buckets
+		}
+		if err := lpmon.SetTagFilter(splitList(*metricsDisableTags), splitList(*metricsAllowTags)); err != nil {
+			glog.Fatalf("Error configuring metrics tags: %v", err)
+		}
+		if *metricsDisableGroups != "" {
+			if err := lpmon.SetDisabledViewGroups(strings.Split(*metricsDisableGroups, ",")); err != nil {
+				glog.Fatalf("Error configuring metrics groups: %v", err)
+			}
 		}
-		nodeType := "bctr"
-		switch n.NodeType {
-		case core.OrchestratorNode:
-			nodeType = "orch"
-		case core.TranscoderNode:
-			nodeType = "trcr"
+		if *streamLabels != "" {
+			if err := lpmon.SetStreamLabels(strings.Split(*streamLabels, ",")); err != nil {
+				glog.Fatalf("Error configuring stream labels: %v", err)
+			}
+		}
+		if *monitor {
+			glog.Infof("Monitoring endpoint: %s", *monUrl)
+			lpmon.Init(*monUrl, nodeType, nodeID, core.LivepeerVersion)
+		}
+		if err := lpmon.InitWithDogStatsD(nodeType, nodeID, core.LivepeerVersion, *statsdAddr); err != nil {
+			glog.Fatalf("Error setting up DogStatsD metrics: %v", err)
+		}
+		if *metricsPushURL != "" {
+			headers := make(map[string]string)
+			for _, h := range strings.Split(*metricsPushHeaders, ",") {
+				if kv := strings.SplitN(h, ":", 2); len(kv) == 2 {
+					headers[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+				}
+			}
+			lpmon.InitWithMetricsPush(nodeType, nodeID, core.LivepeerVersion, *metricsPushURL, *metricsPushInterval, headers)
+		}
+		if *otlpEndpoint != "" {
+			shutdown, err := lpmon.InitWithOTLP(nodeType, nodeID, core.LivepeerVersion, *otlpEndpoint, *otlpInsecure, *traceSampleRate)
+			if err != nil {
+				glog.Fatalf("Error setting up OTLP exporter: %v", err)
+			}
+			defer shutdown(context.Background())
+		}
+		if *gpuMetrics {
+			stopGPUMetrics, err := lpmon.InitGPUMetrics()
+			if err != nil {
+				glog.Fatalf("Error setting up GPU metrics: %v", err)
+			}
+			defer stopGPUMetrics()
+		}
+		if *kafkaBrokers != "" {
+			glog.Infof("Sending segment events to Kafka brokers=%s topic=%s", *kafkaBrokers, *kafkaTopic)
+			sink := lpmon.NewKafkaEventSink(strings.Split(*kafkaBrokers, ","), *kafkaTopic)
+			lpmon.RegisterEventSink(sink)
+			lpmon.RegisterEventBusSink(sink)
+		}
+		if *eventsWebhookURL != "" {
+			glog.Infof("Sending node events to webhook %s", *eventsWebhookURL)
+			lpmon.RegisterEventBusSink(lpmon.NewWebhookEventSink(*eventsWebhookURL))
+		}
+		if *eventsFile != "" {
+			sink, err := lpmon.NewFileEventSink(*eventsFile)
+			if err != nil {
+				glog.Fatalf("Error opening events file %s: %v", *eventsFile, err)
+			}
+			defer sink.Close()
+			lpmon.RegisterEventBusSink(sink)
+		}
+	}
+
+	if *alertWebhookURL != "" {
+		if !lpmon.Enabled {
+			glog.Fatal("-alertWebhookURL requires -monitor or another metrics backend")
+		}
+		var alerts []lpmon.ThresholdAlert
+		if *alertMinSuccessRate > 0 {
+			alerts = append(alerts, lpmon.SuccessRateBelowAlert(*alertMinSuccessRate, *alertFor))
+		}
+		if *alertMaxUploadTime > 0 {
+			alerts = append(alerts, lpmon.UploadTimeP95AboveAlert(*alertMaxUploadTime, *alertFor))
+		}
+		if *alertNoOrchestrators {
+			alerts = append(alerts, lpmon.NoOrchestratorsAlert(*alertFor))
+		}
+		glog.Infof("Sending %d threshold alerts to webhook %s", len(alerts), *alertWebhookURL)
+		lpmon.InitAlerting(*alertWebhookURL, alerts...)
+	}
+
+	if *sentryDSN != "" || *crashWebhookURL != "" {
+		if err := lpmon.InitCrashReporting(nodeType, nodeID, core.LivepeerVersion, *sentryDSN, *crashWebhookURL); err != nil {
+			glog.Fatalf("Error setting up crash reporting: %v", err)
+		}
+	}
+
+	if *jaegerEndpoint != "" || *zipkinEndpoint != "" {
+		if err := lpmon.InitTracing(nodeType, nodeID, *jaegerEndpoint, *zipkinEndpoint, *traceSampleRate); err != nil {
+			glog.Fatalf("Error setting up tracing: %v", err)
 		}
-		lpmon.Init(*monUrl, nodeType, nodeID, core.LivepeerVersion)
 	}
 
 	if n.NodeType == core.TranscoderNode {
@@ -329,6 +534,8 @@ func main() {
 
 		if n.NodeType == core.BroadcasterNode {
 			n.Sender = pm.NewSender(n.Eth)
+			// Setup ticket service to record winning tickets redeemed by orchestrators
+			n.EthServices["TicketService"] = eventservices.NewTicketService(n.Eth)
 		}
 
 		// Start services
@@ -369,6 +576,15 @@ func main() {
 	}
 
 	core.MaxSessions = *maxSessions
+	server.MaxSegmentSize = *maxSegmentSize
+	server.MaxSegmentRetries = *maxSegmentRetries
+	server.SegmentRetryBackoff = *segmentRetryBackoff
+	server.SegmentRetryMaxBackoff = *segmentRetryMaxBackoff
+	server.SegmentRetryDeadline = *segmentRetryDeadline
+	if *segmentTimeoutMultiplier <= 0 {
+		glog.Fatal("-segmentTimeoutMultiplier must be positive")
+	}
+	server.SegmentTimeoutMultiplier = *segmentTimeoutMultiplier
 	if lpmon.Enabled {
 		lpmon.MaxSessions(core.MaxSessions)
 	}
@@ -380,16 +596,110 @@ func main() {
 		*httpAddr = defaultAddr(*httpAddr, "127.0.0.1", RpcPort)
 
 		// Set up orchestrator discovery
+		if *discoveryTimeout <= 0 || *orchDiscoveryTimeout <= 0 {
+			glog.Fatal("-discoveryTimeout and -orchDiscoveryTimeout must be positive")
+		}
+		discovery.DiscoveryTimeout = *discoveryTimeout
+		discovery.OrchestratorTimeout = *orchDiscoveryTimeout
 		if len(orchAddresses) > 0 {
 			n.OrchestratorPool = discovery.NewOrchestratorPool(n, orchAddresses)
+		} else if *orchWebhookURL != "" {
+			whurl, err := getAuthWebhookURL(*orchWebhookURL)
+			if err != nil {
+				glog.Fatal("Error setting orch webhook URL ", err)
+			}
+			n.OrchestratorPool = discovery.NewWebhookPool(n, whurl, *orchWebhookRefresh)
 		} else if *network != "offchain" {
+			if *orchCacheRefresh <= 0 {
+				glog.Fatal("-orchCacheRefreshInterval must be positive")
+			}
+			discovery.CacheTTL = *orchCacheTTL
+			discovery.CacheRefreshInterval = *orchCacheRefresh
 			n.OrchestratorPool = discovery.NewDBOrchestratorPoolCache(n)
 		}
 		if n.OrchestratorPool == nil {
 			// Not a fatal error; may continue operating in segment-only mode
 			glog.Error("No orchestrator specified; transcoding will not happen")
+		} else if *discoveryCacheTTL > 0 {
+			n.OrchestratorPool = discovery.NewCachedPool(n, n.OrchestratorPool, *discoveryCacheTTL)
 		}
 		var err error
+		var stake func(ethcommon.Address) (*big.Int, error)
+		if n.Eth != nil {
+			stake = func(addr ethcommon.Address) (*big.Int, error) {
+				t, err := n.Eth.GetTranscoder(addr)
+				if err != nil {
+					return nil, err
+				}
+				return t.DelegatedStake, nil
+			}
+		}
+		server.OrchSelection, err = server.NewSelectionStrategy(*selectionStrategy, stake)
+		if err != nil {
+			glog.Fatalf("Error setting up orchestrator selection: %v", err)
+		}
+		server.SelectionCandidates = *selectionCandidates
+		server.ProbeOrchestrators = *probeOrchestrators
+		server.MaxProbeLatency = *maxOrchLatency
+		server.RedundantSubmissions = *redundantSubmissions
+		server.CompareSubmissions = *compareSubmissions
+		server.MinSessionRefreshInterval = *minSessionRefreshInterval
+		if *preferRegions != "" {
+			server.PreferredRegions = splitList(*preferRegions)
+		}
+		if *requiredCapabilities != "" {
+			server.RequiredCapabilities = strings.Split(*requiredCapabilities, ",")
+		}
+		server.SuspensionCooldown = *suspensionCooldown
+		server.MaxSuspensionCooldown = *maxSuspensionCooldown
+		if *segmentLength < server.MinSegLen || *segmentLength > server.MaxSegLen {
+			glog.Fatalf("-segmentLength must be between %v and %v", server.MinSegLen, server.MaxSegLen)
+		}
+		server.SegLen = *segmentLength
+		core.LiveWindow = *liveWindow
+		if p, ok := common.AudioProfileLookup[*audioOnlyProfile]; ok {
+			server.AudioOnlyProfile = p
+		} else {
+			glog.Fatalf("Unknown -audioOnlyProfile %v", *audioOnlyProfile)
+		}
+		if server.BroadcastPrice, err = common.ParseBigInt(*maxPricePerSegment); err != nil || server.BroadcastPrice.Sign() < 0 {
+			glog.Fatalf("Invalid -maxPricePerSegment %v", *maxPricePerSegment)
+		}
+		server.MaxStreamsPerMinute = *maxStreamsPerMinute
+		server.MaxIngestBitrate = *maxIngestBitrate
+		if *localTranscode {
+			if *maxLocalTranscodes <= 0 {
+				glog.Fatal("-maxLocalTranscodes must be positive")
+			}
+			n.Transcoder = core.NewLocalTranscoder(n.WorkDir)
+			server.LocalTranscoder = n.Transcoder
+			server.LocalTranscodeDir = n.WorkDir
+			server.MaxLocalTranscodes = *maxLocalTranscodes
+			server.LocalTranscodeProfiles = *localTranscodeProfiles
+		}
+		if *spotCheckRate < 0 || *spotCheckRate > 1 {
+			glog.Fatal("-spotCheckRate must be between 0 and 1")
+		}
+		if *spotCheckRate > 0 {
+			if *spotCheckHasherURL == "" {
+				glog.Fatal("-spotCheckRate requires -spotCheckHasherURL")
+			}
+			server.SpotCheckRate = *spotCheckRate
+			server.SpotCheckHasher = server.NewExternalHasher(*spotCheckHasherURL)
+			server.SpotCheckMaxDistance = *spotCheckMaxDistance
+		}
+		if *verifierURL != "" {
+			server.SegmentVerifier = server.NewExternalVerifier(*verifierURL)
+		} else if *verifySegments {
+			server.SegmentVerifier = &server.LocalVerifier{BitrateTolerance: *verifyBitrateTolerance, FramerateTolerance: *verifyFramerateTolerance}
+		}
+		server.EnableDASH = *dash
+		if *record && drivers.NodeStorage == nil {
+			glog.Fatal("-record requires -s3bucket or -gsbucket to keep segments in")
+		}
+		server.EnableRecording = *record
+		server.RecordMP4 = *recordMP4
+		server.ContentAddressedSegments = *contentAddressedSegments
 		if server.AuthWebhookURL, err = getAuthWebhookURL(*authWebhookURL); err != nil {
 			glog.Fatal("Error setting auth webhook URL ", err)
 		}
@@ -399,6 +709,10 @@ func main() {
 			glog.Fatal("Error getting service URI: ", err)
 		}
 		n.SetServiceURI(suri)
+		server.OrchestratorRegion = *region
+		if *capabilities != "" {
+			server.OrchestratorCapabilities = strings.Split(*capabilities, ",")
+		}
 		// if http addr is not provided, listen to all ifaces
 		// take the port to listen to from the service URI
 		*httpAddr = defaultAddr(*httpAddr, "", n.GetServiceURI().Port())
@@ -488,7 +802,7 @@ func main() {
 	}
 
 	c := make(chan os.Signal)
-	signal.Notify(c, os.Interrupt)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
 	select {
 	case err := <-ec:
 		glog.Infof("Error from media server: %v", err)
@@ -503,6 +817,9 @@ func main() {
 		return
 	case sig := <-c:
 		glog.Infof("Exiting Livepeer: %v", sig)
+		if n.NodeType == core.BroadcasterNode {
+			s.Drain(*drainTimeout)
+		}
 		time.Sleep(time.Millisecond * 500) //Give time for other processes to shut down completely
 		return
 	}
@@ -624,3 +941,15 @@ func defaultAddr(addr, defaultHost, defaultPort string) string {
 	}
 	return addr
 }
+
+// splitList splits a comma separated flag value, dropping the spaces around
+// entries and empty entries
+func splitList(s string) []string {
+	var res []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			res = append(res, v)
+		}
+	}
+	return res
+}
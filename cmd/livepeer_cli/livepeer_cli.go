@@ -82,6 +82,7 @@ func (w *wizard) initializeOptions() []wizardOpt {
 	options := []wizardOpt{
 		{desc: "Get node status", invoke: func() { w.stats(w.orchestrator) }},
 		{desc: "View protocol parameters", invoke: w.protocolStats},
+		{desc: "View node metrics", invoke: w.metricsStats},
 		{desc: "List registered orchestrators", invoke: func() { w.registeredOrchestratorStats() }},
 		{desc: "Invoke \"initialize round\"", invoke: w.initializeRound},
 		{desc: "Invoke \"bond\"", invoke: w.bond},
@@ -14,6 +14,7 @@ import (
 	"github.com/golang/glog"
 	"github.com/livepeer/go-livepeer/eth"
 	lpTypes "github.com/livepeer/go-livepeer/eth/types"
+	"github.com/livepeer/go-livepeer/monitor"
 	"github.com/olekukonko/tablewriter"
 )
 
@@ -377,6 +378,93 @@ func (w *wizard) getOrchestratorInfo() (lpTypes.Transcoder, error) {
 	return tInfo, nil
 }
 
+// Views shown at the top of the metrics snapshot, with their labels
+var metricsSummaryViews = []struct{ name, label string }{
+	{"current_sessions_total", "Current Sessions"},
+	{"max_sessions_total", "Max Sessions"},
+	{"success_rate", "Success Rate"},
+	{"segment_source_emerged_total", "Segments Emerged"},
+	{"segment_transcoded_all_appeared_total", "Segments Transcoded"},
+	{"segment_transcode_failed_total", "Segments Failed"},
+	{"transcode_latency_seconds", "Transcode Latency (s)"},
+	{"upload_time_seconds", "Upload Time (s)"},
+	{"orch_transcode_queue_depth", "Transcode Queue Depth"},
+}
+
+func (w *wizard) metricsStats() {
+	snapshot, err := w.getMetricsSnapshot()
+	if err != nil {
+		glog.Errorf("Error getting metrics snapshot (is the node running with -monitor?): %v", err)
+		return
+	}
+
+	fmt.Println("+------------+")
+	fmt.Println("|NODE METRICS|")
+	fmt.Println("+------------+")
+
+	table := tablewriter.NewWriter(os.Stdout)
+	for _, sv := range metricsSummaryViews {
+		v := snapshot.Find(sv.name)
+		if v == nil {
+			continue
+		}
+		table.Append([]string{sv.label, formatViewSnapshot(v)})
+	}
+	table.SetAlignment(tablewriter.ALIGN_RIGHT)
+	table.SetCenterSeparator("*")
+	table.SetRowLine(true)
+	table.SetColumnSeparator("|")
+	table.Render()
+
+	fmt.Printf("Show all %d metrics? (y/n) - ", len(snapshot.Views))
+	if w.readStringYesOrNo() != "y" {
+		return
+	}
+
+	table = tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Metric", "Value"})
+	for _, v := range snapshot.Views {
+		table.Append([]string{v.Name, formatViewSnapshot(v)})
+	}
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	table.SetCenterSeparator("*")
+	table.SetColumnSeparator("|")
+	table.Render()
+}
+
+func formatViewSnapshot(v *monitor.ViewSnapshot) string {
+	if v.Count > 0 {
+		return fmt.Sprintf("mean %.3g, p50 <= %g, p95 <= %g (%d samples)", v.Value, v.P50, v.P95, v.Count)
+	}
+	return strconv.FormatFloat(v.Value, 'f', -1, 64)
+}
+
+func (w *wizard) getMetricsSnapshot() (*monitor.MetricsSnapshot, error) {
+	resp, err := http.Get(fmt.Sprintf("http://%v:%v/metrics/snapshot", w.host, w.httpPort))
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New(resp.Status)
+	}
+
+	result, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var snapshot monitor.MetricsSnapshot
+	err = json.Unmarshal(result, &snapshot)
+	if err != nil {
+		return nil, err
+	}
+
+	return &snapshot, nil
+}
+
 func (w *wizard) getOrchestratorEventSubscriptions() (map[string]bool, error) {
 	resp, err := http.Get(fmt.Sprintf("http://%v:%v/orchestratorEventSubscriptions", w.host, w.httpPort))
 	if err != nil {
@@ -0,0 +1,63 @@
+package common
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/ericxtang/m3u8"
+	ffmpeg "github.com/livepeer/lpms/ffmpeg"
+)
+
+// AudioProfile describes the rendition of a stream without a video track
+type AudioProfile struct {
+	Name    string
+	Bitrate string
+	Codec   string
+}
+
+// Audio codecs RTMP carries and their HLS CODECS attribute
+var audioCodecTags = map[string]string{
+	"aac": "mp4a.40.2",
+	"mp3": "mp4a.40.34",
+}
+
+var (
+	A128kAAC = AudioProfile{Name: "A128kAAC", Bitrate: "128k", Codec: "aac"}
+	A96kAAC  = AudioProfile{Name: "A96kAAC", Bitrate: "96k", Codec: "aac"}
+	A64kAAC  = AudioProfile{Name: "A64kAAC", Bitrate: "64k", Codec: "aac"}
+	A128kMP3 = AudioProfile{Name: "A128kMP3", Bitrate: "128k", Codec: "mp3"}
+)
+
+// DefaultAudioProfiles are the profiles streams with each audio codec are
+// published under unless configured otherwise
+var DefaultAudioProfiles = map[string]AudioProfile{
+	"aac": A128kAAC,
+	"mp3": A128kMP3,
+}
+
+var AudioProfileLookup = map[string]AudioProfile{
+	"A128kAAC": A128kAAC,
+	"A96kAAC":  A96kAAC,
+	"A64kAAC":  A64kAAC,
+	"A128kMP3": A128kMP3,
+}
+
+// VideoProfile returns the profile playlists track the audio rendition by:
+// named after the audio profile and without a resolution. Its bitrate may be
+// set to that of the stream, which playlists then advertise.
+func (p AudioProfile) VideoProfile() ffmpeg.VideoProfile {
+	return ffmpeg.VideoProfile{Name: p.Name, Bitrate: p.Bitrate}
+}
+
+// IsAudioProfile returns true if p is the video profile of an audio profile
+func IsAudioProfile(p ffmpeg.VideoProfile) bool {
+	_, ok := AudioProfileLookup[p.Name]
+	return ok && p.Resolution == ""
+}
+
+// AudioProfileToVariantParams returns the master playlist attributes of an
+// audio-only rendition, which carry its codec in place of a resolution
+func AudioProfileToVariantParams(p AudioProfile) m3u8.VariantParams {
+	bw, _ := strconv.ParseUint(strings.Replace(p.Bitrate, "k", "000", 1), 10, 32)
+	return m3u8.VariantParams{Bandwidth: uint32(bw), Codecs: audioCodecTags[p.Codec]}
+}
@@ -3,10 +3,12 @@ package common
 import (
 	"bytes"
 	"database/sql"
+	"fmt"
 	"math/big"
 	"strconv"
 	"strings"
 	"text/template"
+	"time"
 
 	ethcommon "github.com/ethereum/go-ethereum/common"
 	"github.com/golang/glog"
@@ -27,11 +29,49 @@ type DB struct {
 	unbondingLocks             *sql.Stmt
 	withdrawableUnbondingLocks *sql.Stmt
 	insertWinningTicket        *sql.Stmt
+	insertStreamStats          *sql.Stmt
+	updateOrchestratorScore    *sql.Stmt
+	insertOrchestratorPrice    *sql.Stmt
 }
 
 type DBOrch struct {
 	ServiceURI   string
 	EthereumAddr string
+	// Delegated stake as of when the orchestrator was cached; nil if unknown
+	Stake *big.Int
+}
+
+// DBStreamStats is the summary of an ended stream
+type DBStreamStats struct {
+	ManifestID         string    `json:"manifestID"`
+	Nonce              uint64    `json:"nonce"`
+	StartedAt          time.Time `json:"startedAt"`
+	EndedAt            time.Time `json:"endedAt"`
+	SegmentsEmerged    int64     `json:"segmentsEmerged"`
+	SegmentsTranscoded int64     `json:"segmentsTranscoded"`
+	SegmentsFailed     int64     `json:"segmentsFailed"`
+	AvgLatency         float64   `json:"avgLatencySeconds"`
+	Orchestrators      []string  `json:"orchestrators"`
+	FeesSent           *big.Int  `json:"feesSent"`
+}
+
+// DBOrchestratorScore is the performance of an orchestrator as observed by
+// this node across streams
+type DBOrchestratorScore struct {
+	Transcoder string    `json:"transcoder"`
+	UpdatedAt  time.Time `json:"updatedAt"`
+	Segments   int64     `json:"segments"`
+	Failures   int64     `json:"failures"`
+	LatencyP50 float64   `json:"latencyP50Seconds"`
+	LatencyP95 float64   `json:"latencyP95Seconds"`
+}
+
+// DBOrchestratorPrice is the price an orchestrator asked for at some point,
+// as the expected value of a ticket in wei
+type DBOrchestratorPrice struct {
+	Transcoder string    `json:"transcoder"`
+	CreatedAt  time.Time `json:"createdAt"`
+	Price      *big.Rat  `json:"price"`
 }
 
 type DBUnbondingLock struct {
@@ -41,7 +81,15 @@ type DBUnbondingLock struct {
 	WithdrawRound int64
 }
 
-var LivepeerDBVersion = 1
+var LivepeerDBVersion = 2
+
+// migrations[v] upgrades the schema of a DB at version v to version v+1
+var migrations = map[int]func(*sql.DB) error{
+	1: func(db *sql.DB) error {
+		_, err := db.Exec("ALTER TABLE orchestrators ADD COLUMN stake TEXT")
+		return err
+	},
+}
 
 var ErrDBTooNew = errors.New("DB Too New")
 
@@ -58,7 +106,8 @@ var schema = `
 		ethereumAddr STRING PRIMARY KEY,
 		createdAt STRING DEFAULT CURRENT_TIMESTAMP NOT NULL,
 		updatedAt STRING DEFAULT CURRENT_TIMESTAMP NOT NULL,
-		serviceURI STRING
+		serviceURI STRING,
+		stake TEXT
 	);
 
 	CREATE TABLE IF NOT EXISTS unbondingLocks (
@@ -87,6 +136,39 @@ var schema = `
 	);
 
 	CREATE INDEX IF NOT EXISTS idx_winningtickets_sessionid ON winningTickets(sessionID);
+
+	CREATE TABLE IF NOT EXISTS streamStats (
+		createdAt STRING DEFAULT CURRENT_TIMESTAMP,
+		manifestID STRING,
+		nonce INTEGER,
+		startedAt INTEGER,
+		endedAt INTEGER,
+		segmentsEmerged INTEGER,
+		segmentsTranscoded INTEGER,
+		segmentsFailed INTEGER,
+		avgLatency REAL,
+		orchestrators STRING,
+		feesSent TEXT
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_streamstats_manifestid ON streamStats(manifestID);
+
+	CREATE TABLE IF NOT EXISTS orchestratorScores (
+		transcoder STRING PRIMARY KEY,
+		updatedAt INTEGER,
+		segments INTEGER,
+		failures INTEGER,
+		latencyP50 REAL,
+		latencyP95 REAL
+	);
+
+	CREATE TABLE IF NOT EXISTS orchestratorPrices (
+		createdAt INTEGER,
+		transcoder STRING,
+		price TEXT
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_orchestratorprices_transcoder ON orchestratorPrices(transcoder);
 `
 
 func NewDBOrch(serviceURI string, orchAddr string) *DBOrch {
@@ -133,21 +215,33 @@ func InitDB(dbPath string) (*DB, error) {
 	} else if dbVersion < LivepeerDBVersion {
 		// Upgrade stepwise up to the correct version using the migration
 		// procedure for each version
+		for v := dbVersion; v < LivepeerDBVersion; v++ {
+			if err := migrations[v](db); err != nil {
+				glog.Errorf("Error migrating DB from version %d: %v", v, err)
+				d.Close()
+				return nil, err
+			}
+			if _, err := db.Exec("UPDATE kv SET value=?, updatedAt = datetime() WHERE key='dbVersion'", v+1); err != nil {
+				glog.Error("Unable to update DB version ", err)
+				d.Close()
+				return nil, err
+			}
+		}
 	} else if dbVersion == LivepeerDBVersion {
 		// all good; nothing to do
 	}
 
-	// select all orchestrators updated in the last 24 hours
-	stmt, err := db.Prepare("SELECT serviceURI, ethereumAddr FROM orchestrators WHERE updatedAt >= datetime('now','-1 day')")
+	// select all orchestrators updated since a time modifier, as in '-1 day'
+	stmt, err := db.Prepare("SELECT serviceURI, ethereumAddr, stake FROM orchestrators WHERE updatedAt >= datetime('now', ?)")
 	if err != nil {
-		glog.Error("Unable to select orchestrators updated in the past 24 hours", err)
+		glog.Error("Unable to prepare selectOrchs stmt ", err)
 		d.Close()
 		return nil, err
 	}
 	d.selectOrchs = stmt
 
 	// updateOrchestrators statement
-	stmt, err = db.Prepare("INSERT OR REPLACE INTO orchestrators(updatedAt, serviceURI, ethereumAddr, createdAt) VALUES(datetime(), ?1, ?2, (SELECT createdAt FROM orchestrators WHERE ethereumAddr = ?2))")
+	stmt, err = db.Prepare("INSERT OR REPLACE INTO orchestrators(updatedAt, serviceURI, ethereumAddr, stake, createdAt) VALUES(datetime(), ?1, ?2, ?3, (SELECT createdAt FROM orchestrators WHERE ethereumAddr = ?2))")
 	if err != nil {
 		glog.Error("Unable to prepare updateOrchestrators stmt ", err)
 		d.Close()
@@ -203,6 +297,31 @@ func InitDB(dbPath string) (*DB, error) {
 	}
 	d.insertWinningTicket = stmt
 
+	// Stream stats prepared statements
+	stmt, err = db.Prepare("INSERT INTO streamStats(manifestID, nonce, startedAt, endedAt, segmentsEmerged, segmentsTranscoded, segmentsFailed, avgLatency, orchestrators, feesSent) VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?)")
+	if err != nil {
+		glog.Error("Unable to prepare insertStreamStats ", err)
+		d.Close()
+		return nil, err
+	}
+	d.insertStreamStats = stmt
+
+	// Orchestrator score prepared statements
+	stmt, err = db.Prepare("INSERT OR REPLACE INTO orchestratorScores(transcoder, updatedAt, segments, failures, latencyP50, latencyP95) VALUES(?, ?, ?, ?, ?, ?)")
+	if err != nil {
+		glog.Error("Unable to prepare updateOrchestratorScore ", err)
+		d.Close()
+		return nil, err
+	}
+	d.updateOrchestratorScore = stmt
+	stmt, err = db.Prepare("INSERT INTO orchestratorPrices(createdAt, transcoder, price) VALUES(?, ?, ?)")
+	if err != nil {
+		glog.Error("Unable to prepare insertOrchestratorPrice ", err)
+		d.Close()
+		return nil, err
+	}
+	d.insertOrchestratorPrice = stmt
+
 	glog.V(DEBUG).Info("Initialized DB node")
 	return &d, nil
 }
@@ -233,6 +352,15 @@ func (db *DB) Close() {
 	if db.insertWinningTicket != nil {
 		db.insertWinningTicket.Close()
 	}
+	if db.insertStreamStats != nil {
+		db.insertStreamStats.Close()
+	}
+	if db.updateOrchestratorScore != nil {
+		db.updateOrchestratorScore.Close()
+	}
+	if db.insertOrchestratorPrice != nil {
+		db.insertOrchestratorPrice.Close()
+	}
 	if db.dbh != nil {
 		db.dbh.Close()
 	}
@@ -272,7 +400,11 @@ func (db *DB) UpdateOrch(orch *DBOrch) error {
 		return nil
 	}
 
-	_, err := db.updateOrch.Exec(orch.ServiceURI, orch.EthereumAddr)
+	var stake interface{}
+	if orch.Stake != nil {
+		stake = orch.Stake.String()
+	}
+	_, err := db.updateOrch.Exec(orch.ServiceURI, orch.EthereumAddr, stake)
 	if err != nil {
 		glog.Error("db: Unable to update orchestrator ", err)
 	}
@@ -280,28 +412,38 @@ func (db *DB) UpdateOrch(orch *DBOrch) error {
 	return err
 }
 
+// SelectOrchs returns the orchestrators updated in the last 24 hours
 func (db *DB) SelectOrchs() ([]*DBOrch, error) {
+	return db.SelectOrchsUpdatedWithin(24 * time.Hour)
+}
+
+// SelectOrchsUpdatedWithin returns the orchestrators updated within ttl
+func (db *DB) SelectOrchsUpdatedWithin(ttl time.Duration) ([]*DBOrch, error) {
 	if db == nil {
 		return nil, nil
 	}
 
-	rows, err := db.selectOrchs.Query()
-	defer rows.Close()
+	rows, err := db.selectOrchs.Query(fmt.Sprintf("-%d seconds", int64(ttl.Seconds())))
 	if err != nil {
-		glog.Error("db: Unable to get orchestrators updated in the last 24 hours", err)
+		glog.Errorf("db: Unable to get orchestrators updated in the last %v: %v", ttl, err)
 		return nil, err
 	}
+	defer rows.Close()
 	orchs := []*DBOrch{}
 	for rows.Next() {
 		var orch DBOrch
 		var serviceURI string
 		var ethereumAddr string
-		if err := rows.Scan(&serviceURI, &ethereumAddr); err != nil {
+		var stake sql.NullString
+		if err := rows.Scan(&serviceURI, &ethereumAddr, &stake); err != nil {
 			glog.Error("db: Unable to fetch orchestrator ", err)
 			continue
 		}
 		orch.ServiceURI = serviceURI
 		orch.EthereumAddr = ethereumAddr
+		if stake.Valid {
+			orch.Stake, _ = new(big.Int).SetString(stake.String, 10)
+		}
 		orchs = append(orchs, &orch)
 	}
 	return orchs, nil
@@ -451,6 +593,149 @@ func (db *DB) LoadWinningTickets(sessionIDs []string) (tickets []*pm.Ticket, sig
 	return
 }
 
+// InsertStreamStats stores the summary of an ended stream. Orchestrators are
+// stored comma separated, and fees as a decimal string.
+func (db *DB) InsertStreamStats(s *DBStreamStats) error {
+	if db == nil || s == nil {
+		return nil
+	}
+	glog.V(DEBUG).Infof("db: Inserting stream stats for manifestID %v nonce %v", s.ManifestID, s.Nonce)
+	fees := "0"
+	if s.FeesSent != nil {
+		fees = s.FeesSent.String()
+	}
+	_, err := db.insertStreamStats.Exec(s.ManifestID, int64(s.Nonce), s.StartedAt.Unix(), s.EndedAt.Unix(), s.SegmentsEmerged,
+		s.SegmentsTranscoded, s.SegmentsFailed, s.AvgLatency, strings.Join(s.Orchestrators, ","), fees)
+	if err != nil {
+		return errors.Wrapf(err, "failed inserting stream stats for manifestID: %v", s.ManifestID)
+	}
+	return nil
+}
+
+// StreamStats returns the summaries of the most recently ended streams, newest
+// first, up to limit. An empty manifestID returns all streams.
+func (db *DB) StreamStats(manifestID string, limit int) ([]*DBStreamStats, error) {
+	if db == nil {
+		return []*DBStreamStats{}, nil
+	}
+	query := "SELECT manifestID, nonce, startedAt, endedAt, segmentsEmerged, segmentsTranscoded, segmentsFailed, avgLatency, orchestrators, feesSent FROM streamStats"
+	args := []interface{}{}
+	if manifestID != "" {
+		query += " WHERE manifestID = ?"
+		args = append(args, manifestID)
+	}
+	query += " ORDER BY endedAt DESC, rowid DESC LIMIT ?"
+	args = append(args, limit)
+	rows, err := db.dbh.Query(query, args...)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed loading stream stats for manifestID: %v", manifestID)
+	}
+	defer rows.Close()
+
+	res := []*DBStreamStats{}
+	for rows.Next() {
+		var (
+			s                  DBStreamStats
+			nonce              int64
+			startedAt, endedAt int64
+			orchs, fees        string
+		)
+		if err := rows.Scan(&s.ManifestID, &nonce, &startedAt, &endedAt, &s.SegmentsEmerged, &s.SegmentsTranscoded,
+			&s.SegmentsFailed, &s.AvgLatency, &orchs, &fees); err != nil {
+			return nil, errors.Wrapf(err, "failed scanning stream stats for manifestID: %v", manifestID)
+		}
+		s.Nonce = uint64(nonce)
+		s.StartedAt = time.Unix(startedAt, 0)
+		s.EndedAt = time.Unix(endedAt, 0)
+		if orchs != "" {
+			s.Orchestrators = strings.Split(orchs, ",")
+		}
+		s.FeesSent, _ = new(big.Int).SetString(fees, 10)
+		res = append(res, &s)
+	}
+	return res, nil
+}
+
+// UpdateOrchestratorScore stores the score of an orchestrator, replacing the
+// previous one
+func (db *DB) UpdateOrchestratorScore(s *DBOrchestratorScore) error {
+	if db == nil || s == nil {
+		return nil
+	}
+	_, err := db.updateOrchestratorScore.Exec(s.Transcoder, s.UpdatedAt.Unix(), s.Segments, s.Failures, s.LatencyP50, s.LatencyP95)
+	if err != nil {
+		return errors.Wrapf(err, "failed updating score for orchestrator: %v", s.Transcoder)
+	}
+	return nil
+}
+
+// OrchestratorScores returns the stored scores of all orchestrators
+func (db *DB) OrchestratorScores() ([]*DBOrchestratorScore, error) {
+	if db == nil {
+		return []*DBOrchestratorScore{}, nil
+	}
+	rows, err := db.dbh.Query("SELECT transcoder, updatedAt, segments, failures, latencyP50, latencyP95 FROM orchestratorScores")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed loading orchestrator scores")
+	}
+	defer rows.Close()
+
+	res := []*DBOrchestratorScore{}
+	for rows.Next() {
+		var (
+			s         DBOrchestratorScore
+			updatedAt int64
+		)
+		if err := rows.Scan(&s.Transcoder, &updatedAt, &s.Segments, &s.Failures, &s.LatencyP50, &s.LatencyP95); err != nil {
+			return nil, errors.Wrap(err, "failed scanning orchestrator scores")
+		}
+		s.UpdatedAt = time.Unix(updatedAt, 0)
+		res = append(res, &s)
+	}
+	return res, nil
+}
+
+// InsertOrchestratorPrice adds a price to the price history of an orchestrator
+func (db *DB) InsertOrchestratorPrice(p *DBOrchestratorPrice) error {
+	if db == nil || p == nil || p.Price == nil {
+		return nil
+	}
+	_, err := db.insertOrchestratorPrice.Exec(p.CreatedAt.Unix(), p.Transcoder, p.Price.String())
+	if err != nil {
+		return errors.Wrapf(err, "failed inserting price for orchestrator: %v", p.Transcoder)
+	}
+	return nil
+}
+
+// OrchestratorPrices returns the price history of an orchestrator, newest
+// first, up to limit
+func (db *DB) OrchestratorPrices(transcoder string, limit int) ([]*DBOrchestratorPrice, error) {
+	if db == nil {
+		return []*DBOrchestratorPrice{}, nil
+	}
+	rows, err := db.dbh.Query("SELECT createdAt, transcoder, price FROM orchestratorPrices WHERE transcoder = ? ORDER BY createdAt DESC, rowid DESC LIMIT ?", transcoder, limit)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed loading prices for orchestrator: %v", transcoder)
+	}
+	defer rows.Close()
+
+	res := []*DBOrchestratorPrice{}
+	for rows.Next() {
+		var (
+			p         DBOrchestratorPrice
+			createdAt int64
+			price     string
+		)
+		if err := rows.Scan(&createdAt, &p.Transcoder, &price); err != nil {
+			return nil, errors.Wrapf(err, "failed scanning prices for orchestrator: %v", transcoder)
+		}
+		p.CreatedAt = time.Unix(createdAt, 0)
+		p.Price, _ = new(big.Rat).SetString(price)
+		res = append(res, &p)
+	}
+	return res, nil
+}
+
 // We are building a query string instead of using a prepared statement because prepared statements don't
 // support IN queries. We want to use IN for the performance benefit, rather than running len(sessionIDs)
 // queries.
@@ -6,6 +6,7 @@ import (
 	"math"
 	"math/big"
 	"testing"
+	"time"
 
 	ethcommon "github.com/ethereum/go-ethereum/common"
 	"github.com/livepeer/go-livepeer/pm"
@@ -106,6 +107,69 @@ func TestDBVersion(t *testing.T) {
 	}
 }
 
+func TestDBMigration(t *testing.T) {
+	require := require.New(t)
+	assert := assert.New(t)
+
+	// a version 1 DB, without orchestrator stakes
+	raw, err := sql.Open("sqlite3", dbPath(t))
+	require.Nil(err)
+	defer raw.Close()
+	_, err = raw.Exec(`
+		CREATE TABLE kv (key STRING PRIMARY KEY, value STRING, updatedAt STRING DEFAULT CURRENT_TIMESTAMP);
+		INSERT INTO kv(key, value) VALUES('dbVersion', '1');
+		CREATE TABLE orchestrators (
+			ethereumAddr STRING PRIMARY KEY,
+			createdAt STRING DEFAULT CURRENT_TIMESTAMP NOT NULL,
+			updatedAt STRING DEFAULT CURRENT_TIMESTAMP NOT NULL,
+			serviceURI STRING
+		);
+		INSERT INTO orchestrators(ethereumAddr, serviceURI) VALUES('0x1', '127.0.0.1:8936');`)
+	require.Nil(err)
+
+	dbh, err := InitDB(dbPath(t))
+	require.Nil(err)
+	defer dbh.Close()
+	var dbVersion int
+	require.Nil(raw.QueryRow("SELECT value FROM kv WHERE key = 'dbVersion'").Scan(&dbVersion))
+	assert.Equal(LivepeerDBVersion, dbVersion)
+
+	orchs, err := dbh.SelectOrchs()
+	require.Nil(err)
+	require.Len(orchs, 1)
+	assert.Nil(orchs[0].Stake)
+
+	orch := NewDBOrch("127.0.0.1:8936", "0x1")
+	orch.Stake = big.NewInt(500)
+	require.Nil(dbh.UpdateOrch(orch))
+	orchs, err = dbh.SelectOrchs()
+	require.Nil(err)
+	require.Len(orchs, 1)
+	assert.Equal(int64(500), orchs[0].Stake.Int64())
+}
+
+func TestSelectOrchsUpdatedWithin(t *testing.T) {
+	dbh, dbraw, err := TempDB(t)
+	require := require.New(t)
+	require.Nil(err)
+	defer dbh.Close()
+	defer dbraw.Close()
+
+	require.Nil(dbh.UpdateOrch(NewDBOrch("127.0.0.1:8936", "0x1")))
+	require.Nil(dbh.UpdateOrch(NewDBOrch("127.0.0.1:8937", "0x2")))
+	_, err = dbraw.Exec("UPDATE orchestrators SET updatedAt = datetime('now', '-2 hours') WHERE ethereumAddr = '0x2'")
+	require.Nil(err)
+
+	orchs, err := dbh.SelectOrchsUpdatedWithin(time.Hour)
+	require.Nil(err)
+	require.Len(orchs, 1)
+	assert.Equal(t, "0x1", orchs[0].EthereumAddr)
+
+	orchs, err = dbh.SelectOrchsUpdatedWithin(3 * time.Hour)
+	require.Nil(err)
+	assert.Len(t, orchs, 2)
+}
+
 func profilesMatch(j1 []ffmpeg.VideoProfile, j2 []ffmpeg.VideoProfile) bool {
 	if len(j1) != len(j2) {
 		return false
@@ -632,3 +696,106 @@ func getRowCountOrFatal(query string, dbraw *sql.DB, t *testing.T) int {
 
 	return count
 }
+
+func TestStreamStats(t *testing.T) {
+	dbh, dbraw, err := TempDB(t)
+	require := require.New(t)
+	assert := assert.New(t)
+	require.Nil(err)
+	defer dbh.Close()
+	defer dbraw.Close()
+
+	start := time.Unix(1000, 0)
+	for i, mid := range []string{"a", "b", "a"} {
+		err := dbh.InsertStreamStats(&DBStreamStats{
+			ManifestID:         mid,
+			Nonce:              math.MaxUint64 - uint64(i),
+			StartedAt:          start,
+			EndedAt:            start.Add(time.Duration(i+1) * time.Minute),
+			SegmentsEmerged:    10,
+			SegmentsTranscoded: 9,
+			SegmentsFailed:     1,
+			AvgLatency:         1.5,
+			Orchestrators:      []string{"https://o1:8935", "https://o2:8935"},
+			FeesSent:           big.NewInt(int64(100 * (i + 1))),
+		})
+		require.Nil(err)
+	}
+
+	stats, err := dbh.StreamStats("a", 10)
+	require.Nil(err)
+	require.Len(stats, 2)
+	// newest first
+	assert.Equal(uint64(math.MaxUint64-2), stats[0].Nonce)
+	assert.Equal(start.Add(3*time.Minute), stats[0].EndedAt)
+	assert.Equal(start, stats[0].StartedAt)
+	assert.Equal(int64(9), stats[0].SegmentsTranscoded)
+	assert.Equal(1.5, stats[0].AvgLatency)
+	assert.Equal([]string{"https://o1:8935", "https://o2:8935"}, stats[0].Orchestrators)
+	assert.Equal(big.NewInt(300), stats[0].FeesSent)
+
+	stats, err = dbh.StreamStats("", 2)
+	require.Nil(err)
+	require.Len(stats, 2)
+	assert.Equal("b", stats[1].ManifestID)
+
+	// streams without orchestrators or fees
+	require.Nil(dbh.InsertStreamStats(&DBStreamStats{ManifestID: "c", StartedAt: start, EndedAt: start}))
+	stats, err = dbh.StreamStats("c", 10)
+	require.Nil(err)
+	require.Len(stats, 1)
+	assert.Nil(stats[0].Orchestrators)
+	assert.Equal(big.NewInt(0), stats[0].FeesSent)
+	assert.Equal(start, stats[0].EndedAt)
+	assert.Nil(dbh.InsertStreamStats(nil))
+
+	// nil DB
+	var nilDB *DB
+	assert.Nil(nilDB.InsertStreamStats(&DBStreamStats{ManifestID: "d"}))
+	stats, err = nilDB.StreamStats("", 10)
+	assert.Nil(err)
+	assert.Empty(stats)
+}
+
+func TestOrchestratorScores(t *testing.T) {
+	dbh, dbraw, err := TempDB(t)
+	require := require.New(t)
+	assert := assert.New(t)
+	require.Nil(err)
+	defer dbh.Close()
+	defer dbraw.Close()
+
+	updated := time.Unix(1000, 0)
+	require.Nil(dbh.UpdateOrchestratorScore(&DBOrchestratorScore{Transcoder: "https://o1:8935", UpdatedAt: updated, Segments: 10, Failures: 1, LatencyP50: 1.5, LatencyP95: 3}))
+	require.Nil(dbh.UpdateOrchestratorScore(&DBOrchestratorScore{Transcoder: "https://o2:8935", UpdatedAt: updated, Segments: 5}))
+	// replaces the previous score
+	require.Nil(dbh.UpdateOrchestratorScore(&DBOrchestratorScore{Transcoder: "https://o1:8935", UpdatedAt: updated, Segments: 20, Failures: 2, LatencyP50: 1, LatencyP95: 2}))
+
+	scores, err := dbh.OrchestratorScores()
+	require.Nil(err)
+	require.Len(scores, 2)
+	for _, s := range scores {
+		if s.Transcoder == "https://o1:8935" {
+			assert.Equal(&DBOrchestratorScore{Transcoder: "https://o1:8935", UpdatedAt: updated, Segments: 20, Failures: 2, LatencyP50: 1, LatencyP95: 2}, s)
+		}
+	}
+
+	for i, price := range []*big.Rat{big.NewRat(1, 3), big.NewRat(100, 1)} {
+		require.Nil(dbh.InsertOrchestratorPrice(&DBOrchestratorPrice{Transcoder: "https://o1:8935", CreatedAt: updated.Add(time.Duration(i) * time.Minute), Price: price}))
+	}
+	require.Nil(dbh.InsertOrchestratorPrice(&DBOrchestratorPrice{Transcoder: "https://o2:8935", CreatedAt: updated, Price: big.NewRat(5, 1)}))
+	prices, err := dbh.OrchestratorPrices("https://o1:8935", 10)
+	require.Nil(err)
+	require.Len(prices, 2)
+	// newest first
+	assert.Equal(big.NewRat(100, 1), prices[0].Price)
+	assert.Equal(big.NewRat(1, 3), prices[1].Price)
+	assert.Equal(updated, prices[1].CreatedAt)
+
+	// nil DB
+	var nilDB *DB
+	scores, err = nilDB.OrchestratorScores()
+	assert.Nil(err)
+	assert.Empty(scores)
+	assert.Nil(nilDB.UpdateOrchestratorScore(&DBOrchestratorScore{}))
+}
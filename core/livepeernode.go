@@ -23,6 +23,7 @@ import (
 	"github.com/livepeer/go-livepeer/common"
 	"github.com/livepeer/go-livepeer/eth"
 	"github.com/livepeer/go-livepeer/ipfs"
+	"github.com/livepeer/go-livepeer/monitor"
 	"github.com/livepeer/go-livepeer/net"
 )
 
@@ -55,6 +56,8 @@ type LivepeerNode struct {
 	WorkDir         string
 	NodeType        NodeType
 	Database        *common.DB
+	// Census records metrics for this node; nil records on the default census
+	Census monitor.Census
 
 	// Transcoder public fields
 	SegmentChans     map[ManifestID]SegmentChan
@@ -140,3 +143,11 @@ func (n *LivepeerNode) GetServiceURI() *url.URL {
 func (n *LivepeerNode) SetServiceURI(newUrl *url.URL) {
 	n.serviceURI = *newUrl
 }
+
+// GetCensus returns the census that the metrics of this node are recorded on
+func (n *LivepeerNode) GetCensus() monitor.Census {
+	if n.Census != nil {
+		return n.Census
+	}
+	return monitor.DefaultCensus()
+}
@@ -9,6 +9,7 @@ import (
 
 	"github.com/golang/glog"
 	"github.com/livepeer/go-livepeer/drivers"
+	"github.com/livepeer/go-livepeer/monitor"
 	"github.com/livepeer/lpms/ffmpeg"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -129,3 +130,19 @@ func TestServiceURIChange(t *testing.T) {
 	require.Nil(err)
 	assert.Equal("test://secondurl.com/stream/testpath/testdata3", surl)
 }
+
+type stubCensus struct {
+	monitor.Census
+}
+
+func TestGetCensus(t *testing.T) {
+	assert := assert.New(t)
+
+	n, err := NewLivepeerNode(nil, "", nil)
+	require.Nil(t, err)
+	assert.Equal(monitor.DefaultCensus(), n.GetCensus())
+
+	c := &stubCensus{}
+	n.Census = c
+	assert.Equal(c, n.GetCensus())
+}
@@ -111,11 +111,20 @@ func (orch *orchestrator) ProcessPayment(payment net.Payment, manifestID Manifes
 
 	sessionID, won, err := orch.node.Recipient.ReceiveTicket(ticket, payment.Sig, seed)
 	if err != nil {
+		if monitor.Enabled {
+			orch.node.GetCensus().LogOrchPaymentError()
+		}
 		return errors.Wrapf(err, "error receiving ticket for payment %v for manifest %v", payment, manifestID)
 	}
+	if monitor.Enabled {
+		orch.node.GetCensus().LogTicketReceived(ticket.Sender.Hex(), ticket.FaceValue)
+	}
 
 	if won {
 		glog.V(common.DEBUG).Info("Received winning ticket")
+		if monitor.Enabled {
+			orch.node.GetCensus().LogWinningTicket(sessionID, ticket.Sender.Hex(), ticket.FaceValue)
+		}
 		cachePMSessionID(orch.node, manifestID, sessionID)
 	}
 
@@ -227,7 +236,7 @@ func (n *LivepeerNode) getSegmentChan(md *SegTranscodingMetadata) (SegmentChan,
 	}
 	n.SegmentChans[md.ManifestID] = sc
 	if lpmon.Enabled {
-		lpmon.CurrentSessions(len(n.SegmentChans))
+		n.GetCensus().CurrentSessions(len(n.SegmentChans))
 	}
 	return sc, nil
 }
@@ -237,6 +246,9 @@ func (n *LivepeerNode) sendToTranscodeLoop(md *SegTranscodingMetadata, seg *stre
 	ch, err := n.getSegmentChan(md)
 	if err != nil {
 		glog.Error("Could not find segment chan ", err)
+		if err == ErrOrchCap && monitor.Enabled {
+			n.GetCensus().LogOrchSegmentRejected(monitor.SegmentTranscodeErrorOrchestratorCapped)
+		}
 		return nil, err
 	}
 	segChanData := &SegChanData{seg: seg, md: md, res: make(chan *TranscodeResult, 1)}
@@ -246,9 +258,18 @@ func (n *LivepeerNode) sendToTranscodeLoop(md *SegTranscodingMetadata, seg *stre
 	default:
 		// sending segChan should not block; if it does, the channel is busy
 		glog.Error("Transcoder was busy with a previous segment!")
+		if monitor.Enabled {
+			n.GetCensus().LogOrchSegmentRejected(monitor.SegmentTranscodeErrorOrchestratorBusy)
+		}
 		return nil, ErrOrchBusy
 	}
+	if monitor.Enabled {
+		n.GetCensus().LogOrchTranscodeQueued()
+	}
 	res := <-segChanData.res
+	if monitor.Enabled {
+		n.GetCensus().LogOrchTranscodeDequeued()
+	}
 	return res, res.Err
 }
 
@@ -312,7 +333,7 @@ func (n *LivepeerNode) transcodeSeg(config transcodeConfig, seg *stream.HLSSegme
 		seg.Name = url
 	}
 	if isLocal && monitor.Enabled {
-		monitor.LogSegmentTranscodeStarting(seg.SeqNo, string(md.ManifestID))
+		n.GetCensus().LogSegmentTranscodeStarting(seg.SeqNo, string(md.ManifestID))
 	}
 
 	//Do the transcoding
@@ -330,8 +351,9 @@ func (n *LivepeerNode) transcodeSeg(config transcodeConfig, seg *stream.HLSSegme
 	took := time.Since(start)
 	tProfileData := make(map[ffmpeg.VideoProfile][]byte, 0)
 	glog.V(common.DEBUG).Infof("Transcoding of segment %v took %v", seg.SeqNo, took)
-	if isLocal && monitor.Enabled {
-		monitor.LogSegmentTranscodeEnded(seg.SeqNo, string(md.ManifestID), took,
+	if monitor.Enabled {
+		// transcode_time_seconds covers remote transcoders too
+		n.GetCensus().LogSegmentTranscodeEnded(seg.SeqNo, string(md.ManifestID), took,
 			common.ProfilesNames(md.Profiles))
 	}
 
@@ -401,7 +423,7 @@ func (n *LivepeerNode) transcodeSegmentLoop(md *SegTranscodingMetadata, segChan
 					close(n.SegmentChans[md.ManifestID])
 					delete(n.SegmentChans, md.ManifestID)
 					if lpmon.Enabled {
-						lpmon.CurrentSessions(len(n.SegmentChans))
+						n.GetCensus().CurrentSessions(len(n.SegmentChans))
 					}
 				}
 				n.segmentMutex.Unlock()
@@ -409,6 +431,9 @@ func (n *LivepeerNode) transcodeSegmentLoop(md *SegTranscodingMetadata, segChan
 					sessionIDs := getAndClearPMSessionIDsByManifestID(n, md.ManifestID)
 					if len(sessionIDs) > 0 {
 						err := n.Recipient.RedeemWinningTickets(sessionIDs)
+						if lpmon.Enabled {
+							n.GetCensus().LogWinningTicketsRedeemed(sessionIDs, err)
+						}
 						if err != nil {
 							glog.Errorf("Error redeeming winning tickets for manifestID %v and sessions %v. Errors: %+v", md.ManifestID, sessionIDs, err)
 						}
@@ -424,6 +449,13 @@ func (n *LivepeerNode) transcodeSegmentLoop(md *SegTranscodingMetadata, segChan
 	return nil
 }
 
+// HasTranscoder returns whether a local or remote transcoder is available
+func (n *LivepeerNode) HasTranscoder() bool {
+	n.tcoderMutex.RLock()
+	defer n.tcoderMutex.RUnlock()
+	return n.Transcoder != nil
+}
+
 func (n *LivepeerNode) serveTranscoder(stream net.Transcoder_RegisterTranscoderServer) {
 	transcoder := NewRemoteTranscoder(n, stream)
 
@@ -1,28 +1,53 @@
 package core
 
 import (
+	"errors"
 	"fmt"
 	"sync"
 
 	"github.com/ericxtang/m3u8"
 	"github.com/golang/glog"
+	"github.com/livepeer/go-livepeer/common"
 	"github.com/livepeer/go-livepeer/drivers"
 	ffmpeg "github.com/livepeer/lpms/ffmpeg"
 )
 
 const LIVE_LIST_LENGTH uint = 6
 
+// Number of sequence numbers a segment may trail the latest segment of its
+// rendition by before it is rejected as stale. Defaults to the length of the
+// live playlist.
+var LiveWindow = uint64(LIVE_LIST_LENGTH)
+
+var ErrStaleSegment = errors.New("ErrStaleSegment")
+
+// IsStaleSegment returns true if seqNo trails lastSeqNo by more than LiveWindow
+func IsStaleSegment(seqNo, lastSeqNo uint64) bool {
+	return seqNo < lastSeqNo && lastSeqNo-seqNo > LiveWindow
+}
+
 //	PlaylistManager manages playlists and data for one video stream, backed by one object storage.
 type PlaylistManager interface {
 	ManifestID() ManifestID
 	// Implicitly creates master and media playlists
-	// Inserts in media playlist given a link to a segment
+	// Inserts in media playlist given a link to a segment. Segments already
+	// in the playlist are skipped; segments older than LiveWindow are
+	// rejected with ErrStaleSegment.
 	InsertHLSSegment(profile *ffmpeg.VideoProfile, seqNo uint64, uri string, duration float64) error
 
 	GetHLSMasterPlaylist() *m3u8.MasterPlaylist
 
 	GetHLSMediaPlaylist(rendition string) *m3u8.MediaPlaylist
 
+	// Removes the media playlist of a rendition and its master playlist
+	// variant. Inserting a segment for the rendition adds them back.
+	RemoveHLSRendition(rendition string)
+
+	// Forgets the sequence numbers of the renditions for a stream that
+	// restarted its numbering, and marks a discontinuity before the next
+	// segment of each rendition.
+	RestartHLSSequence()
+
 	GetOSSession() drivers.OSSession
 
 	Cleanup()
@@ -34,7 +59,11 @@ type BasicPlaylistManager struct {
 	// Live playlist used for broadcasting
 	masterPList *m3u8.MasterPlaylist
 	mediaLists  map[string]*m3u8.MediaPlaylist
-	mapSync     *sync.RWMutex
+	// highest sequence number inserted per rendition
+	lastSeqNos map[string]uint64
+	// renditions whose next segment follows a sequence restart
+	discontinuities map[string]bool
+	mapSync         *sync.RWMutex
 }
 
 // NewBasicPlaylistManager create new BasicPlaylistManager struct
@@ -42,11 +71,13 @@ func NewBasicPlaylistManager(manifestID ManifestID,
 	storageSession drivers.OSSession) *BasicPlaylistManager {
 
 	bplm := &BasicPlaylistManager{
-		storageSession: storageSession,
-		manifestID:     manifestID,
-		masterPList:    m3u8.NewMasterPlaylist(),
-		mediaLists:     make(map[string]*m3u8.MediaPlaylist),
-		mapSync:        &sync.RWMutex{},
+		storageSession:  storageSession,
+		manifestID:      manifestID,
+		masterPList:     m3u8.NewMasterPlaylist(),
+		mediaLists:      make(map[string]*m3u8.MediaPlaylist),
+		lastSeqNos:      make(map[string]uint64),
+		discontinuities: make(map[string]bool),
+		mapSync:         &sync.RWMutex{},
 	}
 	return bplm
 }
@@ -83,6 +114,11 @@ func (mgr *BasicPlaylistManager) getOrCreatePL(profile *ffmpeg.VideoProfile) (*m
 	}
 	mgr.mediaLists[profile.Name] = mpl
 	vParams := ffmpeg.VideoProfileToVariantParams(*profile)
+	if common.IsAudioProfile(*profile) {
+		aProfile := common.AudioProfileLookup[profile.Name]
+		aProfile.Bitrate = profile.Bitrate
+		vParams = common.AudioProfileToVariantParams(aProfile)
+	}
 	url := fmt.Sprintf("%v/%v.m3u8", mgr.manifestID, profile.Name)
 	mgr.masterPList.Append(url, mpl, vParams)
 	return mpl, nil
@@ -95,13 +131,56 @@ func (mgr *BasicPlaylistManager) InsertHLSSegment(profile *ffmpeg.VideoProfile,
 	if err != nil {
 		return err
 	}
-	return mgr.addToMediaPlaylist(uri, seqNo, duration, mpl)
+	fresh, discontinuity := mgr.checkSeqNo(profile.Name, seqNo)
+	if !fresh {
+		glog.V(common.DEBUG).Infof("Rejecting stale playlist segment manifestID=%s profile=%s seqNo=%d", mgr.manifestID, profile.Name, seqNo)
+		return ErrStaleSegment
+	}
+	return mgr.addToMediaPlaylist(uri, seqNo, duration, discontinuity, mpl)
 }
 
-func (mgr *BasicPlaylistManager) addToMediaPlaylist(uri string, seqNo uint64, duration float64,
-	mpl *m3u8.MediaPlaylist) error {
+// checkSeqNo returns false if seqNo is stale for the rendition; otherwise it
+// records seqNo if it's the highest seen so far, and returns whether the
+// segment is the first since the sequence restarted
+func (mgr *BasicPlaylistManager) checkSeqNo(rendition string, seqNo uint64) (bool, bool) {
+	mgr.mapSync.Lock()
+	defer mgr.mapSync.Unlock()
+	last, ok := mgr.lastSeqNos[rendition]
+	if ok && IsStaleSegment(seqNo, last) {
+		return false, false
+	}
+	if !ok || seqNo > last {
+		mgr.lastSeqNos[rendition] = seqNo
+	}
+	discontinuity := mgr.discontinuities[rendition]
+	delete(mgr.discontinuities, rendition)
+	return true, discontinuity
+}
 
+// RestartHLSSequence forgets the sequence numbers of every rendition, so that
+// segments numbered from the start again aren't rejected as stale, and marks
+// a discontinuity before the next segment of each rendition
+func (mgr *BasicPlaylistManager) RestartHLSSequence() {
+	mgr.mapSync.Lock()
+	defer mgr.mapSync.Unlock()
+	mgr.lastSeqNos = make(map[string]uint64)
+	for rendition := range mgr.mediaLists {
+		mgr.discontinuities[rendition] = true
+	}
+}
+
+func (mgr *BasicPlaylistManager) addToMediaPlaylist(uri string, seqNo uint64, duration float64,
+	discontinuity bool, mpl *m3u8.MediaPlaylist) error {
+
+	// the same segment may come back from several orchestrators
+	for _, seg := range mpl.Segments {
+		if seg != nil && seg.SeqId == seqNo {
+			glog.V(common.DEBUG).Infof("Skipping duplicate playlist segment seqNo=%d uri=%s", seqNo, uri)
+			return nil
+		}
+	}
 	mseg := newMediaSegment(uri, seqNo, duration)
+	mseg.Discontinuity = discontinuity
 	if mpl.Count() >= mpl.WinSize() {
 		mpl.Remove()
 	}
@@ -114,9 +193,33 @@ func (mgr *BasicPlaylistManager) addToMediaPlaylist(uri string, seqNo uint64, du
 
 // GetHLSMasterPlaylist ..
 func (mgr *BasicPlaylistManager) GetHLSMasterPlaylist() *m3u8.MasterPlaylist {
+	mgr.mapSync.RLock()
+	defer mgr.mapSync.RUnlock()
 	return mgr.masterPList
 }
 
+// RemoveHLSRendition removes the media playlist of the rendition and its
+// variant in the master playlist, and forgets its sequence numbers
+func (mgr *BasicPlaylistManager) RemoveHLSRendition(rendition string) {
+	mgr.mapSync.Lock()
+	defer mgr.mapSync.Unlock()
+	if _, ok := mgr.mediaLists[rendition]; !ok {
+		return
+	}
+	delete(mgr.mediaLists, rendition)
+	delete(mgr.lastSeqNos, rendition)
+	delete(mgr.discontinuities, rendition)
+	// rebuild rather than edit the master playlist, which caches its encoding
+	url := fmt.Sprintf("%v/%v.m3u8", mgr.manifestID, rendition)
+	masterPList := m3u8.NewMasterPlaylist()
+	for _, v := range mgr.masterPList.Variants {
+		if v.URI != url {
+			masterPList.Append(v.URI, v.Chunklist, v.VariantParams)
+		}
+	}
+	mgr.masterPList = masterPList
+}
+
 // GetHLSMediaPlaylist ...
 func (mgr *BasicPlaylistManager) GetHLSMediaPlaylist(rendition string) *m3u8.MediaPlaylist {
 	return mgr.getPL(rendition)
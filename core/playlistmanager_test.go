@@ -3,9 +3,11 @@ package core
 import (
 	"bytes"
 	"net/url"
+	"strings"
 	"testing"
 
 	"github.com/ericxtang/m3u8"
+	"github.com/livepeer/go-livepeer/common"
 	"github.com/livepeer/go-livepeer/drivers"
 	ffmpeg "github.com/livepeer/lpms/ffmpeg"
 )
@@ -112,11 +114,11 @@ func TestPlaylists(t *testing.T) {
 		t.Error("Unexpected playlist/segment properties")
 	}
 
-	// insert a "duplicate" seqno. Should not work but does. Fix.
+	// insert a duplicate seqno; should be skipped
 	if err := c.InsertHLSSegment(vProfile, seg.SeqId, seg.URI, seg.Duration); err != nil {
 		t.Error("HLS insertion")
 	}
-	if len(pl.Segments) != int(LIVE_LIST_LENGTH) || !compareSeg(seg, pl.Segments[0]) || !compareSeg(pl.Segments[0], pl.Segments[1]) {
+	if len(pl.Segments) != int(LIVE_LIST_LENGTH) || !compareSeg(seg, pl.Segments[0]) || pl.Segments[1] != nil {
 		t.Error("Unexpected playlist/segment properties")
 	}
 
@@ -125,7 +127,7 @@ func TestPlaylists(t *testing.T) {
 	if err := c.InsertHLSSegment(vProfile, seg.SeqId, seg.URI, seg.Duration); err != nil {
 		t.Error("HLS insertion")
 	}
-	if !compareSeg(seg, pl.Segments[2]) {
+	if !compareSeg(seg, pl.Segments[1]) {
 		t.Error("Unexpected seg properties")
 	}
 
@@ -142,6 +144,138 @@ func TestPlaylists(t *testing.T) {
 
 }
 
+func TestRemoveHLSRendition(t *testing.T) {
+	mid := RandomManifestID()
+	c := NewBasicPlaylistManager(mid, nil)
+	low, high := &ffmpeg.P144p30fps16x9, &ffmpeg.P240p30fps16x9
+	for _, p := range []*ffmpeg.VideoProfile{low, high} {
+		if err := c.InsertHLSSegment(p, 1, "abc", 2); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c.RemoveHLSRendition(low.Name)
+	if pl := c.GetHLSMediaPlaylist(low.Name); pl != nil {
+		t.Error("Expected the media playlist to be removed")
+	}
+	masterPL := c.GetHLSMasterPlaylist()
+	if len(masterPL.Variants) != 1 || masterPL.Variants[0].URI != string(mid)+"/"+high.Name+".m3u8" {
+		t.Error("Unexpected variants ", masterPL.String())
+	}
+	if c.GetHLSMediaPlaylist(high.Name) == nil {
+		t.Error("Expected the other media playlist to be kept")
+	}
+
+	// removing an unknown rendition is a no-op
+	c.RemoveHLSRendition("nonexistent")
+	if len(c.GetHLSMasterPlaylist().Variants) != 1 {
+		t.Error("Unexpected variants ", c.GetHLSMasterPlaylist().String())
+	}
+
+	// inserting again adds the rendition back
+	if err := c.InsertHLSSegment(low, 2, "abc", 2); err != nil {
+		t.Fatal(err)
+	}
+	if len(c.GetHLSMasterPlaylist().Variants) != 2 || c.GetHLSMediaPlaylist(low.Name) == nil {
+		t.Error("Expected the rendition to be added back ", c.GetHLSMasterPlaylist().String())
+	}
+}
+
+func TestStaleSegments(t *testing.T) {
+	defer func(w uint64) { LiveWindow = w }(LiveWindow)
+	LiveWindow = 2
+	c := NewBasicPlaylistManager(RandomManifestID(), nil)
+	low, high := &ffmpeg.P144p30fps16x9, &ffmpeg.P240p30fps16x9
+
+	if err := c.InsertHLSSegment(low, 10, "abc", 2); err != nil {
+		t.Fatal(err)
+	}
+	// segments within the window are still inserted
+	if err := c.InsertHLSSegment(low, 8, "abc", 2); err != nil {
+		t.Error("Unexpected error ", err)
+	}
+	// as are restarted sequence numbers of other renditions
+	if err := c.InsertHLSSegment(high, 0, "abc", 2); err != nil {
+		t.Error("Unexpected error ", err)
+	}
+	// older segments are rejected
+	if err := c.InsertHLSSegment(low, 7, "abc", 2); err != ErrStaleSegment {
+		t.Error("Expected stale segment error, got ", err)
+	}
+	if pl := c.GetHLSMediaPlaylist(low.Name); pl.Count() != 2 {
+		t.Error("Unexpected segment count ", pl.Count())
+	}
+	// rejected segments don't move the window back
+	if err := c.InsertHLSSegment(low, 0, "abc", 2); err != ErrStaleSegment {
+		t.Error("Expected stale segment error, got ", err)
+	}
+	if err := c.InsertHLSSegment(low, 11, "abc", 2); err != nil {
+		t.Error("Unexpected error ", err)
+	}
+}
+
+func TestRestartHLSSequence(t *testing.T) {
+	defer func(w uint64) { LiveWindow = w }(LiveWindow)
+	LiveWindow = 2
+	c := NewBasicPlaylistManager(RandomManifestID(), nil)
+	low := &ffmpeg.P144p30fps16x9
+
+	for _, seqNo := range []uint64{10, 11} {
+		if err := c.InsertHLSSegment(low, seqNo, "abc", 2); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c.RestartHLSSequence()
+
+	// numbering from the start again is accepted after a restart
+	for _, seqNo := range []uint64{0, 1} {
+		if err := c.InsertHLSSegment(low, seqNo, "def", 2); err != nil {
+			t.Error("Unexpected error ", err)
+		}
+	}
+	pl := c.GetHLSMediaPlaylist(low.Name)
+	if pl.Count() != 4 {
+		t.Fatal("Unexpected segment count ", pl.Count())
+	}
+	// with a discontinuity before the first restarted segment only
+	for i, want := range []bool{false, false, true, false} {
+		if pl.Segments[i].Discontinuity != want {
+			t.Errorf("Unexpected discontinuity for segment %d: %v", i, pl.Segments[i].Discontinuity)
+		}
+	}
+	if !strings.Contains(pl.String(), "#EXT-X-DISCONTINUITY") {
+		t.Error("Expected a discontinuity tag in the playlist")
+	}
+}
+
+func TestAudioOnlyPlaylist(t *testing.T) {
+	c := NewBasicPlaylistManager(RandomManifestID(), nil)
+	aProfile := common.A64kAAC.VideoProfile()
+	if err := c.InsertHLSSegment(&aProfile, 1, "test_seg/1.ts", 2); err != nil {
+		t.Fatal(err)
+	}
+	variants := c.GetHLSMasterPlaylist().Variants
+	if len(variants) != 1 {
+		t.Fatal("Unexpected variants ", len(variants))
+	}
+	// audio-only variants carry the codec rather than a resolution
+	if v := variants[0]; v.Codecs != "mp4a.40.2" || v.Resolution != "" || v.Bandwidth != 64000 {
+		t.Errorf("Unexpected variant params %+v", v.VariantParams)
+	}
+	if pl := c.GetHLSMediaPlaylist(aProfile.Name); pl == nil || pl.Count() != 1 {
+		t.Error("Expected audio-only segment to be inserted")
+	}
+	// the bitrate of the profile is advertised rather than the nominal one
+	c = NewBasicPlaylistManager(RandomManifestID(), nil)
+	aProfile.Bitrate = "200k"
+	if err := c.InsertHLSSegment(&aProfile, 1, "test_seg/1.ts", 2); err != nil {
+		t.Fatal(err)
+	}
+	if v := c.GetHLSMasterPlaylist().Variants[0]; v.Codecs != "mp4a.40.2" || v.Bandwidth != 200000 {
+		t.Errorf("Unexpected variant params %+v", v.VariantParams)
+	}
+}
+
 func TestCleanup(t *testing.T) {
 	vProfile := ffmpeg.P144p30fps16x9
 	hlsStrmID := MakeStreamID(RandomManifestID(), &vProfile)
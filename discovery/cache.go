@@ -0,0 +1,206 @@
+package discovery
+
+import (
+	"context"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/livepeer/go-livepeer/core"
+	"github.com/livepeer/go-livepeer/monitor"
+	"github.com/livepeer/go-livepeer/net"
+	"github.com/livepeer/go-livepeer/server"
+
+	"github.com/golang/glog"
+)
+
+// cachedPool remembers the orchestrators last returned by a pool and only
+// queries those while it refreshes them in the background, so that slow
+// orchestrators don't hold up the segments waiting on a session refresh.
+// Only the transcoder URIs are cached: the ticket params and storage of an
+// orchestrator are specific to each query, so every caller gets them from a
+// fresh query. Orchestrators older than the TTL are no longer used; callers
+// wait for the pool instead.
+type cachedPool struct {
+	pool  net.OrchestratorPool
+	bcast server.Broadcaster
+	ttl   time.Duration
+
+	lock       sync.Mutex
+	uris       []*url.URL
+	fetchedAt  time.Time
+	count      int // largest number of orchestrators asked for
+	refreshing bool
+}
+
+func NewCachedPool(node *core.LivepeerNode, pool net.OrchestratorPool, ttl time.Duration) *cachedPool {
+	return &cachedPool{pool: pool, bcast: core.NewBroadcaster(node), ttl: ttl}
+}
+
+func (c *cachedPool) GetOrchestrators(numOrchestrators int, constraints *net.OrchestratorConstraints) ([]*net.OrchestratorInfo, error) {
+	uris, age := c.cached(numOrchestrators, constraints)
+	if len(uris) > 0 {
+		var orchs []*net.OrchestratorInfo
+		for o := range streamOrchestrators(context.Background(), c.bcast, uris, numOrchestrators, constraints) {
+			orchs = append(orchs, o)
+		}
+		if len(orchs) > 0 {
+			if monitor.Enabled {
+				monitor.LogDiscoveryCache(true, age)
+			}
+			return orchs, nil
+		}
+	}
+
+	if monitor.Enabled {
+		monitor.LogDiscoveryCache(false, 0)
+	}
+	c.lock.Lock()
+	count := c.count
+	c.lock.Unlock()
+	orchs, err := c.pool.GetOrchestrators(count, constraints)
+	if err != nil || len(orchs) <= 0 {
+		return orchs, err
+	}
+	c.store(orchs)
+	if len(orchs) > numOrchestrators {
+		orchs = orchs[:numOrchestrators]
+	}
+	return orchs, nil
+}
+
+// StreamOrchestrators queries the cached orchestrators if they haven't
+// expired. Otherwise it streams them from the pool if the pool can. Discovery
+// then runs to completion even after ctx is done, so that only complete
+// results are cached.
+func (c *cachedPool) StreamOrchestrators(ctx context.Context, numOrchestrators int, constraints *net.OrchestratorConstraints) <-chan *net.OrchestratorInfo {
+	ipool, ok := c.pool.(net.IncrementalOrchestratorPool)
+	if !ok {
+		orchInfos := make(chan *net.OrchestratorInfo)
+		go func() {
+			defer close(orchInfos)
+			orchs, err := c.GetOrchestrators(numOrchestrators, constraints)
+			if err != nil {
+				glog.Error("Could not get orchestrators: ", err)
+			}
+			for _, o := range orchs {
+				select {
+				case orchInfos <- o:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+		return orchInfos
+	}
+
+	orchInfos := make(chan *net.OrchestratorInfo)
+	uris, age := c.cached(numOrchestrators, constraints)
+	go func() {
+		defer close(orchInfos)
+		if len(uris) > 0 {
+			sent := 0
+			for o := range streamOrchestrators(ctx, c.bcast, uris, numOrchestrators, constraints) {
+				select {
+				case orchInfos <- o:
+					sent++
+				case <-ctx.Done():
+				}
+			}
+			if sent > 0 {
+				if monitor.Enabled {
+					monitor.LogDiscoveryCache(true, age)
+				}
+				return
+			}
+		}
+
+		if monitor.Enabled {
+			monitor.LogDiscoveryCache(false, 0)
+		}
+		c.lock.Lock()
+		count := c.count
+		store := !c.refreshing
+		c.refreshing = true
+		c.lock.Unlock()
+		if !store {
+			// a refresh is already running; only this caller is served
+			for o := range ipool.StreamOrchestrators(ctx, numOrchestrators, constraints) {
+				select {
+				case orchInfos <- o:
+				case <-ctx.Done():
+				}
+			}
+			return
+		}
+		var orchs []*net.OrchestratorInfo
+		for o := range ipool.StreamOrchestrators(context.Background(), count, constraints) {
+			orchs = append(orchs, o)
+			if len(orchs) > numOrchestrators || ctx.Err() != nil {
+				continue
+			}
+			select {
+			case orchInfos <- o:
+			case <-ctx.Done():
+			}
+		}
+		c.finishRefresh(orchs)
+	}()
+	return orchInfos
+}
+
+// cached returns the cached orchestrator URIs and their age if they haven't
+// expired, and starts refreshing them in the background.
+func (c *cachedPool) cached(numOrchestrators int, constraints *net.OrchestratorConstraints) ([]*url.URL, time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if numOrchestrators > c.count {
+		c.count = numOrchestrators
+	}
+	age := time.Since(c.fetchedAt)
+	if len(c.uris) <= 0 || age >= c.ttl {
+		return nil, 0
+	}
+	if !c.refreshing {
+		c.refreshing = true
+		go c.refresh(c.count, constraints)
+	}
+	return c.uris, age
+}
+
+func (c *cachedPool) refresh(count int, constraints *net.OrchestratorConstraints) {
+	orchs, err := c.pool.GetOrchestrators(count, constraints)
+	if err != nil || len(orchs) <= 0 {
+		// keep using the last known good orchestrators until they expire
+		glog.Errorf("Could not refresh cached orchestrators count=%d err=%v", len(orchs), err)
+	}
+	c.finishRefresh(orchs)
+}
+
+func (c *cachedPool) finishRefresh(orchs []*net.OrchestratorInfo) {
+	if len(orchs) > 0 {
+		c.store(orchs)
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.refreshing = false
+}
+
+func (c *cachedPool) store(orchs []*net.OrchestratorInfo) {
+	var uris []*url.URL
+	for _, o := range orchs {
+		uri, err := url.ParseRequestURI(o.GetTranscoder())
+		if err != nil {
+			glog.Errorf("Could not parse orchestrator=%s err=%v", o.GetTranscoder(), err)
+			continue
+		}
+		uris = append(uris, uri)
+	}
+	if len(uris) <= 0 {
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.uris = uris
+	c.fetchedAt = time.Now()
+}
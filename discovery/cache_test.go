@@ -0,0 +1,304 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/livepeer/go-livepeer/core"
+	"github.com/livepeer/go-livepeer/net"
+	"github.com/livepeer/go-livepeer/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type countingPool struct {
+	mu     sync.Mutex
+	calls  int
+	counts []int
+	orchs  []*net.OrchestratorInfo
+	err    error
+	block  chan struct{}
+}
+
+func (p *countingPool) GetOrchestrators(n int, constraints *net.OrchestratorConstraints) ([]*net.OrchestratorInfo, error) {
+	if p.block != nil {
+		<-p.block
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.calls++
+	p.counts = append(p.counts, n)
+	var orchs []*net.OrchestratorInfo
+	for _, o := range p.orchs {
+		if constraints.Matches(o) {
+			orchs = append(orchs, o)
+		}
+	}
+	return orchs, p.err
+}
+
+func (p *countingPool) numCalls() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.calls
+}
+
+func (p *countingPool) set(orchs []*net.OrchestratorInfo, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.orchs, p.err = orchs, err
+}
+
+// streamingPool streams the orchestrators of a countingPool until ctx is done
+type streamingPool struct {
+	*countingPool
+}
+
+func (p *streamingPool) StreamOrchestrators(ctx context.Context, n int, constraints *net.OrchestratorConstraints) <-chan *net.OrchestratorInfo {
+	orchs, _ := p.GetOrchestrators(n, constraints)
+	orchInfos := make(chan *net.OrchestratorInfo)
+	go func() {
+		defer close(orchInfos)
+		for _, o := range orchs {
+			select {
+			case orchInfos <- o:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return orchInfos
+}
+
+// stubQueries answers orchestrator queries with a fresh copy of the
+// orchestrator with the same host in orchs, and counts the queries per host
+func stubQueries(orchs ...*net.OrchestratorInfo) (map[string]int, *sync.Mutex, func()) {
+	var mu sync.Mutex
+	queries := make(map[string]int)
+	orig := getOrchestratorInfo
+	getOrchestratorInfo = func(ctx context.Context, bcast server.Broadcaster, uri *url.URL) (*net.OrchestratorInfo, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		queries[uri.Host]++
+		for _, o := range orchs {
+			if u, _ := url.Parse(o.Transcoder); u.Host == uri.Host {
+				return &net.OrchestratorInfo{Transcoder: o.Transcoder, Capabilities: o.Capabilities}, nil
+			}
+		}
+		return nil, errors.New("unreachable")
+	}
+	return queries, &mu, func() { getOrchestratorInfo = orig }
+}
+
+func newTestCachedPool(pool net.OrchestratorPool) *cachedPool {
+	node, _ := core.NewLivepeerNode(nil, "", nil)
+	return NewCachedPool(node, pool, time.Minute)
+}
+
+func transcoders(orchs []*net.OrchestratorInfo) []string {
+	var uris []string
+	for _, o := range orchs {
+		uris = append(uris, o.Transcoder)
+	}
+	sort.Strings(uris)
+	return uris
+}
+
+func waitRefreshed(t *testing.T, c *cachedPool) {
+	for i := 0; i < 100; i++ {
+		c.lock.Lock()
+		refreshing := c.refreshing
+		c.lock.Unlock()
+		if !refreshing {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatal("cache did not finish refreshing")
+}
+
+func TestCachedPool_RequeriesCachedAndRefreshes(t *testing.T) {
+	assert := assert.New(t)
+	a := &net.OrchestratorInfo{Transcoder: "https://a:8935"}
+	b := &net.OrchestratorInfo{Transcoder: "https://b:8935"}
+	queries, mu, restore := stubQueries(a, b)
+	defer restore()
+	pool := &countingPool{orchs: []*net.OrchestratorInfo{a, b}}
+	c := newTestCachedPool(pool)
+
+	// nothing cached yet, so the first call waits for the pool
+	orchs, err := c.GetOrchestrators(1, nil)
+	require.Nil(t, err)
+	assert.Equal([]*net.OrchestratorInfo{a}, orchs)
+	assert.Equal(1, pool.numCalls())
+
+	// cached orchestrators are queried again while the pool is blocked
+	pool.block = make(chan struct{})
+	pool.set([]*net.OrchestratorInfo{b}, nil)
+	orchs, err = c.GetOrchestrators(2, nil)
+	require.Nil(t, err)
+	assert.Equal([]string{a.Transcoder, b.Transcoder}, transcoders(orchs))
+	for _, o := range orchs {
+		assert.False(o == a || o == b, "cached orchestrator info was reused")
+	}
+	mu.Lock()
+	assert.Equal(map[string]int{"a:8935": 1, "b:8935": 1}, queries)
+	mu.Unlock()
+
+	// only one refresh runs at a time
+	orchs, err = c.GetOrchestrators(2, nil)
+	require.Nil(t, err)
+	assert.Len(orchs, 2)
+
+	close(pool.block)
+	waitRefreshed(t, c)
+	assert.Equal(2, pool.numCalls())
+	assert.Equal([]int{1, 2}, pool.counts)
+
+	// the refreshed orchestrators are queried next
+	orchs, err = c.GetOrchestrators(2, nil)
+	require.Nil(t, err)
+	assert.Equal([]string{b.Transcoder}, transcoders(orchs))
+	waitRefreshed(t, c)
+}
+
+func TestCachedPool_Unreachable(t *testing.T) {
+	assert := assert.New(t)
+	a := &net.OrchestratorInfo{Transcoder: "https://a:8935"}
+	b := &net.OrchestratorInfo{Transcoder: "https://b:8935"}
+	_, _, restore := stubQueries(b)
+	defer restore()
+	pool := &countingPool{orchs: []*net.OrchestratorInfo{a}}
+	c := newTestCachedPool(pool)
+	_, err := c.GetOrchestrators(1, nil)
+	require.Nil(t, err)
+	waitRefreshed(t, c)
+
+	// callers wait for the pool if no cached orchestrator answers
+	pool.set([]*net.OrchestratorInfo{b}, nil)
+	orchs, err := c.GetOrchestrators(1, nil)
+	require.Nil(t, err)
+	assert.Equal([]*net.OrchestratorInfo{b}, orchs)
+	waitRefreshed(t, c)
+}
+
+func TestCachedPool_KeepsLastGood(t *testing.T) {
+	assert := assert.New(t)
+	a := &net.OrchestratorInfo{Transcoder: "https://a:8935"}
+	_, _, restore := stubQueries(a)
+	defer restore()
+	pool := &countingPool{orchs: []*net.OrchestratorInfo{a}}
+	c := newTestCachedPool(pool)
+	_, err := c.GetOrchestrators(1, nil)
+	require.Nil(t, err)
+
+	// failed refreshes keep the last known good orchestrators
+	pool.set(nil, errors.New("unavailable"))
+	orchs, err := c.GetOrchestrators(1, nil)
+	require.Nil(t, err)
+	assert.Equal([]string{a.Transcoder}, transcoders(orchs))
+	waitRefreshed(t, c)
+
+	pool.set(nil, nil)
+	orchs, err = c.GetOrchestrators(1, nil)
+	require.Nil(t, err)
+	assert.Equal([]string{a.Transcoder}, transcoders(orchs))
+	waitRefreshed(t, c)
+}
+
+func TestCachedPool_Expiry(t *testing.T) {
+	assert := assert.New(t)
+	a := &net.OrchestratorInfo{Transcoder: "https://a:8935"}
+	_, _, restore := stubQueries(a)
+	defer restore()
+	pool := &countingPool{orchs: []*net.OrchestratorInfo{a}}
+	c := newTestCachedPool(pool)
+	_, err := c.GetOrchestrators(1, nil)
+	require.Nil(t, err)
+
+	// expired orchestrators are not used
+	c.fetchedAt = time.Now().Add(-2 * time.Minute)
+	pool.set(nil, errors.New("unavailable"))
+	orchs, err := c.GetOrchestrators(1, nil)
+	assert.EqualError(err, "unavailable")
+	assert.Nil(orchs)
+	assert.Equal(2, pool.numCalls())
+
+	pool.set([]*net.OrchestratorInfo{a}, nil)
+	orchs, err = c.GetOrchestrators(1, nil)
+	require.Nil(t, err)
+	assert.Equal([]*net.OrchestratorInfo{a}, orchs)
+	assert.Equal(3, pool.numCalls())
+}
+
+func TestCachedPool_Constraints(t *testing.T) {
+	assert := assert.New(t)
+	a := &net.OrchestratorInfo{Transcoder: "https://a:8935"}
+	b := &net.OrchestratorInfo{Transcoder: "https://b:8935", Capabilities: []string{"hevc"}}
+	_, _, restore := stubQueries(a, b)
+	defer restore()
+	pool := &countingPool{orchs: []*net.OrchestratorInfo{a, b}}
+	c := newTestCachedPool(pool)
+	_, err := c.GetOrchestrators(2, nil)
+	require.Nil(t, err)
+
+	// only cached orchestrators meeting the constraints are returned
+	hevc := &net.OrchestratorConstraints{Capabilities: []string{"hevc"}}
+	orchs, err := c.GetOrchestrators(2, hevc)
+	require.Nil(t, err)
+	assert.Equal([]string{b.Transcoder}, transcoders(orchs))
+	waitRefreshed(t, c)
+
+	// and callers wait for the pool if none do
+	pool.set([]*net.OrchestratorInfo{a}, nil)
+	c.GetOrchestrators(1, nil)
+	waitRefreshed(t, c)
+	calls := pool.numCalls()
+	orchs, err = c.GetOrchestrators(2, hevc)
+	require.Nil(t, err)
+	assert.Empty(orchs)
+	assert.Equal(calls+1, pool.numCalls())
+	waitRefreshed(t, c)
+}
+
+func TestCachedPool_StreamCachesCompleteResults(t *testing.T) {
+	assert := assert.New(t)
+	a := &net.OrchestratorInfo{Transcoder: "https://a:8935"}
+	b := &net.OrchestratorInfo{Transcoder: "https://b:8935"}
+	queries, mu, restore := stubQueries(a, b)
+	defer restore()
+	pool := &streamingPool{&countingPool{orchs: []*net.OrchestratorInfo{a, b}}}
+	c := newTestCachedPool(pool)
+
+	// the caller stops reading after the first orchestrator
+	ctx, cancel := context.WithCancel(context.Background())
+	orchInfos := c.StreamOrchestrators(ctx, 2, nil)
+	assert.Equal(a, <-orchInfos)
+	cancel()
+	for range orchInfos {
+	}
+	waitRefreshed(t, c)
+
+	// yet every orchestrator discovered is cached
+	c.lock.Lock()
+	require.Len(t, c.uris, 2)
+	assert.Equal("a:8935", c.uris[0].Host)
+	assert.Equal("b:8935", c.uris[1].Host)
+	c.lock.Unlock()
+
+	// and queried again by the next caller
+	var orchs []*net.OrchestratorInfo
+	for o := range c.StreamOrchestrators(context.Background(), 2, nil) {
+		orchs = append(orchs, o)
+	}
+	assert.Equal([]string{a.Transcoder, b.Transcoder}, transcoders(orchs))
+	mu.Lock()
+	assert.Equal(map[string]int{"a:8935": 1, "b:8935": 1}, queries)
+	mu.Unlock()
+	waitRefreshed(t, c)
+}
@@ -1,6 +1,10 @@
 package discovery
 
 import (
+	"context"
+	"math/big"
+	"math/rand"
+	"sync"
 	"time"
 
 	"github.com/livepeer/go-livepeer/common"
@@ -11,13 +15,30 @@ import (
 	"github.com/golang/glog"
 )
 
-var cacheRefreshInterval = 1 * time.Hour
+// How often the registered orchestrators are fetched from the chain
+var CacheRefreshInterval = 1 * time.Hour
+
+// How long orchestrators fetched from the chain are used for after they were
+// last seen registered
+var CacheTTL = 24 * time.Hour
+
+// Multiple of the number of orchestrators requested that are sampled from
+// the cache and queried, to make up for the ones that don't respond
+var sampleFactor = 2
+
 var getTicker = func() *time.Ticker {
-	return time.NewTicker(cacheRefreshInterval)
+	return time.NewTicker(CacheRefreshInterval)
 }
 
+// DBOrchestratorPoolCache discovers orchestrators from the registered
+// orchestrators on chain, cached in the node DB and refreshed in the
+// background. Orchestrators are queried in a random sample weighted by
+// their stake.
 type DBOrchestratorPoolCache struct {
 	node *core.LivepeerNode
+
+	randLock sync.Mutex // rand.Rand is not safe for concurrent use
+	rand     *rand.Rand
 }
 
 func NewDBOrchestratorPoolCache(node *core.LivepeerNode) *DBOrchestratorPoolCache {
@@ -38,29 +59,102 @@ func NewDBOrchestratorPoolCache(node *core.LivepeerNode) *DBOrchestratorPoolCach
 		}
 	}(node)
 
-	return &DBOrchestratorPoolCache{node: node}
+	return &DBOrchestratorPoolCache{node: node, rand: rand.New(rand.NewSource(time.Now().UnixNano()))}
 }
 
-func (dbo *DBOrchestratorPoolCache) GetOrchestrators(numOrchestrators int) ([]*net.OrchestratorInfo, error) {
-	orchs, err := dbo.node.Database.SelectOrchs()
+func (dbo *DBOrchestratorPoolCache) GetOrchestrators(numOrchestrators int, constraints *net.OrchestratorConstraints) ([]*net.OrchestratorInfo, error) {
+	orchPool, err := dbo.samplePool(numOrchestrators)
+	if err != nil || orchPool == nil {
+		return nil, err
+	}
+
+	orchInfos, err := orchPool.GetOrchestrators(numOrchestrators, constraints)
+	if err != nil || len(orchInfos) <= 0 {
+		return nil, err
+	}
+
+	return orchInfos, nil
+}
+
+func (dbo *DBOrchestratorPoolCache) StreamOrchestrators(ctx context.Context, numOrchestrators int, constraints *net.OrchestratorConstraints) <-chan *net.OrchestratorInfo {
+	orchPool, err := dbo.samplePool(numOrchestrators)
+	if err != nil || orchPool == nil {
+		if err != nil {
+			glog.Error("Could not select cached orchestrators: ", err)
+		}
+		orchInfos := make(chan *net.OrchestratorInfo)
+		close(orchInfos)
+		return orchInfos
+	}
+	return orchPool.StreamOrchestrators(ctx, numOrchestrators, constraints)
+}
+
+// samplePool returns a pool of the cached orchestrators sampled to query
+// for numOrchestrators, or nil if none are cached
+func (dbo *DBOrchestratorPoolCache) samplePool(numOrchestrators int) (*orchestratorPool, error) {
+	orchs, err := dbo.node.Database.SelectOrchsUpdatedWithin(CacheTTL)
 	if err != nil || len(orchs) <= 0 {
 		return nil, err
 	}
 
+	dbo.randLock.Lock()
+	sample := stakeSample(dbo.rand, orchs, sampleFactor*numOrchestrators)
+	dbo.randLock.Unlock()
+
 	var uris []string
-	for _, orch := range orchs {
+	for _, orch := range sample {
 		uri := orch.ServiceURI
 		uris = append(uris, uri)
 	}
 
-	orchPool := NewOrchestratorPool(dbo.node, uris)
+	return NewOrchestratorPool(dbo.node, uris), nil
+}
 
-	orchInfos, err := orchPool.GetOrchestrators(numOrchestrators)
-	if err != nil || len(orchInfos) <= 0 {
-		return nil, err
+// stakeSample returns up to n of orchs, picked at random without
+// replacement and weighted by stake. Orchestrators without a known stake are
+// only picked once all the staked ones are.
+func stakeSample(r *rand.Rand, orchs []*common.DBOrch, n int) []*common.DBOrch {
+	if n >= len(orchs) {
+		return orchs
+	}
+	rest := append([]*common.DBOrch(nil), orchs...)
+	total := new(big.Int)
+	for _, o := range rest {
+		if o.Stake != nil && o.Stake.Sign() > 0 {
+			total.Add(total, o.Stake)
+		}
 	}
+	sample := make([]*common.DBOrch, 0, n)
+	for len(sample) < n {
+		var i int
+		if total.Sign() > 0 {
+			i = pickByStake(r, rest, total)
+			total.Sub(total, rest[i].Stake)
+		} else {
+			i = r.Intn(len(rest))
+		}
+		sample = append(sample, rest[i])
+		rest = append(rest[:i], rest[i+1:]...)
+	}
+	return sample
+}
 
-	return orchInfos, nil
+// pickByStake returns the index of a random staked orchestrator of orchs,
+// weighted by stake. total is the sum of their stakes and must be positive.
+func pickByStake(r *rand.Rand, orchs []*common.DBOrch, total *big.Int) int {
+	w := new(big.Int).Rand(r, total)
+	last := 0
+	for i, o := range orchs {
+		if o.Stake == nil || o.Stake.Sign() <= 0 {
+			continue
+		}
+		if w.Cmp(o.Stake) < 0 {
+			return i
+		}
+		w.Sub(w, o.Stake)
+		last = i
+	}
+	return last
 }
 
 func cacheRegisteredTranscoders(node *core.LivepeerNode) error {
@@ -104,5 +198,7 @@ func ethOrchToDBOrch(orch *lpTypes.Transcoder) *common.DBOrch {
 	if orch == nil {
 		return nil
 	}
-	return common.NewDBOrch(orch.ServiceURI, orch.Address.String())
+	dbOrch := common.NewDBOrch(orch.ServiceURI, orch.Address.String())
+	dbOrch.Stake = orch.DelegatedStake
+	return dbOrch
 }
@@ -5,9 +5,9 @@ import (
 	"math/rand"
 	"net/url"
 	"strings"
-	"sync"
 	"time"
 
+	"github.com/livepeer/go-livepeer/common"
 	"github.com/livepeer/go-livepeer/core"
 	"github.com/livepeer/go-livepeer/monitor"
 	"github.com/livepeer/go-livepeer/net"
@@ -16,7 +16,13 @@ import (
 	"github.com/golang/glog"
 )
 
-const GetOrchestratorsTimeoutLoop = 1 * time.Hour
+// How long discovery waits for orchestrators to respond. The orchestrators
+// that responded by then are returned.
+var DiscoveryTimeout = 5 * time.Second
+
+// How long each orchestrator is given to respond to discovery. Orchestrators
+// that don't are skipped rather than holding up discovery until it times out.
+var OrchestratorTimeout = 3 * time.Second
 
 type orchestratorPool struct {
 	uris  []*url.URL
@@ -25,6 +31,8 @@ type orchestratorPool struct {
 
 var perm = func(len int) []int { return rand.Perm(len) }
 
+var getOrchestratorInfo = server.GetOrchestratorInfo
+
 func NewOrchestratorPool(node *core.LivepeerNode, addresses []string) *orchestratorPool {
 	var uris []*url.URL
 
@@ -75,54 +83,76 @@ func NewOnchainOrchestratorPool(node *core.LivepeerNode) *orchestratorPool {
 	return NewOrchestratorPool(node, addresses)
 }
 
-func (o *orchestratorPool) GetOrchestrators(numOrchestrators int) ([]*net.OrchestratorInfo, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), GetOrchestratorsTimeoutLoop)
+func (o *orchestratorPool) GetOrchestrators(numOrchestrators int, constraints *net.OrchestratorConstraints) ([]*net.OrchestratorInfo, error) {
 	orchInfos := []*net.OrchestratorInfo{}
-	orchChan := make(chan struct{})
-	numResp := 0
-	numSuccessResp := 0
-	respLock := sync.Mutex{}
-
-	getOrchInfo := func(uri *url.URL) {
-		info, err := server.GetOrchestratorInfo(ctx, o.bcast, uri)
-		respLock.Lock()
-		defer respLock.Unlock()
-		numResp++
-		if err == nil {
-			orchInfos = append(orchInfos, info)
-			numSuccessResp++
-		} else if monitor.Enabled {
-			monitor.LogDiscoveryError(err.Error())
-		}
-		if numSuccessResp >= numOrchestrators || numResp >= len(o.uris) {
-			orchChan <- struct{}{}
-		}
+	for info := range o.StreamOrchestrators(context.Background(), numOrchestrators, constraints) {
+		orchInfos = append(orchInfos, info)
+	}
+	if monitor.Enabled {
+		monitor.LogDiscoveryResponses(numOrchestrators, len(orchInfos))
+	}
+	glog.Info("Done fetching orch info for orchestrators, numResponses fetched: ", orchInfos)
+	return orchInfos, nil
+}
+
+// StreamOrchestrators queries the orchestrators of the pool in parallel and
+// sends those meeting the constraints on the returned channel as they
+// respond, up to numOrchestrators of them. The channel is closed once that
+// many were sent, every orchestrator responded or timed out, or ctx is done
+// or DiscoveryTimeout passed; queries still in flight are then cancelled.
+func (o *orchestratorPool) StreamOrchestrators(ctx context.Context, numOrchestrators int, constraints *net.OrchestratorConstraints) <-chan *net.OrchestratorInfo {
+	if monitor.Enabled {
+		monitor.OrchestratorPoolSize(len(o.uris))
 	}
+	return streamOrchestrators(ctx, o.bcast, o.uris, numOrchestrators, constraints)
+}
 
-	for _, uri := range o.uris {
-		go getOrchInfo(uri)
+func streamOrchestrators(ctx context.Context, bcast server.Broadcaster, uris []*url.URL, numOrchestrators int, constraints *net.OrchestratorConstraints) <-chan *net.OrchestratorInfo {
+	timeout, orchTimeout, getInfo := DiscoveryTimeout, OrchestratorTimeout, getOrchestratorInfo
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	// buffered so queries finishing after the stream is closed don't block
+	responses := make(chan *net.OrchestratorInfo, len(uris))
+	for _, uri := range uris {
+		go func(uri *url.URL) {
+			octx, ocancel := context.WithTimeout(ctx, orchTimeout)
+			defer ocancel()
+			info, err := getInfo(octx, bcast, uri)
+			if err != nil {
+				// queries cancelled along with the stream didn't fail
+				if monitor.Enabled && ctx.Err() == nil {
+					monitor.LogDiscoveryError(err.Error())
+				}
+				info = nil
+			} else if !constraints.Matches(info) {
+				glog.V(common.DEBUG).Infof("Skipping orchestrator=%s not meeting broadcaster constraints", uri)
+				info = nil
+			}
+			responses <- info
+		}(uri)
 	}
 
-	select {
-	case <-ctx.Done():
-		respLock.Lock()
-		if len(orchInfos) < numOrchestrators {
-			numOrchestrators = len(orchInfos)
-		}
-		returnOrchs := orchInfos[:numOrchestrators]
-		respLock.Unlock()
-		glog.Info("Done fetching orch info for orchestrators, context timeout: ", returnOrchs)
-		cancel()
-		return returnOrchs, nil
-	case <-orchChan:
-		respLock.Lock()
-		if len(orchInfos) < numOrchestrators {
-			numOrchestrators = len(orchInfos)
-		}
-		returnOrchs := orchInfos[:numOrchestrators]
-		respLock.Unlock()
-		glog.Info("Done fetching orch info for orchestrators, numResponses fetched: ", returnOrchs)
-		cancel()
-		return returnOrchs, nil
+	if numOrchestrators < 0 {
+		numOrchestrators = 0
 	}
+	orchInfos := make(chan *net.OrchestratorInfo, numOrchestrators)
+	go func() {
+		defer cancel()
+		defer close(orchInfos)
+		sent := 0
+		for numResp := 0; numResp < len(uris) && sent < numOrchestrators; numResp++ {
+			select {
+			case info := <-responses:
+				if info != nil {
+					orchInfos <- info
+					sent++
+				}
+			case <-ctx.Done():
+				if ctx.Err() == context.DeadlineExceeded {
+					glog.Infof("Discovery timed out after %v with %d of %d orchestrators responded", timeout, numResp, len(uris))
+				}
+				return
+			}
+		}
+	}()
+	return orchInfos
 }
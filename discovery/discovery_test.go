@@ -1,15 +1,20 @@
 package discovery
 
 import (
+	"context"
+	"errors"
+	"math/big"
 	"math/rand"
 	"net/url"
 	"testing"
+	"time"
 
 	ethcommon "github.com/ethereum/go-ethereum/common"
 	"github.com/livepeer/go-livepeer/common"
 	"github.com/livepeer/go-livepeer/core"
 	"github.com/livepeer/go-livepeer/eth"
 	lpTypes "github.com/livepeer/go-livepeer/eth/types"
+	"github.com/livepeer/go-livepeer/net"
 	"github.com/livepeer/go-livepeer/server"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -124,3 +129,145 @@ func TestNewOrchestratorPoolCache_GivenListOfOrchs_CreatesPoolCacheCorrectly(t *
 		assert.Equal(uri.String(), expected[i])
 	}
 }
+
+func TestStakeSample(t *testing.T) {
+	assert := assert.New(t)
+	r := rand.New(rand.NewSource(321))
+	unstaked := &common.DBOrch{ServiceURI: "https://127.0.0.1:8936"}
+	high := &common.DBOrch{ServiceURI: "https://127.0.0.1:8937", Stake: big.NewInt(1000)}
+	low := &common.DBOrch{ServiceURI: "https://127.0.0.1:8938", Stake: big.NewInt(1)}
+	orchs := []*common.DBOrch{unstaked, high, low}
+
+	assert.Equal(orchs, stakeSample(r, orchs, 3))
+	assert.Equal(orchs, stakeSample(r, orchs, 5))
+
+	// staked orchestrators are picked first
+	for i := 0; i < 10; i++ {
+		assert.ElementsMatch([]*common.DBOrch{high, low}, stakeSample(r, orchs, 2))
+	}
+
+	// in proportion to their stake
+	picked := 0
+	for i := 0; i < 1000; i++ {
+		if stakeSample(r, orchs, 1)[0] == high {
+			picked++
+		}
+	}
+	assert.True(picked > 950, "picked=%d", picked)
+
+	// the input isn't changed
+	assert.Equal([]*common.DBOrch{unstaked, high, low}, orchs)
+}
+
+func TestCacheDBOrchs_StoresStake(t *testing.T) {
+	dbh, dbraw, err := common.TempDB(t)
+	require := require.New(t)
+	require.Nil(err)
+	defer dbh.Close()
+	defer dbraw.Close()
+
+	node, _ := core.NewLivepeerNode(nil, "", nil)
+	node.Database = dbh
+	orchestrators := StubOrchestrators([]string{"https://127.0.0.1:8936"})
+	orchestrators[0].DelegatedStake = big.NewInt(500)
+	_, err = cacheDBOrchs(node, orchestrators)
+	require.Nil(err)
+
+	orchs, err := dbh.SelectOrchsUpdatedWithin(CacheTTL)
+	require.Nil(err)
+	require.Len(orchs, 1)
+	assert.Equal(t, int64(500), orchs[0].Stake.Int64())
+}
+
+// stubOrchestratorInfo answers for the hosts in delays after the given delay
+// and fails for others
+func stubOrchestratorInfo(delays map[string]time.Duration) func() {
+	orig := getOrchestratorInfo
+	getOrchestratorInfo = func(ctx context.Context, bcast server.Broadcaster, uri *url.URL) (*net.OrchestratorInfo, error) {
+		delay, ok := delays[uri.Host]
+		if !ok {
+			return nil, errors.New("unreachable")
+		}
+		select {
+		case <-time.After(delay):
+			return &net.OrchestratorInfo{Transcoder: uri.String()}, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	return func() { getOrchestratorInfo = orig }
+}
+
+func TestStreamOrchestrators(t *testing.T) {
+	assert := assert.New(t)
+	defer stubOrchestratorInfo(map[string]time.Duration{
+		"fast:8935": 0,
+		"slow:8935": time.Hour,
+	})()
+	node, _ := core.NewLivepeerNode(nil, "", nil)
+	pool := NewOrchestratorPool(node, []string{"https://fast:8935", "https://slow:8935", "https://down:8935"})
+
+	// the first to respond is sent without waiting for the others
+	orchs := pool.StreamOrchestrators(context.Background(), 1, nil)
+	select {
+	case o := <-orchs:
+		assert.Equal("https://fast:8935", o.GetTranscoder())
+	case <-time.After(time.Second):
+		t.Fatal("orchestrator was not streamed")
+	}
+	_, open := <-orchs
+	assert.False(open)
+
+	// the stream ends with ctx
+	ctx, cancel := context.WithCancel(context.Background())
+	orchs = pool.StreamOrchestrators(ctx, 2, nil)
+	assert.Equal("https://fast:8935", (<-orchs).GetTranscoder())
+	cancel()
+	_, open = <-orchs
+	assert.False(open)
+
+	// and GetOrchestrators returns what the stream sent
+	infos, err := pool.GetOrchestrators(1, nil)
+	require.Nil(t, err)
+	require.Len(t, infos, 1)
+	assert.Equal("https://fast:8935", infos[0].GetTranscoder())
+
+	// orchestrators not meeting the constraints aren't sent
+	orchs = pool.StreamOrchestrators(context.Background(), 1, &net.OrchestratorConstraints{Capabilities: []string{"hevc"}})
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	select {
+	case o := <-orchs:
+		t.Fatalf("unexpected orchestrator=%s", o.GetTranscoder())
+	case <-ctx.Done():
+	}
+}
+
+func TestGetOrchestrators_Timeouts(t *testing.T) {
+	assert := assert.New(t)
+	defer func(d, o time.Duration) { DiscoveryTimeout, OrchestratorTimeout = d, o }(DiscoveryTimeout, OrchestratorTimeout)
+	defer stubOrchestratorInfo(map[string]time.Duration{
+		"fast:8935":    0,
+		"slower:8935":  100 * time.Millisecond,
+		"hanging:8935": time.Hour,
+	})()
+	node, _ := core.NewLivepeerNode(nil, "", nil)
+	pool := NewOrchestratorPool(node, []string{"https://fast:8935", "https://slower:8935", "https://hanging:8935"})
+
+	// orchestrators that don't respond in time are skipped
+	DiscoveryTimeout, OrchestratorTimeout = time.Hour, 200*time.Millisecond
+	start := time.Now()
+	infos, err := pool.GetOrchestrators(3, nil)
+	require.Nil(t, err)
+	assert.Len(infos, 2)
+	assert.True(time.Since(start) < time.Second)
+
+	// and those that responded by the deadline are returned
+	DiscoveryTimeout, OrchestratorTimeout = 50*time.Millisecond, time.Hour
+	start = time.Now()
+	infos, err = pool.GetOrchestrators(3, nil)
+	require.Nil(t, err)
+	require.Len(t, infos, 1)
+	assert.Equal("https://fast:8935", infos[0].GetTranscoder())
+	assert.True(time.Since(start) < time.Second)
+}
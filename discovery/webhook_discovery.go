@@ -0,0 +1,168 @@
+package discovery
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/livepeer/go-livepeer/core"
+	"github.com/livepeer/go-livepeer/net"
+
+	"github.com/golang/glog"
+)
+
+var webhookClient = &http.Client{Timeout: 10 * time.Second}
+
+// Largest orchestrator list read from the webhook
+const maxWebhookResponse = 1 << 20
+
+// webhookOrchestrator is an orchestrator listed by the discovery webhook,
+// either as an object or as a plain URI string
+type webhookOrchestrator struct {
+	Address string `json:"address"`
+	// Orchestrators with higher scores are preferred
+	Score float64 `json:"score"`
+	// Orchestrators asking for more wei per segment than the broadcaster's
+	// max price are skipped without being queried
+	PricePerSegment *big.Int `json:"pricePerSegment"`
+}
+
+func (o *webhookOrchestrator) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &o.Address); err == nil {
+		return nil
+	}
+	type orch webhookOrchestrator // without this method
+	return json.Unmarshal(data, (*orch)(o))
+}
+
+// webhookPool discovers orchestrators from a list fetched from a webhook on
+// an interval. The last list fetched successfully is kept if the webhook
+// fails.
+type webhookPool struct {
+	node *core.LivepeerNode
+	url  string
+
+	lock  sync.RWMutex
+	orchs []webhookOrchestrator
+}
+
+func NewWebhookPool(node *core.LivepeerNode, callback string, refresh time.Duration) *webhookPool {
+	pool := &webhookPool{node: node, url: callback}
+	if err := pool.refresh(); err != nil {
+		glog.Error("Could not fetch orchestrators from webhook: ", err)
+	}
+	if refresh > 0 {
+		ticker := time.NewTicker(refresh)
+		go func() {
+			for range ticker.C {
+				if err := pool.refresh(); err != nil {
+					glog.Error("Could not refresh orchestrators from webhook: ", err)
+				}
+			}
+		}()
+	}
+	return pool
+}
+
+func (w *webhookPool) refresh() error {
+	resp, err := webhookClient.Get(w.url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxWebhookResponse))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("status=%d body=%s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	var orchs []webhookOrchestrator
+	if err := json.Unmarshal(body, &orchs); err != nil {
+		return err
+	}
+	w.lock.Lock()
+	w.orchs = orchs
+	w.lock.Unlock()
+	glog.V(6).Infof("Fetched %d orchestrators from webhook", len(orchs))
+	return nil
+}
+
+func (w *webhookPool) GetOrchestrators(numOrchestrators int, constraints *net.OrchestratorConstraints) ([]*net.OrchestratorInfo, error) {
+	addresses, scores := w.candidates(constraints)
+	if len(addresses) <= 0 {
+		return nil, nil
+	}
+
+	// every candidate is waited for, so that the best scoring ones are
+	// returned rather than the best of the first few to respond
+	orchInfos, err := NewOrchestratorPool(w.node, addresses).GetOrchestrators(len(addresses), constraints)
+	if err != nil || len(orchInfos) <= 0 {
+		return nil, err
+	}
+	sort.SliceStable(orchInfos, func(i, j int) bool {
+		return scores[webhookHost(orchInfos[i].GetTranscoder())] > scores[webhookHost(orchInfos[j].GetTranscoder())]
+	})
+	if len(orchInfos) > numOrchestrators {
+		orchInfos = orchInfos[:numOrchestrators]
+	}
+	return orchInfos, nil
+}
+
+// StreamOrchestrators sends orchestrators in the order they respond rather
+// than by score
+func (w *webhookPool) StreamOrchestrators(ctx context.Context, numOrchestrators int, constraints *net.OrchestratorConstraints) <-chan *net.OrchestratorInfo {
+	addresses, _ := w.candidates(constraints)
+	if len(addresses) <= 0 {
+		orchInfos := make(chan *net.OrchestratorInfo)
+		close(orchInfos)
+		return orchInfos
+	}
+	return NewOrchestratorPool(w.node, addresses).StreamOrchestrators(ctx, numOrchestrators, constraints)
+}
+
+// candidates returns the addresses of the listed orchestrators not asking for
+// more than the max price of the constraints, and the scores of their hosts
+func (w *webhookPool) candidates(constraints *net.OrchestratorConstraints) ([]string, map[string]float64) {
+	w.lock.RLock()
+	orchs := w.orchs
+	w.lock.RUnlock()
+
+	var max *big.Int
+	if constraints != nil {
+		max = constraints.MaxPrice
+	}
+	scores := make(map[string]float64)
+	var addresses []string
+	for _, o := range orchs {
+		if o.PricePerSegment != nil && max != nil && max.Sign() > 0 && o.PricePerSegment.Cmp(max) > 0 {
+			glog.V(6).Infof("Skipping orchestrator=%s with webhook price=%v above max=%v", o.Address, o.PricePerSegment, max)
+			continue
+		}
+		addresses = append(addresses, o.Address)
+		scores[webhookHost(o.Address)] = o.Score
+	}
+	return addresses, scores
+}
+
+// webhookHost returns the host of an orchestrator address, which matches
+// the transcoder URI orchestrators advertise at that address
+func webhookHost(addr string) string {
+	if !strings.HasPrefix(addr, "http") {
+		addr = "https://" + addr
+	}
+	u, err := url.Parse(addr)
+	if err != nil {
+		return addr
+	}
+	return u.Host
+}
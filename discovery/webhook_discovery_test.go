@@ -0,0 +1,102 @@
+package discovery
+
+import (
+	"context"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/livepeer/go-livepeer/core"
+	"github.com/livepeer/go-livepeer/net"
+	"github.com/livepeer/go-livepeer/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhookPool_Refresh(t *testing.T) {
+	assert := assert.New(t)
+	var body atomic.Value
+	body.Store(`["https://127.0.0.1:8936", {"address": "127.0.0.1:8937", "score": 0.5, "pricePerSegment": 1000}]`)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b := body.Load().(string)
+		if b == "" {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(b))
+	}))
+	defer ts.Close()
+
+	node, _ := core.NewLivepeerNode(nil, "", nil)
+	pool := NewWebhookPool(node, ts.URL, 0)
+	require.Len(t, pool.orchs, 2)
+	assert.Equal("https://127.0.0.1:8936", pool.orchs[0].Address)
+	assert.Nil(pool.orchs[0].PricePerSegment)
+	assert.Equal("127.0.0.1:8937", pool.orchs[1].Address)
+	assert.Equal(0.5, pool.orchs[1].Score)
+	assert.Equal(int64(1000), pool.orchs[1].PricePerSegment.Int64())
+
+	// the last list fetched is kept when the webhook fails
+	body.Store("")
+	assert.NotNil(pool.refresh())
+	assert.Len(pool.orchs, 2)
+	body.Store("not json")
+	assert.NotNil(pool.refresh())
+	assert.Len(pool.orchs, 2)
+
+	body.Store(`[]`)
+	assert.Nil(pool.refresh())
+	assert.Len(pool.orchs, 0)
+}
+
+func TestWebhookPool_PriceFilter(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[{"address": "127.0.0.1:8936", "pricePerSegment": 11}]`))
+	}))
+	defer ts.Close()
+
+	node, _ := core.NewLivepeerNode(nil, "", nil)
+	pool := NewWebhookPool(node, ts.URL, 0)
+	require.Len(t, pool.orchs, 1)
+
+	// orchestrators above the max price aren't queried
+	orchs, err := pool.GetOrchestrators(1, &net.OrchestratorConstraints{MaxPrice: big.NewInt(10)})
+	assert.Nil(t, err)
+	assert.Empty(t, orchs)
+}
+
+func TestWebhookPool_Scores(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[{"address": "a:8935", "score": 0.1}, {"address": "b:8935", "score": 0.9}, {"address": "c:8935", "score": 0.5}]`))
+	}))
+	defer ts.Close()
+
+	// the best scoring orchestrator is the slowest to respond
+	orig := getOrchestratorInfo
+	defer func() { getOrchestratorInfo = orig }()
+	getOrchestratorInfo = func(ctx context.Context, bcast server.Broadcaster, uri *url.URL) (*net.OrchestratorInfo, error) {
+		if uri.Host == "b:8935" {
+			time.Sleep(50 * time.Millisecond)
+		}
+		return &net.OrchestratorInfo{Transcoder: "https://" + uri.Host}, nil
+	}
+
+	node, _ := core.NewLivepeerNode(nil, "", nil)
+	pool := NewWebhookPool(node, ts.URL, 0)
+	orchs, err := pool.GetOrchestrators(2, nil)
+	require.Nil(t, err)
+	require.Len(t, orchs, 2)
+	assert.Equal(t, "https://b:8935", orchs[0].Transcoder)
+	assert.Equal(t, "https://c:8935", orchs[1].Transcoder)
+}
+
+func TestWebhookHost(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal("127.0.0.1:8936", webhookHost("127.0.0.1:8936"))
+	assert.Equal("127.0.0.1:8936", webhookHost("https://127.0.0.1:8936"))
+	assert.Equal("orch.example:8935", webhookHost("https://orch.example:8935/"))
+}
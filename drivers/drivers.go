@@ -2,14 +2,17 @@
 package drivers
 
 import (
+	"context"
 	"crypto/tls"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"time"
 
 	"github.com/golang/glog"
 	"github.com/livepeer/go-livepeer/common"
+	"github.com/livepeer/go-livepeer/monitor"
 	"github.com/livepeer/go-livepeer/net"
 )
 
@@ -53,21 +56,51 @@ func IsOwnExternal(uri string) bool {
 }
 
 func GetSegmentData(uri string) ([]byte, error) {
+	return GetSegmentDataContext(context.Background(), uri)
+}
+
+// GetSegmentDataContext downloads the segment at uri, giving up once ctx is
+// done
+func GetSegmentDataContext(ctx context.Context, uri string) ([]byte, error) {
 	parsed, err := url.Parse(uri)
 	if err != nil {
 		return nil, fmt.Errorf("Invalid URI")
 	}
+	start := time.Now()
+	var data []byte
 	if parsed.Scheme == "ipfs" {
-		return GetSegmentDataIpfs(uri)
+		data, err = GetSegmentDataIpfs(uri)
+	} else {
+		data, err = getSegmentDataHTTP(ctx, uri)
+	}
+	if monitor.Enabled {
+		monitor.LogOSOperation(segmentDataDriver(parsed.Scheme, uri), monitor.OSOperationGetData, len(data), time.Since(start), err)
 	}
-	return getSegmentDataHTTP(uri)
+	return data, err
+}
+
+// segmentDataDriver names the storage a segment is downloaded from
+func segmentDataDriver(scheme, uri string) string {
+	switch {
+	case scheme == "ipfs":
+		return "ipfs"
+	case IsOwnStorageS3(uri):
+		return "s3"
+	case IsOwnStorageGS(uri):
+		return "gs"
+	}
+	return "http"
 }
 
 var httpc = &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
 
-func getSegmentDataHTTP(uri string) ([]byte, error) {
+func getSegmentDataHTTP(ctx context.Context, uri string) ([]byte, error) {
 	glog.V(common.VERBOSE).Info("Downloading ", uri)
-	resp, err := httpc.Get(uri)
+	req, err := http.NewRequest("GET", uri, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := httpc.Do(req.WithContext(ctx))
 	if err != nil {
 		glog.Error("Error getting HTTP ", err)
 		return nil, err
@@ -3,8 +3,10 @@ package drivers
 import (
 	"bytes"
 	"fmt"
+	"time"
 
 	"github.com/livepeer/go-livepeer/ipfs"
+	"github.com/livepeer/go-livepeer/monitor"
 	"github.com/livepeer/go-livepeer/net"
 )
 
@@ -45,7 +47,11 @@ func (os *ipfsOS) EndSession() {
 
 func (os *ipfsOS) SaveData(name string, data []byte) (string, error) {
 
+	start := time.Now()
 	reader := bytes.NewReader(data)
 	url, err := ipfsAPI.Add(reader)
+	if monitor.Enabled {
+		monitor.LogOSOperation("ipfs", monitor.OSOperationSaveData, len(data), time.Since(start), err)
+	}
 	return url, err
 }
@@ -5,7 +5,9 @@ import (
 	"net/url"
 	"path"
 	"sync"
+	"time"
 
+	"github.com/livepeer/go-livepeer/monitor"
 	"github.com/livepeer/go-livepeer/net"
 )
 
@@ -94,6 +96,15 @@ func (ostore *MemorySession) GetInfo() *net.OSInfo {
 }
 
 func (ostore *MemorySession) SaveData(name string, data []byte) (string, error) {
+	start := time.Now()
+	uri, err := ostore.saveData(name, data)
+	if monitor.Enabled {
+		monitor.LogOSOperation("memory", monitor.OSOperationSaveData, len(data), time.Since(start), err)
+	}
+	return uri, err
+}
+
+func (ostore *MemorySession) saveData(name string, data []byte) (string, error) {
 	path, file := path.Split(ostore.getAbsolutePath(name))
 
 	ostore.dLock.Lock()
@@ -16,6 +16,7 @@ import (
 
 	"github.com/golang/glog"
 	"github.com/livepeer/go-livepeer/common"
+	"github.com/livepeer/go-livepeer/monitor"
 	"github.com/livepeer/go-livepeer/net"
 
 	"github.com/aws/aws-sdk-go/aws"
@@ -129,7 +130,11 @@ func (os *s3Session) SaveData(name string, data []byte) (string, error) {
 	// tentativeUrl just used for logging
 	tentativeURL := path.Join(os.host, os.key, name)
 	glog.V(common.VERBOSE).Infof("Saving to S3 %s", tentativeURL)
+	start := time.Now()
 	path, err := os.postData(name, data)
+	if monitor.Enabled {
+		monitor.LogOSOperation(os.driverName(), monitor.OSOperationSaveData, len(data), time.Since(start), err)
+	}
 	if err != nil {
 		// handle error
 		glog.Errorf("Save S3 error: %v", err)
@@ -142,6 +147,14 @@ func (os *s3Session) SaveData(name string, data []byte) (string, error) {
 	return url, err
 }
 
+// driverName distinguishes S3 from Google Cloud Storage sessions
+func (os *s3Session) driverName() string {
+	if os.storageType == net.OSInfo_GOOGLE {
+		return "gs"
+	}
+	return "s3"
+}
+
 func (os *s3Session) getAbsURL(path string) string {
 	return os.host + "/" + path
 }
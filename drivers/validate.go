@@ -0,0 +1,97 @@
+package drivers
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidSegmentURL  = errors.New("Invalid segment URL")
+	ErrSegmentURLScheme   = errors.New("Segment URL scheme not allowed")
+	ErrSegmentURLPort     = errors.New("Segment URL port not allowed")
+	ErrSegmentURLInternal = errors.New("Segment URL points to an internal address")
+	ErrSegmentURLResolve  = errors.New("Segment URL host could not be resolved")
+)
+
+// How long resolving the host of a segment URL may take
+const segmentURLLookupTimeout = 2 * time.Second
+
+var lookupIPAddr = net.DefaultResolver.LookupIPAddr
+
+var allowedSegmentPorts = map[string]bool{"": true, "80": true, "443": true, "8080": true}
+
+var privateNets = func() []*net.IPNet {
+	cidrs := []string{
+		// RFC 1918
+		"10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16",
+		// link-local
+		"169.254.0.0/16", "fe80::/10",
+		// loopback, unique local and unspecified
+		"127.0.0.0/8", "::1/128", "fc00::/7", "0.0.0.0/8",
+	}
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, c := range cidrs {
+		_, n, _ := net.ParseCIDR(c)
+		nets = append(nets, n)
+	}
+	return nets
+}()
+
+// ValidateSegmentURL checks that a segment URL returned by an orchestrator is
+// safe to download from: it must be HTTP(S), use a standard port and not point
+// to a private, loopback or link-local address. Hostnames are resolved and
+// every address they resolve to is checked. URLs whose host matches one of
+// `allowedHosts` (eg, the orchestrator's own address) are always allowed.
+func ValidateSegmentURL(u string, allowedHosts ...string) error {
+	parsed, err := url.Parse(u)
+	if err != nil || parsed.Host == "" {
+		return ErrInvalidSegmentURL
+	}
+	for _, h := range allowedHosts {
+		if h != "" && strings.EqualFold(parsed.Host, h) {
+			return nil
+		}
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return ErrSegmentURLScheme
+	}
+	if !allowedSegmentPorts[parsed.Port()] {
+		return ErrSegmentURLPort
+	}
+	host := parsed.Hostname()
+	if strings.EqualFold(host, "localhost") {
+		return ErrSegmentURLInternal
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		if isInternalIP(ip) {
+			return ErrSegmentURLInternal
+		}
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), segmentURLLookupTimeout)
+	defer cancel()
+	addrs, err := lookupIPAddr(ctx, host)
+	if err != nil || len(addrs) == 0 {
+		return ErrSegmentURLResolve
+	}
+	for _, addr := range addrs {
+		if isInternalIP(addr.IP) {
+			return ErrSegmentURLInternal
+		}
+	}
+	return nil
+}
+
+func isInternalIP(ip net.IP) bool {
+	for _, n := range privateNets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,86 @@
+package drivers
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+)
+
+func stubLookup(hosts map[string][]string) func() {
+	orig := lookupIPAddr
+	lookupIPAddr = func(ctx context.Context, host string) ([]net.IPAddr, error) {
+		ips, ok := hosts[host]
+		if !ok {
+			return nil, errors.New("no such host")
+		}
+		var addrs []net.IPAddr
+		for _, ip := range ips {
+			addrs = append(addrs, net.IPAddr{IP: net.ParseIP(ip)})
+		}
+		return addrs, nil
+	}
+	return func() { lookupIPAddr = orig }
+}
+
+func TestValidateSegmentURL(t *testing.T) {
+	defer stubLookup(map[string][]string{
+		"example.com":       {"93.184.216.34", "2606:2800:220:1:248:1893:25c8:1946"},
+		"internal.example":  {"10.0.0.1"},
+		"rebind.example":    {"93.184.216.34", "127.0.0.1"},
+		"metadata.example":  {"::ffff:169.254.169.254"},
+		"localhost.example": {"::1"},
+	})()
+
+	rejects := map[string]error{
+		"":                                         ErrInvalidSegmentURL,
+		"://bad":                                   ErrInvalidSegmentURL,
+		"/relative/path.ts":                        ErrInvalidSegmentURL,
+		"ftp://example.com/0.ts":                   ErrSegmentURLScheme,
+		"file://host/etc/passwd":                   ErrSegmentURLScheme,
+		"ipfs://QmHash":                            ErrSegmentURLScheme,
+		"http://example.com:22/0.ts":               ErrSegmentURLPort,
+		"https://example.com:8936/":                ErrSegmentURLPort,
+		"http://10.1.2.3/0.ts":                     ErrSegmentURLInternal,
+		"http://172.16.0.1/0.ts":                   ErrSegmentURLInternal,
+		"http://172.31.255.255/0.ts":               ErrSegmentURLInternal,
+		"http://192.168.1.1/0.ts":                  ErrSegmentURLInternal,
+		"http://169.254.169.254/latest/meta-data/": ErrSegmentURLInternal,
+		"http://[fe80::1]/0.ts":                    ErrSegmentURLInternal,
+		"http://127.0.0.1/0.ts":                    ErrSegmentURLInternal,
+		"http://[::1]:8080/0.ts":                   ErrSegmentURLInternal,
+		"http://localhost/0.ts":                    ErrSegmentURLInternal,
+		"http://0.0.0.0/0.ts":                      ErrSegmentURLInternal,
+		"http://internal.example/0.ts":             ErrSegmentURLInternal,
+		"http://rebind.example/0.ts":               ErrSegmentURLInternal,
+		"http://metadata.example/0.ts":             ErrSegmentURLInternal,
+		"http://localhost.example:8080/0.ts":       ErrSegmentURLInternal,
+		"http://unknown.example/0.ts":              ErrSegmentURLResolve,
+	}
+	for u, expected := range rejects {
+		if err := ValidateSegmentURL(u); err != expected {
+			t.Errorf("URL %q: expected %v got %v", u, expected, err)
+		}
+	}
+
+	accepts := []string{
+		"http://example.com/0.ts",
+		"https://example.com:443/0.ts",
+		"http://example.com:8080/0.ts",
+		"https://8.8.8.8/0.ts",
+		"http://172.32.0.1/0.ts",
+	}
+	for _, u := range accepts {
+		if err := ValidateSegmentURL(u); err != nil {
+			t.Errorf("URL %q: unexpected error %v", u, err)
+		}
+	}
+
+	// orchestrator's own host is allowed regardless of port or address
+	if err := ValidateSegmentURL("https://127.0.0.1:8935/stream/0.ts", "127.0.0.1:8935"); err != nil {
+		t.Error("Unexpected error for orchestrator host ", err)
+	}
+	if err := ValidateSegmentURL("https://127.0.0.1:8936/stream/0.ts", "127.0.0.1:8935"); err != ErrSegmentURLPort {
+		t.Error("Expected port error for a different host; got ", err)
+	}
+}
@@ -121,6 +121,7 @@ type LivepeerEthClient interface {
 	WatchForRebond(chan *contracts.BondingManagerRebond) (ethereum.Subscription, error)
 	ProcessHistoricalWithdrawStake(*big.Int, func(*contracts.BondingManagerWithdrawStake) error) error
 	WatchForWithdrawStake(chan *contracts.BondingManagerWithdrawStake) (ethereum.Subscription, error)
+	WatchForWinningTicketRedeemed(chan *contracts.LivepeerETHTicketBrokerWinningTicketRedeemed) (ethereum.Subscription, error)
 
 	// Helpers
 	ContractAddresses() map[string]ethcommon.Address
@@ -999,6 +1000,27 @@ func (c *client) WatchForWithdrawStake(sink chan *contracts.BondingManagerWithdr
 	return sub, err
 }
 
+func (c *client) WatchForWinningTicketRedeemed(sink chan *contracts.LivepeerETHTicketBrokerWinningTicketRedeemed) (ethereum.Subscription, error) {
+	var (
+		sub ethereum.Subscription
+		err error
+	)
+
+	winningTicketWatcher := func() error {
+		sub, err = c.LivepeerETHTicketBrokerSession.Contract.LivepeerETHTicketBrokerFilterer.WatchWinningTicketRedeemed(nil, sink, []ethcommon.Address{c.Account().Address}, nil)
+		if err != nil {
+			glog.Error("Unable to start WinningTicketRedeemed watcher ", err)
+			return err
+		}
+
+		return nil
+	}
+
+	err = backoff.Retry(winningTicketWatcher, backoff.NewConstantBackOff(time.Second*2))
+
+	return sub, err
+}
+
 func filterOptsWithTimeout(start uint64) (*bind.FilterOpts, context.CancelFunc) {
 	ctx, cancel := context.WithTimeout(context.Background(), RPCTimeout)
 
@@ -0,0 +1,109 @@
+package eventservices
+
+import (
+	"context"
+	"fmt"
+
+	ethereum "github.com/ethereum/go-ethereum"
+	"github.com/golang/glog"
+	"github.com/livepeer/go-livepeer/eth"
+	"github.com/livepeer/go-livepeer/eth/contracts"
+	"github.com/livepeer/go-livepeer/monitor"
+)
+
+var (
+	ErrTicketServiceStarted = fmt.Errorf("ticket service already started")
+	ErrTicketServiceStopped = fmt.Errorf("ticket service already stopped")
+)
+
+var logWinningTicketSent = monitor.LogWinningTicketSent
+
+// TicketService watches the chain for winning tickets sent by this node
+// being redeemed, and records them in the census. The sender can't tell a
+// winning ticket apart when sending it, so redemption is the first time it
+// learns about the win.
+type TicketService struct {
+	client       eth.LivepeerEthClient
+	working      bool
+	cancelWorker context.CancelFunc
+	resubscribe  bool
+}
+
+func NewTicketService(client eth.LivepeerEthClient) *TicketService {
+	return &TicketService{
+		client:      client,
+		resubscribe: true,
+	}
+}
+
+func (s *TicketService) Start(ctx context.Context) error {
+	if s.working {
+		return ErrTicketServiceStarted
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	s.cancelWorker = cancel
+
+	go func() {
+		var (
+			sink = make(chan *contracts.LivepeerETHTicketBrokerWinningTicketRedeemed)
+			sub  ethereum.Subscription
+			errc <-chan error
+			err  error
+		)
+
+		for {
+			if s.resubscribe {
+				sub, err = s.client.WatchForWinningTicketRedeemed(sink)
+				if err != nil {
+					glog.Error(err)
+				} else {
+					s.resubscribe = false
+					if sub != nil {
+						errc = sub.Err()
+					}
+				}
+			}
+
+			select {
+			case redeemed := <-sink:
+				if monitor.Enabled {
+					logWinningTicketSent(redeemed.Recipient.Hex(), redeemed.FaceValue)
+				}
+			case subErr := <-errc:
+				sub.Unsubscribe()
+				errc = nil
+				s.resubscribe = true
+
+				glog.Error("Error with WinningTicketRedeemed subscription ", subErr)
+			case <-ctx.Done():
+				if sub != nil {
+					sub.Unsubscribe()
+				}
+
+				glog.Infof("Received cancellation for ticket service; stopping")
+
+				return
+			}
+		}
+	}()
+
+	s.working = true
+
+	return nil
+}
+
+func (s *TicketService) Stop() error {
+	if !s.working {
+		return ErrTicketServiceStopped
+	}
+
+	s.cancelWorker()
+	s.working = false
+
+	return nil
+}
+
+func (s *TicketService) IsWorking() bool {
+	return s.working
+}
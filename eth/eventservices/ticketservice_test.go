@@ -0,0 +1,155 @@
+package eventservices
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	ethereum "github.com/ethereum/go-ethereum"
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/livepeer/go-livepeer/eth"
+	"github.com/livepeer/go-livepeer/eth/contracts"
+	"github.com/livepeer/go-livepeer/monitor"
+)
+
+type stubSubscription struct {
+	errc chan error
+
+	lock         sync.Mutex
+	unsubscribed bool
+}
+
+func (s *stubSubscription) Unsubscribe() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.unsubscribed = true
+}
+
+func (s *stubSubscription) Err() <-chan error { return s.errc }
+
+func (s *stubSubscription) isUnsubscribed() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.unsubscribed
+}
+
+// ticketClient hands out a new subscription to each WinningTicketRedeemed
+// watch, along with the sink events are sent to
+type ticketClient struct {
+	*eth.StubClient
+	subs  chan *stubSubscription
+	sinks chan chan *contracts.LivepeerETHTicketBrokerWinningTicketRedeemed
+}
+
+func newTicketClient() *ticketClient {
+	return &ticketClient{
+		StubClient: &eth.StubClient{},
+		subs:       make(chan *stubSubscription, 10),
+		sinks:      make(chan chan *contracts.LivepeerETHTicketBrokerWinningTicketRedeemed, 10),
+	}
+}
+
+func (c *ticketClient) WatchForWinningTicketRedeemed(sink chan *contracts.LivepeerETHTicketBrokerWinningTicketRedeemed) (ethereum.Subscription, error) {
+	sub := &stubSubscription{errc: make(chan error, 1)}
+	c.subs <- sub
+	c.sinks <- sink
+	return sub, nil
+}
+
+func (c *ticketClient) nextSub(t *testing.T) (*stubSubscription, chan *contracts.LivepeerETHTicketBrokerWinningTicketRedeemed) {
+	select {
+	case sub := <-c.subs:
+		return sub, <-c.sinks
+	case <-time.After(time.Second):
+		t.Fatal("Timed out waiting for subscription")
+	}
+	return nil, nil
+}
+
+func TestTicketService_StartStop(t *testing.T) {
+	c := newTicketClient()
+	s := NewTicketService(c)
+	if s.IsWorking() {
+		t.Error("Expected new service not to be working")
+	}
+	if err := s.Stop(); err != ErrTicketServiceStopped {
+		t.Error("Unexpected error stopping service that wasn't started ", err)
+	}
+
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Start(context.Background()); err != ErrTicketServiceStarted {
+		t.Error("Unexpected error starting service twice ", err)
+	}
+	if !s.IsWorking() {
+		t.Error("Expected started service to be working")
+	}
+	sub, _ := c.nextSub(t)
+
+	// stopping unsubscribes from the events
+	if err := s.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	if s.IsWorking() {
+		t.Error("Expected stopped service not to be working")
+	}
+	for i := 0; i < 100 && !sub.isUnsubscribed(); i++ {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if !sub.isUnsubscribed() {
+		t.Error("Expected subscription to be unsubscribed")
+	}
+}
+
+func TestTicketService_Events(t *testing.T) {
+	defer func(enabled bool) { monitor.Enabled = enabled }(monitor.Enabled)
+	monitor.Enabled = true
+	type sent struct {
+		recipient string
+		faceValue *big.Int
+	}
+	logged := make(chan sent, 1)
+	defer func(f func(string, *big.Int)) { logWinningTicketSent = f }(logWinningTicketSent)
+	logWinningTicketSent = func(recipient string, faceValue *big.Int) {
+		logged <- sent{recipient, faceValue}
+	}
+	expectLogged := func(recipient ethcommon.Address, faceValue int64) {
+		select {
+		case l := <-logged:
+			if l.recipient != recipient.Hex() || l.faceValue.Int64() != faceValue {
+				t.Errorf("Unexpected winning ticket recipient=%s faceValue=%v", l.recipient, l.faceValue)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Timed out waiting for winning ticket")
+		}
+	}
+
+	c := newTicketClient()
+	s := NewTicketService(c)
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Stop()
+	sub, sink := c.nextSub(t)
+
+	// redeemed tickets are recorded as winning tickets sent
+	recipient := ethcommon.BytesToAddress([]byte{1})
+	sink <- &contracts.LivepeerETHTicketBrokerWinningTicketRedeemed{Recipient: recipient, FaceValue: big.NewInt(100)}
+	expectLogged(recipient, 100)
+
+	// failed subscriptions are replaced
+	sub.errc <- errors.New("connection lost")
+	next, sink := c.nextSub(t)
+	if !sub.isUnsubscribed() {
+		t.Error("Expected failed subscription to be unsubscribed")
+	}
+	sink <- &contracts.LivepeerETHTicketBrokerWinningTicketRedeemed{Recipient: recipient, FaceValue: big.NewInt(200)}
+	expectLogged(recipient, 200)
+	if next.isUnsubscribed() {
+		t.Error("Expected new subscription to be in use")
+	}
+}
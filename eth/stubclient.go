@@ -282,3 +282,6 @@ func (c *StubClient) ProcessHistoricalWithdrawStake(*big.Int, func(*contracts.Bo
 func (c *StubClient) WatchForWithdrawStake(chan *contracts.BondingManagerWithdrawStake) (ethereum.Subscription, error) {
 	return nil, nil
 }
+func (c *StubClient) WatchForWinningTicketRedeemed(chan *contracts.LivepeerETHTicketBrokerWinningTicketRedeemed) (ethereum.Subscription, error) {
+	return nil, nil
+}
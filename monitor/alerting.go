@@ -0,0 +1,206 @@
+package monitor
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// Number of recent segment upload durations kept for alerting, and how long
+// they are kept for; the upload time alert resolves once uploads stop
+const uploadTimeSamples = 100
+const uploadTimeWindow = 5 * time.Minute
+
+type uploadTime struct {
+	at  time.Time
+	dur time.Duration
+}
+
+// AlertCheckInterval is how often threshold alerts are evaluated
+var AlertCheckInterval = 30 * time.Second
+
+// AlertState is a snapshot of the census that threshold alerts are evaluated on
+type AlertState struct {
+	// Success rate averaged across active streams; NaN without active streams
+	SuccessRate float64
+	// Whether discovery has run, and how many orchestrators responded last time
+	DiscoveryRan           bool
+	OrchestratorsResponded int
+	// 95th percentile of the segment upload durations of the last
+	// uploadTimeWindow; zero if no segment was uploaded in that time
+	UploadTimeP95 time.Duration
+}
+
+// ThresholdAlert fires once Check has held continuously for For
+type ThresholdAlert struct {
+	Name string
+	For  time.Duration
+	// Check returns the observed value and whether the alert condition holds
+	Check func(s *AlertState) (float64, bool)
+}
+
+// SuccessRateBelowAlert fires when the average success rate stays below threshold
+func SuccessRateBelowAlert(threshold float64, dur time.Duration) ThresholdAlert {
+	return ThresholdAlert{
+		Name: fmt.Sprintf("success_rate < %v", threshold),
+		For:  dur,
+		Check: func(s *AlertState) (float64, bool) {
+			return s.SuccessRate, !math.IsNaN(s.SuccessRate) && s.SuccessRate < threshold
+		},
+	}
+}
+
+// NoOrchestratorsAlert fires when discovery keeps finding no orchestrators
+func NoOrchestratorsAlert(dur time.Duration) ThresholdAlert {
+	return ThresholdAlert{
+		Name: "no orchestrators found",
+		For:  dur,
+		Check: func(s *AlertState) (float64, bool) {
+			return float64(s.OrchestratorsResponded), s.DiscoveryRan && s.OrchestratorsResponded == 0
+		},
+	}
+}
+
+// UploadTimeP95AboveAlert fires when the p95 segment upload time stays above threshold
+func UploadTimeP95AboveAlert(threshold time.Duration, dur time.Duration) ThresholdAlert {
+	return ThresholdAlert{
+		Name: fmt.Sprintf("upload_time p95 > %v", threshold),
+		For:  dur,
+		Check: func(s *AlertState) (float64, bool) {
+			return s.UploadTimeP95.Seconds(), s.UploadTimeP95 > threshold
+		},
+	}
+}
+
+// AlertNotification is sent when an alert starts or stops firing. The Text
+// field makes it usable as a Slack incoming webhook payload.
+type AlertNotification struct {
+	Text     string  `json:"text"`
+	Alert    string  `json:"alert"`
+	Firing   bool    `json:"firing"`
+	Value    float64 `json:"value"`
+	NodeType string  `json:"nodeType"`
+	NodeID   string  `json:"nodeID"`
+	Time     int64   `json:"time"`
+}
+
+type thresholdAlertState struct {
+	alert  ThresholdAlert
+	since  time.Time // when the condition started holding; zero if it doesn't
+	firing bool
+}
+
+type alerter struct {
+	nodeType string
+	nodeID   string
+	alerts   []*thresholdAlertState
+	notify   func(n *AlertNotification)
+}
+
+// InitAlerting evaluates alerts against the default census every
+// AlertCheckInterval and POSTs an AlertNotification to webhookURL whenever an
+// alert starts or stops firing. Must be called after Init.
+func InitAlerting(webhookURL string, alerts ...ThresholdAlert) {
+	client := &http.Client{Timeout: webhookClientTimeout}
+	a := newAlerter(census.nodeType, census.nodeID, alerts, func(n *AlertNotification) {
+		body, err := json.Marshal(n)
+		if err != nil {
+			glog.Error("Error marshaling alert ", err)
+			return
+		}
+		resp, err := client.Post(webhookURL, "application/json", bytes.NewReader(body))
+		if err != nil {
+			glog.Errorf("Error posting alert %q to webhook %s: %v", n.Alert, webhookURL, err)
+			return
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			glog.Errorf("Error posting alert %q to webhook %s: status %d", n.Alert, webhookURL, resp.StatusCode)
+		}
+	})
+	go func() {
+		ticker := time.NewTicker(AlertCheckInterval)
+		defer ticker.Stop()
+		for now := range ticker.C {
+			a.evaluate(now, census.alertState(now))
+		}
+	}()
+}
+
+func newAlerter(nodeType, nodeID string, alerts []ThresholdAlert, notify func(n *AlertNotification)) *alerter {
+	a := &alerter{nodeType: nodeType, nodeID: nodeID, notify: notify}
+	for _, t := range alerts {
+		a.alerts = append(a.alerts, &thresholdAlertState{alert: t})
+	}
+	return a
+}
+
+// evaluate checks every alert against s and notifies on state changes
+func (a *alerter) evaluate(now time.Time, s *AlertState) {
+	for _, st := range a.alerts {
+		value, holds := st.alert.Check(s)
+		if !holds {
+			st.since = time.Time{}
+			if st.firing {
+				st.firing = false
+				a.send(now, st.alert, value, false)
+			}
+			continue
+		}
+		if st.since.IsZero() {
+			st.since = now
+		}
+		if !st.firing && now.Sub(st.since) >= st.alert.For {
+			st.firing = true
+			a.send(now, st.alert, value, true)
+		}
+	}
+}
+
+func (a *alerter) send(now time.Time, t ThresholdAlert, value float64, firing bool) {
+	status := "resolved"
+	if firing {
+		status = "firing"
+	}
+	text := fmt.Sprintf("[%s] %s on %s %s (value %v)", status, t.Name, a.nodeType, a.nodeID, value)
+	GetLogger().Error("Alert "+status, map[string]interface{}{"alert": t.Name, "value": value})
+	a.notify(&AlertNotification{
+		Text:     text,
+		Alert:    t.Name,
+		Firing:   firing,
+		Value:    value,
+		NodeType: a.nodeType,
+		NodeID:   a.nodeID,
+		Time:     now.Unix(),
+	})
+}
+
+// alertState takes a snapshot of the census at now for threshold alerts,
+// dropping upload durations older than uploadTimeWindow
+func (cen *censusMetricsCounter) alertState(now time.Time) *AlertState {
+	cen.lock.Lock()
+	defer cen.lock.Unlock()
+	s := &AlertState{
+		SuccessRate:            cen.successRate(),
+		DiscoveryRan:           cen.discoveryRan,
+		OrchestratorsResponded: cen.lastDiscoveryResponded,
+	}
+	for len(cen.uploadTimes) > 0 && now.Sub(cen.uploadTimes[0].at) > uploadTimeWindow {
+		cen.uploadTimes = cen.uploadTimes[1:]
+	}
+	if n := len(cen.uploadTimes); n > 0 {
+		sorted := make([]time.Duration, n)
+		for i, u := range cen.uploadTimes {
+			sorted[i] = u.dur
+		}
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+		s.UploadTimeP95 = sorted[(n*95-1)/100]
+	}
+	return s
+}
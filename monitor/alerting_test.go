@@ -0,0 +1,76 @@
+package monitor
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestAlerterEvaluate(t *testing.T) {
+	var sent []*AlertNotification
+	a := newAlerter("bctr", "node1", []ThresholdAlert{SuccessRateBelowAlert(0.9, time.Minute)}, func(n *AlertNotification) {
+		sent = append(sent, n)
+	})
+	start := time.Now()
+
+	// condition must hold for the whole duration before firing
+	a.evaluate(start, &AlertState{SuccessRate: 0.5})
+	a.evaluate(start.Add(30*time.Second), &AlertState{SuccessRate: 0.5})
+	if len(sent) != 0 {
+		t.Fatal("Alert fired early ", sent)
+	}
+	a.evaluate(start.Add(time.Minute), &AlertState{SuccessRate: 0.5})
+	if len(sent) != 1 || !sent[0].Firing || sent[0].Value != 0.5 || sent[0].NodeID != "node1" {
+		t.Fatal("Expected a firing notification ", sent)
+	}
+
+	// firing is only notified once
+	a.evaluate(start.Add(2*time.Minute), &AlertState{SuccessRate: 0.4})
+	if len(sent) != 1 {
+		t.Fatal("Unexpected notifications ", sent)
+	}
+
+	// the alert resolves once there are no streams, and doesn't fire again
+	// while there are none
+	a.evaluate(start.Add(3*time.Minute), &AlertState{SuccessRate: math.NaN()})
+	if len(sent) != 2 || sent[1].Firing {
+		t.Fatal("Expected a resolved notification ", sent)
+	}
+	a.evaluate(start.Add(10*time.Minute), &AlertState{SuccessRate: math.NaN()})
+	if len(sent) != 2 {
+		t.Error("Unexpected notifications ", sent)
+	}
+}
+
+func TestAlertState(t *testing.T) {
+	defer func(c *censusMetricsCounter) { census = c }(census)
+	census = &censusMetricsCounter{success: make(map[uint64]*segmentsAverager)}
+	start := time.Now()
+	for i := 1; i <= 100; i++ {
+		census.uploadTimes = append(census.uploadTimes, uploadTime{at: start, dur: time.Duration(i) * time.Millisecond})
+	}
+	census.discoveryRan = true
+
+	s := census.alertState(start)
+	if s.UploadTimeP95 != 95*time.Millisecond {
+		t.Error("Unexpected upload time p95 ", s.UploadTimeP95)
+	}
+	if _, firing := NoOrchestratorsAlert(0).Check(s); !firing {
+		t.Error("Expected no orchestrators alert to hold")
+	}
+	if _, firing := UploadTimeP95AboveAlert(100*time.Millisecond, 0).Check(s); firing {
+		t.Error("Unexpected upload time alert")
+	}
+	if _, firing := UploadTimeP95AboveAlert(50*time.Millisecond, 0).Check(s); !firing {
+		t.Error("Expected upload time alert to hold")
+	}
+
+	// the upload time alert resolves once the uploads age out
+	s = census.alertState(start.Add(uploadTimeWindow + time.Second))
+	if s.UploadTimeP95 != 0 || len(census.uploadTimes) != 0 {
+		t.Error("Expected old upload times to be dropped ", s.UploadTimeP95)
+	}
+	if _, firing := UploadTimeP95AboveAlert(50*time.Millisecond, 0).Check(s); firing {
+		t.Error("Unexpected upload time alert without recent uploads")
+	}
+}
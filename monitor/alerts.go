@@ -0,0 +1,86 @@
+package monitor
+
+import (
+	"fmt"
+	"strings"
+)
+
+// AlertRuleOpts holds the thresholds of the generated alerting rules. A zero
+// threshold leaves the corresponding rule out.
+type AlertRuleOpts struct {
+	// MinSuccessRate alerts when the success rate of a node drops below it
+	MinSuccessRate float64
+	// MaxTranscodeLatencyP95 alerts when the 95th percentile of transcode
+	// latency exceeds it, in seconds
+	MaxTranscodeLatencyP95 float64
+	// MaxLostSegmentsPerMinute alerts when more segments than this are lost
+	// in a minute
+	MaxLostSegmentsPerMinute int
+}
+
+// alert durations; conditions must hold this long before the alert fires
+const (
+	alertForSuccessRate = "5m"
+	alertForLatency     = "10m"
+	alertForLostSegment = "5m"
+)
+
+type alertRule struct {
+	name, expr, dur, summary string
+}
+
+// GenerateAlertingRules returns a Prometheus alerting rule file, in YAML,
+// for the metrics exported by this package
+func GenerateAlertingRules(opts AlertRuleOpts) string {
+	rules := []alertRule{}
+	if opts.MinSuccessRate > 0 {
+		rules = append(rules, alertRule{
+			name:    "LivepeerLowSuccessRate",
+			expr:    fmt.Sprintf("livepeer_success_rate < %v", opts.MinSuccessRate),
+			dur:     alertForSuccessRate,
+			summary: fmt.Sprintf("Success rate of {{ $labels.node_id }} is below %v", opts.MinSuccessRate),
+		})
+	}
+	if opts.MaxTranscodeLatencyP95 > 0 {
+		rules = append(rules, alertRule{
+			name: "LivepeerHighTranscodeLatency",
+			expr: fmt.Sprintf("histogram_quantile(0.95, sum by (node_id, le) (rate(livepeer_transcode_latency_seconds_bucket[5m]))) > %v",
+				opts.MaxTranscodeLatencyP95),
+			dur:     alertForLatency,
+			summary: fmt.Sprintf("95th percentile transcode latency of {{ $labels.node_id }} is above %vs", opts.MaxTranscodeLatencyP95),
+		})
+	}
+	if opts.MaxLostSegmentsPerMinute > 0 {
+		rules = append(rules, alertRule{
+			name: "LivepeerLostSegments",
+			expr: fmt.Sprintf(`sum by (node_id) (increase(livepeer_segment_transcode_failed_total{error_code="LostSegment"}[1m])) > %d`,
+				opts.MaxLostSegmentsPerMinute),
+			dur:     alertForLostSegment,
+			summary: fmt.Sprintf("{{ $labels.node_id }} is losing more than %d segments per minute", opts.MaxLostSegmentsPerMinute),
+		})
+	}
+
+	var b strings.Builder
+	b.WriteString("groups:\n")
+	b.WriteString("- name: livepeer\n")
+	if len(rules) == 0 {
+		b.WriteString("  rules: []\n")
+		return b.String()
+	}
+	b.WriteString("  rules:\n")
+	for _, r := range rules {
+		fmt.Fprintf(&b, "  - alert: %s\n", r.name)
+		fmt.Fprintf(&b, "    expr: %s\n", yamlQuote(r.expr))
+		fmt.Fprintf(&b, "    for: %s\n", r.dur)
+		b.WriteString("    labels:\n")
+		b.WriteString("      severity: warning\n")
+		b.WriteString("    annotations:\n")
+		fmt.Fprintf(&b, "      summary: %s\n", yamlQuote(r.summary))
+	}
+	return b.String()
+}
+
+// yamlQuote returns s as a single-quoted YAML scalar
+func yamlQuote(s string) string {
+	return "'" + strings.Replace(s, "'", "''", -1) + "'"
+}
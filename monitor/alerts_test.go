@@ -0,0 +1,71 @@
+package monitor
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/prometheus/prometheus/promql/parser"
+	"go.opencensus.io/stats/view"
+	"gopkg.in/yaml.v3"
+)
+
+type ruleFile struct {
+	Groups []struct {
+		Name  string `yaml:"name"`
+		Rules []struct {
+			Alert       string            `yaml:"alert"`
+			Expr        string            `yaml:"expr"`
+			For         string            `yaml:"for"`
+			Labels      map[string]string `yaml:"labels"`
+			Annotations map[string]string `yaml:"annotations"`
+		} `yaml:"rules"`
+	} `yaml:"groups"`
+}
+
+func TestGenerateAlertingRules(t *testing.T) {
+	initCensusOnce.Do(func() { initCensus("bctr", "test", "test") })
+
+	out := GenerateAlertingRules(AlertRuleOpts{
+		MinSuccessRate:           0.95,
+		MaxTranscodeLatencyP95:   4,
+		MaxLostSegmentsPerMinute: 2,
+	})
+	var rf ruleFile
+	if err := yaml.Unmarshal([]byte(out), &rf); err != nil {
+		t.Fatalf("Generated rules are not valid YAML: %v\n%s", err, out)
+	}
+	if len(rf.Groups) != 1 || len(rf.Groups[0].Rules) != 3 {
+		t.Fatalf("Unexpected rule layout:\n%s", out)
+	}
+	for _, r := range rf.Groups[0].Rules {
+		if r.Alert == "" || r.For == "" || r.Annotations["summary"] == "" {
+			t.Errorf("Incomplete rule %+v", r)
+		}
+		expr, err := parser.NewParser(parser.Options{}).ParseExpr(r.Expr)
+		if err != nil {
+			t.Errorf("Rule %s has an invalid expression %q: %v", r.Alert, r.Expr, err)
+			continue
+		}
+		// every metric referenced must be one of our registered views
+		parser.Inspect(expr, func(node parser.Node, _ []parser.Node) error {
+			vs, ok := node.(*parser.VectorSelector)
+			if !ok {
+				return nil
+			}
+			name := strings.TrimSuffix(strings.TrimPrefix(vs.Name, "livepeer_"), "_bucket")
+			if view.Find(name) == nil {
+				t.Errorf("Rule %s references unknown metric %s", r.Alert, vs.Name)
+			}
+			return nil
+		})
+	}
+
+	// zero thresholds disable the rules
+	rf = ruleFile{}
+	if err := yaml.Unmarshal([]byte(GenerateAlertingRules(AlertRuleOpts{MinSuccessRate: 0.9})), &rf); err != nil {
+		t.Fatal(err)
+	}
+	if len(rf.Groups[0].Rules) != 1 || rf.Groups[0].Rules[0].Alert != "LivepeerLowSuccessRate" {
+		t.Errorf("Unexpected rules %+v", rf.Groups[0].Rules)
+	}
+}
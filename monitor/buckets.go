@@ -0,0 +1,37 @@
+package monitor
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ParseHistogramBuckets parses bucket overrides in the form
+// `view=b1,b2,...;view2=...` for use as HistogramBuckets. Boundaries must
+// be strictly increasing.
+func ParseHistogramBuckets(s string) (map[string][]float64, error) {
+	res := make(map[string][]float64)
+	for _, spec := range strings.Split(s, ";") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		kv := strings.SplitN(spec, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, fmt.Errorf("invalid bucket spec %q", spec)
+		}
+		var bounds []float64
+		for _, b := range strings.Split(kv[1], ",") {
+			f, err := strconv.ParseFloat(strings.TrimSpace(b), 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid bucket boundary %q for %s", b, kv[0])
+			}
+			if len(bounds) > 0 && f <= bounds[len(bounds)-1] {
+				return nil, fmt.Errorf("bucket boundaries for %s must be increasing", kv[0])
+			}
+			bounds = append(bounds, f)
+		}
+		res[strings.TrimSpace(kv[0])] = bounds
+	}
+	return res, nil
+}
@@ -0,0 +1,29 @@
+package monitor
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseHistogramBuckets(t *testing.T) {
+	b, err := ParseHistogramBuckets("upload_time_seconds=0,1,5; transcode_time_seconds=2,4.5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string][]float64{
+		"upload_time_seconds":    []float64{0, 1, 5},
+		"transcode_time_seconds": []float64{2, 4.5},
+	}
+	if !reflect.DeepEqual(expected, b) {
+		t.Error("Unexpected buckets ", b)
+	}
+
+	if b, err := ParseHistogramBuckets(""); err != nil || len(b) != 0 {
+		t.Error("Expected no buckets; got ", b, err)
+	}
+	for _, s := range []string{"upload_time_seconds", "=1,2", "upload_time_seconds=1,x", "upload_time_seconds=2,1"} {
+		if _, err := ParseHistogramBuckets(s); err == nil {
+			t.Error("Expected error for ", s)
+		}
+	}
+}
@@ -2,18 +2,25 @@ package monitor
 
 import (
 	"context"
+	"errors"
+	"io"
+	"math"
+	"math/big"
 	"runtime"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/golang/glog"
 
+	"contrib.go.opencensus.io/exporter/prometheus"
 	rprom "github.com/prometheus/client_golang/prometheus"
-	"go.opencensus.io/exporter/prometheus"
 	"go.opencensus.io/stats"
 	"go.opencensus.io/stats/view"
 	"go.opencensus.io/tag"
+	"go.opencensus.io/trace"
 )
 
 type (
@@ -39,6 +46,8 @@ const (
 	SegmentTranscodeErrorSaveData           SegmentTranscodeError = "SaveData"
 	SegmentTranscodeErrorSessionEnded       SegmentTranscodeError = "SessionEnded"
 	SegmentTranscodeErrorPlaylist           SegmentTranscodeError = "Playlist"
+	SegmentTranscodeErrorCodecChange        SegmentTranscodeError = "CodecChange"
+	SegmentTranscodeErrorVerification       SegmentTranscodeError = "Verification"
 )
 
 type (
@@ -51,9 +60,19 @@ type (
 		kProfile                      tag.Key
 		kProfiles                     tag.Key
 		kErrorCode                    tag.Key
+		kOrchestrator                 tag.Key
+		kManifestID                   tag.Key
+		kSender                       tag.Key
+		kRecipient                    tag.Key
+		kGPU                          tag.Key
+		kDriver                       tag.Key
+		kOSOperation                  tag.Key
+		kDirection                    tag.Key
+		kStreamLabels                 []tag.Key
 		mSegmentSourceAppeared        *stats.Int64Measure
 		mSegmentEmerged               *stats.Int64Measure
 		mSegmentEmergedWithProfiles   *stats.Int64Measure
+		mSegmentEmergedBytes          *stats.Int64Measure
 		mSegmentUploaded              *stats.Int64Measure
 		mSegmentUploadFailed          *stats.Int64Measure
 		mSegmentTranscoded            *stats.Int64Measure
@@ -62,20 +81,102 @@ type (
 		mSegmentTranscodedAllAppeared *stats.Int64Measure
 		mStartBroadcastClientFailed   *stats.Int64Measure
 		mStreamCreateFailed           *stats.Int64Measure
+		mStreamRejected               *stats.Int64Measure
+		mSegmentTranscodedLocally     *stats.Int64Measure
 		mStreamCreated                *stats.Int64Measure
 		mStreamStarted                *stats.Int64Measure
 		mStreamEnded                  *stats.Int64Measure
 		mMaxSessions                  *stats.Int64Measure
 		mCurrentSessions              *stats.Int64Measure
 		mDiscoveryError               *stats.Int64Measure
+		mSessionRefreshError          *stats.Int64Measure
+		mEventsDropped                *stats.Int64Measure
+		mDuplicateSegment             *stats.Int64Measure
+		mOutOfOrderSegment            *stats.Int64Measure
+		mUploadConcurrency            *stats.Int64Measure
+		mTranscodeRetries             *stats.Int64Measure
+		mTranscodeRetryBacklog        *stats.Int64Measure
+		mTranscodeRetriesExhausted    *stats.Int64Measure
+		mEmergencyRefresh             *stats.Int64Measure
+		mWatchdogTimeout              *stats.Int64Measure
+		mCodecChange                  *stats.Int64Measure
+		mTranscodeCacheHit            *stats.Int64Measure
+		mTranscodeCacheMiss           *stats.Int64Measure
+		mWinningTickets               *stats.Int64Measure
+		mNonceCollision               *stats.Int64Measure
+		mProfileTranscodeFailed       *stats.Int64Measure
+		mGoroutineCount               *stats.Int64Measure
+		mGPUUtilization               *stats.Int64Measure
+		mGPUEncoderUtilization        *stats.Int64Measure
+		mGPUDecoderUtilization        *stats.Int64Measure
+		mGPUEncoderSessions           *stats.Int64Measure
+		mGPUMemoryUsed                *stats.Int64Measure
+		mGPUMemoryTotal               *stats.Int64Measure
+		mPlaylistInsertTotal          *stats.Int64Measure
+		mSegmentOversized             *stats.Int64Measure
+		mOrchSegmentReceived          *stats.Int64Measure
+		mOrchSegmentRejected          *stats.Int64Measure
+		mOrchTranscodeQueueDepth      *stats.Int64Measure
+		mOrchPaymentError             *stats.Int64Measure
+		mPlaylistInsertFailed         *stats.Int64Measure
 		mSuccessRate                  *stats.Float64Measure
+		mStreamSuccessRate            *stats.Float64Measure
+		vStreamSuccessRate            *view.View // dropping rows of ended streams
 		mTranscodeTime                *stats.Float64Measure
 		mTranscodeLatency             *stats.Float64Measure
 		mTranscodeOverallLatency      *stats.Float64Measure
+		mSegmentPipelineE2ELatency    *stats.Float64Measure
+		mTranscodeQualityScore        *stats.Float64Measure
+		mTranscodeQualityScoreLatest  *stats.Float64Measure
 		mUploadTime                   *stats.Float64Measure
+		mOrchestratorUploadTime       *stats.Float64Measure
+		mOrchestratorRoundTripTime    *stats.Float64Measure
+		mOrchestratorFailed           *stats.Int64Measure
+		mOrchestratorSuspended        *stats.Int64Measure
+		mOrchestratorOverPriced       *stats.Int64Measure
+		mOrchestratorPing             *stats.Float64Measure
+		mOrchestratorSpotCheckFailed  *stats.Int64Measure
+		mSegmentVerified              *stats.Int64Measure
+		mSegmentVerificationFailed    *stats.Int64Measure
+		mOSOperationTime              *stats.Float64Measure
+		mOSOperationBytes             *stats.Int64Measure
+		mBytesTransferred             *stats.Int64Measure
+		mOSOperationFailed            *stats.Int64Measure
+		mSessionRefreshDuration       *stats.Float64Measure
+		mDiscoveryLatency             *stats.Float64Measure
+		mSegmentDurationDrift         *stats.Float64Measure
+		mDiscoveryRequested           *stats.Int64Measure
+		mDiscoveryResponded           *stats.Int64Measure
+		mOrchestratorPoolSize         *stats.Int64Measure
+		mDiscoveryCacheHit            *stats.Int64Measure
+		mDiscoveryCacheMiss           *stats.Int64Measure
+		mDiscoveryCacheAge            *stats.Float64Measure
+		mTicketFaceValueSent          *stats.Float64Measure
+		mTicketFaceValueReceived      *stats.Float64Measure
+		mTicketRedemptionError        *stats.Int64Measure
+		mWinningTicketFaceValue       *stats.Float64Measure
+		mWinningTicketsSent           *stats.Int64Measure
+		mWinningTicketFaceValueSent   *stats.Float64Measure
+		mTicketRedemptionLatency      *stats.Float64Measure
 		lock                          sync.Mutex
-		emergeTimes                   map[uint64]map[uint64]time.Time // nonce:seqNo
+		emergeTimes                   map[uint64]map[uint64]time.Time         // nonce:seqNo
+		segmentTraces                 map[uint64]map[uint64]trace.SpanContext // nonce:seqNo, sampled segments only
+		exemplars                     map[string]*exemplarHistogram           // measure name:histogram
 		success                       map[uint64]*segmentsAverager
+		pmSessions                    map[string]string      // PM sessionID:orchestrator
+		pmFees                        map[string]*big.Int    // PM sessionID:face value of tickets sent
+		pmWinTimes                    map[string][]time.Time // PM sessionID:times of unredeemed winning tickets
+		manifests                     map[uint64]string      // nonce:manifestID
+		lastEmergencyRefresh          map[uint64]time.Time
+		codecChanges                  map[uint64]uint64 // nonce:seqNo of the last codec change
+		watchdogCh                    chan struct{}
+		watchdogFired                 int32
+		startTime                     time.Time
+		streams                       map[uint64]*streamCounts
+		orchQueueDepth                int64
+		uploadTimes                   []uploadTime // most recent upload durations
+		discoveryRan                  bool
+		lastDiscoveryResponded        int
 	}
 
 	segmentCount struct {
@@ -90,55 +191,346 @@ type (
 		segments []segmentCount
 		start    int
 		end      int
+		// how long a segment can stay pending before it is counted as
+		// lost; LostSegmentTimeout if zero
+		timeout time.Duration
+	}
+
+	// LossRateAlert describes a callback that is invoked when the share of
+	// lost segments of a stream exceeds Threshold within Window
+	LossRateAlert struct {
+		Threshold float64
+		Window    time.Duration
+		Handler   func(nonce uint64, rate float64)
+	}
+
+	lossRateAlertState struct {
+		alert       LossRateAlert
+		windowStart time.Time
+		counts      map[uint64]*lossCount // nonce
+	}
+
+	lossCount struct {
+		total int
+		lost  int
 	}
 )
 
+// How long timeoutWatcher sleeps between checks for lost segments
+var timeoutWatcherPause = 30 * time.Second
+
+// SuccessRateWindow is the number of most recent segments of a stream that
+// its success rate is averaged over. Must be set before Init.
+var SuccessRateWindow = 30
+
+// LostSegmentTimeout is how long a source segment can go without being
+// transcoded before it is counted as lost. Streams with long segments need a
+// longer timeout, set with SetLostSegmentTimeout. Must be set before Init.
+var LostSegmentTimeout = 8500 * time.Millisecond
+
+// How long to wait for a LossRateAlert handler before giving up on it
+var lossRateAlertTimeout = 5 * time.Second
+
+// GoroutineCountThreshold is the number of goroutines above which the
+// registered LossRateAlert handlers are invoked with GoroutineLeakNonce
+var GoroutineCountThreshold = 10000
+
+// GoroutineLeakNonce is passed to LossRateAlert handlers to signal that the
+// goroutine count exceeded GoroutineCountThreshold. The rate argument then
+// holds the goroutine count.
+const GoroutineLeakNonce uint64 = math.MaxUint64
+
+// How often timeoutWatcher records the goroutine count
+const goroutineCheckInterval = 30 * time.Second
+
 // Exporter Prometheus exporter that handles `/metrics` endpoint
 var Exporter *prometheus.Exporter
 
-var census censusMetricsCounter
+// Prometheus registry the Exporter collects into
+var registry *rprom.Registry
 
-func initCensus(nodeType, nodeID, version string) {
-	census = censusMetricsCounter{
+var census = &censusMetricsCounter{}
+
+// Census records the metrics and events of a node. The package-level
+// functions of the same names record on the default census, which is created
+// by Init. Use NewCensus to record for additional nodes in the same process,
+// or a fake implementation to test callers.
+type Census interface {
+	// Streams and segments (broadcaster)
+	LogStreamCreatedEvent(hlsStrmID string, nonce uint64)
+	LogStreamStartedEvent(nonce uint64)
+	LogStreamEndedEvent(nonce uint64)
+	LogRecordingFinalized(nonce uint64, manifestID, url, mp4URL string, duration float64, errMsg string)
+	LogStreamCreateFailed(nonce uint64, reason string)
+	LogStreamRejected(nonce uint64, reason string)
+	LogSegmentTranscodedLocally(nonce, seqNo uint64)
+	LogStreamLabels(nonce uint64, labels map[string]string)
+	LogSegmentEmerged(nonce, seqNo uint64, profilesNum int)
+	LogSegmentEmergedWithSize(nonce, seqNo uint64, profilesNum int, byteSize int64)
+	LogSegmentOversized(nonce, seqNo uint64, size int64)
+	LogDuplicateSegment(nonce, seqNo uint64)
+	LogSegmentTrace(nonce, seqNo uint64, sc trace.SpanContext)
+	LogOutOfOrderSegment(nonce, seqNo uint64)
+	LogSegmentDurationDrift(nonce, seqNo uint64, drift time.Duration)
+	SetLostSegmentTimeout(nonce uint64, timeout time.Duration)
+	LogCodecChange(nonce, seqNo uint64, prev, cur string)
+	LogSourceSegmentAppeared(nonce, seqNo uint64, manifestID, profile string)
+	SegmentUploadStart(nonce, seqNo uint64)
+	LogSegmentUploaded(nonce, seqNo uint64, uploadDur time.Duration)
+	LogSegmentUploadFailed(nonce, seqNo uint64, code SegmentUploadError, reason string)
+	LogSegmentTranscoded(nonce, seqNo uint64, transcodeDur, totalDur time.Duration, profiles string)
+	LogSegmentTranscodeFailed(subType SegmentTranscodeError, nonce, seqNo uint64, err error)
+	LogTranscodedSegmentAppeared(nonce, seqNo uint64, profile string)
+	SegmentFullyTranscoded(nonce, seqNo uint64, succeededProfiles, failedProfiles []string, errCode SegmentTranscodeError)
+	LogPlaylistInsert(nonce uint64, profile string)
+	LogPlaylistInsertFailed(nonce, seqNo uint64, profile, reason string)
+	LogTranscodeQualityScore(nonce, seqNo uint64, profile string, vmafScore float64)
+	LogTranscodeCache(hit bool)
+	UploadConcurrency(inUse int)
+	LogSegmentRetries(nonce, seqNo uint64, retries int)
+	TranscodeRetryBacklog(segments int)
+	LogSegmentRetriesExhausted(nonce, seqNo uint64, attempts int, err error)
+
+	// Sessions and orchestrators (broadcaster)
+	MaxSessions(maxSessions int)
+	CurrentSessions(currentSessions int)
+	LogDiscoveryError(code string)
+	LogDiscoveryLatency(latency time.Duration)
+	LogDiscoveryResponses(requested, responded int)
+	OrchestratorPoolSize(size int)
+	LogDiscoveryCache(hit bool, age time.Duration)
+	LogSessionRefresh(dur time.Duration, err error)
+	LogOrchestratorSwapped(nonce uint64, prev, cur string)
+	LogStreamSession(nonce uint64, orchestrator, pmSessionID string)
+	LogOrchestratorUploaded(orch string, took time.Duration)
+	LogOrchestratorTranscoded(orch string, roundTrip time.Duration)
+	LogOrchestratorFailed(orch, code string)
+	LogOrchestratorSuspended(orch string, cooldown time.Duration)
+	LogOrchestratorOverPriced(orch string)
+	LogOrchestratorPing(orch string, rtt time.Duration)
+	LogSpotCheckFailed(orch string)
+	LogSegmentVerified(orch, profile string)
+	LogSegmentVerificationFailed(nonce, seqNo uint64, orch, profile, code, reason string)
+
+	// Orchestrator and transcoder
+	LogSegmentTranscodeStarting(seqNo uint64, manifestID string)
+	LogSegmentTranscodeEnded(seqNo uint64, manifestID string, d time.Duration, profiles string)
+	LogOrchSegmentReceived()
+	LogOrchSegmentRejected(code SegmentTranscodeError)
+	LogOrchTranscodeQueued()
+	LogOrchTranscodeDequeued()
+	LogOrchPaymentError()
+	LogGPUStats(gpus []GPUStats)
+
+	// Payments
+	LogPMSessionStarted(sessionID, orchestrator string)
+	LogTicketSent(sessionID, recipient string, faceValue *big.Int)
+	LogTicketReceived(sender string, faceValue *big.Int)
+	LogWinningTicket(sessionID, sender string, faceValue *big.Int)
+	LogWinningTicketsRedeemed(sessionIDs []string, err error)
+	LogWinningTicketSent(recipient string, faceValue *big.Int)
+
+	// Object storage
+	LogOSOperation(driver, op string, bytes int, took time.Duration, err error)
+
+	// Bandwidth
+	LogBytesTransferred(direction string, nonce uint64, bytes int64)
+
+	// State
+	GetSuccessRateSnapshot() map[uint64]float64
+	GetStreamStats() []StreamStats
+	WatchdogTimeout() bool
+	DebugDumpState(w io.Writer) error
+}
+
+var _ Census = (*censusMetricsCounter)(nil)
+
+// DefaultCensus returns the census the package-level functions record on.
+// Init replaces the default census, so callers should not retain it.
+func DefaultCensus() Census {
+	return census
+}
+
+// NewCensus creates a census recording the metrics of another node in this
+// process, tagged with its node type and ID. Metrics are exported through the
+// views registered by Init, which must be called first. Loss rate alerts and
+// the low success rate handler are process-wide.
+func NewCensus(nodeType, nodeID string) Census {
+	cen := newCensusMetricsCounter(nodeType, nodeID)
+	cen.start()
+	return cen
+}
+
+// ErrNonceCollision is returned when a stream is created with the nonce of
+// a stream that is still active
+var ErrNonceCollision = errors.New("NonceCollision")
+
+var initCensusOnce sync.Once
+
+// PerStreamMetrics tags segment metrics with the stream manifest ID, and
+// records the success rate of each stream, when set. Must be set before
+// Init. Manifest IDs change on reconnect, so this may lead to high metrics
+// cardinality.
+var PerStreamMetrics bool
+
+// HistogramBuckets overrides the bucket boundaries of distribution views,
+// keyed by view name. Must be set before Init.
+var HistogramBuckets map[string][]float64
+
+// LowSuccessRateRefreshThreshold is the per-stream success rate below which
+// the low success rate handler is invoked
+var LowSuccessRateRefreshThreshold = 0.5
+
+// Minimum time between two low success rate refreshes of a stream
+const emergencyRefreshInterval = 30 * time.Second
+
+// Invoked when a stream success rate drops below the threshold;
+// protected by census.lock
+var lowSuccessRateHandler func(nonce uint64, rate float64)
+
+// Registered loss rate alerts and their counts. They are shared by every
+// censusMetricsCounter, so they have a lock of their own; when both are held,
+// lossRateAlertsLock is taken after cen.lock.
+var (
+	lossRateAlertsLock sync.Mutex
+	lossRateAlerts     []*lossRateAlertState
+)
+
+// newCensusMetricsCounter creates the measures and state for recording the
+// metrics of one node. Views are registered separately, once per process.
+func newCensusMetricsCounter(nodeType, nodeID string) *censusMetricsCounter {
+	cen := &censusMetricsCounter{
 		emergeTimes: make(map[uint64]map[uint64]time.Time),
 		nodeID:      nodeID,
 		nodeType:    nodeType,
 		success:     make(map[uint64]*segmentsAverager),
+		pmSessions:  make(map[string]string),
+		manifests:   make(map[uint64]string),
+
+		lastEmergencyRefresh: make(map[uint64]time.Time),
+		watchdogCh:           make(chan struct{}, 1),
+		codecChanges:         make(map[uint64]uint64),
+		startTime:            time.Now(),
+		streams:              make(map[uint64]*streamCounts),
 	}
 	var err error
-	census.kNodeType, _ = tag.NewKey("node_type")
-	census.kNodeID, _ = tag.NewKey("node_id")
-	census.kProfile, _ = tag.NewKey("profile")
-	census.kProfiles, _ = tag.NewKey("profiles")
-	census.kErrorCode, _ = tag.NewKey("error_code")
-	census.ctx, err = tag.New(context.Background(), tag.Insert(census.kNodeType, nodeType), tag.Insert(census.kNodeID, nodeID))
+	cen.kNodeType, _ = tag.NewKey("node_type")
+	cen.kNodeID, _ = tag.NewKey("node_id")
+	cen.kProfile, _ = tag.NewKey("profile")
+	cen.kProfiles, _ = tag.NewKey("profiles")
+	cen.kErrorCode, _ = tag.NewKey("error_code")
+	cen.kOrchestrator, _ = tag.NewKey("orchestrator")
+	cen.kManifestID, _ = tag.NewKey("manifest_id")
+	cen.kSender, _ = tag.NewKey("sender")
+	cen.kRecipient, _ = tag.NewKey("recipient")
+	cen.kGPU, _ = tag.NewKey("gpu")
+	cen.kDriver, _ = tag.NewKey("driver")
+	cen.kOSOperation, _ = tag.NewKey("operation")
+	cen.kDirection, _ = tag.NewKey("direction")
+	for _, l := range StreamLabels {
+		k, _ := tag.NewKey(l)
+		cen.kStreamLabels = append(cen.kStreamLabels, k)
+	}
+	cen.ctx, err = tag.New(context.Background(), tag.Insert(cen.kNodeType, nodeType), tag.Insert(cen.kNodeID, nodeID))
 	if err != nil {
 		glog.Fatal("Error creating context", err)
 	}
-	census.mSegmentSourceAppeared = stats.Int64("segment_source_appeared_total", "SegmentSourceAppeared", "tot")
-	census.mSegmentEmerged = stats.Int64("segment_source_emerged_total", "SegmentEmerged", "tot")
-	census.mSegmentEmergedWithProfiles = stats.Int64("segment_source_emerged_with_profiles_total", "SegmentEmerged, counted by number of transcode profiles", "tot")
-	census.mSegmentUploaded = stats.Int64("segment_source_uploaded_total", "SegmentUploaded", "tot")
-	census.mSegmentUploadFailed = stats.Int64("segment_source_upload_failed_total", "SegmentUploadedFailed", "tot")
-	census.mSegmentTranscoded = stats.Int64("segment_transcoded_total", "SegmentTranscoded", "tot")
-	census.mSegmentTranscodeFailed = stats.Int64("segment_transcode_failed_total", "SegmentTranscodeFailed", "tot")
-	census.mSegmentTranscodedAppeared = stats.Int64("segment_transcoded_appeared_total", "SegmentTranscodedAppeared", "tot")
-	census.mSegmentTranscodedAllAppeared = stats.Int64("segment_transcoded_all_appeared_total", "SegmentTranscodedAllAppeared", "tot")
-	census.mStartBroadcastClientFailed = stats.Int64("broadcast_client_start_failed_total", "StartBroadcastClientFailed", "tot")
-	census.mStreamCreateFailed = stats.Int64("stream_create_failed_total", "StreamCreateFailed", "tot")
-	census.mStreamCreated = stats.Int64("stream_created_total", "StreamCreated", "tot")
-	census.mStreamStarted = stats.Int64("stream_started_total", "StreamStarted", "tot")
-	census.mStreamEnded = stats.Int64("stream_ended_total", "StreamEnded", "tot")
-	census.mMaxSessions = stats.Int64("max_sessions_total", "MaxSessions", "tot")
-	census.mCurrentSessions = stats.Int64("current_sessions_total", "Number of currently transcded streams", "tot")
-	census.mDiscoveryError = stats.Int64("discovery_errors_total", "Number of discover errors", "tot")
-	census.mSuccessRate = stats.Float64("success_rate", "Success rate", "per")
-	census.mTranscodeTime = stats.Float64("transcode_time_seconds", "Transcoding time", "sec")
-	census.mTranscodeLatency = stats.Float64("transcode_latency_seconds",
+	cen.mSegmentSourceAppeared = stats.Int64("segment_source_appeared_total", "SegmentSourceAppeared", "tot")
+	cen.mSegmentEmerged = stats.Int64("segment_source_emerged_total", "SegmentEmerged", "tot")
+	cen.mSegmentEmergedWithProfiles = stats.Int64("segment_source_emerged_with_profiles_total", "SegmentEmerged, counted by number of transcode profiles", "tot")
+	cen.mSegmentEmergedBytes = stats.Int64("segment_source_emerged_bytes", "Size of emerged source segments", "By")
+	cen.mSegmentUploaded = stats.Int64("segment_source_uploaded_total", "SegmentUploaded", "tot")
+	cen.mSegmentUploadFailed = stats.Int64("segment_source_upload_failed_total", "SegmentUploadedFailed", "tot")
+	cen.mSegmentTranscoded = stats.Int64("segment_transcoded_total", "SegmentTranscoded", "tot")
+	cen.mSegmentTranscodeFailed = stats.Int64("segment_transcode_failed_total", "SegmentTranscodeFailed", "tot")
+	cen.mSegmentTranscodedAppeared = stats.Int64("segment_transcoded_appeared_total", "SegmentTranscodedAppeared", "tot")
+	cen.mSegmentTranscodedAllAppeared = stats.Int64("segment_transcoded_all_appeared_total", "SegmentTranscodedAllAppeared", "tot")
+	cen.mStartBroadcastClientFailed = stats.Int64("broadcast_client_start_failed_total", "StartBroadcastClientFailed", "tot")
+	cen.mStreamCreateFailed = stats.Int64("stream_create_failed_total", "StreamCreateFailed", "tot")
+	cen.mStreamRejected = stats.Int64("stream_rejected_total", "Number of RTMP streams rejected by ingest limits or authentication", "tot")
+	cen.mSegmentTranscodedLocally = stats.Int64("segment_transcoded_locally_total", "Number of segments transcoded by the broadcaster itself for lack of an orchestrator", "tot")
+	cen.mStreamCreated = stats.Int64("stream_created_total", "StreamCreated", "tot")
+	cen.mStreamStarted = stats.Int64("stream_started_total", "StreamStarted", "tot")
+	cen.mStreamEnded = stats.Int64("stream_ended_total", "StreamEnded", "tot")
+	cen.mMaxSessions = stats.Int64("max_sessions_total", "MaxSessions", "tot")
+	cen.mCurrentSessions = stats.Int64("current_sessions_total", "Number of currently transcded streams", "tot")
+	cen.mDiscoveryError = stats.Int64("discovery_errors_total", "Number of discover errors", "tot")
+	cen.mSuccessRate = stats.Float64("success_rate", "Success rate", "per")
+	cen.mStreamSuccessRate = stats.Float64("stream_success_rate", "Success rate of a single stream", "per")
+	cen.mTranscodeTime = stats.Float64("transcode_time_seconds", "Transcoding time", "sec")
+	cen.mTranscodeLatency = stats.Float64("transcode_latency_seconds",
 		"Transcoding latency, from source segment emered from segmenter till transcoded segment apeeared in manifest", "sec")
-	census.mTranscodeOverallLatency = stats.Float64("transcode_overall_latency_seconds",
+	cen.mTranscodeOverallLatency = stats.Float64("transcode_overall_latency_seconds",
 		"Transcoding latency, from source segment emered from segmenter till all transcoded segment apeeared in manifest", "sec")
-	census.mUploadTime = stats.Float64("upload_time_seconds", "Upload (to Orchestrator) time", "sec")
+	cen.mSegmentPipelineE2ELatency = stats.Float64("segment_pipeline_e2e_latency_seconds",
+		"Time from source segment emerged from segmenter till transcoded segment inserted into playlist", "sec")
+	cen.mTranscodeQualityScore = stats.Float64("transcode_quality_score", "VMAF score of transcoded segments", "vmaf")
+	cen.mTranscodeQualityScoreLatest = stats.Float64("transcode_quality_score_latest", "Latest VMAF score of transcoded segments", "vmaf")
+	cen.mUploadTime = stats.Float64("upload_time_seconds", "Upload (to Orchestrator) time", "sec")
+	cen.mOrchestratorUploadTime = stats.Float64("orchestrator_upload_time_seconds", "Upload time, by orchestrator", "sec")
+	cen.mOrchestratorRoundTripTime = stats.Float64("orchestrator_round_trip_time_seconds", "Time from starting the upload till receiving the transcode result, by orchestrator", "sec")
+	cen.mOSOperationTime = stats.Float64("os_operation_time_seconds", "Time taken by object storage operations", "sec")
+	cen.mOSOperationBytes = stats.Int64("os_operation_bytes", "Bytes transferred by object storage operations", "By")
+	cen.mBytesTransferred = stats.Int64("bytes_transferred", "Bytes of video transferred", "By")
+	cen.mOSOperationFailed = stats.Int64("os_operation_failed_total", "Number of failed object storage operations", "tot")
+	cen.mOrchestratorFailed = stats.Int64("orchestrator_segment_failed_total", "Number of segments that failed to upload or transcode, by orchestrator", "tot")
+	cen.mOrchestratorSuspended = stats.Int64("orchestrator_suspensions_total", "Number of times an orchestrator was suspended after failing, by orchestrator", "tot")
+	cen.mOrchestratorOverPriced = stats.Int64("orchestrator_price_rejected_total", "Number of times an orchestrator was not selected for asking more than the maximum price, by orchestrator", "tot")
+	cen.mOrchestratorPing = stats.Float64("orchestrator_ping_seconds", "Round trip time of pings to orchestrators returned by discovery, by orchestrator", "sec")
+	cen.mOrchestratorSpotCheckFailed = stats.Int64("orchestrator_spot_check_failed_total", "Number of renditions diverging from the spot check reference, by orchestrator", "tot")
+	cen.mSegmentVerified = stats.Int64("segment_verified_total", "Number of transcoded segments that passed verification, by orchestrator", "tot")
+	cen.mSegmentVerificationFailed = stats.Int64("segment_verification_failed_total", "Number of transcoded segments that failed verification, by orchestrator", "tot")
+	cen.mSessionRefreshDuration = stats.Float64("session_refresh_duration_seconds", "Time spent refreshing orchestrator sessions", "sec")
+	cen.mSessionRefreshError = stats.Int64("session_refresh_errors_total", "Number of failed orchestrator session refreshes", "tot")
+	cen.mEventsDropped = stats.Int64("segment_events_dropped_total", "Number of segment events dropped by event sinks", "tot")
+	cen.mUploadConcurrency = stats.Int64("upload_concurrency_total", "Number of uploads to object storage in progress", "tot")
+	cen.mTranscodeRetries = stats.Int64("transcode_retries", "Number of times a segment was resubmitted for transcoding", "tot")
+	cen.mTranscodeRetryBacklog = stats.Int64("transcode_retry_backlog", "Number of segments being resubmitted for transcoding", "tot")
+	cen.mTranscodeRetriesExhausted = stats.Int64("transcode_retries_exhausted", "Number of segments that failed after using up their retries", "tot")
+	cen.mTranscodeCacheHit = stats.Int64("transcode_cache_hits_total", "Number of segments served from the transcode result cache", "tot")
+	cen.mTranscodeCacheMiss = stats.Int64("transcode_cache_misses_total", "Number of segments not found in the transcode result cache", "tot")
+	cen.mTicketFaceValueSent = stats.Float64("ticket_face_value_sent", "Face value of tickets sent to orchestrators", "wei")
+	cen.mWinningTickets = stats.Int64("winning_tickets_total", "Number of winning tickets", "tot")
+	cen.mTicketFaceValueReceived = stats.Float64("ticket_face_value_received", "Face value of tickets received from broadcasters", "wei")
+	cen.mTicketRedemptionError = stats.Int64("ticket_redemption_errors_total", "Number of failures to redeem winning tickets", "tot")
+	cen.mWinningTicketFaceValue = stats.Float64("winning_ticket_face_value_received", "Face value of winning tickets received from broadcasters", "wei")
+	cen.mWinningTicketsSent = stats.Int64("winning_tickets_sent_total", "Number of winning tickets sent and redeemed by orchestrators", "tot")
+	cen.mWinningTicketFaceValueSent = stats.Float64("winning_ticket_face_value_sent", "Face value of winning tickets sent and redeemed by orchestrators", "wei")
+	cen.mTicketRedemptionLatency = stats.Float64("ticket_redemption_latency_seconds", "Time from receiving a winning ticket till submitting its redemption", "sec")
+	cen.mEmergencyRefresh = stats.Int64("emergency_session_refresh_total", "Number of session refreshes triggered by a low success rate", "tot")
+	cen.mWatchdogTimeout = stats.Int64("timeout_watcher_stalled_total", "Number of times the lost segment watcher stopped responding", "tot")
+	cen.mCodecChange = stats.Int64("segment_source_codec_change_total", "Number of codec changes detected mid-stream", "tot")
+	cen.mDiscoveryLatency = stats.Float64("discovery_latency_seconds", "Time taken to get orchestrators from discovery", "sec")
+	cen.mDiscoveryRequested = stats.Int64("discovery_orchestrators_requested", "Number of orchestrators requested from discovery", "tot")
+	cen.mDiscoveryResponded = stats.Int64("discovery_orchestrators_responded", "Number of orchestrators that responded to discovery", "tot")
+	cen.mOrchestratorPoolSize = stats.Int64("orchestrator_pool_size", "Number of orchestrators known to discovery", "tot")
+	cen.mDiscoveryCacheHit = stats.Int64("discovery_cache_hits_total", "Number of discovery calls served from the orchestrator cache", "tot")
+	cen.mDiscoveryCacheMiss = stats.Int64("discovery_cache_misses_total", "Number of discovery calls that waited for orchestrators to respond", "tot")
+	cen.mDiscoveryCacheAge = stats.Float64("discovery_cache_age_seconds", "Age of the cached orchestrators served by discovery", "sec")
+	cen.mDuplicateSegment = stats.Int64("segment_source_duplicate_total", "Number of source segments received more than once", "tot")
+	cen.mOutOfOrderSegment = stats.Int64("segment_source_out_of_order_total", "Number of source segments received after a later segment", "tot")
+	cen.mSegmentDurationDrift = stats.Float64("segment_source_duration_drift_seconds", "Difference between source segment duration and the configured segment length", "sec")
+	cen.mOrchSegmentReceived = stats.Int64("orch_segment_received_total", "Number of segments received by the orchestrator", "tot")
+	cen.mOrchSegmentRejected = stats.Int64("orch_segment_rejected_total", "Number of segments rejected by the orchestrator", "tot")
+	cen.mOrchTranscodeQueueDepth = stats.Int64("orch_transcode_queue_depth", "Number of segments waiting for or being transcoded", "tot")
+	cen.mOrchPaymentError = stats.Int64("orch_payment_errors_total", "Number of payments the orchestrator failed to process", "tot")
+	cen.mSegmentOversized = stats.Int64("segment_source_oversized_total", "Number of source segments dropped for exceeding the maximum size", "tot")
+	cen.mPlaylistInsertTotal = stats.Int64("playlist_insert_total", "Number of segments inserted into playlists", "tot")
+	cen.mPlaylistInsertFailed = stats.Int64("playlist_insert_failed_total", "Number of segments that failed to be inserted into playlists", "tot")
+	cen.mGoroutineCount = stats.Int64("goroutine_count", "Number of running goroutines", "tot")
+	cen.mGPUUtilization = stats.Int64("gpu_utilization_percent", "GPU utilization", "percent")
+	cen.mGPUEncoderUtilization = stats.Int64("gpu_encoder_utilization_percent", "GPU video encoder utilization", "percent")
+	cen.mGPUDecoderUtilization = stats.Int64("gpu_decoder_utilization_percent", "GPU video decoder utilization", "percent")
+	cen.mGPUEncoderSessions = stats.Int64("gpu_encoder_sessions", "Number of active GPU encoder sessions", "tot")
+	cen.mGPUMemoryUsed = stats.Int64("gpu_memory_used_bytes", "GPU memory in use", "By")
+	cen.mGPUMemoryTotal = stats.Int64("gpu_memory_total_bytes", "Total GPU memory", "By")
+	cen.mProfileTranscodeFailed = stats.Int64("profile_transcode_failed_total", "Number of transcoded renditions that failed to appear", "tot")
+	cen.mNonceCollision = stats.Int64("stream_nonce_collision_total", "Number of stream nonce collisions detected", "tot")
+	return cen
+}
+
+func initCensus(nodeType, nodeID, version string) {
+	census = newCensusMetricsCounter(nodeType, nodeID)
 
 	glog.Infof("Compiler: %s Arch %s OS %s Go version %s", runtime.Compiler, runtime.GOARCH, runtime.GOOS, runtime.Version())
 	glog.Infof("Livepeer version: %s", version)
@@ -156,6 +548,13 @@ func initCensus(nodeType, nodeID, version string) {
 		glog.Fatal("Error creating tagged context", err)
 	}
 	baseTags := []tag.Key{census.kNodeID, census.kNodeType}
+	segTags := baseTags
+	if PerStreamMetrics {
+		segTags = []tag.Key{census.kManifestID, census.kNodeID, census.kNodeType}
+	}
+	if len(census.kStreamLabels) > 0 {
+		segTags = append(append([]tag.Key{}, segTags...), census.kStreamLabels...)
+	}
 	views := []*view.View{
 		&view.View{
 			Name:        "versions",
@@ -199,67 +598,88 @@ func initCensus(nodeType, nodeID, version string) {
 			TagKeys:     baseTags,
 			Aggregation: view.Count(),
 		},
+		&view.View{
+			Name:        "stream_rejected_total",
+			Measure:     census.mStreamRejected,
+			Description: "Number of RTMP streams rejected by ingest limits or authentication",
+			TagKeys:     append([]tag.Key{census.kErrorCode}, segTags...),
+			Aggregation: view.Count(),
+		},
+		&view.View{
+			Name:        "segment_transcoded_locally_total",
+			Measure:     census.mSegmentTranscodedLocally,
+			Description: "Number of segments transcoded by the broadcaster itself for lack of an orchestrator",
+			TagKeys:     segTags,
+			Aggregation: view.Count(),
+		},
 		&view.View{
 			Name:        "segment_source_appeared_total",
 			Measure:     census.mSegmentSourceAppeared,
 			Description: "SegmentSourceAppeared",
-			TagKeys:     append([]tag.Key{census.kProfile}, baseTags...),
+			TagKeys:     append([]tag.Key{census.kProfile}, segTags...),
 			Aggregation: view.Count(),
 		},
 		&view.View{
 			Name:        "segment_source_emerged_total",
 			Measure:     census.mSegmentEmerged,
 			Description: "SegmentEmerged",
-			TagKeys:     baseTags,
+			TagKeys:     segTags,
 			Aggregation: view.Count(),
 		},
 		&view.View{
 			Name:        "segment_source_emerged_with_profiles_total",
 			Measure:     census.mSegmentEmergedWithProfiles,
 			Description: "SegmentEmerged, counted by number of transcode profiles",
-			TagKeys:     baseTags,
-			Aggregation: view.Count(),
+			TagKeys:     segTags,
+			Aggregation: view.Sum(),
+		},
+		&view.View{
+			Name:        "segment_source_emerged_bytes",
+			Measure:     census.mSegmentEmergedBytes,
+			Description: "Total size of emerged source segments, bytes",
+			TagKeys:     segTags,
+			Aggregation: view.Sum(),
 		},
 		&view.View{
 			Name:        "segment_source_uploaded_total",
 			Measure:     census.mSegmentUploaded,
 			Description: "SegmentUploaded",
-			TagKeys:     baseTags,
+			TagKeys:     segTags,
 			Aggregation: view.Count(),
 		},
 		&view.View{
 			Name:        "segment_source_upload_failed_total",
 			Measure:     census.mSegmentUploadFailed,
 			Description: "SegmentUploadedFailed",
-			TagKeys:     append([]tag.Key{census.kErrorCode}, baseTags...),
+			TagKeys:     append([]tag.Key{census.kErrorCode}, segTags...),
 			Aggregation: view.Count(),
 		},
 		&view.View{
 			Name:        "segment_transcoded_total",
 			Measure:     census.mSegmentTranscoded,
 			Description: "SegmentTranscoded",
-			TagKeys:     append([]tag.Key{census.kProfiles}, baseTags...),
+			TagKeys:     append([]tag.Key{census.kProfiles}, segTags...),
 			Aggregation: view.Count(),
 		},
 		&view.View{
 			Name:        "segment_transcode_failed_total",
 			Measure:     census.mSegmentTranscodeFailed,
 			Description: "SegmentTranscodeFailed",
-			TagKeys:     append([]tag.Key{census.kErrorCode}, baseTags...),
+			TagKeys:     append([]tag.Key{census.kErrorCode}, segTags...),
 			Aggregation: view.Count(),
 		},
 		&view.View{
 			Name:        "segment_transcoded_appeared_total",
 			Measure:     census.mSegmentTranscodedAppeared,
 			Description: "SegmentTranscodedAppeared",
-			TagKeys:     append([]tag.Key{census.kProfile}, baseTags...),
+			TagKeys:     append([]tag.Key{census.kProfile}, segTags...),
 			Aggregation: view.Count(),
 		},
 		&view.View{
 			Name:        "segment_transcoded_all_appeared_total",
 			Measure:     census.mSegmentTranscodedAllAppeared,
 			Description: "SegmentTranscodedAllAppeared",
-			TagKeys:     append([]tag.Key{census.kProfiles}, baseTags...),
+			TagKeys:     append([]tag.Key{census.kProfiles}, segTags...),
 			Aggregation: view.Count(),
 		},
 		&view.View{
@@ -273,29 +693,120 @@ func initCensus(nodeType, nodeID, version string) {
 			Name:        "transcode_time_seconds",
 			Measure:     census.mTranscodeTime,
 			Description: "TranscodeTime, seconds",
-			TagKeys:     append([]tag.Key{census.kProfiles}, baseTags...),
+			TagKeys:     append([]tag.Key{census.kProfiles}, segTags...),
 			Aggregation: view.Distribution(0, .250, .500, .750, 1.000, 1.250, 1.500, 2.000, 2.500, 3.000, 3.500, 4.000, 4.500, 5.000, 10.000),
 		},
 		&view.View{
 			Name:        "transcode_latency_seconds",
 			Measure:     census.mTranscodeLatency,
 			Description: "Transcoding latency, from source segment emered from segmenter till transcoded segment apeeared in manifest",
-			TagKeys:     append([]tag.Key{census.kProfile}, baseTags...),
+			TagKeys:     append([]tag.Key{census.kProfile}, segTags...),
 			Aggregation: view.Distribution(0, .500, .75, 1.000, 1.500, 2.000, 2.500, 3.000, 3.500, 4.000, 4.500, 5.000, 10.000),
 		},
 		&view.View{
 			Name:        "transcode_overall_latency_seconds",
 			Measure:     census.mTranscodeOverallLatency,
 			Description: "Transcoding latency, from source segment emered from segmenter till all transcoded segment apeeared in manifest",
-			TagKeys:     append([]tag.Key{census.kProfiles}, baseTags...),
+			TagKeys:     append([]tag.Key{census.kProfiles}, segTags...),
 			Aggregation: view.Distribution(0, .500, .75, 1.000, 1.500, 2.000, 2.500, 3.000, 3.500, 4.000, 4.500, 5.000, 10.000),
 		},
 		&view.View{
 			Name:        "upload_time_seconds",
 			Measure:     census.mUploadTime,
 			Description: "UploadTime, seconds",
-			TagKeys:     baseTags,
-			Aggregation: view.Distribution(0, .10, .20, .50, .100, .150, .200, .500, .1000, .5000, 10.000),
+			TagKeys:     segTags,
+			Aggregation: view.Distribution(0, .100, .200, .500, 1.000, 1.500, 2.000, 5.000, 10.000),
+		},
+		&view.View{
+			Name:        "os_operation_time_seconds",
+			Measure:     census.mOSOperationTime,
+			Description: "Object storage operation time, seconds",
+			TagKeys:     append([]tag.Key{census.kDriver, census.kOSOperation}, baseTags...),
+			Aggregation: view.Distribution(0, .010, .050, .100, .200, .500, 1.000, 2.000, 5.000, 10.000),
+		},
+		&view.View{
+			Name:        "os_operation_bytes",
+			Measure:     census.mOSOperationBytes,
+			Description: "Bytes transferred by successful object storage operations",
+			TagKeys:     append([]tag.Key{census.kDriver, census.kOSOperation}, baseTags...),
+			Aggregation: view.Sum(),
+		},
+		&view.View{
+			Name:        "os_operation_failed_total",
+			Measure:     census.mOSOperationFailed,
+			Description: "Number of failed object storage operations",
+			TagKeys:     append([]tag.Key{census.kDriver, census.kOSOperation, census.kErrorCode}, baseTags...),
+			Aggregation: view.Count(),
+		},
+		&view.View{
+			Name:        "bytes_transferred_total",
+			Measure:     census.mBytesTransferred,
+			Description: "Bytes of video received from or sent to the network, by direction",
+			TagKeys:     append([]tag.Key{census.kDirection}, segTags...),
+			Aggregation: view.Sum(),
+		},
+		&view.View{
+			Name:        "orchestrator_upload_time_seconds",
+			Measure:     census.mOrchestratorUploadTime,
+			Description: "Upload time by orchestrator, seconds",
+			TagKeys:     append([]tag.Key{census.kOrchestrator}, baseTags...),
+			Aggregation: view.Distribution(0, .100, .200, .500, 1.000, 1.500, 2.000, 5.000, 10.000),
+		},
+		&view.View{
+			Name:        "orchestrator_round_trip_time_seconds",
+			Measure:     census.mOrchestratorRoundTripTime,
+			Description: "Upload and transcode round trip time by orchestrator, seconds",
+			TagKeys:     append([]tag.Key{census.kOrchestrator}, baseTags...),
+			Aggregation: view.Distribution(0, .500, .75, 1.000, 1.500, 2.000, 2.500, 3.000, 3.500, 4.000, 4.500, 5.000, 10.000),
+		},
+		&view.View{
+			Name:        "orchestrator_segment_failed_total",
+			Measure:     census.mOrchestratorFailed,
+			Description: "Number of segments that failed to upload or transcode, by orchestrator",
+			TagKeys:     append([]tag.Key{census.kOrchestrator, census.kErrorCode}, baseTags...),
+			Aggregation: view.Count(),
+		},
+		&view.View{
+			Name:        "orchestrator_suspensions_total",
+			Measure:     census.mOrchestratorSuspended,
+			Description: "Number of times an orchestrator was suspended after failing, by orchestrator",
+			TagKeys:     append([]tag.Key{census.kOrchestrator}, baseTags...),
+			Aggregation: view.Count(),
+		},
+		&view.View{
+			Name:        "orchestrator_price_rejected_total",
+			Measure:     census.mOrchestratorOverPriced,
+			Description: "Number of times an orchestrator was not selected for asking more than the maximum price, by orchestrator",
+			TagKeys:     append([]tag.Key{census.kOrchestrator}, baseTags...),
+			Aggregation: view.Count(),
+		},
+		&view.View{
+			Name:        "orchestrator_ping_seconds",
+			Measure:     census.mOrchestratorPing,
+			Description: "Round trip time of pings to orchestrators returned by discovery, by orchestrator, seconds",
+			TagKeys:     append([]tag.Key{census.kOrchestrator}, baseTags...),
+			Aggregation: view.Distribution(0, .025, .050, .100, .150, .200, .300, .500, .750, 1.000, 2.000),
+		},
+		&view.View{
+			Name:        "orchestrator_spot_check_failed_total",
+			Measure:     census.mOrchestratorSpotCheckFailed,
+			Description: "Number of renditions diverging from the spot check reference, by orchestrator",
+			TagKeys:     append([]tag.Key{census.kOrchestrator}, baseTags...),
+			Aggregation: view.Count(),
+		},
+		&view.View{
+			Name:        "segment_verified_total",
+			Measure:     census.mSegmentVerified,
+			Description: "Number of transcoded segments that passed verification, by orchestrator",
+			TagKeys:     append([]tag.Key{census.kOrchestrator, census.kProfile}, baseTags...),
+			Aggregation: view.Count(),
+		},
+		&view.View{
+			Name:        "segment_verification_failed_total",
+			Measure:     census.mSegmentVerificationFailed,
+			Description: "Number of transcoded segments that failed verification, by orchestrator",
+			TagKeys:     append([]tag.Key{census.kOrchestrator, census.kProfile, census.kErrorCode}, baseTags...),
+			Aggregation: view.Count(),
 		},
 		&view.View{
 			Name:        "max_sessions_total",
@@ -318,191 +829,1268 @@ func initCensus(nodeType, nodeID, version string) {
 			TagKeys:     append([]tag.Key{census.kErrorCode}, baseTags...),
 			Aggregation: view.Count(),
 		},
-	}
-	// Register the views
-	if err := view.Register(views...); err != nil {
-		glog.Fatalf("Failed to register views: %v", err)
-	}
-	registry := rprom.NewRegistry()
-	registry.MustRegister(rprom.NewProcessCollector(rprom.ProcessCollectorOpts{}))
-	registry.MustRegister(rprom.NewGoCollector())
-	pe, err := prometheus.NewExporter(prometheus.Options{
-		Namespace: "livepeer",
-		Registry:  registry,
-	})
-	if err != nil {
-		glog.Fatalf("Failed to create the Prometheus stats exporter: %v", err)
-	}
-
-	// Register the Prometheus exporters as a stats exporter.
-	view.RegisterExporter(pe)
-	stats.Record(ctx, mVersions.M(1))
-	ctx, err = tag.New(census.ctx, tag.Insert(census.kErrorCode, "LostSegment"))
-	if err != nil {
-		glog.Fatal("Error creating context", err)
-	}
-	go census.timeoutWatcher(ctx)
-	Exporter = pe
-}
-
-// LogDiscoveryError records discovery error
-func LogDiscoveryError(code string) {
-	glog.Error("Discovery error=" + code)
-	if strings.Contains(code, "OrchestratorCapped") {
-		code = "OrchestratorCapped"
-	} else if strings.Contains(code, "Canceled") {
-		code = "Canceled"
-	}
-	ctx, err := tag.New(census.ctx, tag.Insert(census.kErrorCode, code))
-	if err != nil {
-		glog.Error("Error creating context", err)
-		return
-	}
-	stats.Record(ctx, census.mDiscoveryError.M(1))
-}
-
-func (cen *censusMetricsCounter) successRate() float64 {
-	var i int
-	var f float64
-	for _, avg := range cen.success {
-		if r, has := avg.successRate(); has {
-			i++
-			f += r
-		}
-	}
-	return f / float64(i)
-}
-
-func (sa *segmentsAverager) successRate() (float64, bool) {
-	var emerged, transcoded int
-	if sa.end == -1 {
-		return 0, false
-	}
-	i := sa.start
-	now := time.Now()
-	for {
-		item := &sa.segments[i]
-		if item.transcoded > 0 || item.failed || now.Sub(item.emergedTime) > 8500*time.Millisecond {
-			emerged += item.emerged
-			transcoded += item.transcoded
-		}
-		if i == sa.end {
-			break
-		}
-		i = sa.advance(i)
-	}
-	if emerged > 0 {
-		return float64(transcoded) / float64(emerged), true
-	}
-	return 0, false
-}
-
-func (sa *segmentsAverager) advance(i int) int {
-	i++
-	if i == len(sa.segments) {
-		i = 0
-	}
-	return i
-}
-
-func (sa *segmentsAverager) addEmerged(seqNo uint64) {
-	item, _ := sa.getAddItem(seqNo)
-	item.emerged = 1
-	item.transcoded = 0
-	item.emergedTime = time.Now()
-	item.seqNo = seqNo
-}
-
-func (sa *segmentsAverager) addTranscoded(seqNo uint64, failed bool) {
-	item, found := sa.getAddItem(seqNo)
-	if !found {
-		item.emerged = 0
-		item.emergedTime = time.Now()
-	}
-	item.failed = failed
-	if !failed {
-		item.transcoded = 1
-	}
-	item.seqNo = seqNo
-}
-
-func (sa *segmentsAverager) getAddItem(seqNo uint64) (*segmentCount, bool) {
-	var index int
-	if sa.end == -1 {
-		sa.end = 0
-	} else {
-		i := sa.start
-		for {
-			if sa.segments[i].seqNo == seqNo {
-				return &sa.segments[i], true
-			}
-			if i == sa.end {
-				break
-			}
-			i = sa.advance(i)
-		}
-		sa.end = sa.advance(sa.end)
-		index = sa.end
-		if sa.end == sa.start {
-			sa.start = sa.advance(sa.start)
-		}
-	}
-	return &sa.segments[index], false
-}
-
-func (cen *censusMetricsCounter) timeoutWatcher(ctx context.Context) {
-	timeout := 8500 * time.Millisecond
-	for {
-		cen.lock.Lock()
-		now := time.Now()
-		for nonce, emerged := range cen.emergeTimes {
-			for seqNo, tm := range emerged {
-				ago := now.Sub(tm)
-				if ago > timeout {
-					stats.Record(cen.ctx, cen.mSegmentEmerged.M(1))
-					delete(emerged, seqNo)
-					// This shouldn't happen, but if it is, we record
-					// `LostSegment` error, to try to find out why we missed segment
-					stats.Record(ctx, cen.mSegmentTranscodeFailed.M(1))
-					glog.Errorf("LostSegment nonce=%d seqNo=%d emerged=%ss ago", nonce, seqNo, ago)
-				}
-			}
-		}
-		cen.lock.Unlock()
-		time.Sleep(30 * time.Second)
-	}
-}
-
-func MaxSessions(maxSessions int) {
-	census.lock.Lock()
-	defer census.lock.Unlock()
-	stats.Record(census.ctx, census.mMaxSessions.M(int64(maxSessions)))
-}
-
-func CurrentSessions(currentSessions int) {
-	census.lock.Lock()
-	defer census.lock.Unlock()
-	stats.Record(census.ctx, census.mCurrentSessions.M(int64(currentSessions)))
-}
-
-func (cen *censusMetricsCounter) segmentEmerged(nonce, seqNo uint64, profilesNum int) {
-	cen.lock.Lock()
-	defer cen.lock.Unlock()
-	if _, has := cen.emergeTimes[nonce]; !has {
-		cen.emergeTimes[nonce] = make(map[uint64]time.Time)
-	}
-	if avg, has := cen.success[nonce]; has {
-		avg.addEmerged(seqNo)
-	}
-	cen.emergeTimes[nonce][seqNo] = time.Now()
-}
-
-func (cen *censusMetricsCounter) segmentSourceAppeared(nonce, seqNo uint64, profile string) {
-	cen.lock.Lock()
+		&view.View{
+			Name:        "session_refresh_duration_seconds",
+			Measure:     census.mSessionRefreshDuration,
+			Description: "SessionRefreshDuration, seconds",
+			TagKeys:     baseTags,
+			Aggregation: view.Distribution(0, .100, .250, .500, .750, 1.000, 1.500, 2.000, 3.000, 5.000, 10.000, 30.000),
+		},
+		&view.View{
+			Name:        "session_refresh_errors_total",
+			Measure:     census.mSessionRefreshError,
+			Description: "Number of failed orchestrator session refreshes",
+			TagKeys:     baseTags,
+			Aggregation: view.Count(),
+		},
+		&view.View{
+			Name:        "segment_events_dropped_total",
+			Measure:     census.mEventsDropped,
+			Description: "Number of segment events dropped by event sinks",
+			TagKeys:     baseTags,
+			Aggregation: view.Sum(),
+		},
+		&view.View{
+			Name:        "segment_source_duplicate_total",
+			Measure:     census.mDuplicateSegment,
+			Description: "Number of source segments received more than once",
+			TagKeys:     baseTags,
+			Aggregation: view.Count(),
+		},
+		&view.View{
+			Name:        "segment_source_out_of_order_total",
+			Measure:     census.mOutOfOrderSegment,
+			Description: "Number of source segments received after a later segment",
+			TagKeys:     baseTags,
+			Aggregation: view.Count(),
+		},
+		&view.View{
+			Name:        "segment_source_duration_drift_seconds",
+			Measure:     census.mSegmentDurationDrift,
+			Description: "Absolute difference between source segment duration and the configured segment length, in seconds",
+			TagKeys:     baseTags,
+			Aggregation: view.Distribution(0, .100, .250, .500, 1.000, 2.000, 4.000, 8.000),
+		},
+		&view.View{
+			Name:        "discovery_latency_seconds",
+			Measure:     census.mDiscoveryLatency,
+			Description: "DiscoveryLatency, seconds",
+			TagKeys:     []tag.Key{census.kNodeID},
+			Aggregation: view.Distribution(0, .050, .100, .250, .500, .750, 1.000, 1.500, 2.000, 3.000, 5.000, 10.000),
+		},
+		&view.View{
+			Name:        "discovery_orchestrators_requested_total",
+			Measure:     census.mDiscoveryRequested,
+			Description: "Number of orchestrators requested from discovery",
+			TagKeys:     baseTags,
+			Aggregation: view.Sum(),
+		},
+		&view.View{
+			Name:        "discovery_orchestrators_responded_total",
+			Measure:     census.mDiscoveryResponded,
+			Description: "Number of orchestrators that responded to discovery",
+			TagKeys:     baseTags,
+			Aggregation: view.Sum(),
+		},
+		&view.View{
+			Name:        "orchestrator_pool_size",
+			Measure:     census.mOrchestratorPoolSize,
+			Description: "Number of orchestrators known to discovery",
+			TagKeys:     baseTags,
+			Aggregation: view.LastValue(),
+		},
+		&view.View{
+			Name:        "discovery_cache_hits_total",
+			Measure:     census.mDiscoveryCacheHit,
+			Description: "Number of discovery calls served from the orchestrator cache",
+			TagKeys:     baseTags,
+			Aggregation: view.Count(),
+		},
+		&view.View{
+			Name:        "discovery_cache_misses_total",
+			Measure:     census.mDiscoveryCacheMiss,
+			Description: "Number of discovery calls that waited for orchestrators to respond",
+			TagKeys:     baseTags,
+			Aggregation: view.Count(),
+		},
+		&view.View{
+			Name:        "discovery_cache_age_seconds",
+			Measure:     census.mDiscoveryCacheAge,
+			Description: "Age of the cached orchestrators last served by discovery, seconds",
+			TagKeys:     baseTags,
+			Aggregation: view.LastValue(),
+		},
+		&view.View{
+			Name:        "upload_concurrency_total",
+			Measure:     census.mUploadConcurrency,
+			Description: "Number of uploads to object storage in progress",
+			TagKeys:     baseTags,
+			Aggregation: view.LastValue(),
+		},
+		&view.View{
+			Name:        "transcode_retries_per_segment",
+			Measure:     census.mTranscodeRetries,
+			Description: "Number of times each segment was resubmitted for transcoding",
+			TagKeys:     segTags,
+			Aggregation: view.Distribution(0, 1, 2, 3, 5, 10),
+		},
+		&view.View{
+			Name:        "transcode_retries_total",
+			Measure:     census.mTranscodeRetries,
+			Description: "Number of segment resubmissions for transcoding",
+			TagKeys:     segTags,
+			Aggregation: view.Sum(),
+		},
+		&view.View{
+			Name:        "transcode_retry_backlog",
+			Measure:     census.mTranscodeRetryBacklog,
+			Description: "Number of segments being resubmitted for transcoding",
+			TagKeys:     baseTags,
+			Aggregation: view.LastValue(),
+		},
+		&view.View{
+			Name:        "transcode_retries_exhausted_total",
+			Measure:     census.mTranscodeRetriesExhausted,
+			Description: "Number of segments that failed to transcode after using up their retries",
+			TagKeys:     segTags,
+			Aggregation: view.Count(),
+		},
+		&view.View{
+			Name:        "emergency_session_refresh_total",
+			Measure:     census.mEmergencyRefresh,
+			Description: "Number of session refreshes triggered by a low success rate",
+			TagKeys:     baseTags,
+			Aggregation: view.Count(),
+		},
+		&view.View{
+			Name:        "timeout_watcher_stalled_total",
+			Measure:     census.mWatchdogTimeout,
+			Description: "Number of times the lost segment watcher stopped responding",
+			TagKeys:     baseTags,
+			Aggregation: view.Count(),
+		},
+		&view.View{
+			Name:        "segment_source_codec_change_total",
+			Measure:     census.mCodecChange,
+			Description: "Number of codec changes detected mid-stream",
+			TagKeys:     baseTags,
+			Aggregation: view.Count(),
+		},
+		&view.View{
+			Name:        "transcode_cache_hits_total",
+			Measure:     census.mTranscodeCacheHit,
+			Description: "Number of segments served from the transcode result cache",
+			TagKeys:     baseTags,
+			Aggregation: view.Count(),
+		},
+		&view.View{
+			Name:        "transcode_cache_misses_total",
+			Measure:     census.mTranscodeCacheMiss,
+			Description: "Number of segments not found in the transcode result cache",
+			TagKeys:     baseTags,
+			Aggregation: view.Count(),
+		},
+		&view.View{
+			Name:        "ticket_face_value_sent",
+			Measure:     census.mTicketFaceValueSent,
+			Description: "Cumulative face value of tickets sent, wei",
+			TagKeys:     append([]tag.Key{census.kOrchestrator, census.kRecipient}, baseTags...),
+			Aggregation: view.Sum(),
+		},
+		&view.View{
+			Name:        "winning_tickets_total",
+			Measure:     census.mWinningTickets,
+			Description: "Number of winning tickets",
+			TagKeys:     append([]tag.Key{census.kOrchestrator, census.kSender}, baseTags...),
+			Aggregation: view.Count(),
+		},
+		&view.View{
+			Name:        "tickets_sent_total",
+			Measure:     census.mTicketFaceValueSent,
+			Description: "Number of tickets sent",
+			TagKeys:     append([]tag.Key{census.kOrchestrator, census.kRecipient}, baseTags...),
+			Aggregation: view.Count(),
+		},
+		&view.View{
+			Name:        "tickets_received_total",
+			Measure:     census.mTicketFaceValueReceived,
+			Description: "Number of tickets received",
+			TagKeys:     append([]tag.Key{census.kSender}, baseTags...),
+			Aggregation: view.Count(),
+		},
+		&view.View{
+			Name:        "ticket_face_value_received",
+			Measure:     census.mTicketFaceValueReceived,
+			Description: "Cumulative face value of tickets received, wei",
+			TagKeys:     append([]tag.Key{census.kSender}, baseTags...),
+			Aggregation: view.Sum(),
+		},
+		&view.View{
+			Name:        "ticket_redemption_errors_total",
+			Measure:     census.mTicketRedemptionError,
+			Description: "Number of failures to redeem winning tickets",
+			TagKeys:     baseTags,
+			Aggregation: view.Count(),
+		},
+		&view.View{
+			Name:        "winning_ticket_face_value_received",
+			Measure:     census.mWinningTicketFaceValue,
+			Description: "Cumulative face value of winning tickets received, wei",
+			TagKeys:     append([]tag.Key{census.kOrchestrator, census.kSender}, baseTags...),
+			Aggregation: view.Sum(),
+		},
+		&view.View{
+			Name:        "winning_tickets_sent_total",
+			Measure:     census.mWinningTicketsSent,
+			Description: "Number of winning tickets sent, counted when redeemed on-chain",
+			TagKeys:     append([]tag.Key{census.kRecipient}, baseTags...),
+			Aggregation: view.Count(),
+		},
+		&view.View{
+			Name:        "winning_ticket_face_value_sent",
+			Measure:     census.mWinningTicketFaceValueSent,
+			Description: "Cumulative face value of winning tickets sent, counted when redeemed on-chain, wei",
+			TagKeys:     append([]tag.Key{census.kRecipient}, baseTags...),
+			Aggregation: view.Sum(),
+		},
+		&view.View{
+			Name:        "ticket_redemption_latency_seconds",
+			Measure:     census.mTicketRedemptionLatency,
+			Description: "Time from receiving a winning ticket till submitting its redemption, seconds",
+			TagKeys:     baseTags,
+			Aggregation: view.Distribution(0, 1, 5, 10, 30, 60, 120, 300, 600, 1800, 3600),
+		},
+		&view.View{
+			Name:        "stream_nonce_collision_total",
+			Measure:     census.mNonceCollision,
+			Description: "Number of stream nonce collisions detected",
+			TagKeys:     baseTags,
+			Aggregation: view.Count(),
+		},
+		&view.View{
+			Name:        "segment_pipeline_e2e_latency_seconds",
+			Measure:     census.mSegmentPipelineE2ELatency,
+			Description: "Time from source segment emerged from segmenter till transcoded segment inserted into playlist",
+			TagKeys:     append([]tag.Key{census.kProfile}, segTags...),
+			Aggregation: view.Distribution(0, .250, .500, .750, 1.000, 1.500, 2.000, 2.500, 3.000, 4.000, 5.000, 7.500, 10.000, 15.000, 20.000),
+		},
+		&view.View{
+			Name:        "orch_segment_received_total",
+			Measure:     census.mOrchSegmentReceived,
+			Description: "Number of segments received by the orchestrator",
+			TagKeys:     baseTags,
+			Aggregation: view.Count(),
+		},
+		&view.View{
+			Name:        "orch_segment_rejected_total",
+			Measure:     census.mOrchSegmentRejected,
+			Description: "Number of segments rejected by the orchestrator",
+			TagKeys:     append([]tag.Key{census.kErrorCode}, baseTags...),
+			Aggregation: view.Count(),
+		},
+		&view.View{
+			Name:        "orch_transcode_queue_depth",
+			Measure:     census.mOrchTranscodeQueueDepth,
+			Description: "Number of segments waiting for or being transcoded",
+			TagKeys:     baseTags,
+			Aggregation: view.LastValue(),
+		},
+		&view.View{
+			Name:        "orch_payment_errors_total",
+			Measure:     census.mOrchPaymentError,
+			Description: "Number of payments the orchestrator failed to process",
+			TagKeys:     baseTags,
+			Aggregation: view.Count(),
+		},
+		&view.View{
+			Name:        "segment_source_oversized_total",
+			Measure:     census.mSegmentOversized,
+			Description: "Number of source segments dropped for exceeding the maximum size",
+			TagKeys:     segTags,
+			Aggregation: view.Count(),
+		},
+		&view.View{
+			Name:        "playlist_insert_total",
+			Measure:     census.mPlaylistInsertTotal,
+			Description: "Number of segments inserted into playlists",
+			TagKeys:     append([]tag.Key{census.kProfile}, segTags...),
+			Aggregation: view.Count(),
+		},
+		&view.View{
+			Name:        "playlist_insert_failed_total",
+			Measure:     census.mPlaylistInsertFailed,
+			Description: "Number of segments that failed to be inserted into playlists",
+			TagKeys:     append([]tag.Key{census.kProfile, census.kErrorCode}, segTags...),
+			Aggregation: view.Count(),
+		},
+		&view.View{
+			Name:        "goroutine_count",
+			Measure:     census.mGoroutineCount,
+			Description: "Number of running goroutines",
+			TagKeys:     baseTags,
+			Aggregation: view.LastValue(),
+		},
+		&view.View{
+			Name:        "gpu_utilization_percent",
+			Measure:     census.mGPUUtilization,
+			Description: "GPU utilization, percent",
+			TagKeys:     append([]tag.Key{census.kGPU}, baseTags...),
+			Aggregation: view.LastValue(),
+		},
+		&view.View{
+			Name:        "gpu_encoder_utilization_percent",
+			Measure:     census.mGPUEncoderUtilization,
+			Description: "GPU video encoder utilization, percent",
+			TagKeys:     append([]tag.Key{census.kGPU}, baseTags...),
+			Aggregation: view.LastValue(),
+		},
+		&view.View{
+			Name:        "gpu_decoder_utilization_percent",
+			Measure:     census.mGPUDecoderUtilization,
+			Description: "GPU video decoder utilization, percent",
+			TagKeys:     append([]tag.Key{census.kGPU}, baseTags...),
+			Aggregation: view.LastValue(),
+		},
+		&view.View{
+			Name:        "gpu_encoder_sessions",
+			Measure:     census.mGPUEncoderSessions,
+			Description: "Number of active GPU encoder sessions",
+			TagKeys:     append([]tag.Key{census.kGPU}, baseTags...),
+			Aggregation: view.LastValue(),
+		},
+		&view.View{
+			Name:        "gpu_memory_used_bytes",
+			Measure:     census.mGPUMemoryUsed,
+			Description: "GPU memory in use, bytes",
+			TagKeys:     append([]tag.Key{census.kGPU}, baseTags...),
+			Aggregation: view.LastValue(),
+		},
+		&view.View{
+			Name:        "gpu_memory_total_bytes",
+			Measure:     census.mGPUMemoryTotal,
+			Description: "Total GPU memory, bytes",
+			TagKeys:     append([]tag.Key{census.kGPU}, baseTags...),
+			Aggregation: view.LastValue(),
+		},
+		&view.View{
+			Name:        "profile_transcode_failed_total",
+			Measure:     census.mProfileTranscodeFailed,
+			Description: "Number of transcoded renditions that failed to appear, by profile",
+			TagKeys:     append([]tag.Key{census.kProfile, census.kErrorCode}, segTags...),
+			Aggregation: view.Count(),
+		},
+		&view.View{
+			Name:        "transcode_quality_score",
+			Measure:     census.mTranscodeQualityScore,
+			Description: "VMAF score of transcoded segments",
+			TagKeys:     append([]tag.Key{census.kProfile}, segTags...),
+			Aggregation: view.Distribution(0, 20, 40, 60, 70, 75, 80, 85, 90, 93, 95, 97, 99, 100),
+		},
+		&view.View{
+			Name:        "transcode_quality_score_latest",
+			Measure:     census.mTranscodeQualityScoreLatest,
+			Description: "Latest VMAF score of transcoded segments",
+			TagKeys:     append([]tag.Key{census.kProfile}, baseTags...),
+			Aggregation: view.LastValue(),
+		},
+	}
+	if PerStreamMetrics {
+		census.vStreamSuccessRate = &view.View{
+			Name:        "stream_success_rate",
+			Measure:     census.mStreamSuccessRate,
+			Description: "Number of transcoded segments divided on number of source segments, per stream",
+			TagKeys:     segTags,
+			Aggregation: view.LastValue(),
+		}
+		views = append(views, census.vStreamSuccessRate)
+	}
+	for _, v := range views {
+		v.TagKeys = filterTagKeys(v.TagKeys)
+		if b, ok := HistogramBuckets[v.Name]; ok && v.Aggregation.Type == view.AggTypeDistribution {
+			v.Aggregation = view.Distribution(b...)
+		}
+	}
+	if Exemplars {
+		views, census.exemplars = splitExemplarViews(views)
+	}
+	viewGroupsLock.Lock()
+	allViews = views
+	views = enabledViews(views)
+	viewGroupsLock.Unlock()
+	// Register the views
+	if err := view.Register(views...); err != nil {
+		glog.Fatalf("Failed to register views: %v", err)
+	}
+	registry = rprom.NewRegistry()
+	registry.MustRegister(rprom.NewProcessCollector(rprom.ProcessCollectorOpts{}))
+	registry.MustRegister(rprom.NewGoCollector())
+	for _, h := range census.exemplars {
+		registry.MustRegister(h.vec)
+	}
+	pe, err := prometheus.NewExporter(prometheus.Options{
+		Namespace: "livepeer",
+		Registry:  registry,
+	})
+	if err != nil {
+		glog.Fatalf("Failed to create the Prometheus stats exporter: %v", err)
+	}
+
+	// Register the Prometheus exporters as a stats exporter.
+	view.RegisterExporter(pe)
+	stats.Record(ctx, mVersions.M(1))
+	census.start()
+	Exporter = pe
+}
+
+// start runs the background loops watching for lost segments and stalls
+func (cen *censusMetricsCounter) start() {
+	ctx, err := tag.New(cen.ctx, tag.Insert(cen.kErrorCode, "LostSegment"))
+	if err != nil {
+		glog.Fatal("Error creating context", err)
+	}
+	go cen.watchdogMonitor(ctx)
+}
+
+// LogDiscoveryError records discovery error
+func (cen *censusMetricsCounter) LogDiscoveryError(code string) {
+	GetSampledLogger().Error("Discovery error", map[string]interface{}{"code": code})
+	if strings.Contains(code, "OrchestratorCapped") {
+		code = "OrchestratorCapped"
+	} else if strings.Contains(code, "Canceled") {
+		code = "Canceled"
+	}
+	ctx, err := tag.New(cen.ctx, tag.Insert(cen.kErrorCode, code))
+	if err != nil {
+		glog.Error("Error creating context", err)
+		return
+	}
+	stats.Record(ctx, cen.mDiscoveryError.M(1))
+}
+
+// LogDiscoveryLatency records how long a call to get orchestrators took
+func (cen *censusMetricsCounter) LogDiscoveryLatency(latency time.Duration) {
+	cen.lock.Lock()
+	defer cen.lock.Unlock()
+	stats.Record(cen.ctx, cen.mDiscoveryLatency.M(latency.Seconds()))
+}
+
+// LogDiscoveryResponses records how many orchestrators a discovery call
+// requested and how many of them responded successfully
+func (cen *censusMetricsCounter) LogDiscoveryResponses(requested, responded int) {
+	cen.lock.Lock()
+	defer cen.lock.Unlock()
+	stats.Record(cen.ctx, cen.mDiscoveryRequested.M(int64(requested)), cen.mDiscoveryResponded.M(int64(responded)))
+	cen.discoveryRan = true
+	cen.lastDiscoveryResponded = responded
+}
+
+// OrchestratorPoolSize records the number of orchestrators discovery selects from
+func (cen *censusMetricsCounter) OrchestratorPoolSize(size int) {
+	cen.lock.Lock()
+	defer cen.lock.Unlock()
+	stats.Record(cen.ctx, cen.mOrchestratorPoolSize.M(int64(size)))
+}
+
+// LogDiscoveryCache records a discovery call served from the orchestrator
+// cache, and the age of the orchestrators served, or one that missed it
+func (cen *censusMetricsCounter) LogDiscoveryCache(hit bool, age time.Duration) {
+	cen.lock.Lock()
+	defer cen.lock.Unlock()
+	if hit {
+		stats.Record(cen.ctx, cen.mDiscoveryCacheHit.M(1), cen.mDiscoveryCacheAge.M(age.Seconds()))
+	} else {
+		stats.Record(cen.ctx, cen.mDiscoveryCacheMiss.M(1))
+	}
+}
+
+// LogSessionRefresh records the duration of an orchestrator session refresh,
+// counting it as an error if the refresh failed
+func (cen *censusMetricsCounter) LogSessionRefresh(dur time.Duration, err error) {
+	cen.lock.Lock()
+	defer cen.lock.Unlock()
+	stats.Record(cen.ctx, cen.mSessionRefreshDuration.M(dur.Seconds()))
+	if err != nil {
+		stats.Record(cen.ctx, cen.mSessionRefreshError.M(1))
+	}
+}
+
+// LogDuplicateSegment records a source segment whose sequence number was
+// already seen for the stream
+func (cen *censusMetricsCounter) LogDuplicateSegment(nonce, seqNo uint64) {
+	cen.lock.Lock()
+	defer cen.lock.Unlock()
+	stats.Record(cen.ctx, cen.mDuplicateSegment.M(1))
+}
+
+// LogOutOfOrderSegment records a source segment that arrived after a segment
+// with a higher sequence number
+func (cen *censusMetricsCounter) LogOutOfOrderSegment(nonce, seqNo uint64) {
+	cen.lock.Lock()
+	defer cen.lock.Unlock()
+	stats.Record(cen.ctx, cen.mOutOfOrderSegment.M(1))
+}
+
+// LogSegmentDurationDrift records how far the duration of a source segment
+// is from the configured segment length
+func (cen *censusMetricsCounter) LogSegmentDurationDrift(nonce, seqNo uint64, drift time.Duration) {
+	cen.lock.Lock()
+	defer cen.lock.Unlock()
+	if drift < 0 {
+		drift = -drift
+	}
+	stats.Record(cen.ctx, cen.mSegmentDurationDrift.M(drift.Seconds()))
+}
+
+// SetLostSegmentTimeout overrides LostSegmentTimeout for the stream with the
+// given nonce
+func (cen *censusMetricsCounter) SetLostSegmentTimeout(nonce uint64, timeout time.Duration) {
+	cen.lock.Lock()
+	defer cen.lock.Unlock()
+	if avg, ok := cen.success[nonce]; ok {
+		avg.timeout = timeout
+	}
+}
+
+// lostTimeout returns how long a segment of the stream with the given nonce
+// can stay pending. Must be called with cen.lock held.
+func (cen *censusMetricsCounter) lostTimeout(nonce uint64) time.Duration {
+	if avg, ok := cen.success[nonce]; ok {
+		return avg.lostTimeout()
+	}
+	return LostSegmentTimeout
+}
+
+func (cen *censusMetricsCounter) successRate() float64 {
+	var i int
+	var f float64
+	for _, avg := range cen.success {
+		if r, has := avg.successRate(); has {
+			i++
+			f += r
+		}
+	}
+	return f / float64(i)
+}
+
+// GetSuccessRateSnapshot returns the current success rate of each stream,
+// keyed by nonce. Streams without enough data are omitted.
+func (cen *censusMetricsCounter) GetSuccessRateSnapshot() map[uint64]float64 {
+	cen.lock.Lock()
+	defer cen.lock.Unlock()
+	rates := make(map[uint64]float64, len(cen.success))
+	for nonce, avg := range cen.success {
+		if r, has := avg.successRate(); has {
+			rates[nonce] = r
+		}
+	}
+	return rates
+}
+
+func (sa *segmentsAverager) successRate() (float64, bool) {
+	var emerged, transcoded int
+	if sa.end == -1 {
+		return 0, false
+	}
+	i := sa.start
+	now := time.Now()
+	timeout := sa.lostTimeout()
+	for {
+		item := &sa.segments[i]
+		if item.transcoded > 0 || item.failed || now.Sub(item.emergedTime) > timeout {
+			emerged += item.emerged
+			transcoded += item.transcoded
+		}
+		if i == sa.end {
+			break
+		}
+		i = sa.advance(i)
+	}
+	if emerged > 0 {
+		return float64(transcoded) / float64(emerged), true
+	}
+	return 0, false
+}
+
+func (sa *segmentsAverager) lostTimeout() time.Duration {
+	if sa.timeout > 0 {
+		return sa.timeout
+	}
+	return LostSegmentTimeout
+}
+
+func (sa *segmentsAverager) advance(i int) int {
+	i++
+	if i == len(sa.segments) {
+		i = 0
+	}
+	return i
+}
+
+func (sa *segmentsAverager) addEmerged(seqNo uint64) {
+	item, _ := sa.getAddItem(seqNo)
+	item.emerged = 1
+	item.transcoded = 0
+	item.emergedTime = time.Now()
+	item.seqNo = seqNo
+}
+
+func (sa *segmentsAverager) addTranscoded(seqNo uint64, failed bool) {
+	item, found := sa.getAddItem(seqNo)
+	if !found {
+		item.emerged = 0
+		item.emergedTime = time.Now()
+	}
+	item.failed = failed
+	if !failed {
+		item.transcoded = 1
+	}
+	item.seqNo = seqNo
+}
+
+func (sa *segmentsAverager) getAddItem(seqNo uint64) (*segmentCount, bool) {
+	var index int
+	if sa.end == -1 {
+		sa.end = 0
+	} else {
+		i := sa.start
+		for {
+			if sa.segments[i].seqNo == seqNo {
+				return &sa.segments[i], true
+			}
+			if i == sa.end {
+				break
+			}
+			i = sa.advance(i)
+		}
+		sa.end = sa.advance(sa.end)
+		index = sa.end
+		if sa.end == sa.start {
+			sa.start = sa.advance(sa.start)
+		}
+	}
+	return &sa.segments[index], false
+}
+
+// ErrLossRateAlertHandler is returned when registering a loss rate alert
+// without a handler to call when it fires
+var ErrLossRateAlertHandler = errors.New("LossRateAlertHandler")
+
+// RegisterLossRateAlert registers an alert that fires when the segment
+// loss rate of a stream exceeds the alert threshold
+func RegisterLossRateAlert(a LossRateAlert) error {
+	if a.Handler == nil {
+		return ErrLossRateAlertHandler
+	}
+	lossRateAlertsLock.Lock()
+	defer lossRateAlertsLock.Unlock()
+	lossRateAlerts = append(lossRateAlerts, &lossRateAlertState{
+		alert:       a,
+		windowStart: time.Now(),
+		counts:      make(map[uint64]*lossCount),
+	})
+	return nil
+}
+
+func numLossRateAlerts() int {
+	lossRateAlertsLock.Lock()
+	defer lossRateAlertsLock.Unlock()
+	return len(lossRateAlerts)
+}
+
+// countLoss applies f to the counts of every loss rate alert for nonce
+func countLoss(nonce uint64, f func(c *lossCount)) {
+	lossRateAlertsLock.Lock()
+	defer lossRateAlertsLock.Unlock()
+	for _, la := range lossRateAlerts {
+		f(la.count(nonce))
+	}
+}
+
+func (la *lossRateAlertState) count(nonce uint64) *lossCount {
+	c, ok := la.counts[nonce]
+	if !ok {
+		c = &lossCount{}
+		la.counts[nonce] = c
+	}
+	return c
+}
+
+// check fires the alert handler for every stream whose loss rate exceeded the
+// threshold during the last window and starts a new window
+func (la *lossRateAlertState) check(now time.Time) {
+	if now.Sub(la.windowStart) < la.alert.Window {
+		return
+	}
+	for nonce, c := range la.counts {
+		if c.total == 0 {
+			continue
+		}
+		rate := float64(c.lost) / float64(c.total)
+		if rate > la.alert.Threshold {
+			glog.Warningf("Segment loss rate alert nonce=%d rate=%v threshold=%v", nonce, rate, la.alert.Threshold)
+			go runLossRateHandler(la.alert.Handler, nonce, rate)
+		}
+	}
+	la.counts = make(map[uint64]*lossCount)
+	la.windowStart = now
+}
+
+func runLossRateHandler(handler func(uint64, float64), nonce uint64, rate float64) {
+	done := make(chan struct{})
+	go func() {
+		handler(nonce, rate)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(lossRateAlertTimeout):
+		GetLogger().Error("Segment loss rate alert handler timed out", map[string]interface{}{LogFieldNonce: nonce})
+	}
+}
+
+// timeoutWatcher checks for lost segments every pause until ctx is done
+func (cen *censusMetricsCounter) timeoutWatcher(ctx context.Context, pause time.Duration) {
+	defer RecoverAndReport("timeoutWatcher")
+	var lastGoroutineCheck time.Time
+	for {
+		// let the watchdog know we're alive
+		select {
+		case cen.watchdogCh <- struct{}{}:
+		default:
+		}
+		cen.lock.Lock()
+		now := time.Now()
+		for nonce, emerged := range cen.emergeTimes {
+			timeout := cen.lostTimeout(nonce)
+			for seqNo, tm := range emerged {
+				ago := now.Sub(tm)
+				if ago > timeout {
+					stats.Record(cen.streamCtx(cen.ctx, nonce), cen.mSegmentEmerged.M(1))
+					delete(emerged, seqNo)
+					delete(cen.segmentTraces[nonce], seqNo)
+					// This shouldn't happen, but if it is, we record
+					// `LostSegment` error, to try to find out why we missed segment
+					stats.Record(cen.streamCtx(ctx, nonce), cen.mSegmentTranscodeFailed.M(1))
+					GetLogger().Error("LostSegment", map[string]interface{}{LogFieldNonce: nonce, LogFieldSeqNo: seqNo, "emerged_ago": ago})
+					countLoss(nonce, func(c *lossCount) { c.lost++ })
+				}
+			}
+		}
+		lossRateAlertsLock.Lock()
+		for _, la := range lossRateAlerts {
+			la.check(now)
+		}
+		lossRateAlertsLock.Unlock()
+		if now.Sub(lastGoroutineCheck) >= goroutineCheckInterval {
+			lastGoroutineCheck = now
+			cen.checkGoroutines()
+		}
+		cen.lock.Unlock()
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(pause):
+		}
+	}
+}
+
+// checkGoroutines records the goroutine count and alerts if it is too high.
+// Must be called with cen.lock held.
+func (cen *censusMetricsCounter) checkGoroutines() {
+	n := runtime.NumGoroutine()
+	stats.Record(cen.ctx, cen.mGoroutineCount.M(int64(n)))
+	if n <= GoroutineCountThreshold {
+		return
+	}
+	GetLogger().Error("Goroutine count above threshold; possible goroutine leak",
+		map[string]interface{}{"count": n, "threshold": GoroutineCountThreshold})
+	lossRateAlertsLock.Lock()
+	defer lossRateAlertsLock.Unlock()
+	for _, la := range lossRateAlerts {
+		go runLossRateHandler(la.alert.Handler, GoroutineLeakNonce, float64(n))
+	}
+}
+
+// watchdogMonitor runs timeoutWatcher until ctx is done, and restarts it if
+// it stops sending heartbeats. The stuck watcher is stopped first, so that
+// it exits rather than running alongside its replacement once unblocked.
+func (cen *censusMetricsCounter) watchdogMonitor(ctx context.Context) {
+	pause := timeoutWatcherPause
+	deadline := pause * 3
+	wctx, stop := context.WithCancel(ctx)
+	go cen.timeoutWatcher(wctx, pause)
+	timer := time.NewTimer(deadline)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			stop()
+			return
+		case <-cen.watchdogCh:
+		case <-timer.C:
+			GetLogger().Error("Lost segment watcher hasn't responded; restarting", map[string]interface{}{"deadline": deadline})
+			atomic.StoreInt32(&cen.watchdogFired, 1)
+			stats.Record(cen.ctx, cen.mWatchdogTimeout.M(1))
+			stop()
+			wctx, stop = context.WithCancel(ctx)
+			go cen.timeoutWatcher(wctx, pause)
+		}
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(deadline)
+	}
+}
+
+// WatchdogTimeout returns true if the lost segment watcher ever stopped responding
+func (cen *censusMetricsCounter) WatchdogTimeout() bool {
+	return atomic.LoadInt32(&cen.watchdogFired) == 1
+}
+
+func (cen *censusMetricsCounter) MaxSessions(maxSessions int) {
+	cen.lock.Lock()
+	defer cen.lock.Unlock()
+	stats.Record(cen.ctx, cen.mMaxSessions.M(int64(maxSessions)))
+}
+
+func (cen *censusMetricsCounter) CurrentSessions(currentSessions int) {
+	cen.lock.Lock()
+	defer cen.lock.Unlock()
+	stats.Record(cen.ctx, cen.mCurrentSessions.M(int64(currentSessions)))
+}
+
+// LogOrchSegmentReceived records a segment received by the orchestrator
+func (cen *censusMetricsCounter) LogOrchSegmentReceived() {
+	cen.lock.Lock()
+	defer cen.lock.Unlock()
+	stats.Record(cen.ctx, cen.mOrchSegmentReceived.M(1))
+}
+
+// LogOrchSegmentRejected records a segment the orchestrator had no capacity for
+func (cen *censusMetricsCounter) LogOrchSegmentRejected(code SegmentTranscodeError) {
+	cen.lock.Lock()
+	defer cen.lock.Unlock()
+	ctx, err := tag.New(cen.ctx, tag.Insert(cen.kErrorCode, string(code)))
+	if err != nil {
+		GetLogger().Error("Error creating context", map[string]interface{}{"error": err})
+		return
+	}
+	stats.Record(ctx, cen.mOrchSegmentRejected.M(1))
+}
+
+// LogOrchTranscodeQueued records a segment entering the transcode queue
+func (cen *censusMetricsCounter) LogOrchTranscodeQueued() {
+	cen.lock.Lock()
+	defer cen.lock.Unlock()
+	cen.orchQueueDepth++
+	stats.Record(cen.ctx, cen.mOrchTranscodeQueueDepth.M(cen.orchQueueDepth))
+}
+
+// LogOrchTranscodeDequeued records a segment leaving the transcode queue
+func (cen *censusMetricsCounter) LogOrchTranscodeDequeued() {
+	cen.lock.Lock()
+	defer cen.lock.Unlock()
+	cen.orchQueueDepth--
+	stats.Record(cen.ctx, cen.mOrchTranscodeQueueDepth.M(cen.orchQueueDepth))
+}
+
+// LogOrchPaymentError records a payment the orchestrator failed to process.
+// Payments processed are counted by tickets_received_total.
+func (cen *censusMetricsCounter) LogOrchPaymentError() {
+	cen.lock.Lock()
+	defer cen.lock.Unlock()
+	stats.Record(cen.ctx, cen.mOrchPaymentError.M(1))
+}
+
+// LogPMSessionStarted associates a PM session with the orchestrator it pays,
+// so that ticket metrics can be tagged per orchestrator
+func (cen *censusMetricsCounter) LogPMSessionStarted(sessionID, orchestrator string) {
+	cen.lock.Lock()
+	defer cen.lock.Unlock()
+	cen.pmSessions[sessionID] = orchestrator
+}
+
+// LogTicketSent records the face value of a ticket sent within a PM session
+func (cen *censusMetricsCounter) LogTicketSent(sessionID, recipient string, faceValue *big.Int) {
+	cen.lock.Lock()
+	defer cen.lock.Unlock()
+	ctx, err := tag.New(cen.ctx, tag.Insert(cen.kOrchestrator, cen.pmOrchestrator(sessionID)),
+		tag.Insert(cen.kRecipient, recipient))
+	if err != nil {
+		GetLogger().Error("Error creating context", map[string]interface{}{"session_id": sessionID, "error": err})
+		return
+	}
+	fv, _ := new(big.Float).SetInt(faceValue).Float64()
+	stats.Record(ctx, cen.mTicketFaceValueSent.M(fv))
+	if cen.pmFees == nil {
+		cen.pmFees = make(map[string]*big.Int)
+	}
+	if _, ok := cen.pmFees[sessionID]; !ok {
+		cen.pmFees[sessionID] = new(big.Int)
+	}
+	cen.pmFees[sessionID].Add(cen.pmFees[sessionID], faceValue)
+}
+
+// LogTicketReceived records a valid ticket received from a broadcaster
+func (cen *censusMetricsCounter) LogTicketReceived(sender string, faceValue *big.Int) {
+	cen.lock.Lock()
+	defer cen.lock.Unlock()
+	ctx, err := tag.New(cen.ctx, tag.Insert(cen.kSender, sender))
+	if err != nil {
+		GetLogger().Error("Error creating context", map[string]interface{}{"sender": sender, "error": err})
+		return
+	}
+	fv, _ := new(big.Float).SetInt(faceValue).Float64()
+	stats.Record(ctx, cen.mTicketFaceValueReceived.M(fv))
+}
+
+// LogWinningTicket records a winning ticket received from sender within a PM
+// session, and remembers when it was received until it is redeemed
+func (cen *censusMetricsCounter) LogWinningTicket(sessionID, sender string, faceValue *big.Int) {
+	cen.lock.Lock()
+	defer cen.lock.Unlock()
+	ctx, err := tag.New(cen.ctx, tag.Insert(cen.kOrchestrator, cen.pmOrchestrator(sessionID)),
+		tag.Insert(cen.kSender, sender))
+	if err != nil {
+		GetLogger().Error("Error creating context", map[string]interface{}{"session_id": sessionID, "error": err})
+		return
+	}
+	fv, _ := new(big.Float).SetInt(faceValue).Float64()
+	stats.Record(ctx, cen.mWinningTickets.M(1), cen.mWinningTicketFaceValue.M(fv))
+	if cen.pmWinTimes == nil {
+		cen.pmWinTimes = make(map[string][]time.Time)
+	}
+	cen.pmWinTimes[sessionID] = append(cen.pmWinTimes[sessionID], time.Now())
+}
+
+// LogWinningTicketsRedeemed records the time from win till redemption of the
+// winning tickets of the given PM sessions, or the failure to redeem them.
+// The sessions are forgotten either way, as they aren't redeemed again.
+func (cen *censusMetricsCounter) LogWinningTicketsRedeemed(sessionIDs []string, err error) {
+	cen.lock.Lock()
 	defer cen.lock.Unlock()
-	ctx, err := tag.New(cen.ctx, tag.Insert(census.kProfile, profile))
 	if err != nil {
-		glog.Error("Error creating context", err)
+		stats.Record(cen.ctx, cen.mTicketRedemptionError.M(1))
+	}
+	now := time.Now()
+	for _, id := range sessionIDs {
+		if err == nil {
+			for _, won := range cen.pmWinTimes[id] {
+				stats.Record(cen.ctx, cen.mTicketRedemptionLatency.M(now.Sub(won).Seconds()))
+			}
+		}
+		delete(cen.pmWinTimes, id)
+	}
+}
+
+// LogWinningTicketSent records a winning ticket sent to recipient. Senders
+// only learn that a ticket won once the recipient redeems it.
+func (cen *censusMetricsCounter) LogWinningTicketSent(recipient string, faceValue *big.Int) {
+	cen.lock.Lock()
+	defer cen.lock.Unlock()
+	ctx, err := tag.New(cen.ctx, tag.Insert(cen.kRecipient, recipient))
+	if err != nil {
+		GetLogger().Error("Error creating context", map[string]interface{}{"recipient": recipient, "error": err})
+		return
+	}
+	fv, _ := new(big.Float).SetInt(faceValue).Float64()
+	stats.Record(ctx, cen.mWinningTicketsSent.M(1), cen.mWinningTicketFaceValueSent.M(fv))
+}
+
+// LogOrchestratorUploaded records the time taken to upload a segment to orch,
+// the orchestrator service URI
+func (cen *censusMetricsCounter) LogOrchestratorUploaded(orch string, took time.Duration) {
+	cen.lock.Lock()
+	defer cen.lock.Unlock()
+	ctx, err := tag.New(cen.ctx, tag.Insert(cen.kOrchestrator, orch))
+	if err != nil {
+		GetLogger().Error("Error creating context", map[string]interface{}{"orchestrator": orch, "error": err})
+		return
+	}
+	stats.Record(ctx, cen.mOrchestratorUploadTime.M(took.Seconds()))
+}
+
+// LogOrchestratorTranscoded records the time from starting the upload of a
+// segment to orch till receiving its transcode result
+func (cen *censusMetricsCounter) LogOrchestratorTranscoded(orch string, roundTrip time.Duration) {
+	cen.lock.Lock()
+	defer cen.lock.Unlock()
+	ctx, err := tag.New(cen.ctx, tag.Insert(cen.kOrchestrator, orch))
+	if err != nil {
+		GetLogger().Error("Error creating context", map[string]interface{}{"orchestrator": orch, "error": err})
+		return
+	}
+	stats.Record(ctx, cen.mOrchestratorRoundTripTime.M(roundTrip.Seconds()))
+}
+
+// LogOrchestratorFailed records a segment that orch failed to accept or
+// transcode. code is the SegmentUploadError or SegmentTranscodeError.
+func (cen *censusMetricsCounter) LogOrchestratorFailed(orch, code string) {
+	cen.lock.Lock()
+	defer cen.lock.Unlock()
+	ctx, err := tag.New(cen.ctx, tag.Insert(cen.kOrchestrator, orch), tag.Insert(cen.kErrorCode, code))
+	if err != nil {
+		GetLogger().Error("Error creating context", map[string]interface{}{"orchestrator": orch, "error": err})
+		return
+	}
+	stats.Record(ctx, cen.mOrchestratorFailed.M(1))
+}
+
+// LogOrchestratorOverPriced records orch not being selected for asking more
+// than the broadcaster's maximum price
+func (cen *censusMetricsCounter) LogOrchestratorOverPriced(orch string) {
+	cen.lock.Lock()
+	defer cen.lock.Unlock()
+	ctx, err := tag.New(cen.ctx, tag.Insert(cen.kOrchestrator, orch))
+	if err != nil {
+		GetLogger().Error("Error creating context", map[string]interface{}{"orchestrator": orch, "error": err})
+		return
+	}
+	stats.Record(ctx, cen.mOrchestratorOverPriced.M(1))
+}
+
+// LogOrchestratorPing records the round trip time of a ping to orch
+func (cen *censusMetricsCounter) LogOrchestratorPing(orch string, rtt time.Duration) {
+	cen.lock.Lock()
+	defer cen.lock.Unlock()
+	ctx, err := tag.New(cen.ctx, tag.Insert(cen.kOrchestrator, orch))
+	if err != nil {
+		GetLogger().Error("Error creating context", map[string]interface{}{"orchestrator": orch, "error": err})
+		return
+	}
+	stats.Record(ctx, cen.mOrchestratorPing.M(rtt.Seconds()))
+}
+
+// LogSpotCheckFailed records a rendition by orch diverging from the one
+// transcoded by the spot check reference
+func (cen *censusMetricsCounter) LogSpotCheckFailed(orch string) {
+	cen.lock.Lock()
+	defer cen.lock.Unlock()
+	ctx, err := tag.New(cen.ctx, tag.Insert(cen.kOrchestrator, orch))
+	if err != nil {
+		GetLogger().Error("Error creating context", map[string]interface{}{"orchestrator": orch, "error": err})
+		return
+	}
+	stats.Record(ctx, cen.mOrchestratorSpotCheckFailed.M(1))
+}
+
+// LogOrchestratorSuspended records orch being suspended for cooldown after
+// failing a session
+func (cen *censusMetricsCounter) LogOrchestratorSuspended(orch string, cooldown time.Duration) {
+	glog.Infof("Logging OrchestratorSuspended... orchestrator=%s cooldown=%v", orch, cooldown)
+	props := map[string]interface{}{
+		"orchestrator": orch,
+		"cooldown":     cooldown.Seconds(),
+	}
+	sendPost("OrchestratorSuspended", 0, props)
+
+	cen.lock.Lock()
+	defer cen.lock.Unlock()
+	ctx, err := tag.New(cen.ctx, tag.Insert(cen.kOrchestrator, orch))
+	if err != nil {
+		GetLogger().Error("Error creating context", map[string]interface{}{"orchestrator": orch, "error": err})
+		return
+	}
+	stats.Record(ctx, cen.mOrchestratorSuspended.M(1))
+}
+
+// LogSegmentVerified records a rendition transcoded by orch that passed
+// verification
+func (cen *censusMetricsCounter) LogSegmentVerified(orch, profile string) {
+	cen.lock.Lock()
+	defer cen.lock.Unlock()
+	ctx, err := tag.New(cen.ctx, tag.Insert(cen.kOrchestrator, orch), tag.Insert(cen.kProfile, profile))
+	if err != nil {
+		GetLogger().Error("Error creating context", map[string]interface{}{"orchestrator": orch, "error": err})
+		return
+	}
+	stats.Record(ctx, cen.mSegmentVerified.M(1))
+}
+
+// LogSegmentVerificationFailed records a rendition transcoded by orch that
+// failed verification. code classifies the mismatch.
+func (cen *censusMetricsCounter) LogSegmentVerificationFailed(nonce, seqNo uint64, orch, profile, code, reason string) {
+	glog.Infof("Logging SegmentVerificationFailed... nonce=%d seqNo=%d orchestrator=%s profile=%s code=%s reason=%s", nonce, seqNo, orch, profile, code, reason)
+	props := map[string]interface{}{
+		"seqNo":        seqNo,
+		"orchestrator": orch,
+		"profile":      profile,
+		"errorCode":    code,
+		"reason":       reason,
+	}
+	sendPost("SegmentVerificationFailed", nonce, props)
+
+	cen.lock.Lock()
+	defer cen.lock.Unlock()
+	ctx, err := tag.New(cen.ctx, tag.Insert(cen.kOrchestrator, orch), tag.Insert(cen.kProfile, profile), tag.Insert(cen.kErrorCode, code))
+	if err != nil {
+		GetLogger().Error("Error creating context", map[string]interface{}{"orchestrator": orch, "error": err})
+		return
+	}
+	stats.Record(ctx, cen.mSegmentVerificationFailed.M(1))
+}
+
+// Object storage operations
+const (
+	OSOperationSaveData = "SaveData"
+	OSOperationGetData  = "GetSegmentData"
+)
+
+// LogOSOperation records an object storage operation of size bytes on the
+// given driver (eg, s3) that took `took`. A non-nil err counts as a failure.
+func (cen *censusMetricsCounter) LogOSOperation(driver, op string, bytes int, took time.Duration, err error) {
+	cen.lock.Lock()
+	defer cen.lock.Unlock()
+	ctx, tagErr := tag.New(cen.ctx, tag.Insert(cen.kDriver, driver), tag.Insert(cen.kOSOperation, op))
+	if tagErr != nil {
+		GetLogger().Error("Error creating context", map[string]interface{}{"driver": driver, "error": tagErr})
+		return
+	}
+	if err != nil {
+		ctx, tagErr = tag.New(ctx, tag.Insert(cen.kErrorCode, osErrorCode(err)))
+		if tagErr != nil {
+			GetLogger().Error("Error creating context", map[string]interface{}{"driver": driver, "error": tagErr})
+			return
+		}
+		stats.Record(ctx, cen.mOSOperationTime.M(took.Seconds()), cen.mOSOperationFailed.M(1))
+		return
+	}
+	stats.Record(ctx, cen.mOSOperationTime.M(took.Seconds()), cen.mOSOperationBytes.M(int64(bytes)))
+}
+
+// osErrorCode maps object storage errors onto a small set of codes
+func osErrorCode(err error) string {
+	msg := err.Error()
+	switch {
+	case msg == "Session ended":
+		return "SessionEnded"
+	case strings.Contains(msg, "Client.Timeout") || strings.Contains(msg, "timeout"):
+		return "Timeout"
+	case len(msg) >= 3 && msg[0] >= '1' && msg[0] <= '5' && strings.Trim(msg[:3], "0123456789") == "":
+		return msg[:3] // HTTP status
+	}
+	return "Unknown"
+}
+
+// Directions of transferred video bytes
+const (
+	BytesIngress            = "ingress"             // source video received over RTMP
+	BytesEgressOrchestrator = "egress_orchestrator" // source segments sent to orchestrators
+	BytesEgressOS           = "egress_os"           // segments saved to external object storage
+	BytesHLS                = "hls"                 // segments served to HLS players
+	BytesDASH               = "dash"                // segments served to DASH players
+)
+
+// LogBytesTransferred records bytes of video of the stream identified by
+// nonce moving in the given direction
+func (cen *censusMetricsCounter) LogBytesTransferred(direction string, nonce uint64, bytes int64) {
+	cen.lock.Lock()
+	defer cen.lock.Unlock()
+	ctx, err := tag.New(cen.streamCtx(cen.ctx, nonce), tag.Insert(cen.kDirection, direction))
+	if err != nil {
+		GetLogger().Error("Error creating context", map[string]interface{}{LogFieldNonce: nonce, "direction": direction, "error": err})
+		return
+	}
+	stats.Record(ctx, cen.mBytesTransferred.M(bytes))
+}
+
+// pmOrchestrator returns the orchestrator paid within the PM session. Sessions
+// that were not started by this node (eg, on orchestrators) belong to the node itself.
+func (cen *censusMetricsCounter) pmOrchestrator(sessionID string) string {
+	if orch, ok := cen.pmSessions[sessionID]; ok {
+		return orch
+	}
+	return cen.nodeID
+}
+
+// LogTranscodeCache records a transcode result cache lookup
+func (cen *censusMetricsCounter) LogTranscodeCache(hit bool) {
+	cen.lock.Lock()
+	defer cen.lock.Unlock()
+	if hit {
+		stats.Record(cen.ctx, cen.mTranscodeCacheHit.M(1))
+	} else {
+		stats.Record(cen.ctx, cen.mTranscodeCacheMiss.M(1))
+	}
+}
+
+func (cen *censusMetricsCounter) UploadConcurrency(inUse int) {
+	cen.lock.Lock()
+	defer cen.lock.Unlock()
+	stats.Record(cen.ctx, cen.mUploadConcurrency.M(int64(inUse)))
+}
+
+// LogSegmentRetries records how many times a segment was resubmitted for
+// transcoding before it succeeded or ran out of retries
+func (cen *censusMetricsCounter) LogSegmentRetries(nonce, seqNo uint64, retries int) {
+	cen.lock.Lock()
+	defer cen.lock.Unlock()
+	stats.Record(cen.streamCtx(cen.ctx, nonce), cen.mTranscodeRetries.M(int64(retries)))
+}
+
+// LogSegmentRetriesExhausted records a segment failing to transcode after
+// using up its retry attempts or deadline
+func (cen *censusMetricsCounter) LogSegmentRetriesExhausted(nonce, seqNo uint64, attempts int, err error) {
+	GetSampledLogger().Error("Segment retries exhausted", map[string]interface{}{LogFieldNonce: nonce, LogFieldSeqNo: seqNo, "attempts": attempts, "error": err})
+	cen.lock.Lock()
+	stats.Record(cen.streamCtx(cen.ctx, nonce), cen.mTranscodeRetriesExhausted.M(1))
+	cen.lock.Unlock()
+
+	props := map[string]interface{}{
+		"seqNo":    seqNo,
+		"attempts": attempts,
+		"reason":   err.Error(),
+	}
+	sendPost("SegmentRetriesExhausted", nonce, props)
+}
+
+// TranscodeRetryBacklog records the number of segments being resubmitted
+func (cen *censusMetricsCounter) TranscodeRetryBacklog(segments int) {
+	cen.lock.Lock()
+	defer cen.lock.Unlock()
+	stats.Record(cen.ctx, cen.mTranscodeRetryBacklog.M(int64(segments)))
+}
+
+func (cen *censusMetricsCounter) segmentEmerged(nonce, seqNo uint64, profilesNum int, byteSize int64) {
+	cen.lock.Lock()
+	defer cen.lock.Unlock()
+	// record all emergence measures in one batch so they can't diverge
+	stats.Record(cen.streamCtx(cen.ctx, nonce), cen.mSegmentEmergedWithProfiles.M(int64(profilesNum)),
+		cen.mSegmentEmergedBytes.M(byteSize))
+	_, hasEmerged := cen.emergeTimes[nonce]
+	avg, hasAvg := cen.success[nonce]
+	if hasEmerged && !hasAvg {
+		// segments of another stream with the same nonce are still tracked
+		GetLogger().Error("Nonce collision detected", map[string]interface{}{LogFieldNonce: nonce, LogFieldSeqNo: seqNo})
+		stats.Record(cen.ctx, cen.mNonceCollision.M(1))
+	}
+	if !hasEmerged {
+		cen.emergeTimes[nonce] = make(map[uint64]time.Time)
+	}
+	if hasAvg {
+		avg.addEmerged(seqNo)
+	}
+	countLoss(nonce, func(c *lossCount) { c.total++ })
+	cen.stream(nonce).emerged++
+	cen.emergeTimes[nonce][seqNo] = time.Now()
+}
+
+func (cen *censusMetricsCounter) codecChanged(nonce, seqNo uint64) {
+	cen.lock.Lock()
+	defer cen.lock.Unlock()
+	cen.codecChanges[nonce] = seqNo
+	stats.Record(cen.streamCtx(cen.ctx, nonce), cen.mCodecChange.M(1))
+}
+
+func (cen *censusMetricsCounter) segmentSourceAppeared(nonce, seqNo uint64, profile string) {
+	cen.lock.Lock()
+	defer cen.lock.Unlock()
+	ctx, err := tag.New(cen.streamCtx(cen.ctx, nonce), tag.Insert(census.kProfile, profile))
+	if err != nil {
+		GetLogger().Error("Error creating context", map[string]interface{}{LogFieldNonce: nonce, LogFieldSeqNo: seqNo, "error": err})
 		return
 	}
 	stats.Record(ctx, cen.mSegmentSourceAppeared.M(1))
@@ -511,7 +2099,13 @@ func (cen *censusMetricsCounter) segmentSourceAppeared(nonce, seqNo uint64, prof
 func (cen *censusMetricsCounter) segmentUploaded(nonce, seqNo uint64, uploadDur time.Duration) {
 	cen.lock.Lock()
 	defer cen.lock.Unlock()
-	stats.Record(cen.ctx, cen.mSegmentUploaded.M(1), cen.mUploadTime.M(float64(uploadDur/time.Second)))
+	ctx := cen.streamCtx(cen.ctx, nonce)
+	stats.Record(ctx, cen.mSegmentUploaded.M(1))
+	cen.recordLatency(ctx, nonce, seqNo, cen.mUploadTime, float64(uploadDur/time.Second))
+	if len(cen.uploadTimes) >= uploadTimeSamples {
+		cen.uploadTimes = cen.uploadTimes[1:]
+	}
+	cen.uploadTimes = append(cen.uploadTimes, uploadTime{at: time.Now(), dur: uploadDur})
 }
 
 func (cen *censusMetricsCounter) segmentUploadFailed(nonce, seqNo uint64, code SegmentUploadError) {
@@ -519,23 +2113,23 @@ func (cen *censusMetricsCounter) segmentUploadFailed(nonce, seqNo uint64, code S
 	defer cen.lock.Unlock()
 	cen.countSegmentEmerged(nonce, seqNo)
 
-	ctx, err := tag.New(cen.ctx, tag.Insert(census.kErrorCode, string(code)))
+	ctx, err := tag.New(cen.streamCtx(cen.ctx, nonce), tag.Insert(census.kErrorCode, string(code)))
 	if err != nil {
-		glog.Error("Error creating context", err)
+		GetLogger().Error("Error creating context", map[string]interface{}{LogFieldNonce: nonce, LogFieldSeqNo: seqNo, "error": err})
 		return
 	}
 	stats.Record(ctx, cen.mSegmentUploadFailed.M(1))
 	cen.countSegmentTranscoded(nonce, seqNo, true)
-	cen.sendSuccess()
+	cen.sendSuccess(nonce)
 }
 
 func (cen *censusMetricsCounter) segmentTranscoded(nonce, seqNo uint64, transcodeDur, totalDur time.Duration,
 	profiles string) {
 	cen.lock.Lock()
 	defer cen.lock.Unlock()
-	ctx, err := tag.New(cen.ctx, tag.Insert(cen.kProfiles, profiles))
+	ctx, err := tag.New(cen.streamCtx(cen.ctx, nonce), tag.Insert(cen.kProfiles, profiles))
 	if err != nil {
-		glog.Error("Error creating context", err)
+		GetLogger().Error("Error creating context", map[string]interface{}{LogFieldNonce: nonce, LogFieldSeqNo: seqNo, "error": err})
 		return
 	}
 	stats.Record(ctx, cen.mSegmentTranscoded.M(1), cen.mTranscodeTime.M(float64(transcodeDur/time.Second)))
@@ -544,9 +2138,15 @@ func (cen *censusMetricsCounter) segmentTranscoded(nonce, seqNo uint64, transcod
 func (cen *censusMetricsCounter) segmentTranscodeFailed(nonce, seqNo uint64, code SegmentTranscodeError) {
 	cen.lock.Lock()
 	defer cen.lock.Unlock()
-	ctx, err := tag.New(cen.ctx, tag.Insert(census.kErrorCode, string(code)))
+	if code == SegmentTranscodeErrorTranscode {
+		if changed, ok := cen.codecChanges[nonce]; ok && changed == seqNo {
+			// attribute the failure to the encoder rather than the orchestrator
+			code = SegmentTranscodeErrorCodecChange
+		}
+	}
+	ctx, err := tag.New(cen.streamCtx(cen.ctx, nonce), tag.Insert(census.kErrorCode, string(code)))
 	if err != nil {
-		glog.Error("Error creating context", err)
+		GetLogger().Error("Error creating context", map[string]interface{}{LogFieldNonce: nonce, LogFieldSeqNo: seqNo, "error": err})
 		return
 	}
 	stats.Record(ctx, cen.mSegmentTranscodeFailed.M(1))
@@ -554,9 +2154,11 @@ func (cen *censusMetricsCounter) segmentTranscodeFailed(nonce, seqNo uint64, cod
 		// Do not count segments into success rate if transcoded segment arrived after stream was ended
 		return
 	}
+	cen.stream(nonce).failed++
 	cen.countSegmentEmerged(nonce, seqNo)
 	cen.countSegmentTranscoded(nonce, seqNo, true)
-	cen.sendSuccess()
+	cen.sendSuccess(nonce)
+	cen.checkSuccessRate(nonce)
 }
 
 func (cen *censusMetricsCounter) countSegmentTranscoded(nonce, seqNo uint64, failed bool) {
@@ -567,70 +2169,274 @@ func (cen *censusMetricsCounter) countSegmentTranscoded(nonce, seqNo uint64, fai
 
 func (cen *censusMetricsCounter) countSegmentEmerged(nonce, seqNo uint64) {
 	if _, ok := cen.emergeTimes[nonce][seqNo]; ok {
-		stats.Record(cen.ctx, cen.mSegmentEmerged.M(1))
+		stats.Record(cen.streamCtx(cen.ctx, nonce), cen.mSegmentEmerged.M(1))
 		delete(cen.emergeTimes[nonce], seqNo)
+		delete(cen.segmentTraces[nonce], seqNo)
+	}
+}
+
+// SetLowSuccessRateHandler sets the function that is called, at most once every
+// 30 seconds per stream, when a stream success rate drops below
+// LowSuccessRateRefreshThreshold. Typically used to refresh sessions.
+func SetLowSuccessRateHandler(h func(nonce uint64, rate float64)) {
+	census.lock.Lock()
+	defer census.lock.Unlock()
+	lowSuccessRateHandler = h
+}
+
+// checkSuccessRate invokes the low success rate handler if the success rate of
+// the stream crossed the threshold
+func (cen *censusMetricsCounter) checkSuccessRate(nonce uint64) {
+	if lowSuccessRateHandler == nil {
+		return
+	}
+	avg, ok := cen.success[nonce]
+	if !ok {
+		return
+	}
+	rate, has := avg.successRate()
+	if !has || rate >= LowSuccessRateRefreshThreshold {
+		return
+	}
+	if time.Since(cen.lastEmergencyRefresh[nonce]) < emergencyRefreshInterval {
+		return
+	}
+	cen.lastEmergencyRefresh[nonce] = time.Now()
+	glog.Warningf("Low success rate nonce=%d rate=%v threshold=%v; refreshing sessions", nonce, rate, LowSuccessRateRefreshThreshold)
+	stats.Record(cen.ctx, cen.mEmergencyRefresh.M(1))
+	go lowSuccessRateHandler(nonce, rate)
+}
+
+// streamCtx adds the manifest ID of the stream to ctx if per-stream metrics
+// are enabled, and the allowed labels of the stream
+func (cen *censusMetricsCounter) streamCtx(ctx context.Context, nonce uint64) context.Context {
+	var mutators []tag.Mutator
+	if mid, ok := cen.manifests[nonce]; ok && PerStreamMetrics {
+		mutators = append(mutators, tag.Insert(cen.kManifestID, mid))
 	}
+	if st, ok := cen.streams[nonce]; ok {
+		for _, k := range cen.kStreamLabels {
+			if v, ok := st.labels[k.Name()]; ok {
+				mutators = append(mutators, tag.Insert(k, v))
+			}
+		}
+	}
+	if len(mutators) == 0 {
+		return ctx
+	}
+	sctx, err := tag.New(ctx, mutators...)
+	if err != nil {
+		GetLogger().Error("Error creating context", map[string]interface{}{LogFieldNonce: nonce, "error": err})
+		return ctx
+	}
+	return sctx
 }
 
-func (cen *censusMetricsCounter) sendSuccess() {
+// sendSuccess records the success rate averaged across all streams, and the
+// success rate of the given stream if per-stream metrics are enabled
+func (cen *censusMetricsCounter) sendSuccess(nonce uint64) {
 	stats.Record(cen.ctx, cen.mSuccessRate.M(cen.successRate()))
+	if !PerStreamMetrics {
+		return
+	}
+	cen.recordStreamSuccess(nonce)
 }
 
-func SegmentFullyTranscoded(nonce, seqNo uint64, profiles string, allSuccess bool) {
-	census.lock.Lock()
-	defer census.lock.Unlock()
-	ctx, err := tag.New(census.ctx, tag.Insert(census.kProfiles, profiles))
+func (cen *censusMetricsCounter) recordStreamSuccess(nonce uint64) {
+	avg, ok := cen.success[nonce]
+	if !ok {
+		return
+	}
+	if rate, has := avg.successRate(); has {
+		stats.Record(cen.streamCtx(cen.ctx, nonce), cen.mStreamSuccessRate.M(rate))
+	}
+}
+
+// dropStreamSuccessRate drops the stream_success_rate rows of ended streams,
+// which would otherwise keep their last value. Views can't drop single rows,
+// so the view is registered anew and the rates of the remaining streams are
+// recorded again.
+func (cen *censusMetricsCounter) dropStreamSuccessRate() {
+	if cen.vStreamSuccessRate == nil {
+		return
+	}
+	v := view.Find(cen.vStreamSuccessRate.Name)
+	if v == nil {
+		return // not registered, eg its view group is disabled
+	}
+	view.Unregister(v)
+	nv := *v
+	if err := view.Register(&nv); err != nil {
+		GetLogger().Error("Error registering view", map[string]interface{}{"view": v.Name, "error": err})
+		return
+	}
+	cen.vStreamSuccessRate = &nv
+	for nonce := range cen.success {
+		cen.recordStreamSuccess(nonce)
+	}
+}
+
+// SegmentFullyTranscoded records the outcome of all the renditions of a segment
+func (cen *censusMetricsCounter) SegmentFullyTranscoded(nonce, seqNo uint64, succeededProfiles, failedProfiles []string, errCode SegmentTranscodeError) {
+	cen.lock.Lock()
+	defer cen.lock.Unlock()
+	names := make(sort.StringSlice, 0, len(succeededProfiles)+len(failedProfiles))
+	names = append(append(names, succeededProfiles...), failedProfiles...)
+	names.Sort()
+	ctx, err := tag.New(cen.streamCtx(cen.ctx, nonce), tag.Insert(cen.kProfiles, strings.Join(names, ",")))
 	if err != nil {
-		glog.Error("Error creating context", err)
+		GetLogger().Error("Error creating context", map[string]interface{}{LogFieldNonce: nonce, LogFieldSeqNo: seqNo, "error": err})
 		return
 	}
+	allSuccess := len(failedProfiles) == 0
+	if !allSuccess && errCode == "" {
+		errCode = SegmentTranscodeErrorUnknown
+	}
+	for _, profile := range failedProfiles {
+		pctx, err := tag.New(cen.streamCtx(cen.ctx, nonce), tag.Insert(cen.kProfile, profile),
+			tag.Insert(cen.kErrorCode, string(errCode)))
+		if err != nil {
+			GetLogger().Error("Error creating context", map[string]interface{}{LogFieldNonce: nonce, LogFieldSeqNo: seqNo, "error": err})
+			continue
+		}
+		stats.Record(pctx, cen.mProfileTranscodeFailed.M(1))
+	}
 
-	if st, ok := census.emergeTimes[nonce][seqNo]; ok {
+	if st, ok := cen.emergeTimes[nonce][seqNo]; ok {
 		if allSuccess {
 			latency := time.Since(st)
-			stats.Record(ctx, census.mTranscodeOverallLatency.M(float64(latency/time.Second)))
+			stats.Record(ctx, cen.mTranscodeOverallLatency.M(float64(latency/time.Second)))
+			cen.stream(nonce).latency += latency
 		}
-		census.countSegmentEmerged(nonce, seqNo)
+		cen.countSegmentEmerged(nonce, seqNo)
 	}
 	if allSuccess {
-		stats.Record(ctx, census.mSegmentTranscodedAllAppeared.M(1))
+		stats.Record(ctx, cen.mSegmentTranscodedAllAppeared.M(1))
+		cen.stream(nonce).transcoded++
 	}
-	census.countSegmentTranscoded(nonce, seqNo, false)
-	census.sendSuccess()
+	cen.countSegmentTranscoded(nonce, seqNo, false)
+	cen.sendSuccess(nonce)
+	cen.checkSuccessRate(nonce)
 }
 
 func (cen *censusMetricsCounter) segmentTranscodedAppeared(nonce, seqNo uint64, profile string) {
 	cen.lock.Lock()
 	defer cen.lock.Unlock()
-	ctx, err := tag.New(cen.ctx, tag.Insert(cen.kProfile, profile))
+	ctx, err := tag.New(cen.streamCtx(cen.ctx, nonce), tag.Insert(cen.kProfile, profile))
 	if err != nil {
-		glog.Error("Error creating context", err)
+		GetLogger().Error("Error creating context", map[string]interface{}{LogFieldNonce: nonce, LogFieldSeqNo: seqNo, "error": err})
 		return
 	}
 
 	// cen.transcodedSegments[nonce] = cen.transcodedSegments[nonce] + 1
 	if st, ok := cen.emergeTimes[nonce][seqNo]; ok {
 		latency := time.Since(st)
-		stats.Record(ctx, cen.mTranscodeLatency.M(float64(latency/time.Second)))
+		cen.recordLatency(ctx, nonce, seqNo, cen.mTranscodeLatency, float64(latency/time.Second))
+		stats.Record(ctx, cen.mSegmentPipelineE2ELatency.M(latency.Seconds()))
 	}
 
 	stats.Record(ctx, cen.mSegmentTranscodedAppeared.M(1))
 }
 
+// LogStreamRejected records an RTMP stream rejected for reason. The nonce is
+// zero for streams rejected before they were created.
+func (cen *censusMetricsCounter) LogStreamRejected(nonce uint64, reason string) {
+	cen.lock.Lock()
+	defer cen.lock.Unlock()
+	ctx, err := tag.New(cen.streamCtx(cen.ctx, nonce), tag.Insert(cen.kErrorCode, reason))
+	if err != nil {
+		glog.Error("Error creating context", err)
+		return
+	}
+	stats.Record(ctx, cen.mStreamRejected.M(1))
+}
+
+// LogSegmentTranscodedLocally records a segment transcoded by the
+// broadcaster itself because no orchestrator was available
+func (cen *censusMetricsCounter) LogSegmentTranscodedLocally(nonce, seqNo uint64) {
+	cen.lock.Lock()
+	defer cen.lock.Unlock()
+	stats.Record(cen.streamCtx(cen.ctx, nonce), cen.mSegmentTranscodedLocally.M(1))
+}
+
+// LogSegmentOversized records a source segment dropped for exceeding the
+// maximum segment size
+func (cen *censusMetricsCounter) LogSegmentOversized(nonce, seqNo uint64, size int64) {
+	cen.lock.Lock()
+	defer cen.lock.Unlock()
+	stats.Record(cen.streamCtx(cen.ctx, nonce), cen.mSegmentOversized.M(1))
+}
+
+// LogPlaylistInsert counts an attempt to insert a segment into a playlist
+func (cen *censusMetricsCounter) LogPlaylistInsert(nonce uint64, profile string) {
+	cen.lock.Lock()
+	defer cen.lock.Unlock()
+	ctx, err := tag.New(cen.streamCtx(cen.ctx, nonce), tag.Insert(cen.kProfile, profile))
+	if err != nil {
+		GetLogger().Error("Error creating context", map[string]interface{}{LogFieldNonce: nonce, "error": err})
+		return
+	}
+	stats.Record(ctx, cen.mPlaylistInsertTotal.M(1))
+}
+
+// LogPlaylistInsertFailed records a failure to insert a segment into a playlist
+func (cen *censusMetricsCounter) LogPlaylistInsertFailed(nonce, seqNo uint64, profile, reason string) {
+	cen.lock.Lock()
+	defer cen.lock.Unlock()
+	ctx, err := tag.New(cen.streamCtx(cen.ctx, nonce), tag.Insert(cen.kProfile, profile),
+		tag.Insert(cen.kErrorCode, reason))
+	if err != nil {
+		GetLogger().Error("Error creating context", map[string]interface{}{LogFieldNonce: nonce, LogFieldSeqNo: seqNo, "error": err})
+		return
+	}
+	stats.Record(ctx, cen.mPlaylistInsertFailed.M(1))
+}
+
+// LogTranscodeQualityScore records the VMAF score of a transcoded segment.
+// The score is computed by the transcoding pipeline.
+func (cen *censusMetricsCounter) LogTranscodeQualityScore(nonce, seqNo uint64, profile string, vmafScore float64) {
+	cen.transcodeQualityScore(nonce, seqNo, profile, vmafScore)
+}
+
+func (cen *censusMetricsCounter) transcodeQualityScore(nonce, seqNo uint64, profile string, vmafScore float64) {
+	cen.lock.Lock()
+	defer cen.lock.Unlock()
+	ctx, err := tag.New(cen.ctx, tag.Insert(cen.kProfile, profile))
+	if err != nil {
+		GetLogger().Error("Error creating context", map[string]interface{}{LogFieldNonce: nonce, LogFieldSeqNo: seqNo, "error": err})
+		return
+	}
+	stats.Record(cen.streamCtx(ctx, nonce), cen.mTranscodeQualityScore.M(vmafScore))
+	stats.Record(ctx, cen.mTranscodeQualityScoreLatest.M(vmafScore))
+}
+
+func (cen *censusMetricsCounter) eventsDropped(n int) {
+	cen.lock.Lock()
+	defer cen.lock.Unlock()
+	stats.Record(cen.ctx, cen.mEventsDropped.M(int64(n)))
+}
+
 func (cen *censusMetricsCounter) streamCreateFailed(nonce uint64, reason string) {
 	cen.lock.Lock()
 	defer cen.lock.Unlock()
 	stats.Record(cen.ctx, cen.mStreamCreateFailed.M(1))
 }
 
-func (cen *censusMetricsCounter) streamCreated(nonce uint64) {
+func (cen *censusMetricsCounter) streamCreated(manifestID string, nonce uint64) error {
 	cen.lock.Lock()
 	defer cen.lock.Unlock()
+	if _, has := cen.success[nonce]; has {
+		stats.Record(cen.ctx, cen.mNonceCollision.M(1))
+		return ErrNonceCollision
+	}
 	stats.Record(cen.ctx, cen.mStreamCreated.M(1))
+	cen.manifests[nonce] = manifestID
+	cen.stream(nonce).started = time.Now()
 	cen.success[nonce] = &segmentsAverager{
-		segments: make([]segmentCount, 30),
+		segments: make([]segmentCount, SuccessRateWindow),
 		end:      -1,
 	}
+	return nil
 }
 
 func (cen *censusMetricsCounter) streamStarted(nonce uint64) {
@@ -643,6 +2449,22 @@ func (cen *censusMetricsCounter) streamEnded(nonce uint64) {
 	cen.lock.Lock()
 	defer cen.lock.Unlock()
 	stats.Record(cen.ctx, cen.mStreamEnded.M(1))
+	if streamEndedHandler != nil {
+		go streamEndedHandler(cen.streamSummary(nonce))
+	}
 	delete(cen.emergeTimes, nonce)
+	delete(cen.segmentTraces, nonce)
 	delete(cen.success, nonce)
+	if PerStreamMetrics {
+		cen.dropStreamSuccessRate()
+	}
+	delete(cen.manifests, nonce)
+	delete(cen.lastEmergencyRefresh, nonce)
+	delete(cen.codecChanges, nonce)
+	delete(cen.streams, nonce)
+	lossRateAlertsLock.Lock()
+	for _, la := range lossRateAlerts {
+		delete(la.counts, nonce)
+	}
+	lossRateAlertsLock.Unlock()
 }
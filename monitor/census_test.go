@@ -0,0 +1,649 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+)
+
+func TestWatchdogTimeout(t *testing.T) {
+	defer func(p time.Duration, c *censusMetricsCounter) {
+		timeoutWatcherPause = p
+		census = c
+	}(timeoutWatcherPause, census)
+	timeoutWatcherPause = 10 * time.Millisecond
+	census = &censusMetricsCounter{
+		ctx:              context.Background(),
+		emergeTimes:      make(map[uint64]map[uint64]time.Time),
+		watchdogCh:       make(chan struct{}, 1),
+		mWatchdogTimeout: stats.Int64("test_watchdog_timeout", "", "tot"),
+		mGoroutineCount:  stats.Int64("test_watchdog_goroutine_count", "", "tot"),
+	}
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+	go census.watchdogMonitor(ctx)
+
+	time.Sleep(100 * time.Millisecond)
+	if WatchdogTimeout() {
+		t.Fatal("Watchdog fired for a healthy watcher")
+	}
+
+	// block the watcher for longer than the deadline
+	census.lock.Lock()
+	time.Sleep(100 * time.Millisecond)
+	census.lock.Unlock()
+	if !WatchdogTimeout() {
+		t.Error("Watchdog did not fire for a blocked watcher")
+	}
+}
+
+func TestGetSuccessRateSnapshot(t *testing.T) {
+	census = &censusMetricsCounter{success: make(map[uint64]*segmentsAverager)}
+	newAvg := func() *segmentsAverager {
+		return &segmentsAverager{segments: make([]segmentCount, 30), end: -1}
+	}
+
+	// all segments transcoded
+	census.success[1] = newAvg()
+	census.success[1].addEmerged(0)
+	census.success[1].addTranscoded(0, false)
+	census.success[1].addEmerged(1)
+	census.success[1].addTranscoded(1, false)
+
+	// one of two segments failed
+	census.success[2] = newAvg()
+	census.success[2].addEmerged(0)
+	census.success[2].addTranscoded(0, false)
+	census.success[2].addEmerged(1)
+	census.success[2].addTranscoded(1, true)
+
+	// no data yet
+	census.success[3] = newAvg()
+
+	rates := GetSuccessRateSnapshot()
+	if len(rates) != 2 {
+		t.Fatal("Unexpected number of rates ", rates)
+	}
+	if rates[1] != 1.0 {
+		t.Error("Unexpected success rate for nonce 1 ", rates[1])
+	}
+	if rates[2] != 0.5 {
+		t.Error("Unexpected success rate for nonce 2 ", rates[2])
+	}
+	if _, ok := rates[3]; ok {
+		t.Error("Nonce without data should be omitted")
+	}
+}
+
+func TestLostSegmentTimeout(t *testing.T) {
+	defer func(d time.Duration) { LostSegmentTimeout = d }(LostSegmentTimeout)
+	avg := &segmentsAverager{segments: make([]segmentCount, 30), end: -1}
+	avg.addEmerged(0)
+
+	// a pending segment isn't counted until it times out
+	LostSegmentTimeout = time.Minute
+	if _, has := avg.successRate(); has {
+		t.Error("Pending segment counted before the timeout")
+	}
+	LostSegmentTimeout = 0
+	if r, has := avg.successRate(); !has || r != 0 {
+		t.Error("Expected timed out segment to count as lost; got ", r, has)
+	}
+
+	// streams with longer segments get their own timeout
+	cen := &censusMetricsCounter{success: map[uint64]*segmentsAverager{1: avg}}
+	cen.SetLostSegmentTimeout(1, time.Minute)
+	cen.SetLostSegmentTimeout(2, time.Minute) // unknown streams are ignored
+	if _, has := avg.successRate(); has {
+		t.Error("Pending segment counted before the stream timeout")
+	}
+	if cen.lostTimeout(1) != time.Minute || cen.lostTimeout(2) != LostSegmentTimeout {
+		t.Error("Unexpected lost segment timeouts ", cen.lostTimeout(1), cen.lostTimeout(2))
+	}
+}
+
+func TestSendSuccessPerStream(t *testing.T) {
+	PerStreamMetrics = true
+	defer func() { PerStreamMetrics = false }()
+	kManifestID, _ := tag.NewKey("manifest_id")
+	census = &censusMetricsCounter{
+		ctx:                context.Background(),
+		kManifestID:        kManifestID,
+		success:            make(map[uint64]*segmentsAverager),
+		manifests:          map[uint64]string{1: "good", 2: "broken"},
+		mSuccessRate:       stats.Float64("test_success_rate", "", "per"),
+		mStreamSuccessRate: stats.Float64("test_stream_success_rate", "", "per"),
+	}
+	v := &view.View{
+		Name:        "test_stream_success_rate",
+		Measure:     census.mStreamSuccessRate,
+		TagKeys:     []tag.Key{kManifestID},
+		Aggregation: view.LastValue(),
+	}
+	if err := view.Register(v); err != nil {
+		t.Fatal(err)
+	}
+	defer view.Unregister(v)
+
+	for nonce, failed := range map[uint64]bool{1: false, 2: true} {
+		census.success[nonce] = &segmentsAverager{segments: make([]segmentCount, 30), end: -1}
+		census.success[nonce].addEmerged(0)
+		census.success[nonce].addTranscoded(0, failed)
+		census.sendSuccess(nonce)
+	}
+
+	rows, err := view.RetrieveData("test_stream_success_rate")
+	if err != nil || len(rows) != 2 {
+		t.Fatal("Unexpected rows ", rows, err)
+	}
+	rates := make(map[string]float64)
+	for _, r := range rows {
+		rates[r.Tags[0].Value] = r.Data.(*view.LastValueData).Value
+	}
+	if rates["good"] != 1.0 || rates["broken"] != 0 {
+		t.Error("Unexpected rates ", rates)
+	}
+
+	// rows of ended streams are dropped
+	census.vStreamSuccessRate = v
+	defer func() { view.Unregister(census.vStreamSuccessRate) }()
+	delete(census.success, 2)
+	census.dropStreamSuccessRate()
+	rows, err = view.RetrieveData("test_stream_success_rate")
+	if err != nil || len(rows) != 1 || rows[0].Tags[0].Value != "good" {
+		t.Fatal("Unexpected rows after stream ended ", rows, err)
+	}
+}
+
+func TestStreamCreatedNonceCollision(t *testing.T) {
+	census = &censusMetricsCounter{
+		ctx:             context.Background(),
+		success:         make(map[uint64]*segmentsAverager),
+		manifests:       make(map[uint64]string),
+		mStreamCreated:  stats.Int64("test_stream_created", "", "tot"),
+		mNonceCollision: stats.Int64("test_nonce_collision", "", "tot"),
+	}
+	if err := census.streamCreated("a", 1); err != nil {
+		t.Fatal("Unexpected error ", err)
+	}
+	if err := census.streamCreated("b", 1); err != ErrNonceCollision {
+		t.Fatal("Expected nonce collision; got ", err)
+	}
+	if census.manifests[1] != "a" {
+		t.Error("Colliding stream replaced the existing one")
+	}
+	if err := census.streamCreated("b", 2); err != nil {
+		t.Fatal("Unexpected error ", err)
+	}
+}
+
+func TestTranscodeQualityScore(t *testing.T) {
+	kProfile, _ := tag.NewKey("profile")
+	census = &censusMetricsCounter{
+		ctx:                          context.Background(),
+		kProfile:                     kProfile,
+		mTranscodeQualityScore:       stats.Float64("test_quality_score", "", "vmaf"),
+		mTranscodeQualityScoreLatest: stats.Float64("test_quality_score_latest", "", "vmaf"),
+	}
+	dist := &view.View{
+		Name:        "test_quality_score",
+		Measure:     census.mTranscodeQualityScore,
+		TagKeys:     []tag.Key{kProfile},
+		Aggregation: view.Distribution(0, 50, 100),
+	}
+	latest := &view.View{
+		Name:        "test_quality_score_latest",
+		Measure:     census.mTranscodeQualityScoreLatest,
+		TagKeys:     []tag.Key{kProfile},
+		Aggregation: view.LastValue(),
+	}
+	if err := view.Register(dist, latest); err != nil {
+		t.Fatal(err)
+	}
+	defer view.Unregister(dist, latest)
+
+	LogTranscodeQualityScore(1, 0, "P240p30fps16x9", 92.5)
+	LogTranscodeQualityScore(1, 1, "P240p30fps16x9", 40)
+
+	rows, err := view.RetrieveData("test_quality_score")
+	if err != nil || len(rows) != 1 {
+		t.Fatal("Unexpected distribution rows ", rows, err)
+	}
+	if d := rows[0].Data.(*view.DistributionData); d.Count != 2 || d.Min != 40 || d.Max != 92.5 {
+		t.Error("Unexpected distribution ", d)
+	}
+	rows, err = view.RetrieveData("test_quality_score_latest")
+	if err != nil || len(rows) != 1 {
+		t.Fatal("Unexpected gauge rows ", rows, err)
+	}
+	if v := rows[0].Data.(*view.LastValueData).Value; v != 40 {
+		t.Error("Expected latest score to be 40; got ", v)
+	}
+}
+
+func TestSegmentFullyTranscodedProfileFailures(t *testing.T) {
+	kProfile, _ := tag.NewKey("profile")
+	kProfiles, _ := tag.NewKey("profiles")
+	kErrorCode, _ := tag.NewKey("error_code")
+	census = &censusMetricsCounter{
+		ctx:                           context.Background(),
+		kProfile:                      kProfile,
+		kProfiles:                     kProfiles,
+		kErrorCode:                    kErrorCode,
+		emergeTimes:                   make(map[uint64]map[uint64]time.Time),
+		mProfileTranscodeFailed:       stats.Int64("test_profile_transcode_failed", "", "tot"),
+		mSegmentTranscodedAllAppeared: stats.Int64("test_all_appeared", "", "tot"),
+		mSuccessRate:                  stats.Float64("test_success_rate", "", "per"),
+	}
+	failedView := &view.View{
+		Name:        "test_profile_transcode_failed",
+		Measure:     census.mProfileTranscodeFailed,
+		TagKeys:     []tag.Key{kProfile, kErrorCode},
+		Aggregation: view.Count(),
+	}
+	allView := &view.View{
+		Name:        "test_all_appeared",
+		Measure:     census.mSegmentTranscodedAllAppeared,
+		Aggregation: view.Count(),
+	}
+	if err := view.Register(failedView, allView); err != nil {
+		t.Fatal(err)
+	}
+	defer view.Unregister(failedView, allView)
+
+	// one of two renditions failed
+	SegmentFullyTranscoded(1, 0, []string{"P144p30fps16x9"}, []string{"P240p30fps16x9"}, SegmentTranscodeErrorDownload)
+	rows, err := view.RetrieveData("test_profile_transcode_failed")
+	if err != nil || len(rows) != 1 {
+		t.Fatal("Unexpected rows ", rows, err)
+	}
+	for _, tg := range rows[0].Tags {
+		if tg.Key == kProfile && tg.Value != "P240p30fps16x9" {
+			t.Error("Unexpected failed profile ", tg.Value)
+		}
+		if tg.Key == kErrorCode && tg.Value != string(SegmentTranscodeErrorDownload) {
+			t.Error("Unexpected error code ", tg.Value)
+		}
+	}
+	if rows, _ := view.RetrieveData("test_all_appeared"); len(rows) != 0 {
+		t.Error("Partially failed segment counted as fully transcoded")
+	}
+
+	// all renditions succeeded
+	SegmentFullyTranscoded(1, 1, []string{"P144p30fps16x9", "P240p30fps16x9"}, nil, "")
+	if rows, _ := view.RetrieveData("test_all_appeared"); len(rows) != 1 || rows[0].Data.(*view.CountData).Value != 1 {
+		t.Error("Expected segment to be counted as fully transcoded")
+	}
+}
+
+func TestCheckGoroutines(t *testing.T) {
+	census = &censusMetricsCounter{
+		ctx:             context.Background(),
+		mGoroutineCount: stats.Int64("test_goroutine_count", "", "tot"),
+	}
+	called := make(chan uint64, 1)
+	defer func(a []*lossRateAlertState, th int) {
+		lossRateAlerts = a
+		GoroutineCountThreshold = th
+	}(lossRateAlerts, GoroutineCountThreshold)
+	lossRateAlerts = nil
+	err := RegisterLossRateAlert(LossRateAlert{
+		Threshold: 1,
+		Window:    time.Minute,
+		Handler:   func(nonce uint64, rate float64) { called <- nonce },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// alerts without a handler would panic once they fire
+	if err := RegisterLossRateAlert(LossRateAlert{Threshold: 1, Window: time.Minute}); err != ErrLossRateAlertHandler {
+		t.Error("Expected alert without handler to be rejected; got ", err)
+	}
+	if n := numLossRateAlerts(); n != 1 {
+		t.Error("Unexpected number of alerts ", n)
+	}
+
+	// below threshold
+	census.checkGoroutines()
+	select {
+	case <-called:
+		t.Fatal("Handler called below the goroutine threshold")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	GoroutineCountThreshold = 0
+	census.checkGoroutines()
+	select {
+	case nonce := <-called:
+		if nonce != GoroutineLeakNonce {
+			t.Error("Unexpected nonce ", nonce)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Handler not called above the goroutine threshold")
+	}
+}
+
+func TestLossRateAlert(t *testing.T) {
+	defer func(a []*lossRateAlertState) { lossRateAlerts = a }(lossRateAlerts)
+	lossRateAlerts = nil
+	called := make(chan float64, 1)
+	err := RegisterLossRateAlert(LossRateAlert{
+		Threshold: 0.5,
+		Window:    time.Minute,
+		Handler:   func(nonce uint64, rate float64) { called <- rate },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	la := lossRateAlerts[0]
+	start := la.windowStart
+	expectCalled := func(msg string, rate float64) {
+		select {
+		case r := <-called:
+			if r != rate {
+				t.Error("Unexpected loss rate ", r)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Handler not called ", msg)
+		}
+	}
+	expectNotCalled := func(msg string) {
+		select {
+		case <-called:
+			t.Error("Handler called ", msg)
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+
+	countLoss(1, func(c *lossCount) { c.total += 4; c.lost += 3 })
+	la.check(start.Add(30 * time.Second))
+	expectNotCalled("before the window ended")
+	la.check(start.Add(time.Minute))
+	expectCalled("above the threshold", 0.75)
+
+	// counts start over with every window
+	if len(la.counts) != 0 {
+		t.Error("Counts not reset after the window ", la.counts)
+	}
+	la.check(start.Add(2 * time.Minute))
+	expectNotCalled("without losses in the window")
+
+	countLoss(1, func(c *lossCount) { c.total += 4; c.lost += 2 })
+	la.check(start.Add(3 * time.Minute))
+	expectNotCalled("at the threshold")
+}
+
+func TestRunLossRateHandler_Timeout(t *testing.T) {
+	defer func(d time.Duration) { lossRateAlertTimeout = d }(lossRateAlertTimeout)
+	lossRateAlertTimeout = 50 * time.Millisecond
+	release := make(chan struct{})
+	defer close(release)
+
+	done := make(chan struct{})
+	go func() {
+		runLossRateHandler(func(uint64, float64) { <-release }, 1, 1)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Hanging handler was not abandoned")
+	}
+}
+
+func TestLogOrchestratorFailed(t *testing.T) {
+	kOrchestrator, _ := tag.NewKey("orchestrator")
+	kErrorCode, _ := tag.NewKey("error_code")
+	census = &censusMetricsCounter{
+		ctx:                 context.Background(),
+		kOrchestrator:       kOrchestrator,
+		kErrorCode:          kErrorCode,
+		mOrchestratorFailed: stats.Int64("test_orchestrator_failed", "", "tot"),
+	}
+	v := &view.View{
+		Name:        "test_orchestrator_failed",
+		Measure:     census.mOrchestratorFailed,
+		TagKeys:     []tag.Key{kOrchestrator, kErrorCode},
+		Aggregation: view.Count(),
+	}
+	if err := view.Register(v); err != nil {
+		t.Fatal(err)
+	}
+	defer view.Unregister(v)
+
+	LogOrchestratorFailed("https://o1:8935", string(SegmentTranscodeErrorOrchestratorBusy))
+	LogOrchestratorFailed("https://o1:8935", string(SegmentTranscodeErrorOrchestratorBusy))
+	LogOrchestratorFailed("https://o2:8935", string(SegmentUploadErrorUnknown))
+
+	rows, err := view.RetrieveData("test_orchestrator_failed")
+	if err != nil || len(rows) != 2 {
+		t.Fatal("Unexpected rows ", rows, err)
+	}
+	counts := make(map[string]int64)
+	for _, r := range rows {
+		for _, tg := range r.Tags {
+			if tg.Key == kOrchestrator {
+				counts[tg.Value] = r.Data.(*view.CountData).Value
+			}
+		}
+	}
+	if counts["https://o1:8935"] != 2 || counts["https://o2:8935"] != 1 {
+		t.Error("Unexpected counts ", counts)
+	}
+}
+
+func TestOSErrorCode(t *testing.T) {
+	tests := map[string]string{
+		"Session ended": "SessionEnded",
+		"Get https://x/0.ts: net/http: request canceled (Client.Timeout exceeded while awaiting headers)": "Timeout",
+		"403 Forbidden":       "403",
+		"<Error>AccessDenied": "Unknown",
+		"ab":                  "Unknown",
+	}
+	for msg, code := range tests {
+		if c := osErrorCode(errors.New(msg)); c != code {
+			t.Errorf("Expected code %s for %q; got %s", code, msg, c)
+		}
+	}
+}
+
+func TestLogBytesTransferred(t *testing.T) {
+	kDirection, _ := tag.NewKey("direction")
+	census = &censusMetricsCounter{
+		ctx:               context.Background(),
+		kDirection:        kDirection,
+		mBytesTransferred: stats.Int64("test_bytes_transferred", "", "By"),
+	}
+	v := &view.View{
+		Name:        "test_bytes_transferred",
+		Measure:     census.mBytesTransferred,
+		TagKeys:     []tag.Key{kDirection},
+		Aggregation: view.Sum(),
+	}
+	if err := view.Register(v); err != nil {
+		t.Fatal(err)
+	}
+	defer view.Unregister(v)
+
+	LogBytesTransferred(BytesIngress, 1, 100)
+	LogBytesTransferred(BytesIngress, 2, 50)
+	LogBytesTransferred(BytesHLS, 1, 300)
+
+	rows, err := view.RetrieveData("test_bytes_transferred")
+	if err != nil || len(rows) != 2 {
+		t.Fatal("Unexpected rows ", rows, err)
+	}
+	sums := make(map[string]float64)
+	for _, r := range rows {
+		sums[r.Tags[0].Value] = r.Data.(*view.SumData).Value
+	}
+	if sums[BytesIngress] != 150 || sums[BytesHLS] != 300 {
+		t.Error("Unexpected sums ", sums)
+	}
+}
+
+func TestWinningTicketsRedeemed(t *testing.T) {
+	kOrchestrator, _ := tag.NewKey("orchestrator")
+	kSender, _ := tag.NewKey("sender")
+	census = &censusMetricsCounter{
+		ctx:                      context.Background(),
+		kOrchestrator:            kOrchestrator,
+		kSender:                  kSender,
+		pmSessions:               make(map[string]string),
+		mWinningTickets:          stats.Int64("test_winning_tickets", "", "tot"),
+		mWinningTicketFaceValue:  stats.Float64("test_winning_ticket_face_value", "", "wei"),
+		mTicketRedemptionLatency: stats.Float64("test_ticket_redemption_latency", "", "sec"),
+		mTicketRedemptionError:   stats.Int64("test_ticket_redemption_errors", "", "tot"),
+	}
+	fvView := &view.View{
+		Name:        "test_winning_ticket_face_value",
+		Measure:     census.mWinningTicketFaceValue,
+		Aggregation: view.Sum(),
+	}
+	latencyView := &view.View{
+		Name:        "test_ticket_redemption_latency",
+		Measure:     census.mTicketRedemptionLatency,
+		Aggregation: view.Count(),
+	}
+	errView := &view.View{
+		Name:        "test_ticket_redemption_errors",
+		Measure:     census.mTicketRedemptionError,
+		Aggregation: view.Count(),
+	}
+	if err := view.Register(fvView, latencyView, errView); err != nil {
+		t.Fatal(err)
+	}
+	defer view.Unregister(fvView, latencyView, errView)
+
+	LogWinningTicket("s1", "0xb", big.NewInt(100))
+	LogWinningTicket("s1", "0xb", big.NewInt(100))
+	LogWinningTicket("s2", "0xb", big.NewInt(100))
+	if rows, _ := view.RetrieveData("test_winning_ticket_face_value"); len(rows) != 1 || rows[0].Data.(*view.SumData).Value != 300 {
+		t.Error("Unexpected winning ticket face value ", rows)
+	}
+
+	// failed redemptions are counted and forgotten without recording latency
+	LogWinningTicketsRedeemed([]string{"s2"}, errors.New("no deposit"))
+	if rows, _ := view.RetrieveData("test_ticket_redemption_latency"); len(rows) != 0 {
+		t.Error("Unexpected redemption latency for a failed redemption ", rows)
+	}
+	if rows, _ := view.RetrieveData("test_ticket_redemption_errors"); len(rows) != 1 || rows[0].Data.(*view.CountData).Value != 1 {
+		t.Error("Expected the failed redemption to be counted ", rows)
+	}
+	LogWinningTicketsRedeemed([]string{"s1"}, nil)
+	if rows, _ := view.RetrieveData("test_ticket_redemption_latency"); len(rows) != 1 || rows[0].Data.(*view.CountData).Value != 2 {
+		t.Error("Expected the redemption latency of both tickets ", rows)
+	}
+	if len(census.pmWinTimes) != 0 {
+		t.Error("Expected redeemed sessions to be forgotten ", census.pmWinTimes)
+	}
+}
+
+func TestOrchestratorMetrics(t *testing.T) {
+	kErrorCode, _ := tag.NewKey("error_code")
+	census = &censusMetricsCounter{
+		ctx:                      context.Background(),
+		kErrorCode:               kErrorCode,
+		mOrchSegmentReceived:     stats.Int64("test_orch_segment_received", "", "tot"),
+		mOrchSegmentRejected:     stats.Int64("test_orch_segment_rejected", "", "tot"),
+		mOrchTranscodeQueueDepth: stats.Int64("test_orch_transcode_queue_depth", "", "tot"),
+		mOrchPaymentError:        stats.Int64("test_orch_payment_errors", "", "tot"),
+	}
+	views := []*view.View{
+		{Name: "test_orch_segment_received", Measure: census.mOrchSegmentReceived, Aggregation: view.Count()},
+		{Name: "test_orch_segment_rejected", Measure: census.mOrchSegmentRejected, TagKeys: []tag.Key{kErrorCode}, Aggregation: view.Count()},
+		{Name: "test_orch_transcode_queue_depth", Measure: census.mOrchTranscodeQueueDepth, Aggregation: view.LastValue()},
+		{Name: "test_orch_payment_errors", Measure: census.mOrchPaymentError, Aggregation: view.Count()},
+	}
+	if err := view.Register(views...); err != nil {
+		t.Fatal(err)
+	}
+	defer view.Unregister(views...)
+	count := func(name string) int64 {
+		rows, err := view.RetrieveData(name)
+		if err != nil || len(rows) != 1 {
+			t.Fatal("Unexpected rows ", name, rows, err)
+		}
+		return rows[0].Data.(*view.CountData).Value
+	}
+
+	LogOrchSegmentReceived()
+	LogOrchSegmentReceived()
+	if c := count("test_orch_segment_received"); c != 2 {
+		t.Error("Unexpected received segments ", c)
+	}
+
+	LogOrchSegmentRejected(SegmentTranscodeErrorOrchestratorBusy)
+	LogOrchSegmentRejected(SegmentTranscodeErrorOrchestratorBusy)
+	LogOrchSegmentRejected(SegmentTranscodeErrorOrchestratorCapped)
+	rows, _ := view.RetrieveData("test_orch_segment_rejected")
+	rejected := make(map[string]int64)
+	for _, r := range rows {
+		rejected[r.Tags[0].Value] = r.Data.(*view.CountData).Value
+	}
+	if rejected[string(SegmentTranscodeErrorOrchestratorBusy)] != 2 || rejected[string(SegmentTranscodeErrorOrchestratorCapped)] != 1 {
+		t.Error("Unexpected rejected segments ", rejected)
+	}
+
+	// the queue depth follows segments in and out of the queue
+	LogOrchTranscodeQueued()
+	LogOrchTranscodeQueued()
+	LogOrchTranscodeDequeued()
+	rows, _ = view.RetrieveData("test_orch_transcode_queue_depth")
+	if len(rows) != 1 || rows[0].Data.(*view.LastValueData).Value != 1 {
+		t.Error("Unexpected queue depth ", rows)
+	}
+
+	LogOrchPaymentError()
+	if c := count("test_orch_payment_errors"); c != 1 {
+		t.Error("Unexpected payment errors ", c)
+	}
+}
+
+func TestTicketMetrics(t *testing.T) {
+	kOrchestrator, _ := tag.NewKey("orchestrator")
+	kRecipient, _ := tag.NewKey("recipient")
+	kSender, _ := tag.NewKey("sender")
+	census = &censusMetricsCounter{
+		ctx:                      context.Background(),
+		kOrchestrator:            kOrchestrator,
+		kRecipient:               kRecipient,
+		kSender:                  kSender,
+		pmSessions:               make(map[string]string),
+		mTicketFaceValueSent:     stats.Float64("test_ticket_face_value_sent", "", "wei"),
+		mTicketFaceValueReceived: stats.Float64("test_ticket_face_value_received", "", "wei"),
+	}
+	// ticket counts and face values are views over the same measures
+	views := []*view.View{
+		{Name: "test_tickets_sent", Measure: census.mTicketFaceValueSent, Aggregation: view.Count()},
+		{Name: "test_ticket_value_sent", Measure: census.mTicketFaceValueSent, Aggregation: view.Sum()},
+		{Name: "test_tickets_received", Measure: census.mTicketFaceValueReceived, Aggregation: view.Count()},
+		{Name: "test_ticket_value_received", Measure: census.mTicketFaceValueReceived, Aggregation: view.Sum()},
+	}
+	if err := view.Register(views...); err != nil {
+		t.Fatal(err)
+	}
+	defer view.Unregister(views...)
+
+	LogTicketSent("s1", "0x1", big.NewInt(100))
+	LogTicketSent("s1", "0x1", big.NewInt(50))
+	LogTicketReceived("0xb", big.NewInt(200))
+	if rows, _ := view.RetrieveData("test_tickets_sent"); len(rows) != 1 || rows[0].Data.(*view.CountData).Value != 2 {
+		t.Error("Unexpected tickets sent ", rows)
+	}
+	if rows, _ := view.RetrieveData("test_ticket_value_sent"); len(rows) != 1 || rows[0].Data.(*view.SumData).Value != 150 {
+		t.Error("Unexpected face value sent ", rows)
+	}
+	if rows, _ := view.RetrieveData("test_tickets_received"); len(rows) != 1 || rows[0].Data.(*view.CountData).Value != 1 {
+		t.Error("Unexpected tickets received ", rows)
+	}
+	if rows, _ := view.RetrieveData("test_ticket_value_received"); len(rows) != 1 || rows[0].Data.(*view.SumData).Value != 200 {
+		t.Error("Unexpected face value received ", rows)
+	}
+}
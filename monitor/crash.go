@@ -0,0 +1,166 @@
+package monitor
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/golang/glog"
+)
+
+// How long a crash reporter may take to deliver a report before the
+// goroutine re-panics
+const crashReportTimeout = 5 * time.Second
+
+// CrashReport describes a panic captured by RecoverAndReport
+type CrashReport struct {
+	Location string `json:"location"`
+	Panic    string `json:"panic"`
+	Stack    string `json:"stack"`
+	NodeType string `json:"nodeType"`
+	NodeID   string `json:"nodeID"`
+	Version  string `json:"version"`
+	Time     int64  `json:"time"`
+}
+
+// CrashReporter ships crash reports to an external service. Report is called
+// from the panicking goroutine right before it re-panics, so it should
+// deliver the report synchronously and within crashReportTimeout.
+type CrashReporter interface {
+	Report(r *CrashReport) error
+}
+
+var (
+	crashReporters     []CrashReporter
+	crashReportersLock sync.RWMutex
+	crashNodeType      string
+	crashNodeID        string
+	crashVersion       string
+)
+
+// InitCrashReporting attaches the node type, ID and version to crash reports
+// and registers a Sentry reporter and/or a webhook reporter for the non-empty
+// sentryDSN and webhookURL.
+func InitCrashReporting(nodeType, nodeID, version, sentryDSN, webhookURL string) error {
+	crashReportersLock.Lock()
+	crashNodeType, crashNodeID, crashVersion = nodeType, nodeID, version
+	crashReportersLock.Unlock()
+	if sentryDSN != "" {
+		r, err := NewSentryCrashReporter(sentryDSN, version)
+		if err != nil {
+			return err
+		}
+		RegisterCrashReporter(r)
+	}
+	if webhookURL != "" {
+		RegisterCrashReporter(NewWebhookCrashReporter(webhookURL))
+	}
+	return nil
+}
+
+// RegisterCrashReporter adds a reporter that will receive all subsequent crash reports
+func RegisterCrashReporter(r CrashReporter) {
+	crashReportersLock.Lock()
+	defer crashReportersLock.Unlock()
+	crashReporters = append(crashReporters, r)
+}
+
+// RecoverAndReport must be deferred directly. If the goroutine is panicking,
+// the panic is sent to the registered crash reporters and then re-raised.
+func RecoverAndReport(location string) {
+	p := recover()
+	if p == nil {
+		return
+	}
+	reportCrash(location, p, debug.Stack())
+	panic(p)
+}
+
+func reportCrash(location string, p interface{}, stack []byte) {
+	crashReportersLock.RLock()
+	defer crashReportersLock.RUnlock()
+	r := &CrashReport{
+		Location: location,
+		Panic:    fmt.Sprint(p),
+		Stack:    string(stack),
+		NodeType: crashNodeType,
+		NodeID:   crashNodeID,
+		Version:  crashVersion,
+		Time:     time.Now().Unix(),
+	}
+	for _, cr := range crashReporters {
+		if err := cr.Report(r); err != nil {
+			glog.Errorf("Error reporting crash location=%s err=%v", location, err)
+		}
+	}
+}
+
+// SentryCrashReporter sends crash reports to Sentry
+type SentryCrashReporter struct {
+	hub *sentry.Hub
+}
+
+// NewSentryCrashReporter creates a reporter for the Sentry project at dsn
+func NewSentryCrashReporter(dsn, version string) (*SentryCrashReporter, error) {
+	client, err := sentry.NewClient(sentry.ClientOptions{Dsn: dsn, Release: version})
+	if err != nil {
+		return nil, fmt.Errorf("error creating Sentry client: %v", err)
+	}
+	return &SentryCrashReporter{hub: sentry.NewHub(client, sentry.NewScope())}, nil
+}
+
+// Report sends the crash to Sentry and waits for it to be delivered
+func (s *SentryCrashReporter) Report(r *CrashReport) error {
+	event := sentry.NewEvent()
+	event.Level = sentry.LevelFatal
+	event.Message = fmt.Sprintf("panic in %s: %s", r.Location, r.Panic)
+	event.Exception = []sentry.Exception{{
+		Type:       "panic",
+		Value:      r.Panic,
+		Stacktrace: sentry.NewStacktrace(),
+	}}
+	event.Tags = map[string]string{
+		"location":  r.Location,
+		"node_type": r.NodeType,
+		"node_id":   r.NodeID,
+	}
+	event.Contexts = map[string]sentry.Context{"panic": {"stack": r.Stack}}
+	s.hub.CaptureEvent(event)
+	if !s.hub.Flush(crashReportTimeout) {
+		return fmt.Errorf("timed out sending crash report to Sentry")
+	}
+	return nil
+}
+
+// WebhookCrashReporter POSTs each crash report as JSON to a URL
+type WebhookCrashReporter struct {
+	url    string
+	client *http.Client
+}
+
+// NewWebhookCrashReporter creates a reporter posting to url
+func NewWebhookCrashReporter(url string) *WebhookCrashReporter {
+	return &WebhookCrashReporter{url: url, client: &http.Client{Timeout: crashReportTimeout}}
+}
+
+// Report posts the crash report and waits for the response
+func (w *WebhookCrashReporter) Report(r *CrashReport) error {
+	body, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	resp, err := w.client.Post(w.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("crash webhook %s returned status %d", w.url, resp.StatusCode)
+	}
+	return nil
+}
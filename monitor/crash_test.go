@@ -0,0 +1,72 @@
+package monitor
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type stubCrashReporter struct {
+	reports []*CrashReport
+}
+
+func (s *stubCrashReporter) Report(r *CrashReport) error {
+	s.reports = append(s.reports, r)
+	return nil
+}
+
+func TestRecoverAndReport(t *testing.T) {
+	defer func() { crashReporters = nil }()
+	stub := &stubCrashReporter{}
+	RegisterCrashReporter(stub)
+	InitCrashReporting("bctr", "node1", "0.5.0", "", "")
+
+	repanicked := func() (p interface{}) {
+		defer func() { p = recover() }()
+		func() {
+			defer RecoverAndReport("processSegment")
+			panic("boom")
+		}()
+		return nil
+	}()
+	if repanicked != "boom" {
+		t.Error("Expected the panic to be re-raised; got ", repanicked)
+	}
+	if len(stub.reports) != 1 {
+		t.Fatal("Expected one crash report; got ", len(stub.reports))
+	}
+	r := stub.reports[0]
+	if r.Location != "processSegment" || r.Panic != "boom" || r.NodeType != "bctr" || r.NodeID != "node1" || r.Version != "0.5.0" {
+		t.Error("Unexpected report ", r)
+	}
+	if !strings.Contains(r.Stack, "TestRecoverAndReport") {
+		t.Error("Expected the stack of the panicking goroutine")
+	}
+
+	// no panic, no report
+	func() {
+		defer RecoverAndReport("processSegment")
+	}()
+	if len(stub.reports) != 1 {
+		t.Error("Unexpected crash report without a panic")
+	}
+}
+
+func TestWebhookCrashReporter(t *testing.T) {
+	var received CrashReport
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&received); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer ts.Close()
+
+	if err := NewWebhookCrashReporter(ts.URL).Report(&CrashReport{Location: "dlFunc", Panic: "boom"}); err != nil {
+		t.Fatal(err)
+	}
+	if received.Location != "dlFunc" || received.Panic != "boom" {
+		t.Error("Unexpected report ", received)
+	}
+}
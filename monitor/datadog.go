@@ -0,0 +1,121 @@
+package monitor
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/DataDog/datadog-go/statsd"
+	"github.com/golang/glog"
+	"go.opencensus.io/stats/view"
+)
+
+// DefaultStatsDAddr is the address of a local DogStatsD agent
+const DefaultStatsDAddr = "127.0.0.1:8125"
+
+// DataDogSink is a stats exporter that sends Livepeer metrics to DataDog
+// through a DogStatsD agent. Cumulative counts and sums are sent as counter
+// increments, last values as gauges, and distributions as a counter plus a
+// gauge holding the average of the values recorded since the last export.
+type DataDogSink struct {
+	client statsd.ClientInterface
+
+	lock sync.Mutex
+	last map[string]view.AggregationData // view name + tags : last exported data
+}
+
+// NewDataDogSink creates a sink sending metrics to the DogStatsD agent at addr
+func NewDataDogSink(addr, nodeType, nodeID string) (*DataDogSink, error) {
+	client, err := statsd.New(addr,
+		statsd.WithNamespace("livepeer."),
+		statsd.WithTags([]string{"node_type:" + nodeType, "node_id:" + nodeID}))
+	if err != nil {
+		return nil, err
+	}
+	return &DataDogSink{
+		client: client,
+		last:   make(map[string]view.AggregationData),
+	}, nil
+}
+
+// InitWithDogStatsD starts exporting metrics to the DogStatsD agent at
+// statsdAddr. Does nothing if statsdAddr is empty. May be used together with
+// or instead of Init.
+func InitWithDogStatsD(nodeType, nodeID, version, statsdAddr string) error {
+	if statsdAddr == "" {
+		return nil
+	}
+	sink, err := NewDataDogSink(statsdAddr, nodeType, nodeID)
+	if err != nil {
+		return err
+	}
+	initCensusOnce.Do(func() { initCensus(nodeType, nodeID, version) })
+	view.RegisterExporter(sink)
+	glog.Infof("Exporting metrics to DogStatsD at %s", statsdAddr)
+	return nil
+}
+
+// ExportView implements view.Exporter
+func (d *DataDogSink) ExportView(vd *view.Data) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	name := vd.View.Name
+	for _, row := range vd.Rows {
+		tags := ddTags(row)
+		key := name + "|" + strings.Join(tags, ",")
+		last := d.last[key]
+		var err error
+		switch data := row.Data.(type) {
+		case *view.CountData:
+			var prev int64
+			if l, ok := last.(*view.CountData); ok {
+				prev = l.Value
+			}
+			if data.Value > prev {
+				err = d.client.Count(name, data.Value-prev, tags, 1)
+			}
+		case *view.SumData:
+			var prev float64
+			if l, ok := last.(*view.SumData); ok {
+				prev = l.Value
+			}
+			if data.Value > prev {
+				err = d.client.Count(name, int64(data.Value-prev), tags, 1)
+			}
+		case *view.LastValueData:
+			err = d.client.Gauge(name, data.Value, tags, 1)
+		case *view.DistributionData:
+			var prevCount int64
+			var prevSum float64
+			if l, ok := last.(*view.DistributionData); ok {
+				prevCount = l.Count
+				prevSum = l.Mean * float64(l.Count)
+			}
+			if n := data.Count - prevCount; n > 0 {
+				avg := (data.Mean*float64(data.Count) - prevSum) / float64(n)
+				if err = d.client.Count(name+".count", n, tags, 1); err == nil {
+					err = d.client.Gauge(name+".avg", avg, tags, 1)
+				}
+			}
+		}
+		if err != nil {
+			glog.Errorf("Error sending metric %s to DogStatsD: %v", name, err)
+		}
+		d.last[key] = row.Data
+	}
+}
+
+// ddTags converts the row tags to DogStatsD tags. Node tags are already
+// attached to every metric by the client.
+func ddTags(row *view.Row) []string {
+	tags := make([]string, 0, len(row.Tags))
+	for _, t := range row.Tags {
+		k := t.Key.Name()
+		if k == "node_type" || k == "node_id" {
+			continue
+		}
+		tags = append(tags, k+":"+t.Value)
+	}
+	sort.Strings(tags)
+	return tags
+}
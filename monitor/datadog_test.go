@@ -0,0 +1,63 @@
+package monitor
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+)
+
+func readPacket(t *testing.T, conn net.PacketConn) string {
+	buf := make([]byte, 4096)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatal("Error reading DogStatsD payload ", err)
+	}
+	return string(buf[:n])
+}
+
+func TestDataDogSink(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	sink, err := NewDataDogSink(conn.LocalAddr().String(), "bctr", "node1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	kErr, _ := tag.NewKey("error_code")
+	kNodeID, _ := tag.NewKey("node_id")
+	tags := []tag.Tag{{Key: kErr, Value: "Unknown"}, {Key: kNodeID, Value: "node1"}}
+	export := func(name string, data view.AggregationData) string {
+		sink.ExportView(&view.Data{
+			View: &view.View{Name: name},
+			Rows: []*view.Row{&view.Row{Tags: tags, Data: data}},
+		})
+		sink.client.Flush()
+		return readPacket(t, conn)
+	}
+	checkPayload := func(payload, metric string) {
+		if !strings.Contains(payload, metric) {
+			t.Errorf("Expected %s in payload %s", metric, payload)
+		}
+		for _, tg := range []string{"node_type:bctr", "node_id:node1", "error_code:Unknown"} {
+			if !strings.Contains(payload, tg) {
+				t.Errorf("Expected tag %s in payload %s", tg, payload)
+			}
+		}
+	}
+
+	// counts are sent as increments since the last export
+	checkPayload(export("failed_total", &view.CountData{Value: 3}), "livepeer.failed_total:3|c")
+	checkPayload(export("failed_total", &view.CountData{Value: 5}), "livepeer.failed_total:2|c")
+
+	checkPayload(export("sessions_total", &view.LastValueData{Value: 4}), "livepeer.sessions_total:4|g")
+
+	checkPayload(export("latency_seconds", &view.DistributionData{Count: 2, Mean: 1.5}), "livepeer.latency_seconds.count:2|c")
+}
@@ -0,0 +1,83 @@
+package monitor
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+)
+
+type debugAverager struct {
+	Rate       float64 `json:"rate"`
+	HasRate    bool    `json:"hasRate"`
+	WindowSize int     `json:"windowSize"`
+}
+
+type debugState struct {
+	Uptime          string                    `json:"uptime"`
+	PendingSegments map[uint64]int            `json:"pendingSegments"` // nonce : emerged, not yet transcoded
+	Streams         map[uint64]*debugAverager `json:"streams"`
+	SuccessRate     *float64                  `json:"successRate,omitempty"`
+	WatchdogTimeout bool                      `json:"watchdogTimeout"`
+	EventSinks      int                       `json:"eventSinks"`
+	LossRateAlerts  int                       `json:"lossRateAlerts"`
+	PMSessions      int                       `json:"pmSessions"`
+}
+
+// DebugDumpState writes a JSON snapshot of the internal monitor state to w,
+// for troubleshooting. Holds the census lock while the snapshot is taken.
+func (cen *censusMetricsCounter) DebugDumpState(w io.Writer) error {
+	state := cen.debugState()
+	state.WatchdogTimeout = cen.WatchdogTimeout()
+	sinksLock.RLock()
+	state.EventSinks = len(sinks)
+	sinksLock.RUnlock()
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(state)
+}
+
+func (cen *censusMetricsCounter) debugState() *debugState {
+	cen.lock.Lock()
+	defer cen.lock.Unlock()
+	state := &debugState{
+		PendingSegments: make(map[uint64]int, len(cen.emergeTimes)),
+		Streams:         make(map[uint64]*debugAverager, len(cen.success)),
+		LossRateAlerts:  numLossRateAlerts(),
+		PMSessions:      len(cen.pmSessions),
+	}
+	if !cen.startTime.IsZero() {
+		state.Uptime = time.Since(cen.startTime).Round(time.Second).String()
+	}
+	for nonce, emerged := range cen.emergeTimes {
+		state.PendingSegments[nonce] = len(emerged)
+	}
+	var total float64
+	var n int
+	for nonce, avg := range cen.success {
+		rate, has := avg.successRate()
+		state.Streams[nonce] = &debugAverager{
+			Rate:       rate,
+			HasRate:    has,
+			WindowSize: avg.windowSize(),
+		}
+		if has {
+			total += rate
+			n++
+		}
+	}
+	// the aggregate rate is undefined (and not valid JSON) without data
+	if n > 0 {
+		rate := total / float64(n)
+		state.SuccessRate = &rate
+	}
+	return state
+}
+
+// windowSize returns the number of segments currently tracked
+func (sa *segmentsAverager) windowSize() int {
+	if sa.end == -1 {
+		return 0
+	}
+	return (sa.end-sa.start+len(sa.segments))%len(sa.segments) + 1
+}
@@ -0,0 +1,51 @@
+package monitor
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestDebugDumpState(t *testing.T) {
+	census = &censusMetricsCounter{
+		emergeTimes: map[uint64]map[uint64]time.Time{1: {0: time.Now(), 1: time.Now()}},
+		success:     make(map[uint64]*segmentsAverager),
+		startTime:   time.Now().Add(-time.Minute),
+	}
+	census.success[1] = &segmentsAverager{segments: make([]segmentCount, 30), end: -1}
+	census.success[1].addEmerged(0)
+	census.success[1].addTranscoded(0, false)
+	census.success[2] = &segmentsAverager{segments: make([]segmentCount, 30), end: -1}
+
+	var buf bytes.Buffer
+	if err := DebugDumpState(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var state debugState
+	if err := json.Unmarshal(buf.Bytes(), &state); err != nil {
+		t.Fatalf("Invalid JSON %v\n%s", err, buf.String())
+	}
+	if state.PendingSegments[1] != 2 {
+		t.Error("Unexpected pending segments ", state.PendingSegments)
+	}
+	if s := state.Streams[1]; s == nil || !s.HasRate || s.Rate != 1 || s.WindowSize != 1 {
+		t.Error("Unexpected state for stream 1 ", s)
+	}
+	if s := state.Streams[2]; s == nil || s.HasRate || s.WindowSize != 0 {
+		t.Error("Unexpected state for stream 2 ", s)
+	}
+	if state.SuccessRate == nil || *state.SuccessRate != 1 {
+		t.Error("Unexpected aggregate success rate ", state.SuccessRate)
+	}
+	if state.Uptime != "1m0s" {
+		t.Error("Unexpected uptime ", state.Uptime)
+	}
+
+	// no streams with data
+	census = &censusMetricsCounter{}
+	buf.Reset()
+	if err := DebugDumpState(&buf); err != nil {
+		t.Fatal("Expected valid output without data; got ", err)
+	}
+}
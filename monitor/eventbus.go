@@ -0,0 +1,171 @@
+package monitor
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+const (
+	eventBusQueueSize    = 1024
+	webhookClientTimeout = 10 * time.Second
+)
+
+// EventBusSink receives structured node events. Implementations should not
+// block; events that can not be accepted should be dropped and an error
+// returned.
+type EventBusSink interface {
+	EmitEvent(e *Event) error
+}
+
+// RegisterEventBusSink adds a sink that will receive all subsequent node
+// events. Sinks share the registry of RegisterEventSink.
+func RegisterEventBusSink(s EventBusSink) {
+	registerSink(s)
+}
+
+// UnregisterEventBusSink removes a previously registered sink
+func UnregisterEventBusSink(s EventBusSink) {
+	unregisterSink(s)
+}
+
+func hasEventBusSinks() bool {
+	sinksLock.RLock()
+	defer sinksLock.RUnlock()
+	for _, v := range sinks {
+		if _, ok := v.(EventBusSink); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func publishEvent(e *Event) {
+	sinksLock.RLock()
+	defer sinksLock.RUnlock()
+	for _, v := range sinks {
+		s, ok := v.(EventBusSink)
+		if !ok {
+			continue
+		}
+		if err := s.EmitEvent(e); err != nil {
+			glog.V(4).Infof("Dropped event name=%s nonce=%s err=%v", e.Name, e.Nonce, err)
+		}
+	}
+}
+
+// WebhookEventSink POSTs each event as JSON to a URL
+type WebhookEventSink struct {
+	url    string
+	client *http.Client
+	queue  chan *Event
+}
+
+// NewWebhookEventSink creates a sink posting to url and starts its send loop
+func NewWebhookEventSink(url string) *WebhookEventSink {
+	w := &WebhookEventSink{
+		url:    url,
+		client: &http.Client{Timeout: webhookClientTimeout},
+		queue:  make(chan *Event, eventBusQueueSize),
+	}
+	go w.sendLoop()
+	return w
+}
+
+// EmitEvent queues the event without blocking
+func (w *WebhookEventSink) EmitEvent(e *Event) error {
+	select {
+	case w.queue <- e:
+		return nil
+	default:
+		return ErrEventQueueFull
+	}
+}
+
+func (w *WebhookEventSink) sendLoop() {
+	for e := range w.queue {
+		body, err := json.Marshal(e)
+		if err != nil {
+			glog.Error("Error marshaling event ", err)
+			continue
+		}
+		resp, err := w.client.Post(w.url, "application/json", bytes.NewReader(body))
+		if err != nil {
+			glog.Errorf("Error posting event %s to webhook %s: %v", e.Name, w.url, err)
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			glog.Errorf("Error posting event %s to webhook %s: status %d", e.Name, w.url, resp.StatusCode)
+		}
+	}
+}
+
+// FileEventSink appends each event as a line of JSON to a local file
+type FileEventSink struct {
+	file  *os.File
+	queue chan *Event
+	done  chan struct{} // closed once the file is written and closed
+
+	lock   sync.Mutex
+	closed bool
+}
+
+// NewFileEventSink opens path for appending, creating it if needed, and
+// starts the write loop
+func NewFileEventSink(path string) (*FileEventSink, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	f := &FileEventSink{
+		file:  file,
+		queue: make(chan *Event, eventBusQueueSize),
+		done:  make(chan struct{}),
+	}
+	go f.writeLoop()
+	return f, nil
+}
+
+// EmitEvent queues the event without blocking
+func (f *FileEventSink) EmitEvent(e *Event) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.closed {
+		return ErrEventSinkClosed
+	}
+	select {
+	case f.queue <- e:
+		return nil
+	default:
+		return ErrEventQueueFull
+	}
+}
+
+// Close stops accepting events and returns once the queued events are
+// written and the file is closed
+func (f *FileEventSink) Close() {
+	f.lock.Lock()
+	if !f.closed {
+		f.closed = true
+		close(f.queue)
+	}
+	f.lock.Unlock()
+	<-f.done
+}
+
+func (f *FileEventSink) writeLoop() {
+	enc := json.NewEncoder(f.file)
+	for e := range f.queue {
+		if err := enc.Encode(e); err != nil {
+			glog.Errorf("Error writing event %s to %s: %v", e.Name, f.file.Name(), err)
+		}
+	}
+	f.file.Close()
+	close(f.done)
+}
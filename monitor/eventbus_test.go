@@ -0,0 +1,124 @@
+package monitor
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type chanEventSink chan *Event
+
+func (c chanEventSink) EmitEvent(e *Event) error {
+	c <- e
+	return nil
+}
+
+func TestSendPostPublishesToEventBus(t *testing.T) {
+	sink := make(chanEventSink, 1)
+	RegisterEventBusSink(sink)
+	defer UnregisterEventBusSink(sink)
+
+	LogOrchestratorSwapped(7, "https://o1:8935", "https://o2:8935")
+	select {
+	case e := <-sink:
+		if e.Name != "OrchestratorSwapped" || e.Nonce != "7" {
+			t.Error("Unexpected event ", e)
+		}
+		if e.Properties["prev"] != "https://o1:8935" || e.Properties["cur"] != "https://o2:8935" {
+			t.Error("Unexpected properties ", e.Properties)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Event not published")
+	}
+
+	UnregisterEventBusSink(sink)
+	if hasEventBusSinks() {
+		t.Error("Expected no sinks after unregistering")
+	}
+}
+
+func TestRegisterEventBusSinkOnce(t *testing.T) {
+	sink := make(chanEventSink, 2)
+	RegisterEventBusSink(sink)
+	RegisterEventBusSink(sink)
+	defer UnregisterEventBusSink(sink)
+
+	publishEvent(&Event{Name: "StreamStarted", Nonce: "1"})
+	if len(sink) != 1 {
+		t.Error("Expected sink to be registered once; got events ", len(sink))
+	}
+}
+
+func TestWebhookEventSink(t *testing.T) {
+	received := make(chan Event, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var e Event
+		if err := json.NewDecoder(r.Body).Decode(&e); err != nil {
+			t.Error(err)
+		}
+		received <- e
+	}))
+	defer ts.Close()
+
+	sink := NewWebhookEventSink(ts.URL)
+	if err := sink.EmitEvent(&Event{Name: "StreamStarted", Nonce: "1"}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case e := <-received:
+		if e.Name != "StreamStarted" || e.Nonce != "1" {
+			t.Error("Unexpected event ", e)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Webhook not called")
+	}
+}
+
+func TestFileEventSink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "events.jsonl")
+
+	sink, err := NewFileEventSink(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink.EmitEvent(&Event{Name: "StreamStarted", Nonce: "1"})
+	sink.EmitEvent(&Event{Name: "SegmentTranscodeFailed", Nonce: "1", Properties: map[string]interface{}{"reason": "boom"}})
+	sink.Close()
+
+	// closed sinks don't accept events, and Close waits for the file
+	if err := sink.EmitEvent(&Event{Name: "StreamEnded", Nonce: "1"}); err != ErrEventSinkClosed {
+		t.Error("Expected closed sink error; got ", err)
+	}
+	sink.Close()
+	var lines []Event
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e Event
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatal(err)
+		}
+		lines = append(lines, e)
+	}
+	if len(lines) != 2 {
+		t.Fatal("Expected 2 events; got ", lines)
+	}
+	if lines[1].Name != "SegmentTranscodeFailed" || lines[1].Properties["reason"] != "boom" {
+		t.Error("Unexpected event ", lines[1])
+	}
+}
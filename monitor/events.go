@@ -19,14 +19,17 @@ type metricsVars struct {
 	lastSegmentNonce     uint64
 	lastSeqNo            int64
 	segmentsInFlight     int
-	ch                   chan *event
+	ch                   chan *Event
 	nodeType             string
 	nodeID               string
 }
 
-var metrics = metricsVars{ch: make(chan *event, 1024)}
+var metrics = metricsVars{ch: make(chan *Event, 1024)}
 
-type event struct {
+// Event is a structured node event, such as a stream starting or a segment
+// failing to transcode. Events are posted to the monUrl collector and sent to
+// all registered event bus sinks.
+type Event struct {
 	Name       string                 `json:"event"`
 	Nonce      string                 `json:"nonce"`
 	Ts         string                 `json:"ts"`
@@ -42,10 +45,10 @@ func Init(url, nodeType, nodeID, version string) {
 	metrics.nodeID = nodeID
 	metrics.nodeType = nodeType
 	go sendLoop(metrics.ch)
-	initCensus(nodeType, nodeID, version)
+	initCensusOnce.Do(func() { initCensus(nodeType, nodeID, version) })
 }
 
-func sendLoop(inCh chan *event) {
+func sendLoop(inCh chan *Event) {
 	var client = &http.Client{}
 	for {
 		e := <-inCh
@@ -66,7 +69,7 @@ func sendLoop(inCh chan *event) {
 	}
 }
 
-func LogSegmentTranscodeStarting(seqNo uint64, manifestID string) {
+func (cen *censusMetricsCounter) LogSegmentTranscodeStarting(seqNo uint64, manifestID string) {
 	glog.Infof("Logging SegmentTranscodeStarting... seqNo=%d manifestID=%s",
 		seqNo, manifestID)
 
@@ -78,11 +81,11 @@ func LogSegmentTranscodeStarting(seqNo uint64, manifestID string) {
 	sendPost("SegmentTranscodeStarting", 0, props)
 }
 
-func LogSegmentTranscodeEnded(seqNo uint64, manifestID string, d time.Duration,
+func (cen *censusMetricsCounter) LogSegmentTranscodeEnded(seqNo uint64, manifestID string, d time.Duration,
 	profiles string) {
 	glog.Infof("Logging SegmentTranscodeEnded... seqNo=%d manifestID=%s duration=%s",
 		seqNo, manifestID, d)
-	census.segmentTranscoded(0, seqNo, d, 0, profiles)
+	cen.segmentTranscoded(0, seqNo, d, 0, profiles)
 
 	props := map[string]interface{}{
 		"seqNo":      seqNo,
@@ -92,9 +95,11 @@ func LogSegmentTranscodeEnded(seqNo uint64, manifestID string, d time.Duration,
 	sendPost("SegmentTranscodeEnded", 0, props)
 }
 
-func LogStreamCreatedEvent(hlsStrmID string, nonce uint64) {
+func (cen *censusMetricsCounter) LogStreamCreatedEvent(hlsStrmID string, nonce uint64) {
 	glog.Infof("Logging StreamCreated... nonce=%d strid=%s", nonce, hlsStrmID)
-	census.streamCreated(nonce)
+	if err := cen.streamCreated(hlsStrmID, nonce); err != nil {
+		glog.Errorf("Error creating stream nonce=%d strid=%s err=%v", nonce, hlsStrmID, err)
+	}
 
 	props := map[string]interface{}{
 		"hlsStrmID": hlsStrmID,
@@ -103,23 +108,54 @@ func LogStreamCreatedEvent(hlsStrmID string, nonce uint64) {
 	sendPost("StreamCreated", nonce, props)
 }
 
-func LogStreamStartedEvent(nonce uint64) {
+func (cen *censusMetricsCounter) LogStreamStartedEvent(nonce uint64) {
 	glog.Infof("Logging StreamStarted... nonce=%d", nonce)
-	census.streamStarted(nonce)
+	cen.streamStarted(nonce)
 
 	sendPost("StreamStarted", nonce, nil)
 }
 
-func LogStreamEndedEvent(nonce uint64) {
+// LogOrchestratorSwapped records the broadcaster switching the orchestrator
+// transcoding a stream, eg after the previous one failed
+func (cen *censusMetricsCounter) LogOrchestratorSwapped(nonce uint64, prev, cur string) {
+	glog.Infof("Logging OrchestratorSwapped... nonce=%d prev=%s cur=%s", nonce, prev, cur)
+
+	props := map[string]interface{}{
+		"prev": prev,
+		"cur":  cur,
+	}
+
+	sendPost("OrchestratorSwapped", nonce, props)
+}
+
+func (cen *censusMetricsCounter) LogStreamEndedEvent(nonce uint64) {
 	glog.Infof("Logging StreamEnded... nonce=%d", nonce)
-	census.streamEnded(nonce)
+	cen.streamEnded(nonce)
 
 	sendPost("StreamEnded", nonce, nil)
 }
 
-func LogStreamCreateFailed(nonce uint64, reason string) {
+// LogRecordingFinalized sends the location of the VOD playlist written for a
+// recorded stream, or errMsg if it couldn't be written
+func (cen *censusMetricsCounter) LogRecordingFinalized(nonce uint64, manifestID, url, mp4URL string, duration float64, errMsg string) {
+	glog.Infof("Logging RecordingFinalized... nonce=%d manifestID=%s url=%s", nonce, manifestID, url)
+	props := map[string]interface{}{
+		"manifestID": manifestID,
+		"url":        url,
+		"duration":   duration,
+	}
+	if mp4URL != "" {
+		props["mp4URL"] = mp4URL
+	}
+	if errMsg != "" {
+		props["error"] = errMsg
+	}
+	sendPost("RecordingFinalized", nonce, props)
+}
+
+func (cen *censusMetricsCounter) LogStreamCreateFailed(nonce uint64, reason string) {
 	glog.Errorf("Logging StreamCreateFailed... nonce=%d reason='%s'", nonce, reason)
-	census.streamCreateFailed(nonce, reason)
+	cen.streamCreateFailed(nonce, reason)
 
 	props := map[string]interface{}{
 		"reason": reason,
@@ -128,7 +164,7 @@ func LogStreamCreateFailed(nonce uint64, reason string) {
 	sendPost("StreamCreateFailed", nonce, props)
 }
 
-func LogSegmentUploadFailed(nonce, seqNo uint64, code SegmentUploadError, reason string) {
+func (cen *censusMetricsCounter) LogSegmentUploadFailed(nonce, seqNo uint64, code SegmentUploadError, reason string) {
 	if code == SegmentUploadErrorUnknown {
 		if strings.Contains(reason, "Client.Timeout") {
 			code = SegmentUploadErrorTimeout
@@ -138,7 +174,7 @@ func LogSegmentUploadFailed(nonce, seqNo uint64, code SegmentUploadError, reason
 	}
 	glog.Errorf("Logging SegmentUploadFailed... code=%v reason='%s'", code, reason)
 
-	census.segmentUploadFailed(nonce, seqNo, code)
+	cen.segmentUploadFailed(nonce, seqNo, code)
 
 	props := map[string]interface{}{
 		"reason": reason,
@@ -146,11 +182,12 @@ func LogSegmentUploadFailed(nonce, seqNo uint64, code SegmentUploadError, reason
 	}
 
 	sendPost("SegmentUploadFailed", nonce, props)
+	emitSegmentEvent(SegmentEventUploadFailed, nonce, seqNo, "", 0)
 }
 
-func LogTranscodedSegmentAppeared(nonce, seqNo uint64, profile string) {
+func (cen *censusMetricsCounter) LogTranscodedSegmentAppeared(nonce, seqNo uint64, profile string) {
 	glog.Infof("Logging LogTranscodedSegmentAppeared... nonce=%d SeqNo=%d profile=%s", nonce, seqNo, profile)
-	census.segmentTranscodedAppeared(nonce, seqNo, profile)
+	cen.segmentTranscodedAppeared(nonce, seqNo, profile)
 
 	props := map[string]interface{}{
 		"seqNo":   seqNo,
@@ -158,12 +195,13 @@ func LogTranscodedSegmentAppeared(nonce, seqNo uint64, profile string) {
 	}
 
 	sendPost("TranscodedSegmentAppeared", nonce, props)
+	emitSegmentEvent(SegmentEventAppeared, nonce, seqNo, profile, 0)
 }
 
-func LogSourceSegmentAppeared(nonce, seqNo uint64, manifestID, profile string) {
+func (cen *censusMetricsCounter) LogSourceSegmentAppeared(nonce, seqNo uint64, manifestID, profile string) {
 	glog.Infof("Logging LogSourceSegmentAppeared... nonce=%d seqNo=%d manifestid=%s profile=%s", nonce,
 		seqNo, manifestID, profile)
-	census.segmentSourceAppeared(nonce, seqNo, profile)
+	cen.segmentSourceAppeared(nonce, seqNo, profile)
 	props := map[string]interface{}{
 		"seqNo":      seqNo,
 		"profile":    profile,
@@ -173,9 +211,18 @@ func LogSourceSegmentAppeared(nonce, seqNo uint64, manifestID, profile string) {
 	sendPost("SourceSegmentAppeared", nonce, props)
 }
 
-func LogSegmentEmerged(nonce, seqNo uint64, profilesNum int) {
-	glog.Infof("Logging SegmentEmerged... nonce=%d seqNo=%d", nonce, seqNo)
-	census.segmentEmerged(nonce, seqNo, profilesNum)
+// LogSegmentEmerged records a source segment emerging from the segmenter.
+//
+// Deprecated: use LogSegmentEmergedWithSize, which also records the segment size.
+func (cen *censusMetricsCounter) LogSegmentEmerged(nonce, seqNo uint64, profilesNum int) {
+	cen.LogSegmentEmergedWithSize(nonce, seqNo, profilesNum, 0)
+}
+
+// LogSegmentEmergedWithSize records a source segment emerging from the
+// segmenter along with its number of transcode profiles and size in bytes
+func (cen *censusMetricsCounter) LogSegmentEmergedWithSize(nonce, seqNo uint64, profilesNum int, byteSize int64) {
+	glog.Infof("Logging SegmentEmerged... nonce=%d seqNo=%d size=%d", nonce, seqNo, byteSize)
+	cen.segmentEmerged(nonce, seqNo, profilesNum, byteSize)
 
 	var sincePrevious time.Duration
 	now := time.Now()
@@ -191,20 +238,37 @@ func LogSegmentEmerged(nonce, seqNo uint64, profilesNum int) {
 	props := map[string]interface{}{
 		"seqNo":         seqNo,
 		"sincePrevious": uint64(sincePrevious / time.Millisecond),
+		"size":          byteSize,
 	}
 
 	sendPost("SegmentEmerged", nonce, props)
+	emitSegmentEvent(SegmentEventEmerged, nonce, seqNo, "", 0)
 }
 
-func SegmentUploadStart(nonce, seqNo uint64) {
+// LogCodecChange records a change of the source codec parameters mid-stream.
+// Transcode failures of the segment are attributed to SegmentTranscodeErrorCodecChange.
+func (cen *censusMetricsCounter) LogCodecChange(nonce, seqNo uint64, prev, cur string) {
+	glog.Warningf("Logging CodecChange... nonce=%d seqNo=%d prev=%s cur=%s", nonce, seqNo, prev, cur)
+	cen.codecChanged(nonce, seqNo)
+
+	props := map[string]interface{}{
+		"seqNo": seqNo,
+		"prev":  prev,
+		"cur":   cur,
+	}
+
+	sendPost("CodecChange", nonce, props)
+}
+
+func (cen *censusMetricsCounter) SegmentUploadStart(nonce, seqNo uint64) {
 	if metrics.lastSegmentNonce == nonce {
 		metrics.segmentsInFlight++
 	}
 }
 
-func LogSegmentUploaded(nonce, seqNo uint64, uploadDur time.Duration) {
+func (cen *censusMetricsCounter) LogSegmentUploaded(nonce, seqNo uint64, uploadDur time.Duration) {
 	glog.Infof("Logging SegmentUploaded... nonce=%d seqNo=%d uploadduration=%s", nonce, seqNo, uploadDur)
-	census.segmentUploaded(nonce, seqNo, uploadDur)
+	cen.segmentUploaded(nonce, seqNo, uploadDur)
 
 	props := map[string]interface{}{
 		"seqNo":          seqNo,
@@ -212,6 +276,7 @@ func LogSegmentUploaded(nonce, seqNo uint64, uploadDur time.Duration) {
 	}
 
 	sendPost("SegmentUploaded", nonce, props)
+	emitSegmentEvent(SegmentEventUploaded, nonce, seqNo, "", uploadDur)
 }
 
 func detectSeqDif(props map[string]interface{}, nonce, seqNo uint64) {
@@ -224,12 +289,12 @@ func detectSeqDif(props map[string]interface{}, nonce, seqNo uint64) {
 	}
 }
 
-func LogSegmentTranscoded(nonce, seqNo uint64, transcodeDur, totalDur time.Duration,
+func (cen *censusMetricsCounter) LogSegmentTranscoded(nonce, seqNo uint64, transcodeDur, totalDur time.Duration,
 	profiles string) {
 	glog.Infof("Logging SegmentTranscoded... nonce=%d seqNo=%d transcode_duration=%s total_dur=%s",
 		nonce, seqNo, transcodeDur, totalDur)
 
-	census.segmentTranscoded(nonce, seqNo, transcodeDur, totalDur, profiles)
+	cen.segmentTranscoded(nonce, seqNo, transcodeDur, totalDur, profiles)
 
 	if metrics.lastSegmentNonce == nonce {
 		metrics.segmentsInFlight--
@@ -245,12 +310,14 @@ func LogSegmentTranscoded(nonce, seqNo uint64, transcodeDur, totalDur time.Durat
 	detectSeqDif(props, nonce, seqNo)
 
 	sendPost("SegmentTranscoded", nonce, props)
+	emitSegmentEvent(SegmentEventTranscoded, nonce, seqNo, profiles, totalDur)
 }
 
-func LogSegmentTranscodeFailed(subType SegmentTranscodeError, nonce, seqNo uint64, err error) {
+func (cen *censusMetricsCounter) LogSegmentTranscodeFailed(subType SegmentTranscodeError, nonce, seqNo uint64, err error) {
 	glog.Errorf("Logging LogSegmentTranscodeFailed subtype=%v nonce=%d seqNo=%d error='%s'", subType, nonce, seqNo, err.Error())
 
-	census.segmentTranscodeFailed(nonce, seqNo, subType)
+	cen.segmentTranscodeFailed(nonce, seqNo, subType)
+	emitSegmentEvent(SegmentEventTranscodeFailed, nonce, seqNo, "", 0)
 	if err == nil {
 		return
 	}
@@ -272,11 +339,11 @@ func LogSegmentTranscodeFailed(subType SegmentTranscodeError, nonce, seqNo uint6
 }
 
 func sendPost(name string, nonce uint64, props map[string]interface{}) {
-	if eventsURL == "" {
+	if eventsURL == "" && !hasEventBusSinks() {
 		return
 	}
 	ts := time.Now().UnixNano() / int64(time.Millisecond)
-	e := &event{
+	e := &Event{
 		Name:       name,
 		Nonce:      strconv.FormatUint(nonce, 10),
 		Ts:         strconv.FormatInt(ts, 10),
@@ -284,5 +351,8 @@ func sendPost(name string, nonce uint64, props map[string]interface{}) {
 		NodeType:   metrics.nodeType,
 		Properties: props,
 	}
-	metrics.ch <- e
+	if eventsURL != "" {
+		metrics.ch <- e
+	}
+	publishEvent(e)
 }
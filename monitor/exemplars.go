@@ -0,0 +1,120 @@
+package monitor
+
+import (
+	"context"
+	"net/http"
+
+	rprom "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+	"go.opencensus.io/trace"
+)
+
+// Exemplars attaches the trace ID of traced segments as exemplars to the
+// latency histograms in exemplarViews. Must be set before Init, and only has
+// an effect if tracing is enabled.
+var Exemplars bool
+
+// Views exported with exemplars. The OpenCensus Prometheus exporter can't
+// attach exemplars, so these are served by native Prometheus histograms
+// instead of being registered as views.
+var exemplarViews = map[string]bool{
+	"transcode_latency_seconds": true,
+	"upload_time_seconds":       true,
+}
+
+// exemplarHistogram is a Prometheus histogram standing in for a
+// distribution view; label values are taken from the tags in the context.
+type exemplarHistogram struct {
+	vec  *rprom.HistogramVec
+	keys []tag.Key
+}
+
+func newExemplarHistogram(v *view.View) *exemplarHistogram {
+	labels := make([]string, len(v.TagKeys))
+	for i, k := range v.TagKeys {
+		labels[i] = k.Name()
+	}
+	return &exemplarHistogram{
+		vec: rprom.NewHistogramVec(rprom.HistogramOpts{
+			Namespace: "livepeer",
+			Name:      v.Name,
+			Help:      v.Description,
+			Buckets:   v.Aggregation.Buckets,
+		}, labels),
+		keys: v.TagKeys,
+	}
+}
+
+// observe records value, with the trace ID of sc as exemplar if it's valid
+func (h *exemplarHistogram) observe(ctx context.Context, value float64, sc trace.SpanContext) {
+	tags := tag.FromContext(ctx)
+	values := make([]string, len(h.keys))
+	for i, k := range h.keys {
+		if tags != nil {
+			values[i], _ = tags.Value(k)
+		}
+	}
+	obs := h.vec.WithLabelValues(values...)
+	if eo, ok := obs.(rprom.ExemplarObserver); ok && sc.TraceID != (trace.TraceID{}) {
+		eo.ObserveWithExemplar(value, rprom.Labels{"trace_id": sc.TraceID.String()})
+		return
+	}
+	obs.Observe(value)
+}
+
+// splitExemplarViews takes the views served with exemplars out of views and
+// returns the histograms replacing them, keyed by measure name
+func splitExemplarViews(views []*view.View) ([]*view.View, map[string]*exemplarHistogram) {
+	hists := make(map[string]*exemplarHistogram)
+	kept := views[:0]
+	for _, v := range views {
+		if exemplarViews[v.Name] && v.Aggregation.Type == view.AggTypeDistribution {
+			hists[v.Measure.Name()] = newExemplarHistogram(v)
+			continue
+		}
+		kept = append(kept, v)
+	}
+	return kept, hists
+}
+
+// recordLatency records a latency measure of segment seqNo, through its
+// exemplar histogram if there is one. Must be called with cen.lock held.
+func (cen *censusMetricsCounter) recordLatency(ctx context.Context, nonce, seqNo uint64, m *stats.Float64Measure, value float64) {
+	if h, ok := cen.exemplars[m.Name()]; ok {
+		h.observe(ctx, value, cen.segmentTraces[nonce][seqNo])
+		return
+	}
+	stats.Record(ctx, m.M(value))
+}
+
+// LogSegmentTrace remembers the span of a sampled segment so its trace ID can
+// be attached as exemplar to the segment latency metrics
+func (cen *censusMetricsCounter) LogSegmentTrace(nonce, seqNo uint64, sc trace.SpanContext) {
+	if !sc.IsSampled() {
+		return
+	}
+	cen.lock.Lock()
+	defer cen.lock.Unlock()
+	if len(cen.exemplars) == 0 {
+		return
+	}
+	if cen.segmentTraces == nil {
+		cen.segmentTraces = make(map[uint64]map[uint64]trace.SpanContext)
+	}
+	if _, ok := cen.segmentTraces[nonce]; !ok {
+		cen.segmentTraces[nonce] = make(map[uint64]trace.SpanContext)
+	}
+	cen.segmentTraces[nonce][seqNo] = sc
+}
+
+// MetricsHandler serves the Prometheus metrics. When exemplars are enabled
+// the OpenMetrics format is offered, as only that format carries exemplars.
+func MetricsHandler() http.Handler {
+	if len(census.exemplars) == 0 {
+		return Exporter
+	}
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{EnableOpenMetrics: true})
+}
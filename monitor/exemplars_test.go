@@ -0,0 +1,69 @@
+package monitor
+
+import (
+	"context"
+	"testing"
+
+	rprom "github.com/prometheus/client_golang/prometheus"
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+	"go.opencensus.io/trace"
+)
+
+func TestExemplars(t *testing.T) {
+	kNode := tag.MustNewKey("node_id")
+	m := stats.Float64("test_exemplar_latency", "", "sec")
+	views, hists := splitExemplarViews([]*view.View{
+		{Name: "upload_time_seconds", Measure: m, TagKeys: []tag.Key{kNode}, Aggregation: view.Distribution(0, 1, 2)},
+		{Name: "segment_source_emerged_total", Measure: stats.Int64("test_exemplar_emerged", "", "tot"), Aggregation: view.Count()},
+	})
+	if len(views) != 1 || views[0].Name != "segment_source_emerged_total" {
+		t.Fatal("Expected only the exemplar view to be taken out ", views)
+	}
+	if _, ok := hists[m.Name()]; !ok {
+		t.Fatal("Expected a histogram for the exemplar view")
+	}
+
+	cen := &censusMetricsCounter{exemplars: hists}
+	sampled := trace.SpanContext{TraceID: trace.TraceID{1}, TraceOptions: 1}
+	cen.LogSegmentTrace(1, 2, sampled)
+	cen.LogSegmentTrace(1, 3, trace.SpanContext{TraceID: trace.TraceID{2}})
+	if len(cen.segmentTraces[1]) != 1 {
+		t.Error("Expected only the sampled segment to be remembered ", cen.segmentTraces)
+	}
+
+	ctx, err := tag.New(context.Background(), tag.Insert(kNode, "node1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cen.recordLatency(ctx, 1, 2, m, 0.5)
+	cen.recordLatency(ctx, 1, 3, m, 1.5)
+
+	reg := rprom.NewRegistry()
+	reg.MustRegister(hists[m.Name()].vec)
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mfs) != 1 || mfs[0].GetName() != "livepeer_upload_time_seconds" {
+		t.Fatal("Unexpected metric families ", mfs)
+	}
+	metric := mfs[0].GetMetric()[0]
+	if l := metric.GetLabel(); len(l) != 1 || l[0].GetValue() != "node1" {
+		t.Error("Expected the label to be taken from the tags ", l)
+	}
+	h := metric.GetHistogram()
+	if h.GetSampleCount() != 2 {
+		t.Error("Unexpected sample count ", h.GetSampleCount())
+	}
+	var exemplars []string
+	for _, b := range h.GetBucket() {
+		if e := b.GetExemplar(); e != nil {
+			exemplars = append(exemplars, e.GetLabel()[0].GetValue())
+		}
+	}
+	if len(exemplars) != 1 || exemplars[0] != sampled.TraceID.String() {
+		t.Error("Expected the sampled trace ID as only exemplar ", exemplars)
+	}
+}
@@ -0,0 +1,43 @@
+package monitor
+
+import (
+	"strconv"
+	"time"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/tag"
+)
+
+// GPUMetricsInterval is how often GPU stats are polled from NVML
+var GPUMetricsInterval = 10 * time.Second
+
+// GPUStats is a snapshot of the utilization of a single GPU
+type GPUStats struct {
+	Index              int
+	Utilization        uint32 // percent
+	EncoderUtilization uint32 // percent
+	DecoderUtilization uint32 // percent
+	EncoderSessions    int
+	MemoryUsed         uint64 // bytes
+	MemoryTotal        uint64 // bytes
+}
+
+// LogGPUStats records the utilization of each GPU, tagged by device index
+func (cen *censusMetricsCounter) LogGPUStats(gpus []GPUStats) {
+	cen.lock.Lock()
+	defer cen.lock.Unlock()
+	for _, g := range gpus {
+		ctx, err := tag.New(cen.ctx, tag.Insert(cen.kGPU, strconv.Itoa(g.Index)))
+		if err != nil {
+			GetLogger().Error("Error creating context", map[string]interface{}{"gpu": g.Index, "error": err})
+			continue
+		}
+		stats.Record(ctx,
+			cen.mGPUUtilization.M(int64(g.Utilization)),
+			cen.mGPUEncoderUtilization.M(int64(g.EncoderUtilization)),
+			cen.mGPUDecoderUtilization.M(int64(g.DecoderUtilization)),
+			cen.mGPUEncoderSessions.M(int64(g.EncoderSessions)),
+			cen.mGPUMemoryUsed.M(int64(g.MemoryUsed)),
+			cen.mGPUMemoryTotal.M(int64(g.MemoryTotal)))
+	}
+}
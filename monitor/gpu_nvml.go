@@ -0,0 +1,87 @@
+//go:build nvml
+// +build nvml
+
+package monitor
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+)
+
+// InitGPUMetrics starts polling NVML for the utilization of all NVIDIA GPUs
+// on the host. Returns an error if NVML isn't available, eg on hosts without
+// NVIDIA drivers. The returned func stops polling and shuts NVML down.
+func InitGPUMetrics() (func(), error) {
+	if ret := nvml.Init(); ret != nvml.SUCCESS {
+		return nil, fmt.Errorf("error initializing NVML: %s", nvml.ErrorString(ret))
+	}
+	if _, ret := nvml.DeviceGetCount(); ret != nvml.SUCCESS {
+		nvml.Shutdown()
+		return nil, fmt.Errorf("error getting device count: %s", nvml.ErrorString(ret))
+	}
+	quit := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(GPUMetricsInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+			case <-quit:
+				return
+			}
+			gpus, err := nvmlStats()
+			if err != nil {
+				GetLogger().Error("Error polling GPU stats", map[string]interface{}{"error": err})
+				continue
+			}
+			LogGPUStats(gpus)
+		}
+	}()
+	var once sync.Once
+	stop := func() {
+		once.Do(func() {
+			close(quit)
+			<-done
+			nvml.Shutdown()
+		})
+	}
+	return stop, nil
+}
+
+func nvmlStats() ([]GPUStats, error) {
+	count, ret := nvml.DeviceGetCount()
+	if ret != nvml.SUCCESS {
+		return nil, fmt.Errorf("error getting device count: %s", nvml.ErrorString(ret))
+	}
+	gpus := make([]GPUStats, 0, count)
+	for i := 0; i < count; i++ {
+		dev, ret := nvml.DeviceGetHandleByIndex(i)
+		if ret != nvml.SUCCESS {
+			return nil, fmt.Errorf("error getting device %d: %s", i, nvml.ErrorString(ret))
+		}
+		g := GPUStats{Index: i}
+		if util, ret := dev.GetUtilizationRates(); ret == nvml.SUCCESS {
+			g.Utilization = util.Gpu
+		}
+		if util, _, ret := dev.GetEncoderUtilization(); ret == nvml.SUCCESS {
+			g.EncoderUtilization = util
+		}
+		if util, _, ret := dev.GetDecoderUtilization(); ret == nvml.SUCCESS {
+			g.DecoderUtilization = util
+		}
+		if sessions, _, _, ret := dev.GetEncoderStats(); ret == nvml.SUCCESS {
+			g.EncoderSessions = sessions
+		}
+		if mem, ret := dev.GetMemoryInfo(); ret == nvml.SUCCESS {
+			g.MemoryUsed = mem.Used
+			g.MemoryTotal = mem.Total
+		}
+		gpus = append(gpus, g)
+	}
+	return gpus, nil
+}
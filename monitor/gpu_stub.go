@@ -0,0 +1,11 @@
+//go:build !nvml
+// +build !nvml
+
+package monitor
+
+import "errors"
+
+// InitGPUMetrics always fails: this binary was built without the nvml tag
+func InitGPUMetrics() (func(), error) {
+	return nil, errors.New("GPU metrics not supported; rebuild with -tags nvml")
+}
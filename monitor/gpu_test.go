@@ -0,0 +1,67 @@
+package monitor
+
+import (
+	"context"
+	"testing"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+)
+
+func TestLogGPUStats(t *testing.T) {
+	kGPU, _ := tag.NewKey("gpu")
+	census = &censusMetricsCounter{
+		ctx:                    context.Background(),
+		kGPU:                   kGPU,
+		mGPUUtilization:        stats.Int64("test_gpu_utilization", "", "percent"),
+		mGPUEncoderUtilization: stats.Int64("test_gpu_encoder_utilization", "", "percent"),
+		mGPUDecoderUtilization: stats.Int64("test_gpu_decoder_utilization", "", "percent"),
+		mGPUEncoderSessions:    stats.Int64("test_gpu_encoder_sessions", "", "tot"),
+		mGPUMemoryUsed:         stats.Int64("test_gpu_memory_used", "", "By"),
+		mGPUMemoryTotal:        stats.Int64("test_gpu_memory_total", "", "By"),
+	}
+	util := &view.View{
+		Name:        "test_gpu_utilization",
+		Measure:     census.mGPUUtilization,
+		TagKeys:     []tag.Key{kGPU},
+		Aggregation: view.LastValue(),
+	}
+	sessions := &view.View{
+		Name:        "test_gpu_encoder_sessions",
+		Measure:     census.mGPUEncoderSessions,
+		TagKeys:     []tag.Key{kGPU},
+		Aggregation: view.LastValue(),
+	}
+	if err := view.Register(util, sessions); err != nil {
+		t.Fatal(err)
+	}
+	defer view.Unregister(util, sessions)
+
+	LogGPUStats([]GPUStats{
+		{Index: 0, Utilization: 80, EncoderSessions: 3},
+		{Index: 1, Utilization: 10, EncoderSessions: 1},
+	})
+	LogGPUStats([]GPUStats{{Index: 0, Utilization: 60, EncoderSessions: 2}})
+
+	rows, err := view.RetrieveData("test_gpu_utilization")
+	if err != nil || len(rows) != 2 {
+		t.Fatal("Unexpected utilization rows ", rows, err)
+	}
+	expected := map[string]float64{"0": 60, "1": 10}
+	for _, r := range rows {
+		if v := r.Data.(*view.LastValueData).Value; v != expected[r.Tags[0].Value] {
+			t.Errorf("Unexpected utilization %v for gpu %v", v, r.Tags[0].Value)
+		}
+	}
+	rows, err = view.RetrieveData("test_gpu_encoder_sessions")
+	if err != nil || len(rows) != 2 {
+		t.Fatal("Unexpected session rows ", rows, err)
+	}
+	expected = map[string]float64{"0": 2, "1": 1}
+	for _, r := range rows {
+		if v := r.Data.(*view.LastValueData).Value; v != expected[r.Tags[0].Value] {
+			t.Errorf("Unexpected encoder sessions %v for gpu %v", v, r.Tags[0].Value)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package monitor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/golang/glog"
+	kafka "github.com/segmentio/kafka-go"
+)
+
+const (
+	kafkaBatchSize     = 100
+	kafkaBatchInterval = 500 * time.Millisecond
+	kafkaQueueSize     = 1024
+	kafkaWriteTimeout  = 10 * time.Second
+)
+
+// ErrEventQueueFull is returned when an event sink can not accept more events
+var ErrEventQueueFull = errors.New("EventQueueFull")
+
+// ErrEventSinkClosed is returned when an event is emitted to a closed sink
+var ErrEventSinkClosed = errors.New("EventSinkClosed")
+
+// KafkaEventSink batches segment and node events and writes them to a Kafka
+// topic
+type KafkaEventSink struct {
+	writer *kafka.Writer
+	queue  chan kafkaEvent
+}
+
+// kafkaEvent is a queued event along with its message key
+type kafkaEvent struct {
+	key   string
+	value interface{}
+}
+
+// NewKafkaEventSink creates a sink writing to `topic` on the given brokers and
+// starts its flush loop
+func NewKafkaEventSink(brokers []string, topic string) *KafkaEventSink {
+	k := &KafkaEventSink{
+		writer: &kafka.Writer{
+			Addr:         kafka.TCP(brokers...),
+			Topic:        topic,
+			Balancer:     &kafka.Hash{},
+			BatchSize:    kafkaBatchSize,
+			BatchTimeout: kafkaBatchInterval,
+		},
+		queue: make(chan kafkaEvent, kafkaQueueSize),
+	}
+	go k.flushLoop()
+	return k
+}
+
+// EmitSegmentEvent queues the event without blocking
+func (k *KafkaEventSink) EmitSegmentEvent(e SegmentEvent) error {
+	return k.enqueue(kafkaEvent{key: strconv.FormatUint(e.Nonce, 10), value: e})
+}
+
+// EmitEvent queues the event without blocking
+func (k *KafkaEventSink) EmitEvent(e *Event) error {
+	return k.enqueue(kafkaEvent{key: e.Nonce, value: e})
+}
+
+func (k *KafkaEventSink) enqueue(e kafkaEvent) error {
+	select {
+	case k.queue <- e:
+		return nil
+	default:
+		return ErrEventQueueFull
+	}
+}
+
+func (k *KafkaEventSink) flushLoop() {
+	ticker := time.NewTicker(kafkaBatchInterval)
+	defer ticker.Stop()
+	batch := make([]kafka.Message, 0, kafkaBatchSize)
+	for {
+		select {
+		case e := <-k.queue:
+			val, err := json.Marshal(e.value)
+			if err != nil {
+				glog.Error("Error marshaling event ", err)
+				continue
+			}
+			batch = append(batch, kafka.Message{
+				Key:   []byte(e.key),
+				Value: val,
+			})
+			if len(batch) < kafkaBatchSize {
+				continue
+			}
+		case <-ticker.C:
+			if len(batch) == 0 {
+				continue
+			}
+		}
+		k.flush(batch)
+		batch = batch[:0]
+	}
+}
+
+func (k *KafkaEventSink) flush(batch []kafka.Message) {
+	ctx, cancel := context.WithTimeout(context.Background(), kafkaWriteTimeout)
+	defer cancel()
+	if err := k.writer.WriteMessages(ctx, batch...); err != nil {
+		glog.Errorf("Error writing %d events to Kafka: %v", len(batch), err)
+		census.eventsDropped(len(batch))
+	}
+}
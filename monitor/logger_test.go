@@ -0,0 +1,20 @@
+package monitor
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestGlogLine(t *testing.T) {
+	if l := glogLine("msg", nil); l != "msg" {
+		t.Error("Unexpected line ", l)
+	}
+	l := glogLine("Error saving segment", map[string]interface{}{
+		LogFieldSeqNo: uint64(4),
+		LogFieldNonce: uint64(7),
+		"error":       errors.New("boom"),
+	})
+	if l != "Error saving segment error=boom nonce=7 seq_no=4" {
+		t.Error("Unexpected line ", l)
+	}
+}
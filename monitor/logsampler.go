@@ -0,0 +1,116 @@
+package monitor
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// LogSampleInterval is how long repeats of an error logged through
+// SampledLogger are collapsed for. The first occurrence is logged right away
+// and the repeats are summarized with their count once the interval is over.
+// Zero disables sampling.
+var LogSampleInterval = time.Minute
+
+// Fields that differ between repeats of the same error and so are left out
+// when telling errors apart
+var sampleIgnoredFields = map[string]bool{
+	LogFieldNonce: true,
+	LogFieldSeqNo: true,
+	"url":         true,
+	"manifest_id": true,
+}
+
+type sampledError struct {
+	msg      string
+	fields   map[string]interface{}
+	repeated int
+}
+
+// SampledLogger rate limits errors on hot paths, like per segment or
+// discovery errors. Errors with the same message and fields, apart from the
+// ones identifying the segment, are logged once per LogSampleInterval
+// followed by a summary of how many times they repeated. Info and Fatal are
+// passed through.
+type SampledLogger struct {
+	// logger to write to; the one set with SetLogger if nil
+	l Logger
+
+	mu     sync.Mutex
+	errors map[string]*sampledError
+}
+
+var sampledLogger = &SampledLogger{}
+
+// GetSampledLogger returns the sampling logger writing to GetLogger
+func GetSampledLogger() Logger {
+	return sampledLogger
+}
+
+func (s *SampledLogger) logger() Logger {
+	if s.l != nil {
+		return s.l
+	}
+	return GetLogger()
+}
+
+func (s *SampledLogger) Info(msg string, fields map[string]interface{}) {
+	s.logger().Info(msg, fields)
+}
+
+func (s *SampledLogger) Fatal(msg string, fields map[string]interface{}) {
+	s.logger().Fatal(msg, fields)
+}
+
+func (s *SampledLogger) Error(msg string, fields map[string]interface{}) {
+	interval := LogSampleInterval
+	if interval <= 0 {
+		s.logger().Error(msg, fields)
+		return
+	}
+	key := sampleKey(msg, fields)
+	s.mu.Lock()
+	if e, ok := s.errors[key]; ok {
+		e.repeated++
+		s.mu.Unlock()
+		return
+	}
+	if s.errors == nil {
+		s.errors = make(map[string]*sampledError)
+	}
+	s.errors[key] = &sampledError{msg: msg, fields: fields}
+	s.mu.Unlock()
+
+	s.logger().Error(msg, fields)
+	time.AfterFunc(interval, func() { s.flush(key, interval) })
+}
+
+// flush ends the sampling interval of an error, summarizing its repeats
+func (s *SampledLogger) flush(key string, interval time.Duration) {
+	s.mu.Lock()
+	e, ok := s.errors[key]
+	delete(s.errors, key)
+	s.mu.Unlock()
+	if !ok || e.repeated == 0 {
+		return
+	}
+	fields := make(map[string]interface{}, len(e.fields)+2)
+	for k, v := range e.fields {
+		if !sampleIgnoredFields[k] {
+			fields[k] = v
+		}
+	}
+	fields["repeated"] = e.repeated
+	fields["interval"] = interval
+	s.logger().Error(e.msg+" (repeated)", fields)
+}
+
+func sampleKey(msg string, fields map[string]interface{}) string {
+	key := msg
+	for _, k := range sortedKeys(fields) {
+		if !sampleIgnoredFields[k] {
+			key += fmt.Sprintf("\x00%s=%v", k, fields[k])
+		}
+	}
+	return key
+}
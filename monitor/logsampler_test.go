@@ -0,0 +1,70 @@
+package monitor
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+type recordingLogger struct {
+	mu     sync.Mutex
+	msgs   []string
+	fields []map[string]interface{}
+}
+
+func (r *recordingLogger) Info(msg string, fields map[string]interface{})  {}
+func (r *recordingLogger) Fatal(msg string, fields map[string]interface{}) {}
+
+func (r *recordingLogger) Error(msg string, fields map[string]interface{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.msgs = append(r.msgs, msg)
+	r.fields = append(r.fields, fields)
+}
+
+func (r *recordingLogger) lines() ([]string, []map[string]interface{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.msgs...), append([]map[string]interface{}(nil), r.fields...)
+}
+
+func TestSampledLogger(t *testing.T) {
+	defer func(i time.Duration) { LogSampleInterval = i }(LogSampleInterval)
+	LogSampleInterval = 50 * time.Millisecond
+
+	rec := &recordingLogger{}
+	s := &SampledLogger{l: rec}
+	err := errors.New("boom")
+	for i := 0; i < 5; i++ {
+		s.Error("Error saving segment", map[string]interface{}{LogFieldNonce: uint64(1), LogFieldSeqNo: uint64(i), "error": err})
+	}
+	s.Error("Error saving segment", map[string]interface{}{LogFieldNonce: uint64(1), LogFieldSeqNo: uint64(5), "error": errors.New("other")})
+	if msgs, _ := rec.lines(); len(msgs) != 2 {
+		t.Fatal("Expected only the first of each error to be logged ", msgs)
+	}
+
+	time.Sleep(150 * time.Millisecond)
+	msgs, fields := rec.lines()
+	if len(msgs) != 3 || msgs[2] != "Error saving segment (repeated)" {
+		t.Fatal("Expected a summary of the repeated error ", msgs)
+	}
+	if fields[2]["repeated"] != 4 || fields[2]["error"] != err {
+		t.Error("Unexpected summary fields ", fields[2])
+	}
+	if _, ok := fields[2][LogFieldSeqNo]; ok {
+		t.Error("Expected segment fields to be left out of the summary ", fields[2])
+	}
+
+	// a new interval starts once the previous one is over
+	s.Error("Error saving segment", map[string]interface{}{"error": err})
+	if msgs, _ := rec.lines(); len(msgs) != 4 {
+		t.Error("Expected the error to be logged again ", msgs)
+	}
+
+	LogSampleInterval = 0
+	s.Error("Error saving segment", map[string]interface{}{"error": err})
+	if msgs, _ := rec.lines(); len(msgs) != 5 {
+		t.Error("Expected every error to be logged with sampling disabled ", msgs)
+	}
+}
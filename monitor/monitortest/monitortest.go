@@ -0,0 +1,60 @@
+// Package monitortest provides helpers for asserting on monitor events in tests
+package monitortest
+
+import (
+	"sync"
+
+	"github.com/livepeer/go-livepeer/monitor"
+)
+
+// InMemorySink is a monitor.EventSink that keeps every event it receives
+type InMemorySink struct {
+	lock   sync.Mutex
+	events []monitor.SegmentEvent
+}
+
+func NewInMemorySink() *InMemorySink {
+	return &InMemorySink{}
+}
+
+// EmitSegmentEvent implements monitor.EventSink
+func (s *InMemorySink) EmitSegmentEvent(e monitor.SegmentEvent) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.events = append(s.events, e)
+	return nil
+}
+
+// Events returns a copy of the events received so far
+func (s *InMemorySink) Events() []monitor.SegmentEvent {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([]monitor.SegmentEvent{}, s.events...)
+}
+
+// CountByType returns the number of received events of the given type
+func (s *InMemorySink) CountByType(eventType monitor.SegmentEventType) int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	n := 0
+	for _, e := range s.events {
+		if e.EventType == eventType {
+			n++
+		}
+	}
+	return n
+}
+
+// Reset discards all received events
+func (s *InMemorySink) Reset() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.events = nil
+}
+
+// Install registers the sink with the monitor package and returns a
+// function that unregisters it, typically deferred by the test.
+func (s *InMemorySink) Install() func() {
+	monitor.RegisterEventSink(s)
+	return func() { monitor.UnregisterEventSink(s) }
+}
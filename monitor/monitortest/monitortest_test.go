@@ -0,0 +1,38 @@
+package monitortest
+
+import (
+	"testing"
+
+	"github.com/livepeer/go-livepeer/monitor"
+)
+
+func TestInMemorySink(t *testing.T) {
+	s := NewInMemorySink()
+	cleanup := s.Install()
+	defer cleanup()
+
+	s.EmitSegmentEvent(monitor.SegmentEvent{Nonce: 1, SeqNo: 0, EventType: monitor.SegmentEventEmerged})
+	s.EmitSegmentEvent(monitor.SegmentEvent{Nonce: 1, SeqNo: 1, EventType: monitor.SegmentEventEmerged})
+	s.EmitSegmentEvent(monitor.SegmentEvent{Nonce: 1, SeqNo: 0, EventType: monitor.SegmentEventTranscodeFailed})
+
+	if n := len(s.Events()); n != 3 {
+		t.Error("Unexpected number of events ", n)
+	}
+	if n := s.CountByType(monitor.SegmentEventEmerged); n != 2 {
+		t.Error("Unexpected number of emerged events ", n)
+	}
+	if n := s.CountByType(monitor.SegmentEventTranscoded); n != 0 {
+		t.Error("Unexpected number of transcoded events ", n)
+	}
+
+	// returned events are a copy
+	s.Events()[0].SeqNo = 10
+	if s.Events()[0].SeqNo != 0 {
+		t.Error("Events should not be modifiable by callers")
+	}
+
+	s.Reset()
+	if n := len(s.Events()); n != 0 {
+		t.Error("Expected no events after reset; got ", n)
+	}
+}
@@ -0,0 +1,66 @@
+package monitor
+
+import (
+	"context"
+	"time"
+
+	"github.com/golang/glog"
+	"go.opentelemetry.io/otel/attribute"
+	ocbridge "go.opentelemetry.io/otel/bridge/opencensus"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// How often metrics are pushed to the OTLP collector
+var OTLPExportInterval = 15 * time.Second
+
+// InitWithOTLP starts pushing metrics and segment spans to the
+// OpenTelemetry collector at endpoint (host:port) over gRPC. All census views
+// and OpenCensus spans are converted through the OpenCensus bridge; spans are
+// sampled at traceSampleRate and sent to the collector instead of any Jaeger
+// or Zipkin exporter. May be used together with or instead of Init.
+// Returns a function that flushes and stops the exporters.
+func InitWithOTLP(nodeType, nodeID, version, endpoint string, insecure bool, traceSampleRate float64) (func(context.Context) error, error) {
+	metricOpts := []otlpmetricgrpc.Option{otlpmetricgrpc.WithEndpoint(endpoint)}
+	traceOpts := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(endpoint)}
+	if insecure {
+		metricOpts = append(metricOpts, otlpmetricgrpc.WithInsecure())
+		traceOpts = append(traceOpts, otlptracegrpc.WithInsecure())
+	}
+	metricExp, err := otlpmetricgrpc.New(context.Background(), metricOpts...)
+	if err != nil {
+		return nil, err
+	}
+	traceExp, err := otlptracegrpc.New(context.Background(), traceOpts...)
+	if err != nil {
+		return nil, err
+	}
+	initCensusOnce.Do(func() { initCensus(nodeType, nodeID, version) })
+
+	res := resource.NewSchemaless(
+		attribute.String("service.name", "livepeer"),
+		attribute.String("service.version", version),
+		attribute.String("node_type", nodeType),
+		attribute.String("node_id", nodeID),
+	)
+	reader := sdkmetric.NewPeriodicReader(metricExp,
+		sdkmetric.WithInterval(OTLPExportInterval),
+		sdkmetric.WithProducer(ocbridge.NewMetricProducer()))
+	meters := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader), sdkmetric.WithResource(res))
+	tracers := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(traceExp),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(traceSampleRate))))
+	ocbridge.InstallTraceBridge(ocbridge.WithTracerProvider(tracers))
+	glog.Infof("Exporting metrics and traces to OTLP collector at %s", endpoint)
+	return func(ctx context.Context) error {
+		terr := tracers.Shutdown(ctx)
+		if err := meters.Shutdown(ctx); err != nil {
+			return err
+		}
+		return terr
+	}, nil
+}
@@ -0,0 +1,112 @@
+package monitor
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/trace"
+	colmetricpb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"google.golang.org/grpc"
+)
+
+// otlpCollector records the metric and span names exported to it
+type otlpCollector struct {
+	colmetricpb.UnimplementedMetricsServiceServer
+
+	mu      sync.Mutex
+	metrics map[string]bool
+	spans   map[string]map[string]string // span name to its attributes
+}
+
+func (c *otlpCollector) Export(ctx context.Context, req *colmetricpb.ExportMetricsServiceRequest) (*colmetricpb.ExportMetricsServiceResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, rm := range req.ResourceMetrics {
+		for _, sm := range rm.ScopeMetrics {
+			for _, m := range sm.Metrics {
+				c.metrics[m.Name] = true
+			}
+		}
+	}
+	return &colmetricpb.ExportMetricsServiceResponse{}, nil
+}
+
+type otlpTraceCollector struct {
+	coltracepb.UnimplementedTraceServiceServer
+	*otlpCollector
+}
+
+func (c otlpTraceCollector) Export(ctx context.Context, req *coltracepb.ExportTraceServiceRequest) (*coltracepb.ExportTraceServiceResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, rs := range req.ResourceSpans {
+		for _, ss := range rs.ScopeSpans {
+			for _, s := range ss.Spans {
+				attrs := make(map[string]string)
+				for _, kv := range rs.Resource.GetAttributes() {
+					attrs[kv.Key] = kv.Value.GetStringValue()
+				}
+				c.spans[s.Name] = attrs
+			}
+		}
+	}
+	return &coltracepb.ExportTraceServiceResponse{}, nil
+}
+
+func TestInitWithOTLP(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	col := &otlpCollector{metrics: make(map[string]bool), spans: make(map[string]map[string]string)}
+	srv := grpc.NewServer()
+	colmetricpb.RegisterMetricsServiceServer(srv, col)
+	coltracepb.RegisterTraceServiceServer(srv, otlpTraceCollector{otlpCollector: col})
+	go srv.Serve(lis)
+	defer srv.Stop()
+
+	// the bridge replaces the OpenCensus tracer; put it back for other tests
+	defer func(tracer trace.Tracer) { trace.DefaultTracer = tracer }(trace.DefaultTracer)
+	defer func(i time.Duration) { OTLPExportInterval = i }(OTLPExportInterval)
+	OTLPExportInterval = time.Hour
+
+	measure := stats.Int64("otlp_test_total", "Test counter", "tot")
+	v := &view.View{Name: "otlp_test_total", Measure: measure, Aggregation: view.Count()}
+	if err := view.Register(v); err != nil {
+		t.Fatal(err)
+	}
+	defer view.Unregister(v)
+
+	shutdown, err := InitWithOTLP("broadcaster", "node1", "test", lis.Addr().String(), true, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats.Record(context.Background(), measure.M(1))
+	_, span := StartSegmentSpan(context.Background(), "ProcessSegment", 1, 2)
+	span.End()
+
+	// shutting down flushes both exporters
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	col.mu.Lock()
+	defer col.mu.Unlock()
+	if !col.metrics["otlp_test_total"] {
+		t.Error("Expected census view to be exported; got ", col.metrics)
+	}
+	attrs, ok := col.spans["ProcessSegment"]
+	if !ok {
+		t.Fatal("Expected segment span to be exported; got ", col.spans)
+	}
+	if attrs["node_id"] != "node1" || attrs["service.name"] != "livepeer" {
+		t.Error("Unexpected span resource ", attrs)
+	}
+}
@@ -0,0 +1,52 @@
+package monitor
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/golang/glog"
+	rprom "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+)
+
+// InitWithMetricsPush periodically pushes all metrics to the Prometheus
+// Pushgateway at pushURL, for nodes that can't be scraped (eg, behind NAT).
+// headers are added to every push request, typically for authentication.
+// May be used together with or instead of Init.
+func InitWithMetricsPush(nodeType, nodeID, version, pushURL string, interval time.Duration, headers map[string]string) {
+	initCensusOnce.Do(func() { initCensus(nodeType, nodeID, version) })
+	pusher := newPusher(registry, nodeID, pushURL, interval, headers)
+	glog.Infof("Pushing metrics to %s every %v", pushURL, interval)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := pusher.Push(); err != nil {
+				glog.Errorf("Error pushing metrics to %s: %v", pushURL, err)
+			}
+		}
+	}()
+}
+
+// newPusher pushes the metrics of gatherer to pushURL, grouped by node.
+// Every view already carries node_type and node_id labels, which the
+// Pushgateway rejects as grouping labels, so the node ID is the instance.
+func newPusher(gatherer rprom.Gatherer, nodeID, pushURL string, timeout time.Duration, headers map[string]string) *push.Pusher {
+	return push.New(pushURL, "livepeer").
+		Gatherer(gatherer).
+		Grouping("instance", nodeID).
+		Client(&headerClient{client: &http.Client{Timeout: timeout}, headers: headers})
+}
+
+// headerClient adds fixed headers to each request
+type headerClient struct {
+	client  *http.Client
+	headers map[string]string
+}
+
+func (h *headerClient) Do(req *http.Request) (*http.Response, error) {
+	for k, v := range h.headers {
+		req.Header.Set(k, v)
+	}
+	return h.client.Do(req)
+}
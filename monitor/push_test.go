@@ -0,0 +1,84 @@
+package monitor
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	rprom "github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+func TestHeaderClient(t *testing.T) {
+	var auth string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+	}))
+	defer ts.Close()
+
+	hc := &headerClient{client: ts.Client(), headers: map[string]string{"Authorization": "Bearer foo"}}
+	req, _ := http.NewRequest("PUT", ts.URL, nil)
+	resp, err := hc.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if auth != "Bearer foo" {
+		t.Error("Expected auth header to be sent; got ", auth)
+	}
+}
+
+// pushgateway rejects pushes like the Prometheus Pushgateway does when a
+// pushed metric carries one of the grouping labels, and records the path of
+// accepted pushes
+func pushgateway(paths *[]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		grouping := make(map[string]bool)
+		parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/metrics/"), "/")
+		for i := 0; i+1 < len(parts); i += 2 {
+			grouping[parts[i]] = true
+		}
+		dec := expfmt.NewDecoder(r.Body, expfmt.ResponseFormat(r.Header))
+		for {
+			var mf dto.MetricFamily
+			if err := dec.Decode(&mf); err == io.EOF {
+				break
+			} else if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			for _, m := range mf.GetMetric() {
+				for _, l := range m.GetLabel() {
+					if grouping[l.GetName()] {
+						http.Error(w, "pushed metrics must not have grouping label "+l.GetName(), http.StatusBadRequest)
+						return
+					}
+				}
+			}
+		}
+		*paths = append(*paths, r.URL.Path)
+	}))
+}
+
+func TestPusher(t *testing.T) {
+	var paths []string
+	ts := pushgateway(&paths)
+	defer ts.Close()
+
+	// metrics labelled like the census views
+	reg := rprom.NewRegistry()
+	g := rprom.NewGaugeVec(rprom.GaugeOpts{Name: "livepeer_test"}, []string{"node_type", "node_id"})
+	g.WithLabelValues("bctr", "node1").Set(1)
+	reg.MustRegister(g)
+
+	if err := newPusher(reg, "node1", ts.URL, time.Second, nil).Push(); err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) != 1 || paths[0] != "/metrics/job/livepeer/instance/node1" {
+		t.Error("Unexpected pushes ", paths)
+	}
+}
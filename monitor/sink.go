@@ -0,0 +1,102 @@
+package monitor
+
+import (
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// SegmentEventType is the kind of segment event emitted to event sinks
+type SegmentEventType string
+
+const (
+	SegmentEventEmerged         SegmentEventType = "emerged"
+	SegmentEventUploaded        SegmentEventType = "uploaded"
+	SegmentEventUploadFailed    SegmentEventType = "upload_failed"
+	SegmentEventTranscoded      SegmentEventType = "transcoded"
+	SegmentEventTranscodeFailed SegmentEventType = "transcode_failed"
+	SegmentEventAppeared        SegmentEventType = "appeared"
+)
+
+// SegmentEvent is a single segment-level event emitted to event sinks
+type SegmentEvent struct {
+	Nonce     uint64           `json:"nonce"`
+	SeqNo     uint64           `json:"seqNo"`
+	Profile   string           `json:"profile,omitempty"`
+	EventType SegmentEventType `json:"eventType"`
+	Latency   time.Duration    `json:"latency"`
+	Timestamp time.Time        `json:"timestamp"`
+}
+
+// EventSink receives segment events. Implementations should not block;
+// events that can not be accepted should be dropped and an error returned.
+type EventSink interface {
+	EmitSegmentEvent(e SegmentEvent) error
+}
+
+// Registered sinks; each is an EventSink, an EventBusSink or both
+var (
+	sinks     []interface{}
+	sinksLock sync.RWMutex
+)
+
+// RegisterEventSink adds a sink that will receive all subsequent segment
+// events. Sinks are registered once: a sink that is also an EventBusSink
+// receives node events as well.
+func RegisterEventSink(s EventSink) {
+	registerSink(s)
+}
+
+// UnregisterEventSink removes a previously registered sink
+func UnregisterEventSink(s EventSink) {
+	unregisterSink(s)
+}
+
+func registerSink(s interface{}) {
+	sinksLock.Lock()
+	defer sinksLock.Unlock()
+	for _, v := range sinks {
+		if v == s {
+			return
+		}
+	}
+	sinks = append(sinks, s)
+}
+
+func unregisterSink(s interface{}) {
+	sinksLock.Lock()
+	defer sinksLock.Unlock()
+	for i, v := range sinks {
+		if v == s {
+			sinks = append(sinks[:i:i], sinks[i+1:]...)
+			return
+		}
+	}
+}
+
+func emitSegmentEvent(eventType SegmentEventType, nonce, seqNo uint64, profile string, latency time.Duration) {
+	sinksLock.RLock()
+	defer sinksLock.RUnlock()
+	if len(sinks) == 0 {
+		return
+	}
+	e := SegmentEvent{
+		Nonce:     nonce,
+		SeqNo:     seqNo,
+		Profile:   profile,
+		EventType: eventType,
+		Latency:   latency,
+		Timestamp: time.Now(),
+	}
+	for _, v := range sinks {
+		s, ok := v.(EventSink)
+		if !ok {
+			continue
+		}
+		if err := s.EmitSegmentEvent(e); err != nil {
+			glog.V(4).Infof("Dropped segment event type=%s nonce=%d seqNo=%d err=%v", eventType, nonce, seqNo, err)
+			census.eventsDropped(1)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package monitor
+
+import (
+	"sort"
+	"time"
+
+	"go.opencensus.io/stats/view"
+)
+
+// ViewSnapshot is the current value of a view, aggregated over all its tag
+// values: counts and sums are added up, last values are averaged and
+// distributions are merged
+type ViewSnapshot struct {
+	Name        string  `json:"name"`
+	Description string  `json:"description"`
+	Value       float64 `json:"value"`           // mean for distributions
+	Count       int64   `json:"count,omitempty"` // distributions only
+	P50         float64 `json:"p50,omitempty"`   // distributions only
+	P95         float64 `json:"p95,omitempty"`   // distributions only
+}
+
+// MetricsSnapshot is a point in time summary of the registered census views
+type MetricsSnapshot struct {
+	Time  time.Time       `json:"time"`
+	Views []*ViewSnapshot `json:"views"`
+}
+
+// Find returns the snapshot of the named view, or nil if it has no data
+func (s *MetricsSnapshot) Find(name string) *ViewSnapshot {
+	for _, v := range s.Views {
+		if v.Name == name {
+			return v
+		}
+	}
+	return nil
+}
+
+// GetMetricsSnapshot reads the data of all registered views that have any,
+// ordered by view name
+func GetMetricsSnapshot() *MetricsSnapshot {
+	viewGroupsLock.Lock()
+	views := make([]*view.View, len(allViews))
+	copy(views, allViews)
+	viewGroupsLock.Unlock()
+
+	res := &MetricsSnapshot{Time: time.Now()}
+	for _, v := range views {
+		if view.Find(v.Name) == nil {
+			continue
+		}
+		rows, err := view.RetrieveData(v.Name)
+		if err != nil || len(rows) == 0 {
+			continue
+		}
+		res.Views = append(res.Views, snapshotView(v, rows))
+	}
+	sort.Slice(res.Views, func(i, j int) bool { return res.Views[i].Name < res.Views[j].Name })
+	return res
+}
+
+func snapshotView(v *view.View, rows []*view.Row) *ViewSnapshot {
+	vs := &ViewSnapshot{Name: v.Name, Description: v.Description}
+	var counts []int64
+	var sum float64
+	for _, r := range rows {
+		switch d := r.Data.(type) {
+		case *view.CountData:
+			vs.Value += float64(d.Value)
+		case *view.SumData:
+			vs.Value += d.Value
+		case *view.LastValueData:
+			vs.Value += d.Value / float64(len(rows))
+		case *view.DistributionData:
+			vs.Count += d.Count
+			sum += d.Mean * float64(d.Count)
+			if counts == nil {
+				counts = make([]int64, len(d.CountPerBucket))
+			}
+			for i, c := range d.CountPerBucket {
+				if i < len(counts) {
+					counts[i] += c
+				}
+			}
+		}
+	}
+	if vs.Count > 0 {
+		vs.Value = sum / float64(vs.Count)
+		vs.P50 = bucketQuantile(v.Aggregation.Buckets, counts, 0.5)
+		vs.P95 = bucketQuantile(v.Aggregation.Buckets, counts, 0.95)
+	}
+	return vs
+}
+
+// bucketQuantile estimates quantile q as the upper bound of the bucket it
+// falls in. Samples above the last bound are reported as the last bound.
+func bucketQuantile(bounds []float64, counts []int64, q float64) float64 {
+	// OpenCensus drops non-positive bounds, leaving one bucket per bound
+	// plus one for the samples above them
+	for len(bounds) > 0 && len(bounds)+1 > len(counts) {
+		bounds = bounds[1:]
+	}
+	if len(bounds) == 0 {
+		return 0
+	}
+	var total int64
+	for _, c := range counts {
+		total += c
+	}
+	rank := q * float64(total)
+	var seen int64
+	for i, c := range counts {
+		seen += c
+		if float64(seen) >= rank {
+			if i < len(bounds) {
+				return bounds[i]
+			}
+			break
+		}
+	}
+	return bounds[len(bounds)-1]
+}
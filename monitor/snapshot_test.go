@@ -0,0 +1,50 @@
+package monitor
+
+import (
+	"testing"
+
+	"go.opencensus.io/stats/view"
+)
+
+func TestBucketQuantile(t *testing.T) {
+	bounds := []float64{1, 2, 4}
+	counts := []int64{50, 40, 5, 5}
+	if q := bucketQuantile(bounds, counts, 0.5); q != 1 {
+		t.Error("Unexpected p50 ", q)
+	}
+	if q := bucketQuantile(bounds, counts, 0.95); q != 4 {
+		t.Error("Unexpected p95 ", q)
+	}
+	// samples above the last bound are reported as the last bound
+	if q := bucketQuantile(bounds, counts, 0.99); q != 4 {
+		t.Error("Unexpected p99 ", q)
+	}
+	// a dropped zero bound is skipped
+	if q := bucketQuantile([]float64{0, 1, 2, 4}, counts, 0.5); q != 1 {
+		t.Error("Unexpected p50 with a zero bound ", q)
+	}
+}
+
+func TestSnapshotView(t *testing.T) {
+	v := &view.View{Name: "test_snapshot", Aggregation: view.Distribution(1, 2)}
+	rows := []*view.Row{
+		{Data: &view.DistributionData{Count: 2, Mean: 0.5, CountPerBucket: []int64{2, 0, 0}}},
+		{Data: &view.DistributionData{Count: 2, Mean: 1.5, CountPerBucket: []int64{0, 2, 0}}},
+	}
+	vs := snapshotView(v, rows)
+	if vs.Count != 4 || vs.Value != 1 || vs.P50 != 1 || vs.P95 != 2 {
+		t.Error("Unexpected distribution snapshot ", vs)
+	}
+
+	v = &view.View{Name: "test_snapshot_count", Aggregation: view.Count()}
+	rows = []*view.Row{{Data: &view.CountData{Value: 3}}, {Data: &view.CountData{Value: 4}}}
+	if vs := snapshotView(v, rows); vs.Value != 7 || vs.Count != 0 {
+		t.Error("Unexpected count snapshot ", vs)
+	}
+
+	v = &view.View{Name: "test_snapshot_last", Aggregation: view.LastValue()}
+	rows = []*view.Row{{Data: &view.LastValueData{Value: 0.5}}, {Data: &view.LastValueData{Value: 1}}}
+	if vs := snapshotView(v, rows); vs.Value != 0.75 {
+		t.Error("Unexpected last value snapshot ", vs)
+	}
+}
@@ -0,0 +1,158 @@
+package monitor
+
+import (
+	"math/big"
+	"sort"
+	"time"
+)
+
+// StreamStats are the live statistics of a single stream
+type StreamStats struct {
+	Nonce              uint64   `json:"nonce"`
+	ManifestID         string   `json:"manifestID,omitempty"`
+	SegmentsEmerged    int64    `json:"segmentsEmerged"`
+	SegmentsTranscoded int64    `json:"segmentsTranscoded"`
+	SegmentsFailed     int64    `json:"segmentsFailed"`
+	SuccessRate        *float64 `json:"successRate,omitempty"`
+	AvgLatency         float64  `json:"avgLatencySeconds"` // emerged till all renditions appeared
+}
+
+// StreamSummary describes a stream once it has ended
+type StreamSummary struct {
+	Nonce              uint64
+	ManifestID         string
+	Started            time.Time
+	Ended              time.Time
+	SegmentsEmerged    int64
+	SegmentsTranscoded int64
+	SegmentsFailed     int64
+	AvgLatency         float64 // seconds
+	Orchestrators      []string
+	FeesSent           *big.Int // face value of the tickets sent
+}
+
+type streamCounts struct {
+	emerged, transcoded, failed int64
+	latency                     time.Duration // total over transcoded segments
+	started                     time.Time
+	orchestrators               map[string]bool
+	pmSessions                  map[string]bool
+	labels                      map[string]string // allowed stream labels
+}
+
+var streamEndedHandler func(s *StreamSummary)
+
+// SetStreamEndedHandler sets the function that is called with the summary of
+// each stream when it ends, eg to persist it. Called from a new goroutine.
+func SetStreamEndedHandler(h func(s *StreamSummary)) {
+	census.lock.Lock()
+	defer census.lock.Unlock()
+	streamEndedHandler = h
+}
+
+// LogStreamSession records the orchestrator, and the PM session paying it,
+// that a segment of the stream was submitted to
+func (cen *censusMetricsCounter) LogStreamSession(nonce uint64, orchestrator, pmSessionID string) {
+	cen.lock.Lock()
+	defer cen.lock.Unlock()
+	sc := cen.stream(nonce)
+	if sc.orchestrators == nil {
+		sc.orchestrators = make(map[string]bool)
+		sc.pmSessions = make(map[string]bool)
+	}
+	sc.orchestrators[orchestrator] = true
+	if pmSessionID != "" {
+		sc.pmSessions[pmSessionID] = true
+	}
+}
+
+// streamSummary summarizes a stream and forgets the fees of its PM sessions.
+// Must be called with cen.lock held.
+func (cen *censusMetricsCounter) streamSummary(nonce uint64) *StreamSummary {
+	sc := cen.stream(nonce)
+	s := &StreamSummary{
+		Nonce:              nonce,
+		ManifestID:         cen.manifests[nonce],
+		Started:            sc.started,
+		Ended:              time.Now(),
+		SegmentsEmerged:    sc.emerged,
+		SegmentsTranscoded: sc.transcoded,
+		SegmentsFailed:     sc.failed,
+		FeesSent:           new(big.Int),
+	}
+	if sc.transcoded > 0 {
+		s.AvgLatency = sc.latency.Seconds() / float64(sc.transcoded)
+	}
+	for o := range sc.orchestrators {
+		s.Orchestrators = append(s.Orchestrators, o)
+	}
+	sort.Strings(s.Orchestrators)
+	for id := range sc.pmSessions {
+		if fees, ok := cen.pmFees[id]; ok {
+			s.FeesSent.Add(s.FeesSent, fees)
+			delete(cen.pmFees, id)
+		}
+	}
+	return s
+}
+
+// stream returns the counters of a stream, creating them if needed.
+// Must be called with cen.lock held.
+// LogStreamLabels sets the labels of a stream. Labels not in StreamLabels,
+// or whose value can't be a tag value, are dropped.
+func (cen *censusMetricsCounter) LogStreamLabels(nonce uint64, labels map[string]string) {
+	cen.lock.Lock()
+	defer cen.lock.Unlock()
+	allowed := make(map[string]string)
+	for _, k := range cen.kStreamLabels {
+		v, ok := labels[k.Name()]
+		if !ok {
+			continue
+		}
+		if !validTagValue(v) {
+			GetLogger().Error("Invalid stream label", map[string]interface{}{LogFieldNonce: nonce, "label": k.Name()})
+			continue
+		}
+		allowed[k.Name()] = v
+	}
+	cen.stream(nonce).labels = allowed
+}
+
+func (cen *censusMetricsCounter) stream(nonce uint64) *streamCounts {
+	if cen.streams == nil {
+		cen.streams = make(map[uint64]*streamCounts)
+	}
+	sc, ok := cen.streams[nonce]
+	if !ok {
+		sc = &streamCounts{}
+		cen.streams[nonce] = sc
+	}
+	return sc
+}
+
+// GetStreamStats returns the statistics of all active streams, ordered by nonce
+func (cen *censusMetricsCounter) GetStreamStats() []StreamStats {
+	cen.lock.Lock()
+	defer cen.lock.Unlock()
+	res := make([]StreamStats, 0, len(cen.streams))
+	for nonce, sc := range cen.streams {
+		st := StreamStats{
+			Nonce:              nonce,
+			ManifestID:         cen.manifests[nonce],
+			SegmentsEmerged:    sc.emerged,
+			SegmentsTranscoded: sc.transcoded,
+			SegmentsFailed:     sc.failed,
+		}
+		if sc.transcoded > 0 {
+			st.AvgLatency = sc.latency.Seconds() / float64(sc.transcoded)
+		}
+		if avg, ok := cen.success[nonce]; ok {
+			if r, has := avg.successRate(); has {
+				st.SuccessRate = &r
+			}
+		}
+		res = append(res, st)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Nonce < res[j].Nonce })
+	return res
+}
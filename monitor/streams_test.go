@@ -0,0 +1,92 @@
+package monitor
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/tag"
+)
+
+func TestGetStreamStats(t *testing.T) {
+	census = &censusMetricsCounter{
+		emergeTimes: make(map[uint64]map[uint64]time.Time),
+		success:     make(map[uint64]*segmentsAverager),
+		manifests:   map[uint64]string{2: "mid2"},
+	}
+	census.stream(2).emerged = 3
+	census.stream(2).transcoded = 2
+	census.stream(2).failed = 1
+	census.stream(2).latency = 3 * time.Second
+	census.stream(1).emerged = 1
+	census.success[2] = &segmentsAverager{segments: make([]segmentCount, 30), end: -1}
+	census.success[2].addEmerged(0)
+	census.success[2].addTranscoded(0, false)
+
+	st := GetStreamStats()
+	if len(st) != 2 || st[0].Nonce != 1 || st[1].Nonce != 2 {
+		t.Fatal("Unexpected streams ", st)
+	}
+	if st[0].SuccessRate != nil || st[0].AvgLatency != 0 {
+		t.Error("Unexpected stats for stream without transcoded segments ", st[0])
+	}
+	s := st[1]
+	if s.ManifestID != "mid2" || s.SegmentsEmerged != 3 || s.SegmentsTranscoded != 2 || s.SegmentsFailed != 1 {
+		t.Error("Unexpected counts ", s)
+	}
+	if s.AvgLatency != 1.5 {
+		t.Error("Unexpected average latency ", s.AvgLatency)
+	}
+	if s.SuccessRate == nil || *s.SuccessRate != 1 {
+		t.Error("Unexpected success rate ", s.SuccessRate)
+	}
+}
+
+func TestStreamSummary(t *testing.T) {
+	kOrchestrator, _ := tag.NewKey("orchestrator")
+	kRecipient, _ := tag.NewKey("recipient")
+	census = &censusMetricsCounter{
+		kOrchestrator:        kOrchestrator,
+		kRecipient:           kRecipient,
+		ctx:                  context.Background(),
+		manifests:            map[uint64]string{1: "mid1"},
+		pmSessions:           make(map[string]string),
+		mStreamEnded:         stats.Int64("test_summary_stream_ended", "", "tot"),
+		mTicketFaceValueSent: stats.Float64("test_summary_face_value_sent", "", "wei"),
+	}
+	summaries := make(chan *StreamSummary, 1)
+	SetStreamEndedHandler(func(s *StreamSummary) { summaries <- s })
+	defer SetStreamEndedHandler(nil)
+
+	census.stream(1).emerged = 2
+	census.stream(1).transcoded = 2
+	census.stream(1).latency = 3 * time.Second
+	LogStreamSession(1, "https://o2:8935", "s2")
+	LogStreamSession(1, "https://o1:8935", "s1")
+	LogStreamSession(1, "https://o1:8935", "s1")
+	LogTicketSent("s1", "0x1", big.NewInt(100))
+	LogTicketSent("s2", "0x2", big.NewInt(50))
+	LogTicketSent("other", "0x3", big.NewInt(1000))
+
+	census.streamEnded(1)
+	var s *StreamSummary
+	select {
+	case s = <-summaries:
+	case <-time.After(time.Second):
+		t.Fatal("Stream ended handler not called")
+	}
+	if s.ManifestID != "mid1" || s.SegmentsTranscoded != 2 || s.AvgLatency != 1.5 {
+		t.Error("Unexpected summary ", s)
+	}
+	if len(s.Orchestrators) != 2 || s.Orchestrators[0] != "https://o1:8935" || s.Orchestrators[1] != "https://o2:8935" {
+		t.Error("Unexpected orchestrators ", s.Orchestrators)
+	}
+	if s.FeesSent.Cmp(big.NewInt(150)) != 0 {
+		t.Error("Unexpected fees ", s.FeesSent)
+	}
+	if _, ok := census.pmFees["s1"]; ok {
+		t.Error("Fees of the ended stream were not forgotten")
+	}
+}
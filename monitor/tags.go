@@ -0,0 +1,104 @@
+package monitor
+
+import (
+	"fmt"
+	"regexp"
+
+	"go.opencensus.io/tag"
+)
+
+// OptionalTags are the tag keys that may be removed from views to limit
+// metrics cardinality
+var OptionalTags = []string{"node_id", "profiles", "error_code"}
+
+// DisabledTags holds the names of optional tag keys to remove from all views.
+// Must be set before Init; see SetTagFilter.
+var DisabledTags map[string]bool
+
+// SetTagFilter configures which optional tags are attached to views. Tags in
+// disabled are dropped. If allowed is non-empty, only the optional tags it
+// lists are kept. Returns an error for tag names that aren't optional.
+func SetTagFilter(disabled, allowed []string) error {
+	optional := make(map[string]bool)
+	for _, k := range OptionalTags {
+		optional[k] = true
+	}
+	res := make(map[string]bool)
+	for _, k := range disabled {
+		if !optional[k] {
+			return fmt.Errorf("tag %q can not be disabled; expected one of %v", k, OptionalTags)
+		}
+		res[k] = true
+	}
+	if len(allowed) > 0 {
+		keep := make(map[string]bool)
+		for _, k := range allowed {
+			if !optional[k] {
+				return fmt.Errorf("unknown optional tag %q; expected one of %v", k, OptionalTags)
+			}
+			keep[k] = true
+		}
+		for _, k := range OptionalTags {
+			if !keep[k] {
+				res[k] = true
+			}
+		}
+	}
+	DisabledTags = res
+	return nil
+}
+
+// filterTagKeys returns keys without the disabled tags. Always returns a new
+// slice since views share their underlying tag arrays.
+func filterTagKeys(keys []tag.Key) []tag.Key {
+	res := make([]tag.Key, 0, len(keys))
+	for _, k := range keys {
+		if !DisabledTags[k.Name()] {
+			res = append(res, k)
+		}
+	}
+	return res
+}
+
+// StreamLabels holds the names of the stream labels added as tags to
+// per-stream views; other labels of a stream are dropped. Must be set before
+// Init; see SetStreamLabels.
+var StreamLabels []string
+
+// Names of the tags the census itself sets, which stream labels can't shadow
+var builtinTags = map[string]bool{
+	"node_type": true, "node_id": true, "profile": true, "profiles": true,
+	"error_code": true, "orchestrator": true, "manifest_id": true, "sender": true,
+	"recipient": true, "gpu": true, "driver": true, "operation": true, "direction": true,
+}
+
+var labelNameRE = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// SetStreamLabels allows the given stream labels as tags. Returns an error for
+// names that aren't valid Prometheus label names or clash with built-in tags.
+func SetStreamLabels(names []string) error {
+	for _, n := range names {
+		if !labelNameRE.MatchString(n) {
+			return fmt.Errorf("invalid stream label %q", n)
+		}
+		if builtinTags[n] {
+			return fmt.Errorf("stream label %q clashes with a built-in tag", n)
+		}
+	}
+	StreamLabels = names
+	return nil
+}
+
+// validTagValue reports whether v can be used as a tag value: at most 255
+// printable ASCII characters
+func validTagValue(v string) bool {
+	if len(v) > 255 {
+		return false
+	}
+	for _, c := range v {
+		if c < 0x20 || c > 0x7e {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,94 @@
+package monitor
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"go.opencensus.io/tag"
+)
+
+func TestSetTagFilter(t *testing.T) {
+	defer func() { DisabledTags = nil }()
+
+	if err := SetTagFilter([]string{"node_id"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if !DisabledTags["node_id"] || DisabledTags["profiles"] || DisabledTags["error_code"] {
+		t.Error("Unexpected disabled tags ", DisabledTags)
+	}
+
+	if err := SetTagFilter(nil, []string{"error_code"}); err != nil {
+		t.Fatal(err)
+	}
+	if !DisabledTags["node_id"] || !DisabledTags["profiles"] || DisabledTags["error_code"] {
+		t.Error("Unexpected disabled tags ", DisabledTags)
+	}
+
+	if err := SetTagFilter([]string{"node_type"}, nil); err == nil {
+		t.Error("Expected error disabling a required tag")
+	}
+	if err := SetTagFilter(nil, []string{"foo"}); err == nil {
+		t.Error("Expected error allowing an unknown tag")
+	}
+}
+
+func TestFilterTagKeys(t *testing.T) {
+	defer func() { DisabledTags = nil }()
+	kNodeID, _ := tag.NewKey("node_id")
+	kNodeType, _ := tag.NewKey("node_type")
+	kProfiles, _ := tag.NewKey("profiles")
+	keys := []tag.Key{kProfiles, kNodeID, kNodeType}
+
+	DisabledTags = map[string]bool{"node_id": true}
+	res := filterTagKeys(keys)
+	if len(res) != 2 || res[0] != kProfiles || res[1] != kNodeType {
+		t.Error("Unexpected keys ", res)
+	}
+	if len(keys) != 3 || keys[1] != kNodeID {
+		t.Error("Input keys were modified ", keys)
+	}
+
+	DisabledTags = nil
+	if res := filterTagKeys(keys); len(res) != 3 {
+		t.Error("Unexpected keys ", res)
+	}
+}
+
+func TestSetStreamLabels(t *testing.T) {
+	defer func() { StreamLabels = nil }()
+	if err := SetStreamLabels([]string{"tenant", "region_1"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(StreamLabels) != 2 {
+		t.Error("Unexpected stream labels ", StreamLabels)
+	}
+	if err := SetStreamLabels([]string{"1tenant"}); err == nil {
+		t.Error("Expected error for an invalid label name")
+	}
+	if err := SetStreamLabels([]string{"manifest_id"}); err == nil {
+		t.Error("Expected error for a label clashing with a built-in tag")
+	}
+}
+
+func TestStreamLabelsCtx(t *testing.T) {
+	kTenant, _ := tag.NewKey("tenant")
+	cen := &censusMetricsCounter{kStreamLabels: []tag.Key{kTenant}}
+	cen.LogStreamLabels(1, map[string]string{"tenant": "acme", "region": "eu"})
+	cen.LogStreamLabels(2, map[string]string{"tenant": strings.Repeat("x", 256)})
+
+	if labels := cen.streams[1].labels; len(labels) != 1 || labels["tenant"] != "acme" {
+		t.Error("Expected only the allowed labels ", labels)
+	}
+	if labels := cen.streams[2].labels; len(labels) != 0 {
+		t.Error("Expected invalid label values to be dropped ", labels)
+	}
+
+	ctx := cen.streamCtx(context.Background(), 1)
+	if v, ok := tag.FromContext(ctx).Value(kTenant); !ok || v != "acme" {
+		t.Error("Expected the stream label as tag ", v)
+	}
+	if ctx := cen.streamCtx(context.Background(), 3); tag.FromContext(ctx) != nil {
+		t.Error("Expected no tags for an unknown stream")
+	}
+}
@@ -0,0 +1,92 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"contrib.go.opencensus.io/exporter/jaeger"
+	"contrib.go.opencensus.io/exporter/zipkin"
+	openzipkin "github.com/openzipkin/zipkin-go"
+	zipkinhttp "github.com/openzipkin/zipkin-go/reporter/http"
+	"go.opencensus.io/plugin/ochttp/propagation/tracecontext"
+	"go.opencensus.io/trace"
+)
+
+// TracePropagation is the format used to carry the trace context in the
+// broadcaster to orchestrator HTTP requests
+var TracePropagation = &tracecontext.HTTPFormat{}
+
+// Span attribute keys for segment spans
+const (
+	SpanAttrNonce   = "nonce"
+	SpanAttrSeqNo   = "seq_no"
+	SpanAttrProfile = "profile"
+	SpanAttrNodeID  = "node_id"
+)
+
+// InitTracing exports spans to Jaeger and/or Zipkin, sampling the given
+// fraction of segments. Either endpoint may be empty to disable that exporter.
+func InitTracing(nodeType, nodeID, jaegerEndpoint, zipkinEndpoint string, sampleRate float64) error {
+	serviceName := "livepeer-" + nodeType
+	if jaegerEndpoint != "" {
+		je, err := jaeger.NewExporter(jaeger.Options{
+			CollectorEndpoint: jaegerEndpoint,
+			Process: jaeger.Process{
+				ServiceName: serviceName,
+				Tags:        []jaeger.Tag{jaeger.StringTag(SpanAttrNodeID, nodeID)},
+			},
+			OnError: func(err error) {
+				GetLogger().Error("Error exporting spans to Jaeger", map[string]interface{}{"error": err})
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("error creating Jaeger exporter: %v", err)
+		}
+		trace.RegisterExporter(je)
+	}
+	if zipkinEndpoint != "" {
+		endpoint, err := openzipkin.NewEndpoint(serviceName, "")
+		if err != nil {
+			return fmt.Errorf("error creating Zipkin endpoint: %v", err)
+		}
+		trace.RegisterExporter(zipkin.NewExporter(zipkinhttp.NewReporter(zipkinEndpoint), endpoint))
+	}
+	trace.ApplyConfig(trace.Config{DefaultSampler: trace.ProbabilitySampler(sampleRate)})
+	return nil
+}
+
+// StartSegmentSpan starts a span named name for segment seqNo of the stream
+// with the given nonce, as a child of any span in ctx
+func StartSegmentSpan(ctx context.Context, name string, nonce, seqNo uint64) (context.Context, *trace.Span) {
+	ctx, span := trace.StartSpan(ctx, name)
+	span.AddAttributes(
+		trace.Int64Attribute(SpanAttrNonce, int64(nonce)),
+		trace.Int64Attribute(SpanAttrSeqNo, int64(seqNo)),
+	)
+	return ctx, span
+}
+
+// StartProfileSpan starts a span for the rendition of segment seqNo in profile
+func StartProfileSpan(ctx context.Context, name string, nonce, seqNo uint64, profile string) (context.Context, *trace.Span) {
+	ctx, span := StartSegmentSpan(ctx, name, nonce, seqNo)
+	span.AddAttributes(trace.StringAttribute(SpanAttrProfile, profile))
+	return ctx, span
+}
+
+// StartRemoteSpan starts a span for an incoming request, continuing the trace
+// propagated in the request headers if there is one
+func StartRemoteSpan(r *http.Request, name string) (context.Context, *trace.Span) {
+	if sc, ok := TracePropagation.SpanContextFromRequest(r); ok {
+		return trace.StartSpanWithRemoteParent(r.Context(), name, sc)
+	}
+	return trace.StartSpan(r.Context(), name)
+}
+
+// EndSpan records err, if any, on span and ends it
+func EndSpan(span *trace.Span, err error) {
+	if err != nil {
+		span.SetStatus(trace.Status{Code: trace.StatusCodeUnknown, Message: err.Error()})
+	}
+	span.End()
+}
@@ -0,0 +1,30 @@
+package monitor
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"go.opencensus.io/trace"
+)
+
+func TestStartRemoteSpan(t *testing.T) {
+	ctx, parent := StartSegmentSpan(context.Background(), "ProcessSegment", 1, 2)
+	defer parent.End()
+
+	// propagated trace context is continued
+	req := httptest.NewRequest("POST", "/segment", nil)
+	TracePropagation.SpanContextToRequest(trace.FromContext(ctx).SpanContext(), req)
+	_, span := StartRemoteSpan(req, "ServeSegment")
+	defer span.End()
+	if span.SpanContext().TraceID != parent.SpanContext().TraceID {
+		t.Error("Expected remote span to continue the trace")
+	}
+
+	// no trace context starts a new trace
+	_, span = StartRemoteSpan(httptest.NewRequest("POST", "/segment", nil), "ServeSegment")
+	defer span.End()
+	if span.SpanContext().TraceID == parent.SpanContext().TraceID {
+		t.Error("Expected a new trace")
+	}
+}
@@ -0,0 +1,147 @@
+package monitor
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"go.opencensus.io/stats/view"
+)
+
+// Groups of views that can be enabled and disabled at runtime. A view
+// belongs to a group if it has one of the group's tag keys or is listed in
+// the group's views; a view is registered only while all its groups are
+// enabled.
+var viewGroups = map[string]struct {
+	tags  []string
+	views []string
+}{
+	"profile":      {tags: []string{"profile", "profiles"}},
+	"orchestrator": {tags: []string{"orchestrator"}},
+	"ticket":       {tags: []string{"sender", "recipient"}},
+	"stream":       {tags: []string{"manifest_id"}},
+	"gpu":          {tags: []string{"gpu"}},
+	"storage":      {tags: []string{"driver", "operation"}},
+	"debug": {views: []string{
+		"segment_events_dropped_total",
+		"timeout_watcher_stalled_total",
+		"stream_nonce_collision_total",
+		"goroutine_count",
+		"segment_source_duration_drift_seconds",
+	}},
+}
+
+// DisabledViewGroups holds the view groups to leave unregistered at Init.
+// Must be set before Init; see SetDisabledViewGroups.
+var DisabledViewGroups map[string]bool
+
+var (
+	// all views built by Init, registered or not; protected by viewGroupsLock
+	allViews       []*view.View
+	viewGroupsLock sync.Mutex
+)
+
+// SetDisabledViewGroups configures the view groups disabled at startup.
+// Returns an error for unknown groups.
+func SetDisabledViewGroups(groups []string) error {
+	res := make(map[string]bool)
+	for _, g := range groups {
+		if _, ok := viewGroups[g]; !ok {
+			return fmt.Errorf("unknown view group %q; expected one of %v", g, viewGroupNames())
+		}
+		res[g] = true
+	}
+	DisabledViewGroups = res
+	return nil
+}
+
+// ViewGroups returns whether each view group is enabled
+func ViewGroups() map[string]bool {
+	viewGroupsLock.Lock()
+	defer viewGroupsLock.Unlock()
+	res := make(map[string]bool, len(viewGroups))
+	for g := range viewGroups {
+		res[g] = !DisabledViewGroups[g]
+	}
+	return res
+}
+
+// SetViewGroupEnabled registers or unregisters the views of a group.
+// Unregistering a view drops its data, so re-enabled views start from zero.
+func SetViewGroupEnabled(group string, enabled bool) error {
+	if _, ok := viewGroups[group]; !ok {
+		return fmt.Errorf("unknown view group %q; expected one of %v", group, viewGroupNames())
+	}
+	viewGroupsLock.Lock()
+	defer viewGroupsLock.Unlock()
+	if enabled == !DisabledViewGroups[group] {
+		return nil
+	}
+	disabled := make(map[string]bool, len(DisabledViewGroups)+1)
+	for g, d := range DisabledViewGroups {
+		disabled[g] = d
+	}
+	disabled[group] = !enabled
+
+	var changed []*view.View
+	for _, v := range allViews {
+		if inViewGroup(v, group) && viewEnabled(v, disabled) == enabled {
+			changed = append(changed, v)
+		}
+	}
+	if enabled {
+		if err := view.Register(changed...); err != nil {
+			return err
+		}
+	} else {
+		view.Unregister(changed...)
+	}
+	DisabledViewGroups = disabled
+	return nil
+}
+
+// enabledViews returns the views whose groups are all enabled
+func enabledViews(views []*view.View) []*view.View {
+	res := make([]*view.View, 0, len(views))
+	for _, v := range views {
+		if viewEnabled(v, DisabledViewGroups) {
+			res = append(res, v)
+		}
+	}
+	return res
+}
+
+func viewEnabled(v *view.View, disabled map[string]bool) bool {
+	for g, d := range disabled {
+		if d && inViewGroup(v, g) {
+			return false
+		}
+	}
+	return true
+}
+
+func inViewGroup(v *view.View, group string) bool {
+	vg := viewGroups[group]
+	for _, name := range vg.views {
+		if v.Name == name {
+			return true
+		}
+	}
+	for _, k := range v.TagKeys {
+		for _, t := range vg.tags {
+			if k.Name() == t {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func viewGroupNames() []string {
+	names := make([]string, 0, len(viewGroups))
+	for g := range viewGroups {
+		names = append(names, g)
+	}
+	sort.Strings(names)
+	return names
+}
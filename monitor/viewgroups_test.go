@@ -0,0 +1,79 @@
+package monitor
+
+import (
+	"testing"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+)
+
+func TestSetDisabledViewGroups(t *testing.T) {
+	defer func() { DisabledViewGroups = nil }()
+	if err := SetDisabledViewGroups([]string{"profile", "debug"}); err != nil {
+		t.Fatal(err)
+	}
+	groups := ViewGroups()
+	if groups["profile"] || groups["debug"] || !groups["stream"] {
+		t.Error("Unexpected view groups ", groups)
+	}
+	if err := SetDisabledViewGroups([]string{"foo"}); err == nil {
+		t.Error("Expected error for an unknown group")
+	}
+}
+
+func TestSetViewGroupEnabled(t *testing.T) {
+	defer func(views []*view.View) {
+		allViews = views
+		DisabledViewGroups = nil
+	}(allViews)
+	kProfile, _ := tag.NewKey("profile")
+	kManifestID, _ := tag.NewKey("manifest_id")
+	profileView := &view.View{
+		Name:        "test_group_profile",
+		Measure:     stats.Int64("test_group_profile", "", "tot"),
+		TagKeys:     []tag.Key{kProfile},
+		Aggregation: view.Count(),
+	}
+	bothView := &view.View{
+		Name:        "test_group_profile_stream",
+		Measure:     stats.Int64("test_group_profile_stream", "", "tot"),
+		TagKeys:     []tag.Key{kProfile, kManifestID},
+		Aggregation: view.Count(),
+	}
+	DisabledViewGroups = map[string]bool{"stream": true}
+	allViews = []*view.View{profileView, bothView}
+	views := enabledViews(allViews)
+	if len(views) != 1 || views[0] != profileView {
+		t.Fatal("Expected views of disabled groups to be left out ", views)
+	}
+	if err := view.Register(views...); err != nil {
+		t.Fatal(err)
+	}
+	defer view.Unregister(profileView, bothView)
+
+	if err := SetViewGroupEnabled("profile", false); err != nil {
+		t.Fatal(err)
+	}
+	if view.Find("test_group_profile") != nil {
+		t.Error("Expected the profile view to be unregistered")
+	}
+
+	// a view is only registered once all its groups are enabled
+	if err := SetViewGroupEnabled("stream", true); err != nil {
+		t.Fatal(err)
+	}
+	if view.Find("test_group_profile_stream") != nil {
+		t.Error("Unexpected view registered while its profile group is disabled")
+	}
+	if err := SetViewGroupEnabled("profile", true); err != nil {
+		t.Fatal(err)
+	}
+	if view.Find("test_group_profile") == nil || view.Find("test_group_profile_stream") == nil {
+		t.Error("Expected both views to be registered")
+	}
+
+	if err := SetViewGroupEnabled("foo", true); err == nil {
+		t.Error("Expected error for an unknown group")
+	}
+}
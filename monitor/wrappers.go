@@ -0,0 +1,371 @@
+package monitor
+
+import (
+	"io"
+	"math/big"
+	"time"
+
+	"go.opencensus.io/trace"
+)
+
+// LogDiscoveryError calls LogDiscoveryError on the default census
+func LogDiscoveryError(code string) {
+	census.LogDiscoveryError(code)
+}
+
+// LogDiscoveryLatency calls LogDiscoveryLatency on the default census
+func LogDiscoveryLatency(latency time.Duration) {
+	census.LogDiscoveryLatency(latency)
+}
+
+// LogDiscoveryResponses calls LogDiscoveryResponses on the default census
+func LogDiscoveryResponses(requested, responded int) {
+	census.LogDiscoveryResponses(requested, responded)
+}
+
+// OrchestratorPoolSize calls OrchestratorPoolSize on the default census
+func OrchestratorPoolSize(size int) {
+	census.OrchestratorPoolSize(size)
+}
+
+// LogDiscoveryCache calls LogDiscoveryCache on the default census
+func LogDiscoveryCache(hit bool, age time.Duration) {
+	census.LogDiscoveryCache(hit, age)
+}
+
+// LogSessionRefresh calls LogSessionRefresh on the default census
+func LogSessionRefresh(dur time.Duration, err error) {
+	census.LogSessionRefresh(dur, err)
+}
+
+// LogDuplicateSegment calls LogDuplicateSegment on the default census
+func LogDuplicateSegment(nonce, seqNo uint64) {
+	census.LogDuplicateSegment(nonce, seqNo)
+}
+
+// LogStreamLabels calls LogStreamLabels on the default census
+func LogStreamLabels(nonce uint64, labels map[string]string) {
+	census.LogStreamLabels(nonce, labels)
+}
+
+// LogSegmentTrace calls LogSegmentTrace on the default census
+func LogSegmentTrace(nonce, seqNo uint64, sc trace.SpanContext) {
+	census.LogSegmentTrace(nonce, seqNo, sc)
+}
+
+// LogOutOfOrderSegment calls LogOutOfOrderSegment on the default census
+func LogOutOfOrderSegment(nonce, seqNo uint64) {
+	census.LogOutOfOrderSegment(nonce, seqNo)
+}
+
+// LogSegmentDurationDrift calls LogSegmentDurationDrift on the default census
+func LogSegmentDurationDrift(nonce, seqNo uint64, drift time.Duration) {
+	census.LogSegmentDurationDrift(nonce, seqNo, drift)
+}
+
+// SetLostSegmentTimeout calls SetLostSegmentTimeout on the default census
+func SetLostSegmentTimeout(nonce uint64, timeout time.Duration) {
+	census.SetLostSegmentTimeout(nonce, timeout)
+}
+
+// GetSuccessRateSnapshot calls GetSuccessRateSnapshot on the default census
+func GetSuccessRateSnapshot() map[uint64]float64 {
+	return census.GetSuccessRateSnapshot()
+}
+
+// WatchdogTimeout calls WatchdogTimeout on the default census
+func WatchdogTimeout() bool {
+	return census.WatchdogTimeout()
+}
+
+// MaxSessions calls MaxSessions on the default census
+func MaxSessions(maxSessions int) {
+	census.MaxSessions(maxSessions)
+}
+
+// CurrentSessions calls CurrentSessions on the default census
+func CurrentSessions(currentSessions int) {
+	census.CurrentSessions(currentSessions)
+}
+
+// LogOrchSegmentReceived calls LogOrchSegmentReceived on the default census
+func LogOrchSegmentReceived() {
+	census.LogOrchSegmentReceived()
+}
+
+// LogOrchSegmentRejected calls LogOrchSegmentRejected on the default census
+func LogOrchSegmentRejected(code SegmentTranscodeError) {
+	census.LogOrchSegmentRejected(code)
+}
+
+// LogOrchTranscodeQueued calls LogOrchTranscodeQueued on the default census
+func LogOrchTranscodeQueued() {
+	census.LogOrchTranscodeQueued()
+}
+
+// LogOrchTranscodeDequeued calls LogOrchTranscodeDequeued on the default census
+func LogOrchTranscodeDequeued() {
+	census.LogOrchTranscodeDequeued()
+}
+
+// LogOrchPaymentError calls LogOrchPaymentError on the default census
+func LogOrchPaymentError() {
+	census.LogOrchPaymentError()
+}
+
+// LogPMSessionStarted calls LogPMSessionStarted on the default census
+func LogPMSessionStarted(sessionID, orchestrator string) {
+	census.LogPMSessionStarted(sessionID, orchestrator)
+}
+
+// LogTicketSent calls LogTicketSent on the default census
+func LogTicketSent(sessionID, recipient string, faceValue *big.Int) {
+	census.LogTicketSent(sessionID, recipient, faceValue)
+}
+
+// LogTicketReceived calls LogTicketReceived on the default census
+func LogTicketReceived(sender string, faceValue *big.Int) {
+	census.LogTicketReceived(sender, faceValue)
+}
+
+// LogWinningTicket calls LogWinningTicket on the default census
+func LogWinningTicket(sessionID, sender string, faceValue *big.Int) {
+	census.LogWinningTicket(sessionID, sender, faceValue)
+}
+
+// LogWinningTicketsRedeemed calls LogWinningTicketsRedeemed on the default census
+func LogWinningTicketsRedeemed(sessionIDs []string, err error) {
+	census.LogWinningTicketsRedeemed(sessionIDs, err)
+}
+
+// LogWinningTicketSent calls LogWinningTicketSent on the default census
+func LogWinningTicketSent(recipient string, faceValue *big.Int) {
+	census.LogWinningTicketSent(recipient, faceValue)
+}
+
+// LogOrchestratorUploaded calls LogOrchestratorUploaded on the default census
+func LogOrchestratorUploaded(orch string, took time.Duration) {
+	census.LogOrchestratorUploaded(orch, took)
+}
+
+// LogOrchestratorTranscoded calls LogOrchestratorTranscoded on the default census
+func LogOrchestratorTranscoded(orch string, roundTrip time.Duration) {
+	census.LogOrchestratorTranscoded(orch, roundTrip)
+}
+
+// LogOrchestratorFailed calls LogOrchestratorFailed on the default census
+func LogOrchestratorFailed(orch, code string) {
+	census.LogOrchestratorFailed(orch, code)
+}
+
+// LogOrchestratorOverPriced calls LogOrchestratorOverPriced on the default census
+func LogOrchestratorOverPriced(orch string) {
+	census.LogOrchestratorOverPriced(orch)
+}
+
+// LogOrchestratorPing calls LogOrchestratorPing on the default census
+func LogOrchestratorPing(orch string, rtt time.Duration) {
+	census.LogOrchestratorPing(orch, rtt)
+}
+
+// LogSpotCheckFailed calls LogSpotCheckFailed on the default census
+func LogSpotCheckFailed(orch string) {
+	census.LogSpotCheckFailed(orch)
+}
+
+// LogOrchestratorSuspended calls LogOrchestratorSuspended on the default census
+func LogOrchestratorSuspended(orch string, cooldown time.Duration) {
+	census.LogOrchestratorSuspended(orch, cooldown)
+}
+
+// LogSegmentVerified calls LogSegmentVerified on the default census
+func LogSegmentVerified(orch, profile string) {
+	census.LogSegmentVerified(orch, profile)
+}
+
+// LogSegmentVerificationFailed calls LogSegmentVerificationFailed on the default census
+func LogSegmentVerificationFailed(nonce, seqNo uint64, orch, profile, code, reason string) {
+	census.LogSegmentVerificationFailed(nonce, seqNo, orch, profile, code, reason)
+}
+
+// LogOSOperation calls LogOSOperation on the default census
+func LogOSOperation(driver, op string, bytes int, took time.Duration, err error) {
+	census.LogOSOperation(driver, op, bytes, took, err)
+}
+
+// LogBytesTransferred calls LogBytesTransferred on the default census
+func LogBytesTransferred(direction string, nonce uint64, bytes int64) {
+	census.LogBytesTransferred(direction, nonce, bytes)
+}
+
+// LogTranscodeCache calls LogTranscodeCache on the default census
+func LogTranscodeCache(hit bool) {
+	census.LogTranscodeCache(hit)
+}
+
+// UploadConcurrency calls UploadConcurrency on the default census
+func UploadConcurrency(inUse int) {
+	census.UploadConcurrency(inUse)
+}
+
+// LogSegmentRetries calls LogSegmentRetries on the default census
+func LogSegmentRetries(nonce, seqNo uint64, retries int) {
+	census.LogSegmentRetries(nonce, seqNo, retries)
+}
+
+// LogSegmentRetriesExhausted calls LogSegmentRetriesExhausted on the default census
+func LogSegmentRetriesExhausted(nonce, seqNo uint64, attempts int, err error) {
+	census.LogSegmentRetriesExhausted(nonce, seqNo, attempts, err)
+}
+
+// TranscodeRetryBacklog calls TranscodeRetryBacklog on the default census
+func TranscodeRetryBacklog(segments int) {
+	census.TranscodeRetryBacklog(segments)
+}
+
+// SegmentFullyTranscoded calls SegmentFullyTranscoded on the default census
+func SegmentFullyTranscoded(nonce, seqNo uint64, succeededProfiles, failedProfiles []string, errCode SegmentTranscodeError) {
+	census.SegmentFullyTranscoded(nonce, seqNo, succeededProfiles, failedProfiles, errCode)
+}
+
+// LogSegmentOversized calls LogSegmentOversized on the default census
+func LogSegmentOversized(nonce, seqNo uint64, size int64) {
+	census.LogSegmentOversized(nonce, seqNo, size)
+}
+
+// LogPlaylistInsert calls LogPlaylistInsert on the default census
+func LogPlaylistInsert(nonce uint64, profile string) {
+	census.LogPlaylistInsert(nonce, profile)
+}
+
+// LogPlaylistInsertFailed calls LogPlaylistInsertFailed on the default census
+func LogPlaylistInsertFailed(nonce, seqNo uint64, profile, reason string) {
+	census.LogPlaylistInsertFailed(nonce, seqNo, profile, reason)
+}
+
+// LogTranscodeQualityScore calls LogTranscodeQualityScore on the default census
+func LogTranscodeQualityScore(nonce, seqNo uint64, profile string, vmafScore float64) {
+	census.LogTranscodeQualityScore(nonce, seqNo, profile, vmafScore)
+}
+
+// LogSegmentTranscodeStarting calls LogSegmentTranscodeStarting on the default census
+func LogSegmentTranscodeStarting(seqNo uint64, manifestID string) {
+	census.LogSegmentTranscodeStarting(seqNo, manifestID)
+}
+
+// LogSegmentTranscodeEnded calls LogSegmentTranscodeEnded on the default census
+func LogSegmentTranscodeEnded(seqNo uint64, manifestID string, d time.Duration, profiles string) {
+	census.LogSegmentTranscodeEnded(seqNo, manifestID, d, profiles)
+}
+
+// LogStreamCreatedEvent calls LogStreamCreatedEvent on the default census
+func LogStreamCreatedEvent(hlsStrmID string, nonce uint64) {
+	census.LogStreamCreatedEvent(hlsStrmID, nonce)
+}
+
+// LogStreamStartedEvent calls LogStreamStartedEvent on the default census
+func LogStreamStartedEvent(nonce uint64) {
+	census.LogStreamStartedEvent(nonce)
+}
+
+// LogOrchestratorSwapped calls LogOrchestratorSwapped on the default census
+func LogOrchestratorSwapped(nonce uint64, prev, cur string) {
+	census.LogOrchestratorSwapped(nonce, prev, cur)
+}
+
+// LogStreamSession calls LogStreamSession on the default census
+func LogStreamSession(nonce uint64, orchestrator, pmSessionID string) {
+	census.LogStreamSession(nonce, orchestrator, pmSessionID)
+}
+
+// LogStreamEndedEvent calls LogStreamEndedEvent on the default census
+func LogStreamEndedEvent(nonce uint64) {
+	census.LogStreamEndedEvent(nonce)
+}
+
+// LogRecordingFinalized calls LogRecordingFinalized on the default census
+func LogRecordingFinalized(nonce uint64, manifestID, url, mp4URL string, duration float64, errMsg string) {
+	census.LogRecordingFinalized(nonce, manifestID, url, mp4URL, duration, errMsg)
+}
+
+// LogStreamRejected calls LogStreamRejected on the default census
+func LogStreamRejected(nonce uint64, reason string) {
+	census.LogStreamRejected(nonce, reason)
+}
+
+// LogSegmentTranscodedLocally calls LogSegmentTranscodedLocally on the default census
+func LogSegmentTranscodedLocally(nonce, seqNo uint64) {
+	census.LogSegmentTranscodedLocally(nonce, seqNo)
+}
+
+// LogStreamCreateFailed calls LogStreamCreateFailed on the default census
+func LogStreamCreateFailed(nonce uint64, reason string) {
+	census.LogStreamCreateFailed(nonce, reason)
+}
+
+// LogSegmentUploadFailed calls LogSegmentUploadFailed on the default census
+func LogSegmentUploadFailed(nonce, seqNo uint64, code SegmentUploadError, reason string) {
+	census.LogSegmentUploadFailed(nonce, seqNo, code, reason)
+}
+
+// LogTranscodedSegmentAppeared calls LogTranscodedSegmentAppeared on the default census
+func LogTranscodedSegmentAppeared(nonce, seqNo uint64, profile string) {
+	census.LogTranscodedSegmentAppeared(nonce, seqNo, profile)
+}
+
+// LogSourceSegmentAppeared calls LogSourceSegmentAppeared on the default census
+func LogSourceSegmentAppeared(nonce, seqNo uint64, manifestID, profile string) {
+	census.LogSourceSegmentAppeared(nonce, seqNo, manifestID, profile)
+}
+
+// LogSegmentEmerged calls LogSegmentEmerged on the default census
+//
+// Deprecated: use LogSegmentEmergedWithSize, which also records the segment size.
+func LogSegmentEmerged(nonce, seqNo uint64, profilesNum int) {
+	census.LogSegmentEmerged(nonce, seqNo, profilesNum)
+}
+
+// LogSegmentEmergedWithSize calls LogSegmentEmergedWithSize on the default census
+func LogSegmentEmergedWithSize(nonce, seqNo uint64, profilesNum int, byteSize int64) {
+	census.LogSegmentEmergedWithSize(nonce, seqNo, profilesNum, byteSize)
+}
+
+// LogCodecChange calls LogCodecChange on the default census
+func LogCodecChange(nonce, seqNo uint64, prev, cur string) {
+	census.LogCodecChange(nonce, seqNo, prev, cur)
+}
+
+// SegmentUploadStart calls SegmentUploadStart on the default census
+func SegmentUploadStart(nonce, seqNo uint64) {
+	census.SegmentUploadStart(nonce, seqNo)
+}
+
+// LogSegmentUploaded calls LogSegmentUploaded on the default census
+func LogSegmentUploaded(nonce, seqNo uint64, uploadDur time.Duration) {
+	census.LogSegmentUploaded(nonce, seqNo, uploadDur)
+}
+
+// LogSegmentTranscoded calls LogSegmentTranscoded on the default census
+func LogSegmentTranscoded(nonce, seqNo uint64, transcodeDur, totalDur time.Duration, profiles string) {
+	census.LogSegmentTranscoded(nonce, seqNo, transcodeDur, totalDur, profiles)
+}
+
+// LogSegmentTranscodeFailed calls LogSegmentTranscodeFailed on the default census
+func LogSegmentTranscodeFailed(subType SegmentTranscodeError, nonce, seqNo uint64, err error) {
+	census.LogSegmentTranscodeFailed(subType, nonce, seqNo, err)
+}
+
+// GetStreamStats calls GetStreamStats on the default census
+func GetStreamStats() []StreamStats {
+	return census.GetStreamStats()
+}
+
+// DebugDumpState calls DebugDumpState on the default census
+func DebugDumpState(w io.Writer) error {
+	return census.DebugDumpState(w)
+}
+
+// LogGPUStats calls LogGPUStats on the default census
+func LogGPUStats(gpus []GPUStats) {
+	census.LogGPUStats(gpus)
+}
@@ -1,7 +1,9 @@
 package net
 
 import (
+	"context"
 	"fmt"
+	"math/big"
 	"strings"
 
 	"github.com/ericxtang/m3u8"
@@ -9,7 +11,72 @@ import (
 )
 
 type OrchestratorPool interface {
-	GetOrchestrators(int) ([]*OrchestratorInfo, error)
+	// GetOrchestrators returns up to the given number of orchestrators that
+	// match the constraints. Nil constraints match any orchestrator.
+	GetOrchestrators(int, *OrchestratorConstraints) ([]*OrchestratorInfo, error)
+}
+
+// IncrementalOrchestratorPool is an OrchestratorPool that can also return
+// orchestrators one by one as they respond, so broadcasters can start with
+// the first viable one rather than wait for all those requested
+type IncrementalOrchestratorPool interface {
+	OrchestratorPool
+	// StreamOrchestrators sends up to the given number of orchestrators that
+	// match the constraints on the returned channel, which is closed once
+	// discovery is done or ctx is.
+	StreamOrchestrators(context.Context, int, *OrchestratorConstraints) <-chan *OrchestratorInfo
+}
+
+// OrchestratorConstraints are the requirements a broadcaster has of the
+// orchestrators it uses
+type OrchestratorConstraints struct {
+	// Highest expected value of a ticket, in wei. Nil or zero is unlimited.
+	MaxPrice *big.Int
+	// Capabilities the orchestrator must all advertise
+	Capabilities []string
+}
+
+// maxWinProb is the win probability of a ticket that always wins
+var maxWinProb = new(big.Int).Lsh(big.NewInt(1), 256)
+
+// Matches returns true if o meets the constraints
+func (c *OrchestratorConstraints) Matches(o *OrchestratorInfo) bool {
+	return c.Affordable(o) && c.Capable(o)
+}
+
+// Affordable returns true if the expected value of the tickets of o is at
+// most MaxPrice. Orchestrators that don't ask for payment are free.
+func (c *OrchestratorConstraints) Affordable(o *OrchestratorInfo) bool {
+	if c == nil || c.MaxPrice == nil || c.MaxPrice.Sign() <= 0 {
+		return true
+	}
+	params := o.GetTicketParams()
+	if params == nil {
+		return true
+	}
+	// faceValue * winProb / 2^256 <= max
+	ev := new(big.Int).Mul(new(big.Int).SetBytes(params.FaceValue), new(big.Int).SetBytes(params.WinProb))
+	return ev.Cmp(new(big.Int).Mul(c.MaxPrice, maxWinProb)) <= 0
+}
+
+// Capable returns true if o advertises all the required Capabilities
+func (c *OrchestratorConstraints) Capable(o *OrchestratorInfo) bool {
+	if c == nil {
+		return true
+	}
+	for _, want := range c.Capabilities {
+		found := false
+		for _, have := range o.GetCapabilities() {
+			if strings.EqualFold(want, have) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
 }
 
 type NodeStatus struct {
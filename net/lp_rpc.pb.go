@@ -287,6 +287,10 @@ type OrchestratorInfo struct {
 	Transcoder string `protobuf:"bytes,1,opt,name=transcoder,proto3" json:"transcoder,omitempty"`
 	// Required parameters for probabilistic micropayment tickets
 	TicketParams *TicketParams `protobuf:"bytes,2,opt,name=ticket_params,json=ticketParams,proto3" json:"ticket_params,omitempty"`
+	// Region the orchestrator is located in, as a hint for broadcasters
+	Region string `protobuf:"bytes,3,opt,name=region,proto3" json:"region,omitempty"`
+	// Features the orchestrator supports, for broadcasters that require them
+	Capabilities []string `protobuf:"bytes,4,rep,name=capabilities,proto3" json:"capabilities,omitempty"`
 	// Orchestrator returns info about own input object storage, if it wants it to be used.
 	Storage              []*OSInfo `protobuf:"bytes,32,rep,name=storage,proto3" json:"storage,omitempty"`
 	XXX_NoUnkeyedLiteral struct{}  `json:"-"`
@@ -333,6 +337,20 @@ func (m *OrchestratorInfo) GetTicketParams() *TicketParams {
 	return nil
 }
 
+func (m *OrchestratorInfo) GetRegion() string {
+	if m != nil {
+		return m.Region
+	}
+	return ""
+}
+
+func (m *OrchestratorInfo) GetCapabilities() []string {
+	if m != nil {
+		return m.Capabilities
+	}
+	return nil
+}
+
 func (m *OrchestratorInfo) GetStorage() []*OSInfo {
 	if m != nil {
 		return m.Storage
@@ -1018,60 +1036,61 @@ func init() {
 func init() { proto.RegisterFile("net/lp_rpc.proto", fileDescriptor_034e29c79f9ba827) }
 
 var fileDescriptor_034e29c79f9ba827 = []byte{
-	// 848 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x8c, 0x55, 0xdd, 0x6e, 0x1b, 0x45,
-	0x14, 0xce, 0x66, 0x9d, 0x8d, 0x73, 0x6c, 0x13, 0x67, 0xda, 0x86, 0xc5, 0x82, 0xca, 0x2c, 0x54,
-	0x4a, 0x6f, 0x0c, 0x72, 0xa4, 0x22, 0xee, 0x68, 0x49, 0x49, 0x2c, 0xa1, 0xc4, 0x1a, 0x1b, 0x24,
-	0xae, 0xac, 0xc9, 0xee, 0xb1, 0xb3, 0x8a, 0x33, 0xbb, 0x9d, 0x19, 0xd3, 0x9a, 0xb7, 0xe0, 0x15,
-	0x80, 0x2b, 0x5e, 0x85, 0x97, 0x42, 0x73, 0x66, 0x77, 0xbd, 0x6e, 0x5a, 0xe8, 0xdd, 0xf9, 0x9b,
-	0x99, 0xef, 0x7c, 0xf3, 0x9d, 0x19, 0xe8, 0x4a, 0x34, 0x5f, 0x2d, 0xf3, 0x99, 0xca, 0xe3, 0x41,
-	0xae, 0x32, 0x93, 0x31, 0x5f, 0xa2, 0x89, 0xfa, 0xd0, 0x1c, 0xa7, 0x72, 0x31, 0xce, 0xe4, 0x82,
-	0x3d, 0x84, 0xbd, 0x5f, 0xc5, 0x72, 0x85, 0xa1, 0xd7, 0xf7, 0x4e, 0xda, 0xdc, 0x39, 0xd1, 0x73,
-	0x78, 0x70, 0xa5, 0xe2, 0x1b, 0xd4, 0x46, 0x09, 0x93, 0x29, 0x8e, 0xaf, 0x56, 0xa8, 0x0d, 0x0b,
-	0x61, 0x5f, 0x24, 0x89, 0x42, 0xad, 0x8b, 0xf2, 0xd2, 0x65, 0x5d, 0xf0, 0x75, 0xba, 0x08, 0x77,
-	0x29, 0x6a, 0xcd, 0xe8, 0x4f, 0x0f, 0x82, 0xab, 0xc9, 0x48, 0xce, 0x33, 0xf6, 0x2d, 0xb4, 0xb4,
-	0xc9, 0x94, 0x58, 0xe0, 0x74, 0x9d, 0xbb, 0x93, 0x3e, 0x1a, 0x7e, 0x3c, 0x90, 0x68, 0x06, 0xae,
-	0x62, 0x30, 0xd9, 0xa4, 0x79, 0xbd, 0x96, 0x3d, 0x81, 0x40, 0x9f, 0xa6, 0x72, 0x9e, 0x85, 0xdd,
-	0xbe, 0x77, 0xd2, 0x1a, 0x76, 0x68, 0xd5, 0xe4, 0xd4, 0xad, 0xe3, 0x45, 0x32, 0xfa, 0x06, 0x5a,
-	0xb5, 0x2d, 0x18, 0x40, 0x70, 0x36, 0xe2, 0x2f, 0xbf, 0x9f, 0x76, 0x77, 0x58, 0x00, 0xbb, 0x93,
-	0xd3, 0xae, 0xc7, 0x9a, 0xd0, 0x18, 0x8d, 0x7f, 0x98, 0x74, 0x77, 0x6d, 0xf6, 0xfc, 0xea, 0xea,
-	0xfc, 0xc7, 0x97, 0x5d, 0x3f, 0xfa, 0xc3, 0x83, 0x66, 0xb9, 0x1b, 0x63, 0xd0, 0xb8, 0xc9, 0xb4,
-	0x21, 0x80, 0x07, 0x9c, 0x6c, 0xdb, 0xd8, 0x2d, 0xae, 0xa9, 0xb1, 0x03, 0x6e, 0x4d, 0x76, 0x0c,
-	0x41, 0x9e, 0x2d, 0xd3, 0x78, 0x1d, 0xfa, 0x14, 0x2c, 0x3c, 0xf6, 0x29, 0x1c, 0xe8, 0x74, 0x21,
-	0x85, 0x59, 0x29, 0x0c, 0x1b, 0x94, 0xda, 0x04, 0xd8, 0x63, 0x80, 0x58, 0x61, 0x82, 0xd2, 0xa4,
-	0x62, 0x19, 0xee, 0x51, 0xba, 0x16, 0x61, 0x3d, 0x68, 0xbe, 0x79, 0x7e, 0xf7, 0xdb, 0x99, 0x30,
-	0x18, 0x06, 0x94, 0xad, 0xfc, 0xe8, 0x77, 0x0f, 0xba, 0xf5, 0xeb, 0x20, 0xb0, 0x8f, 0x01, 0x8c,
-	0x12, 0x52, 0xc7, 0x59, 0x82, 0xaa, 0x80, 0x5c, 0x8b, 0xb0, 0x67, 0xd0, 0x31, 0x69, 0x7c, 0x8b,
-	0x66, 0x96, 0x0b, 0x25, 0xee, 0x34, 0xb5, 0xd0, 0x1a, 0x1e, 0x11, 0x81, 0x53, 0xca, 0x8c, 0x29,
-	0xc1, 0xdb, 0xa6, 0xe6, 0xb1, 0x27, 0xb0, 0x5f, 0x5c, 0x40, 0xd8, 0xef, 0xfb, 0x27, 0xad, 0x61,
-	0xab, 0x76, 0x51, 0xbc, 0xcc, 0x45, 0x7f, 0x79, 0xb0, 0x3f, 0xc1, 0xc5, 0x99, 0x30, 0xc2, 0x42,
-	0xb9, 0x13, 0x32, 0x9d, 0xa3, 0x36, 0xa3, 0xa4, 0x50, 0x46, 0x2d, 0x42, 0xe2, 0xc0, 0x57, 0x04,
-	0xc0, 0xe7, 0xd6, 0x24, 0xa6, 0x85, 0xbe, 0x21, 0x06, 0xdb, 0x9c, 0x6c, 0xcb, 0x40, 0xae, 0xb2,
-	0x79, 0xba, 0x44, 0x4d, 0xf4, 0xb5, 0x79, 0xe5, 0x97, 0xf2, 0xda, 0xab, 0xe4, 0xf5, 0xa1, 0x30,
-	0x9f, 0xc2, 0xa3, 0x69, 0xc9, 0x49, 0x32, 0xc1, 0xc5, 0x1d, 0x4a, 0x43, 0x98, 0xbb, 0xe0, 0xaf,
-	0xd4, 0xb2, 0xe0, 0xcd, 0x9a, 0xd1, 0x2f, 0xd0, 0xa9, 0x4a, 0xa9, 0xe4, 0x19, 0x34, 0xb5, 0x5b,
-	0x61, 0xe5, 0x6e, 0xcf, 0xe8, 0x39, 0xf2, 0xde, 0xb5, 0x21, 0xaf, 0x6a, 0xdf, 0x31, 0x0b, 0x19,
-	0x1c, 0x56, 0x8b, 0x38, 0xea, 0xd5, 0xd2, 0x94, 0x9c, 0x78, 0x1b, 0x4e, 0x8e, 0x61, 0x0f, 0x95,
-	0xca, 0x94, 0xd3, 0xda, 0xc5, 0x0e, 0x77, 0x2e, 0x3b, 0x81, 0x46, 0x22, 0x8c, 0x20, 0xae, 0x5a,
-	0x43, 0xb6, 0x0d, 0xc1, 0x1e, 0x7d, 0xb1, 0xc3, 0xa9, 0xe2, 0x45, 0x13, 0x02, 0x45, 0xbb, 0x47,
-	0x4f, 0xe1, 0x90, 0xe3, 0x22, 0xd5, 0x06, 0xab, 0xd9, 0x3d, 0x86, 0x40, 0x63, 0xac, 0xb0, 0x94,
-	0x77, 0xe1, 0x45, 0x3f, 0x41, 0xe7, 0x32, 0x33, 0xe9, 0x7c, 0x5d, 0x34, 0x73, 0x9f, 0x19, 0xbb,
-	0xd4, 0x08, 0x7d, 0x3b, 0x4a, 0x68, 0x08, 0x7d, 0x5e, 0x78, 0x5b, 0x37, 0x76, 0xb4, 0x7d, 0x63,
-	0xd1, 0xdf, 0x1e, 0xb4, 0xeb, 0x2a, 0xb3, 0xe3, 0xa1, 0x30, 0x4e, 0xf3, 0x14, 0xa5, 0x29, 0x34,
-	0xb2, 0x09, 0xb0, 0xcf, 0x00, 0xe6, 0x22, 0xc6, 0x99, 0x7b, 0x8b, 0x1c, 0x75, 0x07, 0x36, 0xf2,
-	0xb3, 0x0d, 0xb0, 0x4f, 0xa0, 0xf9, 0x3a, 0x95, 0xb3, 0x5c, 0x65, 0xd7, 0x85, 0x66, 0xf6, 0x5f,
-	0xa7, 0x72, 0xac, 0xb2, 0x6b, 0x36, 0x80, 0x07, 0xd5, 0x36, 0x33, 0x25, 0x64, 0x32, 0x23, 0x65,
-	0x39, 0x05, 0x1d, 0x55, 0x29, 0x2e, 0x64, 0x72, 0x61, 0x65, 0xc6, 0xa0, 0xa1, 0x11, 0x93, 0x42,
-	0x4b, 0x64, 0x47, 0xff, 0x78, 0x10, 0x38, 0xb0, 0xff, 0x03, 0x93, 0x48, 0x94, 0x76, 0xe0, 0x1c,
-	0xc4, 0xc2, 0x7b, 0x0b, 0xbe, 0xff, 0x5f, 0xf0, 0x1b, 0xdb, 0xf0, 0x3f, 0x87, 0xb6, 0xdb, 0x63,
-	0x26, 0x33, 0x19, 0x23, 0xc1, 0xea, 0xf0, 0x96, 0x8b, 0x5d, 0xda, 0xd0, 0xfb, 0x3a, 0x0c, 0xde,
-	0xd3, 0x61, 0x34, 0x85, 0xfd, 0xb1, 0x58, 0xd3, 0x5d, 0x7e, 0x01, 0x81, 0x1b, 0x6e, 0x6a, 0xa5,
-	0x1c, 0x12, 0xd7, 0x2a, 0x2f, 0x52, 0xf7, 0xf5, 0x5a, 0x71, 0xe4, 0x6f, 0x38, 0x1a, 0xbe, 0x81,
-	0x76, 0xfd, 0x0d, 0x62, 0x2f, 0xe0, 0xf0, 0x1c, 0xcd, 0x56, 0x28, 0x74, 0x23, 0x78, 0xff, 0xe3,
-	0xe8, 0x3d, 0xba, 0x97, 0xa1, 0x37, 0xec, 0x4b, 0x68, 0xd8, 0x8f, 0x88, 0xb9, 0x57, 0xbd, 0xfc,
-	0x93, 0x7a, 0xdb, 0xee, 0xf0, 0x12, 0x60, 0xba, 0x79, 0xd7, 0xbe, 0x03, 0x56, 0x4a, 0xbb, 0x16,
-	0x7d, 0x48, 0x4b, 0xde, 0xd2, 0x7c, 0xcf, 0x0d, 0xcb, 0x96, 0xbc, 0xbf, 0xf6, 0xae, 0x03, 0xfa,
-	0x0a, 0x4f, 0xff, 0x0d, 0x00, 0x00, 0xff, 0xff, 0x36, 0x3e, 0x51, 0x4c, 0x1e, 0x07, 0x00, 0x00,
+	// 855 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x8d, 0x55, 0xdb, 0x6e, 0xd3, 0x40,
+	0x10, 0xc5, 0x4d, 0x9a, 0xa4, 0x93, 0x84, 0xba, 0xcb, 0xcd, 0x44, 0x80, 0x8a, 0x01, 0x09, 0x5e,
+	0x02, 0x4a, 0x25, 0x10, 0x6f, 0xdc, 0x4b, 0x25, 0xd4, 0x46, 0x9b, 0x80, 0xc4, 0x53, 0xb4, 0xb5,
+	0x37, 0xa9, 0xd5, 0xd4, 0x0e, 0xde, 0x0d, 0x10, 0x3e, 0x07, 0x78, 0xe2, 0x57, 0x10, 0xff, 0xc4,
+	0xec, 0xac, 0xed, 0x38, 0x94, 0xdb, 0xdb, 0xdc, 0x76, 0xf6, 0xcc, 0xcc, 0x99, 0x5d, 0x70, 0x63,
+	0xa9, 0xef, 0x4e, 0x67, 0xa3, 0x74, 0x16, 0x74, 0x67, 0x69, 0xa2, 0x13, 0x56, 0x41, 0x8b, 0xbf,
+	0x0d, 0x8d, 0x7e, 0x14, 0x4f, 0xfa, 0x49, 0x3c, 0x61, 0xe7, 0x61, 0xfd, 0xbd, 0x98, 0xce, 0xa5,
+	0xe7, 0x6c, 0x3b, 0xb7, 0x5b, 0xdc, 0x2a, 0xfe, 0x63, 0x38, 0x77, 0x90, 0x06, 0x47, 0x52, 0xe9,
+	0x54, 0xe8, 0x24, 0xe5, 0xf2, 0xdd, 0x1c, 0x65, 0xe6, 0x41, 0x5d, 0x84, 0x61, 0x2a, 0x95, 0xca,
+	0xc2, 0x73, 0x95, 0xb9, 0x50, 0x51, 0xd1, 0xc4, 0x5b, 0x23, 0xab, 0x11, 0xfd, 0x2f, 0x0e, 0xd4,
+	0x0e, 0x06, 0x7b, 0xf1, 0x38, 0x61, 0x0f, 0xa1, 0xa9, 0x30, 0x8b, 0x98, 0xc8, 0xe1, 0x62, 0x66,
+	0x6f, 0x3a, 0xdb, 0xbb, 0xd4, 0x45, 0x28, 0x5d, 0x1b, 0xd1, 0x1d, 0x2c, 0xdd, 0xbc, 0x1c, 0xcb,
+	0x6e, 0x41, 0x4d, 0xed, 0x44, 0x18, 0xe2, 0xb9, 0x78, 0xaa, 0xd9, 0x6b, 0xd3, 0xa9, 0xc1, 0x8e,
+	0x3d, 0xc7, 0x33, 0xa7, 0xff, 0x00, 0x9a, 0xa5, 0x14, 0x0c, 0xa0, 0xf6, 0x6c, 0x8f, 0x3f, 0x7f,
+	0x3a, 0x74, 0xcf, 0xb0, 0x1a, 0xac, 0x0d, 0x76, 0x5c, 0x87, 0x35, 0xa0, 0xba, 0xd7, 0x7f, 0x31,
+	0x70, 0xd7, 0x8c, 0x77, 0xf7, 0xe0, 0x60, 0xf7, 0xd5, 0x73, 0xb7, 0xe2, 0x7f, 0x76, 0xa0, 0x91,
+	0x67, 0x63, 0x0c, 0xaa, 0x47, 0x89, 0xd2, 0x04, 0x70, 0x83, 0x93, 0x6c, 0x0a, 0x3b, 0x96, 0x0b,
+	0x2a, 0x6c, 0x83, 0x1b, 0x91, 0x5d, 0x84, 0xda, 0x2c, 0x99, 0x46, 0xc1, 0xc2, 0xab, 0x90, 0x31,
+	0xd3, 0xd8, 0x15, 0xd8, 0xc0, 0xba, 0x63, 0xa1, 0xe7, 0xa9, 0xf4, 0xaa, 0xe4, 0x5a, 0x1a, 0xd8,
+	0x35, 0x80, 0x20, 0x95, 0xa1, 0x8c, 0x75, 0x24, 0xa6, 0xde, 0x3a, 0xb9, 0x4b, 0x16, 0xd6, 0x81,
+	0xc6, 0xc7, 0xc7, 0x27, 0x9f, 0x9e, 0x09, 0x2d, 0xbd, 0x1a, 0x79, 0x0b, 0xdd, 0xff, 0xe1, 0x80,
+	0x5b, 0x1e, 0x07, 0x81, 0xc5, 0x84, 0xa8, 0xc5, 0x2a, 0x48, 0x42, 0x99, 0x66, 0x90, 0x4b, 0x16,
+	0x76, 0x1f, 0xda, 0x3a, 0x0a, 0x8e, 0xa5, 0x1e, 0xcd, 0x44, 0x2a, 0x4e, 0x14, 0x95, 0xd0, 0xec,
+	0x6d, 0x51, 0x03, 0x87, 0xe4, 0xe9, 0x93, 0x83, 0xb7, 0x74, 0x49, 0x33, 0xe5, 0xa5, 0x72, 0x12,
+	0x25, 0x71, 0x5e, 0x9e, 0xd5, 0x98, 0x0f, 0xad, 0x40, 0xcc, 0xc4, 0x61, 0x34, 0x8d, 0x74, 0x24,
+	0x15, 0x56, 0x58, 0x41, 0xef, 0x8a, 0x0d, 0xa7, 0x55, 0xcf, 0x86, 0xe7, 0x6d, 0xa3, 0xbb, 0xd9,
+	0x6b, 0x96, 0x86, 0xcc, 0x73, 0x9f, 0xff, 0xd5, 0x81, 0xfa, 0x40, 0x4e, 0xb0, 0x36, 0x61, 0xca,
+	0x38, 0x11, 0x71, 0x34, 0xc6, 0xda, 0xf6, 0xc2, 0x8c, 0x55, 0x25, 0x0b, 0x11, 0x4b, 0xbe, 0x23,
+	0xf0, 0x15, 0x6e, 0x44, 0x9a, 0x92, 0x50, 0x47, 0x04, 0xaf, 0xc5, 0x49, 0x36, 0xdd, 0x43, 0x7e,
+	0x8f, 0xa3, 0x29, 0x01, 0x33, 0xf6, 0x42, 0xcf, 0xa9, 0xb9, 0x5e, 0x50, 0xf3, 0x7f, 0x61, 0xde,
+	0x81, 0x0b, 0xc3, 0xbc, 0x9f, 0x21, 0xe2, 0x3d, 0xc1, 0x51, 0x11, 0x66, 0xcc, 0x38, 0x4f, 0xa7,
+	0x59, 0xcf, 0x8d, 0xe8, 0xbf, 0x85, 0x76, 0x11, 0x4a, 0x21, 0xf7, 0xa1, 0xa1, 0xec, 0x09, 0xb3,
+	0x2a, 0xe6, 0x8e, 0x8e, 0x6d, 0xfc, 0xef, 0x12, 0xf2, 0x22, 0xf6, 0x37, 0x7b, 0x94, 0xc0, 0x66,
+	0x71, 0x88, 0x4b, 0x35, 0x9f, 0xea, 0xbc, 0x27, 0xce, 0xb2, 0x27, 0x17, 0x61, 0x5d, 0xa6, 0x69,
+	0x92, 0x5a, 0x9e, 0xbe, 0x3c, 0xc3, 0xad, 0xca, 0x6e, 0x43, 0x35, 0xc4, 0x0b, 0xa8, 0x57, 0xcd,
+	0x1e, 0x5b, 0x85, 0x60, 0xae, 0xc6, 0x50, 0x8a, 0x78, 0xd2, 0x30, 0x63, 0x37, 0xd9, 0xb1, 0xec,
+	0x4d, 0x8e, 0x23, 0x57, 0x5a, 0x16, 0x7b, 0x8f, 0x9c, 0x50, 0x12, 0xc9, 0x9a, 0xaf, 0x46, 0xa6,
+	0xf9, 0xaf, 0xa1, 0xbd, 0x9f, 0xe8, 0x68, 0xbc, 0xc8, 0x8a, 0x39, 0xdd, 0x19, 0x73, 0x54, 0x0b,
+	0x75, 0x8c, 0xb3, 0x75, 0x09, 0x6e, 0xa6, 0xad, 0x4c, 0x6c, 0x6b, 0x75, 0x62, 0xfe, 0x37, 0x07,
+	0x5a, 0x65, 0x86, 0x9a, 0xd5, 0x4a, 0x65, 0x10, 0xcd, 0x22, 0xbc, 0x23, 0xe3, 0xc8, 0xd2, 0xc0,
+	0xae, 0x02, 0x8c, 0x45, 0x20, 0x47, 0xf6, 0x1d, 0xb3, 0xad, 0xdb, 0x30, 0x96, 0x37, 0xc6, 0xc0,
+	0x2e, 0x43, 0xe3, 0x43, 0x14, 0x8f, 0x30, 0xfb, 0x61, 0xc6, 0x99, 0x3a, 0xea, 0x7d, 0x54, 0x59,
+	0x17, 0xce, 0x15, 0x69, 0x46, 0xd8, 0x96, 0x70, 0x44, 0xcc, 0xb2, 0x0c, 0xda, 0x2a, 0x5c, 0x1c,
+	0x3d, 0x2f, 0x0d, 0xcd, 0x90, 0x7a, 0x4a, 0xca, 0x30, 0xe3, 0x12, 0xc9, 0xfe, 0x77, 0x7c, 0xe7,
+	0x2c, 0xd8, 0x7f, 0xc0, 0xa4, 0x26, 0xc6, 0x66, 0x59, 0x2d, 0xc4, 0x4c, 0xfb, 0x05, 0x7e, 0xe5,
+	0x6f, 0xf0, 0xab, 0xab, 0xf0, 0xaf, 0x43, 0xcb, 0xe6, 0x18, 0xc5, 0x49, 0x1c, 0x48, 0x82, 0xd5,
+	0xc6, 0xf7, 0x93, 0x6c, 0xfb, 0xc6, 0xf4, 0xa7, 0x0a, 0x6b, 0x7f, 0xa8, 0xd0, 0x1f, 0x42, 0xbd,
+	0x2f, 0x16, 0x34, 0xcb, 0x1b, 0x38, 0x39, 0xaa, 0x8b, 0x4a, 0xc9, 0x97, 0xc4, 0x96, 0xca, 0x33,
+	0xd7, 0x69, 0xbe, 0x16, 0x3d, 0xaa, 0x2c, 0x7b, 0xd4, 0xfb, 0x08, 0xad, 0xf2, 0xfb, 0xc5, 0x9e,
+	0xc0, 0xe6, 0xae, 0xd4, 0x2b, 0x26, 0xcf, 0xae, 0xe0, 0xe9, 0x4f, 0xa7, 0x73, 0xe1, 0x94, 0x87,
+	0xde, 0xbf, 0x9b, 0x50, 0x35, 0x9f, 0x18, 0xb3, 0x3f, 0x42, 0xfe, 0x9f, 0x75, 0x56, 0xd5, 0xde,
+	0x3e, 0xc0, 0x70, 0xf9, 0x26, 0x3e, 0x02, 0x96, 0x53, 0xbb, 0x64, 0x3d, 0x4f, 0x47, 0x7e, 0xe1,
+	0x7c, 0xc7, 0x2e, 0xcb, 0x0a, 0xbd, 0xef, 0x39, 0x87, 0x35, 0xfa, 0x46, 0x77, 0x7e, 0x02, 0xa6,
+	0xfd, 0x6c, 0x73, 0x5a, 0x07, 0x00, 0x00,
 }
 
 // Reference imports to suppress errors if they are not otherwise used.
@@ -1,12 +1,20 @@
 package server
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
+	"math"
 	"math/big"
+	"math/rand"
+	"net/url"
 	"regexp"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/golang/glog"
 
@@ -17,29 +25,523 @@ import (
 	"github.com/livepeer/go-livepeer/core"
 	"github.com/livepeer/go-livepeer/drivers"
 	"github.com/livepeer/go-livepeer/monitor"
+	"github.com/livepeer/go-livepeer/net"
 	"github.com/livepeer/go-livepeer/pm"
 
+	"github.com/livepeer/lpms/ffmpeg"
 	"github.com/livepeer/lpms/stream"
 )
 
-func selectOrchestrator(n *core.LivepeerNode, cpl core.PlaylistManager) (*BroadcastSession, error) {
+var ErrUploadConcurrencyExceeded = errors.New("ErrUploadConcurrencyExceeded")
+var ErrSegmentTooLarge = errors.New("ErrSegmentTooLarge")
+
+// Maximum size of a source segment, in bytes. Larger segments are dropped.
+var MaxSegmentSize int64 = 50 * 1024 * 1024
+
+// Maximum number of concurrent segment uploads to orchestrator object storage
+var MaxUploadConcurrency = 50
+
+var uploadSem chan struct{}
+var uploadSemOnce sync.Once
+
+func acquireUploadSlot() bool {
+	uploadSemOnce.Do(func() {
+		uploadSem = make(chan struct{}, MaxUploadConcurrency)
+	})
+	select {
+	case uploadSem <- struct{}{}:
+		if monitor.Enabled {
+			monitor.UploadConcurrency(len(uploadSem))
+		}
+		return true
+	default:
+		return false
+	}
+}
+
+func releaseUploadSlot() {
+	<-uploadSem
+	if monitor.Enabled {
+		monitor.UploadConcurrency(len(uploadSem))
+	}
+}
+
+// Maximum number of times a segment is resubmitted to the orchestrator after
+// an error that doesn't end the session. Zero disables retries.
+var MaxSegmentRetries = 0
+
+// Backoff before the first resubmission of a segment; doubled after every
+// retry up to SegmentRetryMaxBackoff. The actual wait is picked at random up
+// to the backoff so retries from different segments don't line up.
+var SegmentRetryBackoff = 250 * time.Millisecond
+var SegmentRetryMaxBackoff = 2 * time.Second
+
+// How old a segment can get, counting from when it was received, before it
+// is no longer resubmitted. Zero means twice the segment length.
+var SegmentRetryDeadline time.Duration
+
+// Number of segments currently being resubmitted
+var retryBacklog int64
+
+func updateRetryBacklog(delta int64) {
+	n := atomic.AddInt64(&retryBacklog, delta)
+	if monitor.Enabled {
+		monitor.TranscodeRetryBacklog(int(n))
+	}
+}
+
+// retryWait returns how long to wait before the given retry, with full jitter
+func retryWait(retry int) time.Duration {
+	backoff := SegmentRetryBackoff << uint(retry)
+	if backoff > SegmentRetryMaxBackoff || backoff <= 0 {
+		backoff = SegmentRetryMaxBackoff
+	}
+	if backoff <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(backoff) + 1))
+}
+
+// submitSegmentWithRetries submits the segment, resubmitting it with backoff
+// on errors that don't end the stream or session, until MaxSegmentRetries
+// retries are made or the segment, received at emerged, is older than
+// SegmentRetryDeadline
+func submitSegmentWithRetries(ctx context.Context, sess *BroadcastSession, seg *stream.HLSSegment, nonce uint64, emerged time.Time) (*net.TranscodeData, error) {
+	submit := func() (*net.TranscodeData, error) {
+		start := time.Now()
+		res, err := SubmitSegment(ctx, sess, seg, nonce)
+		if ctx.Err() == nil {
+			orchPerf.record(sess.OrchestratorInfo.GetTranscoder(), time.Since(start), err)
+		}
+		return res, err
+	}
+	deadline := segmentDeadline(emerged, segDuration(seg))
+
+	res, err := submit()
+	retries := 0
+	for ; err != nil && MaxSegmentRetries > 0 && ctx.Err() == nil && !shouldStopStream(err) && !shouldStopSession(err); retries++ {
+		wait := retryWait(retries)
+		if retries >= MaxSegmentRetries || time.Now().Add(wait).After(deadline) {
+			if monitor.Enabled {
+				monitor.LogSegmentRetriesExhausted(nonce, seg.SeqNo, retries+1, err)
+			}
+			break
+		}
+		if retries == 0 {
+			updateRetryBacklog(1)
+		}
+		glog.Warningf("Resubmitting segment nonce=%d seqNo=%d retry=%d wait=%v err=%v", nonce, seg.SeqNo, retries+1, wait, err)
+		select {
+		case <-time.After(wait):
+			res, err = submit()
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+	}
+	if retries > 0 {
+		updateRetryBacklog(-1)
+	}
+	if monitor.Enabled {
+		monitor.LogSegmentRetries(nonce, seg.SeqNo, retries)
+	}
+	return res, err
+}
+
+// segmentDeadline is when a segment of length segLen received at emerged is
+// too old to be worth resubmitting
+func segmentDeadline(emerged time.Time, segLen time.Duration) time.Time {
+	deadlineAge := SegmentRetryDeadline
+	if deadlineAge <= 0 {
+		deadlineAge = 2 * segLen
+	}
+	return emerged.Add(deadlineAge)
+}
+
+// segDuration returns the duration of the segment, or SegLen if the
+// segmenter didn't report one
+func segDuration(seg *stream.HLSSegment) time.Duration {
+	if seg.Duration <= 0 {
+		return SegLen
+	}
+	return time.Duration(seg.Duration * float64(time.Second))
+}
+
+// downloadRendition downloads the rendition of seg at url, giving up after
+// the timeout for segments of its length
+func downloadRendition(ctx context.Context, seg *stream.HLSSegment, url string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, segmentTimeout(segDuration(seg)))
+	defer cancel()
+	return drivers.GetSegmentDataContext(ctx, url)
+}
+
+// validateRenditionURL checks a rendition URL returned by the orchestrator of
+// sess before it's downloaded. Renditions the orchestrator saved to the
+// broadcaster's own storage, or hosts itself, are always allowed.
+func validateRenditionURL(sess *BroadcastSession, uri string) error {
+	if drivers.IsOwnExternal(uri) {
+		return nil
+	}
+	var orchHost string
+	if u, err := url.Parse(sess.OrchestratorInfo.GetTranscoder()); err == nil {
+		orchHost = u.Host
+	}
+	return drivers.ValidateSegmentURL(uri, orchHost)
+}
+
+// Number of orchestrators each segment is submitted to in parallel. The first
+// valid response is used and the other submissions are cancelled, trading
+// the cost of paying several orchestrators for lower tail latency.
+var RedundantSubmissions = 1
+
+// submitSegmentRedundant submits the segment to all sessions in parallel and
+// returns the session that responded first with a result. If none did, the
+// error of the first session is returned so it can be refreshed.
+func submitSegmentRedundant(ctx context.Context, sessions []*BroadcastSession, seg *stream.HLSSegment, nonce uint64, emerged time.Time) (*BroadcastSession, *net.TranscodeData, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		sess *BroadcastSession
+		res  *net.TranscodeData
+		err  error
+	}
+	results := make(chan result, len(sessions))
+	for i, sess := range sessions {
+		sseg := seg
+		if i > 0 {
+			// only the first orchestrator can read the segment from its
+			// storage; send the data to the others
+			cp := *seg
+			cp.Name = ""
+			sseg = &cp
+		}
+		go func(sess *BroadcastSession, seg *stream.HLSSegment) {
+			res, err := submitSegmentWithRetries(ctx, sess, seg, nonce, emerged)
+			results <- result{sess: sess, res: res, err: err}
+		}(sess, sseg)
+	}
+
+	var primaryErr error
+	for range sessions {
+		r := <-results
+		if r.err == nil && r.res != nil {
+			glog.V(common.DEBUG).Infof("Using redundant submission result nonce=%d seqNo=%d orchestrator=%s", nonce, seg.SeqNo, r.sess.OrchestratorInfo.GetTranscoder())
+			return r.sess, r.res, nil
+		}
+		if r.sess == sessions[0] {
+			primaryErr = r.err
+		}
+	}
+	return sessions[0], nil, primaryErr
+}
+
+// CompareSubmissions enables a high assurance mode in which each segment is
+// submitted to two orchestrators and their renditions are only used if they
+// are identical. If they differ, the segment is submitted to further
+// orchestrators until two agree. Segments are skipped while there's no second
+// orchestrator to compare against. Requires deterministic transcoding.
+var CompareSubmissions = false
+
+// ErrRenditionMismatch is returned when no two orchestrators returned
+// identical renditions of a segment
+var ErrRenditionMismatch = errors.New("ErrRenditionMismatch")
+
+// ErrNoComparison is logged when a segment is skipped because there's no
+// orchestrator to compare its renditions against
+var ErrNoComparison = errors.New("ErrNoComparison")
+
+// submitSegmentCompared submits the segment to the first two sessions in
+// parallel, then to one more session at a time, until two of them return
+// renditions with the same hashes, and returns the first of those along with
+// the renditions downloaded to hash them. The orchestrators that returned
+// other renditions are suspended.
+func submitSegmentCompared(ctx context.Context, sessions []*BroadcastSession, seg *stream.HLSSegment, nonce uint64, emerged time.Time) (*BroadcastSession, *net.TranscodeData, [][]byte, error) {
+	type result struct {
+		sess *BroadcastSession
+		res  *net.TranscodeData
+		data [][]byte
+		hash []byte
+		err  error
+	}
+	submit := func(i int) result {
+		sess, sseg := sessions[i], seg
+		if i > 0 {
+			// only the first orchestrator can read the segment from its
+			// storage; send the data to the others
+			cp := *seg
+			cp.Name = ""
+			sseg = &cp
+		}
+		res, err := submitSegmentWithRetries(ctx, sess, sseg, nonce, emerged)
+		if err != nil {
+			return result{sess: sess, err: err}
+		}
+		if res == nil {
+			return result{sess: sess, err: errors.New("no transcode result")}
+		}
+		hash, data, err := renditionsHash(ctx, sess, sseg, res)
+		return result{sess: sess, res: res, data: data, hash: hash, err: err}
+	}
+
+	var results []result
+	var primaryErr error
+	for next := 0; next < len(sessions); {
+		batch := 1
+		if next == 0 {
+			batch = 2
+		}
+		ch := make(chan result, batch)
+		started := 0
+		for ; started < batch && next < len(sessions); started++ {
+			go func(i int) { ch <- submit(i) }(next)
+			next++
+		}
+		for ; started > 0; started-- {
+			r := <-ch
+			if r.err != nil {
+				if r.sess == sessions[0] {
+					primaryErr = r.err
+				}
+				glog.Errorf("Error submitting segment for comparison nonce=%d seqNo=%d orchestrator=%s err=%v", nonce, seg.SeqNo, r.sess.OrchestratorInfo.GetTranscoder(), r.err)
+				continue
+			}
+			results = append(results, r)
+		}
+
+		for i, a := range results {
+			for _, b := range results[i+1:] {
+				if !bytes.Equal(a.hash, b.hash) {
+					continue
+				}
+				for _, r := range results {
+					if !bytes.Equal(r.hash, a.hash) {
+						addr := r.sess.OrchestratorInfo.GetTranscoder()
+						glog.Errorf("Renditions differ from the agreed ones nonce=%d seqNo=%d orchestrator=%s", nonce, seg.SeqNo, addr)
+						if monitor.Enabled {
+							monitor.LogOrchestratorFailed(addr, ErrRenditionMismatch.Error())
+						}
+						orchSuspensions.penalize(addr)
+					}
+				}
+				return a.sess, a.res, a.data, nil
+			}
+		}
+		if len(results) > 1 {
+			glog.Warningf("Orchestrators returned differing renditions nonce=%d seqNo=%d; submitting to another", nonce, seg.SeqNo)
+		}
+	}
+
+	if len(results) > 1 {
+		return sessions[0], nil, nil, ErrRenditionMismatch
+	}
+	if primaryErr == nil {
+		primaryErr = ErrRenditionMismatch
+	}
+	return sessions[0], nil, nil, primaryErr
+}
+
+// renditionsHash downloads the renditions of seg in res, returned by the
+// orchestrator of sess, and returns the Keccak hash of their hashes along
+// with the renditions
+func renditionsHash(ctx context.Context, sess *BroadcastSession, seg *stream.HLSSegment, res *net.TranscodeData) ([]byte, [][]byte, error) {
+	renditions := make([][]byte, len(res.Segments))
+	hashes := make([][]byte, len(res.Segments))
+	for i, v := range res.Segments {
+		if err := validateRenditionURL(sess, v.Url); err != nil {
+			return nil, nil, err
+		}
+		data, err := downloadRendition(ctx, seg, v.Url)
+		if err != nil {
+			return nil, nil, err
+		}
+		renditions[i] = data
+		hashes[i] = crypto.Keccak256(data)
+	}
+	return crypto.Keccak256(hashes...), renditions, nil
+}
+
+// How long a segment sequence number is remembered for duplicate detection
+var DuplicateSegmentTTL = 5 * time.Minute
+
+type segmentKey struct {
+	nonce uint64
+	seqNo uint64
+}
+
+var seenSegments sync.Map // segmentKey -> struct{}
+
+// checkDuplicateSegment returns true if the segment was already seen within
+// DuplicateSegmentTTL; otherwise it remembers the segment until the TTL expires
+func checkDuplicateSegment(nonce, seqNo uint64) bool {
+	key := segmentKey{nonce: nonce, seqNo: seqNo}
+	if _, seen := seenSegments.LoadOrStore(key, struct{}{}); seen {
+		return true
+	}
+	time.AfterFunc(DuplicateSegmentTTL, func() { seenSegments.Delete(key) })
+	return false
+}
+
+// forgetSegments forgets the segments of the stream with nonce seen for
+// duplicate detection
+func forgetSegments(nonce uint64) {
+	seenSegments.Range(func(k, v interface{}) bool {
+		if k.(segmentKey).nonce == nonce {
+			seenSegments.Delete(k)
+		}
+		return true
+	})
+}
+
+// checkSequenceRestart returns true if the segment trails the latest segment
+// by more than LiveWindow, which happens when the encoder restarts its
+// numbering rather than for late segments
+func (cxn *rtmpConnection) checkSequenceRestart(seqNo uint64) bool {
+	return cxn.seqSeen && core.IsStaleSegment(seqNo, cxn.lastSeqNo)
+}
+
+// checkSegmentOrder returns true if the segment arrived after a segment with a
+// higher sequence number; otherwise it records seqNo as the latest segment
+func (cxn *rtmpConnection) checkSegmentOrder(seqNo uint64) bool {
+	if cxn.seqSeen && seqNo < cxn.lastSeqNo {
+		return true
+	}
+	cxn.lastSeqNo, cxn.seqSeen = seqNo, true
+	return false
+}
+
+// probeTracks publishes the stream under an audio profile, and stops
+// transcoding it, if its first segment has no video. Returns true if the
+// stream is audio-only.
+func (cxn *rtmpConnection) probeTracks(seg *stream.HLSSegment) bool {
+	cxn.lock.Lock()
+	defer cxn.lock.Unlock()
+	if !cxn.probed {
+		cxn.probed = true
+		if isAudioOnly(seg.Data) {
+			profile := audioOnlyProfile(seg)
+			glog.Infof("Stream without video manifestID=%s; publishing as profile=%s bitrate=%s", cxn.mid, profile.Name, profile.Bitrate)
+			cxn.profile = &profile
+			cxn.profiles = nil
+			cxn.audioOnly = true
+		}
+	}
+	return cxn.audioOnly
+}
+
+// audioOnlyProfile returns the profile a segment without video is published
+// under. Audio isn't re-encoded, so the profile advertises the codec and
+// bitrate of the segment itself: AudioOnlyProfile if it has the codec of the
+// segment, else the default profile for that codec, with the bitrate the
+// segment was measured at.
+func audioOnlyProfile(seg *stream.HLSSegment) ffmpeg.VideoProfile {
+	p := AudioOnlyProfile
+	if codec := audioCodec(seg.Data); codec != p.Codec {
+		p = common.DefaultAudioProfiles[codec]
+	}
+	profile := p.VideoProfile()
+	kbps := int(math.Ceil(float64(len(seg.Data)*8) / segDuration(seg).Seconds() / 1000))
+	profile.Bitrate = strconv.Itoa(kbps) + "k"
+	return profile
+}
+
+func selectOrchestrator(n *core.LivepeerNode, cpl core.PlaylistManager, profiles []ffmpeg.VideoProfile) (*BroadcastSession, error) {
 
 	if n.OrchestratorPool == nil {
 		glog.Info("No orchestrators specified; not transcoding")
 		return nil, ErrDiscovery
 	}
 
-	rpcBcast := core.NewBroadcaster(n)
-
-	tinfos, err := n.OrchestratorPool.GetOrchestrators(1)
-	if len(tinfos) <= 0 {
+	start := time.Now()
+	// ask for candidates in more than one region if regions are preferred
+	count := OrchSelection.Candidates()
+	if len(PreferredRegions) > 0 && count < SelectionCandidates {
+		count = SelectionCandidates
+	}
+	candidates, err := discoverCandidates(n.OrchestratorPool, count, "")
+	if monitor.Enabled {
+		monitor.LogDiscoveryLatency(time.Since(start))
+	}
+	if ProbeOrchestrators && len(candidates) > 0 {
+		candidates = probeOrchestrators(candidates)
+	}
+	if len(candidates) == 0 {
 		glog.Info("No orchestrators found; not transcoding. Error: ", err)
 		return nil, ErrNoOrchs
 	}
 	if err != nil {
 		return nil, err
 	}
-	tinfo := tinfos[0]
+	return newBroadcastSession(n, cpl, OrchSelection.Select(preferRegion(candidates)), profiles), nil
+}
+
+// selectRedundantOrchestrators returns sessions with up to count
+// orchestrators other than the one of primary, for segments to be submitted
+// to in parallel
+func selectRedundantOrchestrators(n *core.LivepeerNode, cpl core.PlaylistManager, primary *BroadcastSession, count int) []*BroadcastSession {
+	if n.OrchestratorPool == nil || count <= 0 {
+		return nil
+	}
+	candidates, err := discoverCandidates(n.OrchestratorPool, count, primary.OrchestratorInfo.GetTranscoder())
+	if err != nil {
+		glog.Error("Error getting redundant orchestrators: ", err)
+		return nil
+	}
+	if ProbeOrchestrators && len(candidates) > 0 {
+		candidates = probeOrchestrators(candidates)
+	}
+	var sessions []*BroadcastSession
+	for _, ti := range candidates {
+		if len(sessions) >= count {
+			break
+		}
+		sessions = append(sessions, newBroadcastSession(n, cpl, ti, primary.Profiles))
+	}
+	return sessions
+}
+
+// discoverCandidates returns orchestrators from discovery that aren't
+// suspended or excluded and that meet the constraints of the broadcaster.
+// Pools that stream orchestrators are only read until count of those
+// responded, so a session can start as soon as the first viable one does.
+func discoverCandidates(pool net.OrchestratorPool, count int, exclude string) ([]*net.OrchestratorInfo, error) {
+	constraints := discoveryConstraints()
+	viable := func(ti *net.OrchestratorInfo) bool {
+		addr := ti.GetTranscoder()
+		return addr != exclude && !orchSuspensions.isSuspended(addr) && !overPriced(ti) && constraints.Capable(ti)
+	}
+	// ask for enough orchestrators to get candidates that aren't suspended
+	num := count + orchSuspensions.len()
+	if exclude != "" {
+		num++
+	}
+
+	var candidates []*net.OrchestratorInfo
+	if ipool, ok := pool.(net.IncrementalOrchestratorPool); ok {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		for ti := range ipool.StreamOrchestrators(ctx, num, constraints) {
+			if viable(ti) {
+				candidates = append(candidates, ti)
+			}
+			if len(candidates) >= count {
+				break
+			}
+		}
+		return candidates, nil
+	}
+
+	tinfos, err := pool.GetOrchestrators(num, constraints)
+	for _, ti := range tinfos {
+		if viable(ti) {
+			candidates = append(candidates, ti)
+		}
+	}
+	return candidates, err
+}
+
+func newBroadcastSession(n *core.LivepeerNode, cpl core.PlaylistManager, tinfo *net.OrchestratorInfo, profiles []ffmpeg.VideoProfile) *BroadcastSession {
+	rpcBcast := core.NewBroadcaster(n)
+	orchPerf.recordPrice(tinfo.GetTranscoder(), ticketEV(tinfo))
 
 	var sessionID string
 
@@ -54,6 +556,9 @@ func selectOrchestrator(n *core.LivepeerNode, cpl core.PlaylistManager) (*Broadc
 		}
 
 		sessionID = n.Sender.StartSession(params)
+		if monitor.Enabled {
+			monitor.LogPMSessionStarted(sessionID, tinfo.Transcoder)
+		}
 	}
 
 	// set OSes
@@ -72,36 +577,101 @@ func selectOrchestrator(n *core.LivepeerNode, cpl core.PlaylistManager) (*Broadc
 	return &BroadcastSession{
 		Broadcaster:      rpcBcast,
 		ManifestID:       cpl.ManifestID(),
-		Profiles:         BroadcastJobVideoProfiles,
+		Profiles:         profiles,
 		OrchestratorInfo: tinfo,
 		OrchestratorOS:   orchOS,
 		BroadcasterOS:    bcastOS,
 		Sender:           n.Sender,
 		PMSessionID:      sessionID,
-	}, nil
+	}
 }
 
 func processSegment(cxn *rtmpConnection, seg *stream.HLSSegment) {
+	defer monitor.RecoverAndReport("processSegment")
+	atomic.AddInt32(&cxn.inFlight, 1)
+	defer atomic.AddInt32(&cxn.inFlight, -1)
+	emerged := time.Now()
 
 	nonce := cxn.nonce
-	rtmpStrm := cxn.stream
 	cpl := cxn.pl
 	mid := cxn.mid
-	vProfile := cxn.profile
+
+	ctx, span := monitor.StartSegmentSpan(context.Background(), "ProcessSegment", nonce, seg.SeqNo)
+	defer span.End()
 
 	cxn.lock.RLock()
 	sess := cxn.sess
+	redundant := cxn.redundant
+	profiles := cxn.profiles
 	cxn.lock.RUnlock()
 
+	if size := int64(len(seg.Data)); size > MaxSegmentSize {
+		glog.Errorf("Dropping oversized segment manifestID=%s nonce=%d seqNo=%d size=%d max=%d", mid, nonce, seg.SeqNo, size, MaxSegmentSize)
+		if monitor.Enabled {
+			monitor.LogSegmentOversized(nonce, seg.SeqNo, size)
+			monitor.LogSegmentUploadFailed(nonce, seg.SeqNo, monitor.SegmentUploadErrorUnknown, ErrSegmentTooLarge.Error())
+		}
+		return
+	}
+
+	if cxn.checkIngestBitrate(seg) {
+		rejectStream(nonce, rejectIngestBitrate)
+		cxn.stream.Close()
+		return
+	}
+
+	// encoders that reconnect may number segments from the start again
+	if cxn.checkSequenceRestart(seg.SeqNo) {
+		glog.Warningf("Segment numbering restarted manifestID=%s nonce=%d seqNo=%d lastSeqNo=%d window=%d", mid, nonce, seg.SeqNo, cxn.lastSeqNo, core.LiveWindow)
+		forgetSegments(nonce)
+		cxn.pl.RestartHLSSequence()
+		cxn.seqSeen = false
+	}
+
+	// drop repeated segments
+	if checkDuplicateSegment(nonce, seg.SeqNo) {
+		glog.Warningf("Dropping duplicate segment manifestID=%s nonce=%d seqNo=%d", mid, nonce, seg.SeqNo)
+		if monitor.Enabled {
+			monitor.LogDuplicateSegment(nonce, seg.SeqNo)
+		}
+		return
+	} else if cxn.checkSegmentOrder(seg.SeqNo) {
+		glog.Warningf("Out of order segment manifestID=%s nonce=%d seqNo=%d lastSeqNo=%d", mid, nonce, seg.SeqNo, cxn.lastSeqNo)
+		if monitor.Enabled {
+			monitor.LogOutOfOrderSegment(nonce, seg.SeqNo)
+		}
+	}
+
+	// only segments that weren't dropped emerge; the lost segment watcher
+	// would otherwise wait on them forever
 	if monitor.Enabled {
-		monitor.LogSegmentEmerged(nonce, seg.SeqNo, len(BroadcastJobVideoProfiles))
+		monitor.LogSegmentEmergedWithSize(nonce, seg.SeqNo, len(profiles), int64(len(seg.Data)))
+		monitor.LogBytesTransferred(monitor.BytesIngress, nonce, int64(len(seg.Data)))
+		monitor.LogSegmentTrace(nonce, seg.SeqNo, span.SpanContext())
+	}
+
+	if seg.Duration > 0 && monitor.Enabled {
+		dur := time.Duration(seg.Duration * float64(time.Second))
+		monitor.LogSegmentDurationDrift(nonce, seg.SeqNo, dur-cxn.segLen)
 	}
 
+	if codec := codecFingerprint(seg.Data); codec != "" {
+		if cxn.codec != "" && cxn.codec != codec {
+			glog.Warningf("Codec changed mid-stream manifestID=%s seqNo=%d from=%s to=%s", mid, seg.SeqNo, cxn.codec, codec)
+			if monitor.Enabled {
+				monitor.LogCodecChange(nonce, seg.SeqNo, cxn.codec, codec)
+			}
+		}
+		cxn.codec = codec
+	}
+	audioOnly := cxn.probeTracks(seg)
+	vProfile := cxn.profile
+
 	seg.Name = "" // hijack seg.Name to convey the uploaded URI
-	name := fmt.Sprintf("%s/%d.ts", vProfile.Name, seg.SeqNo)
+	name := segmentName(vProfile.Name, seg.SeqNo, seg.Data)
 	uri, err := cpl.GetOSSession().SaveData(name, seg.Data)
 	if err != nil {
-		glog.Errorf("Error saving segment %d: %v", seg.SeqNo, err)
+		monitor.GetSampledLogger().Error("Error saving segment", map[string]interface{}{monitor.LogFieldNonce: nonce, monitor.LogFieldSeqNo: seg.SeqNo, "error": err})
 		if monitor.Enabled {
 			monitor.LogSegmentUploadFailed(nonce, seg.SeqNo, monitor.SegmentUploadErrorUnknown, err.Error())
 		}
@@ -109,145 +679,393 @@ func processSegment(cxn *rtmpConnection, seg *stream.HLSSegment) {
 	}
 	if cpl.GetOSSession().IsExternal() {
 		seg.Name = uri // hijack seg.Name to convey the uploaded URI
+		if monitor.Enabled {
+			monitor.LogBytesTransferred(monitor.BytesEgressOS, nonce, int64(len(seg.Data)))
+		}
 	}
+	_, insertSpan := monitor.StartProfileSpan(ctx, "PlaylistInsert", nonce, seg.SeqNo, vProfile.Name)
 	err = cpl.InsertHLSSegment(vProfile, seg.SeqNo, uri, seg.Duration)
+	monitor.EndSpan(insertSpan, err)
 	if monitor.Enabled {
+		monitor.LogPlaylistInsert(nonce, vProfile.Name)
 		monitor.LogSourceSegmentAppeared(nonce, seg.SeqNo, string(mid), vProfile.Name)
 		glog.V(6).Infof("Appeared segment %d", seg.SeqNo)
 	}
 	if err != nil {
-		glog.Errorf("Error inserting segment %d: %v", seg.SeqNo, err)
+		monitor.GetSampledLogger().Error("Error inserting segment", map[string]interface{}{monitor.LogFieldNonce: nonce, monitor.LogFieldSeqNo: seg.SeqNo, "error": err})
 		if monitor.Enabled {
+			monitor.LogPlaylistInsertFailed(nonce, seg.SeqNo, vProfile.Name, err.Error())
 			monitor.LogSegmentUploadFailed(nonce, seg.SeqNo, monitor.SegmentUploadErrorUnknown, err.Error())
 		}
+	} else {
+		cxn.insertDASHSegment(vProfile, seg.SeqNo, seg.Data, true)
+		if cxn.recording != nil {
+			cxn.recording.add(vProfile, seg.SeqNo, uri, seg.Duration)
+		}
 	}
 
 	// Return early under a few circumstances:
+	// Segments without video, which can't be transcoded into video profiles
+	if audioOnly || isAudioOnly(seg.Data) {
+		glog.V(common.DEBUG).Infof("Passing through segment without video manifestID=%s nonce=%d seqNo=%d", mid, nonce, seg.SeqNo)
+		return
+	}
 	// View-only (non-transcoded) streams or mid-failover
 	if sess == nil {
-		if monitor.Enabled {
+		// fall back to transcoding on this node, if it can; the local
+		// transcode records its own outcome
+		if !transcodeLocally(ctx, cxn, seg, profiles, emerged) && monitor.Enabled {
 			monitor.LogSegmentTranscodeFailed(monitor.SegmentTranscodeErrorNoOrchestrators, nonce, seg.SeqNo, errors.New("No Orchestrators Error"))
 		}
 		return
 	}
 
 	// Process the rest of the segment asynchronously - transcode
+	atomic.AddInt32(&cxn.inFlight, 1)
 	go func() {
-		// storage the orchestrator prefers
-		if ios := sess.OrchestratorOS; ios != nil {
-			// XXX handle case when orch expects direct upload
-			uri, err := ios.SaveData(name, seg.Data)
-			if err != nil {
-				glog.Error("Error saving segment to OS ", err)
-				if monitor.Enabled {
-					monitor.LogSegmentUploadFailed(nonce, seg.SeqNo, monitor.SegmentUploadErrorOS, err.Error())
-				}
+		defer monitor.RecoverAndReport("transcodeSegment")
+		defer atomic.AddInt32(&cxn.inFlight, -1)
+		ctx, span := monitor.StartSegmentSpan(ctx, "TranscodeSegment", nonce, seg.SeqNo)
+		defer span.End()
+
+		sourceName := seg.Name
+		deadline := segmentDeadline(emerged, segDuration(seg))
+		err := transcodeSegment(ctx, cxn, sess, redundant, seg, name, emerged)
+		// resubmit segments that failed verification once the orchestrator
+		// that transcoded them is replaced
+		for _, unverified := err.(*VerificationError); unverified; _, unverified = err.(*VerificationError) {
+			prev := sess
+			if sess, redundant = awaitSessionChange(cxn, prev, deadline); sess == nil {
+				glog.Errorf("No orchestrator to resubmit unverified segment to manifestID=%s nonce=%d seqNo=%d", mid, nonce, seg.SeqNo)
 				return
 			}
+			glog.Warningf("Resubmitting unverified segment manifestID=%s nonce=%d seqNo=%d from=%s to=%s", mid, nonce, seg.SeqNo, prev.OrchestratorInfo.GetTranscoder(), sess.OrchestratorInfo.GetTranscoder())
+			seg.Name = sourceName
+			err = transcodeSegment(ctx, cxn, sess, redundant, seg, name, emerged)
+		}
+	}()
+}
+
+// transcodeSegment submits the segment to sess, or reuses a cached result
+// for it, and inserts the renditions into the playlist. Returns a
+// *VerificationError if the orchestrator returned renditions that failed
+// verification.
+func transcodeSegment(ctx context.Context, cxn *rtmpConnection, sess *BroadcastSession, redundant []*BroadcastSession,
+	seg *stream.HLSSegment, name string, emerged time.Time) error {
+
+	nonce := cxn.nonce
+	rtmpStrm := cxn.stream
+
+	// reuse the result if the same segment data was recently transcoded
+	if res := TranscodeCache.Get(seg.Data, sess.OrchestratorInfo.GetTranscoder()); res != nil {
+		glog.V(common.DEBUG).Infof("Using cached transcode result for segment %d", seg.SeqNo)
+		if monitor.Enabled {
+			monitor.LogTranscodeCache(true)
+		}
+		return handleTranscodeResult(ctx, cxn, sess, seg, res, nil)
+	}
+	if monitor.Enabled {
+		monitor.LogTranscodeCache(false)
+	}
+	if CompareSubmissions && len(redundant) <= 0 {
+		// don't let renditions through unchecked
+		glog.Errorf("Skipping segment with no orchestrator to compare against manifestID=%s nonce=%d seqNo=%d", cxn.mid, nonce, seg.SeqNo)
+		if monitor.Enabled {
+			monitor.LogSegmentTranscodeFailed(monitor.SegmentTranscodeErrorNoOrchestrators, nonce, seg.SeqNo, ErrNoComparison)
+		}
+		return nil
+	}
+
+	// storage the orchestrator prefers. Segments are sent inline to
+	// orchestrators without storage, and if the upload to its storage fails.
+	// Segments over the upload concurrency limit are dropped instead: sending
+	// them inline would bypass the limit.
+	direct := sess.expectsDirectUpload()
+	if ios := sess.OrchestratorOS; ios != nil {
+		if uri, err := uploadToOrchestratorOS(ctx, ios, name, seg, nonce); err == nil {
 			seg.Name = uri // hijack seg.Name to convey the uploaded URI
+		} else if err == ErrUploadConcurrencyExceeded {
+			return nil
+		} else {
+			glog.Warningf("Sending segment inline after failing to upload it to orchestrator storage nonce=%d seqNo=%d orchestrator=%s", nonce, seg.SeqNo, sess.OrchestratorInfo.GetTranscoder())
+			direct = true
 		}
+	}
+	if direct && seg.Name != "" {
+		// the orchestrator may not be able to read the broadcaster's
+		// storage; leave the URI of the caller's segment alone
+		cp := *seg
+		cp.Name = ""
+		seg = &cp
+	}
 
-		// send segment to the orchestrator
-		glog.V(common.DEBUG).Infof("Submitting segment %d", seg.SeqNo)
+	// send segment to the orchestrator
+	glog.V(common.DEBUG).Infof("Submitting segment %d", seg.SeqNo)
 
-		res, err := SubmitSegment(sess, seg, nonce)
-		if err != nil {
-			if shouldStopStream(err) {
-				glog.Warningf("Stopping current stream due to: %v", err)
-				rtmpStrm.Close()
-				return
-			}
-			if shouldStopSession(err) {
-				cxn.needOrch <- struct{}{}
-			}
-			return
+	var res *net.TranscodeData
+	var renditions [][]byte
+	var err error
+	if CompareSubmissions {
+		sess, res, renditions, err = submitSegmentCompared(ctx, append([]*BroadcastSession{sess}, redundant...), seg, nonce, emerged)
+	} else if len(redundant) > 0 {
+		sess, res, err = submitSegmentRedundant(ctx, append([]*BroadcastSession{sess}, redundant...), seg, nonce, emerged)
+	} else {
+		res, err = submitSegmentWithRetries(ctx, sess, seg, nonce, emerged)
+	}
+	if err != nil {
+		cxn.history.failed(sess.OrchestratorInfo.GetTranscoder())
+		if shouldStopStream(err) {
+			glog.Warningf("Stopping current stream due to: %v", err)
+			rtmpStrm.Close()
+			return nil
 		}
+		if shouldStopSession(err) {
+			orchSuspensions.penalize(sess.OrchestratorInfo.GetTranscoder())
+			cxn.requestSession()
+		}
+		return nil
+	}
+	if res == nil {
+		return nil
+	}
+	if err := handleTranscodeResult(ctx, cxn, sess, seg, res, renditions); err != nil {
+		cxn.history.failed(sess.OrchestratorInfo.GetTranscoder())
+		orchSuspensions.penalize(sess.OrchestratorInfo.GetTranscoder())
+		cxn.requestSession()
+		return err
+	}
+	cxn.history.transcoded(seg.SeqNo, sess.OrchestratorInfo.GetTranscoder())
+	orchSuspensions.recordSuccess(sess.OrchestratorInfo.GetTranscoder())
+	TranscodeCache.Add(seg.Data, sess.OrchestratorInfo.GetTranscoder(), res)
+	spotCheck(ctx, cxn, sess, seg, res)
+	return nil
+}
 
-		// download transcoded segments from the transcoder
-		gotErr := false // only send one error msg per segment list
-		errFunc := func(subType monitor.SegmentTranscodeError, url string, err error) {
-			glog.Errorf("%v error with segment %v: %v (URL: %v)", subType, seg.SeqNo, err, url)
-			if monitor.Enabled && !gotErr {
-				monitor.LogSegmentTranscodeFailed(subType, nonce, seg.SeqNo, err)
-				gotErr = true
-			}
+// uploadToOrchestratorOS saves the segment to the storage of the orchestrator
+// and returns its URI
+func uploadToOrchestratorOS(ctx context.Context, ios drivers.OSSession, name string, seg *stream.HLSSegment, nonce uint64) (string, error) {
+	if !acquireUploadSlot() {
+		monitor.GetSampledLogger().Error("Error saving segment to OS", map[string]interface{}{monitor.LogFieldNonce: nonce, monitor.LogFieldSeqNo: seg.SeqNo, "error": ErrUploadConcurrencyExceeded})
+		if monitor.Enabled {
+			monitor.LogSegmentUploadFailed(nonce, seg.SeqNo, monitor.SegmentUploadErrorOS, ErrUploadConcurrencyExceeded.Error())
 		}
-		if res == nil {
-			return
+		return "", ErrUploadConcurrencyExceeded
+	}
+	_, uploadSpan := monitor.StartSegmentSpan(ctx, "UploadSegment", nonce, seg.SeqNo)
+	uri, err := ios.SaveData(name, seg.Data)
+	monitor.EndSpan(uploadSpan, err)
+	releaseUploadSlot()
+	if err != nil {
+		monitor.GetSampledLogger().Error("Error saving segment to OS", map[string]interface{}{monitor.LogFieldNonce: nonce, monitor.LogFieldSeqNo: seg.SeqNo, "error": err})
+		if monitor.Enabled {
+			monitor.LogSegmentUploadFailed(nonce, seg.SeqNo, monitor.SegmentUploadErrorOS, err.Error())
 		}
+		return "", err
+	}
+	if monitor.Enabled {
+		monitor.LogBytesTransferred(monitor.BytesEgressOS, nonce, int64(len(seg.Data)))
+	}
+	return uri, nil
+}
 
-		segHashes := make([][]byte, len(res.Segments))
-		n := len(res.Segments)
-		segHashLock := &sync.Mutex{}
-		cond := sync.NewCond(segHashLock)
+// handleTranscodeResult downloads the transcoded segments in `res`, unless
+// they are already in `renditions`, verifies them if SegmentVerifier is set,
+// inserts them into the playlist and verifies the orchestrator signature.
+// Returns a *VerificationError if any rendition failed verification; none of
+// the renditions are inserted then.
+func handleTranscodeResult(ctx context.Context, cxn *rtmpConnection, sess *BroadcastSession, seg *stream.HLSSegment, res *net.TranscodeData, renditions [][]byte) error {
+	nonce := cxn.nonce
+	cpl := cxn.pl
 
-		dlFunc := func(url string, i int) {
-			defer func() {
-				cond.L.Lock()
-				n--
-				if n == 0 {
-					cond.Signal()
-				}
-				cond.L.Unlock()
-			}()
+	// download transcoded segments from the transcoder
+	gotErr := false // only send one error msg per segment list
+	var errCode monitor.SegmentTranscodeError
+	var verifyErr error
+	segHashLock := &sync.Mutex{}
+	errFunc := func(subType monitor.SegmentTranscodeError, url string, err error) {
+		monitor.GetSampledLogger().Error("Error with segment", map[string]interface{}{monitor.LogFieldNonce: nonce, monitor.LogFieldSeqNo: seg.SeqNo, "type": subType, "error": err, "url": url})
+		segHashLock.Lock()
+		defer segHashLock.Unlock()
+		if !gotErr {
+			if monitor.Enabled {
+				monitor.LogSegmentTranscodeFailed(subType, nonce, seg.SeqNo, err)
+			}
+			errCode = subType
+			gotErr = true
+		}
+	}
 
-			if bos := sess.BroadcasterOS; bos != nil && !drivers.IsOwnExternal(url) {
-				data, err := drivers.GetSegmentData(url)
-				if err != nil {
-					errFunc(monitor.SegmentTranscodeErrorDownload, url, err)
-					return
-				}
-				name := fmt.Sprintf("%s/%d.ts", sess.Profiles[i].Name, seg.SeqNo)
-				newUrl, err := bos.SaveData(name, data)
-				if err != nil {
-					switch err.Error() {
-					case "Session ended":
-						errFunc(monitor.SegmentTranscodeErrorSessionEnded, url, err)
-					default:
-						errFunc(monitor.SegmentTranscodeErrorSaveData, url, err)
-					}
-					return
-				}
-				url = newUrl
+	segHashes := make([][]byte, len(res.Segments))
+	segData := make([][]byte, len(res.Segments))
+	segVerified := make([]bool, len(res.Segments)) // downloaded and verified
+	segOk := make([]bool, len(res.Segments))       // inserted into the playlist
+	bos := sess.BroadcasterOS
+	copied := func(url string) bool { return bos != nil && !drivers.IsOwnExternal(url) }
+
+	// renditions are downloaded to be verified, and to be copied to the
+	// broadcaster's storage unless the orchestrator saved them there
+	verifyFunc := func(url string, i int) {
+		defer monitor.RecoverAndReport("verifyFunc")
+		ctx, span := monitor.StartProfileSpan(ctx, "DownloadSegment", nonce, seg.SeqNo, sess.Profiles[i].Name)
+		defer span.End()
 
-				hash := crypto.Keccak256(data)
+		var data []byte
+		if renditions != nil {
+			data = renditions[i]
+		} else if copied(url) || SegmentVerifier != nil {
+			if err := validateRenditionURL(sess, url); err != nil {
+				errFunc(monitor.SegmentTranscodeErrorDownload, url, err)
+				return
+			}
+			var err error
+			data, err = downloadRendition(ctx, seg, url)
+			if err != nil {
+				errFunc(monitor.SegmentTranscodeErrorDownload, url, err)
+				return
+			}
+		}
+		if SegmentVerifier != nil {
+			err := verifySegment(nonce, &VerificationParams{
+				ManifestID:   cxn.mid,
+				SeqNo:        seg.SeqNo,
+				Orchestrator: sess.OrchestratorInfo.GetTranscoder(),
+				Profile:      sess.Profiles[i],
+				Duration:     seg.Duration,
+				URL:          url,
+				Data:         data,
+			})
+			if err != nil {
+				errFunc(monitor.SegmentTranscodeErrorVerification, url, err)
 				segHashLock.Lock()
-				segHashes[i] = hash
+				verifyErr = err
 				segHashLock.Unlock()
+				return
 			}
+		}
+		segHashLock.Lock()
+		segData[i] = data
+		segVerified[i] = true
+		segHashLock.Unlock()
+	}
 
-			if monitor.Enabled {
-				monitor.LogTranscodedSegmentAppeared(nonce, seg.SeqNo, sess.Profiles[i].Name)
-			}
-			err = cpl.InsertHLSSegment(&sess.Profiles[i], seg.SeqNo, url, seg.Duration)
+	insertFunc := func(url string, i int) {
+		defer monitor.RecoverAndReport("insertFunc")
+		data := segData[i]
+		if copied(url) {
+			name := segmentName(sess.Profiles[i].Name, seg.SeqNo, data)
+			newUrl, err := bos.SaveData(name, data)
 			if err != nil {
-				errFunc(monitor.SegmentTranscodeErrorPlaylist, url, err)
+				switch err.Error() {
+				case "Session ended":
+					errFunc(monitor.SegmentTranscodeErrorSessionEnded, url, err)
+				default:
+					errFunc(monitor.SegmentTranscodeErrorSaveData, url, err)
+				}
 				return
 			}
+			url = newUrl
+			if monitor.Enabled && bos.IsExternal() {
+				monitor.LogBytesTransferred(monitor.BytesEgressOS, nonce, int64(len(data)))
+			}
+
+			hash := crypto.Keccak256(data)
+			segHashLock.Lock()
+			segHashes[i] = hash
+			segHashLock.Unlock()
 		}
 
-		for i, v := range res.Segments {
-			go dlFunc(v.Url, i)
+		if cxn.isDropped(sess.Profiles[i].Name) {
+			glog.V(common.DEBUG).Infof("Discarding removed rendition nonce=%d seqNo=%d profile=%s", nonce, seg.SeqNo, sess.Profiles[i].Name)
+			return
 		}
 
-		cond.L.Lock()
-		for n != 0 {
-			cond.Wait()
+		_, insertSpan := monitor.StartProfileSpan(ctx, "PlaylistInsert", nonce, seg.SeqNo, sess.Profiles[i].Name)
+		err := cpl.InsertHLSSegment(&sess.Profiles[i], seg.SeqNo, url, seg.Duration)
+		monitor.EndSpan(insertSpan, err)
+		if err == core.ErrStaleSegment {
+			// arrived after the live playlist moved past it
+			glog.Warningf("Discarding stale rendition nonce=%d seqNo=%d profile=%s", nonce, seg.SeqNo, sess.Profiles[i].Name)
+			return
 		}
-		cond.L.Unlock()
 		if monitor.Enabled {
-			monitor.SegmentFullyTranscoded(nonce, seg.SeqNo, common.ProfilesNames(sess.Profiles), len(segHashes) == len(res.Segments))
+			monitor.LogPlaylistInsert(nonce, sess.Profiles[i].Name)
+			if err != nil {
+				monitor.LogPlaylistInsertFailed(nonce, seg.SeqNo, sess.Profiles[i].Name, err.Error())
+			}
 		}
-
-		ticketParams := sess.OrchestratorInfo.GetTicketParams()
-		if ticketParams != nil && // may be nil in offchain mode
-			!pm.VerifySig(ethcommon.BytesToAddress(ticketParams.Recipient), crypto.Keccak256(segHashes...), res.Sig) {
-			glog.Error("Sig check failed for segment ", seg.SeqNo)
+		if err != nil {
+			errFunc(monitor.SegmentTranscodeErrorPlaylist, url, err)
 			return
 		}
+		segHashLock.Lock()
+		segOk[i] = true
+		segHashLock.Unlock()
+		if monitor.Enabled {
+			monitor.LogTranscodedSegmentAppeared(nonce, seg.SeqNo, sess.Profiles[i].Name)
+		}
+		if cxn.recording != nil {
+			cxn.recording.add(&sess.Profiles[i], seg.SeqNo, url, seg.Duration)
+		}
+
+		if cxn.dash != nil {
+			if data == nil {
+				// not downloaded when the broadcaster doesn't store renditions
+				if data, err = downloadRendition(ctx, seg, url); err != nil {
+					glog.Errorf("Error downloading segment for DASH nonce=%d seqNo=%d profile=%s err=%v", nonce, seg.SeqNo, sess.Profiles[i].Name, err)
+					return
+				}
+			}
+			cxn.insertDASHSegment(&sess.Profiles[i], seg.SeqNo, data, false)
+		}
+	}
+
+	// every rendition is verified before any is inserted, so that segments
+	// failing verification don't leave some renditions in the playlists
+	var wg sync.WaitGroup
+	for i, v := range res.Segments {
+		wg.Add(1)
+		go func(url string, i int) {
+			defer wg.Done()
+			verifyFunc(url, i)
+		}(v.Url, i)
+	}
+	wg.Wait()
+	if verifyErr == nil {
+		for i, v := range res.Segments {
+			if !segVerified[i] {
+				continue
+			}
+			wg.Add(1)
+			go func(url string, i int) {
+				defer wg.Done()
+				insertFunc(url, i)
+			}(v.Url, i)
+		}
+		wg.Wait()
+	}
+	if monitor.Enabled {
+		var succeeded, failed []string
+		for i, ok := range segOk {
+			if ok {
+				succeeded = append(succeeded, sess.Profiles[i].Name)
+			} else {
+				failed = append(failed, sess.Profiles[i].Name)
+			}
+		}
+		monitor.SegmentFullyTranscoded(nonce, seg.SeqNo, succeeded, failed, errCode)
+	}
 
+	ticketParams := sess.OrchestratorInfo.GetTicketParams()
+	if ticketParams != nil && // may be nil in offchain mode
+		!pm.VerifySig(ethcommon.BytesToAddress(ticketParams.Recipient), crypto.Keccak256(segHashes...), res.Sig) {
+		monitor.GetSampledLogger().Error("Sig check failed for segment", map[string]interface{}{monitor.LogFieldNonce: nonce, monitor.LogFieldSeqNo: seg.SeqNo})
+		return verifyErr
+	}
+
+	if verifyErr == nil {
 		glog.V(common.DEBUG).Info("Successfully validated segment ", seg.SeqNo)
-	}()
+	}
+	return verifyErr
 }
 
 var sessionErrStrings = []string{"dial tcp", "unexpected EOF", core.ErrOrchBusy.Error(), core.ErrOrchCap.Error()}
@@ -1,10 +1,27 @@
 package server
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/ericxtang/m3u8"
+	"github.com/golang/protobuf/proto"
 	"github.com/livepeer/go-livepeer/core"
+	"github.com/livepeer/go-livepeer/drivers"
+	"github.com/livepeer/go-livepeer/monitor"
+	"github.com/livepeer/go-livepeer/net"
+	ffmpeg "github.com/livepeer/lpms/ffmpeg"
+	"github.com/livepeer/lpms/stream"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestStopSessionErrors(t *testing.T) {
@@ -39,3 +56,448 @@ func TestStopSessionErrors(t *testing.T) {
 	}
 
 }
+
+func TestDuplicateSegments(t *testing.T) {
+	oldTTL := DuplicateSegmentTTL
+	defer func() { DuplicateSegmentTTL = oldTTL }()
+	DuplicateSegmentTTL = 50 * time.Millisecond
+
+	if checkDuplicateSegment(1, 1) {
+		t.Error("First segment should not be a duplicate")
+	}
+	if checkDuplicateSegment(2, 1) {
+		t.Error("Same seqNo on a different stream should not be a duplicate")
+	}
+	if !checkDuplicateSegment(1, 1) {
+		t.Error("Repeated segment should be a duplicate")
+	}
+
+	// entry should be forgotten once the TTL expires
+	time.Sleep(100 * time.Millisecond)
+	if checkDuplicateSegment(1, 1) {
+		t.Error("Segment should not be a duplicate after TTL expiry")
+	}
+}
+
+func TestCheckSegmentOrder(t *testing.T) {
+	cxn := &rtmpConnection{}
+	for _, seqNo := range []uint64{0, 1, 3} {
+		if cxn.checkSegmentOrder(seqNo) {
+			t.Error("Segment should be in order ", seqNo)
+		}
+	}
+	if !cxn.checkSegmentOrder(2) {
+		t.Error("Segment should be out of order")
+	}
+	if cxn.lastSeqNo != 3 {
+		t.Error("Out of order segment should not update the last seqNo ", cxn.lastSeqNo)
+	}
+	// repeating the last seqNo is a duplicate, not out of order
+	if cxn.checkSegmentOrder(3) {
+		t.Error("Repeated segment should not be out of order")
+	}
+}
+
+func TestUploadConcurrencyLimit(t *testing.T) {
+	for i := 0; i < MaxUploadConcurrency; i++ {
+		if !acquireUploadSlot() {
+			t.Fatal("Expected upload slot ", i)
+		}
+	}
+	if acquireUploadSlot() {
+		t.Error("Expected upload slots to be exhausted")
+	}
+	releaseUploadSlot()
+	if !acquireUploadSlot() {
+		t.Error("Expected a released upload slot to be reusable")
+	}
+	for i := 0; i < MaxUploadConcurrency; i++ {
+		releaseUploadSlot()
+	}
+}
+
+func TestProcessSegment_Oversized(t *testing.T) {
+	defer func(max int64) { MaxSegmentSize = max }(MaxSegmentSize)
+	MaxSegmentSize = 4
+
+	mid := core.RandomManifestID()
+	storage := drivers.NewMemoryDriver(nil).NewSession(string(mid))
+	cxn := &rtmpConnection{
+		mid:     mid,
+		nonce:   8,
+		pl:      core.NewBasicPlaylistManager(mid, storage),
+		profile: &ffmpeg.P144p30fps16x9,
+		lock:    &sync.RWMutex{},
+	}
+
+	processSegment(cxn, &stream.HLSSegment{SeqNo: 0, Data: []byte("dummy")})
+	if pl := cxn.pl.GetHLSMediaPlaylist(ffmpeg.P144p30fps16x9.Name); pl != nil {
+		t.Error("Oversized segment was inserted into the playlist")
+	}
+
+	processSegment(cxn, &stream.HLSSegment{SeqNo: 1, Data: []byte("data")})
+	if pl := cxn.pl.GetHLSMediaPlaylist(ffmpeg.P144p30fps16x9.Name); pl == nil || pl.Count() != 1 {
+		t.Error("Expected segment within the size limit to be inserted")
+	}
+}
+
+func TestProcessSegment_DuplicateAndRestart(t *testing.T) {
+	defer func(w uint64) { core.LiveWindow = w }(core.LiveWindow)
+	core.LiveWindow = 2
+
+	mid := core.RandomManifestID()
+	storage := drivers.NewMemoryDriver(nil).NewSession(string(mid))
+	cxn := &rtmpConnection{
+		mid:     mid,
+		nonce:   9,
+		pl:      core.NewBasicPlaylistManager(mid, storage),
+		profile: &ffmpeg.P144p30fps16x9,
+		lock:    &sync.RWMutex{},
+	}
+	pl := func() *m3u8.MediaPlaylist {
+		return cxn.pl.GetHLSMediaPlaylist(ffmpeg.P144p30fps16x9.Name)
+	}
+
+	for _, seqNo := range []uint64{0, 4, 5} {
+		processSegment(cxn, &stream.HLSSegment{SeqNo: seqNo, Data: []byte("dummy")})
+	}
+	if pl().Count() != 3 {
+		t.Fatal("Unexpected segment count ", pl().Count())
+	}
+	// repeated segments are dropped
+	processSegment(cxn, &stream.HLSSegment{SeqNo: 5, Data: []byte("dummy")})
+	if pl().Count() != 3 {
+		t.Error("Duplicate segment was inserted into the playlist")
+	}
+	// out of order segments within the window are kept
+	processSegment(cxn, &stream.HLSSegment{SeqNo: 3, Data: []byte("dummy")})
+	if pl().Count() != 4 {
+		t.Error("Expected out of order segment within the window to be inserted")
+	}
+
+	// segments too far behind mean the encoder restarted its numbering, and
+	// the stream resumes from there
+	for _, seqNo := range []uint64{0, 1} {
+		processSegment(cxn, &stream.HLSSegment{SeqNo: seqNo, Data: []byte("dummy")})
+	}
+	if pl().Count() != 6 {
+		t.Fatal("Expected restarted segments to be inserted; count ", pl().Count())
+	}
+	if cxn.lastSeqNo != 1 {
+		t.Error("Unexpected last seqNo after restart ", cxn.lastSeqNo)
+	}
+	for i, seg := range pl().Segments[:6] {
+		if seg.Discontinuity != (i == 4) {
+			t.Errorf("Unexpected discontinuity for segment %d: %v", i, seg.Discontinuity)
+		}
+	}
+}
+
+func TestProcessSegment_AudioOnly(t *testing.T) {
+	mid := core.RandomManifestID()
+	storage := drivers.NewMemoryDriver(nil).NewSession(string(mid))
+	cxn := &rtmpConnection{
+		mid:      mid,
+		nonce:    10,
+		pl:       core.NewBasicPlaylistManager(mid, storage),
+		profile:  &ffmpeg.P144p30fps16x9,
+		profiles: BroadcastJobVideoProfiles,
+		lock:     &sync.RWMutex{},
+	}
+
+	data := audioOnlyTS(t)
+	processSegment(cxn, &stream.HLSSegment{SeqNo: 0, Data: data, Duration: 2})
+	if !cxn.audioOnly || cxn.profiles != nil {
+		t.Error("Expected stream without video to be audio-only")
+	}
+	if pl := cxn.pl.GetHLSMediaPlaylist(AudioOnlyProfile.Name); pl == nil || pl.Count() != 1 {
+		t.Fatal("Expected segment to be published under the audio-only profile")
+	}
+	// which advertises the codec and bitrate of the stream
+	variants := cxn.pl.GetHLSMasterPlaylist().Variants
+	if len(variants) != 1 || variants[0].Codecs != "mp4a.40.2" || variants[0].Resolution != "" {
+		t.Error("Unexpected master playlist ", cxn.pl.GetHLSMasterPlaylist())
+	}
+	if bw := uint32(len(data) * 8 / 2); variants[0].Bandwidth < bw {
+		t.Errorf("Expected bandwidth of at least %d; got %d", bw, variants[0].Bandwidth)
+	}
+
+	// the stream stays audio-only
+	processSegment(cxn, &stream.HLSSegment{SeqNo: 1, Data: []byte("dummy")})
+	if pl := cxn.pl.GetHLSMediaPlaylist(AudioOnlyProfile.Name); pl.Count() != 2 {
+		t.Error("Unexpected segment count ", pl.Count())
+	}
+}
+
+// profileVerifier rejects the renditions of a single profile
+type profileVerifier struct {
+	profile string
+	err     error
+}
+
+func (v *profileVerifier) Verify(params *VerificationParams) error {
+	if params.Profile.Name == v.profile {
+		return v.err
+	}
+	return nil
+}
+
+func TestHandleTranscodeResult_VerifiesAllRenditions(t *testing.T) {
+	assert := assert.New(t)
+	defer func(v Verifier) { SegmentVerifier = v }(SegmentVerifier)
+	mid := core.RandomManifestID()
+	cxn := &rtmpConnection{
+		mid:   mid,
+		nonce: 11,
+		pl:    core.NewBasicPlaylistManager(mid, drivers.NewMemoryDriver(nil).NewSession(string(mid))),
+		lock:  &sync.RWMutex{},
+	}
+	sess := &BroadcastSession{
+		Profiles:         []ffmpeg.VideoProfile{ffmpeg.P240p30fps16x9, ffmpeg.P144p30fps16x9},
+		OrchestratorInfo: &net.OrchestratorInfo{Transcoder: "https://a:8935"},
+	}
+	res := &net.TranscodeData{Segments: []*net.TranscodedSegmentData{
+		{Url: "https://a:8935/stream/240p/0.ts"},
+		{Url: "https://a:8935/stream/144p/0.ts"},
+	}}
+	renditions := [][]byte{[]byte("240p"), []byte("144p")}
+	count := func(profile string) int {
+		if pl := cxn.pl.GetHLSMediaPlaylist(profile); pl != nil {
+			return int(pl.Count())
+		}
+		return 0
+	}
+
+	// no rendition is inserted if any fails verification
+	verr := &VerificationError{Code: VerificationErrorResolution, Reason: "wrong"}
+	SegmentVerifier = &profileVerifier{profile: ffmpeg.P144p30fps16x9.Name, err: verr}
+	err := handleTranscodeResult(context.Background(), cxn, sess, &stream.HLSSegment{SeqNo: 0, Duration: 2}, res, renditions)
+	assert.Equal(verr, err)
+	assert.Equal(0, count(ffmpeg.P240p30fps16x9.Name))
+	assert.Equal(0, count(ffmpeg.P144p30fps16x9.Name))
+
+	// otherwise all of them are
+	SegmentVerifier = &profileVerifier{}
+	err = handleTranscodeResult(context.Background(), cxn, sess, &stream.HLSSegment{SeqNo: 1, Duration: 2}, res, renditions)
+	assert.Nil(err)
+	assert.Equal(1, count(ffmpeg.P240p30fps16x9.Name))
+	assert.Equal(1, count(ffmpeg.P144p30fps16x9.Name))
+}
+
+func TestProcessSegment_DuplicateNotLost(t *testing.T) {
+	defer func(enabled bool) { monitor.Enabled = enabled }(monitor.Enabled)
+	monitor.Enabled = true
+	monitor.Init("", "broadcaster", "test", "test")
+
+	mid := core.RandomManifestID()
+	storage := drivers.NewMemoryDriver(nil).NewSession(string(mid))
+	cxn := &rtmpConnection{
+		mid:     mid,
+		nonce:   12,
+		pl:      core.NewBasicPlaylistManager(mid, storage),
+		profile: &ffmpeg.P144p30fps16x9,
+		lock:    &sync.RWMutex{},
+	}
+	pending := func() int {
+		var buf bytes.Buffer
+		if err := monitor.DebugDumpState(&buf); err != nil {
+			t.Fatal(err)
+		}
+		var state struct {
+			PendingSegments map[uint64]int `json:"pendingSegments"`
+		}
+		if err := json.Unmarshal(buf.Bytes(), &state); err != nil {
+			t.Fatal(err)
+		}
+		return state.PendingSegments[cxn.nonce]
+	}
+
+	// without orchestrators the segment fails rather than staying pending
+	processSegment(cxn, &stream.HLSSegment{SeqNo: 1, Data: []byte("dummy")})
+	if n := pending(); n != 0 {
+		t.Fatal("Unexpected pending segments ", n)
+	}
+	// a dropped duplicate doesn't emerge, so it can't be reported lost
+	processSegment(cxn, &stream.HLSSegment{SeqNo: 1, Data: []byte("dummy")})
+	if n := pending(); n != 0 {
+		t.Error("Dropped duplicate segment is waiting to be transcoded ", n)
+	}
+}
+
+// Errors seen from gRPC, HTTP and the standard library when submitting segments
+var stopErrCorpus = []string{
+	"",
+	"not really an error",
+	"Unable to read response body for segment 4 : unexpected EOF",
+	"Unable to submit segment 5 Post https://127.0.0.1:8936/segment: dial tcp 127.0.0.1:8936: getsockopt: connection refused",
+	"rpc error: code = Unavailable desc = transport is closing",
+	"Code: 500 Error: MediaStats Failure",
+	core.ErrOrchBusy.Error(),
+	core.ErrOrchCap.Error(),
+}
+
+func TestTranscodeSegment_DirectUpload(t *testing.T) {
+	assert := assert.New(t)
+	buf, err := proto.Marshal(&net.TranscodeResult{Result: &net.TranscodeResult_Data{Data: &net.TranscodeData{}}})
+	require.Nil(t, err)
+
+	// content type and body of each submission
+	var lock sync.Mutex
+	var received []string
+	ts, mux := stubTLSServer()
+	defer ts.Close()
+	mux.HandleFunc("/segment", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		lock.Lock()
+		received = append(received, r.Header.Get("Content-Type")+" "+string(body))
+		lock.Unlock()
+		w.WriteHeader(http.StatusOK)
+		w.Write(buf)
+	})
+	lastReceived := func() string {
+		lock.Lock()
+		defer lock.Unlock()
+		require.NotEmpty(t, received)
+		return received[len(received)-1]
+	}
+
+	mid := core.RandomManifestID()
+	cxn := &rtmpConnection{
+		mid:      mid,
+		pl:       core.NewBasicPlaylistManager(mid, drivers.NewMemoryDriver(nil).NewSession(string(mid))),
+		lock:     &sync.RWMutex{},
+		needOrch: make(chan struct{}, 1),
+	}
+	newSess := func(storage []*net.OSInfo, ios drivers.OSSession) *BroadcastSession {
+		return &BroadcastSession{
+			Broadcaster:      StubBroadcaster2(),
+			ManifestID:       mid,
+			OrchestratorInfo: &net.OrchestratorInfo{Transcoder: ts.URL, Storage: storage},
+			OrchestratorOS:   ios,
+		}
+	}
+	direct := []*net.OSInfo{&net.OSInfo{StorageType: net.OSInfo_DIRECT}}
+
+	// orchestrators without storage are sent the data rather than the
+	// URI of the broadcaster's storage
+	seg := &stream.HLSSegment{SeqNo: 1, Name: "https://broadcaster/source/1.ts", Data: []byte("direct")}
+	assert.Nil(transcodeSegment(context.Background(), cxn, newSess(direct, nil), nil, seg, "source/1.ts", time.Now()))
+	assert.Equal("video/MP2T direct", lastReceived())
+	assert.Equal("https://broadcaster/source/1.ts", seg.Name)
+
+	// orchestrators not advertising storage at all are still sent the URI
+	seg = &stream.HLSSegment{SeqNo: 2, Name: "https://broadcaster/source/2.ts", Data: []byte("uri")}
+	assert.Nil(transcodeSegment(context.Background(), cxn, newSess(nil, nil), nil, seg, "source/2.ts", time.Now()))
+	assert.Equal("application/vnd+livepeer.uri https://broadcaster/source/2.ts", lastReceived())
+
+	// segments that can't be uploaded to the orchestrator's storage are
+	// sent inline rather than dropped
+	ios := &mockOSSession{}
+	ios.On("SaveData").Return("", errors.New("upload failed"))
+	seg = &stream.HLSSegment{SeqNo: 3, Name: "https://broadcaster/source/3.ts", Data: []byte("fallback")}
+	assert.Nil(transcodeSegment(context.Background(), cxn, newSess(nil, ios), nil, seg, "source/3.ts", time.Now()))
+	assert.Equal("video/MP2T fallback", lastReceived())
+
+	// but not those over the upload concurrency limit
+	for acquireUploadSlot() {
+		defer releaseUploadSlot()
+	}
+	lock.Lock()
+	submitted := len(received)
+	lock.Unlock()
+	seg = &stream.HLSSegment{SeqNo: 4, Name: "https://broadcaster/source/4.ts", Data: []byte("busy")}
+	assert.Nil(transcodeSegment(context.Background(), cxn, newSess(nil, ios), nil, seg, "source/4.ts", time.Now()))
+	lock.Lock()
+	assert.Len(received, submitted)
+	lock.Unlock()
+}
+
+func TestTranscodeSegment_EndedStream(t *testing.T) {
+	ts, _ := stubTLSServer()
+	addr := ts.URL
+	ts.Close()
+	defer UnsuspendOrchestrator(addr)
+
+	// nothing listens for session requests once the stream ended
+	mid := core.RandomManifestID()
+	cxn := &rtmpConnection{
+		mid:      mid,
+		pl:       core.NewBasicPlaylistManager(mid, drivers.NewMemoryDriver(nil).NewSession(string(mid))),
+		lock:     &sync.RWMutex{},
+		needOrch: make(chan struct{}),
+	}
+	sess := &BroadcastSession{
+		Broadcaster:      StubBroadcaster2(),
+		ManifestID:       mid,
+		OrchestratorInfo: &net.OrchestratorInfo{Transcoder: addr},
+	}
+	done := make(chan error)
+	go func() {
+		done <- transcodeSegment(context.Background(), cxn, sess, nil, &stream.HLSSegment{SeqNo: 1, Data: []byte("data")}, "source/1.ts", time.Now())
+	}()
+	select {
+	case err := <-done:
+		assert.Nil(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Segment stuck asking for a new session")
+	}
+}
+
+func TestValidateRenditionURL(t *testing.T) {
+	assert := assert.New(t)
+	defer func(bucket string) { drivers.S3BUCKET = bucket }(drivers.S3BUCKET)
+	drivers.S3BUCKET = "own-bucket"
+	sess := &BroadcastSession{OrchestratorInfo: &net.OrchestratorInfo{Transcoder: "https://127.0.0.1:8935"}}
+
+	// renditions hosted by the orchestrator or saved to the broadcaster's
+	// storage are allowed
+	assert.Nil(validateRenditionURL(sess, "https://127.0.0.1:8935/stream/1.ts"))
+	assert.Nil(validateRenditionURL(sess, "https://own-bucket.s3.amazonaws.com:8443/stream/1.ts"))
+
+	// others are checked
+	assert.Equal(drivers.ErrSegmentURLPort, validateRenditionURL(sess, "https://other-bucket.s3.amazonaws.com:8443/stream/1.ts"))
+	assert.Equal(drivers.ErrSegmentURLInternal, validateRenditionURL(sess, "https://127.0.0.1:8080/stream/1.ts"))
+}
+
+func TestStopStreamImpliesStopSession(t *testing.T) {
+	for _, v := range stopErrCorpus {
+		err := errors.New(v)
+		if shouldStopStream(err) && !shouldStopSession(err) {
+			t.Error("Stopping stream without stopping session: ", v)
+		}
+	}
+}
+
+func TestStopStream_SegmentErrorRegression(t *testing.T) {
+	// A transient connection error for a single segment must only
+	// rotate the session, never tear down the stream.
+	err := errors.New("Unable to submit segment 5 Post https://127.0.0.1:8936/segment: dial tcp 127.0.0.1:8936: getsockopt: connection refused")
+	if shouldStopStream(err) {
+		t.Error("Segment connection error should not stop the stream")
+	}
+	if !shouldStopSession(err) {
+		t.Error("Segment connection error should stop the session")
+	}
+}
+
+func FuzzShouldStopStream(f *testing.F) {
+	// The corpus errors as they show up wrapped or truncated in logs
+	variants := []func(string) string{
+		func(s string) string { return s },
+		func(s string) string { return "Error submitting segment: " + s },
+		func(s string) string { return s + ": context deadline exceeded" },
+		func(s string) string { return strings.ToUpper(s) },
+		func(s string) string { return s[:len(s)/2] },
+	}
+	for _, v := range stopErrCorpus {
+		for _, variant := range variants {
+			f.Add(variant(v))
+		}
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		err := errors.New(s)
+		if shouldStopStream(err) && !shouldStopSession(err) {
+			t.Error("Stopping stream without stopping session: ", s)
+		}
+	})
+}
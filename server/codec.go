@@ -0,0 +1,412 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Minimal MPEG-TS parser used to fingerprint the codecs of a segment so that
+// encoder-side codec changes can be detected mid-stream.
+
+const (
+	tsPacketSize = 188
+	tsSyncByte   = 0x47
+	tsPatPID     = 0
+)
+
+// stream types from ISO/IEC 13818-1 table 2-34
+const (
+	tsStreamTypeMP3  = 0x03
+	tsStreamTypeMP2  = 0x04
+	tsStreamTypeAAC  = 0x0F // ADTS
+	tsStreamTypeH264 = 0x1B
+)
+
+// codecFingerprint returns a string identifying the elementary stream types
+// of a TS segment and, for H.264 video, the profile and level of its SPS.
+// Returns an empty string if the data doesn't look like a TS segment.
+func codecFingerprint(data []byte) string {
+	streams, sps := parseTS(data)
+	if len(streams) == 0 {
+		return ""
+	}
+
+	types := []string{}
+	for _, t := range streams {
+		types = append(types, fmt.Sprintf("%02x", t))
+	}
+	sort.Strings(types)
+	fp := "streams=" + strings.Join(types, ",")
+	if len(sps) >= 4 {
+		// profile_idc, constraint flags, level_idc follow the NAL header
+		fp += fmt.Sprintf(";h264=%d/%d", sps[1], sps[3])
+	}
+	return fp
+}
+
+// parseTS returns the elementary stream types of a TS segment, keyed by PID,
+// and the first H.264 SPS found. Returns no streams if the data doesn't look
+// like a TS segment.
+func parseTS(data []byte) (map[int]byte, []byte) {
+	if len(data) < tsPacketSize || data[0] != tsSyncByte {
+		return nil, nil
+	}
+	pmtPID := -1
+	streams := map[int]byte{} // pid : stream type
+	var sps []byte
+
+	for off := 0; off+tsPacketSize <= len(data); off += tsPacketSize {
+		pkt := data[off : off+tsPacketSize]
+		if pkt[0] != tsSyncByte {
+			return nil, nil
+		}
+		pusi := pkt[1]&0x40 != 0
+		pid := int(pkt[1]&0x1F)<<8 | int(pkt[2])
+		payload := tsPayload(pkt)
+		if payload == nil {
+			continue
+		}
+		switch {
+		case pid == tsPatPID && pusi && pmtPID < 0:
+			pmtPID = parsePAT(payload)
+		case pid == pmtPID && pusi && len(streams) == 0:
+			streams = parsePMT(payload)
+		case streams[pid] == tsStreamTypeH264 && sps == nil:
+			sps = findSPS(payload)
+		}
+		if len(streams) > 0 && (sps != nil || !hasH264(streams)) {
+			break
+		}
+	}
+	return streams, sps
+}
+
+// tsPayload returns the payload of a TS packet, skipping the adaptation field
+func tsPayload(pkt []byte) []byte {
+	afc := (pkt[3] >> 4) & 0x3
+	start := 4
+	if afc == 2 || afc == 0 {
+		return nil // no payload
+	}
+	if afc == 3 {
+		start += 1 + int(pkt[4])
+	}
+	if start >= len(pkt) {
+		return nil
+	}
+	return pkt[start:]
+}
+
+// psiSection skips the pointer field of a PSI payload
+func psiSection(payload []byte) []byte {
+	if len(payload) < 1 {
+		return nil
+	}
+	start := 1 + int(payload[0])
+	if start >= len(payload) {
+		return nil
+	}
+	return payload[start:]
+}
+
+func parsePAT(payload []byte) int {
+	sec := psiSection(payload)
+	if len(sec) < 8 {
+		return -1
+	}
+	secLen := int(sec[1]&0x0F)<<8 | int(sec[2])
+	end := 3 + secLen - 4 // exclude CRC
+	for i := 8; i+4 <= end && i+4 <= len(sec); i += 4 {
+		program := int(sec[i])<<8 | int(sec[i+1])
+		if program != 0 {
+			return int(sec[i+2]&0x1F)<<8 | int(sec[i+3])
+		}
+	}
+	return -1
+}
+
+func parsePMT(payload []byte) map[int]byte {
+	streams := map[int]byte{}
+	sec := psiSection(payload)
+	if len(sec) < 12 {
+		return streams
+	}
+	secLen := int(sec[1]&0x0F)<<8 | int(sec[2])
+	end := 3 + secLen - 4 // exclude CRC
+	progInfoLen := int(sec[10]&0x0F)<<8 | int(sec[11])
+	for i := 12 + progInfoLen; i+5 <= end && i+5 <= len(sec); {
+		streamType := sec[i]
+		pid := int(sec[i+1]&0x1F)<<8 | int(sec[i+2])
+		esInfoLen := int(sec[i+3]&0x0F)<<8 | int(sec[i+4])
+		streams[pid] = streamType
+		i += 5 + esInfoLen
+	}
+	return streams
+}
+
+// findSPS returns the H.264 SPS NAL unit (starting at the NAL header) if
+// one begins within the payload
+func findSPS(payload []byte) []byte {
+	for i := 0; i+4 < len(payload); i++ {
+		if payload[i] == 0 && payload[i+1] == 0 && payload[i+2] == 1 && payload[i+3]&0x1F == 7 {
+			return payload[i+3:]
+		}
+	}
+	return nil
+}
+
+// videoFramerate estimates the frame rate of the H.264 video of a TS segment
+// from the presentation timestamps of its frames, taking each PES packet to
+// hold one frame as muxed by ffmpeg
+func videoFramerate(data []byte) (float64, error) {
+	streams, _ := parseTS(data)
+	pid := -1
+	for p, t := range streams {
+		if t == tsStreamTypeH264 {
+			pid = p
+		}
+	}
+	if pid < 0 {
+		return 0, errors.New("no H.264 video")
+	}
+	frames := 0
+	var minPTS, maxPTS int64 = -1, -1
+	for off := 0; off+tsPacketSize <= len(data); off += tsPacketSize {
+		pkt := data[off : off+tsPacketSize]
+		if pkt[0] != tsSyncByte || pkt[1]&0x40 == 0 || int(pkt[1]&0x1F)<<8|int(pkt[2]) != pid {
+			continue
+		}
+		pts, ok := pesPTS(tsPayload(pkt))
+		if !ok {
+			continue
+		}
+		frames++
+		if minPTS < 0 || pts < minPTS {
+			minPTS = pts
+		}
+		if pts > maxPTS {
+			maxPTS = pts
+		}
+	}
+	if frames < 2 || maxPTS <= minPTS {
+		return 0, errors.New("too few frames")
+	}
+	// timestamps are in units of 90kHz
+	return float64(frames-1) * 90000 / float64(maxPTS-minPTS), nil
+}
+
+// pesPTS returns the presentation timestamp of the PES packet starting the
+// payload, if it has one
+func pesPTS(payload []byte) (int64, bool) {
+	if len(payload) < 14 || payload[0] != 0 || payload[1] != 0 || payload[2] != 1 || payload[7]&0x80 == 0 {
+		return 0, false
+	}
+	p := payload[9:14]
+	pts := int64(p[0]>>1&0x07)<<30 | int64(p[1])<<22 | int64(p[2]>>1)<<15 | int64(p[3])<<7 | int64(p[4]>>1)
+	return pts, true
+}
+
+func hasH264(streams map[int]byte) bool {
+	for _, t := range streams {
+		if t == tsStreamTypeH264 {
+			return true
+		}
+	}
+	return false
+}
+
+// isAudioOnly returns true if data is a TS segment carrying audio but no video
+func isAudioOnly(data []byte) bool {
+	streams, _ := parseTS(data)
+	return !hasH264(streams) && tsAudioCodec(streams) != ""
+}
+
+// audioCodec returns the codec of the audio stream of a TS segment, as named
+// by audio profiles, or an empty string if it has none
+func audioCodec(data []byte) string {
+	streams, _ := parseTS(data)
+	return tsAudioCodec(streams)
+}
+
+func tsAudioCodec(streams map[int]byte) string {
+	for _, t := range streams {
+		switch t {
+		case tsStreamTypeAAC:
+			return "aac"
+		case tsStreamTypeMP3, tsStreamTypeMP2:
+			return "mp3"
+		}
+	}
+	return ""
+}
+
+// spsResolution returns the cropped frame size coded in an H.264 SPS NAL unit
+func spsResolution(sps []byte) (width, height int, err error) {
+	info, err := parseSPS(sps)
+	if err != nil {
+		return 0, 0, err
+	}
+	return info.width, info.height, nil
+}
+
+// spsInfo holds the fields of an H.264 SPS needed to describe the stream
+type spsInfo struct {
+	width, height  int // cropped frame size
+	chromaFormat   int
+	bitDepthLuma   int
+	bitDepthChroma int
+}
+
+// parseSPS parses an H.264 SPS NAL unit, as per ITU-T H.264 section 7.3.2.1.1
+func parseSPS(sps []byte) (*spsInfo, error) {
+	info := &spsInfo{chromaFormat: 1, bitDepthLuma: 8, bitDepthChroma: 8}
+	r := &bitReader{data: unescapeRBSP(sps)}
+	r.skip(8) // NAL header
+	profileIdc := r.bits(8)
+	r.skip(16) // constraint flags, level_idc
+	r.ue()     // seq_parameter_set_id
+	switch profileIdc {
+	case 100, 110, 122, 244, 44, 83, 86, 118, 128, 138, 139, 134, 135:
+		info.chromaFormat = r.ue()
+		if info.chromaFormat == 3 {
+			r.skip(1) // separate_colour_plane_flag
+		}
+		info.bitDepthLuma = r.ue() + 8
+		info.bitDepthChroma = r.ue() + 8
+		r.skip(1)           // qpprime_y_zero_transform_bypass_flag
+		if r.bits(1) == 1 { // seq_scaling_matrix_present_flag
+			lists := 8
+			if info.chromaFormat == 3 {
+				lists = 12
+			}
+			for i := 0; i < lists; i++ {
+				if r.bits(1) == 0 {
+					continue
+				}
+				size := 16
+				if i >= 6 {
+					size = 64
+				}
+				last, next := 8, 8
+				for j := 0; j < size; j++ {
+					if next != 0 {
+						next = (last + r.se() + 256) % 256
+					}
+					if next != 0 {
+						last = next
+					}
+				}
+			}
+		}
+	}
+	r.ue()          // log2_max_frame_num_minus4
+	switch r.ue() { // pic_order_cnt_type
+	case 0:
+		r.ue() // log2_max_pic_order_cnt_lsb_minus4
+	case 1:
+		r.skip(1) // delta_pic_order_always_zero_flag
+		r.se()    // offset_for_non_ref_pic
+		r.se()    // offset_for_top_to_bottom_field
+		for n := r.ue(); n > 0 && r.err == nil; n-- {
+			r.se() // offset_for_ref_frame
+		}
+	}
+	r.ue()    // max_num_ref_frames
+	r.skip(1) // gaps_in_frame_num_value_allowed_flag
+	widthMbs := r.ue() + 1
+	heightMapUnits := r.ue() + 1
+	frameMbsOnly := r.bits(1)
+	if frameMbsOnly == 0 {
+		r.skip(1) // mb_adaptive_frame_field_flag
+	}
+	r.skip(1) // direct_8x8_inference_flag
+	var cropLeft, cropRight, cropTop, cropBottom int
+	if r.bits(1) == 1 {
+		cropLeft, cropRight, cropTop, cropBottom = r.ue(), r.ue(), r.ue(), r.ue()
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	cropUnitX, cropUnitY := 1, 2-frameMbsOnly
+	switch info.chromaFormat {
+	case 1:
+		cropUnitX, cropUnitY = 2, 2*(2-frameMbsOnly)
+	case 2:
+		cropUnitX = 2
+	}
+	info.width = widthMbs*16 - (cropLeft+cropRight)*cropUnitX
+	info.height = (2-frameMbsOnly)*heightMapUnits*16 - (cropTop+cropBottom)*cropUnitY
+	return info, nil
+}
+
+// unescapeRBSP removes the emulation prevention bytes of a NAL unit
+func unescapeRBSP(nal []byte) []byte {
+	res := make([]byte, 0, len(nal))
+	zeros := 0
+	for _, b := range nal {
+		if zeros >= 2 && b == 3 {
+			zeros = 0
+			continue
+		}
+		if b == 0 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+		res = append(res, b)
+	}
+	return res
+}
+
+var errShortSPS = errors.New("SPS too short")
+
+// bitReader reads the big endian bit fields and Exp-Golomb codes of a NAL
+// unit. Reading past the end sets err and returns zeros.
+type bitReader struct {
+	data []byte
+	pos  int // in bits
+	err  error
+}
+
+func (r *bitReader) bits(n int) int {
+	v := 0
+	for i := 0; i < n; i++ {
+		if r.pos >= len(r.data)*8 {
+			r.err = errShortSPS
+			return 0
+		}
+		bit := int(r.data[r.pos/8]>>uint(7-r.pos%8)) & 1
+		v = v<<1 | bit
+		r.pos++
+	}
+	return v
+}
+
+func (r *bitReader) skip(n int) {
+	r.bits(n)
+}
+
+// ue reads an unsigned Exp-Golomb code
+func (r *bitReader) ue() int {
+	zeros := 0
+	for r.bits(1) == 0 && r.err == nil {
+		zeros++
+		if zeros > 31 {
+			r.err = errShortSPS
+			return 0
+		}
+	}
+	return (1 << uint(zeros)) - 1 + r.bits(zeros)
+}
+
+// se reads a signed Exp-Golomb code
+func (r *bitReader) se() int {
+	v := r.ue()
+	if v%2 == 0 {
+		return -v / 2
+	}
+	return (v + 1) / 2
+}
@@ -0,0 +1,151 @@
+package server
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"github.com/livepeer/go-livepeer/common"
+	"github.com/livepeer/lpms/stream"
+)
+
+func TestCodecFingerprint(t *testing.T) {
+	data, err := ioutil.ReadFile("../core/test.ts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// AAC audio, H.264 High 4:2:2 profile at level 3.1
+	if fp := codecFingerprint(data); fp != "streams=0f,1b;h264=122/31" {
+		t.Error("Unexpected fingerprint ", fp)
+	}
+
+	// changing the SPS profile changes the fingerprint
+	changed := append([]byte{}, data...)
+	for i := 0; i+4 < len(changed); i++ {
+		if changed[i] == 0 && changed[i+1] == 0 && changed[i+2] == 1 && changed[i+3]&0x1F == 7 {
+			changed[i+4] = 100
+			break
+		}
+	}
+	if fp := codecFingerprint(changed); fp != "streams=0f,1b;h264=100/31" {
+		t.Error("Unexpected fingerprint after profile change ", fp)
+	}
+
+	// not TS data
+	for _, d := range [][]byte{nil, []byte("dummy"), make([]byte, 2*tsPacketSize)} {
+		if fp := codecFingerprint(d); fp != "" {
+			t.Error("Expected empty fingerprint; got ", fp)
+		}
+	}
+}
+
+func TestSPSResolution(t *testing.T) {
+	data, err := ioutil.ReadFile("../core/test.ts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, sps := parseTS(data)
+	w, h, err := spsResolution(sps)
+	if err != nil || w != 1280 || h != 720 {
+		t.Error("Unexpected resolution ", w, h, err)
+	}
+
+	// truncated SPS
+	if _, _, err := spsResolution(sps[:6]); err != errShortSPS {
+		t.Error("Expected short SPS error; got ", err)
+	}
+
+	// emulation prevention bytes are removed
+	if d := unescapeRBSP([]byte{0, 0, 3, 1, 0, 0, 3, 0, 3}); string(d) != string([]byte{0, 0, 1, 0, 0, 0, 3}) {
+		t.Error("Unexpected RBSP ", d)
+	}
+}
+
+func TestVideoFramerate(t *testing.T) {
+	data, err := ioutil.ReadFile("../core/test.ts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fps, err := videoFramerate(data); err != nil || fps < 24.9 || fps > 25.1 {
+		t.Error("Unexpected frame rate ", fps, err)
+	}
+
+	// only the first frame
+	if _, err := videoFramerate(data[:10*tsPacketSize]); err == nil {
+		t.Error("Expected an error with too few frames")
+	}
+	if _, err := videoFramerate([]byte("dummy")); err == nil {
+		t.Error("Expected an error without video")
+	}
+}
+
+// audioOnlyTS returns the test segment with its H.264 stream relabelled as
+// private data in the PMT
+func audioOnlyTS(t *testing.T) []byte {
+	data, err := ioutil.ReadFile("../core/test.ts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	i := bytes.Index(data, []byte{tsStreamTypeH264, 0xe1, 0x00, 0xf0, 0x00})
+	if i < 0 {
+		t.Fatal("Missing H.264 stream in PMT")
+	}
+	data[i] = 0x06
+	return data
+}
+
+func TestIsAudioOnly(t *testing.T) {
+	data, err := ioutil.ReadFile("../core/test.ts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if isAudioOnly(data) {
+		t.Error("Segment with video is not audio-only")
+	}
+	if !isAudioOnly(audioOnlyTS(t)) {
+		t.Error("Expected segment without video to be audio-only")
+	}
+	// not TS data
+	if isAudioOnly([]byte("dummy")) {
+		t.Error("Non-TS data is not audio-only")
+	}
+}
+
+func TestAudioCodec(t *testing.T) {
+	data := audioOnlyTS(t)
+	if c := audioCodec(data); c != "aac" {
+		t.Error("Unexpected codec ", c)
+	}
+	// relabel the AAC stream as MP3
+	i := bytes.Index(data, []byte{tsStreamTypeAAC, 0xe1, 0x01, 0xf0, 0x00})
+	if i < 0 {
+		t.Fatal("Missing AAC stream in PMT")
+	}
+	data[i] = tsStreamTypeMP3
+	if c := audioCodec(data); c != "mp3" {
+		t.Error("Unexpected codec ", c)
+	}
+	if c := audioCodec([]byte("dummy")); c != "" {
+		t.Error("Unexpected codec of non-TS data ", c)
+	}
+}
+
+func TestAudioOnlyProfile(t *testing.T) {
+	defer func(p common.AudioProfile) { AudioOnlyProfile = p }(AudioOnlyProfile)
+	AudioOnlyProfile = common.A64kAAC
+	data := audioOnlyTS(t)
+
+	// the configured profile is advertised at the bitrate of the segment
+	p := audioOnlyProfile(&stream.HLSSegment{Data: data[:1000*188], Duration: 2})
+	if p.Name != "A64kAAC" || p.Bitrate != "752k" {
+		t.Errorf("Unexpected profile %+v", p)
+	}
+
+	// and replaced by one with the codec of the segment
+	i := bytes.Index(data, []byte{tsStreamTypeAAC, 0xe1, 0x01, 0xf0, 0x00})
+	data[i] = tsStreamTypeMP3
+	p = audioOnlyProfile(&stream.HLSSegment{Data: data[:1000*188], Duration: 2})
+	if p.Name != "A128kMP3" || p.Bitrate != "752k" {
+		t.Errorf("Unexpected profile %+v", p)
+	}
+}
@@ -0,0 +1,354 @@
+package server
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/livepeer/go-livepeer/core"
+	"github.com/livepeer/go-livepeer/monitor"
+	"github.com/livepeer/lpms/ffmpeg"
+)
+
+// EnableDASH makes broadcasters also package streams as MPEG-DASH, served at
+// /dash/<manifestID>.mpd next to the HLS playlists
+var EnableDASH = false
+
+// Representation ID of the audio of the source rendition
+const dashAudio = "audio"
+
+// dashManifest holds the most recent fMP4 segments of the renditions of a
+// stream and describes them as a live MPD
+type dashManifest struct {
+	mid  core.ManifestID
+	lock sync.RWMutex
+	// wall clock time of the start of the first segment
+	availabilityStart time.Time
+	reps              map[string]*dashRepresentation // rendition : representation
+	order             []string                       // renditions in order of appearance
+}
+
+type dashRepresentation struct {
+	name      string
+	video     bool
+	codecs    string
+	bandwidth int64
+	width     int
+	height    int
+	rate      int // audio sampling rate
+	timescale uint32
+	init      []byte
+	segments  []*dashSegment // oldest first
+}
+
+type dashSegment struct {
+	seqNo    uint64
+	start    uint64 // earliest presentation time, in timescale
+	duration uint64 // in timescale
+	data     []byte
+}
+
+func newDASHManifest(mid core.ManifestID) *dashManifest {
+	return &dashManifest{mid: mid, reps: make(map[string]*dashRepresentation)}
+}
+
+// insert remuxes a TS segment of rendition profile into the manifest. The
+// audio track is only taken from renditions with withAudio set, as every
+// rendition carries the same audio.
+func (m *dashManifest) insert(profile *ffmpeg.VideoProfile, seqNo uint64, data []byte, withAudio bool) error {
+	video, audio, err := demuxTS(data)
+	if err != nil {
+		return err
+	}
+	bandwidth, _ := parseBitrate(profile.Bitrate)
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.availabilityStart.IsZero() {
+		end := time.Duration(float64(video.ept+video.duration()) / float64(video.timescale) * float64(time.Second))
+		m.availabilityStart = time.Now().Add(-end)
+	}
+	m.add(profile.Name, video, seqNo, bandwidth)
+	if withAudio && audio != nil {
+		m.add(dashAudio, audio, seqNo, 0)
+	}
+	return nil
+}
+
+func (m *dashManifest) add(name string, t *fmp4Track, seqNo uint64, bandwidth int64) {
+	rep, ok := m.reps[name]
+	if !ok {
+		rep = &dashRepresentation{name: name}
+		m.reps[name] = rep
+		m.order = append(m.order, name)
+	}
+	for _, s := range rep.segments {
+		if s.seqNo == seqNo {
+			return // redundant submission
+		}
+	}
+	if dur := t.duration(); bandwidth <= 0 && dur > 0 {
+		bandwidth = int64(t.size()) * 8 * int64(t.timescale) / int64(dur)
+	}
+	rep.video, rep.codecs, rep.timescale, rep.init = t.video, t.codecs, t.timescale, initSegment(t)
+	rep.width, rep.height, rep.rate = t.width, t.height, t.sampleRate
+	if bandwidth > rep.bandwidth {
+		rep.bandwidth = bandwidth
+	}
+	rep.segments = append(rep.segments, &dashSegment{
+		seqNo:    seqNo,
+		start:    t.ept,
+		duration: t.duration(),
+		data:     fragment(uint32(seqNo+1), t),
+	})
+	sort.Slice(rep.segments, func(i, j int) bool { return rep.segments[i].seqNo < rep.segments[j].seqNo })
+	if n := len(rep.segments) - int(core.LIVE_LIST_LENGTH); n > 0 {
+		rep.segments = rep.segments[n:]
+	}
+}
+
+// remove drops a rendition from the manifest
+func (m *dashManifest) remove(name string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	delete(m.reps, name)
+	for i, n := range m.order {
+		if n == name {
+			m.order = append(m.order[:i:i], m.order[i+1:]...)
+			break
+		}
+	}
+}
+
+// file returns the initialization segment of a rendition for init.mp4, or
+// the media segment <seqNo>.m4s. Returns nil if there's no such file.
+func (m *dashManifest) file(rendition, name string) []byte {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	rep, ok := m.reps[rendition]
+	if !ok {
+		return nil
+	}
+	if name == "init.mp4" {
+		return rep.init
+	}
+	seqNo, err := strconv.ParseUint(strings.TrimSuffix(name, ".m4s"), 10, 64)
+	if err != nil || !strings.HasSuffix(name, ".m4s") {
+		return nil
+	}
+	for _, s := range rep.segments {
+		if s.seqNo == seqNo {
+			return s.data
+		}
+	}
+	return nil
+}
+
+// MPD elements, as per ISO/IEC 23009-1
+type mpd struct {
+	XMLName                    xml.Name  `xml:"MPD"`
+	Xmlns                      string    `xml:"xmlns,attr"`
+	Profiles                   string    `xml:"profiles,attr"`
+	Type                       string    `xml:"type,attr"`
+	AvailabilityStartTime      string    `xml:"availabilityStartTime,attr"`
+	PublishTime                string    `xml:"publishTime,attr"`
+	MinimumUpdatePeriod        string    `xml:"minimumUpdatePeriod,attr"`
+	MinBufferTime              string    `xml:"minBufferTime,attr"`
+	TimeShiftBufferDepth       string    `xml:"timeShiftBufferDepth,attr"`
+	SuggestedPresentationDelay string    `xml:"suggestedPresentationDelay,attr"`
+	Period                     mpdPeriod `xml:"Period"`
+}
+
+type mpdPeriod struct {
+	ID             string             `xml:"id,attr"`
+	Start          string             `xml:"start,attr"`
+	AdaptationSets []mpdAdaptationSet `xml:"AdaptationSet"`
+}
+
+type mpdAdaptationSet struct {
+	ContentType      string              `xml:"contentType,attr"`
+	MimeType         string              `xml:"mimeType,attr"`
+	SegmentAlignment bool                `xml:"segmentAlignment,attr"`
+	StartWithSAP     int                 `xml:"startWithSAP,attr"`
+	Representations  []mpdRepresentation `xml:"Representation"`
+}
+
+type mpdRepresentation struct {
+	ID                string         `xml:"id,attr"`
+	Bandwidth         int64          `xml:"bandwidth,attr"`
+	Codecs            string         `xml:"codecs,attr"`
+	Width             int            `xml:"width,attr,omitempty"`
+	Height            int            `xml:"height,attr,omitempty"`
+	AudioSamplingRate int            `xml:"audioSamplingRate,attr,omitempty"`
+	SegmentList       mpdSegmentList `xml:"SegmentList"`
+}
+
+type mpdSegmentList struct {
+	Timescale      uint32            `xml:"timescale,attr"`
+	Initialization mpdInitialization `xml:"Initialization"`
+	Timeline       []mpdS            `xml:"SegmentTimeline>S"`
+	SegmentURLs    []mpdSegmentURL   `xml:"SegmentURL"`
+}
+
+type mpdInitialization struct {
+	SourceURL string `xml:"sourceURL,attr"`
+}
+
+type mpdS struct {
+	T uint64 `xml:"t,attr"`
+	D uint64 `xml:"d,attr"`
+}
+
+type mpdSegmentURL struct {
+	Media string `xml:"media,attr"`
+}
+
+// xsDuration formats d as an xs:duration
+func xsDuration(d time.Duration) string {
+	return fmt.Sprintf("PT%.3fS", d.Seconds())
+}
+
+// segLen returns the longest segment duration in the manifest, or SegLen
+// if it has no segments yet. Callers hold the lock.
+func (m *dashManifest) segLen() time.Duration {
+	var segLen time.Duration
+	for _, rep := range m.reps {
+		for _, seg := range rep.segments {
+			d := time.Duration(float64(seg.duration) / float64(rep.timescale) * float64(time.Second))
+			if d > segLen {
+				segLen = d
+			}
+		}
+	}
+	if segLen == 0 {
+		return SegLen
+	}
+	return segLen
+}
+
+// mpd returns the live MPD of the stream. Segment URLs are relative to
+// /dash/<manifestID>.mpd.
+func (m *dashManifest) mpd() ([]byte, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	segLen := m.segLen()
+	window := time.Duration(core.LIVE_LIST_LENGTH) * segLen
+	doc := &mpd{
+		Xmlns:                      "urn:mpeg:dash:schema:mpd:2011",
+		Profiles:                   "urn:mpeg:dash:profile:isoff-live:2011",
+		Type:                       "dynamic",
+		AvailabilityStartTime:      m.availabilityStart.UTC().Format(time.RFC3339Nano),
+		PublishTime:                time.Now().UTC().Format(time.RFC3339Nano),
+		MinimumUpdatePeriod:        xsDuration(segLen),
+		MinBufferTime:              xsDuration(segLen),
+		TimeShiftBufferDepth:       xsDuration(window),
+		SuggestedPresentationDelay: xsDuration(3 * segLen),
+		Period:                     mpdPeriod{ID: "0", Start: xsDuration(0)},
+	}
+	video := mpdAdaptationSet{ContentType: "video", MimeType: "video/mp4", SegmentAlignment: true, StartWithSAP: 1}
+	audio := mpdAdaptationSet{ContentType: "audio", MimeType: "audio/mp4", SegmentAlignment: true, StartWithSAP: 1}
+	for _, name := range m.order {
+		rep := m.reps[name]
+		r := mpdRepresentation{
+			ID:        name,
+			Bandwidth: rep.bandwidth,
+			Codecs:    rep.codecs,
+			SegmentList: mpdSegmentList{
+				Timescale:      rep.timescale,
+				Initialization: mpdInitialization{SourceURL: fmt.Sprintf("%s/%s/init.mp4", m.mid, name)},
+			},
+		}
+		for _, s := range rep.segments {
+			r.SegmentList.Timeline = append(r.SegmentList.Timeline, mpdS{T: s.start, D: s.duration})
+			r.SegmentList.SegmentURLs = append(r.SegmentList.SegmentURLs, mpdSegmentURL{Media: fmt.Sprintf("%s/%s/%d.m4s", m.mid, name, s.seqNo)})
+		}
+		if rep.video {
+			r.Width, r.Height = rep.width, rep.height
+			video.Representations = append(video.Representations, r)
+		} else {
+			r.AudioSamplingRate = rep.rate
+			audio.Representations = append(audio.Representations, r)
+		}
+	}
+	if len(video.Representations) > 0 {
+		doc.Period.AdaptationSets = append(doc.Period.AdaptationSets, video)
+	}
+	if len(audio.Representations) > 0 {
+		doc.Period.AdaptationSets = append(doc.Period.AdaptationSets, audio)
+	}
+	out, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), out...), nil
+}
+
+// insertDASHSegment packages a rendition of a segment into the stream's DASH
+// manifest. Failures are only logged; they don't affect HLS.
+func (cxn *rtmpConnection) insertDASHSegment(profile *ffmpeg.VideoProfile, seqNo uint64, data []byte, withAudio bool) {
+	if cxn.dash == nil {
+		return
+	}
+	if err := cxn.dash.insert(profile, seqNo, data, withAudio); err != nil {
+		glog.Errorf("Error packaging DASH segment manifestID=%s nonce=%d seqNo=%d profile=%s err=%v", cxn.mid, cxn.nonce, seqNo, profile.Name, err)
+	}
+}
+
+// getDASHHandler serves the DASH manifests and segments of active streams:
+// /dash/<manifestID>.mpd, /dash/<manifestID>/<rendition>/init.mp4 and
+// /dash/<manifestID>/<rendition>/<seqNo>.m4s
+func getDASHHandler(s *LivepeerServer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Access-Control-Expose-Headers", "Content-Length")
+		path := strings.TrimPrefix(r.URL.Path, "/dash/")
+		parts := strings.Split(path, "/")
+		mid := core.ManifestID(strings.TrimSuffix(parts[0], ".mpd"))
+
+		s.connectionLock.RLock()
+		cxn, ok := s.rtmpConnections[mid]
+		s.connectionLock.RUnlock()
+		if !ok || cxn.dash == nil {
+			http.Error(w, "ErrNotFound", http.StatusNotFound)
+			return
+		}
+
+		if len(parts) == 1 && strings.HasSuffix(path, ".mpd") {
+			data, err := cxn.dash.mpd()
+			if err != nil {
+				glog.Errorf("Error generating MPD manifestID=%s err=%v", mid, err)
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "application/dash+xml")
+			w.Header().Set("Cache-Control", "no-cache")
+			w.Write(data)
+			return
+		}
+		if len(parts) != 3 {
+			http.Error(w, "ErrNotFound", http.StatusNotFound)
+			return
+		}
+		data := cxn.dash.file(parts[1], parts[2])
+		if data == nil {
+			http.Error(w, "ErrNotFound", http.StatusNotFound)
+			return
+		}
+		if parts[1] == dashAudio {
+			w.Header().Set("Content-Type", "audio/mp4")
+		} else {
+			w.Header().Set("Content-Type", "video/mp4")
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		w.Write(data)
+		if monitor.Enabled {
+			monitor.LogBytesTransferred(monitor.BytesDASH, cxn.nonce, int64(len(data)))
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package server
+
+import (
+	"encoding/binary"
+	"encoding/xml"
+	"io/ioutil"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/livepeer/go-livepeer/core"
+	"github.com/livepeer/lpms/ffmpeg"
+	"github.com/livepeer/lpms/stream"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// boxTypes returns the types of the top level boxes of b, failing on
+// malformed sizes
+func boxTypes(t *testing.T, b []byte) []string {
+	var types []string
+	for len(b) > 0 {
+		require.True(t, len(b) >= 8)
+		size := int(binary.BigEndian.Uint32(b))
+		require.True(t, size >= 8 && size <= len(b), "box %s size %d", b[4:8], size)
+		types = append(types, string(b[4:8]))
+		b = b[size:]
+	}
+	return types
+}
+
+func TestDemuxTS(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	data, err := ioutil.ReadFile("../core/test.ts")
+	require.Nil(err)
+
+	video, audio, err := demuxTS(data)
+	require.Nil(err)
+	assert.True(video.video)
+	assert.Equal("avc1.7a001f", video.codecs)
+	assert.Equal(1280, video.width)
+	assert.Equal(720, video.height)
+	assert.Len(video.samples, 217)
+	assert.True(video.samples[0].sync)
+	assert.Equal([]string{"ftyp", "moov"}, boxTypes(t, initSegment(video)))
+	assert.Equal([]string{"moof", "mdat"}, boxTypes(t, fragment(1, video)))
+
+	require.NotNil(audio)
+	assert.Equal("mp4a.40.2", audio.codecs)
+	assert.Equal(44100, audio.sampleRate)
+	assert.Len(audio.samples, 179)
+	// audio and video cover about the same time
+	assert.InDelta(float64(video.duration())/float64(video.timescale), float64(audio.duration())/float64(audio.timescale), 0.1)
+	assert.Equal([]string{"ftyp", "moov"}, boxTypes(t, initSegment(audio)))
+
+	// mdat holds the samples the trun data offset points at
+	frag := fragment(1, video)
+	moofSize := int(binary.BigEndian.Uint32(frag))
+	assert.Equal(video.samples[0].data, frag[moofSize+8:moofSize+8+len(video.samples[0].data)])
+
+	_, _, err = demuxTS([]byte("not a TS segment"))
+	assert.Equal(errNoVideo, err)
+}
+
+func TestDASHManifest(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	data, err := ioutil.ReadFile("../core/test.ts")
+	require.Nil(err)
+
+	m := newDASHManifest("dash")
+	source := &ffmpeg.VideoProfile{Name: "source", Bitrate: "4000k"}
+	for i := uint64(0); i < 8; i++ {
+		require.Nil(m.insert(source, i, data, true))
+		require.Nil(m.insert(&ffmpeg.P240p30fps16x9, i, data, false))
+	}
+	// redundant submissions are ignored
+	require.Nil(m.insert(&ffmpeg.P240p30fps16x9, 7, data, false))
+	assert.NotNil(m.insert(source, 8, []byte("garbage"), true))
+
+	var doc mpd
+	out, err := m.mpd()
+	require.Nil(err)
+	require.Nil(xml.Unmarshal(out, &doc))
+	assert.Equal("dynamic", doc.Type)
+	require.Len(doc.Period.AdaptationSets, 2)
+	video := doc.Period.AdaptationSets[0]
+	require.Len(video.Representations, 2)
+	assert.Equal("source", video.Representations[0].ID)
+	assert.Equal(int64(4000000), video.Representations[0].Bandwidth)
+	assert.Equal(1280, video.Representations[0].Width)
+	assert.Equal("dash/source/init.mp4", video.Representations[0].SegmentList.Initialization.SourceURL)
+	// only the most recent segments are listed
+	urls := video.Representations[1].SegmentList.SegmentURLs
+	require.Len(urls, int(core.LIVE_LIST_LENGTH))
+	assert.Equal("dash/P240p30fps16x9/2.m4s", urls[0].Media)
+	assert.Equal("dash/P240p30fps16x9/7.m4s", urls[len(urls)-1].Media)
+	audio := doc.Period.AdaptationSets[1]
+	require.Len(audio.Representations, 1)
+	assert.Equal("audio", audio.Representations[0].ID)
+	assert.Equal(44100, audio.Representations[0].AudioSamplingRate)
+
+	assert.NotNil(m.file("source", "init.mp4"))
+	assert.NotNil(m.file("audio", "7.m4s"))
+	assert.Nil(m.file("source", "1.m4s"))
+	assert.Nil(m.file("source", "7.ts"))
+	assert.Nil(m.file("720p", "7.m4s"))
+
+	m.remove("P240p30fps16x9")
+	assert.Nil(m.file("P240p30fps16x9", "7.m4s"))
+	out, err = m.mpd()
+	require.Nil(err)
+	doc = mpd{}
+	require.Nil(xml.Unmarshal(out, &doc))
+	assert.Len(doc.Period.AdaptationSets[0].Representations, 1)
+}
+
+func TestDASHHandler(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	defer func() { EnableDASH = false }()
+	data, err := ioutil.ReadFile("../core/test.ts")
+	require.Nil(err)
+
+	s := setupServer()
+	handler := getDASHHandler(s)
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest("GET", path, nil))
+		return w
+	}
+
+	// streams without DASH packaging
+	mid := core.SplitStreamIDString(t.Name()).ManifestID
+	strm := stream.NewBasicRTMPVideoStream(string(mid))
+	cxn, err := s.registerConnection(strm)
+	require.Nil(err)
+	assert.Equal(404, get("/dash/"+string(mid)+".mpd").Code)
+	s.connectionLock.Lock()
+	delete(s.rtmpConnections, mid)
+	s.connectionLock.Unlock()
+
+	EnableDASH = true
+	cxn, err = s.registerConnection(strm)
+	require.Nil(err)
+	defer func() {
+		s.connectionLock.Lock()
+		delete(s.rtmpConnections, mid)
+		s.connectionLock.Unlock()
+	}()
+	require.NotNil(cxn.dash)
+	cxn.insertDASHSegment(cxn.profile, 0, data, true)
+
+	w := get("/dash/" + string(mid) + ".mpd")
+	assert.Equal(200, w.Code)
+	assert.Equal("application/dash+xml", w.Header().Get("Content-Type"))
+	assert.Equal("*", w.Header().Get("Access-Control-Allow-Origin"))
+
+	w = get("/dash/" + string(mid) + "/source/init.mp4")
+	assert.Equal(200, w.Code)
+	assert.Equal("video/mp4", w.Header().Get("Content-Type"))
+	assert.Equal([]string{"ftyp", "moov"}, boxTypes(t, w.Body.Bytes()))
+	w = get("/dash/" + string(mid) + "/audio/0.m4s")
+	assert.Equal(200, w.Code)
+	assert.Equal("audio/mp4", w.Header().Get("Content-Type"))
+
+	assert.Equal(404, get("/dash/"+string(mid)+"/source/1.m4s").Code)
+	assert.Equal(404, get("/dash/"+string(mid)+"/source").Code)
+	assert.Equal(404, get("/dash/unknown.mpd").Code)
+}
@@ -0,0 +1,502 @@
+package server
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Remuxing of TS segments into fragmented MP4, as per ISO/IEC 14496-12 and
+// 14496-15. Only H.264 video and ADTS AAC audio are supported, which is what
+// broadcasters ingest and transcoders output.
+
+const (
+	tsClockRate     = 90000 // PTS and DTS ticks per second
+	aacFrameSamples = 1024
+)
+
+var (
+	errNoVideo = errors.New("no H.264 video")
+	errNoPPS   = errors.New("no H.264 SPS or PPS")
+)
+
+var aacSampleRates = []int{96000, 88200, 64000, 48000, 44100, 32000, 24000, 22050, 16000, 12000, 11025, 8000, 7350}
+
+// fmp4Track is an elementary stream of a TS segment, demuxed into samples
+type fmp4Track struct {
+	video     bool
+	codecs    string // RFC 6381 codecs parameter
+	timescale uint32
+	entry     []byte // sample entry of the stsd box
+
+	width, height int // video only
+	sampleRate    int // audio only
+
+	baseTime uint64 // decode time of the first sample, in timescale
+	ept      uint64 // earliest presentation time, in timescale
+	samples  []fmp4Sample
+}
+
+type fmp4Sample struct {
+	data      []byte
+	duration  uint32
+	ctsOffset uint32 // presentation minus decode time
+	sync      bool
+}
+
+// duration returns the sum of the sample durations, in timescale
+func (t *fmp4Track) duration() uint64 {
+	var d uint64
+	for _, s := range t.samples {
+		d += uint64(s.duration)
+	}
+	return d
+}
+
+// size returns the sum of the sample sizes, in bytes
+func (t *fmp4Track) size() int {
+	n := 0
+	for _, s := range t.samples {
+		n += len(s.data)
+	}
+	return n
+}
+
+// demuxTS splits a TS segment into its H.264 video track and, if there is
+// one, its AAC audio track
+func demuxTS(data []byte) (video, audio *fmp4Track, err error) {
+	streams, _ := parseTS(data)
+	videoPID, audioPID := -1, -1
+	for pid, t := range streams {
+		switch {
+		case t == tsStreamTypeH264 && videoPID < 0:
+			videoPID = pid
+		case t == tsStreamTypeAAC && audioPID < 0:
+			audioPID = pid
+		}
+	}
+	if videoPID < 0 {
+		return nil, nil, errNoVideo
+	}
+
+	pes := map[int][][]byte{} // pid : PES packets
+	cur := map[int][]byte{}
+	for off := 0; off+tsPacketSize <= len(data); off += tsPacketSize {
+		pkt := data[off : off+tsPacketSize]
+		pid := int(pkt[1]&0x1F)<<8 | int(pkt[2])
+		if pid != videoPID && pid != audioPID {
+			continue
+		}
+		payload := tsPayload(pkt)
+		if payload == nil {
+			continue
+		}
+		if pkt[1]&0x40 != 0 { // payload_unit_start_indicator
+			if cur[pid] != nil {
+				pes[pid] = append(pes[pid], cur[pid])
+			}
+			cur[pid] = append([]byte(nil), payload...)
+		} else if cur[pid] != nil {
+			cur[pid] = append(cur[pid], payload...)
+		}
+	}
+	for pid, p := range cur {
+		pes[pid] = append(pes[pid], p)
+	}
+
+	video, err = demuxH264(pes[videoPID])
+	if err != nil {
+		return nil, nil, err
+	}
+	if audioPID >= 0 {
+		audio, err = demuxAAC(pes[audioPID])
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return video, audio, nil
+}
+
+// parsePES returns the timestamps and payload of a PES packet. Timestamps
+// are -1 if absent.
+func parsePES(p []byte) (pts, dts int64, payload []byte, ok bool) {
+	if len(p) < 9 || p[0] != 0 || p[1] != 0 || p[2] != 1 {
+		return -1, -1, nil, false
+	}
+	pesLen := int(p[4])<<8 | int(p[5])
+	if pesLen > 0 && 6+pesLen < len(p) {
+		p = p[:6+pesLen]
+	}
+	flags := p[7] >> 6
+	hdrEnd := 9 + int(p[8])
+	if hdrEnd > len(p) {
+		return -1, -1, nil, false
+	}
+	pts, dts = -1, -1
+	if flags&2 != 0 && hdrEnd >= 14 {
+		pts = readTimestamp(p[9:])
+		dts = pts
+	}
+	if flags == 3 && hdrEnd >= 19 {
+		dts = readTimestamp(p[14:])
+	}
+	return pts, dts, p[hdrEnd:], true
+}
+
+// readTimestamp reads a 33 bit PTS or DTS coded over 5 bytes
+func readTimestamp(b []byte) int64 {
+	return int64(b[0]>>1&0x07)<<30 | int64(b[1])<<22 | int64(b[2]>>1)<<15 | int64(b[3])<<7 | int64(b[4]>>1)
+}
+
+// splitNALs splits an Annex B byte stream into NAL units
+func splitNALs(b []byte) [][]byte {
+	var nals [][]byte
+	start := -1
+	for i := 0; i+2 < len(b); i++ {
+		if b[i] != 0 || b[i+1] != 0 || b[i+2] != 1 {
+			continue
+		}
+		if start >= 0 {
+			nals = append(nals, trimZeros(b[start:i]))
+		}
+		start = i + 3
+		i += 2
+	}
+	if start >= 0 && start < len(b) {
+		nals = append(nals, trimZeros(b[start:]))
+	}
+	return nals
+}
+
+// trimZeros removes the trailing zero bytes of a NAL unit, which belong to
+// the next start code
+func trimZeros(nal []byte) []byte {
+	for len(nal) > 0 && nal[len(nal)-1] == 0 {
+		nal = nal[:len(nal)-1]
+	}
+	return nal
+}
+
+// demuxH264 turns PES packets, each holding an access unit, into samples of
+// length prefixed NAL units
+func demuxH264(packets [][]byte) (*fmp4Track, error) {
+	type frame struct {
+		pts, dts int64
+		data     []byte
+		sync     bool
+	}
+	var frames []*frame
+	var sps, pps []byte
+	for _, p := range packets {
+		pts, dts, payload, ok := parsePES(p)
+		if !ok {
+			continue
+		}
+		var sample []byte
+		sync := false
+		for _, nal := range splitNALs(payload) {
+			if len(nal) == 0 {
+				continue
+			}
+			switch nal[0] & 0x1F {
+			case 7:
+				if sps == nil {
+					sps = nal
+				}
+				continue
+			case 8:
+				if pps == nil {
+					pps = nal
+				}
+				continue
+			case 9: // access unit delimiter
+				continue
+			case 5:
+				sync = true
+			}
+			var size [4]byte
+			binary.BigEndian.PutUint32(size[:], uint32(len(nal)))
+			sample = append(append(sample, size[:]...), nal...)
+		}
+		if pts < 0 {
+			// continuation of the previous access unit
+			if len(frames) > 0 {
+				last := frames[len(frames)-1]
+				last.data = append(last.data, sample...)
+				last.sync = last.sync || sync
+			}
+			continue
+		}
+		if len(sample) > 0 {
+			frames = append(frames, &frame{pts: pts, dts: dts, data: sample, sync: sync})
+		}
+	}
+	if len(frames) == 0 {
+		return nil, errNoVideo
+	}
+	if sps == nil || pps == nil {
+		return nil, errNoPPS
+	}
+	info, err := parseSPS(sps)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &fmp4Track{
+		video:     true,
+		codecs:    fmt.Sprintf("avc1.%02x%02x%02x", sps[1], sps[2], sps[3]),
+		timescale: tsClockRate,
+		width:     info.width,
+		height:    info.height,
+		baseTime:  uint64(frames[0].dts),
+		ept:       uint64(frames[0].pts),
+	}
+	duration := uint32(tsClockRate / 30) // assumed if there's a single frame
+	for i, f := range frames {
+		if i+1 < len(frames) && frames[i+1].dts > f.dts {
+			duration = uint32(frames[i+1].dts - f.dts)
+		}
+		if uint64(f.pts) < t.ept {
+			t.ept = uint64(f.pts)
+		}
+		cts := uint32(0)
+		if f.pts > f.dts {
+			cts = uint32(f.pts - f.dts)
+		}
+		t.samples = append(t.samples, fmp4Sample{data: f.data, duration: duration, ctsOffset: cts, sync: f.sync})
+	}
+	t.entry = avcSampleEntry(t, sps, pps, info)
+	return t, nil
+}
+
+// demuxAAC turns PES packets of ADTS frames into raw AAC samples
+func demuxAAC(packets [][]byte) (*fmp4Track, error) {
+	var t *fmp4Track
+	var objectType, freqIdx, channels int
+	var times []uint64 // decode time of each sample
+	for _, p := range packets {
+		pts, _, payload, ok := parsePES(p)
+		if !ok {
+			continue
+		}
+		first := true
+		for len(payload) >= 7 && payload[0] == 0xFF && payload[1]&0xF0 == 0xF0 {
+			hdrLen := 7
+			if payload[1]&1 == 0 { // protection_absent
+				hdrLen = 9
+			}
+			frameLen := int(payload[3]&0x03)<<11 | int(payload[4])<<3 | int(payload[5]>>5)
+			if frameLen < hdrLen || frameLen > len(payload) {
+				break
+			}
+			if t == nil {
+				objectType = int(payload[2]>>6) + 1
+				freqIdx = int(payload[2]>>2) & 0x0F
+				channels = int(payload[2]&1)<<2 | int(payload[3]>>6)
+				if freqIdx >= len(aacSampleRates) || pts < 0 {
+					return nil, fmt.Errorf("unsupported ADTS header")
+				}
+				rate := aacSampleRates[freqIdx]
+				t = &fmp4Track{
+					codecs:     fmt.Sprintf("mp4a.40.%d", objectType),
+					timescale:  uint32(rate),
+					sampleRate: rate,
+					baseTime:   uint64(pts) * uint64(rate) / tsClockRate,
+				}
+				t.ept = t.baseTime
+			}
+			// frames within a packet follow each other, but there may be gaps
+			// between packets
+			ts := t.baseTime
+			if len(times) > 0 {
+				ts = times[len(times)-1] + aacFrameSamples
+			}
+			if first && pts >= 0 {
+				ts = uint64(pts) * uint64(t.sampleRate) / tsClockRate
+			}
+			first = false
+			times = append(times, ts)
+			t.samples = append(t.samples, fmp4Sample{data: payload[hdrLen:frameLen], sync: true})
+			payload = payload[frameLen:]
+		}
+	}
+	if t == nil {
+		return nil, nil
+	}
+	for i := range t.samples {
+		t.samples[i].duration = aacFrameSamples
+		if i+1 < len(times) && times[i+1] > times[i] {
+			t.samples[i].duration = uint32(times[i+1] - times[i])
+		}
+	}
+	t.entry = aacSampleEntry(t, objectType, freqIdx, channels)
+	return t, nil
+}
+
+// box returns an ISOBMFF box of type typ holding the concatenated payloads
+func box(typ string, payloads ...[]byte) []byte {
+	size := 8
+	for _, p := range payloads {
+		size += len(p)
+	}
+	b := make([]byte, 8, size)
+	binary.BigEndian.PutUint32(b, uint32(size))
+	copy(b[4:], typ)
+	for _, p := range payloads {
+		b = append(b, p...)
+	}
+	return b
+}
+
+// fullBox returns a box with a version and flags header
+func fullBox(typ string, version byte, flags uint32, payloads ...[]byte) []byte {
+	hdr := []byte{version, byte(flags >> 16), byte(flags >> 8), byte(flags)}
+	return box(typ, append([][]byte{hdr}, payloads...)...)
+}
+
+// fields serializes fixed size values big endian
+func fields(vals ...interface{}) []byte {
+	buf := &bytes.Buffer{}
+	for _, v := range vals {
+		binary.Write(buf, binary.BigEndian, v)
+	}
+	return buf.Bytes()
+}
+
+var unityMatrix = []uint32{0x00010000, 0, 0, 0, 0x00010000, 0, 0, 0, 0x40000000}
+
+// initSegment returns the ftyp and moov boxes of a file holding tracks,
+// which are given IDs from 1 in order
+func initSegment(tracks ...*fmp4Track) []byte {
+	const movieTimescale = 1000
+	ftyp := box("ftyp", []byte("iso6"), fields(uint32(0)), []byte("iso6dashmp41"))
+	mvhd := fullBox("mvhd", 0, 0, fields(
+		uint32(0), uint32(0), // creation and modification time
+		uint32(movieTimescale), uint32(0), // duration is unknown
+		uint32(0x00010000), uint16(0x0100), uint16(0), [2]uint32{}, // rate, volume, reserved
+		unityMatrix, [6]uint32{}, // pre_defined
+		uint32(len(tracks)+1), // next_track_ID
+	))
+	moov := [][]byte{mvhd}
+	var trex [][]byte
+	for i, t := range tracks {
+		moov = append(moov, trackBox(uint32(i+1), t))
+		trex = append(trex, fullBox("trex", 0, 0, fields(uint32(i+1), uint32(1), uint32(0), uint32(0), uint32(0))))
+	}
+	moov = append(moov, box("mvex", trex...))
+	return append(ftyp, box("moov", moov...)...)
+}
+
+// trackBox returns the trak box describing a track
+func trackBox(trackID uint32, t *fmp4Track) []byte {
+	handler, name, mediaHeader := "soun", "SoundHandler", fullBox("smhd", 0, 0, fields(uint16(0), uint16(0)))
+	width, height := uint32(0), uint32(0)
+	volume := uint16(0x0100)
+	if t.video {
+		handler, name = "vide", "VideoHandler"
+		mediaHeader = fullBox("vmhd", 0, 1, fields(uint16(0), [3]uint16{}))
+		width, height = uint32(t.width)<<16, uint32(t.height)<<16
+		volume = 0
+	}
+
+	tkhd := fullBox("tkhd", 0, 3, fields( // enabled, in movie
+		uint32(0), uint32(0), trackID, uint32(0), uint32(0),
+		[2]uint32{}, uint16(0), uint16(0), volume, uint16(0),
+		unityMatrix, width, height,
+	))
+	mdhd := fullBox("mdhd", 0, 0, fields(uint32(0), uint32(0), t.timescale, uint32(0), uint16(0x55C4), uint16(0))) // language und
+	hdlr := fullBox("hdlr", 0, 0, fields(uint32(0)), []byte(handler), fields([3]uint32{}), []byte(name+"\x00"))
+	dinf := box("dinf", fullBox("dref", 0, 0, fields(uint32(1)), fullBox("url ", 0, 1))) // media in the same file
+	stbl := box("stbl",
+		fullBox("stsd", 0, 0, fields(uint32(1)), t.entry),
+		fullBox("stts", 0, 0, fields(uint32(0))),
+		fullBox("stsc", 0, 0, fields(uint32(0))),
+		fullBox("stsz", 0, 0, fields(uint32(0), uint32(0))),
+		fullBox("stco", 0, 0, fields(uint32(0))),
+	)
+	return box("trak", tkhd, box("mdia", mdhd, hdlr, box("minf", mediaHeader, dinf, stbl)))
+}
+
+// avcSampleEntry returns the avc1 sample entry describing an H.264 track
+func avcSampleEntry(t *fmp4Track, sps, pps []byte, info *spsInfo) []byte {
+	avcC := fields(uint8(1), sps[1], sps[2], sps[3], uint8(0xFF), uint8(0xE1), uint16(len(sps)), sps, uint8(1), uint16(len(pps)), pps)
+	switch sps[1] {
+	case 100, 110, 122, 144: // high profiles carry the chroma format and bit depths
+		avcC = append(avcC, 0xFC|byte(info.chromaFormat), 0xF8|byte(info.bitDepthLuma-8), 0xF8|byte(info.bitDepthChroma-8), 0)
+	}
+	return box("avc1", fields(
+		[6]byte{}, uint16(1), // reserved, data_reference_index
+		uint16(0), uint16(0), [3]uint32{}, // pre_defined, reserved
+		uint16(t.width), uint16(t.height),
+		uint32(0x00480000), uint32(0x00480000), // 72 dpi
+		uint32(0), uint16(1), [32]byte{}, // reserved, frame_count, compressorname
+		uint16(0x0018), int16(-1), // depth, pre_defined
+	), box("avcC", avcC))
+}
+
+// aacSampleEntry returns the mp4a sample entry describing an AAC track
+func aacSampleEntry(t *fmp4Track, objectType, freqIdx, channels int) []byte {
+	asc := []byte{byte(objectType<<3 | freqIdx>>1), byte((freqIdx&1)<<7 | channels<<3)} // AudioSpecificConfig
+	dsi := append([]byte{0x05, byte(len(asc))}, asc...)
+	dcd := append([]byte{0x04, byte(13 + len(dsi)), 0x40, 0x15, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}, dsi...)
+	sl := []byte{0x06, 1, 2}
+	es := append([]byte{0x03, byte(3 + len(dcd) + len(sl)), 0, 0, 0}, dcd...)
+	es = append(es, sl...)
+	return box("mp4a", fields(
+		[6]byte{}, uint16(1), // reserved, data_reference_index
+		[2]uint32{}, uint16(channels), uint16(16), // reserved, channelcount, samplesize
+		uint16(0), uint16(0), uint32(t.sampleRate)<<16,
+	), fullBox("esds", 0, 0, es))
+}
+
+// fragment returns the samples of tracks as a media segment: a moof box
+// followed by the mdat box holding the samples. Tracks are given IDs from 1
+// in order, as in initSegment.
+func fragment(seq uint32, tracks ...*fmp4Track) []byte {
+	var mdat []byte
+	offsets := make([]uint32, len(tracks)) // of each track's samples within mdat
+	for i, t := range tracks {
+		offsets[i] = uint32(len(mdat))
+		for _, s := range t.samples {
+			mdat = append(mdat, s.data...)
+		}
+	}
+
+	moof := func(base uint32) []byte {
+		trafs := [][]byte{fullBox("mfhd", 0, 0, fields(seq))}
+		for i, t := range tracks {
+			trafs = append(trafs, t.traf(uint32(i+1), base+offsets[i]))
+		}
+		return box("moof", trafs...)
+	}
+	// samples start right after the moof and mdat headers
+	m := moof(0)
+	m = moof(uint32(len(m) + 8))
+	return append(m, box("mdat", mdat)...)
+}
+
+// traf returns the track fragment box of the samples of the track, which
+// start at dataOffset from the beginning of the moof box
+func (t *fmp4Track) traf(trackID, dataOffset uint32) []byte {
+	flags := uint32(0x000001 | 0x000100 | 0x000200) // data offset, duration, size
+	if t.video {
+		flags |= 0x000400 | 0x000800 // sample flags, composition time offset
+	}
+	var entries []byte
+	for _, s := range t.samples {
+		entries = append(entries, fields(s.duration, uint32(len(s.data)))...)
+		if t.video {
+			sampleFlags := uint32(0x01010000) // depends on others, non-sync
+			if s.sync {
+				sampleFlags = 0x02000000
+			}
+			entries = append(entries, fields(sampleFlags, s.ctsOffset)...)
+		}
+	}
+	return box("traf",
+		fullBox("tfhd", 0, 0x020000, fields(trackID)), // default-base-is-moof
+		fullBox("tfdt", 1, 0, fields(t.baseTime)),
+		fullBox("trun", 0, flags, fields(uint32(len(t.samples)), dataOffset), entries),
+	)
+}
@@ -5,11 +5,13 @@ import (
 	"fmt"
 	"math/big"
 	"net/http"
+	"strconv"
 
 	ethcommon "github.com/ethereum/go-ethereum/common"
 	"github.com/golang/glog"
 	"github.com/livepeer/go-livepeer/common"
 	"github.com/livepeer/go-livepeer/eth"
+	"github.com/livepeer/go-livepeer/monitor"
 )
 
 func respondWith500(w http.ResponseWriter, errMsg string) {
@@ -68,6 +70,87 @@ func currentBlockHandler(getter BlockGetter) http.Handler {
 	})
 }
 
+// StreamStatsGetter is an interface which describes an object capable
+// of getting the summaries of ended streams
+type StreamStatsGetter interface {
+	// StreamStats returns up to limit stream summaries, newest first
+	StreamStats(manifestID string, limit int) ([]*common.DBStreamStats, error)
+}
+
+// Default and maximum number of stream summaries returned by streamStatsHandler
+const (
+	defaultStreamStatsLimit = 100
+	maxStreamStatsLimit     = 1000
+)
+
+func streamStatsHandler(getter StreamStatsGetter) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if getter == nil {
+			respondWith500(w, "missing stream stats getter")
+			return
+		}
+
+		limit := defaultStreamStatsLimit
+		if l := r.FormValue("limit"); l != "" {
+			n, err := strconv.Atoi(l)
+			if err != nil || n <= 0 {
+				respondWith400(w, fmt.Sprintf("invalid limit: %v", l))
+				return
+			}
+			if n > maxStreamStatsLimit {
+				n = maxStreamStatsLimit
+			}
+			limit = n
+		}
+
+		res, err := getter.StreamStats(r.FormValue("manifestID"), limit)
+		if err != nil {
+			respondWith500(w, fmt.Sprintf("could not query stream stats: %v", err))
+			return
+		}
+
+		data, err := json.Marshal(res)
+		if err != nil {
+			respondWith500(w, fmt.Sprintf("could not parse stream stats: %v", err))
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(data)
+	})
+}
+
+// metricsGroupsHandler returns whether each metric view group is enabled on
+// GET, and enables or disables the view group given by the "group" and
+// "enabled" form params on POST
+func metricsGroupsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			enabled, err := strconv.ParseBool(r.FormValue("enabled"))
+			if err != nil {
+				respondWith400(w, fmt.Sprintf("invalid enabled: %v", r.FormValue("enabled")))
+				return
+			}
+			if err := monitor.SetViewGroupEnabled(r.FormValue("group"), enabled); err != nil {
+				respondWith400(w, err.Error())
+				return
+			}
+			glog.Infof("Set metrics group %s enabled=%v", r.FormValue("group"), enabled)
+		}
+
+		data, err := json.Marshal(monitor.ViewGroups())
+		if err != nil {
+			respondWith500(w, fmt.Sprintf("could not parse metrics groups: %v", err))
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(data)
+	})
+}
+
 func fundAndApproveSignersHandler(client eth.LivepeerEthClient) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if client == nil {
@@ -14,6 +14,7 @@ import (
 
 	"github.com/ethereum/go-ethereum/accounts"
 	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/livepeer/go-livepeer/common"
 	"github.com/livepeer/go-livepeer/eth"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
@@ -35,6 +36,21 @@ func (m *mockBlockGetter) LastSeenBlock() (*big.Int, error) {
 	return blk, args.Error(1)
 }
 
+type mockStreamStatsGetter struct {
+	mock.Mock
+}
+
+func (m *mockStreamStatsGetter) StreamStats(manifestID string, limit int) ([]*common.DBStreamStats, error) {
+	args := m.Called(manifestID, limit)
+
+	var stats []*common.DBStreamStats
+	if args.Get(0) != nil {
+		stats = args.Get(0).([]*common.DBStreamStats)
+	}
+
+	return stats, args.Error(1)
+}
+
 func dummyHandler() http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
@@ -145,6 +161,73 @@ func TestCurrentBlockHandler_Success(t *testing.T) {
 	assert.Equal(big.NewInt(50), new(big.Int).SetBytes(body))
 }
 
+func TestStreamStatsHandler_MissingGetter(t *testing.T) {
+	handler := streamStatsHandler(nil)
+
+	resp := httpGetResp(handler)
+	body, _ := ioutil.ReadAll(resp.Body)
+
+	assert := assert.New(t)
+	assert.Equal(http.StatusInternalServerError, resp.StatusCode)
+	assert.Equal("missing stream stats getter", strings.TrimSpace(string(body)))
+}
+
+func TestStreamStatsHandler_InvalidLimit(t *testing.T) {
+	getter := &mockStreamStatsGetter{}
+	handler := streamStatsHandler(getter)
+	assert := assert.New(t)
+
+	for _, limit := range []string{"foo", "0", "-1"} {
+		resp := httpPostFormResp(handler, strings.NewReader("limit="+limit))
+		body, _ := ioutil.ReadAll(resp.Body)
+
+		assert.Equal(http.StatusBadRequest, resp.StatusCode)
+		assert.Equal("invalid limit: "+limit, strings.TrimSpace(string(body)))
+	}
+	getter.AssertNotCalled(t, "StreamStats", mock.Anything, mock.Anything)
+}
+
+func TestStreamStatsHandler_StreamStatsError(t *testing.T) {
+	getter := &mockStreamStatsGetter{}
+	handler := streamStatsHandler(getter)
+
+	getter.On("StreamStats", "", defaultStreamStatsLimit).Return(nil, errors.New("StreamStats error"))
+
+	resp := httpGetResp(handler)
+	body, _ := ioutil.ReadAll(resp.Body)
+
+	assert := assert.New(t)
+	assert.Equal(http.StatusInternalServerError, resp.StatusCode)
+	assert.Equal("could not query stream stats: StreamStats error", strings.TrimSpace(string(body)))
+}
+
+func TestStreamStatsHandler_Success(t *testing.T) {
+	getter := &mockStreamStatsGetter{}
+	handler := streamStatsHandler(getter)
+	stats := []*common.DBStreamStats{{ManifestID: "a", Nonce: 1, SegmentsEmerged: 10, FeesSent: big.NewInt(100)}}
+
+	getter.On("StreamStats", "a", 10).Return(stats, nil)
+	getter.On("StreamStats", "", maxStreamStatsLimit).Return([]*common.DBStreamStats{}, nil)
+
+	resp := httpPostFormResp(handler, strings.NewReader("manifestID=a&limit=10"))
+	body, _ := ioutil.ReadAll(resp.Body)
+
+	var res []*common.DBStreamStats
+	require.Nil(t, json.Unmarshal(body, &res))
+	assert := assert.New(t)
+	assert.Equal(http.StatusOK, resp.StatusCode)
+	assert.Equal("application/json", resp.Header.Get("Content-Type"))
+	assert.Equal(stats, res)
+
+	// limits above the max are capped
+	resp = httpPostFormResp(handler, strings.NewReader("limit=5000"))
+	body, _ = ioutil.ReadAll(resp.Body)
+
+	assert.Equal(http.StatusOK, resp.StatusCode)
+	assert.Equal("[]", strings.TrimSpace(string(body)))
+	getter.AssertExpectations(t)
+}
+
 func TestFundAndApproveSignersHandler_MissingClient(t *testing.T) {
 	handler := fundAndApproveSignersHandler(nil)
 
@@ -608,6 +691,41 @@ func TestTicketBrokerParamsHandler_Success(t *testing.T) {
 	assert.Equal(unlockPeriod, params.UnlockPeriod)
 }
 
+func TestMetricsGroupsHandler_InvalidEnabled(t *testing.T) {
+	handler := metricsGroupsHandler()
+
+	form := url.Values{"group": {"profile"}, "enabled": {"maybe"}}
+	resp := httpPostFormResp(handler, strings.NewReader(form.Encode()))
+	body, _ := ioutil.ReadAll(resp.Body)
+
+	assert := assert.New(t)
+	assert.Equal(http.StatusBadRequest, resp.StatusCode)
+	assert.Equal("invalid enabled: maybe", strings.TrimSpace(string(body)))
+}
+
+func TestMetricsGroupsHandler_UnknownGroup(t *testing.T) {
+	handler := metricsGroupsHandler()
+
+	form := url.Values{"group": {"foo"}, "enabled": {"false"}}
+	resp := httpPostFormResp(handler, strings.NewReader(form.Encode()))
+
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestMetricsGroupsHandler_Success(t *testing.T) {
+	handler := metricsGroupsHandler()
+
+	resp := httpGetResp(handler)
+	body, _ := ioutil.ReadAll(resp.Body)
+
+	var groups map[string]bool
+	require.Nil(t, json.Unmarshal(body, &groups))
+	assert := assert.New(t)
+	assert.Equal(http.StatusOK, resp.StatusCode)
+	assert.True(groups["profile"])
+	assert.True(groups["debug"])
+}
+
 func httpPostFormResp(handler http.Handler, body io.Reader) *http.Response {
 	headers := map[string]string{
 		"Content-Type": "application/x-www-form-urlencoded",
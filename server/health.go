@@ -0,0 +1,166 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	gonet "net"
+	"net/http"
+	"time"
+
+	"github.com/livepeer/go-livepeer/core"
+	"github.com/livepeer/go-livepeer/net"
+)
+
+// Maximum time a single readiness check may take
+var healthCheckTimeout = 2 * time.Second
+
+var errNoOrchestrators = errors.New("no orchestrators available")
+
+type healthCheck struct {
+	name  string
+	check func(ctx context.Context) error
+}
+
+type readyzResponse struct {
+	Ready  bool              `json:"ready"`
+	Checks map[string]string `json:"checks"`
+}
+
+// healthzHandler reports that the node process is alive
+func healthzHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("OK"))
+	})
+}
+
+// readyzHandler runs the readiness checks for the node type and responds
+// with 503 if any of them fail
+func readyzHandler(s *LivepeerServer) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		resp := readyzResponse{Ready: true, Checks: make(map[string]string)}
+		for _, c := range s.readinessChecks() {
+			ctx, cancel := context.WithTimeout(r.Context(), healthCheckTimeout)
+			err := c.check(ctx)
+			cancel()
+			if err != nil {
+				resp.Ready = false
+				resp.Checks[c.name] = err.Error()
+			} else {
+				resp.Checks[c.name] = "ok"
+			}
+		}
+		data, err := json.Marshal(resp)
+		if err != nil {
+			respondWith500(w, err.Error())
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if !resp.Ready {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		w.Write(data)
+	})
+}
+
+func (s *LivepeerServer) readinessChecks() []healthCheck {
+	n := s.LivepeerNode
+	var checks []healthCheck
+	switch n.NodeType {
+	case core.BroadcasterNode:
+		checks = append(checks, healthCheck{"rtmp", s.checkRTMP})
+		if n.OrchestratorPool != nil {
+			checks = append(checks, healthCheck{"orchestrators", s.checkOrchestrators})
+		}
+	case core.OrchestratorNode, core.TranscoderNode:
+		checks = append(checks, healthCheck{"transcoder", s.checkTranscoder})
+	}
+	if n.Eth != nil {
+		checks = append(checks, healthCheck{"eth", s.checkEthSynced})
+	}
+	return checks
+}
+
+// checkRTMP checks that the RTMP server is accepting connections
+func (s *LivepeerServer) checkRTMP(ctx context.Context) error {
+	var d gonet.Dialer
+	conn, err := d.DialContext(ctx, "tcp", s.rtmpAddr)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// checkOrchestrators checks that orchestrators are available: a stream has a
+// session with one, or discovery returns one before ctx is done. Streaming
+// pools stop discovery at the first orchestrator.
+func (s *LivepeerServer) checkOrchestrators(ctx context.Context) error {
+	if s.hasSession() {
+		return nil
+	}
+	pool := s.LivepeerNode.OrchestratorPool
+	if ipool, ok := pool.(net.IncrementalOrchestratorPool); ok {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		for range ipool.StreamOrchestrators(ctx, 1, discoveryConstraints()) {
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		return errNoOrchestrators
+	}
+
+	result := make(chan error, 1)
+	go func() {
+		orchs, err := pool.GetOrchestrators(1, discoveryConstraints())
+		if err == nil && len(orchs) == 0 {
+			err = errNoOrchestrators
+		}
+		result <- err
+	}()
+	select {
+	case err := <-result:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// hasSession returns true if any stream has a session with an orchestrator
+func (s *LivepeerServer) hasSession() bool {
+	s.connectionLock.RLock()
+	defer s.connectionLock.RUnlock()
+	for _, cxn := range s.rtmpConnections {
+		cxn.lock.RLock()
+		sess := cxn.sess
+		cxn.lock.RUnlock()
+		if sess != nil {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *LivepeerServer) checkTranscoder(ctx context.Context) error {
+	if !s.LivepeerNode.HasTranscoder() {
+		return errors.New("no transcoder available")
+	}
+	return nil
+}
+
+func (s *LivepeerServer) checkEthSynced(ctx context.Context) error {
+	backend, err := s.LivepeerNode.Eth.Backend()
+	if err != nil {
+		return err
+	}
+	progress, err := backend.SyncProgress(ctx)
+	if err != nil {
+		return err
+	}
+	if progress != nil {
+		return errors.New("eth client is syncing")
+	}
+	return nil
+}
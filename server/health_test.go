@@ -0,0 +1,116 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	gonet "net"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/livepeer/go-livepeer/core"
+	"github.com/livepeer/go-livepeer/net"
+)
+
+func TestHealthz(t *testing.T) {
+	resp := httpGetResp(healthzHandler())
+	if resp.StatusCode != http.StatusOK {
+		t.Error("Unexpected status ", resp.StatusCode)
+	}
+}
+
+func TestReadyz_Broadcaster(t *testing.T) {
+	n, _ := core.NewLivepeerNode(nil, "./tmp", nil)
+	n.NodeType = core.BroadcasterNode
+	n.OrchestratorPool = &stubDiscovery{}
+
+	ln, err := gonet.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	s := &LivepeerServer{LivepeerNode: n, rtmpAddr: ln.Addr().String()}
+
+	readyz := func() (int, readyzResponse) {
+		resp := httpGetResp(readyzHandler(s))
+		body, _ := ioutil.ReadAll(resp.Body)
+		var r readyzResponse
+		if err := json.Unmarshal(body, &r); err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode, r
+	}
+
+	// no orchestrators
+	code, r := readyz()
+	if code != http.StatusServiceUnavailable || r.Ready {
+		t.Error("Expected not ready without orchestrators ", code, r)
+	}
+	if r.Checks["rtmp"] != "ok" || r.Checks["orchestrators"] == "ok" {
+		t.Error("Unexpected checks ", r.Checks)
+	}
+
+	// all checks pass
+	n.OrchestratorPool = &stubDiscovery{infos: []*net.OrchestratorInfo{{Transcoder: "https://127.0.0.1:8935"}}}
+	code, r = readyz()
+	if code != http.StatusOK || !r.Ready {
+		t.Error("Expected ready ", code, r)
+	}
+
+	// RTMP listener down
+	ln.Close()
+	code, r = readyz()
+	if code != http.StatusServiceUnavailable || r.Checks["rtmp"] == "ok" {
+		t.Error("Expected not ready without RTMP listener ", code, r)
+	}
+}
+
+func TestCheckOrchestrators(t *testing.T) {
+	defer func(d time.Duration) { healthCheckTimeout = d }(healthCheckTimeout)
+	healthCheckTimeout = 100 * time.Millisecond
+	n, _ := core.NewLivepeerNode(nil, "./tmp", nil)
+	n.NodeType = core.BroadcasterNode
+	pool := &stubDiscovery{waitGetOrch: make(chan struct{}), lock: &sync.Mutex{}}
+	defer close(pool.waitGetOrch)
+	n.OrchestratorPool = pool
+	s := &LivepeerServer{LivepeerNode: n, connectionLock: &sync.RWMutex{}, rtmpConnections: make(map[core.ManifestID]*rtmpConnection)}
+
+	// slow discovery doesn't hold up the check past its timeout
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(context.Background(), healthCheckTimeout)
+	err := s.checkOrchestrators(ctx)
+	cancel()
+	if err != context.DeadlineExceeded || time.Since(start) > time.Second {
+		t.Error("Expected check to time out; got ", err, time.Since(start))
+	}
+
+	// streams with a session don't need discovery
+	s.rtmpConnections["stream"] = &rtmpConnection{lock: &sync.RWMutex{}, sess: &BroadcastSession{OrchestratorInfo: &net.OrchestratorInfo{Transcoder: "https://127.0.0.1:8935"}}}
+	if err := s.checkOrchestrators(context.Background()); err != nil {
+		t.Error("Expected orchestrators of sessions to be available; got ", err)
+	}
+	pool.lock.Lock()
+	defer pool.lock.Unlock()
+	if pool.getOrchCalls != 0 {
+		t.Error("Unexpected discovery calls ", pool.getOrchCalls)
+	}
+}
+
+func TestReadyz_Orchestrator(t *testing.T) {
+	n, _ := core.NewLivepeerNode(nil, "./tmp", nil)
+	n.NodeType = core.OrchestratorNode
+	s := &LivepeerServer{LivepeerNode: n}
+
+	resp := httpGetResp(readyzHandler(s))
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Error("Expected not ready without transcoder ", resp.StatusCode)
+	}
+
+	n.Transcoder = core.NewLocalTranscoder("./tmp")
+	resp = httpGetResp(readyzHandler(s))
+	if resp.StatusCode != http.StatusOK {
+		t.Error("Expected ready with transcoder ", resp.StatusCode)
+	}
+}
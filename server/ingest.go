@@ -0,0 +1,86 @@
+package server
+
+import (
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/livepeer/go-livepeer/monitor"
+	"github.com/livepeer/lpms/stream"
+)
+
+// MaxStreamsPerMinute caps how many RTMP streams may be started per minute
+// across all clients. Zero disables the limit.
+var MaxStreamsPerMinute = 0
+
+// MaxIngestBitrate is the highest bitrate, in bits per second, streams may be
+// ingested at. Streams whose source segments exceed it for
+// ingestBitrateSegments segments in a row are closed. Zero disables the limit.
+var MaxIngestBitrate int64 = 0
+
+// Number of consecutive source segments above MaxIngestBitrate after which a
+// stream is closed; tolerates the odd segment with a large keyframe
+const ingestBitrateSegments = 3
+
+// Reasons RTMP streams are rejected for, as reported by LogStreamRejected
+const (
+	rejectUnauthorized   = "Unauthorized"
+	rejectTooManyStreams = "TooManyStreams"
+	rejectStreamRate     = "StreamRate"
+	rejectIngestBitrate  = "IngestBitrate"
+	rejectDraining       = "Draining"
+)
+
+// streamRateLimiter limits the number of streams started per minute
+type streamRateLimiter struct {
+	lock   sync.Mutex
+	starts []time.Time // within the last minute, oldest first
+}
+
+var streamStarts = &streamRateLimiter{}
+
+// allow records a stream starting at now unless max streams already started
+// within the minute before it
+func (l *streamRateLimiter) allow(now time.Time, max int) bool {
+	if max <= 0 {
+		return true
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	i := 0
+	for i < len(l.starts) && now.Sub(l.starts[i]) >= time.Minute {
+		i++
+	}
+	l.starts = l.starts[i:]
+	if len(l.starts) >= max {
+		return false
+	}
+	l.starts = append(l.starts, now)
+	return true
+}
+
+// rejectStream logs and counts an RTMP stream rejected for reason. The nonce
+// is zero for streams rejected before they were registered.
+func rejectStream(nonce uint64, reason string) {
+	glog.Errorf("Rejecting stream nonce=%d reason=%s", nonce, reason)
+	if monitor.Enabled {
+		monitor.LogStreamRejected(nonce, reason)
+	}
+}
+
+// checkIngestBitrate reports whether the source segment pushes the stream
+// over MaxIngestBitrate. Only called from processSegment, which runs
+// sequentially per stream.
+func (cxn *rtmpConnection) checkIngestBitrate(seg *stream.HLSSegment) bool {
+	if MaxIngestBitrate <= 0 || seg.Duration <= 0 {
+		return false
+	}
+	bitrate := int64(float64(len(seg.Data)*8) / seg.Duration)
+	if bitrate <= MaxIngestBitrate {
+		cxn.overBitrate = 0
+		return false
+	}
+	cxn.overBitrate++
+	glog.Warningf("Segment above the maximum ingest bitrate manifestID=%s nonce=%d seqNo=%d bitrate=%d max=%d", cxn.mid, cxn.nonce, seg.SeqNo, bitrate, MaxIngestBitrate)
+	return cxn.overBitrate >= ingestBitrateSegments
+}
@@ -0,0 +1,114 @@
+package server
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/livepeer/go-livepeer/core"
+	"github.com/livepeer/lpms/stream"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStreamRateLimiter(t *testing.T) {
+	assert := assert.New(t)
+	l := &streamRateLimiter{}
+	now := time.Now()
+	assert.True(l.allow(now, 2))
+	assert.True(l.allow(now.Add(10*time.Second), 2))
+	assert.False(l.allow(now.Add(20*time.Second), 2))
+	// rejected streams don't count against the limit
+	assert.Len(l.starts, 2)
+	// the oldest start drops out of the window after a minute
+	assert.True(l.allow(now.Add(time.Minute), 2))
+	assert.False(l.allow(now.Add(time.Minute), 2))
+	// no limit
+	assert.True(l.allow(now.Add(time.Minute), 0))
+}
+
+func TestCreateRTMPStreamIDHandler_StreamRate(t *testing.T) {
+	defer func(l *streamRateLimiter) { streamStarts = l }(streamStarts)
+	defer func() { MaxStreamsPerMinute = 0 }()
+	streamStarts = &streamRateLimiter{}
+	MaxStreamsPerMinute = 1
+
+	s := setupServer()
+	createSid := createRTMPStreamIDHandler(s)
+	u, _ := url.Parse("rtmp://localhost/stream/rate1")
+	assert.NotEmpty(t, createSid(u))
+	u, _ = url.Parse("rtmp://localhost/stream/rate2")
+	assert.Empty(t, createSid(u))
+}
+
+func TestCreateRTMPStreamIDHandler_StreamRateAfterChecks(t *testing.T) {
+	defer func(l *streamRateLimiter) { streamStarts = l }(streamStarts)
+	defer func() { MaxStreamsPerMinute = 0 }()
+	defer func(url string) { AuthWebhookURL = url }(AuthWebhookURL)
+	streamStarts = &streamRateLimiter{}
+	MaxStreamsPerMinute = 1
+
+	// streams rejected for other reasons don't use up the limit
+	s := setupServer()
+	createSid := createRTMPStreamIDHandler(s)
+	AuthWebhookURL = "http://127.0.0.1:1/auth"
+	u, _ := url.Parse("rtmp://localhost/stream/unauthorized")
+	assert.Empty(t, createSid(u))
+	AuthWebhookURL = ""
+	s.connectionLock.Lock()
+	s.rtmpConnections["dup"] = &rtmpConnection{}
+	s.connectionLock.Unlock()
+	u, _ = url.Parse("rtmp://localhost/stream/dup")
+	assert.Empty(t, createSid(u))
+
+	u, _ = url.Parse("rtmp://localhost/stream/rate3")
+	assert.NotEmpty(t, createSid(u))
+}
+
+func TestCheckIngestBitrate(t *testing.T) {
+	assert := assert.New(t)
+	defer func() { MaxIngestBitrate = 0 }()
+	cxn := &rtmpConnection{}
+	seg := &stream.HLSSegment{Data: make([]byte, 1000), Duration: 1} // 8kbps
+
+	assert.False(cxn.checkIngestBitrate(seg), "no limit")
+	MaxIngestBitrate = 4000
+	for i := 1; i < ingestBitrateSegments; i++ {
+		assert.False(cxn.checkIngestBitrate(seg), "odd segments above the limit are tolerated")
+	}
+	// a segment within the limit resets the count
+	assert.False(cxn.checkIngestBitrate(&stream.HLSSegment{Data: make([]byte, 100), Duration: 1}))
+	assert.Equal(0, cxn.overBitrate)
+	for i := 1; i < ingestBitrateSegments; i++ {
+		cxn.checkIngestBitrate(seg)
+	}
+	assert.True(cxn.checkIngestBitrate(seg))
+	// segments without a duration are skipped
+	assert.False((&rtmpConnection{}).checkIngestBitrate(&stream.HLSSegment{Data: seg.Data}))
+}
+
+func TestProcessSegment_IngestBitrate(t *testing.T) {
+	defer func() { MaxIngestBitrate = 0 }()
+	MaxIngestBitrate = 1
+	s := setupServer()
+	mid := core.SplitStreamIDString(t.Name()).ManifestID
+	strm := stream.NewBasicRTMPVideoStream(string(mid))
+	cxn, err := s.registerConnection(strm)
+	require.Nil(t, err)
+	defer func() {
+		s.connectionLock.Lock()
+		delete(s.rtmpConnections, mid)
+		s.connectionLock.Unlock()
+	}()
+
+	seg := &stream.HLSSegment{Data: []byte("segment"), Duration: 1}
+	for i := 0; i < ingestBitrateSegments; i++ {
+		seg.SeqNo = uint64(i)
+		processSegment(cxn, seg)
+	}
+	select {
+	case <-strm.EOF:
+	default:
+		t.Error("Expected the stream to be closed")
+	}
+}
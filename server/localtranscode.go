@@ -0,0 +1,180 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/livepeer/go-livepeer/common"
+	"github.com/livepeer/go-livepeer/core"
+	"github.com/livepeer/go-livepeer/monitor"
+	"github.com/livepeer/lpms/ffmpeg"
+	"github.com/livepeer/lpms/stream"
+)
+
+// LocalTranscoder transcodes segments on the broadcaster itself when no
+// orchestrator is available for the stream. Nil disables the fallback.
+var LocalTranscoder core.Transcoder
+
+// LocalTranscodeDir is where source segments are written for LocalTranscoder
+var LocalTranscodeDir = os.TempDir()
+
+// MaxLocalTranscodes caps the number of segments transcoded locally at once,
+// bounding the CPU the fallback may use. Segments arriving while every slot
+// is taken are not transcoded.
+var MaxLocalTranscodes = 1
+
+// LocalTranscodeProfiles is the number of renditions transcoded locally,
+// starting from the lowest resolution. Zero transcodes all of them.
+var LocalTranscodeProfiles = 1
+
+var localTranscodeSem chan struct{}
+var localTranscodeSemOnce sync.Once
+
+func acquireLocalTranscodeSlot() bool {
+	localTranscodeSemOnce.Do(func() {
+		localTranscodeSem = make(chan struct{}, MaxLocalTranscodes)
+	})
+	select {
+	case localTranscodeSem <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+func releaseLocalTranscodeSlot() {
+	<-localTranscodeSem
+}
+
+// localProfiles returns the renditions transcoded locally: the
+// LocalTranscodeProfiles lowest resolution ones among profiles
+func localProfiles(profiles []ffmpeg.VideoProfile) []ffmpeg.VideoProfile {
+	sorted := append([]ffmpeg.VideoProfile(nil), profiles...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return profilePixels(sorted[i]) < profilePixels(sorted[j])
+	})
+	if LocalTranscodeProfiles > 0 && len(sorted) > LocalTranscodeProfiles {
+		sorted = sorted[:LocalTranscodeProfiles]
+	}
+	return sorted
+}
+
+func profilePixels(p ffmpeg.VideoProfile) int {
+	var w, h int
+	if _, err := fmt.Sscanf(p.Resolution, "%dx%d", &w, &h); err != nil {
+		return 0
+	}
+	return w * h
+}
+
+// transcodeLocally transcodes seg with LocalTranscoder in the background and
+// inserts the renditions into the playlist, recording whether that succeeded.
+// Returns false if the fallback is disabled or out of slots, leaving the
+// segment untranscoded and its outcome to the caller.
+func transcodeLocally(ctx context.Context, cxn *rtmpConnection, seg *stream.HLSSegment, profiles []ffmpeg.VideoProfile, emerged time.Time) bool {
+	if LocalTranscoder == nil || len(profiles) == 0 {
+		return false
+	}
+	if !acquireLocalTranscodeSlot() {
+		glog.Warningf("No local transcode slot for segment manifestID=%s nonce=%d seqNo=%d", cxn.mid, cxn.nonce, seg.SeqNo)
+		return false
+	}
+	profiles = localProfiles(profiles)
+	atomic.AddInt32(&cxn.inFlight, 1)
+	go func() {
+		defer atomic.AddInt32(&cxn.inFlight, -1)
+		defer releaseLocalTranscodeSlot()
+		defer monitor.RecoverAndReport("transcodeLocally")
+		_, span := monitor.StartSegmentSpan(ctx, "TranscodeSegmentLocally", cxn.nonce, seg.SeqNo)
+		start := time.Now()
+		err := localTranscodeSegment(cxn, seg, profiles)
+		monitor.EndSpan(span, err)
+		if err != nil {
+			glog.Errorf("Error transcoding segment locally manifestID=%s nonce=%d seqNo=%d err=%v", cxn.mid, cxn.nonce, seg.SeqNo, err)
+			if monitor.Enabled {
+				monitor.LogSegmentTranscodeFailed(monitor.SegmentTranscodeErrorTranscode, cxn.nonce, seg.SeqNo, err)
+			}
+			return
+		}
+		if monitor.Enabled {
+			names := make([]string, len(profiles))
+			for i, p := range profiles {
+				names[i] = p.Name
+			}
+			monitor.LogSegmentTranscodedLocally(cxn.nonce, seg.SeqNo)
+			monitor.LogSegmentTranscoded(cxn.nonce, seg.SeqNo, time.Since(start), time.Since(emerged), common.ProfilesNames(profiles))
+			monitor.SegmentFullyTranscoded(cxn.nonce, seg.SeqNo, names, nil, "")
+		}
+	}()
+	return true
+}
+
+// runLocalTranscoder transcodes the data of seg into profiles with
+// LocalTranscoder
+func runLocalTranscoder(mid core.ManifestID, seg *stream.HLSSegment, profiles []ffmpeg.VideoProfile) ([][]byte, error) {
+	// LocalTranscoder reads the manifest ID and sequence number off the path
+	dir := path.Join(LocalTranscodeDir, string(mid))
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	fname := path.Join(dir, fmt.Sprintf("%d.ts", seg.SeqNo))
+	if err := ioutil.WriteFile(fname, seg.Data, 0644); err != nil {
+		return nil, err
+	}
+	defer os.Remove(fname)
+
+	renditions, err := LocalTranscoder.Transcode(fname, profiles)
+	if err != nil {
+		return nil, err
+	}
+	if len(renditions) != len(profiles) {
+		return nil, fmt.Errorf("got %d renditions for %d profiles", len(renditions), len(profiles))
+	}
+	return renditions, nil
+}
+
+func localTranscodeSegment(cxn *rtmpConnection, seg *stream.HLSSegment, profiles []ffmpeg.VideoProfile) error {
+	nonce := cxn.nonce
+	cpl := cxn.pl
+
+	glog.V(common.DEBUG).Infof("Transcoding segment locally manifestID=%s nonce=%d seqNo=%d profiles=%v", cxn.mid, nonce, seg.SeqNo, common.ProfilesNames(profiles))
+	renditions, err := runLocalTranscoder(cxn.mid, seg, profiles)
+	if err != nil {
+		return err
+	}
+
+	for i, data := range renditions {
+		profile := &profiles[i]
+		if cxn.isDropped(profile.Name) {
+			continue
+		}
+		name := segmentName(profile.Name, seg.SeqNo, data)
+		uri, err := cpl.GetOSSession().SaveData(name, data)
+		if err != nil {
+			return err
+		}
+		if err := cpl.InsertHLSSegment(profile, seg.SeqNo, uri, seg.Duration); err != nil {
+			if monitor.Enabled {
+				monitor.LogPlaylistInsertFailed(nonce, seg.SeqNo, profile.Name, err.Error())
+			}
+			return err
+		}
+		if monitor.Enabled {
+			monitor.LogPlaylistInsert(nonce, profile.Name)
+			monitor.LogTranscodedSegmentAppeared(nonce, seg.SeqNo, profile.Name)
+		}
+		if cxn.recording != nil {
+			cxn.recording.add(profile, seg.SeqNo, uri, seg.Duration)
+		}
+		cxn.insertDASHSegment(profile, seg.SeqNo, data, false)
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package server
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/livepeer/go-livepeer/core"
+	"github.com/livepeer/go-livepeer/monitor"
+	"github.com/livepeer/go-livepeer/monitor/monitortest"
+	"github.com/livepeer/lpms/ffmpeg"
+	"github.com/livepeer/lpms/stream"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type stubLocalTranscoder struct {
+	profiles []ffmpeg.VideoProfile
+	err      error
+}
+
+func (t *stubLocalTranscoder) Transcode(fname string, profiles []ffmpeg.VideoProfile) ([][]byte, error) {
+	t.profiles = profiles
+	if t.err != nil {
+		return nil, t.err
+	}
+	res := make([][]byte, len(profiles))
+	for i, p := range profiles {
+		res[i] = []byte(p.Name)
+	}
+	return res, nil
+}
+
+func TestLocalProfiles(t *testing.T) {
+	assert := assert.New(t)
+	defer func() { LocalTranscodeProfiles = 1 }()
+	profiles := []ffmpeg.VideoProfile{ffmpeg.P720p30fps16x9, ffmpeg.P144p30fps16x9, ffmpeg.P360p30fps16x9}
+
+	assert.Equal([]ffmpeg.VideoProfile{ffmpeg.P144p30fps16x9}, localProfiles(profiles))
+	LocalTranscodeProfiles = 2
+	assert.Equal([]ffmpeg.VideoProfile{ffmpeg.P144p30fps16x9, ffmpeg.P360p30fps16x9}, localProfiles(profiles))
+	LocalTranscodeProfiles = 0
+	assert.Len(localProfiles(profiles), 3)
+	// the stream's own profiles are left as they were
+	assert.Equal(ffmpeg.P720p30fps16x9, profiles[0])
+}
+
+func TestProcessSegment_LocalTranscode(t *testing.T) {
+	assert := assert.New(t)
+	tc := &stubLocalTranscoder{}
+	wd, err := ioutil.TempDir("", t.Name())
+	require.Nil(t, err)
+	defer os.RemoveAll(wd)
+	defer func(dir string) { LocalTranscoder, LocalTranscodeDir = nil, dir }(LocalTranscodeDir)
+	LocalTranscoder = tc
+	LocalTranscodeDir = wd
+	defer func(enabled bool) { monitor.Enabled = enabled }(monitor.Enabled)
+	monitor.Enabled = true
+	monitor.Init("", "broadcaster", "test", "test")
+	sink := monitortest.NewInMemorySink()
+	defer sink.Install()()
+
+	s := setupServer()
+	mid := core.SplitStreamIDString(t.Name()).ManifestID
+	cxn, err := s.registerConnection(stream.NewBasicRTMPVideoStream(string(mid)))
+	require.Nil(t, err)
+	defer func() {
+		s.connectionLock.Lock()
+		delete(s.rtmpConnections, mid)
+		s.connectionLock.Unlock()
+	}()
+	awaitSegments := func() {
+		for atomic.LoadInt32(&cxn.inFlight) > 0 {
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	// only the lowest resolution rendition is transcoded
+	processSegment(cxn, &stream.HLSSegment{SeqNo: 1, Data: []byte("segment"), Duration: 1})
+	awaitSegments()
+	assert.Equal([]ffmpeg.VideoProfile{ffmpeg.P240p30fps4x3}, tc.profiles)
+	if pl := cxn.pl.GetHLSMediaPlaylist(ffmpeg.P240p30fps4x3.Name); assert.NotNil(pl) {
+		assert.Equal(uint(1), pl.Count())
+	}
+	assert.Nil(cxn.pl.GetHLSMediaPlaylist(ffmpeg.P360p30fps16x9.Name))
+	// and counted as transcoded rather than failed for lack of orchestrators
+	assert.Equal(1, sink.CountByType(monitor.SegmentEventTranscoded))
+	assert.Equal(0, sink.CountByType(monitor.SegmentEventTranscodeFailed))
+
+	// segments aren't transcoded while every slot is taken
+	tc.profiles = nil
+	require.True(t, acquireLocalTranscodeSlot())
+	processSegment(cxn, &stream.HLSSegment{SeqNo: 2, Data: []byte("segment"), Duration: 1})
+	awaitSegments()
+	releaseLocalTranscodeSlot()
+	assert.Nil(tc.profiles)
+	assert.Equal(1, sink.CountByType(monitor.SegmentEventTranscodeFailed))
+
+	// failed transcodes leave the playlist alone
+	tc.err = errors.New("transcode error")
+	processSegment(cxn, &stream.HLSSegment{SeqNo: 3, Data: []byte("segment"), Duration: 1})
+	awaitSegments()
+	assert.Equal(uint(1), cxn.pl.GetHLSMediaPlaylist(ffmpeg.P240p30fps4x3.Name).Count())
+	// and are recorded as failed once
+	assert.Equal(2, sink.CountByType(monitor.SegmentEventTranscodeFailed))
+}
@@ -17,8 +17,10 @@ import (
 	"net/url"
 	"path"
 	"regexp"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/livepeer/go-livepeer/drivers"
@@ -44,18 +46,46 @@ var ErrStorage = errors.New("ErrStorage")
 var ErrDiscovery = errors.New("ErrDiscovery")
 var ErrNoOrchs = errors.New("ErrNoOrchs")
 var ErrUnknownStream = errors.New("ErrUnknownStream")
+var ErrDraining = errors.New("ErrDraining")
+var ErrAudioOnly = errors.New("ErrAudioOnly")
 
 const HLSWaitInterval = time.Second
 const HLSBufferCap = uint(43200) //12 hrs assuming 1s segment
 const HLSBufferWindow = uint(5)
 const StreamKeyBytes = 6
 
-const SegLen = 2 * time.Second
+// SegLen is the length of the segments streams are split into. Streams may
+// override it with the "segmentLength" RTMP URL query parameter or the auth
+// webhook response.
+var SegLen = defaultSegLen
+
+// Segment length the node's timeouts are tuned for; streams with longer
+// segments get proportionally longer timeouts
+const defaultSegLen = 2 * time.Second
+
+// MinSegLen and MaxSegLen bound the segment length a stream may ask for.
+// Shorter segments multiply the segments, and payments, per second of video.
+const MinSegLen = time.Second
+const MaxSegLen = 20 * time.Second
+
 const BroadcastRetry = 15 * time.Second
 
-var BroadcastPrice = big.NewInt(1)
+// BroadcastPrice is the most the broadcaster pays per segment, in wei: the
+// expected value of the ticket sent with each segment. Orchestrators asking
+// more aren't used. Zero means no limit.
+var BroadcastPrice = big.NewInt(0)
+
+// Capabilities orchestrators must advertise for the broadcaster to use them
+var RequiredCapabilities []string
+
 var BroadcastJobVideoProfiles = []ffmpeg.VideoProfile{ffmpeg.P240p30fps4x3, ffmpeg.P360p30fps16x9}
 
+// Profile streams without a video track are published under if their audio
+// has its codec. Their segments are passed through rather than transcoded:
+// there is no audio transcoder, so playlists advertise the codec and bitrate
+// probed from the stream rather than those of the profile.
+var AudioOnlyProfile = common.A128kAAC
+
 var AuthWebhookURL string
 
 type rtmpConnection struct {
@@ -64,14 +94,54 @@ type rtmpConnection struct {
 	stream  stream.RTMPVideoStream
 	pl      core.PlaylistManager
 	profile *ffmpeg.VideoProfile
+	// Length of the segments the stream is split into. Set before the
+	// stream is segmented and read-only afterwards.
+	segLen time.Duration
 
 	needOrch chan struct{}
 	eof      chan struct{}
 
+	// Codec fingerprint and highest sequence number of the source segments
+	// seen so far. Only accessed from processSegment, which runs sequentially
+	// per stream.
+	codec     string
+	lastSeqNo uint64
+	// set once the tracks of the first segment are probed
+	probed  bool
+	seqSeen bool
+	// consecutive source segments above MaxIngestBitrate
+	overBitrate int
+
+	// Number of segments being processed; accessed atomically
+	inFlight int32
+
+	// orchestrators that served the stream, reported on /status
+	history sessionHistory
+
 	// Thread sensitive fields. All accesses to the
 	// following fields should be protected by `lock`
 	sess *BroadcastSession
-	lock *sync.RWMutex
+	// sessions segments are also submitted to if RedundantSubmissions > 1,
+	// or compared against if CompareSubmissions
+	redundant []*BroadcastSession
+	// session spot checks are submitted to; nil unless SpotCheckRate > 0
+	spotCheck *BroadcastSession
+	// renditions the stream is transcoded into
+	profiles []ffmpeg.VideoProfile
+	// set when the profiles change, until a session refresh picks them up
+	profilesChanged bool
+	// set for streams whose first segment has no video; they're published
+	// under an audio profile and not transcoded
+	audioOnly bool
+	// renditions removed mid-stream; results still in flight for them are
+	// discarded rather than inserted into the playlist
+	dropped map[string]bool
+	lock    *sync.RWMutex
+
+	// DASH packaging of the renditions; nil unless EnableDASH
+	dash *dashManifest
+	// segments kept for the VOD playlist; nil unless EnableRecording
+	recording *streamRecording
 }
 
 type LivepeerServer struct {
@@ -82,17 +152,70 @@ type LivepeerServer struct {
 
 	ExposeCurrentManifest bool
 
+	// Address the RTMP server is bound to
+	rtmpAddr string
+
 	// Thread sensitive fields. All accesses to the
 	// following fields should be protected by `connectionLock`
 	rtmpConnections map[core.ManifestID]*rtmpConnection
 	lastHLSStreamID core.StreamID
 	lastManifestID  core.ManifestID
-	connectionLock  *sync.RWMutex
+	// set by Drain; no new streams are accepted once set
+	drainDeadline  time.Time
+	connectionLock *sync.RWMutex
+
+	// streams that ended but whose recordings are still being written
+	ending sync.WaitGroup
+
+	// Stream labels returned by the auth webhook, kept until the stream
+	// is registered; ManifestID:map[string]string
+	authLabels sync.Map
+	// Transcode profiles returned by the auth webhook, kept until the stream
+	// is registered; ManifestID:[]ffmpeg.VideoProfile
+	authProfiles sync.Map
+	// Segment lengths returned by the auth webhook, kept until the stream
+	// is registered; ManifestID:time.Duration
+	authSegLens sync.Map
+	// Recording settings returned by the auth webhook, kept until the
+	// stream is registered; ManifestID:recordingSettings
+	authRecordings sync.Map
+}
+
+// authWebhookRequest is sent to the auth webhook for every RTMP stream
+type authWebhookRequest struct {
+	URL string `json:"url"`
+	// Manifest ID and stream key given in the URL path, if any
+	ManifestID string `json:"manifestID,omitempty"`
+	StreamKey  string `json:"streamKey,omitempty"`
 }
 
 type authWebhookResponse struct {
-	ManifestID string `json:"manifestID"`
-	StreamKey  string `json:"streamKey"`
+	ManifestID string            `json:"manifestID"`
+	StreamKey  string            `json:"streamKey"`
+	Labels     map[string]string `json:"labels"`
+	// Names of the profiles to transcode the stream into, overriding
+	// BroadcastJobVideoProfiles
+	Profiles []string `json:"profiles"`
+	// Length of the segments to split the stream into, in seconds,
+	// overriding SegLen
+	SegmentLength float64 `json:"segmentLength"`
+	// Whether to record the stream and remux the recording into an MP4,
+	// overriding EnableRecording and RecordMP4
+	Record    *bool `json:"record"`
+	RecordMP4 *bool `json:"recordMP4"`
+}
+
+// recordingSettings returns whether the stream is recorded and remuxed into
+// an MP4, taking the node's settings unless the response overrides them
+func (resp *authWebhookResponse) recordingSettings() recordingSettings {
+	rs := recordingSettings{record: EnableRecording, mp4: RecordMP4}
+	if resp.Record != nil {
+		rs.record = *resp.Record
+	}
+	if resp.RecordMP4 != nil {
+		rs.mp4 = *resp.RecordMP4
+	}
+	return rs
 }
 
 func NewLivepeerServer(rtmpAddr string, httpAddr string, lpNode *core.LivepeerNode) *LivepeerServer {
@@ -108,22 +231,26 @@ func NewLivepeerServer(rtmpAddr string, httpAddr string, lpNode *core.LivepeerNo
 		opts.HttpMux = http.NewServeMux()
 	}
 	server := lpmscore.New(&opts)
-	return &LivepeerServer{RTMPSegmenter: server, LPMS: server, LivepeerNode: lpNode, HttpMux: opts.HttpMux, connectionLock: &sync.RWMutex{}, rtmpConnections: make(map[core.ManifestID]*rtmpConnection)}
+	return &LivepeerServer{RTMPSegmenter: server, LPMS: server, LivepeerNode: lpNode, HttpMux: opts.HttpMux, rtmpAddr: rtmpAddr, connectionLock: &sync.RWMutex{}, rtmpConnections: make(map[core.ManifestID]*rtmpConnection)}
 }
 
 //StartServer starts the LPMS server
 func (s *LivepeerServer) StartMediaServer(ctx context.Context, transcodingOptions string) error {
-	bProfiles := make([]ffmpeg.VideoProfile, 0)
-	for _, opt := range strings.Split(transcodingOptions, ",") {
-		p, ok := ffmpeg.VideoProfileLookup[strings.TrimSpace(opt)]
-		if ok {
-			bProfiles = append(bProfiles, p)
-		}
-	}
-	BroadcastJobVideoProfiles = bProfiles
+	BroadcastJobVideoProfiles = parseProfiles(strings.Split(transcodingOptions, ","))
 
 	glog.V(common.SHORT).Infof("Transcode Job Type: %v", BroadcastJobVideoProfiles)
 
+	if s.LivepeerNode.Database != nil && s.LivepeerNode.NodeType == core.BroadcasterNode {
+		go persistOrchestratorScores(ctx, s.LivepeerNode.Database)
+	}
+
+	if monitor.Enabled {
+		monitor.SetLowSuccessRateHandler(s.refreshSessionForNonce)
+		if s.LivepeerNode.Database != nil {
+			monitor.SetStreamEndedHandler(storeStreamSummary(s.LivepeerNode.Database))
+		}
+	}
+
 	//LPMS handlers for handling RTMP video
 	s.LPMS.HandleRTMPPublish(createRTMPStreamIDHandler(s), gotRTMPStreamHandler(s), endRTMPStreamHandler(s))
 	s.LPMS.HandleRTMPPlay(getRTMPStreamHandler(s))
@@ -131,6 +258,15 @@ func (s *LivepeerServer) StartMediaServer(ctx context.Context, transcodingOption
 	//LPMS hanlder for handling HLS video play
 	s.LPMS.HandleHLSPlay(getHLSMasterPlaylistHandler(s), getHLSMediaPlaylistHandler(s), getHLSSegmentHandler(s))
 
+	// DASH is served by the same HTTP server as HLS
+	if s.LivepeerNode.NodeType == core.BroadcasterNode {
+		mux := s.HttpMux
+		if mux == nil {
+			mux = http.DefaultServeMux
+		}
+		mux.HandleFunc("/dash/", getDASHHandler(s))
+	}
+
 	//Start the LPMS server
 	lpmsCtx, cancel := context.WithCancel(context.Background())
 	ec := make(chan error, 1)
@@ -153,6 +289,27 @@ func (s *LivepeerServer) StartMediaServer(ctx context.Context, transcodingOption
 	}
 }
 
+// storeStreamSummary returns a handler that persists stream summaries to db
+func storeStreamSummary(db *common.DB) func(ss *monitor.StreamSummary) {
+	return func(ss *monitor.StreamSummary) {
+		err := db.InsertStreamStats(&common.DBStreamStats{
+			ManifestID:         ss.ManifestID,
+			Nonce:              ss.Nonce,
+			StartedAt:          ss.Started,
+			EndedAt:            ss.Ended,
+			SegmentsEmerged:    ss.SegmentsEmerged,
+			SegmentsTranscoded: ss.SegmentsTranscoded,
+			SegmentsFailed:     ss.SegmentsFailed,
+			AvgLatency:         ss.AvgLatency,
+			Orchestrators:      ss.Orchestrators,
+			FeesSent:           ss.FeesSent,
+		})
+		if err != nil {
+			glog.Errorf("Error storing stream stats manifestID=%s nonce=%d err=%v", ss.ManifestID, ss.Nonce, err)
+		}
+	}
+}
+
 //RTMP Publish Handlers
 func createRTMPStreamIDHandler(s *LivepeerServer) func(url *url.URL) (strmID string) {
 	return func(url *url.URL) (strmID string) {
@@ -165,8 +322,9 @@ func createRTMPStreamIDHandler(s *LivepeerServer) func(url *url.URL) (strmID str
 		var mid core.ManifestID
 		var err error
 		var key string
-		if resp, err = authenticateStream(url.String()); err != nil {
+		if resp, err = authenticateStream(url); err != nil {
 			glog.Error("Authentication denied for ", err)
+			rejectStream(0, rejectUnauthorized)
 			return ""
 		}
 		if resp != nil {
@@ -184,14 +342,37 @@ func createRTMPStreamIDHandler(s *LivepeerServer) func(url *url.URL) (strmID str
 		// Ensure there's no concurrent StreamID with the same name
 		s.connectionLock.RLock()
 		defer s.connectionLock.RUnlock()
+		if !s.drainDeadline.IsZero() {
+			rejectStream(0, rejectDraining)
+			return ""
+		}
 		if core.MaxSessions > 0 && len(s.rtmpConnections) >= core.MaxSessions {
 			glog.Error("Too many connections")
+			rejectStream(0, rejectTooManyStreams)
 			return ""
 		}
 		if _, exists := s.rtmpConnections[mid]; exists {
 			glog.Error("Manifest already exists ", mid)
 			return ""
 		}
+		// only streams that would otherwise start count against the limit
+		if !streamStarts.allow(time.Now(), MaxStreamsPerMinute) {
+			rejectStream(0, rejectStreamRate)
+			return ""
+		}
+		if resp != nil && len(resp.Labels) > 0 {
+			s.authLabels.Store(mid, resp.Labels)
+		}
+		if resp != nil && len(resp.Profiles) > 0 {
+			s.authProfiles.Store(mid, parseProfiles(resp.Profiles))
+		}
+		if resp != nil && resp.SegmentLength > 0 {
+			segLen, _ := parseSegLen(resp.SegmentLength) // validated by authenticateStream
+			s.authSegLens.Store(mid, segLen)
+		}
+		if resp != nil && (resp.Record != nil || resp.RecordMP4 != nil) {
+			s.authRecordings.Store(mid, resp.recordingSettings())
+		}
 
 		// Generate RTMP part of StreamID
 		if key == "" {
@@ -201,13 +382,18 @@ func createRTMPStreamIDHandler(s *LivepeerServer) func(url *url.URL) (strmID str
 	}
 }
 
-func authenticateStream(url string) (*authWebhookResponse, error) {
+func authenticateStream(u *url.URL) (*authWebhookResponse, error) {
 	if AuthWebhookURL == "" {
 		return nil, nil
 	}
 
-	values := map[string]string{"url": url}
-	jsonValue, err := json.Marshal(values)
+	sid := parseStreamID(u.Path)
+	req := authWebhookRequest{
+		URL:        u.String(),
+		ManifestID: string(sid.ManifestID),
+		StreamKey:  sid.Rendition,
+	}
+	jsonValue, err := json.Marshal(req)
 	if err != nil {
 		return nil, err
 	}
@@ -232,9 +418,148 @@ func authenticateStream(url string) (*authWebhookResponse, error) {
 	if authResp.ManifestID == "" {
 		return nil, errors.New("Empty manifest id not allowed")
 	}
+	for _, p := range authResp.Profiles {
+		if _, ok := ffmpeg.VideoProfileLookup[p]; !ok {
+			return nil, fmt.Errorf("Unknown transcode profile %v", p)
+		}
+	}
+	if _, err := parseSegLen(authResp.SegmentLength); err != nil {
+		return nil, err
+	}
 	return &authResp, nil
 }
 
+// parseProfiles looks up the named video profiles, skipping unknown names
+func parseProfiles(names []string) []ffmpeg.VideoProfile {
+	profiles := make([]ffmpeg.VideoProfile, 0)
+	for _, name := range names {
+		if p, ok := ffmpeg.VideoProfileLookup[strings.TrimSpace(name)]; ok {
+			profiles = append(profiles, p)
+		}
+	}
+	return profiles
+}
+
+// streamProfiles returns the profiles named by the comma separated "profiles"
+// query parameter of the RTMP URL or, failing that, by the suffix of its
+// stream key. Profiles returned by the auth webhook take precedence over
+// these.
+func streamProfiles(u *url.URL) []ffmpeg.VideoProfile {
+	if u == nil {
+		return nil
+	}
+	names := u.Query().Get("profiles")
+	if names == "" {
+		_, profiles := splitProfileSuffix(strings.TrimSuffix(u.Path, path.Ext(u.Path)))
+		return profiles
+	}
+	return parseProfiles(strings.Split(names, ","))
+}
+
+// Short names of the presets stream keys may end with
+var profilePresets = map[string]ffmpeg.VideoProfile{
+	"720p60": ffmpeg.P720p60fps16x9,
+	"720p30": ffmpeg.P720p30fps16x9,
+	"576p30": ffmpeg.P576p30fps16x9,
+	"360p30": ffmpeg.P360p30fps16x9,
+	"240p30": ffmpeg.P240p30fps16x9,
+	"144p30": ffmpeg.P144p30fps16x9,
+}
+
+// splitProfileSuffix splits the comma separated profiles appended to the
+// stream key after a +, as in stream/key+720p30,360p30, from the path.
+// Profiles are named by preset or by their full name. Paths whose suffix
+// names anything else are returned whole.
+func splitProfileSuffix(p string) (string, []ffmpeg.VideoProfile) {
+	i := strings.LastIndex(p, "+")
+	if i < 0 || strings.Contains(p[i:], "/") {
+		return p, nil
+	}
+	var profiles []ffmpeg.VideoProfile
+	for _, name := range strings.Split(p[i+1:], ",") {
+		profile, ok := profilePresets[name]
+		if !ok {
+			profile, ok = ffmpeg.VideoProfileLookup[name]
+		}
+		if !ok {
+			return p, nil
+		}
+		profiles = append(profiles, profile)
+	}
+	return p[:i], profiles
+}
+
+// parseSegLen converts a segment length in seconds into a duration. Zero
+// means the stream uses SegLen.
+func parseSegLen(secs float64) (time.Duration, error) {
+	segLen := time.Duration(secs * float64(time.Second))
+	if secs < 0 || (secs > 0 && segLen < MinSegLen) || segLen > MaxSegLen {
+		return 0, fmt.Errorf("Invalid segment length %v; must be between %v and %v", secs, MinSegLen.Seconds(), MaxSegLen.Seconds())
+	}
+	return segLen, nil
+}
+
+// streamSegLen returns the segment length, in seconds, given by the
+// "segmentLength" query parameter of the RTMP URL, or zero if there is none
+// or it is invalid. Lengths returned by the auth webhook take precedence
+// over this.
+func streamSegLen(u *url.URL) time.Duration {
+	if u == nil {
+		return 0
+	}
+	v := u.Query().Get("segmentLength")
+	if v == "" {
+		return 0
+	}
+	secs, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		glog.Errorf("Ignoring invalid segment length %v: %v", v, err)
+		return 0
+	}
+	segLen, err := parseSegLen(secs)
+	if err != nil {
+		glog.Errorf("Ignoring segment length: %v", err)
+	}
+	return segLen
+}
+
+// scaleTimeout scales a timeout tuned for the default segment length to
+// segments of length segLen. Timeouts are never scaled down.
+func scaleTimeout(timeout, segLen time.Duration) time.Duration {
+	if segLen <= defaultSegLen {
+		return timeout
+	}
+	return time.Duration(float64(timeout) * float64(segLen) / float64(defaultSegLen))
+}
+
+// Multiple of the segment duration that submitting a segment to an
+// orchestrator, and downloading each of its renditions, may take. Defaults
+// to HTTPTimeout for segments of the default length.
+var SegmentTimeoutMultiplier = float64(HTTPTimeout) / float64(defaultSegLen)
+
+// segmentTimeout is how long calls for a segment of length segLen may take
+func segmentTimeout(segLen time.Duration) time.Duration {
+	if SegmentTimeoutMultiplier <= 0 || segLen <= 0 {
+		return HTTPTimeout
+	}
+	return time.Duration(SegmentTimeoutMultiplier * float64(segLen))
+}
+
+// streamLabels returns the query parameters of the RTMP URL as stream labels.
+// Labels returned by the auth webhook take precedence over these.
+func streamLabels(u *url.URL) map[string]string {
+	labels := make(map[string]string)
+	if u == nil {
+		return labels
+	}
+	for k, v := range u.Query() {
+		if len(v) > 0 {
+			labels[k] = v[0]
+		}
+	}
+	return labels
+}
+
 func rtmpManifestID(rtmpStrm stream.RTMPVideoStream) core.ManifestID {
 	return parseManifestID(rtmpStrm.GetStreamID())
 }
@@ -251,6 +576,39 @@ func gotRTMPStreamHandler(s *LivepeerServer) func(url *url.URL, rtmpStrm stream.
 		nonce := cxn.nonce
 		startSeq := 0
 
+		profiles := streamProfiles(url)
+		if p, ok := s.authProfiles.Load(mid); ok {
+			s.authProfiles.Delete(mid)
+			profiles = p.([]ffmpeg.VideoProfile)
+		}
+		if len(profiles) > 0 {
+			cxn.lock.Lock()
+			cxn.profiles = profiles
+			cxn.lock.Unlock()
+			glog.V(common.DEBUG).Infof("Transcoding manifestID=%s into profiles=%s", mid, common.ProfilesNames(profiles))
+		}
+
+		segLen := streamSegLen(url)
+		if l, ok := s.authSegLens.Load(mid); ok {
+			s.authSegLens.Delete(mid)
+			segLen = l.(time.Duration)
+		}
+		if segLen > 0 {
+			cxn.segLen = segLen
+			glog.V(common.DEBUG).Infof("Segmenting manifestID=%s into segLen=%v", mid, segLen)
+		}
+
+		if r, ok := s.authRecordings.Load(mid); ok {
+			s.authRecordings.Delete(mid)
+			rs := r.(recordingSettings)
+			cxn.recording = nil
+			if rs.record && !cxn.pl.GetOSSession().IsExternal() {
+				glog.Errorf("Not recording manifestID=%s without object storage; set -s3bucket or -gsbucket", mid)
+			} else if rs.record {
+				cxn.recording = newStreamRecording(rs.mp4)
+			}
+		}
+
 		streamStarted := false
 		//Segment the stream, insert the segments into the broadcaster
 		go func(rtmpStrm stream.RTMPVideoStream) {
@@ -272,7 +630,7 @@ func gotRTMPStreamHandler(s *LivepeerServer) func(url *url.URL, rtmpStrm stream.
 
 			segOptions := segmenter.SegmenterOptions{
 				StartSeq:  startSeq,
-				SegLength: SegLen,
+				SegLength: cxn.segLen,
 			}
 			err := s.RTMPSegmenter.SegmentRTMPToHLS(context.Background(), rtmpStrm, hlsStrm, segOptions)
 			if err != nil {
@@ -283,8 +641,17 @@ func gotRTMPStreamHandler(s *LivepeerServer) func(url *url.URL, rtmpStrm stream.
 
 		}(rtmpStrm)
 
+		labels := streamLabels(url)
+		if l, ok := s.authLabels.Load(mid); ok {
+			s.authLabels.Delete(mid)
+			for k, v := range l.(map[string]string) {
+				labels[k] = v
+			}
+		}
 		if monitor.Enabled {
+			monitor.LogStreamLabels(nonce, labels)
 			monitor.LogStreamCreatedEvent(string(mid), nonce)
+			monitor.SetLostSegmentTimeout(nonce, scaleTimeout(monitor.LostSegmentTimeout, cxn.segLen))
 		}
 
 		glog.Infof("\n\nVideo Created With ManifestID: %v\n\n", mid)
@@ -301,25 +668,103 @@ func endRTMPStreamHandler(s *LivepeerServer) func(url *url.URL, rtmpStrm stream.
 		mid := rtmpManifestID(rtmpStrm)
 		//Remove RTMP stream
 		s.connectionLock.Lock()
-		defer s.connectionLock.Unlock()
 		cxn, ok := s.rtmpConnections[mid]
 		if !ok || cxn.pl == nil {
+			s.connectionLock.Unlock()
 			glog.Error("Attempted to end unknown stream with manifest ID ", mid)
 			return ErrUnknownStream
 		}
-		cxn.pl.Cleanup()
-		glog.Infof("Ended stream with id=%s", mid)
 		cxn.eof <- struct{}{}
 		delete(s.rtmpConnections, mid)
 		if monitor.Enabled {
 			monitor.LogStreamEndedEvent(cxn.nonce)
 			monitor.CurrentSessions(len(s.rtmpConnections))
 		}
+		drainDeadline := s.drainDeadline
+		s.ending.Add(1)
+		s.connectionLock.Unlock()
+
+		// While draining, let the segments still in flight make it into the
+		// playlists and recording. Otherwise the stream is cleaned up right
+		// away so its manifest ID can be reused.
+		if !drainDeadline.IsZero() && !cxn.awaitSegments(drainDeadline) {
+			glog.Errorf("Ending stream manifestID=%s with segments in flight", mid)
+		}
+		cxn.pl.Cleanup()
+		glog.Infof("Ended stream with id=%s", mid)
+		go func() {
+			defer s.ending.Done()
+			if cxn.recording != nil {
+				finalizeRecording(mid, cxn.nonce, cxn.profile.Name, cxn.recording, cxn.pl.GetOSSession())
+			}
+		}()
 
 		return nil
 	}
 }
 
+// How often draining checks whether streams have finished
+const drainPollInterval = 100 * time.Millisecond
+
+// awaitSegments waits for the segments of the stream in flight to be
+// processed, returning false if they weren't by deadline
+func (cxn *rtmpConnection) awaitSegments(deadline time.Time) bool {
+	for atomic.LoadInt32(&cxn.inFlight) > 0 {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(drainPollInterval)
+	}
+	return true
+}
+
+// Drain stops accepting new streams and ends the active ones, letting the
+// segments they have in flight complete and their recordings be written
+// before returning. Returns false if that didn't finish within timeout.
+func (s *LivepeerServer) Drain(timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	s.connectionLock.Lock()
+	s.drainDeadline = deadline
+	cxns := make([]*rtmpConnection, 0, len(s.rtmpConnections))
+	for _, cxn := range s.rtmpConnections {
+		cxns = append(cxns, cxn)
+	}
+	s.connectionLock.Unlock()
+
+	glog.Infof("Draining streams=%d timeout=%v", len(cxns), timeout)
+	// LPMS ends the streams once their RTMP connections are closed
+	for _, cxn := range cxns {
+		cxn.stream.Close()
+	}
+	for {
+		s.connectionLock.RLock()
+		remaining := len(s.rtmpConnections)
+		s.connectionLock.RUnlock()
+		if remaining == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			glog.Errorf("Timed out draining streams=%d", remaining)
+			return false
+		}
+		time.Sleep(drainPollInterval)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		s.ending.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		glog.Info("Drained all streams")
+		return true
+	case <-time.After(time.Until(deadline)):
+		glog.Error("Timed out writing recordings of drained streams")
+		return false
+	}
+}
+
 func (s *LivepeerServer) registerConnection(rtmpStrm stream.RTMPVideoStream) (*rtmpConnection, error) {
 	nonce := rand.Uint64()
 
@@ -358,22 +803,33 @@ func (s *LivepeerServer) registerConnection(rtmpStrm stream.RTMPVideoStream) (*r
 	hlsStrmID := core.MakeStreamID(mid, &vProfile)
 	s.connectionLock.Lock()
 	defer s.connectionLock.Unlock()
+	if !s.drainDeadline.IsZero() {
+		return nil, ErrDraining
+	}
 	_, exists := s.rtmpConnections[mid]
 	if exists {
 		// We can only have one concurrent stream per ManifestID
 		return nil, ErrAlreadyExists
 	}
 	cxn := &rtmpConnection{
-		mid:     mid,
-		nonce:   nonce,
-		stream:  rtmpStrm,
-		pl:      core.NewBasicPlaylistManager(mid, storage),
-		profile: &vProfile,
-		lock:    &sync.RWMutex{},
+		mid:      mid,
+		nonce:    nonce,
+		stream:   rtmpStrm,
+		pl:       core.NewBasicPlaylistManager(mid, storage),
+		profile:  &vProfile,
+		segLen:   SegLen,
+		profiles: BroadcastJobVideoProfiles,
+		lock:     &sync.RWMutex{},
 
 		needOrch: make(chan struct{}),
 		eof:      make(chan struct{}),
 	}
+	if EnableDASH {
+		cxn.dash = newDASHManifest(mid)
+	}
+	if EnableRecording {
+		cxn.recording = newStreamRecording(RecordMP4)
+	}
 	s.rtmpConnections[mid] = cxn
 	s.lastManifestID = mid
 	s.lastHLSStreamID = hlsStrmID
@@ -394,7 +850,19 @@ func (s *LivepeerServer) startSession(cxn *rtmpConnection) *BroadcastSession {
 	// as the RTMP stream is alive
 	broadcastFunc := func() error {
 		var err error
-		sess, err = selectOrchestrator(s.LivepeerNode, cpl)
+		start := time.Now()
+		cxn.lock.Lock()
+		profiles := cxn.profiles
+		cxn.profilesChanged = false
+		cxn.lock.Unlock()
+		sess, err = selectOrchestrator(s.LivepeerNode, cpl, profiles)
+		took := time.Since(start)
+		if monitor.Enabled && err != ErrDiscovery {
+			monitor.LogSessionRefresh(took, err)
+		}
+		if took > cxn.segLen {
+			glog.Warningf("Session refresh for manifestID=%s took %v, longer than segment length %v", mid, took, cxn.segLen)
+		}
 		if err == ErrDiscovery {
 			return nil // discovery disabled, don't retry
 		} else if err != nil {
@@ -418,13 +886,32 @@ func (s *LivepeerServer) startSession(cxn *rtmpConnection) *BroadcastSession {
 func (s *LivepeerServer) startSessionListener(cxn *rtmpConnection) {
 	mut := cxn.lock
 	sem := make(chan struct{}, 1)
+	limiter := &refreshLimiter{}
 	runStartSession := func() {
 		// Quickly lock-unlock to avoid blocking longer than necessary
 		mut.Lock()
+		prev := cxn.sess
 		cxn.sess = nil
+		cxn.redundant = nil
+		cxn.spotCheck = nil
 		mut.Unlock()
 
 		sess := s.startSession(cxn) // this could take awhile
+		var redundant []*BroadcastSession
+		count := RedundantSubmissions - 1
+		if CompareSubmissions && count < 2 {
+			// one to compare against and one to break ties
+			count = 2
+		}
+		if sess != nil && count > 0 {
+			redundant = selectRedundantOrchestrators(s.LivepeerNode, cxn.pl, sess, count)
+		}
+		var checker *BroadcastSession
+		if sess != nil && SpotCheckRate > 0 {
+			if checkers := selectRedundantOrchestrators(s.LivepeerNode, cxn.pl, sess, 1); len(checkers) > 0 {
+				checker = checkers[0]
+			}
+		}
 
 		// Retain the connectionLock for the rest of the function to ensure
 		// we don't terminate the stream *then* assign the session to the cxn
@@ -436,6 +923,17 @@ func (s *LivepeerServer) startSessionListener(cxn *rtmpConnection) {
 		mut.Lock()
 		defer mut.Unlock()
 		cxn.sess = sess
+		cxn.redundant = redundant
+		cxn.spotCheck = checker
+		if sess != nil {
+			cxn.history.selected(sess.OrchestratorInfo.GetTranscoder())
+		}
+		if monitor.Enabled && prev != nil && sess != nil {
+			prevOrch := prev.OrchestratorInfo.GetTranscoder()
+			if cur := sess.OrchestratorInfo.GetTranscoder(); cur != prevOrch {
+				monitor.LogOrchestratorSwapped(cxn.nonce, prevOrch, cur)
+			}
+		}
 	}
 	glog.V(common.DEBUG).Info("Starting broadcast listener for ", cxn.mid)
 	finished := false
@@ -449,8 +947,24 @@ func (s *LivepeerServer) startSessionListener(cxn *rtmpConnection) {
 			go func() {
 				select {
 				case sem <- struct{}{}:
+					defer func() { <-sem }()
+					// requests arriving while this one waits are dropped
+					if wait := limiter.wait(time.Now()); wait > 0 {
+						glog.V(common.DEBUG).Infof("Delaying session refresh for manifestID=%s by %v", cxn.mid, wait)
+						time.Sleep(wait)
+						s.connectionLock.RLock()
+						_, active := s.rtmpConnections[cxn.mid]
+						s.connectionLock.RUnlock()
+						if !active {
+							return
+						}
+					}
 					runStartSession()
-					<-sem
+					// profiles changed during the refresh were dropped
+					// along with their request, so refresh again
+					for cxn.hasProfilesChanged() {
+						runStartSession()
+					}
 				default:
 					break
 				}
@@ -464,6 +978,111 @@ func (s *LivepeerServer) startSessionListener(cxn *rtmpConnection) {
 	glog.V(common.DEBUG).Info("Stopping broadcast listener for ", cxn.mid)
 }
 
+// refreshSessionForNonce asks the session listener of the stream with the
+// given nonce to select a new orchestrator
+func (s *LivepeerServer) refreshSessionForNonce(nonce uint64, rate float64) {
+	s.connectionLock.RLock()
+	defer s.connectionLock.RUnlock()
+	for _, cxn := range s.rtmpConnections {
+		if cxn.nonce != nonce {
+			continue
+		}
+		select {
+		case cxn.needOrch <- struct{}{}:
+			glog.Infof("Refreshing session for manifestID=%s due to success rate=%v", cxn.mid, rate)
+		default:
+			// listener busy; a refresh is likely already under way
+		}
+		return
+	}
+}
+
+// setStreamProfiles changes the renditions the stream with the given
+// manifest ID is transcoded into. The playlists of removed renditions are
+// dropped and new orchestrator sessions are negotiated for the new profiles.
+// Added renditions appear in the master playlist with their first segment.
+func (s *LivepeerServer) setStreamProfiles(mid core.ManifestID, profiles []ffmpeg.VideoProfile) error {
+	s.connectionLock.RLock()
+	defer s.connectionLock.RUnlock()
+	cxn, ok := s.rtmpConnections[mid]
+	if !ok {
+		return ErrUnknownStream
+	}
+
+	cxn.lock.Lock()
+	if cxn.audioOnly {
+		cxn.lock.Unlock()
+		return ErrAudioOnly
+	}
+	prev := cxn.profiles
+	cxn.profiles = profiles
+	cxn.profilesChanged = true
+	if cxn.dropped == nil {
+		cxn.dropped = make(map[string]bool)
+	}
+	for _, p := range profiles {
+		delete(cxn.dropped, p.Name)
+	}
+	var removed []string
+	for _, p := range prev {
+		if !hasProfile(profiles, p.Name) {
+			cxn.dropped[p.Name] = true
+			removed = append(removed, p.Name)
+		}
+	}
+	cxn.lock.Unlock()
+
+	for _, name := range removed {
+		cxn.pl.RemoveHLSRendition(name)
+		if cxn.dash != nil {
+			cxn.dash.remove(name)
+		}
+	}
+	glog.Infof("Changed profiles of manifestID=%s from=%s to=%s", mid, common.ProfilesNames(prev), common.ProfilesNames(profiles))
+	select {
+	case cxn.needOrch <- struct{}{}:
+	default:
+		// listener busy; a refresh under way picks up the change after
+	}
+	return nil
+}
+
+// requestSession asks the session listener for a new orchestrator without
+// blocking: the listener drops requests arriving during a refresh anyway, and
+// no longer listens once the stream ended, which would otherwise leave the
+// segments asking for one stuck and hold up draining
+func (cxn *rtmpConnection) requestSession() {
+	select {
+	case cxn.needOrch <- struct{}{}:
+	default:
+		// listener busy; a refresh is likely already under way
+	}
+}
+
+// hasProfilesChanged returns whether the profiles changed since the last
+// session refresh started
+func (cxn *rtmpConnection) hasProfilesChanged() bool {
+	cxn.lock.RLock()
+	defer cxn.lock.RUnlock()
+	return cxn.profilesChanged
+}
+
+// isDropped returns whether the named rendition was removed from the stream
+func (cxn *rtmpConnection) isDropped(profile string) bool {
+	cxn.lock.RLock()
+	defer cxn.lock.RUnlock()
+	return cxn.dropped[profile]
+}
+
+func hasProfile(profiles []ffmpeg.VideoProfile, name string) bool {
+	for _, p := range profiles {
+		if p.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
 //End RTMP Publish Handlers
 
 //HLS Play Handlers
@@ -541,6 +1160,14 @@ func getHLSSegmentHandler(s *LivepeerServer) func(url *url.URL) ([]byte, error)
 		}
 		data := os.GetData(segName)
 		if len(data) > 0 {
+			if monitor.Enabled {
+				s.connectionLock.RLock()
+				cxn, ok := s.rtmpConnections[core.ManifestID(parts[0])]
+				s.connectionLock.RUnlock()
+				if ok {
+					monitor.LogBytesTransferred(monitor.BytesHLS, cxn.nonce, int64(len(data)))
+				}
+			}
 			return data, nil
 		}
 		return nil, vidplayer.ErrNotFound
@@ -578,8 +1205,9 @@ func cleanStreamPrefix(reqPath string) string {
 }
 
 func parseStreamID(reqPath string) core.StreamID {
-	// remove extension and create streamid
+	// remove extension and profile suffix and create streamid
 	p := strings.TrimSuffix(reqPath, path.Ext(reqPath))
+	p, _ = splitProfileSuffix(p)
 	return core.SplitStreamIDString(cleanStreamPrefix(p))
 }
 
@@ -615,6 +1243,20 @@ func (s *LivepeerServer) GetNodeStatus() *net.NodeStatus {
 	return &net.NodeStatus{Manifests: m}
 }
 
+// successRates returns the current success rate of each active stream, keyed by manifest ID
+func (s *LivepeerServer) successRates() map[string]float64 {
+	rates := monitor.GetSuccessRateSnapshot()
+	s.connectionLock.RLock()
+	defer s.connectionLock.RUnlock()
+	res := make(map[string]float64, len(rates))
+	for mid, cxn := range s.rtmpConnections {
+		if r, ok := rates[cxn.nonce]; ok {
+			res[string(mid)] = r
+		}
+	}
+	return res
+}
+
 // Debug helpers
 func (s *LivepeerServer) LatestPlaylist() core.PlaylistManager {
 	s.connectionLock.RLock()
@@ -626,6 +1268,9 @@ func (s *LivepeerServer) LatestPlaylist() core.PlaylistManager {
 	return cxn.pl
 }
 
+// shouldStopStream reports whether an error from submitting a segment should
+// terminate the whole stream. Stopping a stream is a superset of stopping a
+// session: any error that stops the stream must also satisfy shouldStopSession.
 func shouldStopStream(err error) bool {
 	return false
 }
@@ -13,7 +13,9 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"reflect"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -57,7 +59,7 @@ type stubDiscovery struct {
 	getOrchError error
 }
 
-func (d *stubDiscovery) GetOrchestrators(num int) ([]*net.OrchestratorInfo, error) {
+func (d *stubDiscovery) GetOrchestrators(num int, constraints *net.OrchestratorConstraints) ([]*net.OrchestratorInfo, error) {
 	if d.waitGetOrch != nil {
 		<-d.waitGetOrch
 	}
@@ -108,14 +110,14 @@ func TestSelectOrchestrator(t *testing.T) {
 	mid := core.RandomManifestID()
 	storage := drivers.NodeStorage.NewSession(string(mid))
 	pl := core.NewBasicPlaylistManager(mid, storage)
-	if _, err := selectOrchestrator(s.LivepeerNode, pl); err != ErrDiscovery {
+	if _, err := selectOrchestrator(s.LivepeerNode, pl, BroadcastJobVideoProfiles); err != ErrDiscovery {
 		t.Error("Expected error with discovery")
 	}
 
 	sd := &stubDiscovery{}
 	// Discovery returned no orchestrators
 	s.LivepeerNode.OrchestratorPool = sd
-	if sess, err := selectOrchestrator(s.LivepeerNode, pl); sess != nil || err != ErrNoOrchs {
+	if sess, err := selectOrchestrator(s.LivepeerNode, pl, BroadcastJobVideoProfiles); sess != nil || err != ErrNoOrchs {
 		t.Error("Expected nil session")
 	}
 
@@ -124,7 +126,7 @@ func TestSelectOrchestrator(t *testing.T) {
 		&net.OrchestratorInfo{},
 		&net.OrchestratorInfo{},
 	}
-	sess, _ := selectOrchestrator(s.LivepeerNode, pl)
+	sess, _ := selectOrchestrator(s.LivepeerNode, pl, BroadcastJobVideoProfiles)
 	if sess == nil {
 		t.Error("Expected nil session")
 	}
@@ -173,7 +175,7 @@ func TestSelectOrchestrator(t *testing.T) {
 	expSessionID := "foo"
 	sender.On("StartSession", params).Return(expSessionID)
 
-	sess, err := selectOrchestrator(s.LivepeerNode, pl)
+	sess, err := selectOrchestrator(s.LivepeerNode, pl, BroadcastJobVideoProfiles)
 	require.Nil(t, err)
 
 	assert := assert.New(t)
@@ -208,10 +210,6 @@ func TestCreateRTMPStreamHandlerCap(t *testing.T) {
 	core.MaxSessions = oldMaxSessions
 }
 
-type authWebhookReq struct {
-	url string `json:"url"`
-}
-
 func TestCreateRTMPStreamHandlerWebhook(t *testing.T) {
 	s := setupServer()
 	s.RTMPSegmenter = &StubSegmenter{skip: true}
@@ -224,9 +222,9 @@ func TestCreateRTMPStreamHandlerWebhook(t *testing.T) {
 		t.Error("Webhook auth failed")
 	}
 
+	var req authWebhookRequest
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		out, _ := ioutil.ReadAll(r.Body)
-		var req authWebhookReq
 		err := json.Unmarshal(out, &req)
 		if err != nil {
 			fmt.Printf("Error parsing URL: %v\n", err)
@@ -242,6 +240,9 @@ func TestCreateRTMPStreamHandlerWebhook(t *testing.T) {
 	if sid == "" {
 		t.Error("On empty response with 200 code should pass")
 	}
+	if req.URL != "http://hot/something/id1" || req.ManifestID != "something" || req.StreamKey != "id1" {
+		t.Error("Unexpected webhook request ", req)
+	}
 	ts2 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Write([]byte(`{"manifestID":""}`))
 	}))
@@ -280,9 +281,307 @@ func TestCreateRTMPStreamHandlerWebhook(t *testing.T) {
 	if mid != "xyz" || sid != "xyz/zyx" {
 		t.Error("Should set manifest / streamkey  to one provided by webhook")
 	}
+	ts6 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"manifestID":"lbl", "labels":{"tenant":"acme"}}`))
+	}))
+	defer ts6.Close()
+	AuthWebhookURL = ts6.URL
+	createSid(u)
+	if l, ok := s.authLabels.Load(core.ManifestID("lbl")); !ok || l.(map[string]string)["tenant"] != "acme" {
+		t.Error("Should keep the labels provided by webhook ", l)
+	}
+	ts7 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"manifestID":"prf", "profiles":["P144p30fps16x9"]}`))
+	}))
+	defer ts7.Close()
+	AuthWebhookURL = ts7.URL
+	createSid(u)
+	if p, ok := s.authProfiles.Load(core.ManifestID("prf")); !ok || !reflect.DeepEqual(p.([]ffmpeg.VideoProfile), []ffmpeg.VideoProfile{ffmpeg.P144p30fps16x9}) {
+		t.Error("Should keep the profiles provided by webhook ", p)
+	}
+	ts8 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"manifestID":"prf2", "profiles":["P144p30fps16x9", "P9000p"]}`))
+	}))
+	defer ts8.Close()
+	AuthWebhookURL = ts8.URL
+	if sid := createSid(u); sid != "" {
+		t.Error("Should not pass if webhook returns unknown profiles")
+	}
+	ts9 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"manifestID":"seglen", "segmentLength":6}`))
+	}))
+	defer ts9.Close()
+	AuthWebhookURL = ts9.URL
+	createSid(u)
+	if l, ok := s.authSegLens.Load(core.ManifestID("seglen")); !ok || l.(time.Duration) != 6*time.Second {
+		t.Error("Should keep the segment length provided by webhook ", l)
+	}
+	ts10 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"manifestID":"seglen2", "segmentLength":60}`))
+	}))
+	defer ts10.Close()
+	AuthWebhookURL = ts10.URL
+	if sid := createSid(u); sid != "" {
+		t.Error("Should not pass if webhook returns an invalid segment length")
+	}
+	ts11 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"manifestID":"rec", "recordMP4":true}`))
+	}))
+	defer ts11.Close()
+	AuthWebhookURL = ts11.URL
+	createSid(u)
+	if rs, ok := s.authRecordings.Load(core.ManifestID("rec")); !ok || rs.(recordingSettings) != (recordingSettings{record: EnableRecording, mp4: true}) {
+		t.Error("Should keep the recording settings provided by webhook ", rs)
+	}
 	AuthWebhookURL = ""
 }
 
+func TestStreamLabels(t *testing.T) {
+	u, _ := url.Parse("rtmp://localhost/stream/key?tenant=acme&region=eu&region=us")
+	labels := streamLabels(u)
+	if len(labels) != 2 || labels["tenant"] != "acme" || labels["region"] != "eu" {
+		t.Error("Unexpected labels ", labels)
+	}
+	if labels := streamLabels(nil); len(labels) != 0 {
+		t.Error("Expected no labels without a URL ", labels)
+	}
+}
+
+func TestStreamProfiles(t *testing.T) {
+	u, _ := url.Parse("rtmp://localhost/stream/key?profiles=P144p30fps16x9,%20P240p30fps16x9,unknown")
+	profiles := streamProfiles(u)
+	if !reflect.DeepEqual(profiles, []ffmpeg.VideoProfile{ffmpeg.P144p30fps16x9, ffmpeg.P240p30fps16x9}) {
+		t.Error("Unexpected profiles ", profiles)
+	}
+	u, _ = url.Parse("rtmp://localhost/stream/key?tenant=acme")
+	if profiles := streamProfiles(u); profiles != nil {
+		t.Error("Expected no profiles without the parameter ", profiles)
+	}
+	if profiles := streamProfiles(nil); profiles != nil {
+		t.Error("Expected no profiles without a URL ", profiles)
+	}
+
+	// profiles given by the stream key suffix
+	u, _ = url.Parse("rtmp://localhost/stream/key+720p30,P144p30fps16x9")
+	profiles = streamProfiles(u)
+	if !reflect.DeepEqual(profiles, []ffmpeg.VideoProfile{ffmpeg.P720p30fps16x9, ffmpeg.P144p30fps16x9}) {
+		t.Error("Unexpected profiles ", profiles)
+	}
+	// the query parameter takes precedence
+	u, _ = url.Parse("rtmp://localhost/stream/key+720p30?profiles=P240p30fps16x9")
+	profiles = streamProfiles(u)
+	if !reflect.DeepEqual(profiles, []ffmpeg.VideoProfile{ffmpeg.P240p30fps16x9}) {
+		t.Error("Unexpected profiles ", profiles)
+	}
+	// keys that merely contain a + don't name profiles
+	u, _ = url.Parse("rtmp://localhost/stream/key+720p30,unknown")
+	if profiles := streamProfiles(u); profiles != nil {
+		t.Error("Expected no profiles with an unknown profile in the suffix ", profiles)
+	}
+}
+
+func TestStreamSegLen(t *testing.T) {
+	tests := []struct {
+		url    string
+		segLen time.Duration
+	}{
+		{"rtmp://localhost/stream/key?segmentLength=4", 4 * time.Second},
+		{"rtmp://localhost/stream/key?segmentLength=1.5", 1500 * time.Millisecond},
+		{"rtmp://localhost/stream/key?segmentLength=0.5", 0},
+		{"rtmp://localhost/stream/key?segmentLength=0.001", 0},
+		{"rtmp://localhost/stream/key", 0},
+		{"rtmp://localhost/stream/key?segmentLength=abc", 0},
+		{"rtmp://localhost/stream/key?segmentLength=-1", 0},
+		{"rtmp://localhost/stream/key?segmentLength=21", 0},
+	}
+	for _, tt := range tests {
+		u, _ := url.Parse(tt.url)
+		if segLen := streamSegLen(u); segLen != tt.segLen {
+			t.Errorf("Unexpected segment length for %v: %v", tt.url, segLen)
+		}
+	}
+	if segLen := streamSegLen(nil); segLen != 0 {
+		t.Error("Expected no segment length without a URL ", segLen)
+	}
+}
+
+func TestScaleTimeout(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(HTTPTimeout, scaleTimeout(HTTPTimeout, time.Second))
+	assert.Equal(HTTPTimeout, scaleTimeout(HTTPTimeout, defaultSegLen))
+	assert.Equal(5*HTTPTimeout, scaleTimeout(HTTPTimeout, 5*defaultSegLen))
+}
+
+func TestSegmentTimeout(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(HTTPTimeout, segmentTimeout(defaultSegLen))
+	assert.Equal(5*HTTPTimeout, segmentTimeout(5*defaultSegLen))
+	// short segments fail fast
+	assert.Equal(HTTPTimeout/4, segmentTimeout(defaultSegLen/4))
+
+	defer func(m float64) { SegmentTimeoutMultiplier = m }(SegmentTimeoutMultiplier)
+	SegmentTimeoutMultiplier = 1.5
+	assert.Equal(3*time.Second, segmentTimeout(defaultSegLen))
+	SegmentTimeoutMultiplier = 0
+	assert.Equal(HTTPTimeout, segmentTimeout(defaultSegLen))
+}
+
+func TestGotRTMPStreamHandler_SegLen(t *testing.T) {
+	s := setupServer()
+	s.RTMPSegmenter = &StubSegmenter{}
+	handler := gotRTMPStreamHandler(s)
+	cxnSegLen := func(mid core.ManifestID) time.Duration {
+		s.connectionLock.RLock()
+		defer s.connectionLock.RUnlock()
+		return s.rtmpConnections[mid].segLen
+	}
+
+	u, _ := url.Parse("rtmp://localhost:1935/movie")
+	if err := handler(u, stream.NewBasicRTMPVideoStream("dfltlen")); err != nil {
+		t.Fatal(err)
+	}
+	if l := cxnSegLen("dfltlen"); l != SegLen {
+		t.Error("Expected default segment length ", l)
+	}
+
+	u, _ = url.Parse("rtmp://localhost:1935/movie?segmentLength=4")
+	if err := handler(u, stream.NewBasicRTMPVideoStream("rtmplen")); err != nil {
+		t.Fatal(err)
+	}
+	if l := cxnSegLen("rtmplen"); l != 4*time.Second {
+		t.Error("Expected segment length from the URL ", l)
+	}
+
+	// the auth webhook takes precedence
+	s.authSegLens.Store(core.ManifestID("authlen"), 10*time.Second)
+	if err := handler(u, stream.NewBasicRTMPVideoStream("authlen")); err != nil {
+		t.Fatal(err)
+	}
+	if l := cxnSegLen("authlen"); l != 10*time.Second {
+		t.Error("Expected segment length from the webhook ", l)
+	}
+	if _, ok := s.authSegLens.Load(core.ManifestID("authlen")); ok {
+		t.Error("Expected webhook segment length to be removed once used")
+	}
+}
+
+func TestGotRTMPStreamHandler_Recording(t *testing.T) {
+	assert := assert.New(t)
+	defer func() { EnableRecording = false }()
+	EnableRecording = true
+	s := setupServer()
+	s.RTMPSegmenter = &StubSegmenter{}
+	handler := gotRTMPStreamHandler(s)
+	cxnRecording := func(mid core.ManifestID) *streamRecording {
+		s.connectionLock.RLock()
+		defer s.connectionLock.RUnlock()
+		return s.rtmpConnections[mid].recording
+	}
+	u, _ := url.Parse("rtmp://localhost:1935/movie")
+
+	require.Nil(t, handler(u, stream.NewBasicRTMPVideoStream("dfltrec")))
+	assert.NotNil(cxnRecording("dfltrec"))
+
+	// the auth webhook may opt streams out of recording
+	s.authRecordings.Store(core.ManifestID("norec"), recordingSettings{})
+	require.Nil(t, handler(u, stream.NewBasicRTMPVideoStream("norec")))
+	assert.Nil(cxnRecording("norec"))
+	_, ok := s.authRecordings.Load(core.ManifestID("norec"))
+	assert.False(ok)
+
+	// but streams are only recorded to object storage
+	s.authRecordings.Store(core.ManifestID("memrec"), recordingSettings{record: true, mp4: true})
+	require.Nil(t, handler(u, stream.NewBasicRTMPVideoStream("memrec")))
+	assert.Nil(cxnRecording("memrec"))
+}
+
+func TestGotRTMPStreamHandler_Profiles(t *testing.T) {
+	s := setupServer()
+	s.RTMPSegmenter = &StubSegmenter{}
+	handler := gotRTMPStreamHandler(s)
+	cxnProfiles := func(mid core.ManifestID) []ffmpeg.VideoProfile {
+		s.connectionLock.RLock()
+		cxn := s.rtmpConnections[mid]
+		s.connectionLock.RUnlock()
+		cxn.lock.RLock()
+		defer cxn.lock.RUnlock()
+		return cxn.profiles
+	}
+
+	// defaults to the broadcaster's profiles
+	u, _ := url.Parse("rtmp://localhost:1935/movie")
+	strm := stream.NewBasicRTMPVideoStream("dflt")
+	if err := handler(u, strm); err != nil {
+		t.Fatal(err)
+	}
+	if p := cxnProfiles("dflt"); !reflect.DeepEqual(p, BroadcastJobVideoProfiles) {
+		t.Error("Expected default profiles ", p)
+	}
+
+	// from the RTMP URL
+	u, _ = url.Parse("rtmp://localhost:1935/movie?profiles=P144p30fps16x9")
+	strm = stream.NewBasicRTMPVideoStream("rtmpprf")
+	if err := handler(u, strm); err != nil {
+		t.Fatal(err)
+	}
+	if p := cxnProfiles("rtmpprf"); !reflect.DeepEqual(p, []ffmpeg.VideoProfile{ffmpeg.P144p30fps16x9}) {
+		t.Error("Expected profiles from the URL ", p)
+	}
+
+	// the auth webhook takes precedence
+	s.authProfiles.Store(core.ManifestID("authprf"), []ffmpeg.VideoProfile{ffmpeg.P720p30fps16x9})
+	strm = stream.NewBasicRTMPVideoStream("authprf")
+	if err := handler(u, strm); err != nil {
+		t.Fatal(err)
+	}
+	if p := cxnProfiles("authprf"); !reflect.DeepEqual(p, []ffmpeg.VideoProfile{ffmpeg.P720p30fps16x9}) {
+		t.Error("Expected profiles from the webhook ", p)
+	}
+	if _, ok := s.authProfiles.Load(core.ManifestID("authprf")); ok {
+		t.Error("Expected webhook profiles to be removed once used")
+	}
+}
+
+func TestSetStreamProfiles(t *testing.T) {
+	assert := assert.New(t)
+	s := setupServer()
+	s.RTMPSegmenter = &StubSegmenter{}
+	handler := gotRTMPStreamHandler(s)
+	u, _ := url.Parse("rtmp://localhost:1935/movie?profiles=P144p30fps16x9,P240p30fps16x9")
+	strm := stream.NewBasicRTMPVideoStream("setprf")
+	require.Nil(t, handler(u, strm))
+	s.connectionLock.RLock()
+	cxn := s.rtmpConnections["setprf"]
+	s.connectionLock.RUnlock()
+	for _, p := range []ffmpeg.VideoProfile{ffmpeg.P144p30fps16x9, ffmpeg.P240p30fps16x9} {
+		require.Nil(t, cxn.pl.InsertHLSSegment(&p, 0, "abc", 2))
+	}
+
+	assert.Equal(ErrUnknownStream, s.setStreamProfiles("nonexistent", nil))
+
+	// drop a rendition, add another
+	assert.Nil(s.setStreamProfiles("setprf", []ffmpeg.VideoProfile{ffmpeg.P240p30fps16x9, ffmpeg.P360p30fps16x9}))
+	cxn.lock.RLock()
+	assert.Equal([]ffmpeg.VideoProfile{ffmpeg.P240p30fps16x9, ffmpeg.P360p30fps16x9}, cxn.profiles)
+	cxn.lock.RUnlock()
+	assert.True(cxn.isDropped(ffmpeg.P144p30fps16x9.Name))
+	assert.False(cxn.isDropped(ffmpeg.P240p30fps16x9.Name))
+	assert.Nil(cxn.pl.GetHLSMediaPlaylist(ffmpeg.P144p30fps16x9.Name))
+	assert.NotNil(cxn.pl.GetHLSMediaPlaylist(ffmpeg.P240p30fps16x9.Name))
+	assert.Len(cxn.pl.GetHLSMasterPlaylist().Variants, 1)
+
+	// adding back a dropped rendition
+	assert.Nil(s.setStreamProfiles("setprf", []ffmpeg.VideoProfile{ffmpeg.P144p30fps16x9}))
+	assert.False(cxn.isDropped(ffmpeg.P144p30fps16x9.Name))
+	assert.True(cxn.isDropped(ffmpeg.P240p30fps16x9.Name))
+
+	// streams without video can't be transcoded
+	cxn.lock.Lock()
+	cxn.audioOnly = true
+	cxn.lock.Unlock()
+	assert.Equal(ErrAudioOnly, s.setStreamProfiles("setprf", []ffmpeg.VideoProfile{ffmpeg.P144p30fps16x9}))
+}
+
 func TestCreateRTMPStreamHandler(t *testing.T) {
 
 	// Monkey patch rng to avoid unpredictability even when seeding
@@ -384,6 +683,59 @@ func TestEndRTMPStreamHandler(t *testing.T) {
 	}
 }
 
+func TestDrain(t *testing.T) {
+	assert := assert.New(t)
+	newServer := func() *LivepeerServer {
+		return &LivepeerServer{
+			RTMPSegmenter:   &StubSegmenter{skip: true},
+			LivepeerNode:    setupServer().LivepeerNode,
+			connectionLock:  &sync.RWMutex{},
+			rtmpConnections: make(map[core.ManifestID]*rtmpConnection),
+		}
+	}
+	// publishes a stream that LPMS ends once its RTMP connection is closed
+	publish := func(s *LivepeerServer, name string) *rtmpConnection {
+		strm := stream.NewBasicRTMPVideoStream(name)
+		u, _ := url.Parse("rtmp://localhost/" + name)
+		require.Nil(t, gotRTMPStreamHandler(s)(u, strm))
+		go func() {
+			<-strm.EOF
+			endRTMPStreamHandler(s)(u, strm)
+		}()
+		s.connectionLock.RLock()
+		defer s.connectionLock.RUnlock()
+		return s.rtmpConnections[core.ManifestID(name)]
+	}
+
+	s := newServer()
+	cxn := publish(s, "drain")
+	atomic.StoreInt32(&cxn.inFlight, 1)
+	drained := make(chan bool)
+	go func() { drained <- s.Drain(5 * time.Second) }()
+
+	// the stream is ended but drain waits for its segment in flight
+	time.Sleep(3 * drainPollInterval)
+	select {
+	case <-drained:
+		t.Fatal("Drained with a segment in flight")
+	default:
+	}
+	u, _ := url.Parse("rtmp://localhost/new")
+	assert.Empty(createRTMPStreamIDHandler(s)(u), "new streams are rejected")
+	_, err := s.registerConnection(stream.NewBasicRTMPVideoStream("new"))
+	assert.Equal(ErrDraining, err)
+
+	atomic.StoreInt32(&cxn.inFlight, 0)
+	assert.True(<-drained)
+	assert.Empty(s.rtmpConnections)
+
+	// segments stuck in flight don't hold up shutdown past the timeout
+	s = newServer()
+	cxn = publish(s, "stuck")
+	atomic.StoreInt32(&cxn.inFlight, 1)
+	assert.False(s.Drain(3 * drainPollInterval))
+}
+
 // Should publish RTMP stream, turn the RTMP stream into HLS, and broadcast the HLS stream.
 func TestGotRTMPStreamHandler(t *testing.T) {
 	s := setupServer()
@@ -743,6 +1095,24 @@ func TestSessionListener(t *testing.T) {
 	assert.Equal(sd.getOrchCalls, 2)
 	sd.lock.Unlock()
 
+	// profiles changed while a refresh is under way are picked up by another
+	// refresh once it's done
+	cxn.needOrch <- struct{}{}
+	time.Sleep(50 * time.Millisecond)
+	profiles := []ffmpeg.VideoProfile{ffmpeg.P360p30fps16x9}
+	require.Nil(t, s.setStreamProfiles(mid, profiles))
+	sd.waitGetOrch <- struct{}{}
+	sd.waitGetOrch <- struct{}{}
+	time.Sleep(100 * time.Millisecond)
+	sd.lock.Lock()
+	assert.Equal(4, sd.getOrchCalls)
+	sd.lock.Unlock()
+	cxn.lock.RLock()
+	require.NotNil(t, cxn.sess)
+	assert.Equal(profiles, cxn.sess.Profiles)
+	assert.False(cxn.profilesChanged)
+	cxn.lock.RUnlock()
+
 	// test termination
 	cxn.eof <- struct{}{}
 
@@ -879,4 +1249,9 @@ func TestParseStreamID(t *testing.T) {
 	checkSid("//abc", core.StreamID{ManifestID: "abc"})
 	checkSid("abc/def//ghi", core.StreamID{ManifestID: "abc", Rendition: "def//ghi"})
 	checkSid("abc/def.m3u8/ghi.ts", core.StreamID{ManifestID: "abc", Rendition: "def.m3u8/ghi"})
+	// profile suffixes aren't part of the stream ID
+	checkSid("/stream/abc+720p30,360p30", core.StreamID{ManifestID: "abc"})
+	checkSid("/stream/abc/def+720p30", core.StreamID{ManifestID: "abc", Rendition: "def"})
+	checkSid("/stream/abc+def", core.StreamID{ManifestID: "abc+def"})
+	checkSid("/stream/abc+720p30/def", core.StreamID{ManifestID: "abc+720p30", Rendition: "def"})
 }
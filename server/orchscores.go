@@ -0,0 +1,142 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/livepeer/go-livepeer/common"
+	"github.com/livepeer/go-livepeer/net"
+)
+
+// How often orchestrator performance stats are saved to the node DB
+var OrchestratorScoreInterval = time.Minute
+
+// loadOrchestratorScores seeds the orchestrator performance stats with the
+// ones stored in db
+func loadOrchestratorScores(db *common.DB) {
+	scores, err := db.OrchestratorScores()
+	if err != nil {
+		glog.Error("Error loading orchestrator scores: ", err)
+		return
+	}
+	orchPerf.lock.Lock()
+	defer orchPerf.lock.Unlock()
+	for _, s := range scores {
+		if _, ok := orchPerf.perf[s.Transcoder]; ok {
+			continue
+		}
+		p50 := time.Duration(s.LatencyP50 * float64(time.Second))
+		p95 := time.Duration(s.LatencyP95 * float64(time.Second))
+		orchPerf.perf[s.Transcoder] = &orchestratorPerf{
+			Segments:  int(s.Segments),
+			Failures:  int(s.Failures),
+			Latency:   p50,
+			P50:       p50,
+			P95:       p95,
+			latencies: seedLatencies(int(s.Segments-s.Failures), p50, p95),
+		}
+	}
+	glog.V(common.DEBUG).Infof("Loaded scores of %d orchestrators", len(scores))
+}
+
+// seedLatencies returns round trip times with the stored percentiles, one for
+// each successful segment up to perfLatencySamples, so that the percentiles
+// of loaded orchestrators aren't replaced by those of the next few segments
+func seedLatencies(succeeded int, p50, p95 time.Duration) []time.Duration {
+	if succeeded > perfLatencySamples {
+		succeeded = perfLatencySamples
+	}
+	if succeeded <= 0 {
+		return nil
+	}
+	latencies := make([]time.Duration, succeeded)
+	for i := range latencies {
+		if i < (succeeded-1)*95/100 {
+			latencies[i] = p50
+		} else {
+			latencies[i] = p95
+		}
+	}
+	return latencies
+}
+
+// storeOrchestratorScores saves the orchestrator performance stats and
+// prices that changed since they were last stored to db
+func storeOrchestratorScores(db *common.DB) {
+	now := time.Now()
+	var scores []*common.DBOrchestratorScore
+	var prices []*common.DBOrchestratorPrice
+	orchPerf.lock.Lock()
+	for addr, perf := range orchPerf.perf {
+		if perf.dirty {
+			scores = append(scores, &common.DBOrchestratorScore{
+				Transcoder: addr,
+				UpdatedAt:  now,
+				Segments:   int64(perf.Segments),
+				Failures:   int64(perf.Failures),
+				LatencyP50: perf.P50.Seconds(),
+				LatencyP95: perf.P95.Seconds(),
+			})
+			perf.dirty = false
+		}
+		if perf.priceChanged {
+			prices = append(prices, &common.DBOrchestratorPrice{Transcoder: addr, CreatedAt: now, Price: perf.Price})
+			perf.priceChanged = false
+		}
+	}
+	orchPerf.lock.Unlock()
+
+	for _, s := range scores {
+		if err := db.UpdateOrchestratorScore(s); err != nil {
+			glog.Error("Error storing orchestrator score: ", err)
+		}
+	}
+	for _, p := range prices {
+		if err := db.InsertOrchestratorPrice(p); err != nil {
+			glog.Error("Error storing orchestrator price: ", err)
+		}
+	}
+}
+
+// persistOrchestratorScores loads the stored orchestrator scores and then
+// saves them periodically until ctx is done
+func persistOrchestratorScores(ctx context.Context, db *common.DB) {
+	loadOrchestratorScores(db)
+	ticker := time.NewTicker(OrchestratorScoreInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			storeOrchestratorScores(db)
+		case <-ctx.Done():
+			storeOrchestratorScores(db)
+			return
+		}
+	}
+}
+
+// scoreSelection picks the orchestrator with the best score, which weighs
+// the success rate against the tail latency. Orchestrators without stats are
+// assumed to succeed half the time.
+type scoreSelection struct{}
+
+func (scoreSelection) Candidates() int { return SelectionCandidates }
+
+func (scoreSelection) Select(orchs []*net.OrchestratorInfo) *net.OrchestratorInfo {
+	best := orchs[0]
+	bestScore := orchScore(orchPerf.get(best.GetTranscoder()))
+	for _, o := range orchs[1:] {
+		if score := orchScore(orchPerf.get(o.GetTranscoder())); score > bestScore {
+			best, bestScore = o, score
+		}
+	}
+	return best
+}
+
+// orchScore is the success rate, with add-one smoothing, discounted by the
+// 95th percentile round trip time in seconds
+func orchScore(perf orchestratorPerf) float64 {
+	successRate := float64(perf.Segments-perf.Failures+1) / float64(perf.Segments+2)
+	return successRate / (1 + perf.P95.Seconds())
+}
@@ -0,0 +1,102 @@
+package server
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/livepeer/go-livepeer/common"
+	"github.com/livepeer/go-livepeer/net"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOrchestratorScores(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	defer func(p *perfList) { orchPerf = p }(orchPerf)
+	orchPerf = &perfList{perf: make(map[string]*orchestratorPerf)}
+
+	dbh, dbraw, err := common.TempDB(t)
+	require.Nil(err)
+	defer dbh.Close()
+	defer dbraw.Close()
+
+	for i := 1; i <= 10; i++ {
+		orchPerf.record("https://a:8935", time.Duration(i)*100*time.Millisecond, nil)
+	}
+	orchPerf.record("https://a:8935", 0, errors.New("timeout"))
+	orchPerf.recordPrice("https://a:8935", big.NewRat(1, 2))
+	perf := orchPerf.get("https://a:8935")
+	assert.Equal(500*time.Millisecond, perf.P50)
+	assert.Equal(900*time.Millisecond, perf.P95)
+
+	storeOrchestratorScores(dbh)
+	scores, err := dbh.OrchestratorScores()
+	require.Nil(err)
+	require.Len(scores, 1)
+	assert.Equal(int64(11), scores[0].Segments)
+	assert.Equal(int64(1), scores[0].Failures)
+	assert.Equal(0.5, scores[0].LatencyP50)
+	prices, err := dbh.OrchestratorPrices("https://a:8935", 10)
+	require.Nil(err)
+	require.Len(prices, 1)
+	assert.Equal(big.NewRat(1, 2), prices[0].Price)
+
+	// unchanged prices aren't stored again
+	orchPerf.recordPrice("https://a:8935", big.NewRat(1, 2))
+	storeOrchestratorScores(dbh)
+	prices, err = dbh.OrchestratorPrices("https://a:8935", 10)
+	require.Nil(err)
+	assert.Len(prices, 1)
+
+	// new processes start from the stored scores
+	orchPerf = &perfList{perf: make(map[string]*orchestratorPerf)}
+	loadOrchestratorScores(dbh)
+	perf = orchPerf.get("https://a:8935")
+	assert.Equal(11, perf.Segments)
+	assert.Equal(1, perf.Failures)
+	assert.Equal(500*time.Millisecond, perf.P50)
+	assert.Equal(900*time.Millisecond, perf.P95)
+
+	// and the next segments are added to the stored percentiles
+	orchPerf.record("https://a:8935", 100*time.Millisecond, nil)
+	perf = orchPerf.get("https://a:8935")
+	assert.Equal(500*time.Millisecond, perf.P50)
+	assert.Equal(900*time.Millisecond, perf.P95)
+}
+
+func TestSeedLatencies(t *testing.T) {
+	assert := assert.New(t)
+	assert.Nil(seedLatencies(0, time.Second, 2*time.Second))
+	assert.Len(seedLatencies(1000, time.Second, 2*time.Second), perfLatencySamples)
+	for _, n := range []int{1, 2, 10, 1000} {
+		sorted := seedLatencies(n, time.Second, 2*time.Second)
+		if n > 2 {
+			assert.Equal(time.Second, sorted[(len(sorted)-1)/2], n)
+		}
+		assert.Equal(2*time.Second, sorted[(len(sorted)-1)*95/100], n)
+	}
+}
+
+func TestSelection_Score(t *testing.T) {
+	assert := assert.New(t)
+	defer func(p *perfList) { orchPerf = p }(orchPerf)
+	orchPerf = &perfList{perf: make(map[string]*orchestratorPerf)}
+	orchs := []*net.OrchestratorInfo{
+		&net.OrchestratorInfo{Transcoder: "https://a:8935"},
+		&net.OrchestratorInfo{Transcoder: "https://b:8935"},
+		&net.OrchestratorInfo{Transcoder: "https://c:8935"},
+	}
+	for i := 0; i < 10; i++ {
+		orchPerf.record("https://a:8935", 500*time.Millisecond, nil)
+		orchPerf.record("https://b:8935", 500*time.Millisecond, errors.New("timeout"))
+	}
+
+	s, err := NewSelectionStrategy("score", nil)
+	assert.Nil(err)
+	assert.Equal("https://a:8935", s.Select(orchs).Transcoder)
+	// unknown orchestrators beat failing ones
+	assert.Equal("https://c:8935", s.Select(orchs[1:]).Transcoder)
+}
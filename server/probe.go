@@ -0,0 +1,75 @@
+package server
+
+import (
+	"context"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/livepeer/go-livepeer/common"
+	"github.com/livepeer/go-livepeer/monitor"
+	"github.com/livepeer/go-livepeer/net"
+)
+
+// ProbeOrchestrators pings the orchestrators returned by discovery before
+// sessions are started with them. Orchestrators that don't answer, or take
+// longer than MaxProbeLatency to, are skipped; the rest are tried fastest
+// first.
+var ProbeOrchestrators = false
+
+// Longest ping round trip time of orchestrators sessions are started with.
+// Zero doesn't limit it.
+var MaxProbeLatency time.Duration
+
+var pingOrchestrator = PingOrchestrator
+
+// probeOrchestrators pings orchs in parallel and returns those that answered
+// within MaxProbeLatency, sorted by round trip time. Round trip times are kept
+// in the performance stats of the orchestrators for selection strategies.
+func probeOrchestrators(orchs []*net.OrchestratorInfo) []*net.OrchestratorInfo {
+	rtts := make([]time.Duration, len(orchs))
+	ctx, cancel := context.WithTimeout(context.Background(), GRPCTimeout)
+	defer cancel()
+	var wg sync.WaitGroup
+	for i, o := range orchs {
+		wg.Add(1)
+		go func(i int, o *net.OrchestratorInfo) {
+			defer wg.Done()
+			rtts[i] = -1
+			uri, err := url.ParseRequestURI(o.GetTranscoder())
+			if err != nil {
+				glog.Errorf("Could not parse orchestrator=%s err=%v", o.GetTranscoder(), err)
+				return
+			}
+			rtt, err := pingOrchestrator(ctx, uri)
+			if err != nil {
+				glog.Errorf("Could not ping orchestrator=%s err=%v", o.GetTranscoder(), err)
+				return
+			}
+			rtts[i] = rtt
+			orchPerf.recordPing(o.GetTranscoder(), rtt)
+			if monitor.Enabled {
+				monitor.LogOrchestratorPing(o.GetTranscoder(), rtt)
+			}
+		}(i, o)
+	}
+	wg.Wait()
+
+	var probed []*net.OrchestratorInfo
+	latencies := make(map[*net.OrchestratorInfo]time.Duration)
+	for i, o := range orchs {
+		if rtts[i] < 0 {
+			continue
+		}
+		if MaxProbeLatency > 0 && rtts[i] > MaxProbeLatency {
+			glog.V(common.DEBUG).Infof("Skipping orchestrator=%s with ping=%v above max=%v", o.GetTranscoder(), rtts[i], MaxProbeLatency)
+			continue
+		}
+		probed = append(probed, o)
+		latencies[o] = rtts[i]
+	}
+	sort.SliceStable(probed, func(i, j int) bool { return latencies[probed[i]] < latencies[probed[j]] })
+	return probed
+}
@@ -0,0 +1,106 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/livepeer/go-livepeer/core"
+	"github.com/livepeer/go-livepeer/drivers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func stubPings(pings map[string]time.Duration) func() {
+	orig := pingOrchestrator
+	pingOrchestrator = func(ctx context.Context, uri *url.URL) (time.Duration, error) {
+		rtt, ok := pings[uri.String()]
+		if !ok {
+			return 0, errors.New("unreachable")
+		}
+		return rtt, nil
+	}
+	return func() { pingOrchestrator = orig }
+}
+
+func TestProbeOrchestrators(t *testing.T) {
+	assert := assert.New(t)
+	defer func(p *perfList) { orchPerf = p }(orchPerf)
+	orchPerf = &perfList{perf: make(map[string]*orchestratorPerf)}
+	defer func(d time.Duration) { MaxProbeLatency = d }(MaxProbeLatency)
+	defer stubPings(map[string]time.Duration{
+		"https://a:8935": 300 * time.Millisecond,
+		"https://b:8935": 100 * time.Millisecond,
+	})()
+
+	// unreachable orchestrators are dropped and the rest sorted by ping
+	orchs := selectionOrchs()
+	probed := probeOrchestrators(orchs)
+	require.Len(t, probed, 2)
+	assert.Equal("https://b:8935", probed[0].Transcoder)
+	assert.Equal("https://a:8935", probed[1].Transcoder)
+	assert.Equal(300*time.Millisecond, orchPerf.get("https://a:8935").Ping)
+	assert.Equal(time.Duration(0), orchPerf.get("https://c:8935").Ping)
+
+	// as are those slower than the ceiling
+	MaxProbeLatency = 200 * time.Millisecond
+	probed = probeOrchestrators(orchs)
+	require.Len(t, probed, 1)
+	assert.Equal("https://b:8935", probed[0].Transcoder)
+
+	assert.Empty(probeOrchestrators(nil))
+}
+
+func TestSelection_LatencyPing(t *testing.T) {
+	assert := assert.New(t)
+	defer func(p *perfList) { orchPerf = p }(orchPerf)
+	orchPerf = &perfList{perf: make(map[string]*orchestratorPerf)}
+	orchs := selectionOrchs()
+
+	// orchestrators without segment stats are ranked by their ping
+	orchPerf.recordPing("https://a:8935", 300*time.Millisecond)
+	orchPerf.recordPing("https://b:8935", 100*time.Millisecond)
+	orchPerf.recordPing("https://c:8935", 200*time.Millisecond)
+	s := latencySelection{}
+	assert.Equal("https://b:8935", s.Select(orchs).Transcoder)
+
+	// segment stats take over once there are some
+	orchPerf.record("https://b:8935", time.Second, nil)
+	assert.Equal("https://c:8935", s.Select(orchs).Transcoder)
+}
+
+func TestSelectOrchestrator_Probe(t *testing.T) {
+	assert := assert.New(t)
+	s := setupServer()
+	mid := core.SplitStreamIDString(t.Name()).ManifestID
+	cpl := core.NewBasicPlaylistManager(mid, drivers.NodeStorage.NewSession(string(mid)))
+	s.LivepeerNode.OrchestratorPool = &stubDiscovery{lock: &sync.Mutex{}, infos: selectionOrchs()}
+	defer func(p *perfList) { orchPerf = p }(orchPerf)
+	orchPerf = &perfList{perf: make(map[string]*orchestratorPerf)}
+	defer func(p bool) { ProbeOrchestrators = p }(ProbeOrchestrators)
+	defer func(d time.Duration) { MaxProbeLatency = d }(MaxProbeLatency)
+	defer stubPings(map[string]time.Duration{
+		"https://a:8935": 300 * time.Millisecond,
+		"https://c:8935": 100 * time.Millisecond,
+	})()
+
+	// without probing, the first orchestrator to respond is used
+	sess, err := selectOrchestrator(s.LivepeerNode, cpl, BroadcastJobVideoProfiles)
+	assert.Nil(err)
+	assert.Equal("https://a:8935", sess.OrchestratorInfo.Transcoder)
+
+	ProbeOrchestrators = true
+	sess, err = selectOrchestrator(s.LivepeerNode, cpl, BroadcastJobVideoProfiles)
+	assert.Nil(err)
+	assert.Equal("https://c:8935", sess.OrchestratorInfo.Transcoder)
+	redundant := selectRedundantOrchestrators(s.LivepeerNode, cpl, sess, 2)
+	require.Len(t, redundant, 1)
+	assert.Equal("https://a:8935", redundant[0].OrchestratorInfo.Transcoder)
+
+	MaxProbeLatency = 50 * time.Millisecond
+	_, err = selectOrchestrator(s.LivepeerNode, cpl, BroadcastJobVideoProfiles)
+	assert.Equal(ErrNoOrchs, err)
+}
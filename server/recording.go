@@ -0,0 +1,247 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ericxtang/m3u8"
+	"github.com/golang/glog"
+	"github.com/livepeer/go-livepeer/core"
+	"github.com/livepeer/go-livepeer/drivers"
+	"github.com/livepeer/go-livepeer/monitor"
+	"github.com/livepeer/lpms/ffmpeg"
+)
+
+// EnableRecording makes broadcasters keep every segment of their streams in
+// object storage and, once a stream ends, write a VOD playlist of all of it
+var EnableRecording = false
+
+// RecordMP4 also remuxes the source rendition of recorded streams into a
+// single MP4 file. The auth webhook may override both settings per stream.
+var RecordMP4 = false
+
+// MaxRecordingMP4Size is the largest MP4 a recording is remuxed into, in
+// bytes. Longer recordings only get VOD playlists.
+var MaxRecordingMP4Size = 1 << 30
+
+var ErrRecordingTooLarge = errors.New("ErrRecordingTooLarge")
+
+var errTracksChanged = errors.New("tracks differ from the first segment")
+
+// Number of finished recordings listed by the status API
+const maxRecordings = 100
+
+type recordedSegment struct {
+	seqNo    uint64
+	uri      string
+	duration float64
+}
+
+// streamRecording accumulates the segments of a stream being recorded
+type streamRecording struct {
+	lock       sync.Mutex
+	renditions map[string][]recordedSegment // rendition : segments
+	profiles   []ffmpeg.VideoProfile        // in order of appearance
+	finalized  bool
+	mp4        bool // remux the source rendition into an MP4
+}
+
+// recordingSettings are the recording options of a single stream
+type recordingSettings struct {
+	record bool
+	mp4    bool
+}
+
+func newStreamRecording(mp4 bool) *streamRecording {
+	return &streamRecording{renditions: make(map[string][]recordedSegment), mp4: mp4}
+}
+
+// add records a segment of a rendition saved to object storage at uri.
+// Segments arriving after the recording was finalized are ignored.
+func (r *streamRecording) add(profile *ffmpeg.VideoProfile, seqNo uint64, uri string, duration float64) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.finalized {
+		return
+	}
+	segs, ok := r.renditions[profile.Name]
+	if !ok {
+		r.profiles = append(r.profiles, *profile)
+	}
+	for _, s := range segs {
+		if s.seqNo == seqNo {
+			return // redundant submission
+		}
+	}
+	r.renditions[profile.Name] = append(segs, recordedSegment{seqNo: seqNo, uri: uri, duration: duration})
+}
+
+// Recording describes the VOD output of a finished stream
+type Recording struct {
+	URL        string  // of the master playlist
+	MP4URL     string  `json:",omitempty"`
+	Segments   int     // of the source rendition
+	Duration   float64 // in seconds
+	FinishedAt time.Time
+	Error      string `json:",omitempty"`
+}
+
+// recordings lists the most recently finished recordings, keyed by manifest ID
+var recordings = &recordingList{recs: make(map[core.ManifestID]*Recording)}
+
+type recordingList struct {
+	lock  sync.Mutex
+	recs  map[core.ManifestID]*Recording
+	order []core.ManifestID // oldest first
+}
+
+func (l *recordingList) add(mid core.ManifestID, rec *Recording) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if _, ok := l.recs[mid]; !ok {
+		l.order = append(l.order, mid)
+	}
+	l.recs[mid] = rec
+	if len(l.order) > maxRecordings {
+		delete(l.recs, l.order[0])
+		l.order = l.order[1:]
+	}
+}
+
+func (l *recordingList) get() map[string]*Recording {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	res := make(map[string]*Recording, len(l.recs))
+	for mid, rec := range l.recs {
+		res[string(mid)] = rec
+	}
+	return res
+}
+
+// finalizeRecording writes the VOD playlists of a finished stream, and its
+// MP4 if requested, to sess. The outcome is listed by the status API
+// and sent as a RecordingFinalized event.
+func finalizeRecording(mid core.ManifestID, nonce uint64, source string, r *streamRecording, sess drivers.OSSession) *Recording {
+	rec, err := writeRecording(source, r, sess)
+	if err != nil {
+		glog.Errorf("Error finalizing recording manifestID=%s nonce=%d err=%v", mid, nonce, err)
+		rec.Error = err.Error()
+	} else {
+		glog.Infof("Finalized recording manifestID=%s nonce=%d url=%s mp4=%s duration=%.3f", mid, nonce, rec.URL, rec.MP4URL, rec.Duration)
+	}
+	rec.FinishedAt = time.Now()
+	recordings.add(mid, rec)
+	if monitor.Enabled {
+		monitor.LogRecordingFinalized(nonce, string(mid), rec.URL, rec.MP4URL, rec.Duration, rec.Error)
+	}
+	return rec
+}
+
+func writeRecording(source string, r *streamRecording, sess drivers.OSSession) (*Recording, error) {
+	r.lock.Lock()
+	r.finalized = true
+	r.lock.Unlock()
+
+	rec := &Recording{}
+	if len(r.renditions[source]) == 0 {
+		return rec, fmt.Errorf("no segments recorded")
+	}
+	master := m3u8.NewMasterPlaylist()
+	for _, p := range r.profiles {
+		segs := r.renditions[p.Name]
+		sort.Slice(segs, func(i, j int) bool { return segs[i].seqNo < segs[j].seqNo })
+		mpl, err := m3u8.NewMediaPlaylist(0, uint(len(segs)))
+		if err != nil {
+			return rec, err
+		}
+		for _, s := range segs {
+			if err := mpl.Append(s.uri, s.duration, ""); err != nil {
+				return rec, err
+			}
+		}
+		mpl.MediaType = m3u8.VOD
+		mpl.Close()
+		name := p.Name + ".m3u8"
+		if _, err := sess.SaveData(name, mpl.Encode().Bytes()); err != nil {
+			return rec, err
+		}
+		master.Append(name, mpl, ffmpeg.VideoProfileToVariantParams(p))
+		if p.Name == source {
+			rec.Segments = len(segs)
+			for _, s := range segs {
+				rec.Duration += s.duration
+			}
+		}
+	}
+	url, err := sess.SaveData("index.m3u8", master.Encode().Bytes())
+	if err != nil {
+		return rec, err
+	}
+	rec.URL = url
+
+	if r.mp4 {
+		data, err := remuxRecording(r.renditions[source])
+		if err != nil {
+			return rec, err
+		}
+		if rec.MP4URL, err = sess.SaveData(source+".mp4", data); err != nil {
+			return rec, err
+		}
+	}
+	return rec, nil
+}
+
+// remuxRecording downloads the recorded segments of a rendition and remuxes
+// them into a single fragmented MP4 with a fragment per segment. Segments are
+// downloaded one at a time, but the MP4 is built in memory to be saved, so
+// it's capped at MaxRecordingMP4Size. The tracks of every segment must match
+// those of the first; audio missing from a segment leaves a gap.
+func remuxRecording(segs []recordedSegment) ([]byte, error) {
+	var out []byte
+	var first []*fmp4Track
+	for i, s := range segs {
+		data, err := drivers.GetSegmentData(s.uri)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkSegmentHash(s.uri, data); err != nil {
+			return nil, fmt.Errorf("segment %d: %v", s.seqNo, err)
+		}
+		video, audio, err := demuxTS(data)
+		if err != nil {
+			return nil, fmt.Errorf("segment %d: %v", s.seqNo, err)
+		}
+		if i == 0 {
+			first = []*fmp4Track{video}
+			if audio != nil {
+				first = append(first, audio)
+			}
+			out = initSegment(first...)
+		}
+
+		tracks := []*fmp4Track{video}
+		if !bytes.Equal(video.entry, first[0].entry) {
+			return nil, fmt.Errorf("segment %d: %v", s.seqNo, errTracksChanged)
+		}
+		switch {
+		case len(first) > 1 && audio == nil:
+			glog.Warningf("Recorded segment without audio seqNo=%d; leaving a gap in the MP4", s.seqNo)
+		case len(first) > 1 && !bytes.Equal(audio.entry, first[1].entry):
+			return nil, fmt.Errorf("segment %d: %v", s.seqNo, errTracksChanged)
+		case len(first) > 1:
+			tracks = append(tracks, audio)
+		case audio != nil:
+			glog.Warningf("Dropping audio of recorded segment seqNo=%d; the recording started without audio", s.seqNo)
+		}
+
+		out = append(out, fragment(uint32(i+1), tracks...)...)
+		if len(out) > MaxRecordingMP4Size {
+			return nil, ErrRecordingTooLarge
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,147 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/livepeer/go-livepeer/core"
+	"github.com/livepeer/go-livepeer/drivers"
+	"github.com/livepeer/lpms/ffmpeg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStreamRecording(t *testing.T) {
+	assert := assert.New(t)
+	r := newStreamRecording(false)
+	source := &ffmpeg.VideoProfile{Name: "source"}
+	r.add(source, 1, "https://os/source/1.ts", 2)
+	r.add(&ffmpeg.P240p30fps16x9, 0, "https://os/P240p30fps16x9/0.ts", 2)
+	r.add(source, 0, "https://os/source/0.ts", 2)
+	// redundant submissions are ignored
+	r.add(source, 1, "https://os/source/1.ts", 2)
+	assert.Len(r.renditions["source"], 2)
+	assert.Equal([]string{"source", "P240p30fps16x9"}, []string{r.profiles[0].Name, r.profiles[1].Name})
+
+	sess := drivers.NewMemoryDriver(nil).NewSession("rec")
+	rec, err := writeRecording("source", r, sess)
+	require.Nil(t, err)
+	assert.Equal("/stream/rec/index.m3u8", rec.URL)
+	assert.Equal(2, rec.Segments)
+	assert.Equal(4.0, rec.Duration)
+	assert.Empty(rec.MP4URL)
+
+	mem := sess.(*drivers.MemorySession)
+	master := string(mem.GetData("rec/index.m3u8"))
+	assert.Contains(master, "source.m3u8")
+	assert.Contains(master, "P240p30fps16x9.m3u8")
+	media := string(mem.GetData("rec/source.m3u8"))
+	assert.Contains(media, "#EXT-X-PLAYLIST-TYPE:VOD")
+	assert.Contains(media, "#EXT-X-ENDLIST")
+	assert.True(strings.Index(media, "source/0.ts") < strings.Index(media, "source/1.ts"))
+
+	// segments arriving after the stream ended are ignored
+	r.add(source, 2, "https://os/source/2.ts", 2)
+	assert.Len(r.renditions["source"], 2)
+
+	_, err = writeRecording("source", newStreamRecording(false), sess)
+	assert.NotNil(err)
+}
+
+func TestRemuxRecording(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	data, err := ioutil.ReadFile("../core/test.ts")
+	require.Nil(err)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing.ts" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(data)
+	}))
+	defer ts.Close()
+
+	segs := []recordedSegment{{seqNo: 0, uri: ts.URL + "/0.ts"}, {seqNo: 1, uri: ts.URL + "/1.ts"}}
+	mp4, err := remuxRecording(segs)
+	require.Nil(err)
+	assert.Equal([]string{"ftyp", "moov", "moof", "mdat", "moof", "mdat"}, boxTypes(t, mp4))
+
+	_, err = remuxRecording(append(segs, recordedSegment{seqNo: 2, uri: ts.URL + "/missing.ts"}))
+	assert.NotNil(err)
+
+	// content addressed segments are checked against their hash
+	hash := fmt.Sprintf("%x", crypto.Keccak256(data))
+	_, err = remuxRecording([]recordedSegment{{seqNo: 0, uri: ts.URL + "/source/" + hash + ".ts"}})
+	assert.Nil(err)
+	_, err = remuxRecording([]recordedSegment{{seqNo: 0, uri: ts.URL + "/source/" + strings.Repeat("ab", 32) + ".ts"}})
+	assert.EqualError(err, "segment 0: ErrSegmentHash")
+
+	// recordings too large to remux in memory
+	defer func(max int) { MaxRecordingMP4Size = max }(MaxRecordingMP4Size)
+	MaxRecordingMP4Size = len(mp4) - 1
+	_, err = remuxRecording(segs)
+	assert.Equal(ErrRecordingTooLarge, err)
+}
+
+func TestRemuxRecording_MissingAudio(t *testing.T) {
+	assert := assert.New(t)
+	data, err := ioutil.ReadFile("../core/test.ts")
+	require.Nil(t, err)
+	// the same segment with its AAC stream relabelled as private data
+	noAudio := append([]byte{}, data...)
+	i := bytes.Index(noAudio, []byte{tsStreamTypeAAC, 0xe1, 0x01, 0xf0, 0x00})
+	require.True(t, i >= 0)
+	noAudio[i] = 0x06
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/noaudio.ts" {
+			w.Write(noAudio)
+			return
+		}
+		w.Write(data)
+	}))
+	defer ts.Close()
+
+	// segments missing audio are remuxed without it, as are all segments of
+	// recordings that start without audio
+	for _, segs := range [][]recordedSegment{
+		{{seqNo: 0, uri: ts.URL + "/0.ts"}, {seqNo: 1, uri: ts.URL + "/noaudio.ts"}, {seqNo: 2, uri: ts.URL + "/2.ts"}},
+		{{seqNo: 0, uri: ts.URL + "/noaudio.ts"}, {seqNo: 1, uri: ts.URL + "/1.ts"}},
+	} {
+		mp4, err := remuxRecording(segs)
+		assert.Nil(err)
+		types := boxTypes(t, mp4)
+		assert.Equal(2+2*len(segs), len(types))
+	}
+}
+
+func TestFinalizeRecording(t *testing.T) {
+	assert := assert.New(t)
+	defer func(l *recordingList) { recordings = l }(recordings)
+	recordings = &recordingList{recs: make(map[core.ManifestID]*Recording)}
+
+	sess := drivers.NewMemoryDriver(nil).NewSession("fin")
+	r := newStreamRecording(false)
+	r.add(&ffmpeg.VideoProfile{Name: "source"}, 0, "https://os/source/0.ts", 2)
+	rec := finalizeRecording("fin", 1, "source", r, sess)
+	assert.Empty(rec.Error)
+	assert.False(rec.FinishedAt.IsZero())
+	assert.Equal(map[string]*Recording{"fin": rec}, recordings.get())
+
+	rec = finalizeRecording("empty", 2, "source", newStreamRecording(false), sess)
+	assert.NotEmpty(rec.Error)
+	assert.Equal(rec, recordings.get()["empty"])
+
+	// only the most recent recordings are kept
+	for i := 0; i < maxRecordings; i++ {
+		recordings.add(core.ManifestID(fmt.Sprintf("rec%d", i)), &Recording{})
+	}
+	assert.Len(recordings.get(), maxRecordings)
+	assert.Nil(recordings.get()["fin"])
+}
@@ -0,0 +1,52 @@
+package server
+
+import (
+	"math/rand"
+	"time"
+)
+
+// MinSessionRefreshInterval is the least time between two session refreshes
+// of a stream. Every refresh requested sooner than that after the previous
+// one doubles the interval, up to BroadcastRetry, so streams whose sessions
+// keep failing don't hammer orchestrator discovery. Zero disables the limit.
+var MinSessionRefreshInterval = time.Second
+
+// Fraction of the wait before a session refresh that is randomized, so the
+// refreshes of streams failing together are spread out
+const sessionRefreshJitter = 0.25
+
+// refreshLimiter spaces out the session refreshes of a stream. Only accessed
+// by the stream's session listener while it holds its refresh semaphore.
+type refreshLimiter struct {
+	last  time.Time // when the previous refresh started
+	churn uint      // refreshes in a row requested within the interval
+}
+
+// interval returns the least time to leave after the previous refresh
+func (l *refreshLimiter) interval() time.Duration {
+	interval := MinSessionRefreshInterval << l.churn
+	if interval > BroadcastRetry || interval <= 0 {
+		interval = BroadcastRetry
+	}
+	return interval
+}
+
+// wait returns how long a refresh requested at now should be delayed by and
+// records it as started at the end of that wait
+func (l *refreshLimiter) wait(now time.Time) time.Duration {
+	if MinSessionRefreshInterval <= 0 {
+		return 0
+	}
+	var wait time.Duration
+	if !l.last.IsZero() && now.Sub(l.last) < l.interval() {
+		if l.interval() < BroadcastRetry {
+			l.churn++
+		}
+		wait = l.interval() - now.Sub(l.last)
+		wait += time.Duration(sessionRefreshJitter * (2*rand.Float64() - 1) * float64(wait))
+	} else {
+		l.churn = 0
+	}
+	l.last = now.Add(wait)
+	return wait
+}
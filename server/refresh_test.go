@@ -0,0 +1,45 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRefreshLimiter(t *testing.T) {
+	assert := assert.New(t)
+	defer func(i time.Duration) { MinSessionRefreshInterval = i }(MinSessionRefreshInterval)
+	MinSessionRefreshInterval = time.Second
+	// the wait is the remaining interval, give or take the jitter
+	within := func(expected, wait time.Duration) {
+		d := time.Duration(sessionRefreshJitter * float64(expected))
+		assert.True(wait >= expected-d && wait <= expected+d, "expected %v got %v", expected, wait)
+	}
+
+	l := &refreshLimiter{}
+	now := time.Now()
+	assert.Equal(time.Duration(0), l.wait(now), "first refresh isn't delayed")
+
+	// refreshes requested in quick succession back off exponentially
+	within(2*time.Second, l.wait(now))
+	now = l.last
+	within(4*time.Second, l.wait(now))
+	now = l.last
+	within(8*time.Second, l.wait(now))
+
+	// up to BroadcastRetry
+	for i := 0; i < 10; i++ {
+		now = l.last
+		l.wait(now)
+	}
+	assert.Equal(BroadcastRetry, l.interval())
+
+	// a refresh after a calm period resets the backoff
+	now = l.last.Add(BroadcastRetry)
+	assert.Equal(time.Duration(0), l.wait(now))
+	within(2*time.Second, l.wait(now.Add(100*time.Millisecond))+100*time.Millisecond)
+
+	MinSessionRefreshInterval = 0
+	assert.Equal(time.Duration(0), (&refreshLimiter{last: now}).wait(now))
+}
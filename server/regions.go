@@ -0,0 +1,68 @@
+package server
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/livepeer/go-livepeer/net"
+)
+
+// Region this node advertises to broadcasters when running as an orchestrator
+var OrchestratorRegion string
+
+// Regions broadcasters prefer orchestrators in, most preferred first.
+// Orchestrators in other regions are only used when none in these respond to
+// discovery. AutoRegion prefers the regions of the orchestrators with the
+// lowest observed latency instead.
+var PreferredRegions []string
+
+const AutoRegion = "auto"
+
+// preferRegion returns the orchestrators of orchs in the most preferred
+// region among them, keeping their order. Returns orchs as is if there are no
+// PreferredRegions.
+func preferRegion(orchs []*net.OrchestratorInfo) []*net.OrchestratorInfo {
+	if len(PreferredRegions) == 0 || len(orchs) == 0 {
+		return orchs
+	}
+	rank := listedRegionRank
+	if len(PreferredRegions) == 1 && PreferredRegions[0] == AutoRegion {
+		rank = regionLatencies(orchs)
+	}
+	sorted := append([]*net.OrchestratorInfo(nil), orchs...)
+	sort.SliceStable(sorted, func(i, j int) bool { return rank(sorted[i]) < rank(sorted[j]) })
+	n := 1
+	for n < len(sorted) && rank(sorted[n]) == rank(sorted[0]) {
+		n++
+	}
+	return sorted[:n]
+}
+
+// listedRegionRank is the position of the region of o in PreferredRegions,
+// or the length of PreferredRegions if it isn't listed
+func listedRegionRank(o *net.OrchestratorInfo) int64 {
+	for i, r := range PreferredRegions {
+		if strings.EqualFold(r, o.GetRegion()) {
+			return int64(i)
+		}
+	}
+	return int64(len(PreferredRegions))
+}
+
+// regionLatencies ranks the regions of orchs by the lowest latency observed
+// from an orchestrator in each. As with latencySelection, orchestrators
+// without stats count as the fastest so their regions get tried.
+func regionLatencies(orchs []*net.OrchestratorInfo) func(*net.OrchestratorInfo) int64 {
+	latencies := make(map[string]time.Duration)
+	for _, o := range orchs {
+		region := strings.ToLower(o.GetRegion())
+		l := observedLatency(o)
+		if best, ok := latencies[region]; !ok || l < best {
+			latencies[region] = l
+		}
+	}
+	return func(o *net.OrchestratorInfo) int64 {
+		return int64(latencies[strings.ToLower(o.GetRegion())])
+	}
+}
@@ -0,0 +1,80 @@
+package server
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/livepeer/go-livepeer/core"
+	"github.com/livepeer/go-livepeer/drivers"
+	"github.com/livepeer/go-livepeer/net"
+	"github.com/stretchr/testify/assert"
+)
+
+func regionOrchs() []*net.OrchestratorInfo {
+	return []*net.OrchestratorInfo{
+		&net.OrchestratorInfo{Transcoder: "https://us1:8935", Region: "us"},
+		&net.OrchestratorInfo{Transcoder: "https://eu1:8935", Region: "eu"},
+		&net.OrchestratorInfo{Transcoder: "https://none:8935"},
+		&net.OrchestratorInfo{Transcoder: "https://eu2:8935", Region: "EU"},
+	}
+}
+
+func transcoders(orchs []*net.OrchestratorInfo) []string {
+	var addrs []string
+	for _, o := range orchs {
+		addrs = append(addrs, o.Transcoder)
+	}
+	return addrs
+}
+
+func TestPreferRegion(t *testing.T) {
+	assert := assert.New(t)
+	defer func(r []string) { PreferredRegions = r }(PreferredRegions)
+	orchs := regionOrchs()
+
+	// without preferred regions, all orchestrators are candidates
+	PreferredRegions = nil
+	assert.Equal(orchs, preferRegion(orchs))
+
+	PreferredRegions = []string{"eu", "us"}
+	assert.Equal([]string{"https://eu1:8935", "https://eu2:8935"}, transcoders(preferRegion(orchs)))
+	// falls back to the next region
+	assert.Equal([]string{"https://us1:8935"}, transcoders(preferRegion([]*net.OrchestratorInfo{orchs[0], orchs[2]})))
+	// and to orchestrators in other regions
+	assert.Equal([]string{"https://none:8935"}, transcoders(preferRegion([]*net.OrchestratorInfo{orchs[2]})))
+	assert.Empty(preferRegion(nil))
+}
+
+func TestPreferRegion_Auto(t *testing.T) {
+	assert := assert.New(t)
+	defer func(r []string) { PreferredRegions = r }(PreferredRegions)
+	defer func(p *perfList) { orchPerf = p }(orchPerf)
+	orchPerf = &perfList{perf: make(map[string]*orchestratorPerf)}
+	PreferredRegions = []string{AutoRegion}
+	orchs := regionOrchs()
+
+	orchPerf.record("https://us1:8935", 100*time.Millisecond, nil)
+	orchPerf.record("https://eu1:8935", 50*time.Millisecond, nil)
+	orchPerf.record("https://eu2:8935", 300*time.Millisecond, nil)
+	orchPerf.record("https://none:8935", 200*time.Millisecond, nil)
+	assert.Equal([]string{"https://eu1:8935", "https://eu2:8935"}, transcoders(preferRegion(orchs)))
+
+	// regions without stats are tried
+	orchs = append(orchs, &net.OrchestratorInfo{Transcoder: "https://ap1:8935", Region: "ap"})
+	assert.Equal([]string{"https://ap1:8935"}, transcoders(preferRegion(orchs)))
+}
+
+func TestSelectOrchestrator_PreferredRegion(t *testing.T) {
+	assert := assert.New(t)
+	s := setupServer()
+	mid := core.SplitStreamIDString(t.Name()).ManifestID
+	cpl := core.NewBasicPlaylistManager(mid, drivers.NodeStorage.NewSession(string(mid)))
+	s.LivepeerNode.OrchestratorPool = &stubDiscovery{lock: &sync.Mutex{}, infos: regionOrchs()}
+	defer func(r []string) { PreferredRegions = r }(PreferredRegions)
+
+	PreferredRegions = []string{"eu"}
+	sess, err := selectOrchestrator(s.LivepeerNode, cpl, BroadcastJobVideoProfiles)
+	assert.Nil(err)
+	assert.Equal("https://eu1:8935", sess.OrchestratorInfo.Transcoder)
+}
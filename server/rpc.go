@@ -30,6 +30,10 @@ const GRPCConnectTimeout = 3 * time.Second
 const GRPCTimeout = 8 * time.Second
 const HTTPTimeout = 8 * time.Second
 
+// Capabilities this node advertises to broadcasters when running as an
+// orchestrator
+var OrchestratorCapabilities []string
+
 type Orchestrator interface {
 	ServiceURI() *url.URL
 	Address() ethcommon.Address
@@ -62,6 +66,14 @@ type BroadcastSession struct {
 	PMSessionID      string
 }
 
+// expectsDirectUpload reports whether the orchestrator has no storage of its
+// own and asked for segments to be sent inline with the transcode request
+// rather than by the URI of the broadcaster's storage
+func (s *BroadcastSession) expectsDirectUpload() bool {
+	storage := s.OrchestratorInfo.GetStorage()
+	return len(storage) > 0 && storage[0].GetStorageType() == net.OSInfo_DIRECT
+}
+
 type lphttp struct {
 	orchestrator Orchestrator
 	orchRpc      *grpc.Server
@@ -125,15 +137,15 @@ func CheckOrchestratorAvailability(orch Orchestrator) bool {
 
 	ping := crypto.Keccak256(ts_signature)
 
-	orch_client, conn, err := startOrchestratorClient(orch.ServiceURI())
+	ctx, cancel := context.WithTimeout(context.Background(), GRPCTimeout)
+	defer cancel()
+
+	orch_client, conn, err := startOrchestratorClient(ctx, orch.ServiceURI())
 	if err != nil {
 		return false
 	}
 	defer conn.Close()
 
-	ctx, cancel := context.WithTimeout(context.Background(), GRPCTimeout)
-	defer cancel()
-
 	pong, err := orch_client.Ping(ctx, &net.PingPong{Value: ping})
 	if err != nil {
 		glog.Error("Was not able to submit Ping: ", err)
@@ -143,6 +155,22 @@ func CheckOrchestratorAvailability(orch Orchestrator) bool {
 	return orch.VerifySig(orch.Address(), string(ping), pong.Value)
 }
 
+// PingOrchestrator returns the round trip time of a Ping to the orchestrator
+// at uri. Connecting to the orchestrator isn't counted.
+func PingOrchestrator(ctx context.Context, uri *url.URL) (time.Duration, error) {
+	c, conn, err := startOrchestratorClient(ctx, uri)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	start := time.Now()
+	if _, err := c.Ping(ctx, &net.PingPong{Value: []byte(fmt.Sprintf("%v", start))}); err != nil {
+		return 0, errors.New("Could not ping orchestrator: " + err.Error())
+	}
+	return time.Since(start), nil
+}
+
 func ping(context context.Context, req *net.PingPong, orch Orchestrator) (*net.PingPong, error) {
 	glog.Info("Received Ping request")
 	value, err := orch.Sign(req.Value)
@@ -155,7 +183,7 @@ func ping(context context.Context, req *net.PingPong, orch Orchestrator) (*net.P
 
 // The broadcaster calls GetOrchestratorInfo which invokes GetOrchestrator on the orchestrator
 func GetOrchestratorInfo(ctx context.Context, bcast Broadcaster, orchestratorServer *url.URL) (*net.OrchestratorInfo, error) {
-	c, conn, err := startOrchestratorClient(orchestratorServer)
+	c, conn, err := startOrchestratorClient(ctx, orchestratorServer)
 	if err != nil {
 		return nil, err
 	}
@@ -171,12 +199,15 @@ func GetOrchestratorInfo(ctx context.Context, bcast Broadcaster, orchestratorSer
 	return r, nil
 }
 
-func startOrchestratorClient(uri *url.URL) (net.OrchestratorClient, *grpc.ClientConn, error) {
+// startOrchestratorClient connects to the orchestrator at uri, giving up
+// after GRPCConnectTimeout or once ctx is done
+func startOrchestratorClient(ctx context.Context, uri *url.URL) (net.OrchestratorClient, *grpc.ClientConn, error) {
 	glog.Infof("Connecting RPC to %v", uri)
-	conn, err := grpc.Dial(uri.Host,
+	ctx, cancel := context.WithTimeout(ctx, GRPCConnectTimeout)
+	defer cancel()
+	conn, err := grpc.DialContext(ctx, uri.Host,
 		grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig)),
-		grpc.WithBlock(),
-		grpc.WithTimeout(GRPCConnectTimeout))
+		grpc.WithBlock())
 	if err != nil {
 		glog.Error("Did not connect: ", err)
 		return nil, nil, errors.New("Did not connect: " + err.Error())
@@ -203,6 +234,8 @@ func getOrchestrator(orch Orchestrator, req *net.OrchestratorRequest) (*net.Orch
 	tr := net.OrchestratorInfo{
 		Transcoder:   orch.ServiceURI().String(), // currently,  orchestrator == transcoder
 		TicketParams: orch.TicketParams(addr),
+		Region:       OrchestratorRegion,
+		Capabilities: OrchestratorCapabilities,
 	}
 
 	storagePrefix := core.RandomManifestID()
@@ -210,6 +243,9 @@ func getOrchestrator(orch Orchestrator, req *net.OrchestratorRequest) (*net.Orch
 
 	if os != nil && os.IsExternal() {
 		tr.Storage = []*net.OSInfo{os.GetInfo()}
+	} else {
+		// without storage of our own, broadcasters send segments inline
+		tr.Storage = []*net.OSInfo{&net.OSInfo{StorageType: net.OSInfo_DIRECT}}
 	}
 
 	return &tr, nil
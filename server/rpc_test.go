@@ -7,6 +7,7 @@ import (
 	"errors"
 	"fmt"
 	"math/big"
+	gonet "net"
 	"net/url"
 	"testing"
 	"time"
@@ -386,6 +387,56 @@ func TestGetOrchestrator_GivenValidSig_ReturnsTranscoderURI(t *testing.T) {
 	assert.Equal(uri, oInfo.Transcoder)
 }
 
+func TestGetOrchestrator_AdvertisesRegion(t *testing.T) {
+	orch := &mockOrchestrator{}
+	drivers.NodeStorage = drivers.NewMemoryDriver(nil)
+	orch.On("VerifySig", mock.Anything, mock.Anything, mock.Anything).Return(true)
+	orch.On("ServiceURI").Return(url.Parse("http://someuri.com"))
+	orch.On("TicketParams", mock.Anything).Return(nil)
+	defer func(r string) { OrchestratorRegion = r }(OrchestratorRegion)
+	OrchestratorRegion = "eu-west"
+
+	oInfo, err := getOrchestrator(orch, &net.OrchestratorRequest{})
+
+	assert := assert.New(t)
+	assert.Nil(err)
+	assert.Equal("eu-west", oInfo.GetRegion())
+}
+
+func TestGetOrchestrator_AdvertisesCapabilities(t *testing.T) {
+	orch := &mockOrchestrator{}
+	drivers.NodeStorage = drivers.NewMemoryDriver(nil)
+	orch.On("VerifySig", mock.Anything, mock.Anything, mock.Anything).Return(true)
+	orch.On("ServiceURI").Return(url.Parse("http://someuri.com"))
+	orch.On("TicketParams", mock.Anything).Return(nil)
+	defer func(c []string) { OrchestratorCapabilities = c }(OrchestratorCapabilities)
+	OrchestratorCapabilities = []string{"hevc", "vp9"}
+
+	oInfo, err := getOrchestrator(orch, &net.OrchestratorRequest{})
+
+	assert := assert.New(t)
+	assert.Nil(err)
+	assert.Equal([]string{"hevc", "vp9"}, oInfo.GetCapabilities())
+}
+
+func TestGetOrchestrator_WithoutStorage_ExpectsDirectUpload(t *testing.T) {
+	orch := &mockOrchestrator{}
+	drivers.NodeStorage = drivers.NewMemoryDriver(nil)
+	orch.On("VerifySig", mock.Anything, mock.Anything, mock.Anything).Return(true)
+	orch.On("ServiceURI").Return(url.Parse("http://someuri.com"))
+	orch.On("TicketParams", mock.Anything).Return(nil)
+
+	oInfo, err := getOrchestrator(orch, &net.OrchestratorRequest{})
+
+	assert := assert.New(t)
+	assert.Nil(err)
+	assert.True((&BroadcastSession{OrchestratorInfo: oInfo}).expectsDirectUpload())
+	// broadcasters predating direct uploads find no storage to use
+	assert.Nil(drivers.NewSession(oInfo.Storage[0]))
+
+	assert.False((&BroadcastSession{OrchestratorInfo: &net.OrchestratorInfo{}}).expectsDirectUpload())
+}
+
 func TestGetOrchestrator_GivenInvalidSig_ReturnsError(t *testing.T) {
 	orch := &mockOrchestrator{}
 	drivers.NodeStorage = drivers.NewMemoryDriver(nil)
@@ -532,3 +583,28 @@ func defaultTicket(t *testing.T) *net.Ticket {
 		RecipientRandHash: pm.RandBytes(123),
 	}
 }
+
+func TestStartOrchestratorClient_Context(t *testing.T) {
+	// accepts connections but never completes the TLS handshake
+	lis, err := gonet.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	defer lis.Close()
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	// connecting gives up once the caller's context is done, well before
+	// the connect timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, _, err = startOrchestratorClient(ctx, &url.URL{Scheme: "https", Host: lis.Addr().String()})
+	assert.NotNil(t, err)
+	assert.True(t, time.Since(start) < GRPCConnectTimeout, "connecting ignored the context")
+}
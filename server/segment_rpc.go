@@ -2,6 +2,7 @@ package server
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
 	"encoding/base64"
 	"fmt"
@@ -16,6 +17,7 @@ import (
 	"github.com/livepeer/go-livepeer/monitor"
 	"github.com/livepeer/go-livepeer/net"
 	"github.com/livepeer/lpms/stream"
+	"go.opencensus.io/plugin/ochttp"
 	"golang.org/x/net/http2"
 
 	ethcommon "github.com/ethereum/go-ethereum/common"
@@ -34,12 +36,18 @@ var ErrSegSig = errors.New("ErrSegSig")
 
 var tlsConfig = &tls.Config{InsecureSkipVerify: true}
 var httpClient = &http.Client{
-	Transport: &http2.Transport{TLSClientConfig: tlsConfig},
-	Timeout:   HTTPTimeout,
+	Transport: &ochttp.Transport{
+		Base:        &http2.Transport{TLSClientConfig: tlsConfig},
+		Propagation: monitor.TracePropagation,
+	},
+	// requests are bounded by the deadline of their context instead, which
+	// depends on the length of the segment
 }
 
 func (h *lphttp) ServeSegment(w http.ResponseWriter, r *http.Request) {
 	orch := h.orchestrator
+	_, span := monitor.StartRemoteSpan(r, "ServeSegment")
+	defer span.End()
 
 	payment, err := getPayment(r.Header.Get(PaymentHeader))
 	if err != nil {
@@ -77,7 +85,8 @@ func (h *lphttp) ServeSegment(w http.ResponseWriter, r *http.Request) {
 		uri = string(data)
 		glog.V(common.DEBUG).Infof("Start getting segment from %s", uri)
 		start := time.Now()
-		data, err = drivers.GetSegmentData(uri)
+		// the broadcaster stops waiting once its deadline for the segment passes
+		data, err = drivers.GetSegmentDataContext(r.Context(), uri)
 		took := time.Since(start)
 		glog.V(common.DEBUG).Infof("Getting segment from %s took %s", uri, took)
 		if err != nil {
@@ -99,6 +108,9 @@ func (h *lphttp) ServeSegment(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Forbidden", http.StatusForbidden)
 		return
 	}
+	if monitor.Enabled {
+		monitor.LogOrchSegmentReceived()
+	}
 
 	// Send down 200OK early as an indication that the upload completed
 	// Any further errors come through the response body
@@ -220,7 +232,15 @@ func verifySegCreds(orch Orchestrator, segCreds string, broadcaster ethcommon.Ad
 	return md, nil
 }
 
-func SubmitSegment(sess *BroadcastSession, seg *stream.HLSSegment, nonce uint64) (*net.TranscodeData, error) {
+func SubmitSegment(ctx context.Context, sess *BroadcastSession, seg *stream.HLSSegment, nonce uint64) (*net.TranscodeData, error) {
+	ctx, span := monitor.StartSegmentSpan(ctx, "SubmitSegment", nonce, seg.SeqNo)
+	defer span.End()
+	if _, ok := ctx.Deadline(); !ok {
+		// longer segments take longer to upload and transcode
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, segmentTimeout(segDuration(seg)))
+		defer cancel()
+	}
 	if monitor.Enabled {
 		monitor.SegmentUploadStart(nonce, seg.SeqNo)
 	}
@@ -244,6 +264,9 @@ func SubmitSegment(sess *BroadcastSession, seg *stream.HLSSegment, nonce uint64)
 	}
 
 	ti := sess.OrchestratorInfo
+	if monitor.Enabled {
+		monitor.LogStreamSession(nonce, ti.Transcoder, sess.PMSessionID)
+	}
 	req, err := http.NewRequest("POST", ti.Transcoder+"/segment", bytes.NewBuffer(data))
 	if err != nil {
 		glog.Error("Could not generate trascode request to ", ti.Transcoder)
@@ -252,6 +275,7 @@ func SubmitSegment(sess *BroadcastSession, seg *stream.HLSSegment, nonce uint64)
 		}
 		return nil, err
 	}
+	req = req.WithContext(ctx)
 
 	req.Header.Set(SegmentHeader, segCreds)
 	req.Header.Set(PaymentHeader, payment)
@@ -265,10 +289,16 @@ func SubmitSegment(sess *BroadcastSession, seg *stream.HLSSegment, nonce uint64)
 	start := time.Now()
 	resp, err := httpClient.Do(req)
 	uploadDur := time.Since(start)
+	if err != nil && ctx.Err() == context.Canceled {
+		// another orchestrator returned the segment first
+		glog.V(common.DEBUG).Infof("Submission of segment %v to %v cancelled", seg.SeqNo, ti.Transcoder)
+		return nil, ctx.Err()
+	}
 	if err != nil {
 		glog.Error("Unable to submit segment ", seg.SeqNo, err)
 		if monitor.Enabled {
 			monitor.LogSegmentUploadFailed(nonce, seg.SeqNo, monitor.SegmentUploadErrorUnknown, err.Error())
+			monitor.LogOrchestratorFailed(ti.Transcoder, string(monitor.SegmentUploadErrorUnknown))
 		}
 		return nil, err
 	}
@@ -281,21 +311,29 @@ func SubmitSegment(sess *BroadcastSession, seg *stream.HLSSegment, nonce uint64)
 		if monitor.Enabled {
 			monitor.LogSegmentUploadFailed(nonce, seg.SeqNo, monitor.SegmentUploadError(resp.Status),
 				fmt.Sprintf("Code: %d Error: %s", resp.StatusCode, errorString))
+			monitor.LogOrchestratorFailed(ti.Transcoder, resp.Status)
 		}
 		return nil, fmt.Errorf(errorString)
 	}
 	glog.Infof("Uploaded segment %v", seg.SeqNo)
 	if monitor.Enabled {
 		monitor.LogSegmentUploaded(nonce, seg.SeqNo, uploadDur)
+		monitor.LogOrchestratorUploaded(ti.Transcoder, uploadDur)
+		monitor.LogBytesTransferred(monitor.BytesEgressOrchestrator, nonce, int64(len(data)))
 	}
 
 	data, err = ioutil.ReadAll(resp.Body)
 	tookAllDur := time.Since(start)
 
+	if err != nil && ctx.Err() == context.Canceled {
+		glog.V(common.DEBUG).Infof("Submission of segment %v to %v cancelled", seg.SeqNo, ti.Transcoder)
+		return nil, ctx.Err()
+	}
 	if err != nil {
 		glog.Error(fmt.Sprintf("Unable to read response body for segment %v : %v", seg.SeqNo, err))
 		if monitor.Enabled {
 			monitor.LogSegmentTranscodeFailed(monitor.SegmentTranscodeErrorReadBody, nonce, seg.SeqNo, err)
+			monitor.LogOrchestratorFailed(ti.Transcoder, string(monitor.SegmentTranscodeErrorReadBody))
 		}
 		return nil, err
 	}
@@ -307,6 +345,7 @@ func SubmitSegment(sess *BroadcastSession, seg *stream.HLSSegment, nonce uint64)
 		glog.Error(fmt.Sprintf("Unable to parse response for segment %v : %v", seg.SeqNo, err))
 		if monitor.Enabled {
 			monitor.LogSegmentTranscodeFailed(monitor.SegmentTranscodeErrorParseResponse, nonce, seg.SeqNo, err)
+			monitor.LogOrchestratorFailed(ti.Transcoder, string(monitor.SegmentTranscodeErrorParseResponse))
 		}
 		return nil, err
 	}
@@ -321,14 +360,15 @@ func SubmitSegment(sess *BroadcastSession, seg *stream.HLSSegment, nonce uint64)
 			glog.Info("Ensure the keyframe interval is 4 seconds or less")
 		}
 		if monitor.Enabled {
+			code := monitor.SegmentTranscodeErrorTranscode
 			switch res.Error {
 			case "OrchestratorBusy":
-				monitor.LogSegmentTranscodeFailed(monitor.SegmentTranscodeErrorOrchestratorBusy, nonce, seg.SeqNo, err)
+				code = monitor.SegmentTranscodeErrorOrchestratorBusy
 			case "OrchestratorCapped":
-				monitor.LogSegmentTranscodeFailed(monitor.SegmentTranscodeErrorOrchestratorCapped, nonce, seg.SeqNo, err)
-			default:
-				monitor.LogSegmentTranscodeFailed(monitor.SegmentTranscodeErrorTranscode, nonce, seg.SeqNo, err)
+				code = monitor.SegmentTranscodeErrorOrchestratorCapped
 			}
+			monitor.LogSegmentTranscodeFailed(code, nonce, seg.SeqNo, err)
+			monitor.LogOrchestratorFailed(ti.Transcoder, string(code))
 		}
 		return nil, err
 	case *net.TranscodeResult_Data:
@@ -339,6 +379,7 @@ func SubmitSegment(sess *BroadcastSession, seg *stream.HLSSegment, nonce uint64)
 		err = fmt.Errorf("UnknownResponse")
 		if monitor.Enabled {
 			monitor.LogSegmentTranscodeFailed(monitor.SegmentTranscodeErrorUnknownResponse, nonce, seg.SeqNo, err)
+			monitor.LogOrchestratorFailed(ti.Transcoder, string(monitor.SegmentTranscodeErrorUnknownResponse))
 		}
 		return nil, err
 	}
@@ -346,6 +387,7 @@ func SubmitSegment(sess *BroadcastSession, seg *stream.HLSSegment, nonce uint64)
 	// transcode succeeded; continue processing response
 	if monitor.Enabled {
 		monitor.LogSegmentTranscoded(nonce, seg.SeqNo, transcodeDur, tookAllDur, common.ProfilesNames(sess.Profiles))
+		monitor.LogOrchestratorTranscoded(ti.Transcoder, tookAllDur)
 	}
 
 	glog.Info("Successfully transcoded segment ", seg.SeqNo)
@@ -400,6 +442,9 @@ func genPayment(sess *BroadcastSession) (string, error) {
 	if err != nil {
 		return "", err
 	}
+	if monitor.Enabled {
+		monitor.LogTicketSent(sess.PMSessionID, ticket.Recipient.Hex(), ticket.FaceValue)
+	}
 
 	protoTicket := &net.Ticket{
 		Recipient:         ticket.Recipient.Bytes(),
@@ -2,13 +2,16 @@ package server
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
 	"errors"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	ethcommon "github.com/ethereum/go-ethereum/common"
 	"github.com/golang/protobuf/proto"
@@ -356,7 +359,7 @@ func TestSubmitSegment_GenSegCredsError(t *testing.T) {
 		ManifestID:  core.RandomManifestID(),
 	}
 
-	_, err := SubmitSegment(s, &stream.HLSSegment{}, 0)
+	_, err := SubmitSegment(context.Background(), s, &stream.HLSSegment{}, 0)
 
 	assert.Equal(t, "Sign error", err.Error())
 }
@@ -370,7 +373,7 @@ func TestSubmitSegment_HttpPostError(t *testing.T) {
 		},
 	}
 
-	_, err := SubmitSegment(s, &stream.HLSSegment{}, 0)
+	_, err := SubmitSegment(context.Background(), s, &stream.HLSSegment{}, 0)
 
 	assert.Contains(t, err.Error(), "connection refused")
 }
@@ -390,11 +393,280 @@ func TestSubmitSegment_Non200StatusCode(t *testing.T) {
 		},
 	}
 
-	_, err := SubmitSegment(s, &stream.HLSSegment{}, 0)
+	_, err := SubmitSegment(context.Background(), s, &stream.HLSSegment{}, 0)
 
 	assert.Equal(t, "Server error", err.Error())
 }
 
+func TestSubmitSegment_Timeout(t *testing.T) {
+	defer func(m float64) { SegmentTimeoutMultiplier = m }(SegmentTimeoutMultiplier)
+	SegmentTimeoutMultiplier = 1
+
+	ts, mux := stubTLSServer()
+	defer ts.Close()
+	release := make(chan struct{})
+	defer close(release)
+	mux.HandleFunc("/segment", func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	})
+
+	s := &BroadcastSession{
+		Broadcaster: StubBroadcaster2(),
+		ManifestID:  core.RandomManifestID(),
+		OrchestratorInfo: &net.OrchestratorInfo{
+			Transcoder: ts.URL,
+		},
+	}
+
+	// the deadline follows the segment duration
+	start := time.Now()
+	_, err := SubmitSegment(context.Background(), s, &stream.HLSSegment{Duration: 0.1}, 0)
+	assert.NotNil(t, err)
+	assert.True(t, time.Since(start) < time.Second)
+
+	// deadlines set by the caller take precedence
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start = time.Now()
+	_, err = SubmitSegment(ctx, s, &stream.HLSSegment{Duration: 10}, 0)
+	assert.NotNil(t, err)
+	assert.True(t, time.Since(start) < time.Second)
+}
+
+func TestSubmitSegmentWithRetries(t *testing.T) {
+	defer func(n int) { MaxSegmentRetries = n }(MaxSegmentRetries)
+	MaxSegmentRetries = 2
+
+	ts, mux := stubTLSServer()
+	defer ts.Close()
+	var calls int32
+	mux.HandleFunc("/segment", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		http.Error(w, "Server error", http.StatusInternalServerError)
+	})
+
+	s := &BroadcastSession{
+		Broadcaster: StubBroadcaster2(),
+		ManifestID:  core.RandomManifestID(),
+		OrchestratorInfo: &net.OrchestratorInfo{
+			Transcoder: ts.URL,
+		},
+	}
+
+	_, err := submitSegmentWithRetries(context.Background(), s, &stream.HLSSegment{}, 0, time.Now())
+
+	assert.Equal(t, "Server error", err.Error())
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+	assert.Equal(t, int64(0), atomic.LoadInt64(&retryBacklog))
+}
+
+func TestSubmitSegmentWithRetries_Deadline(t *testing.T) {
+	defer func(n int, d time.Duration) { MaxSegmentRetries, SegmentRetryDeadline = n, d }(MaxSegmentRetries, SegmentRetryDeadline)
+	MaxSegmentRetries = 10
+	SegmentRetryDeadline = time.Second
+
+	ts, mux := stubTLSServer()
+	defer ts.Close()
+	var calls int32
+	mux.HandleFunc("/segment", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		http.Error(w, "Server error", http.StatusInternalServerError)
+	})
+
+	s := &BroadcastSession{
+		Broadcaster: StubBroadcaster2(),
+		ManifestID:  core.RandomManifestID(),
+		OrchestratorInfo: &net.OrchestratorInfo{
+			Transcoder: ts.URL,
+		},
+	}
+
+	// segments past their deadline aren't resubmitted
+	_, err := submitSegmentWithRetries(context.Background(), s, &stream.HLSSegment{}, 0, time.Now().Add(-time.Minute))
+	assert.Equal(t, "Server error", err.Error())
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+
+	// retries stop at the deadline even if attempts are left
+	start := time.Now()
+	_, err = submitSegmentWithRetries(context.Background(), s, &stream.HLSSegment{}, 0, start)
+	assert.Equal(t, "Server error", err.Error())
+	assert.True(t, time.Since(start) < time.Second+SegmentRetryMaxBackoff)
+	assert.True(t, atomic.LoadInt32(&calls) < 12)
+	assert.Equal(t, int64(0), atomic.LoadInt64(&retryBacklog))
+}
+
+func TestSubmitSegmentRedundant(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	tr := &net.TranscodeResult{
+		Result: &net.TranscodeResult_Data{
+			Data: &net.TranscodeData{
+				Segments: []*net.TranscodedSegmentData{
+					&net.TranscodedSegmentData{Url: "foo"},
+				},
+			},
+		},
+	}
+	buf, err := proto.Marshal(tr)
+	require.Nil(err)
+
+	// slow orchestrator that sees the cancellation of its submission
+	slow, slowMux := stubTLSServer()
+	defer slow.Close()
+	cancelled := make(chan struct{})
+	slowMux.HandleFunc("/segment", func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+			close(cancelled)
+		case <-time.After(5 * time.Second):
+		}
+	})
+	fast, fastMux := stubTLSServer()
+	defer fast.Close()
+	var uploaded string
+	fastMux.HandleFunc("/segment", func(w http.ResponseWriter, r *http.Request) {
+		uploaded = r.Header.Get("Content-Type")
+		w.WriteHeader(http.StatusOK)
+		w.Write(buf)
+	})
+	failing, failingMux := stubTLSServer()
+	defer failing.Close()
+	failingMux.HandleFunc("/segment", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Server error", http.StatusInternalServerError)
+	})
+
+	newSess := func(url string) *BroadcastSession {
+		return &BroadcastSession{
+			Broadcaster:      StubBroadcaster2(),
+			ManifestID:       core.RandomManifestID(),
+			OrchestratorInfo: &net.OrchestratorInfo{Transcoder: url},
+		}
+	}
+	seg := &stream.HLSSegment{Name: "https://primary/storage/0.ts", Data: []byte("data")}
+
+	sessions := []*BroadcastSession{newSess(slow.URL), newSess(failing.URL), newSess(fast.URL)}
+	sess, res, err := submitSegmentRedundant(context.Background(), sessions, seg, 0, time.Now())
+	require.Nil(err)
+	assert.Equal(fast.URL, sess.OrchestratorInfo.Transcoder)
+	assert.Equal("foo", res.Segments[0].Url)
+	// only the primary orchestrator is sent the uploaded URI
+	assert.Equal("video/MP2T", uploaded)
+	assert.Equal("https://primary/storage/0.ts", seg.Name)
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Error("Expected the slow submission to be cancelled")
+	}
+
+	// the error of the primary session is returned if all fail
+	sessions = []*BroadcastSession{newSess(failing.URL), newSess(failing.URL)}
+	sess, res, err = submitSegmentRedundant(context.Background(), sessions, seg, 0, time.Now())
+	assert.Equal(sessions[0], sess)
+	assert.Nil(res)
+	assert.Equal("Server error", err.Error())
+}
+
+func TestSubmitSegmentCompared(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	// orchestrator returning a rendition with the given contents, served by
+	// the orchestrator itself or at renditionURL if set
+	var calls int32
+	var orchs []*httptest.Server
+	defer func() {
+		for _, ts := range orchs {
+			ts.Close()
+		}
+	}()
+	newSessAt := func(rendition, renditionURL string) *BroadcastSession {
+		ts, mux := stubTLSServer()
+		orchs = append(orchs, ts)
+		if renditionURL == "" {
+			renditionURL = ts.URL + "/rendition"
+		}
+		tr := &net.TranscodeResult{
+			Result: &net.TranscodeResult_Data{
+				Data: &net.TranscodeData{
+					Segments: []*net.TranscodedSegmentData{
+						&net.TranscodedSegmentData{Url: renditionURL},
+					},
+				},
+			},
+		}
+		buf, err := proto.Marshal(tr)
+		require.Nil(err)
+		mux.HandleFunc("/rendition", func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(rendition))
+		})
+		mux.HandleFunc("/segment", func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&calls, 1)
+			w.WriteHeader(http.StatusOK)
+			w.Write(buf)
+		})
+		return &BroadcastSession{
+			Broadcaster:      StubBroadcaster2(),
+			ManifestID:       core.RandomManifestID(),
+			OrchestratorInfo: &net.OrchestratorInfo{Transcoder: ts.URL},
+		}
+	}
+	newSess := func(rendition string) *BroadcastSession { return newSessAt(rendition, "") }
+	seg := &stream.HLSSegment{Data: []byte("data")}
+
+	// identical renditions from the first two orchestrators
+	sessions := []*BroadcastSession{newSess("good"), newSess("good"), newSess("good")}
+	sess, res, data, err := submitSegmentCompared(context.Background(), sessions, seg, 0, time.Now())
+	require.Nil(err)
+	assert.Contains(sessions[:2], sess)
+	assert.Equal(sess.OrchestratorInfo.Transcoder+"/rendition", res.Segments[0].Url)
+	assert.Equal([][]byte{[]byte("good")}, data, "the hashed renditions are passed on")
+	assert.Equal(int32(2), atomic.LoadInt32(&calls), "no tie break needed")
+
+	// a third orchestrator breaks the tie, and the odd one out is suspended
+	bad := newSess("bad")
+	defer UnsuspendOrchestrator(bad.OrchestratorInfo.Transcoder)
+	sessions = []*BroadcastSession{bad, newSess("good"), newSess("good")}
+	sess, res, data, err = submitSegmentCompared(context.Background(), sessions, seg, 0, time.Now())
+	require.Nil(err)
+	assert.Contains(sessions[1:], sess)
+	assert.Equal([][]byte{[]byte("good")}, data)
+	assert.True(orchSuspensions.isSuspended(bad.OrchestratorInfo.Transcoder))
+
+	// no two orchestrators agree
+	sessions = []*BroadcastSession{newSess("bad"), newSess("good")}
+	sess, res, data, err = submitSegmentCompared(context.Background(), sessions, seg, 0, time.Now())
+	assert.Equal(sessions[0], sess)
+	assert.Nil(res)
+	assert.Nil(data)
+	assert.Equal(ErrRenditionMismatch, err)
+
+	// renditions hosted elsewhere than the orchestrator aren't fetched
+	other := newSess("good")
+	sessions = []*BroadcastSession{newSessAt("good", other.OrchestratorInfo.Transcoder+"/rendition"), newSess("good")}
+	_, res, _, err = submitSegmentCompared(context.Background(), sessions, seg, 0, time.Now())
+	assert.Nil(res)
+	assert.Equal(drivers.ErrSegmentURLInternal, err)
+}
+
+func TestRetryWait(t *testing.T) {
+	defer func(b, m time.Duration) { SegmentRetryBackoff, SegmentRetryMaxBackoff = b, m }(SegmentRetryBackoff, SegmentRetryMaxBackoff)
+	SegmentRetryBackoff = 100 * time.Millisecond
+	SegmentRetryMaxBackoff = 300 * time.Millisecond
+
+	for i := 0; i < 20; i++ {
+		assert.True(t, retryWait(0) <= 100*time.Millisecond)
+		assert.True(t, retryWait(1) <= 200*time.Millisecond)
+		assert.True(t, retryWait(5) <= 300*time.Millisecond)
+		assert.True(t, retryWait(100) <= 300*time.Millisecond)
+	}
+	SegmentRetryMaxBackoff = 0
+	assert.Equal(t, time.Duration(0), retryWait(1))
+}
+
 func TestSubmitSegment_ProtoUnmarshalError(t *testing.T) {
 	ts, mux := stubTLSServer()
 	defer ts.Close()
@@ -411,7 +683,7 @@ func TestSubmitSegment_ProtoUnmarshalError(t *testing.T) {
 		},
 	}
 
-	_, err := SubmitSegment(s, &stream.HLSSegment{}, 0)
+	_, err := SubmitSegment(context.Background(), s, &stream.HLSSegment{}, 0)
 
 	assert.Contains(t, err.Error(), "proto")
 }
@@ -438,7 +710,7 @@ func TestSubmitSegment_TranscodeResultError(t *testing.T) {
 		},
 	}
 
-	_, err = SubmitSegment(s, &stream.HLSSegment{}, 0)
+	_, err = SubmitSegment(context.Background(), s, &stream.HLSSegment{}, 0)
 
 	assert.Equal(t, "TranscodeResult error", err.Error())
 }
@@ -491,7 +763,7 @@ func TestSubmitSegment_Success(t *testing.T) {
 		assert.Equal([]byte("dummy"), data)
 	}
 
-	tdata, err := SubmitSegment(s, &stream.HLSSegment{Data: []byte("dummy")}, 0)
+	tdata, err := SubmitSegment(context.Background(), s, &stream.HLSSegment{Data: []byte("dummy")}, 0)
 
 	assert.Nil(err)
 	assert.Equal(1, len(tdata.Segments))
@@ -508,7 +780,7 @@ func TestSubmitSegment_Success(t *testing.T) {
 		assert.Equal([]byte("foo"), data)
 	}
 
-	SubmitSegment(s, &stream.HLSSegment{Name: "foo", Data: []byte("dummy")}, 0)
+	SubmitSegment(context.Background(), s, &stream.HLSSegment{Name: "foo", Data: []byte("dummy")}, 0)
 }
 
 func stubTLSServer() (*httptest.Server, *http.ServeMux) {
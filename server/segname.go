@@ -0,0 +1,50 @@
+package server
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// ContentAddressedSegments names the segments broadcasters save to object
+// storage after the Keccak hash of their data rather than their sequence
+// number, as in profile/<hash>.ts, so that saving the same data again reuses
+// the stored object. The hash is the one orchestrators sign renditions with.
+var ContentAddressedSegments = false
+
+// ErrSegmentHash is returned when the data of a content addressed segment
+// doesn't match the hash it is named after
+var ErrSegmentHash = errors.New("ErrSegmentHash")
+
+// segmentName is the name the data of a segment of the given rendition is
+// saved to object storage under
+func segmentName(rendition string, seqNo uint64, data []byte) string {
+	if ContentAddressedSegments {
+		return fmt.Sprintf("%s/%x.ts", rendition, crypto.Keccak256(data))
+	}
+	return fmt.Sprintf("%s/%d.ts", rendition, seqNo)
+}
+
+// checkSegmentHash returns ErrSegmentHash if uri names a content addressed
+// segment whose hash doesn't match data. Segments named otherwise pass.
+func checkSegmentHash(uri string, data []byte) error {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil
+	}
+	name := strings.TrimSuffix(path.Base(u.Path), ".ts")
+	hash, err := hex.DecodeString(name)
+	if err != nil || len(hash) != 32 {
+		return nil
+	}
+	if !bytes.Equal(hash, crypto.Keccak256(data)) {
+		return ErrSegmentHash
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package server
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSegmentName(t *testing.T) {
+	assert := assert.New(t)
+	data := []byte("segment")
+	assert.Equal("source/5.ts", segmentName("source", 5, data))
+
+	defer func(c bool) { ContentAddressedSegments = c }(ContentAddressedSegments)
+	ContentAddressedSegments = true
+	hashed := fmt.Sprintf("source/%x.ts", crypto.Keccak256(data))
+	assert.Equal(hashed, segmentName("source", 5, data))
+	// the same data is saved under the same name
+	assert.Equal(hashed, segmentName("source", 6, data))
+	assert.NotEqual(hashed, segmentName("source", 5, []byte("other")))
+}
+
+func TestCheckSegmentHash(t *testing.T) {
+	assert := assert.New(t)
+	data := []byte("segment")
+	hash := fmt.Sprintf("%x", crypto.Keccak256(data))
+
+	assert.Nil(checkSegmentHash("https://os/mid/source/"+hash+".ts", data))
+	assert.Nil(checkSegmentHash("https://os/mid/source/"+hash+".ts?sig=abc", data))
+	assert.Equal(ErrSegmentHash, checkSegmentHash("https://os/mid/source/"+hash+".ts", []byte("tampered")))
+	// segments not named by hash can't be checked
+	assert.Nil(checkSegmentHash("https://os/mid/source/5.ts", data))
+	assert.Nil(checkSegmentHash("/stream/mid/source/abc.ts", data))
+}
@@ -0,0 +1,337 @@
+package server
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/golang/glog"
+	"github.com/livepeer/go-livepeer/common"
+	"github.com/livepeer/go-livepeer/monitor"
+	"github.com/livepeer/go-livepeer/net"
+)
+
+// SelectionStrategy picks the orchestrator for a new broadcast session out of
+// the non-suspended orchestrators returned by discovery
+type SelectionStrategy interface {
+	// Candidates is the number of orchestrators to ask discovery for
+	Candidates() int
+	// Select returns one of orchs, which is never empty
+	Select(orchs []*net.OrchestratorInfo) *net.OrchestratorInfo
+}
+
+// OrchSelection is the strategy used to select orchestrators. Defaults to
+// the first orchestrator to respond to discovery.
+var OrchSelection SelectionStrategy = firstSelection{}
+
+// Number of orchestrators strategies other than the default choose between
+var SelectionCandidates = 5
+
+// NewSelectionStrategy returns the named strategy: first, roundrobin,
+// latency, price, score or stake. stake looks up the stake of an orchestrator and
+// is only used by the stake strategy.
+func NewSelectionStrategy(name string, stake func(ethcommon.Address) (*big.Int, error)) (SelectionStrategy, error) {
+	switch name {
+	case "first", "":
+		return firstSelection{}, nil
+	case "roundrobin":
+		return &roundRobinSelection{lastSelected: make(map[string]time.Time)}, nil
+	case "latency":
+		return latencySelection{}, nil
+	case "price":
+		return priceSelection{}, nil
+	case "score":
+		return scoreSelection{}, nil
+	case "stake":
+		if stake == nil {
+			return nil, fmt.Errorf("stake selection requires an on-chain node")
+		}
+		return &stakeSelection{stake: stake, rand: rand.New(rand.NewSource(time.Now().UnixNano()))}, nil
+	}
+	return nil, fmt.Errorf("unknown selection strategy %q; expected first, roundrobin, latency, price, score or stake", name)
+}
+
+// firstSelection picks the first orchestrator to respond
+type firstSelection struct{}
+
+func (firstSelection) Candidates() int { return 1 }
+
+func (firstSelection) Select(orchs []*net.OrchestratorInfo) *net.OrchestratorInfo {
+	return orchs[0]
+}
+
+// roundRobinSelection picks the orchestrator it least recently selected.
+// Discovery returns whoever responds first, so candidates are rotated by
+// when they were last picked rather than by their position.
+type roundRobinSelection struct {
+	lock         sync.Mutex
+	lastSelected map[string]time.Time // orchestrator : last selected at
+}
+
+func (s *roundRobinSelection) Candidates() int { return SelectionCandidates }
+
+func (s *roundRobinSelection) Select(orchs []*net.OrchestratorInfo) *net.OrchestratorInfo {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	best := orchs[0]
+	for _, o := range orchs[1:] {
+		if s.lastSelected[o.GetTranscoder()].Before(s.lastSelected[best.GetTranscoder()]) {
+			best = o
+		}
+	}
+	s.lastSelected[best.GetTranscoder()] = time.Now()
+	return best
+}
+
+// latencySelection picks the orchestrator with the lowest average segment
+// round trip time. Orchestrators without segment stats are ranked by their
+// ping, if they were probed; otherwise they are tried first so they get some.
+// Those that failed every segment are tried last.
+type latencySelection struct{}
+
+func (latencySelection) Candidates() int { return SelectionCandidates }
+
+func (latencySelection) Select(orchs []*net.OrchestratorInfo) *net.OrchestratorInfo {
+	best := orchs[0]
+	bestLatency := observedLatency(best)
+	for _, o := range orchs[1:] {
+		if l := observedLatency(o); l < bestLatency {
+			best, bestLatency = o, l
+		}
+	}
+	return best
+}
+
+func observedLatency(o *net.OrchestratorInfo) time.Duration {
+	perf := orchPerf.get(o.GetTranscoder())
+	if perf.Segments > 0 && perf.Failures == perf.Segments {
+		return time.Duration(math.MaxInt64)
+	}
+	if perf.Segments == 0 {
+		return perf.Ping
+	}
+	return perf.Latency
+}
+
+// priceSelection picks the orchestrator with the lowest expected value per
+// ticket. Orchestrators that don't ask for payment are free.
+type priceSelection struct{}
+
+func (priceSelection) Candidates() int { return SelectionCandidates }
+
+func (priceSelection) Select(orchs []*net.OrchestratorInfo) *net.OrchestratorInfo {
+	best := orchs[0]
+	bestPrice := ticketEV(best)
+	for _, o := range orchs[1:] {
+		if p := ticketEV(o); p.Cmp(bestPrice) < 0 {
+			best, bestPrice = o, p
+		}
+	}
+	return best
+}
+
+var maxWinProb = new(big.Int).Lsh(big.NewInt(1), 256)
+
+// ticketEV is the expected value of a ticket: faceValue * winProb / 2^256
+func ticketEV(o *net.OrchestratorInfo) *big.Rat {
+	params := o.GetTicketParams()
+	if params == nil {
+		return new(big.Rat)
+	}
+	ev := new(big.Int).Mul(new(big.Int).SetBytes(params.FaceValue), new(big.Int).SetBytes(params.WinProb))
+	return new(big.Rat).SetFrac(ev, maxWinProb)
+}
+
+// discoveryConstraints are the constraints discovery is asked to meet by the
+// orchestrators it returns
+func discoveryConstraints() *net.OrchestratorConstraints {
+	return &net.OrchestratorConstraints{MaxPrice: BroadcastPrice, Capabilities: RequiredCapabilities}
+}
+
+// overPriced reports whether the orchestrator asks more per segment than
+// BroadcastPrice
+func overPriced(o *net.OrchestratorInfo) bool {
+	max := BroadcastPrice
+	if max == nil || max.Sign() <= 0 {
+		return false
+	}
+	if ticketEV(o).Cmp(new(big.Rat).SetInt(max)) <= 0 {
+		return false
+	}
+	glog.V(common.DEBUG).Infof("Skipping orchestrator=%s asking price=%v above max=%v", o.GetTranscoder(), ticketEV(o).FloatString(3), max)
+	if monitor.Enabled {
+		monitor.LogOrchestratorOverPriced(o.GetTranscoder())
+	}
+	return true
+}
+
+// How long the stake of an orchestrator is cached for by the stake strategy
+var StakeCacheTTL = 10 * time.Minute
+
+// stakeSelection picks a random orchestrator weighted by its stake. If no
+// candidate has a known stake, it picks uniformly at random. Stakes are cached
+// for StakeCacheTTL so that selection doesn't wait on the chain for every
+// candidate of every new session.
+type stakeSelection struct {
+	stake func(ethcommon.Address) (*big.Int, error)
+
+	lock   sync.Mutex
+	rand   *rand.Rand
+	stakes map[ethcommon.Address]cachedStake
+}
+
+type cachedStake struct {
+	stake     *big.Int
+	fetchedAt time.Time
+}
+
+func (s *stakeSelection) Candidates() int { return SelectionCandidates }
+
+// cachedStake returns the stake of addr, looking it up if it isn't cached or
+// has expired. Failed lookups aren't cached.
+func (s *stakeSelection) cachedStake(addr ethcommon.Address) (*big.Int, error) {
+	s.lock.Lock()
+	c, ok := s.stakes[addr]
+	s.lock.Unlock()
+	if ok && time.Since(c.fetchedAt) < StakeCacheTTL {
+		return c.stake, nil
+	}
+	stake, err := s.stake(addr)
+	if err != nil {
+		return nil, err
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.stakes == nil {
+		s.stakes = make(map[ethcommon.Address]cachedStake)
+	}
+	s.stakes[addr] = cachedStake{stake: stake, fetchedAt: time.Now()}
+	return stake, nil
+}
+
+func (s *stakeSelection) Select(orchs []*net.OrchestratorInfo) *net.OrchestratorInfo {
+	weights := make([]*big.Int, len(orchs))
+	total := new(big.Int)
+	for i, o := range orchs {
+		weights[i] = new(big.Int)
+		if params := o.GetTicketParams(); params != nil {
+			stake, err := s.cachedStake(ethcommon.BytesToAddress(params.Recipient))
+			if err != nil {
+				glog.Errorf("Error getting stake of orchestrator=%s err=%v", o.GetTranscoder(), err)
+			} else if stake != nil && stake.Sign() > 0 {
+				weights[i] = stake
+			}
+		}
+		total.Add(total, weights[i])
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if total.Sign() == 0 {
+		return orchs[s.rand.Intn(len(orchs))]
+	}
+	r := new(big.Int).Rand(s.rand, total)
+	for i, w := range weights {
+		if r.Cmp(w) < 0 {
+			return orchs[i]
+		}
+		r.Sub(r, w)
+	}
+	return orchs[len(orchs)-1]
+}
+
+// orchestratorPerf holds the performance of an orchestrator as observed by
+// the segments submitted to it
+type orchestratorPerf struct {
+	Segments int           // segments submitted
+	Failures int           // segments that failed to transcode
+	Latency  time.Duration // average round trip time of successful segments
+	P50, P95 time.Duration // round trip time percentiles of recent segments
+	Price    *big.Rat      // last seen expected value of a ticket
+	Ping     time.Duration // round trip time of the last ping
+
+	latencies    []time.Duration // ring of the most recent round trip times
+	next         int
+	dirty        bool // changed since last persisted
+	priceChanged bool
+}
+
+// Number of most recent round trip times latency percentiles are taken over
+const perfLatencySamples = 100
+
+// orchPerf holds the performance stats of the orchestrators this node has
+// submitted segments to, keyed on the orchestrator's transcoder URI. It is
+// seeded from the node DB so new streams can use what was learnt by earlier
+// ones.
+var orchPerf = &perfList{perf: make(map[string]*orchestratorPerf)}
+
+type perfList struct {
+	lock sync.Mutex
+	perf map[string]*orchestratorPerf
+}
+
+func (p *perfList) getOrCreate(addr string) *orchestratorPerf {
+	perf, ok := p.perf[addr]
+	if !ok {
+		perf = &orchestratorPerf{}
+		p.perf[addr] = perf
+	}
+	return perf
+}
+
+// record adds a submitted segment to the stats of orchestrator addr
+func (p *perfList) record(addr string, latency time.Duration, err error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	perf := p.getOrCreate(addr)
+	perf.Segments++
+	perf.dirty = true
+	if err != nil {
+		perf.Failures++
+		return
+	}
+	succeeded := perf.Segments - perf.Failures
+	perf.Latency += (latency - perf.Latency) / time.Duration(succeeded)
+	if len(perf.latencies) < perfLatencySamples {
+		perf.latencies = append(perf.latencies, latency)
+	} else {
+		perf.latencies[perf.next] = latency
+		perf.next = (perf.next + 1) % perfLatencySamples
+	}
+	sorted := append([]time.Duration(nil), perf.latencies...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	perf.P50 = sorted[(len(sorted)-1)/2]
+	perf.P95 = sorted[(len(sorted)-1)*95/100]
+}
+
+// recordPing remembers the round trip time of a ping to orchestrator addr
+func (p *perfList) recordPing(addr string, rtt time.Duration) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.getOrCreate(addr).Ping = rtt
+}
+
+// recordPrice remembers the price orchestrator addr asks for
+func (p *perfList) recordPrice(addr string, price *big.Rat) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	perf := p.getOrCreate(addr)
+	if perf.Price == nil || perf.Price.Cmp(price) != 0 {
+		perf.Price = price
+		perf.priceChanged = true
+	}
+}
+
+func (p *perfList) get(addr string) orchestratorPerf {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if perf, ok := p.perf[addr]; ok {
+		return *perf
+	}
+	return orchestratorPerf{}
+}
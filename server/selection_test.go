@@ -0,0 +1,297 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+
+	ethcommon "github.com/ethereum/go-ethereum/common"
+	"github.com/livepeer/go-livepeer/core"
+	"github.com/livepeer/go-livepeer/drivers"
+	"github.com/livepeer/go-livepeer/net"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func selectionOrchs() []*net.OrchestratorInfo {
+	return []*net.OrchestratorInfo{
+		&net.OrchestratorInfo{Transcoder: "https://a:8935", TicketParams: &net.TicketParams{Recipient: []byte{1}, FaceValue: big.NewInt(100).Bytes(), WinProb: big.NewInt(10).Bytes()}},
+		&net.OrchestratorInfo{Transcoder: "https://b:8935", TicketParams: &net.TicketParams{Recipient: []byte{2}, FaceValue: big.NewInt(300).Bytes(), WinProb: big.NewInt(2).Bytes()}},
+		&net.OrchestratorInfo{Transcoder: "https://c:8935", TicketParams: &net.TicketParams{Recipient: []byte{3}, FaceValue: big.NewInt(50).Bytes(), WinProb: big.NewInt(30).Bytes()}},
+	}
+}
+
+func TestNewSelectionStrategy(t *testing.T) {
+	assert := assert.New(t)
+	for _, name := range []string{"", "first", "roundrobin", "latency", "price"} {
+		_, err := NewSelectionStrategy(name, nil)
+		assert.Nil(err, name)
+	}
+	_, err := NewSelectionStrategy("stake", nil)
+	assert.NotNil(err)
+	_, err = NewSelectionStrategy("cheapest", nil)
+	assert.NotNil(err)
+}
+
+func TestSelection_RoundRobin(t *testing.T) {
+	assert := assert.New(t)
+	s, err := NewSelectionStrategy("roundrobin", nil)
+	require.Nil(t, err)
+	orchs := selectionOrchs()
+	assert.Equal("https://a:8935", s.Select(orchs).Transcoder)
+	assert.Equal("https://b:8935", s.Select(orchs).Transcoder)
+	// order of the candidates doesn't matter
+	assert.Equal("https://c:8935", s.Select([]*net.OrchestratorInfo{orchs[1], orchs[2], orchs[0]}).Transcoder)
+	assert.Equal("https://a:8935", s.Select(orchs).Transcoder)
+}
+
+func TestSelection_Latency(t *testing.T) {
+	assert := assert.New(t)
+	defer func(p *perfList) { orchPerf = p }(orchPerf)
+	orchPerf = &perfList{perf: make(map[string]*orchestratorPerf)}
+	orchs := selectionOrchs()
+
+	orchPerf.record("https://a:8935", 3*time.Second, nil)
+	orchPerf.record("https://a:8935", time.Second, nil)
+	orchPerf.record("https://b:8935", time.Second, nil)
+	orchPerf.record("https://b:8935", 0, errors.New("timeout"))
+	orchPerf.record("https://c:8935", 0, errors.New("timeout"))
+	assert.Equal(orchestratorPerf{Segments: 2, Latency: 2 * time.Second}, orchPerf.get("https://a:8935"))
+	assert.Equal(orchestratorPerf{Segments: 2, Failures: 1, Latency: time.Second}, orchPerf.get("https://b:8935"))
+
+	s := latencySelection{}
+	assert.Equal("https://b:8935", s.Select(orchs).Transcoder)
+	// orchestrators that failed every segment come last
+	assert.Equal("https://a:8935", s.Select([]*net.OrchestratorInfo{orchs[2], orchs[0]}).Transcoder)
+	// unknown orchestrators come first
+	assert.Equal("https://d:8935", s.Select(append(orchs, &net.OrchestratorInfo{Transcoder: "https://d:8935"})).Transcoder)
+}
+
+func TestSelection_Price(t *testing.T) {
+	assert := assert.New(t)
+	s := priceSelection{}
+	orchs := selectionOrchs()
+	assert.Equal("https://b:8935", s.Select(orchs).Transcoder)
+	// orchestrators without ticket params are free
+	assert.Equal("https://d:8935", s.Select(append(orchs, &net.OrchestratorInfo{Transcoder: "https://d:8935"})).Transcoder)
+}
+
+func TestSelection_Stake(t *testing.T) {
+	assert := assert.New(t)
+	stakes := map[ethcommon.Address]*big.Int{
+		ethcommon.BytesToAddress([]byte{1}): big.NewInt(0),
+		ethcommon.BytesToAddress([]byte{2}): big.NewInt(1000),
+	}
+	stake := func(addr ethcommon.Address) (*big.Int, error) {
+		if s, ok := stakes[addr]; ok {
+			return s, nil
+		}
+		return nil, errors.New("unknown orchestrator")
+	}
+	s := &stakeSelection{stake: stake, rand: rand.New(rand.NewSource(1))}
+	orchs := selectionOrchs()
+	for i := 0; i < 10; i++ {
+		assert.Equal("https://b:8935", s.Select(orchs).Transcoder)
+	}
+
+	// without any stake, picks at random
+	picked := make(map[string]bool)
+	for i := 0; i < 50; i++ {
+		picked[s.Select([]*net.OrchestratorInfo{orchs[0], orchs[2]}).Transcoder] = true
+	}
+	assert.Len(picked, 2)
+}
+
+func TestSelection_StakeCache(t *testing.T) {
+	assert := assert.New(t)
+	defer func(ttl time.Duration) { StakeCacheTTL = ttl }(StakeCacheTTL)
+	lookups := 0
+	stake := func(addr ethcommon.Address) (*big.Int, error) {
+		lookups++
+		if addr == ethcommon.BytesToAddress([]byte{3}) {
+			return nil, errors.New("unknown orchestrator")
+		}
+		return big.NewInt(1000), nil
+	}
+	s := &stakeSelection{stake: stake, rand: rand.New(rand.NewSource(1))}
+	orchs := selectionOrchs()
+
+	// stakes are looked up once per orchestrator; failed lookups are retried
+	s.Select(orchs)
+	s.Select(orchs)
+	assert.Equal(4, lookups)
+
+	// and again once they expire
+	StakeCacheTTL = 0
+	s.Select(orchs)
+	assert.Equal(7, lookups)
+}
+
+func TestSelectOrchestrator_Strategy(t *testing.T) {
+	assert := assert.New(t)
+	s := setupServer()
+	mid := core.SplitStreamIDString(t.Name()).ManifestID
+	cpl := core.NewBasicPlaylistManager(mid, drivers.NodeStorage.NewSession(string(mid)))
+	s.LivepeerNode.OrchestratorPool = &stubDiscovery{lock: &sync.Mutex{}, infos: selectionOrchs()}
+	defer func(s SelectionStrategy) { OrchSelection = s }(OrchSelection)
+
+	sess, err := selectOrchestrator(s.LivepeerNode, cpl, BroadcastJobVideoProfiles)
+	assert.Nil(err)
+	assert.Equal("https://a:8935", sess.OrchestratorInfo.Transcoder)
+
+	OrchSelection = priceSelection{}
+	sess, err = selectOrchestrator(s.LivepeerNode, cpl, BroadcastJobVideoProfiles)
+	assert.Nil(err)
+	assert.Equal("https://b:8935", sess.OrchestratorInfo.Transcoder)
+
+	// suspended orchestrators aren't candidates
+	SuspendOrchestrator("https://b:8935", time.Now().Add(time.Hour))
+	defer UnsuspendOrchestrator("https://b:8935")
+	sess, err = selectOrchestrator(s.LivepeerNode, cpl, BroadcastJobVideoProfiles)
+	assert.Nil(err)
+	assert.Equal("https://a:8935", sess.OrchestratorInfo.Transcoder)
+}
+
+func TestSelectOrchestrator_MaxPrice(t *testing.T) {
+	assert := assert.New(t)
+	s := setupServer()
+	mid := core.SplitStreamIDString(t.Name()).ManifestID
+	cpl := core.NewBasicPlaylistManager(mid, drivers.NodeStorage.NewSession(string(mid)))
+	halfWinProb := new(big.Int).Rsh(maxWinProb, 1).Bytes()
+	// tickets worth 500 and 50 wei
+	orchs := []*net.OrchestratorInfo{
+		&net.OrchestratorInfo{Transcoder: "https://pricey:8935", TicketParams: &net.TicketParams{Recipient: []byte{1}, FaceValue: big.NewInt(1000).Bytes(), WinProb: halfWinProb}},
+		&net.OrchestratorInfo{Transcoder: "https://cheap:8935", TicketParams: &net.TicketParams{Recipient: []byte{2}, FaceValue: big.NewInt(100).Bytes(), WinProb: halfWinProb}},
+	}
+	s.LivepeerNode.OrchestratorPool = &stubDiscovery{lock: &sync.Mutex{}, infos: orchs}
+	defer func(p *big.Int) { BroadcastPrice = p }(BroadcastPrice)
+
+	// no limit
+	BroadcastPrice = big.NewInt(0)
+	sess, err := selectOrchestrator(s.LivepeerNode, cpl, BroadcastJobVideoProfiles)
+	assert.Nil(err)
+	assert.Equal("https://pricey:8935", sess.OrchestratorInfo.Transcoder)
+
+	BroadcastPrice = big.NewInt(100)
+	sess, err = selectOrchestrator(s.LivepeerNode, cpl, BroadcastJobVideoProfiles)
+	assert.Nil(err)
+	assert.Equal("https://cheap:8935", sess.OrchestratorInfo.Transcoder)
+	// nor are over-priced orchestrators used for redundant submissions
+	assert.Empty(selectRedundantOrchestrators(s.LivepeerNode, cpl, sess, 1))
+
+	BroadcastPrice = big.NewInt(10)
+	_, err = selectOrchestrator(s.LivepeerNode, cpl, BroadcastJobVideoProfiles)
+	assert.Equal(ErrNoOrchs, err)
+}
+
+func TestDiscoveryConstraints(t *testing.T) {
+	assert := assert.New(t)
+	defer func(p *big.Int) { BroadcastPrice = p }(BroadcastPrice)
+	defer func(c []string) { RequiredCapabilities = c }(RequiredCapabilities)
+	halfWinProb := new(big.Int).Rsh(maxWinProb, 1).Bytes()
+	// tickets worth 500 wei
+	o := &net.OrchestratorInfo{
+		Transcoder:   "https://a:8935",
+		TicketParams: &net.TicketParams{FaceValue: big.NewInt(1000).Bytes(), WinProb: halfWinProb},
+		Capabilities: []string{"HEVC"},
+	}
+
+	BroadcastPrice, RequiredCapabilities = big.NewInt(0), nil
+	assert.True(discoveryConstraints().Matches(o))
+	// nil constraints match anything
+	var c *net.OrchestratorConstraints
+	assert.True(c.Matches(o))
+
+	BroadcastPrice = big.NewInt(500)
+	assert.True(discoveryConstraints().Matches(o))
+	BroadcastPrice = big.NewInt(499)
+	assert.False(discoveryConstraints().Matches(o))
+	// orchestrators that don't ask for payment are free
+	assert.True(discoveryConstraints().Matches(&net.OrchestratorInfo{}))
+
+	BroadcastPrice = big.NewInt(0)
+	RequiredCapabilities = []string{"hevc"}
+	assert.True(discoveryConstraints().Matches(o))
+	RequiredCapabilities = []string{"hevc", "vp9"}
+	assert.False(discoveryConstraints().Matches(o))
+}
+
+func TestSelectOrchestrator_RequiredCapabilities(t *testing.T) {
+	assert := assert.New(t)
+	s := setupServer()
+	mid := core.SplitStreamIDString(t.Name()).ManifestID
+	cpl := core.NewBasicPlaylistManager(mid, drivers.NodeStorage.NewSession(string(mid)))
+	orchs := []*net.OrchestratorInfo{
+		&net.OrchestratorInfo{Transcoder: "https://a:8935"},
+		&net.OrchestratorInfo{Transcoder: "https://b:8935", Capabilities: []string{"hevc"}},
+	}
+	s.LivepeerNode.OrchestratorPool = &stubDiscovery{lock: &sync.Mutex{}, infos: orchs}
+	defer func(c []string) { RequiredCapabilities = c }(RequiredCapabilities)
+
+	RequiredCapabilities = []string{"hevc"}
+	sess, err := selectOrchestrator(s.LivepeerNode, cpl, BroadcastJobVideoProfiles)
+	assert.Nil(err)
+	assert.Equal("https://b:8935", sess.OrchestratorInfo.Transcoder)
+	assert.Empty(selectRedundantOrchestrators(s.LivepeerNode, cpl, sess, 1))
+
+	RequiredCapabilities = []string{"vp9"}
+	_, err = selectOrchestrator(s.LivepeerNode, cpl, BroadcastJobVideoProfiles)
+	assert.Equal(ErrNoOrchs, err)
+}
+
+// stubIncrementalDiscovery streams infos, then blocks until the stream is
+// cancelled
+type stubIncrementalDiscovery struct {
+	stubDiscovery
+}
+
+func (d *stubIncrementalDiscovery) StreamOrchestrators(ctx context.Context, num int, constraints *net.OrchestratorConstraints) <-chan *net.OrchestratorInfo {
+	orchs := make(chan *net.OrchestratorInfo)
+	go func() {
+		defer close(orchs)
+		for _, o := range d.infos {
+			select {
+			case orchs <- o:
+			case <-ctx.Done():
+				return
+			}
+		}
+		<-ctx.Done()
+	}()
+	return orchs
+}
+
+func TestSelectOrchestrator_Incremental(t *testing.T) {
+	assert := assert.New(t)
+	s := setupServer()
+	mid := core.SplitStreamIDString(t.Name()).ManifestID
+	cpl := core.NewBasicPlaylistManager(mid, drivers.NodeStorage.NewSession(string(mid)))
+	s.LivepeerNode.OrchestratorPool = &stubIncrementalDiscovery{stubDiscovery{lock: &sync.Mutex{}, infos: selectionOrchs()}}
+	SuspendOrchestrator("https://a:8935", time.Now().Add(time.Hour))
+	defer UnsuspendOrchestrator("https://a:8935")
+
+	// the first viable orchestrator is used without waiting for discovery
+	// to finish
+	done := make(chan *BroadcastSession)
+	go func() {
+		sess, err := selectOrchestrator(s.LivepeerNode, cpl, BroadcastJobVideoProfiles)
+		assert.Nil(err)
+		done <- sess
+	}()
+	var sess *BroadcastSession
+	select {
+	case sess = <-done:
+		assert.Equal("https://b:8935", sess.OrchestratorInfo.Transcoder)
+	case <-time.After(time.Second):
+		t.Fatal("selection waited for discovery to finish")
+	}
+
+	redundant := selectRedundantOrchestrators(s.LivepeerNode, cpl, sess, 1)
+	if assert.Len(redundant, 1) {
+		assert.Equal("https://c:8935", redundant[0].OrchestratorInfo.Transcoder)
+	}
+}
@@ -0,0 +1,122 @@
+package server
+
+import (
+	"sync"
+)
+
+// Number of the most recent segments of a stream whose orchestrator is
+// reported on /status
+const sessionHistorySegments = 20
+
+// StreamSessions describes the orchestrator sessions of a stream, as
+// reported on /status
+type StreamSessions struct {
+	// orchestrator of the current session; empty while one is being selected
+	Orchestrator string   `json:"orchestrator"`
+	Redundant    []string `json:"redundant,omitempty"`
+	SpotCheck    string   `json:"spotCheck,omitempty"`
+	// orchestrators selected for the stream so far
+	Orchestrators map[string]*OrchestratorStats `json:"orchestrators"`
+	// the most recent transcoded segments, oldest first
+	Segments []SegmentOrchestrator `json:"segments"`
+}
+
+// OrchestratorStats summarizes how an orchestrator served a stream: the times
+// it was selected, the segments it transcoded and the submissions that failed
+type OrchestratorStats struct {
+	Selected  int  `json:"selected"`
+	Segments  int  `json:"segments"`
+	Errors    int  `json:"errors"`
+	Suspended bool `json:"suspended"`
+}
+
+// SegmentOrchestrator names the orchestrator that transcoded a segment
+type SegmentOrchestrator struct {
+	SeqNo        uint64 `json:"seqNo"`
+	Orchestrator string `json:"orchestrator"`
+}
+
+// sessionHistory records which orchestrators served a stream. The zero value
+// is ready to use.
+type sessionHistory struct {
+	lock     sync.Mutex
+	orchs    map[string]*OrchestratorStats
+	segments []SegmentOrchestrator
+}
+
+func (h *sessionHistory) stats(orch string) *OrchestratorStats {
+	if h.orchs == nil {
+		h.orchs = make(map[string]*OrchestratorStats)
+	}
+	st, ok := h.orchs[orch]
+	if !ok {
+		st = &OrchestratorStats{}
+		h.orchs[orch] = st
+	}
+	return st
+}
+
+// selected records a session with orch being selected for the stream
+func (h *sessionHistory) selected(orch string) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.stats(orch).Selected++
+}
+
+// transcoded records orch transcoding segment seqNo
+func (h *sessionHistory) transcoded(seqNo uint64, orch string) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.stats(orch).Segments++
+	h.segments = append(h.segments, SegmentOrchestrator{SeqNo: seqNo, Orchestrator: orch})
+	if len(h.segments) > sessionHistorySegments {
+		h.segments = h.segments[len(h.segments)-sessionHistorySegments:]
+	}
+}
+
+// failed records a failed submission to orch
+func (h *sessionHistory) failed(orch string) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.stats(orch).Errors++
+}
+
+// sessionStatus returns the state of the stream's sessions
+func (cxn *rtmpConnection) sessionStatus() *StreamSessions {
+	st := &StreamSessions{}
+	cxn.lock.RLock()
+	if cxn.sess != nil {
+		st.Orchestrator = cxn.sess.OrchestratorInfo.GetTranscoder()
+	}
+	for _, sess := range cxn.redundant {
+		st.Redundant = append(st.Redundant, sess.OrchestratorInfo.GetTranscoder())
+	}
+	if cxn.spotCheck != nil {
+		st.SpotCheck = cxn.spotCheck.OrchestratorInfo.GetTranscoder()
+	}
+	cxn.lock.RUnlock()
+
+	h := &cxn.history
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	st.Orchestrators = make(map[string]*OrchestratorStats, len(h.orchs))
+	for orch, stats := range h.orchs {
+		cp := *stats
+		cp.Suspended = orchSuspensions.isSuspended(orch)
+		st.Orchestrators[orch] = &cp
+	}
+	st.Segments = append([]SegmentOrchestrator{}, h.segments...)
+	return st
+}
+
+// sessionStatuses returns the session state of each active stream, keyed by
+// manifest ID
+func (s *LivepeerServer) sessionStatuses() map[string]*StreamSessions {
+	s.connectionLock.RLock()
+	defer s.connectionLock.RUnlock()
+	res := make(map[string]*StreamSessions, len(s.rtmpConnections))
+	for mid, cxn := range s.rtmpConnections {
+		res[string(mid)] = cxn.sessionStatus()
+	}
+	return res
+}
@@ -0,0 +1,81 @@
+package server
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/livepeer/go-livepeer/core"
+	"github.com/livepeer/go-livepeer/net"
+	"github.com/livepeer/lpms/stream"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSessionHistory(t *testing.T) {
+	assert := assert.New(t)
+	h := &sessionHistory{}
+	h.selected("a")
+	for i := 0; i < sessionHistorySegments+5; i++ {
+		h.transcoded(uint64(i), "a")
+	}
+	h.failed("a")
+	h.failed("b")
+
+	assert.Equal(&OrchestratorStats{Selected: 1, Segments: sessionHistorySegments + 5, Errors: 1}, h.orchs["a"])
+	assert.Equal(&OrchestratorStats{Errors: 1}, h.orchs["b"])
+	// only the most recent segments are kept
+	require.Len(t, h.segments, sessionHistorySegments)
+	assert.Equal(uint64(5), h.segments[0].SeqNo)
+	assert.Equal(uint64(sessionHistorySegments+4), h.segments[sessionHistorySegments-1].SeqNo)
+}
+
+func TestSessionStatuses(t *testing.T) {
+	assert := assert.New(t)
+	s := setupServer()
+	mid := core.SplitStreamIDString(t.Name()).ManifestID
+	cxn, err := s.registerConnection(stream.NewBasicRTMPVideoStream(string(mid)))
+	require.Nil(t, err)
+	defer func() {
+		s.connectionLock.Lock()
+		delete(s.rtmpConnections, mid)
+		s.connectionLock.Unlock()
+	}()
+
+	// no session selected yet
+	st := s.sessionStatuses()[string(mid)]
+	require.NotNil(t, st)
+	assert.Empty(st.Orchestrator)
+	assert.Empty(st.Segments)
+
+	newSess := func(orch string) *BroadcastSession {
+		return &BroadcastSession{OrchestratorInfo: &net.OrchestratorInfo{Transcoder: orch}}
+	}
+	cxn.lock.Lock()
+	cxn.sess = newSess("https://current:8935")
+	cxn.redundant = []*BroadcastSession{newSess("https://redundant:8935")}
+	cxn.lock.Unlock()
+	cxn.history.selected("https://old:8935")
+	cxn.history.transcoded(1, "https://old:8935")
+	cxn.history.failed("https://old:8935")
+	cxn.history.selected("https://current:8935")
+	cxn.history.transcoded(2, "https://current:8935")
+	SuspendOrchestrator("https://old:8935", time.Now().Add(time.Minute))
+	defer UnsuspendOrchestrator("https://old:8935")
+
+	st = s.sessionStatuses()[string(mid)]
+	assert.Equal("https://current:8935", st.Orchestrator)
+	assert.Equal([]string{"https://redundant:8935"}, st.Redundant)
+	assert.Equal(&OrchestratorStats{Selected: 1, Segments: 1, Errors: 1, Suspended: true}, st.Orchestrators["https://old:8935"])
+	assert.Equal(&OrchestratorStats{Selected: 1, Segments: 1}, st.Orchestrators["https://current:8935"])
+	assert.Equal([]SegmentOrchestrator{{1, "https://old:8935"}, {2, "https://current:8935"}}, st.Segments)
+
+	// the reported state doesn't change with the stream
+	cxn.history.transcoded(3, "https://current:8935")
+	assert.Len(st.Segments, 2)
+	assert.Equal(1, st.Orchestrators["https://current:8935"].Segments)
+
+	data, err := json.Marshal(st)
+	require.Nil(t, err)
+	assert.Contains(string(data), `"segments":[{"seqNo":1,"orchestrator":"https://old:8935"}`)
+}
@@ -0,0 +1,201 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/bits"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/livepeer/go-livepeer/monitor"
+	"github.com/livepeer/go-livepeer/net"
+	"github.com/livepeer/lpms/ffmpeg"
+	"github.com/livepeer/lpms/stream"
+)
+
+// SpotCheckRate is the fraction of transcoded segments that are transcoded
+// again, by a second orchestrator or LocalTranscoder, to check the
+// renditions of the stream's orchestrator against. Zero disables spot checks.
+var SpotCheckRate = 0.0
+
+// SpotCheckHasher computes the perceptual hashes spot checks compare.
+// Spot checks are disabled if nil.
+var SpotCheckHasher FrameHasher
+
+// SpotCheckMaxDistance is the mean number of bits frame hashes may differ by
+// before a rendition is considered to diverge from the reference
+var SpotCheckMaxDistance = 10
+
+// ErrSpotCheckHashes is returned when two renditions can't be compared
+var ErrSpotCheckHashes = errors.New("ErrSpotCheckHashes")
+
+// FrameHasher computes 64 bit perceptual hashes of frames sampled at fixed
+// points of a rendition, such that renditions of the same source produced by
+// different transcoders hash close together
+type FrameHasher interface {
+	Hash(data []byte) ([]uint64, error)
+}
+
+// ExternalHasher has frame hashes computed by a service at URL. The service is
+// posted the rendition as video/mp2t and responds with {"hashes": [uint64]}.
+type ExternalHasher struct {
+	URL    string
+	Client *http.Client
+}
+
+// NewExternalHasher returns a hasher using the service at url
+func NewExternalHasher(url string) *ExternalHasher {
+	return &ExternalHasher{URL: url, Client: &http.Client{Timeout: SegLen}}
+}
+
+type hashResponse struct {
+	Hashes []uint64 `json:"hashes"`
+}
+
+func (h *ExternalHasher) Hash(data []byte) ([]uint64, error) {
+	resp, err := h.Client.Post(h.URL, "video/mp2t", bytes.NewBuffer(data))
+	if err != nil {
+		return nil, err
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New(resp.Status)
+	}
+	var hresp hashResponse
+	if err := json.Unmarshal(body, &hresp); err != nil {
+		return nil, err
+	}
+	return hresp.Hashes, nil
+}
+
+// hashDistance returns the mean number of differing bits between the frame
+// hashes of two renditions
+func hashDistance(a, b []uint64) (float64, error) {
+	if len(a) == 0 || len(a) != len(b) {
+		return 0, ErrSpotCheckHashes
+	}
+	total := 0
+	for i := range a {
+		total += bits.OnesCount64(a[i] ^ b[i])
+	}
+	return float64(total) / float64(len(a)), nil
+}
+
+// spotCheck picks segments at SpotCheckRate once sess transcoded them into
+// res, and in the background checks a random rendition against the one
+// transcoded by a reference: the stream's spot check session if any, else
+// LocalTranscoder. The orchestrator of sess is suspended if they diverge.
+func spotCheck(ctx context.Context, cxn *rtmpConnection, sess *BroadcastSession, seg *stream.HLSSegment, res *net.TranscodeData) {
+	if SpotCheckRate <= 0 || SpotCheckHasher == nil || len(res.Segments) == 0 || rand.Float64() >= SpotCheckRate {
+		return
+	}
+	cxn.lock.RLock()
+	ref := cxn.spotCheck
+	cxn.lock.RUnlock()
+	if ref == nil && LocalTranscoder == nil {
+		return
+	}
+	i := rand.Intn(len(res.Segments))
+	url, profile := res.Segments[i].Url, sess.Profiles[i]
+	src := *seg
+	src.Name = "" // the reference can't read the segment from the orchestrator's storage
+
+	go func() {
+		defer monitor.RecoverAndReport("spotCheck")
+		orch := sess.OrchestratorInfo.GetTranscoder()
+		dist, err := spotCheckDistance(ctx, cxn, sess, ref, &src, url, profile)
+		if err != nil {
+			glog.Errorf("Error spot checking segment manifestID=%s nonce=%d seqNo=%d orchestrator=%s profile=%s err=%v", cxn.mid, cxn.nonce, seg.SeqNo, orch, profile.Name, err)
+			return
+		}
+		if dist <= float64(SpotCheckMaxDistance) {
+			glog.V(6).Infof("Spot check passed manifestID=%s seqNo=%d orchestrator=%s profile=%s distance=%.1f", cxn.mid, seg.SeqNo, orch, profile.Name, dist)
+			return
+		}
+
+		glog.Errorf("Spot check failed manifestID=%s nonce=%d seqNo=%d orchestrator=%s profile=%s distance=%.1f", cxn.mid, cxn.nonce, seg.SeqNo, orch, profile.Name, dist)
+		SuspendOrchestrator(orch, time.Now().Add(MaxSuspensionCooldown))
+		if monitor.Enabled {
+			monitor.LogSpotCheckFailed(orch)
+			monitor.LogOrchestratorSuspended(orch, MaxSuspensionCooldown)
+		}
+		cxn.lock.RLock()
+		current := cxn.sess == sess
+		cxn.lock.RUnlock()
+		if current {
+			cxn.requestSession()
+		}
+	}()
+}
+
+// spotCheckDistance transcodes seg into profile with the reference and
+// returns the hash distance between its rendition and the one at url,
+// returned by the orchestrator of sess
+func spotCheckDistance(ctx context.Context, cxn *rtmpConnection, sess, ref *BroadcastSession, seg *stream.HLSSegment, url string, profile ffmpeg.VideoProfile) (float64, error) {
+	if err := validateRenditionURL(sess, url); err != nil {
+		return 0, err
+	}
+	data, err := downloadRendition(ctx, seg, url)
+	if err != nil {
+		return 0, err
+	}
+	var refData []byte
+	if ref != nil {
+		refData, err = spotCheckOrchestrator(ctx, cxn, ref, seg, profile)
+	} else {
+		if !acquireLocalTranscodeSlot() {
+			return 0, errors.New("no local transcode slot")
+		}
+		var renditions [][]byte
+		renditions, err = runLocalTranscoder(cxn.mid, seg, []ffmpeg.VideoProfile{profile})
+		releaseLocalTranscodeSlot()
+		if err == nil {
+			refData = renditions[0]
+		}
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	hashes, err := SpotCheckHasher.Hash(data)
+	if err != nil {
+		return 0, err
+	}
+	refHashes, err := SpotCheckHasher.Hash(refData)
+	if err != nil {
+		return 0, err
+	}
+	return hashDistance(hashes, refHashes)
+}
+
+// spotCheckOrchestrator submits seg to the reference session and downloads
+// its rendition of profile
+func spotCheckOrchestrator(ctx context.Context, cxn *rtmpConnection, ref *BroadcastSession, seg *stream.HLSSegment, profile ffmpeg.VideoProfile) ([]byte, error) {
+	res, err := submitSegmentWithRetries(ctx, ref, seg, cxn.nonce, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if res == nil {
+		return nil, errors.New("no transcode result")
+	}
+	for i, p := range ref.Profiles {
+		if p.Name == profile.Name && i < len(res.Segments) {
+			url := res.Segments[i].Url
+			if err := validateRenditionURL(ref, url); err != nil {
+				return nil, err
+			}
+			return downloadRendition(ctx, seg, url)
+		}
+	}
+	return nil, fmt.Errorf("reference didn't transcode profile=%s", profile.Name)
+}
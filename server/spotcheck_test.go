@@ -0,0 +1,149 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/livepeer/go-livepeer/net"
+	"github.com/livepeer/lpms/ffmpeg"
+	"github.com/livepeer/lpms/stream"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stubHasher hashes renditions to the hashes configured for their data
+type stubHasher struct {
+	hashes map[string][]uint64
+	hashed chan []byte
+}
+
+func (h *stubHasher) Hash(data []byte) ([]uint64, error) {
+	h.hashed <- data
+	return h.hashes[string(data)], nil
+}
+
+func TestHashDistance(t *testing.T) {
+	assert := assert.New(t)
+	d, err := hashDistance([]uint64{0xff, 0}, []uint64{0xff, 0})
+	assert.Nil(err)
+	assert.Equal(0.0, d)
+	d, err = hashDistance([]uint64{0xff, 0}, []uint64{0x0f, 0x3})
+	assert.Nil(err)
+	assert.Equal(3.0, d)
+
+	_, err = hashDistance(nil, nil)
+	assert.Equal(ErrSpotCheckHashes, err)
+	_, err = hashDistance([]uint64{0}, []uint64{0, 0})
+	assert.Equal(ErrSpotCheckHashes, err)
+}
+
+func TestExternalHasher(t *testing.T) {
+	assert := assert.New(t)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if r.Header.Get("Content-Type") != "video/mp2t" || string(body) != "rendition" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(&hashResponse{Hashes: []uint64{1, 2}})
+	}))
+	defer ts.Close()
+
+	hashes, err := NewExternalHasher(ts.URL).Hash([]byte("rendition"))
+	assert.Nil(err)
+	assert.Equal([]uint64{1, 2}, hashes)
+	_, err = NewExternalHasher(ts.URL).Hash([]byte("other"))
+	assert.NotNil(err)
+}
+
+func TestSpotCheck_LocalReference(t *testing.T) {
+	wd, err := ioutil.TempDir("", t.Name())
+	require.Nil(t, err)
+	defer os.RemoveAll(wd)
+	defer func(dir string) {
+		SpotCheckRate, SpotCheckHasher, LocalTranscoder, LocalTranscodeDir = 0, nil, nil, dir
+	}(LocalTranscodeDir)
+	SpotCheckRate = 1
+	LocalTranscodeDir = wd
+	LocalTranscoder = &stubLocalTranscoder{} // renditions hold the profile name
+
+	// the orchestrator's renditions
+	var lock sync.Mutex
+	rendition := "honest"
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		w.Write([]byte(rendition))
+	}))
+	defer ts.Close()
+
+	hasher := &stubHasher{
+		hashes: map[string][]uint64{
+			ffmpeg.P240p30fps16x9.Name: {0x0f, 0xf0},
+			"honest":                   {0x0f, 0xf1},
+			"forged":                   {0xfffffffffffffff0, 0xffffffffffffff0f},
+		},
+		hashed: make(chan []byte, 2),
+	}
+	SpotCheckHasher = hasher
+
+	orch := ts.URL // the orchestrator hosts its renditions
+	defer UnsuspendOrchestrator(orch)
+	sess := &BroadcastSession{
+		OrchestratorInfo: &net.OrchestratorInfo{Transcoder: orch},
+		Profiles:         []ffmpeg.VideoProfile{ffmpeg.P240p30fps16x9},
+	}
+	cxn := &rtmpConnection{mid: "spotcheck", sess: sess, lock: &sync.RWMutex{}, needOrch: make(chan struct{}, 1)}
+	res := &net.TranscodeData{Segments: []*net.TranscodedSegmentData{{Url: ts.URL}}}
+	check := func(seqNo uint64) {
+		spotCheck(context.Background(), cxn, sess, &stream.HLSSegment{SeqNo: seqNo, Data: []byte("source")}, res)
+		for i := 0; i < 2; i++ {
+			select {
+			case <-hasher.hashed:
+			case <-time.After(time.Second):
+				t.Fatal("Timed out waiting for the spot check")
+			}
+		}
+		// give the spot check time to act on the hashes
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	check(1)
+	assert.False(t, orchSuspensions.isSuspended(orch), "renditions within the distance pass")
+	assert.Len(t, cxn.needOrch, 0)
+
+	lock.Lock()
+	rendition = "forged"
+	lock.Unlock()
+	check(2)
+	assert.True(t, orchSuspensions.isSuspended(orch), "diverging renditions suspend the orchestrator")
+	assert.Len(t, cxn.needOrch, 1, "the stream moves to another orchestrator")
+
+	// renditions on internal hosts other than the orchestrator aren't fetched
+	UnsuspendOrchestrator(orch)
+	<-cxn.needOrch
+	internal := &net.TranscodeData{Segments: []*net.TranscodedSegmentData{{Url: "http://127.0.0.1:1/internal.ts"}}}
+	spotCheck(context.Background(), cxn, sess, &stream.HLSSegment{SeqNo: 3, Data: []byte("source")}, internal)
+	select {
+	case <-hasher.hashed:
+		t.Error("Unexpected spot check of an internal URL")
+	case <-time.After(100 * time.Millisecond):
+	}
+	assert.False(t, orchSuspensions.isSuspended(orch))
+
+	// disabled spot checks don't transcode anything
+	SpotCheckRate = 0
+	spotCheck(context.Background(), cxn, sess, &stream.HLSSegment{SeqNo: 4, Data: []byte("source")}, res)
+	select {
+	case <-hasher.hashed:
+		t.Error("Unexpected spot check")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
@@ -0,0 +1,99 @@
+package server
+
+import (
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/livepeer/go-livepeer/monitor"
+)
+
+// How long an orchestrator is suspended for after failing a session. Every
+// further failure before it transcodes a segment doubles the cooldown, up to
+// MaxSuspensionCooldown. Zero disables automatic suspensions.
+var SuspensionCooldown = 30 * time.Second
+var MaxSuspensionCooldown = 10 * time.Minute
+
+// orchSuspensions holds orchestrator suspensions, keyed on the
+// orchestrator's transcoder URI, whether initiated by the operator or after
+// failures. Suspended orchestrators are skipped when selecting an
+// orchestrator for a stream; suspensions are shared by all streams.
+var orchSuspensions = &suspensionList{
+	suspended: make(map[string]time.Time),
+	failures:  make(map[string]int),
+}
+
+type suspensionList struct {
+	lock      sync.Mutex
+	suspended map[string]time.Time // orchestrator : suspended until
+	failures  map[string]int       // orchestrator : failures since last success
+}
+
+// SuspendOrchestrator stops routing new sessions to the orchestrator at
+// addr until the given time
+func SuspendOrchestrator(addr string, until time.Time) {
+	orchSuspensions.lock.Lock()
+	defer orchSuspensions.lock.Unlock()
+	orchSuspensions.suspended[addr] = until
+}
+
+// UnsuspendOrchestrator lifts a suspension set with SuspendOrchestrator
+func UnsuspendOrchestrator(addr string) {
+	orchSuspensions.lock.Lock()
+	defer orchSuspensions.lock.Unlock()
+	delete(orchSuspensions.suspended, addr)
+	delete(orchSuspensions.failures, addr)
+}
+
+// penalize suspends addr after it failed a session, for longer the more
+// times it failed in a row. Doesn't shorten an existing suspension.
+func (s *suspensionList) penalize(addr string) {
+	if SuspensionCooldown <= 0 {
+		return
+	}
+	s.lock.Lock()
+	s.failures[addr]++
+	cooldown := SuspensionCooldown << uint(s.failures[addr]-1)
+	if cooldown > MaxSuspensionCooldown || cooldown <= 0 {
+		cooldown = MaxSuspensionCooldown
+	}
+	until := time.Now().Add(cooldown)
+	if cur, ok := s.suspended[addr]; !ok || until.After(cur) {
+		s.suspended[addr] = until
+	}
+	s.lock.Unlock()
+
+	glog.Warningf("Suspending orchestrator=%s for %v after failure", addr, cooldown)
+	if monitor.Enabled {
+		monitor.LogOrchestratorSuspended(addr, cooldown)
+	}
+}
+
+// recordSuccess clears the failures of addr, resetting its cooldown
+func (s *suspensionList) recordSuccess(addr string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	delete(s.failures, addr)
+}
+
+// isSuspended checks whether addr is suspended, clearing the suspension if
+// it has expired
+func (s *suspensionList) isSuspended(addr string) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	until, ok := s.suspended[addr]
+	if !ok {
+		return false
+	}
+	if time.Now().After(until) {
+		delete(s.suspended, addr)
+		return false
+	}
+	return true
+}
+
+func (s *suspensionList) len() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return len(s.suspended)
+}
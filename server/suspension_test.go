@@ -0,0 +1,90 @@
+package server
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/livepeer/go-livepeer/core"
+	"github.com/livepeer/go-livepeer/drivers"
+	"github.com/livepeer/go-livepeer/net"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSelectOrchestrator_Suspended(t *testing.T) {
+	assert := assert.New(t)
+	s := setupServer()
+	mid := core.SplitStreamIDString(t.Name()).ManifestID
+	cpl := core.NewBasicPlaylistManager(mid, drivers.NodeStorage.NewSession(string(mid)))
+	s.LivepeerNode.OrchestratorPool = &stubDiscovery{
+		lock: &sync.Mutex{},
+		infos: []*net.OrchestratorInfo{
+			&net.OrchestratorInfo{Transcoder: "https://a:8935"},
+			&net.OrchestratorInfo{Transcoder: "https://b:8935"},
+		},
+	}
+	defer UnsuspendOrchestrator("https://a:8935")
+	defer UnsuspendOrchestrator("https://b:8935")
+
+	sess, err := selectOrchestrator(s.LivepeerNode, cpl, BroadcastJobVideoProfiles)
+	assert.Nil(err)
+	assert.Equal("https://a:8935", sess.OrchestratorInfo.Transcoder)
+
+	// suspended orchestrators are skipped
+	SuspendOrchestrator("https://a:8935", time.Now().Add(time.Hour))
+	sess, err = selectOrchestrator(s.LivepeerNode, cpl, BroadcastJobVideoProfiles)
+	assert.Nil(err)
+	assert.Equal("https://b:8935", sess.OrchestratorInfo.Transcoder)
+
+	// no orchestrator is available if all are suspended
+	SuspendOrchestrator("https://b:8935", time.Now().Add(time.Hour))
+	_, err = selectOrchestrator(s.LivepeerNode, cpl, BroadcastJobVideoProfiles)
+	assert.Equal(ErrNoOrchs, err)
+
+	// expired suspensions are cleared
+	SuspendOrchestrator("https://a:8935", time.Now().Add(-time.Second))
+	sess, err = selectOrchestrator(s.LivepeerNode, cpl, BroadcastJobVideoProfiles)
+	assert.Nil(err)
+	assert.Equal("https://a:8935", sess.OrchestratorInfo.Transcoder)
+	assert.Equal(1, orchSuspensions.len())
+
+	UnsuspendOrchestrator("https://b:8935")
+	assert.Equal(0, orchSuspensions.len())
+}
+
+func TestSuspensionList_Penalize(t *testing.T) {
+	assert := assert.New(t)
+	defer func(c, m time.Duration) { SuspensionCooldown, MaxSuspensionCooldown = c, m }(SuspensionCooldown, MaxSuspensionCooldown)
+	SuspensionCooldown = time.Minute
+	MaxSuspensionCooldown = 3 * time.Minute
+	l := &suspensionList{suspended: make(map[string]time.Time), failures: make(map[string]int)}
+	addr := "https://a:8935"
+
+	// cooldown doubles with every failure, up to the max
+	for _, cooldown := range []time.Duration{time.Minute, 2 * time.Minute, 3 * time.Minute, 3 * time.Minute} {
+		start := time.Now()
+		l.penalize(addr)
+		until := l.suspended[addr]
+		assert.True(!until.Before(start.Add(cooldown)) && !until.After(time.Now().Add(cooldown)), cooldown)
+		assert.True(l.isSuspended(addr))
+	}
+
+	// a success resets the cooldown but not the current suspension
+	l.recordSuccess(addr)
+	assert.True(l.isSuspended(addr))
+	l.suspended[addr] = time.Now().Add(-time.Second)
+	assert.False(l.isSuspended(addr))
+	l.penalize(addr)
+	assert.True(l.suspended[addr].Before(time.Now().Add(time.Minute + time.Second)))
+
+	// longer operator suspensions aren't shortened
+	long := time.Now().Add(time.Hour)
+	l.suspended[addr] = long
+	l.penalize(addr)
+	assert.Equal(long, l.suspended[addr])
+
+	// no automatic suspensions without a cooldown
+	SuspensionCooldown = 0
+	l.penalize("https://b:8935")
+	assert.False(l.isSuspended("https://b:8935"))
+}
@@ -0,0 +1,97 @@
+package server
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"sync"
+	"time"
+
+	"github.com/livepeer/go-livepeer/net"
+)
+
+const TranscodeCacheSize = 100
+const TranscodeCacheTTL = 5 * time.Minute
+
+// TranscodeCache holds recent transcode results so that segments with
+// duplicate data (eg, re-sent after an RTMP reconnect) aren't transcoded twice
+var TranscodeCache = NewTranscodeResultCache(TranscodeCacheSize, TranscodeCacheTTL)
+
+type transcodeCacheEntry struct {
+	key        [sha256.Size]byte
+	transcoder string
+	res        *net.TranscodeData
+	added      time.Time
+}
+
+// TranscodeResultCache is a fixed size LRU of transcode results keyed on
+// the hash of the source segment data
+type TranscodeResultCache struct {
+	size int
+	ttl  time.Duration
+
+	lock    sync.Mutex
+	entries map[[sha256.Size]byte]*list.Element
+	lru     *list.List // front is most recently used
+}
+
+func NewTranscodeResultCache(size int, ttl time.Duration) *TranscodeResultCache {
+	return &TranscodeResultCache{
+		size:    size,
+		ttl:     ttl,
+		entries: make(map[[sha256.Size]byte]*list.Element),
+		lru:     list.New(),
+	}
+}
+
+// Get returns the cached result for `data` if it was produced by `transcoder`
+// and hasn't expired; nil otherwise.
+func (c *TranscodeResultCache) Get(data []byte, transcoder string) *net.TranscodeData {
+	if len(data) == 0 {
+		return nil
+	}
+	key := sha256.Sum256(data)
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	el, ok := c.entries[key]
+	if !ok {
+		return nil
+	}
+	entry := el.Value.(*transcodeCacheEntry)
+	if time.Since(entry.added) > c.ttl {
+		c.lru.Remove(el)
+		delete(c.entries, key)
+		return nil
+	}
+	// The result signature is only valid for the orchestrator that made it
+	if entry.transcoder != transcoder {
+		return nil
+	}
+	c.lru.MoveToFront(el)
+	return entry.res
+}
+
+// Add caches the result of transcoding `data`, evicting the least recently
+// used entry if the cache is full.
+func (c *TranscodeResultCache) Add(data []byte, transcoder string, res *net.TranscodeData) {
+	if len(data) == 0 {
+		return
+	}
+	key := sha256.Sum256(data)
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if el, ok := c.entries[key]; ok {
+		c.lru.Remove(el)
+		delete(c.entries, key)
+	}
+	c.entries[key] = c.lru.PushFront(&transcodeCacheEntry{
+		key:        key,
+		transcoder: transcoder,
+		res:        res,
+		added:      time.Now(),
+	})
+	for c.lru.Len() > c.size {
+		el := c.lru.Back()
+		c.lru.Remove(el)
+		delete(c.entries, el.Value.(*transcodeCacheEntry).key)
+	}
+}
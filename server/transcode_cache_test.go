@@ -0,0 +1,109 @@
+package server
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/livepeer/go-livepeer/core"
+	"github.com/livepeer/go-livepeer/drivers"
+	"github.com/livepeer/go-livepeer/net"
+	ffmpeg "github.com/livepeer/lpms/ffmpeg"
+	"github.com/livepeer/lpms/stream"
+)
+
+func TestTranscodeResultCache(t *testing.T) {
+	assert := assert.New(t)
+	c := NewTranscodeResultCache(2, time.Minute)
+	res := &net.TranscodeData{Sig: []byte("sig")}
+
+	assert.Nil(c.Get([]byte("a"), "o1"))
+	c.Add([]byte("a"), "o1", res)
+	assert.Equal(res, c.Get([]byte("a"), "o1"))
+	// results from another orchestrator are not reused
+	assert.Nil(c.Get([]byte("a"), "o2"))
+	// empty data is never cached
+	c.Add(nil, "o1", res)
+	assert.Nil(c.Get(nil, "o1"))
+
+	// least recently used entry is evicted
+	c.Add([]byte("b"), "o1", res)
+	c.Get([]byte("a"), "o1")
+	c.Add([]byte("c"), "o1", res)
+	assert.NotNil(c.Get([]byte("a"), "o1"))
+	assert.Nil(c.Get([]byte("b"), "o1"))
+	assert.NotNil(c.Get([]byte("c"), "o1"))
+
+	// expired entries are dropped
+	c = NewTranscodeResultCache(2, time.Millisecond)
+	c.Add([]byte("a"), "o1", res)
+	time.Sleep(5 * time.Millisecond)
+	assert.Nil(c.Get([]byte("a"), "o1"))
+}
+
+func TestProcessSegment_TranscodeCache(t *testing.T) {
+	require := require.New(t)
+	oldCache := TranscodeCache
+	defer func() { TranscodeCache = oldCache }()
+	TranscodeCache = NewTranscodeResultCache(TranscodeCacheSize, TranscodeCacheTTL)
+
+	tr := &net.TranscodeResult{
+		Result: &net.TranscodeResult_Data{
+			Data: &net.TranscodeData{
+				Segments: []*net.TranscodedSegmentData{
+					&net.TranscodedSegmentData{Url: "foo"},
+				},
+			},
+		},
+	}
+	buf, err := proto.Marshal(tr)
+	require.Nil(err)
+
+	var lock sync.Mutex
+	submits := 0
+	ts, mux := stubTLSServer()
+	defer ts.Close()
+	mux.HandleFunc("/segment", func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		submits++
+		lock.Unlock()
+		w.WriteHeader(http.StatusOK)
+		w.Write(buf)
+	})
+
+	mid := core.RandomManifestID()
+	storage := drivers.NewMemoryDriver(nil).NewSession(string(mid))
+	cxn := &rtmpConnection{
+		mid:     mid,
+		nonce:   7,
+		pl:      core.NewBasicPlaylistManager(mid, storage),
+		profile: &ffmpeg.P144p30fps16x9,
+		lock:    &sync.RWMutex{},
+		sess: &BroadcastSession{
+			Broadcaster:      StubBroadcaster2(),
+			ManifestID:       mid,
+			Profiles:         []ffmpeg.VideoProfile{ffmpeg.P144p30fps16x9},
+			OrchestratorInfo: &net.OrchestratorInfo{Transcoder: ts.URL},
+		},
+		needOrch: make(chan struct{}, 1),
+	}
+
+	data := []byte("dummy")
+	processSegment(cxn, &stream.HLSSegment{SeqNo: 0, Data: data})
+	for i := 0; TranscodeCache.Get(data, ts.URL) == nil; i++ {
+		require.True(i < 100, "Timed out waiting for transcode result")
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// identical data should not be submitted again
+	processSegment(cxn, &stream.HLSSegment{SeqNo: 1, Data: data})
+	time.Sleep(100 * time.Millisecond)
+	lock.Lock()
+	defer lock.Unlock()
+	assert.Equal(t, 1, submits)
+}
@@ -0,0 +1,243 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/livepeer/go-livepeer/core"
+	"github.com/livepeer/go-livepeer/monitor"
+	"github.com/livepeer/lpms/ffmpeg"
+)
+
+// Verifier checks the renditions returned by orchestrators before they are
+// inserted into the playlist
+type Verifier interface {
+	// Verify returns a *VerificationError if the rendition doesn't match its
+	// profile, or any other error if the rendition couldn't be checked
+	Verify(params *VerificationParams) error
+}
+
+// VerificationParams describes a downloaded rendition
+type VerificationParams struct {
+	ManifestID   core.ManifestID
+	SeqNo        uint64
+	Orchestrator string
+	Profile      ffmpeg.VideoProfile
+	Duration     float64 // of the source segment, in seconds
+	URL          string  // the rendition was downloaded from
+	Data         []byte
+}
+
+// SegmentVerifier verifies renditions as they are downloaded from
+// orchestrators. Renditions failing verification aren't inserted into the
+// playlist; the segment is resubmitted to another orchestrator instead.
+// Verification is disabled if nil.
+var SegmentVerifier Verifier
+
+// Codes classifying verification failures
+const (
+	VerificationErrorFormat     = "Format"
+	VerificationErrorResolution = "Resolution"
+	VerificationErrorBitrate    = "Bitrate"
+	VerificationErrorFramerate  = "Framerate"
+	VerificationErrorRejected   = "Rejected"
+)
+
+// VerificationError is returned for renditions that don't match their profile
+type VerificationError struct {
+	Code   string
+	Reason string
+}
+
+func (e *VerificationError) Error() string {
+	return fmt.Sprintf("verification failed code=%s reason=%s", e.Code, e.Reason)
+}
+
+// LocalVerifier checks the resolution of renditions against their profile,
+// that their bitrate doesn't exceed the profile's by more than
+// BitrateTolerance times and that their frame rate is within
+// FramerateTolerance, a fraction, of the profile's. Zero tolerances disable
+// the checks.
+type LocalVerifier struct {
+	BitrateTolerance   float64
+	FramerateTolerance float64
+}
+
+func (v *LocalVerifier) Verify(params *VerificationParams) error {
+	streams, sps := parseTS(params.Data)
+	if !hasH264(streams) {
+		return &VerificationError{Code: VerificationErrorFormat, Reason: "no H.264 video"}
+	}
+	if sps == nil {
+		return &VerificationError{Code: VerificationErrorFormat, Reason: "no H.264 SPS"}
+	}
+	w, h, err := spsResolution(sps)
+	if err != nil {
+		return &VerificationError{Code: VerificationErrorFormat, Reason: err.Error()}
+	}
+	if res := fmt.Sprintf("%dx%d", w, h); res != params.Profile.Resolution {
+		return &VerificationError{Code: VerificationErrorResolution, Reason: fmt.Sprintf("got %s pixels=%d; expected %s", res, w*h, params.Profile.Resolution)}
+	}
+
+	if expected := float64(params.Profile.Framerate); expected > 0 && v.FramerateTolerance > 0 {
+		fps, err := videoFramerate(params.Data)
+		if err != nil {
+			return &VerificationError{Code: VerificationErrorFormat, Reason: err.Error()}
+		}
+		if math.Abs(fps-expected) > expected*v.FramerateTolerance {
+			return &VerificationError{Code: VerificationErrorFramerate, Reason: fmt.Sprintf("got %.2ffps; expected %.0ffps", fps, expected)}
+		}
+	}
+
+	expected, err := parseBitrate(params.Profile.Bitrate)
+	if err != nil || params.Duration <= 0 || v.BitrateTolerance <= 0 {
+		return nil // nothing to compare against
+	}
+	bitrate := float64(len(params.Data)*8) / params.Duration
+	if bitrate > float64(expected)*v.BitrateTolerance {
+		return &VerificationError{Code: VerificationErrorBitrate, Reason: fmt.Sprintf("got %.0fbps; expected %dbps", bitrate, expected)}
+	}
+	return nil
+}
+
+// parseBitrate parses ffmpeg style bitrates such as 600k into bits per second
+func parseBitrate(s string) (int64, error) {
+	mult := int64(1)
+	switch {
+	case strings.HasSuffix(s, "k"):
+		mult, s = 1000, strings.TrimSuffix(s, "k")
+	case strings.HasSuffix(s, "M"):
+		mult, s = 1000000, strings.TrimSuffix(s, "M")
+	}
+	v, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return v * mult, nil
+}
+
+// ExternalVerifier asks a verification service at URL whether renditions
+// match their profile. The service is posted the rendition parameters as
+// JSON, fetches the rendition from its URL and responds with
+// {"verified": bool, "code": string, "reason": string}.
+type ExternalVerifier struct {
+	URL    string
+	Client *http.Client
+}
+
+// NewExternalVerifier returns a verifier using the service at url
+func NewExternalVerifier(url string) *ExternalVerifier {
+	return &ExternalVerifier{URL: url, Client: &http.Client{Timeout: SegLen}}
+}
+
+type verificationRequest struct {
+	ManifestID   string  `json:"manifestID"`
+	SeqNo        uint64  `json:"seqNo"`
+	Orchestrator string  `json:"orchestrator"`
+	Profile      string  `json:"profile"`
+	Resolution   string  `json:"resolution"`
+	Bitrate      string  `json:"bitrate"`
+	Duration     float64 `json:"duration"`
+	URL          string  `json:"url"`
+}
+
+type verificationResponse struct {
+	Verified bool   `json:"verified"`
+	Code     string `json:"code"`
+	Reason   string `json:"reason"`
+}
+
+func (v *ExternalVerifier) Verify(params *VerificationParams) error {
+	req, err := json.Marshal(&verificationRequest{
+		ManifestID:   string(params.ManifestID),
+		SeqNo:        params.SeqNo,
+		Orchestrator: params.Orchestrator,
+		Profile:      params.Profile.Name,
+		Resolution:   params.Profile.Resolution,
+		Bitrate:      params.Profile.Bitrate,
+		Duration:     params.Duration,
+		URL:          params.URL,
+	})
+	if err != nil {
+		return err
+	}
+	resp, err := v.Client.Post(v.URL, "application/json", bytes.NewBuffer(req))
+	if err != nil {
+		return err
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return errors.New(resp.Status)
+	}
+	var vresp verificationResponse
+	if err := json.Unmarshal(body, &vresp); err != nil {
+		return err
+	}
+	if !vresp.Verified {
+		if vresp.Code == "" {
+			vresp.Code = VerificationErrorRejected
+		}
+		return &VerificationError{Code: vresp.Code, Reason: vresp.Reason}
+	}
+	return nil
+}
+
+// verifySegment runs SegmentVerifier on a downloaded rendition. Returns a
+// *VerificationError if the rendition doesn't match its profile. Renditions
+// the verifier fails to check are accepted so an unavailable verification
+// service doesn't stop the stream.
+func verifySegment(nonce uint64, params *VerificationParams) error {
+	err := SegmentVerifier.Verify(params)
+	verr, mismatch := err.(*VerificationError)
+	if err != nil && !mismatch {
+		glog.Errorf("Error verifying segment manifestID=%s nonce=%d seqNo=%d profile=%s err=%v", params.ManifestID, nonce, params.SeqNo, params.Profile.Name, err)
+		return nil
+	}
+	if monitor.Enabled {
+		if mismatch {
+			monitor.LogSegmentVerificationFailed(nonce, params.SeqNo, params.Orchestrator, params.Profile.Name, verr.Code, verr.Reason)
+		} else {
+			monitor.LogSegmentVerified(params.Orchestrator, params.Profile.Name)
+		}
+	}
+	if mismatch {
+		return verr
+	}
+	return nil
+}
+
+// How often a segment that failed verification checks whether a new
+// orchestrator was selected to resubmit it to
+var sessionChangePollInterval = 100 * time.Millisecond
+
+// awaitSessionChange waits until the stream's session is replaced by one
+// with a different orchestrator than prev, and returns it along with the
+// sessions redundant submissions go to. Returns a nil session if none was
+// selected before deadline.
+func awaitSessionChange(cxn *rtmpConnection, prev *BroadcastSession, deadline time.Time) (*BroadcastSession, []*BroadcastSession) {
+	for {
+		cxn.lock.RLock()
+		sess, redundant := cxn.sess, cxn.redundant
+		cxn.lock.RUnlock()
+		if sess != nil && sess.OrchestratorInfo.GetTranscoder() != prev.OrchestratorInfo.GetTranscoder() {
+			return sess, redundant
+		}
+		if time.Now().Add(sessionChangePollInterval).After(deadline) {
+			return nil, nil
+		}
+		time.Sleep(sessionChangePollInterval)
+	}
+}
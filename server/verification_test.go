@@ -0,0 +1,147 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/livepeer/go-livepeer/net"
+	"github.com/livepeer/lpms/ffmpeg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalVerifier(t *testing.T) {
+	assert := assert.New(t)
+	data, err := ioutil.ReadFile("../core/test.ts")
+	require.Nil(t, err)
+	v := &LocalVerifier{BitrateTolerance: 2}
+	params := &VerificationParams{Profile: ffmpeg.P720p30fps16x9, Duration: 2, Data: data}
+	assert.Nil(v.Verify(params))
+
+	// wrong resolution
+	params.Profile = ffmpeg.P360p30fps16x9
+	err = v.Verify(params)
+	assert.Equal(&VerificationError{Code: VerificationErrorResolution, Reason: "got 1280x720 pixels=921600; expected 640x360"}, err)
+
+	// too high bitrate; the segment is about 8Mb
+	params.Profile = ffmpeg.P720p30fps16x9
+	params.Duration = 1
+	v.BitrateTolerance = 1
+	err = v.Verify(params)
+	require.IsType(t, &VerificationError{}, err)
+	assert.Equal(VerificationErrorBitrate, err.(*VerificationError).Code)
+
+	// bitrate isn't checked without a duration
+	params.Duration = 0
+	assert.Nil(v.Verify(params))
+
+	// the segment is at 25fps
+	v.FramerateTolerance = 0.2
+	assert.Nil(v.Verify(params))
+	v.FramerateTolerance = 0.1
+	err = v.Verify(params)
+	assert.Equal(&VerificationError{Code: VerificationErrorFramerate, Reason: "got 24.99fps; expected 30fps"}, err)
+	// profiles without a frame rate aren't checked
+	params.Profile.Framerate = 0
+	assert.Nil(v.Verify(params))
+
+	// not a video segment
+	params.Data = []byte("dummy")
+	err = v.Verify(params)
+	require.IsType(t, &VerificationError{}, err)
+	assert.Equal(VerificationErrorFormat, err.(*VerificationError).Code)
+}
+
+func TestParseBitrate(t *testing.T) {
+	assert := assert.New(t)
+	for s, expected := range map[string]int64{"600k": 600000, "6M": 6000000, "1500": 1500} {
+		b, err := parseBitrate(s)
+		assert.Nil(err)
+		assert.Equal(expected, b)
+	}
+	_, err := parseBitrate("fast")
+	assert.NotNil(err)
+}
+
+func TestExternalVerifier(t *testing.T) {
+	assert := assert.New(t)
+	var req verificationRequest
+	var resp verificationResponse
+	status := http.StatusOK
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&req)
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(&resp)
+	}))
+	defer ts.Close()
+
+	v := NewExternalVerifier(ts.URL)
+	params := &VerificationParams{ManifestID: "mid", SeqNo: 3, Orchestrator: "https://a:8935", Profile: ffmpeg.P240p30fps16x9, Duration: 2, URL: "https://a:8935/stream/mid/3.ts"}
+	resp.Verified = true
+	assert.Nil(v.Verify(params))
+	assert.Equal(verificationRequest{ManifestID: "mid", SeqNo: 3, Orchestrator: "https://a:8935", Profile: "P240p30fps16x9", Resolution: "426x240", Bitrate: "600k", Duration: 2, URL: "https://a:8935/stream/mid/3.ts"}, req)
+
+	resp = verificationResponse{Verified: false, Reason: "blank frames"}
+	assert.Equal(&VerificationError{Code: VerificationErrorRejected, Reason: "blank frames"}, v.Verify(params))
+
+	// service errors aren't mismatches
+	status = http.StatusInternalServerError
+	err := v.Verify(params)
+	assert.NotNil(err)
+	_, mismatch := err.(*VerificationError)
+	assert.False(mismatch)
+}
+
+type stubVerifier struct {
+	err error
+}
+
+func (v *stubVerifier) Verify(params *VerificationParams) error {
+	return v.err
+}
+
+func TestVerifySegment(t *testing.T) {
+	assert := assert.New(t)
+	defer func(v Verifier) { SegmentVerifier = v }(SegmentVerifier)
+	params := &VerificationParams{Profile: ffmpeg.P144p30fps16x9}
+
+	SegmentVerifier = &stubVerifier{}
+	assert.Nil(verifySegment(1, params))
+
+	verr := &VerificationError{Code: VerificationErrorResolution, Reason: "wrong"}
+	SegmentVerifier = &stubVerifier{err: verr}
+	assert.Equal(verr, verifySegment(1, params))
+
+	// renditions that can't be checked are accepted
+	SegmentVerifier = &stubVerifier{err: errors.New("unavailable")}
+	assert.Nil(verifySegment(1, params))
+}
+
+func TestAwaitSessionChange(t *testing.T) {
+	assert := assert.New(t)
+	defer func(i time.Duration) { sessionChangePollInterval = i }(sessionChangePollInterval)
+	sessionChangePollInterval = 10 * time.Millisecond
+
+	prev := &BroadcastSession{OrchestratorInfo: &net.OrchestratorInfo{Transcoder: "https://a:8935"}}
+	cxn := &rtmpConnection{lock: &sync.RWMutex{}, sess: prev}
+
+	// times out if the orchestrator isn't replaced
+	sess, _ := awaitSessionChange(cxn, prev, time.Now().Add(50*time.Millisecond))
+	assert.Nil(sess)
+
+	next := &BroadcastSession{OrchestratorInfo: &net.OrchestratorInfo{Transcoder: "https://b:8935"}}
+	go func() {
+		time.Sleep(30 * time.Millisecond)
+		cxn.lock.Lock()
+		cxn.sess = next
+		cxn.lock.Unlock()
+	}()
+	sess, _ = awaitSessionChange(cxn, prev, time.Now().Add(time.Second))
+	assert.Equal(next, sess)
+}
@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"math/big"
+	"net"
 	"net/http"
 	"net/url"
 	"strconv"
@@ -737,6 +738,17 @@ func (s *LivepeerServer) StartWebserver(bindAddr string) {
 		w.Write([]byte(fmt.Sprintf("\n\nLatestPlaylist: %v", s.LatestPlaylist())))
 	})
 
+	mux.HandleFunc("/debug/census", func(w http.ResponseWriter, r *http.Request) {
+		if !isLocalRequest(r) {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := monitor.DebugDumpState(w); err != nil {
+			glog.Error("Error dumping monitor state ", err)
+		}
+	})
+
 	mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
 		status := s.GetNodeStatus()
 		if status != nil {
@@ -745,12 +757,22 @@ func (s *LivepeerServer) StartWebserver(bindAddr string) {
 				mstrs[string(mid)] = m.String()
 			}
 			d := struct {
-				Manifests map[string]string
-				Version   string
+				Manifests    map[string]string
+				SuccessRates map[string]float64         `json:",omitempty"`
+				Recordings   map[string]*Recording      `json:",omitempty"`
+				Sessions     map[string]*StreamSessions `json:",omitempty"`
+				Version      string
 			}{
 				Manifests: mstrs,
+				Sessions:  s.sessionStatuses(),
 				Version:   core.LivepeerVersion,
 			}
+			// streams may be recorded at the request of the auth webhook
+			// even without EnableRecording
+			d.Recordings = recordings.get()
+			if monitor.Enabled {
+				d.SuccessRates = s.successRates()
+			}
 			if data, err := json.Marshal(d); err == nil {
 				w.Header().Set("Content-Type", "application/json")
 				w.Write(data)
@@ -759,6 +781,59 @@ func (s *LivepeerServer) StartWebserver(bindAddr string) {
 		}
 	})
 
+	mux.HandleFunc("/admin/orchestrator/suspend", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var req struct {
+			Addr  string    `json:"addr"`
+			Until time.Time `json:"until"` // zero lifts the suspension
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Addr == "" {
+			http.Error(w, "expected JSON body with addr and until", http.StatusBadRequest)
+			return
+		}
+		if req.Until.IsZero() {
+			glog.Infof("Unsuspending orchestrator %s", req.Addr)
+			UnsuspendOrchestrator(req.Addr)
+			return
+		}
+		glog.Infof("Suspending orchestrator %s until %v", req.Addr, req.Until)
+		SuspendOrchestrator(req.Addr, req.Until)
+	})
+
+	mux.HandleFunc("/admin/stream/profiles", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var req struct {
+			ManifestID string   `json:"manifestID"`
+			Profiles   []string `json:"profiles"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ManifestID == "" || len(req.Profiles) == 0 {
+			http.Error(w, "expected JSON body with manifestID and profiles", http.StatusBadRequest)
+			return
+		}
+		profiles := []ffmpeg.VideoProfile{}
+		for _, name := range req.Profiles {
+			p, ok := ffmpeg.VideoProfileLookup[name]
+			if !ok {
+				http.Error(w, fmt.Sprintf("unknown profile %v", name), http.StatusBadRequest)
+				return
+			}
+			profiles = append(profiles, p)
+		}
+		if err := s.setStreamProfiles(core.ManifestID(req.ManifestID), profiles); err == ErrAudioOnly {
+			http.Error(w, "stream has no video to transcode", http.StatusConflict)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+	})
+
 	mux.HandleFunc("/contractAddresses", func(w http.ResponseWriter, r *http.Request) {
 		if s.LivepeerNode.Eth != nil {
 			addrMap := s.LivepeerNode.Eth.ContractAddresses()
@@ -1079,6 +1154,7 @@ func (s *LivepeerServer) StartWebserver(bindAddr string) {
 	})
 
 	mux.Handle("/currentBlock", currentBlockHandler(s.LivepeerNode.Database))
+	mux.Handle("/streamStats", streamStatsHandler(s.LivepeerNode.Database))
 
 	// TicketBroker
 
@@ -1090,13 +1166,45 @@ func (s *LivepeerServer) StartWebserver(bindAddr string) {
 	mux.Handle("/senderInfo", senderInfoHandler(s.LivepeerNode.Eth))
 	mux.Handle("/ticketBrokerParams", ticketBrokerParamsHandler(s.LivepeerNode.Eth))
 
+	// Health
+	mux.Handle("/healthz", healthzHandler())
+	mux.Handle("/readyz", readyzHandler(s))
+
 	// Metrics
 	if monitor.Enabled {
-		mux.Handle("/metrics", monitor.Exporter)
-
+		mux.Handle("/metrics", monitor.MetricsHandler())
+		mux.HandleFunc("/metrics/streams", func(w http.ResponseWriter, r *http.Request) {
+			data, err := json.Marshal(monitor.GetStreamStats())
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.Write(data)
+		})
+		mux.HandleFunc("/metrics/snapshot", func(w http.ResponseWriter, r *http.Request) {
+			data, err := json.Marshal(monitor.GetMetricsSnapshot())
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.Write(data)
+		})
+		mux.Handle("/admin/metrics/groups", metricsGroupsHandler())
 	}
 
 	glog.Info("CLI server listening on ", bindAddr)
 	srv.ListenAndServe()
 
 }
+
+// isLocalRequest checks whether the request comes from the loopback interface
+func isLocalRequest(r *http.Request) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}